@@ -1,11 +1,10 @@
 package ann
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/url"
-	"strconv"
-	"strings"
 )
 
 const (
@@ -56,8 +55,29 @@ func (e *ErrType) Error() string {
 	return fmt.Sprintf("%s called on annotation type %q, expected type %q", e.Op, e.Actual, e.Expected)
 }
 
-func (a *Ann) sortKey() string {
-	return strings.Join([]string{a.Repo, a.CommitID, a.UnitType, a.Unit, a.Type, a.File, strconv.Itoa(int(a.StartLine)), strconv.Itoa(int(a.EndLine))}, ":")
+// annLess reports whether a sorts before b. Line numbers are compared
+// numerically, and annotations that are otherwise equal are ordered
+// by their data.
+func annLess(a, b *Ann) bool {
+	for _, f := range [][2]string{
+		{a.Repo, b.Repo},
+		{a.CommitID, b.CommitID},
+		{a.UnitType, b.UnitType},
+		{a.Unit, b.Unit},
+		{a.Type, b.Type},
+		{a.File, b.File},
+	} {
+		if f[0] != f[1] {
+			return f[0] < f[1]
+		}
+	}
+	if a.StartLine != b.StartLine {
+		return a.StartLine < b.StartLine
+	}
+	if a.EndLine != b.EndLine {
+		return a.EndLine < b.EndLine
+	}
+	return bytes.Compare(a.Data, b.Data) < 0
 }
 
 // Sorting
@@ -66,4 +86,4 @@ type Anns []*Ann
 
 func (vs Anns) Len() int           { return len(vs) }
 func (vs Anns) Swap(i, j int)      { vs[i], vs[j] = vs[j], vs[i] }
-func (vs Anns) Less(i, j int) bool { return vs[i].sortKey() < vs[j].sortKey() }
+func (vs Anns) Less(i, j int) bool { return annLess(vs[i], vs[j]) }
@@ -0,0 +1,126 @@
+// Package approx is a naive fallback toolchain built into srclib. It
+// gives repositories in languages that no installed toolchain analyzes
+// basic symbol search and jump-to-definition instead of nothing.
+//
+// Its scanner (the built-in "approx" scanner, which is run by default;
+// see scan.DefaultBuiltins) emits a source unit for each language it
+// knows (such as Python or Rust) that contains all of the files in
+// that language. Units of languages that other source units have files
+// in (because a toolchain for the language is installed) are dropped
+// after scanning (see RemoveAnalyzed). Its grapher (see
+// grapher.Builtins) finds defs with regexps, as ctags does, and emits
+// refs from identifiers that have the same name as a def.
+//
+// The results are approximate: defs may be missed or spurious, and
+// refs are matched by name alone. So that consumers can tell, the
+// units' Metadata and the defs' Data have a "Fidelity" field whose
+// value is "approximate".
+package approx
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/scan"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+	"sourcegraph.com/sourcegraph/srclib/util"
+)
+
+const (
+	// UnitType is the type of the approximate source units. The units
+	// are named by their language (e.g., "Python").
+	UnitType = "Approximate"
+
+	// FidelityKey is the key of the units' Metadata (and of the
+	// fields of the defs' Data) that tells how accurate their graph
+	// data is, and Approximate is its value for the units and defs of
+	// this toolchain.
+	FidelityKey = "Fidelity"
+	Approximate = "approximate"
+)
+
+func init() {
+	scan.Builtins["approx"] = Scan
+	scan.DefaultBuiltins = append(scan.DefaultBuiltins, "approx")
+	grapher.Builtins[UnitType] = Graph
+}
+
+// Scan returns a source unit for each language that has files in the
+// tree in the current directory. Directories whose names begin with
+// "." or "_" and node_modules, bower_components, and vendor
+// directories are skipped, as are symbolic links.
+func Scan(treeConfig map[string]interface{}) ([]*unit.SourceUnit, error) {
+	files := map[string][]string{} // language name -> files
+	err := util.Walk(".", util.IgnoreSymlinks, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			if name := fi.Name(); p != "." && (name[0] == '.' || name[0] == '_' || name == "node_modules" || name == "bower_components" || name == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		file := filepath.ToSlash(p)
+		if lang := fileLanguage(file); lang != nil {
+			files[lang.name] = append(files[lang.name], file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	units := make([]*unit.SourceUnit, len(names))
+	for i, name := range names {
+		sort.Strings(files[name])
+		units[i] = &unit.SourceUnit{
+			Key: unit.Key{Type: UnitType, Name: name},
+			Info: unit.Info{
+				Dir:      ".",
+				Files:    files[name],
+				Metadata: map[string]string{FidelityKey: Approximate},
+			},
+		}
+	}
+	return units, nil
+}
+
+// RemoveAnalyzed returns units without the approximate units of the
+// languages that the other units have files in (and so that an
+// installed toolchain analyzes).
+func RemoveAnalyzed(units []*unit.SourceUnit) []*unit.SourceUnit {
+	analyzed := map[string]bool{}
+	for _, u := range units {
+		if u.Type == UnitType {
+			continue
+		}
+		for _, file := range u.Files {
+			if lang := fileLanguage(path.Clean(file)); lang != nil {
+				analyzed[lang.name] = true
+			}
+		}
+	}
+	if len(analyzed) == 0 {
+		return units
+	}
+	kept := make([]*unit.SourceUnit, 0, len(units))
+	for _, u := range units {
+		if u.Type == UnitType && analyzed[u.Name] {
+			continue
+		}
+		kept = append(kept, u)
+	}
+	return kept
+}
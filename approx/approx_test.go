@@ -0,0 +1,106 @@
+package approx
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph/graphtest"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func chdirTestdata(t *testing.T) func() {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir("testdata"); err != nil {
+		t.Fatal(err)
+	}
+	return func() { os.Chdir(wd) }
+}
+
+func approxUnit(lang string, files ...string) *unit.SourceUnit {
+	return &unit.SourceUnit{
+		Key:  unit.Key{Type: UnitType, Name: lang},
+		Info: unit.Info{Dir: ".", Files: files, Metadata: map[string]string{FidelityKey: Approximate}},
+	}
+}
+
+func TestScan(t *testing.T) {
+	defer chdirTestdata(t)()
+
+	units, err := Scan(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*unit.SourceUnit{
+		approxUnit("Python", "lib/c.py", "pkg/a.py", "pkg/b.py"),
+		approxUnit("Rust", "lib/lib.rs"),
+	}
+	if !reflect.DeepEqual(units, want) {
+		t.Errorf("got units %+v, want %+v", units, want)
+	}
+}
+
+func TestRemoveAnalyzed(t *testing.T) {
+	py, rs := approxUnit("Python", "a.py"), approxUnit("Rust", "lib.rs")
+	pyPkg := &unit.SourceUnit{Key: unit.Key{Type: "PipPackage", Name: "p"}, Info: unit.Info{Files: []string{"./a.py"}}}
+
+	if got, want := RemoveAnalyzed([]*unit.SourceUnit{py, rs}), []*unit.SourceUnit{py, rs}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := RemoveAnalyzed([]*unit.SourceUnit{py, rs, pyPkg}), []*unit.SourceUnit{rs, pyPkg}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestGraph(t *testing.T) {
+	defer chdirTestdata(t)()
+
+	tests := map[string]struct {
+		unit       *unit.SourceUnit
+		defs, refs []string
+	}{
+		"Python": {
+			unit: approxUnit("Python", "lib/c.py", "pkg/a.py", "pkg/b.py"),
+			defs: []string{"pkg/a.py/DEFAULT", "pkg/a.py/Greeter", "pkg/a.py/greet", "pkg/a.py/helper", "pkg/b.py/greeting", "pkg/b.py/helper"},
+			refs: []string{
+				"DEFAULT -> Python pkg/a.py/DEFAULT",
+				"Greeter -> Python pkg/a.py/Greeter",
+				"Greeter -> Python pkg/a.py/Greeter",
+				"Greeter -> Python pkg/a.py/Greeter",
+				"greet -> Python pkg/a.py/greet",
+				"greet -> Python pkg/a.py/greet",
+				"helper -> Python pkg/a.py/helper",
+				"helper -> Python pkg/b.py/helper",
+			},
+		},
+		"Rust": {
+			unit: approxUnit("Rust", "lib/lib.rs"),
+			defs: []string{"lib/lib.rs/Point", "lib/lib.rs/origin"},
+			refs: []string{
+				"Point -> Rust lib/lib.rs/Point",
+				"Point -> Rust lib/lib.rs/Point",
+			},
+		},
+	}
+	for label, test := range tests {
+		o, err := Graph(test.unit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defs, refs := graphtest.DescribeOutput(t, o)
+		if !reflect.DeepEqual(defs, test.defs) {
+			t.Errorf("%s: got defs %q, want %q", label, defs, test.defs)
+		}
+		if !reflect.DeepEqual(refs, test.refs) {
+			t.Errorf("%s: got refs %q, want %q", label, refs, test.refs)
+		}
+		for _, def := range o.Defs {
+			if string(def.Data) != `{"Fidelity":"approximate"}` {
+				t.Errorf("%s: def %s has Data %s, want the fidelity", label, def.Path, def.Data)
+			}
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package approx
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// fidelityData is the Data of each def that the approximate grapher
+// emits.
+var fidelityData = fmt.Sprintf(`{%q:%q}`, FidelityKey, Approximate)
+
+// identifier matches the identifiers that may be refs.
+var identifier = regexp.MustCompile(`[A-Za-z_$][\w$]*`)
+
+// Graph graphs the approximate source unit u (see UnitType). It emits
+// a def for each match of its language's def patterns in each file
+// (outside of comments and strings); the def path is the file's name
+// followed by "/" and the def's name (with "$2", "$3", etc. appended to
+// the names of later defs with the same name in the same file). Each
+// identifier with the same name as a def is a ref to it; if several
+// defs have the name, the ref is to the def in the same file, or else
+// in the same directory, or else (if only one def has the name) in
+// another directory. Generated files (see graph.IsGenerated) are
+// skipped.
+func Graph(u *unit.SourceUnit) (*graph.Output, error) {
+	type file struct {
+		name string
+		lang *language
+		code []byte // with comments and strings blanked out
+	}
+	var files []*file
+	for _, name := range u.Files {
+		lang := fileLanguage(name)
+		if lang == nil {
+			lang = nameToLanguage[u.Name]
+		}
+		if lang == nil {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.FromSlash(name))
+		if err != nil {
+			return nil, err
+		}
+		if graph.IsGenerated(name, data) {
+			continue
+		}
+		files = append(files, &file{name: name, lang: lang, code: blankNonCode(lang, data)})
+	}
+
+	o := &graph.Output{}
+	byName := map[string][]*graph.Def{}
+	defNames := map[string]map[int]bool{} // file -> start offsets of def names
+	for _, f := range files {
+		defNames[f.name] = map[int]bool{}
+		count := map[string]int{}
+		for _, p := range f.lang.defs {
+			for _, m := range p.re.FindAllSubmatchIndex(f.code, -1) {
+				start, end := m[2], m[3]
+				if start < 0 || defNames[f.name][start] {
+					continue
+				}
+				defNames[f.name][start] = true
+				name := string(f.code[start:end])
+				count[name]++
+				defPath := f.name + "/" + name
+				if n := count[name]; n > 1 {
+					defPath += "$" + strconv.Itoa(n)
+				}
+				def := &graph.Def{
+					DefKey:   graph.DefKey{UnitType: u.Type, Unit: u.Name, Path: defPath},
+					Name:     name,
+					Kind:     p.kind,
+					File:     f.name,
+					DefStart: uint32(skipSpace(f.code, m[0])),
+					DefEnd:   uint32(lineEnd(f.code, end)),
+					Exported: true,
+					Data:     []byte(fidelityData),
+				}
+				o.Defs = append(o.Defs, def)
+				byName[name] = append(byName[name], def)
+				o.Refs = append(o.Refs, &graph.Ref{
+					DefUnitType: u.Type,
+					DefUnit:     u.Name,
+					DefPath:     defPath,
+					UnitType:    u.Type,
+					Unit:        u.Name,
+					Def:         true,
+					File:        f.name,
+					Start:       uint32(start),
+					End:         uint32(end),
+				})
+			}
+		}
+	}
+
+	for _, f := range files {
+		for _, m := range identifier.FindAllIndex(f.code, -1) {
+			start, end := m[0], m[1]
+			if defNames[f.name][start] {
+				continue
+			}
+			def := matchDef(byName[string(f.code[start:end])], f.name)
+			if def == nil {
+				continue
+			}
+			o.Refs = append(o.Refs, &graph.Ref{
+				DefUnitType: u.Type,
+				DefUnit:     u.Name,
+				DefPath:     def.Path,
+				UnitType:    u.Type,
+				Unit:        u.Name,
+				File:        f.name,
+				Start:       uint32(start),
+				End:         uint32(end),
+			})
+		}
+	}
+	return o, nil
+}
+
+// matchDef returns the def (of those with the same name) that a ref in
+// file refers to (see Graph), or nil if there is none.
+func matchDef(defs []*graph.Def, file string) *graph.Def {
+	switch len(defs) {
+	case 0:
+		return nil
+	case 1:
+		return defs[0]
+	}
+	var sameDir *graph.Def
+	dir := path.Dir(file)
+	for _, def := range defs {
+		if def.File == file {
+			return def
+		}
+		if sameDir == nil && path.Dir(def.File) == dir {
+			sameDir = def
+		}
+	}
+	return sameDir
+}
+
+// skipSpace returns the offset of the first byte at or after the
+// offset i in data that isn't a space or tab.
+func skipSpace(data []byte, i int) int {
+	for ; i < len(data) && (data[i] == ' ' || data[i] == '\t'); i++ {
+	}
+	return i
+}
+
+// lineEnd returns the offset of the end of the line that contains the
+// offset i in data.
+func lineEnd(data []byte, i int) int {
+	for ; i < len(data) && data[i] != '\n' && data[i] != '\r'; i++ {
+	}
+	return i
+}
+
+// blankNonCode returns a copy of the file data (in the language lang)
+// with its comments and string literals replaced by spaces (except for
+// newlines), so that offsets in it are offsets in data. It lexes
+// naively, without regard to escaped newlines, nested comments,
+// heredocs, and the like.
+func blankNonCode(lang *language, data []byte) []byte {
+	code := make([]byte, len(data))
+	copy(code, data)
+	for i := 0; i < len(data); {
+		end := nonCodeEnd(lang, data, i)
+		if end == i {
+			i++
+			continue
+		}
+		for ; i < end; i++ {
+			if code[i] != '\n' {
+				code[i] = ' '
+			}
+		}
+	}
+	return code
+}
+
+// nonCodeEnd returns the offset of the end of the comment or string
+// literal that begins at offset i in data, or i if none begins there.
+func nonCodeEnd(lang *language, data []byte, i int) int {
+	rest := data[i:]
+	if lang.blockComments && bytes.HasPrefix(rest, []byte("/*")) {
+		if end := bytes.Index(rest[2:], []byte("*/")); end != -1 {
+			return i + 2 + end + 2
+		}
+		return len(data)
+	}
+	for _, marker := range lang.lineComments {
+		if bytes.HasPrefix(rest, []byte(marker)) {
+			return lineEnd(data, i)
+		}
+	}
+	if q := data[i]; strings.IndexByte(lang.quotes, q) != -1 {
+		for j := i + 1; j < len(data); j++ {
+			switch data[j] {
+			case '\\':
+				j++
+			case q:
+				return j + 1
+			case '\n':
+				if q != '`' {
+					return j
+				}
+			}
+		}
+		return len(data)
+	}
+	return i
+}
@@ -0,0 +1,217 @@
+package approx
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// A language describes how the approximate grapher finds the defs in
+// the files of a language.
+type language struct {
+	name string
+	exts []string
+
+	// lineComments are the markers that begin comments that extend to
+	// the end of the line, and blockComments is whether /* ... */
+	// comments are allowed.
+	lineComments  []string
+	blockComments bool
+
+	// quotes are the characters that delimit string literals. Strings
+	// delimited by "`" may span lines; others end at the end of the
+	// line.
+	quotes string
+
+	// defs are the patterns of the language's definitions. Each
+	// pattern's first group is the def's name.
+	defs []defPattern
+}
+
+type defPattern struct {
+	kind string
+	re   *regexp.Regexp
+}
+
+// pat returns a def pattern for defs of the given kind that matches
+// the regexp (in multi-line mode, so that ^ matches at the beginning of
+// each line).
+func pat(kind, re string) defPattern {
+	return defPattern{kind: kind, re: regexp.MustCompile(`(?m)` + re)}
+}
+
+// Patterns common to several languages.
+var (
+	cStyleComments = []string{"//"}
+	hashComments   = []string{"#"}
+
+	jsDefs = []defPattern{
+		pat(graph.KindFunction, `^[ \t]*(?:export\s+)?(?:default\s+)?(?:async\s+)?function\s*\*?\s*([A-Za-z_$][\w$]*)`),
+		pat(graph.KindClass, `^[ \t]*(?:export\s+)?(?:default\s+)?(?:abstract\s+)?class\s+([A-Za-z_$][\w$]*)`),
+		pat(graph.KindVariable, `^[ \t]*(?:export\s+)?(?:const|let|var)\s+([A-Za-z_$][\w$]*)\s*[=:]`),
+	}
+	javaDefs = []defPattern{
+		pat(graph.KindClass, `^[ \t]*(?:[a-z]+\s+)*(?:class|record|struct)\s+([A-Za-z_]\w*)`),
+		pat(graph.KindInterface, `^[ \t]*(?:[a-z]+\s+)*interface\s+([A-Za-z_]\w*)`),
+		pat(graph.KindEnum, `^[ \t]*(?:[a-z]+\s+)*enum\s+([A-Za-z_]\w*)`),
+		pat(graph.KindMethod, `^[ \t]*(?:(?:public|private|protected|internal|static|final|abstract|synchronized|native|override|virtual|async|sealed|extern|unsafe)\s+)+[\w<>\[\],.?]+(?:\s*<[^>]*>)?\s+([A-Za-z_]\w*)\s*\(`),
+	}
+	cDefs = []defPattern{
+		pat(graph.KindType, `^(?:typedef\s+)?(?:struct|union|class)\s+([A-Za-z_]\w*)\s*(?:[:{]|$)`),
+		pat(graph.KindEnum, `^(?:typedef\s+)?enum\s+(?:class\s+)?([A-Za-z_]\w*)\s*(?:[:{]|$)`),
+		pat(graph.KindType, `^typedef\b[^;(]*?\b([A-Za-z_]\w*)\s*;`),
+		pat(graph.KindConstant, `^[ \t]*#\s*define\s+([A-Za-z_]\w*)`),
+		pat(graph.KindFunction, `^[A-Za-z_][\w \t*&:<>,]*?[ \t*&:]([A-Za-z_]\w*)\s*\([^;]*$`),
+	}
+)
+
+// languages are the languages that the approximate grapher knows.
+// Their names are the same as those that "srclib coverage" and
+// "srclib langs" use. Go isn't listed: its built-in toolchain (see
+// package golang) is used instead.
+var languages = []*language{
+	{
+		name: "Python", exts: []string{".py"}, lineComments: hashComments, quotes: `"'`,
+		defs: []defPattern{
+			pat(graph.KindFunction, `^[ \t]*(?:async\s+)?def\s+([A-Za-z_]\w*)`),
+			pat(graph.KindClass, `^[ \t]*class\s+([A-Za-z_]\w*)`),
+			pat(graph.KindVariable, `^([A-Za-z_]\w*)\s*(?::[^=\n]*)?=[^=]`),
+		},
+	},
+	{
+		name: "Ruby", exts: []string{".rb"}, lineComments: hashComments, quotes: `"'`,
+		defs: []defPattern{
+			pat(graph.KindMethod, `^[ \t]*def\s+(?:self\.)?([A-Za-z_]\w*)`),
+			pat(graph.KindClass, `^[ \t]*class\s+([A-Z]\w*)`),
+			pat(graph.KindModule, `^[ \t]*module\s+([A-Z]\w*)`),
+			pat(graph.KindConstant, `^[ \t]*([A-Z][A-Z0-9_]*)\s*=[^=]`),
+		},
+	},
+	{
+		name: "JavaScript", exts: []string{".js", ".jsx", ".mjs"}, lineComments: cStyleComments, blockComments: true, quotes: "\"'`",
+		defs: jsDefs,
+	},
+	{
+		name: "TypeScript", exts: []string{".ts", ".tsx"}, lineComments: cStyleComments, blockComments: true, quotes: "\"'`",
+		defs: append([]defPattern{
+			pat(graph.KindInterface, `^[ \t]*(?:export\s+)?(?:declare\s+)?interface\s+([A-Za-z_$][\w$]*)`),
+			pat(graph.KindType, `^[ \t]*(?:export\s+)?(?:declare\s+)?type\s+([A-Za-z_$][\w$]*)\s*[=<]`),
+			pat(graph.KindEnum, `^[ \t]*(?:export\s+)?(?:declare\s+)?(?:const\s+)?enum\s+([A-Za-z_$][\w$]*)`),
+		}, jsDefs...),
+	},
+	{
+		name: "Java", exts: []string{".java"}, lineComments: cStyleComments, blockComments: true, quotes: `"'`,
+		defs: javaDefs,
+	},
+	{
+		name: "C#", exts: []string{".cs"}, lineComments: cStyleComments, blockComments: true, quotes: `"'`,
+		defs: javaDefs,
+	},
+	{
+		name: "C", exts: []string{".c", ".h"}, lineComments: cStyleComments, blockComments: true, quotes: `"'`,
+		defs: cDefs,
+	},
+	{
+		name: "C++", exts: []string{".cpp", ".cc", ".cxx", ".c++", ".hpp", ".hh", ".hxx"}, lineComments: cStyleComments, blockComments: true, quotes: `"'`,
+		defs: cDefs,
+	},
+	{
+		name: "Objective-C", exts: []string{".m", ".mm"}, lineComments: cStyleComments, blockComments: true, quotes: `"'`,
+		defs: append([]defPattern{
+			pat(graph.KindClass, `^@(?:interface|implementation|protocol)\s+([A-Za-z_]\w*)`),
+			pat(graph.KindMethod, `^[-+]\s*\([^)]*\)\s*([A-Za-z_]\w*)`),
+		}, cDefs...),
+	},
+	{
+		name: "PHP", exts: []string{".php"}, lineComments: []string{"//", "#"}, blockComments: true, quotes: `"'`,
+		defs: []defPattern{
+			pat(graph.KindFunction, `^[ \t]*(?:(?:public|private|protected|static|abstract|final)\s+)*function\s+&?([A-Za-z_]\w*)`),
+			pat(graph.KindClass, `^[ \t]*(?:(?:abstract|final)\s+)?(?:class|trait)\s+([A-Za-z_]\w*)`),
+			pat(graph.KindInterface, `^[ \t]*interface\s+([A-Za-z_]\w*)`),
+		},
+	},
+	{
+		name: "Shell", exts: []string{".sh", ".bash"}, lineComments: hashComments, quotes: `"'`,
+		defs: []defPattern{
+			pat(graph.KindFunction, `^[ \t]*function\s+([A-Za-z_][\w]*)`),
+			pat(graph.KindFunction, `^[ \t]*([A-Za-z_]\w*)\s*\(\s*\)`),
+		},
+	},
+	{
+		name: "Rust", exts: []string{".rs"}, lineComments: cStyleComments, blockComments: true, quotes: `"`,
+		defs: []defPattern{
+			pat(graph.KindFunction, `^[ \t]*(?:pub(?:\([^)]*\))?\s+)?(?:(?:async|const|unsafe|extern(?:\s+"[^"]*")?)\s+)*fn\s+([A-Za-z_]\w*)`),
+			pat(graph.KindType, `^[ \t]*(?:pub(?:\([^)]*\))?\s+)?(?:struct|union|type)\s+([A-Za-z_]\w*)`),
+			pat(graph.KindEnum, `^[ \t]*(?:pub(?:\([^)]*\))?\s+)?enum\s+([A-Za-z_]\w*)`),
+			pat(graph.KindInterface, `^[ \t]*(?:pub(?:\([^)]*\))?\s+)?(?:unsafe\s+)?trait\s+([A-Za-z_]\w*)`),
+			pat(graph.KindModule, `^[ \t]*(?:pub(?:\([^)]*\))?\s+)?mod\s+([A-Za-z_]\w*)`),
+			pat(graph.KindConstant, `^[ \t]*(?:pub(?:\([^)]*\))?\s+)?(?:const|static(?:\s+mut)?)\s+([A-Za-z_]\w*)\s*:`),
+			pat(graph.KindFunction, `^[ \t]*macro_rules!\s*([A-Za-z_]\w*)`),
+		},
+	},
+	{
+		name: "Kotlin", exts: []string{".kt", ".kts"}, lineComments: cStyleComments, blockComments: true, quotes: `"'`,
+		defs: []defPattern{
+			pat(graph.KindFunction, `^[ \t]*(?:[a-z]+\s+)*fun\s+(?:<[^>]*>\s*)?(?:[\w.]+\.)?([A-Za-z_]\w*)`),
+			pat(graph.KindClass, `^[ \t]*(?:[a-z]+\s+)*(?:class|object)\s+([A-Za-z_]\w*)`),
+			pat(graph.KindInterface, `^[ \t]*(?:[a-z]+\s+)*interface\s+([A-Za-z_]\w*)`),
+		},
+	},
+	{
+		name: "Scala", exts: []string{".scala"}, lineComments: cStyleComments, blockComments: true, quotes: `"`,
+		defs: []defPattern{
+			pat(graph.KindFunction, `^[ \t]*(?:[a-z]+\s+)*def\s+([A-Za-z_]\w*)`),
+			pat(graph.KindClass, `^[ \t]*(?:[a-z]+\s+)*(?:class|object)\s+([A-Za-z_]\w*)`),
+			pat(graph.KindInterface, `^[ \t]*(?:[a-z]+\s+)*trait\s+([A-Za-z_]\w*)`),
+		},
+	},
+	{
+		name: "Swift", exts: []string{".swift"}, lineComments: cStyleComments, blockComments: true, quotes: `"`,
+		defs: []defPattern{
+			pat(graph.KindFunction, `^[ \t]*(?:[@a-z]+\s+)*func\s+([A-Za-z_]\w*)`),
+			pat(graph.KindClass, `^[ \t]*(?:[@a-z]+\s+)*(?:class|struct)\s+([A-Za-z_]\w*)`),
+			pat(graph.KindEnum, `^[ \t]*(?:[@a-z]+\s+)*enum\s+([A-Za-z_]\w*)`),
+			pat(graph.KindInterface, `^[ \t]*(?:[@a-z]+\s+)*protocol\s+([A-Za-z_]\w*)`),
+		},
+	},
+	{
+		name: "Lua", exts: []string{".lua"}, lineComments: []string{"--"}, quotes: `"'`,
+		defs: []defPattern{
+			pat(graph.KindFunction, `^[ \t]*(?:local\s+)?function\s+(?:[\w.]+[.:])?([A-Za-z_]\w*)`),
+		},
+	},
+	{
+		name: "Perl", exts: []string{".pl", ".pm"}, lineComments: hashComments, quotes: `"'`,
+		defs: []defPattern{
+			pat(graph.KindFunction, `^[ \t]*sub\s+([A-Za-z_]\w*)`),
+			pat(graph.KindModule, `^[ \t]*package\s+(?:\w+::)*(\w+)`),
+		},
+	},
+	{
+		name: "Elixir", exts: []string{".ex", ".exs"}, lineComments: hashComments, quotes: `"'`,
+		defs: []defPattern{
+			pat(graph.KindFunction, `^[ \t]*def(?:p|macro|macrop)?\s+([a-z_]\w*)`),
+			pat(graph.KindModule, `^[ \t]*defmodule\s+(?:[\w]+\.)*(\w+)`),
+		},
+	},
+}
+
+var extToLanguage = map[string]*language{}
+var nameToLanguage = map[string]*language{}
+
+func init() {
+	for _, lang := range languages {
+		nameToLanguage[lang.name] = lang
+		for _, ext := range lang.exts {
+			extToLanguage[ext] = lang
+		}
+	}
+}
+
+// fileLanguage returns the language of the file (by its extension),
+// or nil if the approximate grapher doesn't know it.
+func fileLanguage(file string) *language {
+	return extToLanguage[strings.ToLower(path.Ext(file))]
+}
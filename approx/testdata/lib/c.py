@@ -0,0 +1,3 @@
+from pkg.a import Greeter, helper
+
+helper(Greeter().greet("c"))
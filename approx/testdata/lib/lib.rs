@@ -0,0 +1,4 @@
+/* fn hidden() {} */
+pub struct Point { x: i32 }
+
+pub fn origin() -> Point { Point { x: 0 } }
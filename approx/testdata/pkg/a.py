@@ -0,0 +1,9 @@
+# helper() is documented here, but this isn't a ref.
+class Greeter:
+    def greet(self, name):
+        return helper("hello, " + name)
+
+def helper(s):
+    return s
+
+DEFAULT = Greeter()
@@ -0,0 +1,4 @@
+def helper(s):
+    return "helper: " + s
+
+greeting = helper(DEFAULT.greet("b"))
@@ -0,0 +1,156 @@
+// Package authorship computes the authors of defs (using "git blame"
+// or the equivalent) so that "who owns this symbol" questions can be
+// answered from build data.
+//
+// Computing authorship is an optional build step that runs after
+// graphing. It is enabled for a source unit by setting the
+// "srclib.Blame" key (ConfigKey) to "true" in the unit's Config (e.g.,
+// in the Srcfile's Config or UnitOverrides). The authors are imported
+// into the store along with the unit's defs (see graph.Def.Authors).
+package authorship
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+	"sourcegraph.com/sourcegraph/srclib/vcs"
+)
+
+// ConfigKey is the key in a source unit's Config that enables
+// computing authorship for the unit's defs (if its value is "true").
+const ConfigKey = "srclib.Blame"
+
+// Enabled reports whether computing authorship is enabled for u.
+func Enabled(u *unit.SourceUnit) bool {
+	return u.Config[ConfigKey] == "true"
+}
+
+// Output is the authorship build data for a source unit.
+type Output struct {
+	Defs []*DefAuthors
+}
+
+// DefAuthors lists the authors of a def, in descending order of the
+// number of lines of the def that they last changed.
+type DefAuthors struct {
+	Path    string // def path (unique within the source unit)
+	Authors []*graph.DefAuthor
+}
+
+// Compute computes the authors of each def, using v to blame the
+// defs' files (which are relative to dir). Defs in files that can't
+// be blamed (e.g., because they are not committed) are omitted.
+func Compute(dir string, v vcs.VCS, defs []*graph.Def) (*Output, error) {
+	byFile := map[string][]*graph.Def{}
+	var files []string
+	for _, def := range defs {
+		if def.File == "" || def.DefEnd <= def.DefStart {
+			continue
+		}
+		if _, seen := byFile[def.File]; !seen {
+			files = append(files, def.File)
+		}
+		byFile[def.File] = append(byFile[def.File], def)
+	}
+	sort.Strings(files)
+
+	o := &Output{}
+	for _, file := range files {
+		src, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(file)))
+		if err != nil {
+			continue
+		}
+		hunks, err := v.Blame(dir, file)
+		if err != nil || len(hunks) == 0 {
+			continue
+		}
+		for _, def := range byFile[file] {
+			start, end := LineOf(src, def.DefStart), LineOf(src, def.DefEnd-1)
+			if authors := authorsOfLines(hunks, start, end); len(authors) > 0 {
+				o.Defs = append(o.Defs, &DefAuthors{Path: def.Path, Authors: authors})
+			}
+		}
+	}
+	return o, nil
+}
+
+// LineOf returns the 1-indexed line number of the byte offset off in
+// src.
+func LineOf(src []byte, off uint32) int {
+	if int(off) > len(src) {
+		off = uint32(len(src))
+	}
+	line := 1
+	for _, c := range src[:off] {
+		if c == '\n' {
+			line++
+		}
+	}
+	return line
+}
+
+// authorsOfLines returns the authors of lines start through end
+// (inclusive) according to hunks.
+func authorsOfLines(hunks []vcs.BlameHunk, start, end int) []*graph.DefAuthor {
+	byEmail := map[string]*graph.DefAuthor{}
+	lastDate := map[string]time.Time{}
+	var authors []*graph.DefAuthor
+	for _, h := range hunks {
+		lo, hi := h.StartLine, h.EndLine
+		if lo < start {
+			lo = start
+		}
+		if hi > end {
+			hi = end
+		}
+		if lo > hi {
+			continue
+		}
+		key := h.AuthorEmail
+		if key == "" {
+			key = h.Author
+		}
+		a := byEmail[key]
+		if a == nil {
+			a = &graph.DefAuthor{Name: h.Author, Email: h.AuthorEmail}
+			byEmail[key] = a
+			authors = append(authors, a)
+		}
+		a.Lines += uint32(hi - lo + 1)
+		if d := lastDate[key]; a.LastCommitID == "" || h.AuthorDate.After(d) {
+			a.LastCommitID = h.CommitID
+			a.LastCommitDate = h.AuthorDate.Format(time.RFC3339)
+			lastDate[key] = h.AuthorDate
+		}
+	}
+	sort.Sort(authorsByLines(authors))
+	return authors
+}
+
+type authorsByLines []*graph.DefAuthor
+
+func (v authorsByLines) Len() int      { return len(v) }
+func (v authorsByLines) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v authorsByLines) Less(i, j int) bool {
+	if v[i].Lines != v[j].Lines {
+		return v[i].Lines > v[j].Lines
+	}
+	return v[i].Email < v[j].Email
+}
+
+// Apply sets the Authors of each def in defs that o lists authors for.
+func Apply(defs []*graph.Def, o *Output) {
+	byPath := make(map[string][]*graph.DefAuthor, len(o.Defs))
+	for _, d := range o.Defs {
+		byPath[d.Path] = d.Authors
+	}
+	for _, def := range defs {
+		if authors, present := byPath[def.Path]; present {
+			def.Authors = authors
+		}
+	}
+}
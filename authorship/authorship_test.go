@@ -0,0 +1,43 @@
+package authorship
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/vcs"
+)
+
+func TestAuthorsOfLines(t *testing.T) {
+	d1 := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	d2 := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	hunks := []vcs.BlameHunk{
+		{StartLine: 1, EndLine: 3, CommitID: "c1", Author: "Alice", AuthorEmail: "alice@example.com", AuthorDate: d1},
+		{StartLine: 4, EndLine: 4, CommitID: "c2", Author: "Bob", AuthorEmail: "bob@example.com", AuthorDate: d2},
+		{StartLine: 5, EndLine: 9, CommitID: "c3", Author: "Alice", AuthorEmail: "alice@example.com", AuthorDate: d2},
+	}
+
+	got := authorsOfLines(hunks, 3, 6)
+	want := []*graph.DefAuthor{
+		{Name: "Alice", Email: "alice@example.com", LastCommitID: "c3", LastCommitDate: "2015-06-01T00:00:00Z", Lines: 3},
+		{Name: "Bob", Email: "bob@example.com", LastCommitID: "c2", LastCommitDate: "2015-06-01T00:00:00Z", Lines: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got authors %+v, want %+v", got, want)
+	}
+
+	if got := authorsOfLines(hunks, 10, 12); len(got) != 0 {
+		t.Errorf("got authors %+v for lines outside of all hunks, want none", got)
+	}
+}
+
+func TestLineOf(t *testing.T) {
+	src := []byte("a\nbc\n\nd")
+	tests := map[uint32]int{0: 1, 1: 1, 2: 2, 4: 2, 5: 3, 6: 4, 100: 4}
+	for off, want := range tests {
+		if got := LineOf(src, off); got != want {
+			t.Errorf("LineOf(%d): got %d, want %d", off, got, want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package authorship
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"sourcegraph.com/sourcegraph/makex"
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+	"sourcegraph.com/sourcegraph/srclib/util"
+)
+
+const blameOp = "blame"
+
+func init() {
+	plan.RegisterRuleMaker(blameOp, makeBlameRules)
+	buildstore.RegisterDataType("blame", &Output{})
+}
+
+// makeBlameRules makes a BlameDefsRule for each source unit with
+// authorship enabled that is graphed by one of the existing rules.
+func makeBlameRules(c *config.Tree, dataDir string, existing []makex.Rule) ([]makex.Rule, error) {
+	var rules []makex.Rule
+	for _, r := range existing {
+		switch r := r.(type) {
+		case *grapher.GraphUnitRule:
+			if Enabled(r.Unit) {
+				rules = append(rules, &BlameDefsRule{dataDir, r.Unit, r.Target(), r.Target()})
+			}
+		case *grapher.GraphMultiUnitsRule:
+			for graphFile, u := range r.Targets() {
+				if Enabled(u) {
+					rules = append(rules, &BlameDefsRule{dataDir, u, graphFile, r.Target()})
+				}
+			}
+		}
+	}
+	return rules, nil
+}
+
+// A BlameDefsRule computes the authors of a source unit's defs.
+type BlameDefsRule struct {
+	dataDir   string
+	Unit      *unit.SourceUnit
+	GraphFile string // graph output file of the unit
+	graphRule string // target of the rule that creates GraphFile
+}
+
+func (r *BlameDefsRule) Target() string {
+	return filepath.ToSlash(filepath.Join(r.dataDir, plan.SourceUnitDataFilename(&Output{}, r.Unit)))
+}
+
+func (r *BlameDefsRule) Prereqs() []string {
+	return []string{r.graphRule}
+}
+
+func (r *BlameDefsRule) Recipes() []string {
+	return []string{
+		fmt.Sprintf("%s internal blame-defs %s 1> $@", util.SafeCommandName(srclib.CommandName), plan.ShellQuote(r.GraphFile)),
+	}
+}
@@ -0,0 +1,110 @@
+package buildstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+)
+
+// ArtifactsManifestName is the name of the file, in a commit's build
+// data directory, that "srclib make" writes after it succeeds, listing
+// the commit's build data files (see ArtifactsManifest).
+const ArtifactsManifestName = "artifacts.json"
+
+// An ArtifactsManifest lists the build data files for a commit and
+// which Makefile rules produced them, so that consumers don't need to
+// guess which files belong to which source unit.
+type ArtifactsManifest struct {
+	CommitID  string
+	Artifacts []*Artifact
+}
+
+// An Artifact is a build data file.
+type Artifact struct {
+	// Path is the file's path relative to the commit's build data
+	// directory (with forward slashes).
+	Path string
+
+	Size     int64
+	Checksum string // hex-encoded SHA-256 hash of the contents
+
+	// DataType is the registered data type of the file (see
+	// DataType), if any.
+	DataType string `json:",omitempty"`
+
+	// ArtifactProducer describes the rule that produced the file. It
+	// is empty for files that weren't produced by a rule in the
+	// Makefile that was last run (such as the cached config).
+	ArtifactProducer
+}
+
+// An ArtifactProducer describes the Makefile rule that produced a
+// build data file.
+type ArtifactProducer struct {
+	// Rule is the target of the rule (as in the Makefile).
+	Rule string `json:",omitempty"`
+
+	// UnitType and Unit identify the source unit that the file
+	// contains data for, if any.
+	UnitType string `json:",omitempty"`
+	Unit     string `json:",omitempty"`
+
+	// Duration is how long the tool that the rule ran took (as
+	// recorded in its log), if known.
+	Duration time.Duration `json:",omitempty"`
+}
+
+// ListArtifacts lists the build data files in a commit's build data
+// directory (except for the sync and artifacts manifests), in path
+// order. Each file that is a key in producers is attributed to the
+// rule that it maps to.
+func ListArtifacts(commitFS rwvfs.WalkableFileSystem, producers map[string]*ArtifactProducer) ([]*Artifact, error) {
+	files, err := commitFiles(commitFS)
+	if err != nil {
+		return nil, err
+	}
+	var artifacts []*Artifact
+	for _, file := range files {
+		if file == ArtifactsManifestName {
+			continue
+		}
+		data, err := readFile(commitFS, file)
+		if err != nil {
+			return nil, err
+		}
+		a := &Artifact{Path: file, Size: int64(len(data)), Checksum: checksum(data)}
+		a.DataType, _ = DataType(file)
+		if p := producers[file]; p != nil {
+			a.ArtifactProducer = *p
+		}
+		artifacts = append(artifacts, a)
+	}
+	return artifacts, nil
+}
+
+// WriteArtifactsManifest writes m to a commit's build data directory,
+// replacing any existing artifacts manifest.
+func WriteArtifactsManifest(commitFS rwvfs.FileSystem, m *ArtifactsManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(commitFS, ArtifactsManifestName, data)
+}
+
+// ReadArtifactsManifest reads the artifacts manifest in a commit's
+// build data directory. If there is none, it returns an error
+// satisfying os.IsNotExist.
+func ReadArtifactsManifest(commitFS rwvfs.FileSystem) (*ArtifactsManifest, error) {
+	data, err := readFile(commitFS, ArtifactsManifestName)
+	if err != nil {
+		return nil, err
+	}
+	var m ArtifactsManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %s", ArtifactsManifestName, err)
+	}
+	return &m, nil
+}
@@ -0,0 +1,57 @@
+package buildstore
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+)
+
+func TestArtifactsManifest(t *testing.T) {
+	files := map[string]string{
+		"c1/a.unit.json":         "a",
+		"c1/x/b.graph.json":      "bb",
+		"c1/" + SyncManifestName: "{}",
+	}
+	commitFS := Repo(rwvfs.Walkable(rwvfs.Map(files))).Commit("c1")
+
+	if _, err := ReadArtifactsManifest(commitFS); !os.IsNotExist(err) {
+		t.Errorf("got error %v, want not-exist error", err)
+	}
+
+	producers := map[string]*ArtifactProducer{
+		"x/b.graph.json": {Rule: ".srclib-cache/c1/x/b.graph.json", UnitType: "t", Unit: "x", Duration: time.Second},
+	}
+	artifacts, err := ListArtifacts(commitFS, producers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Artifact{
+		{Path: "a.unit.json", Size: 1, Checksum: checksum([]byte("a"))},
+		{Path: "x/b.graph.json", Size: 2, Checksum: checksum([]byte("bb")), ArtifactProducer: *producers["x/b.graph.json"]},
+	}
+	if !reflect.DeepEqual(artifacts, want) {
+		t.Errorf("got artifacts %+v, want %+v", artifacts, want)
+	}
+
+	m := &ArtifactsManifest{CommitID: "c1", Artifacts: artifacts}
+	if err := WriteArtifactsManifest(commitFS, m); err != nil {
+		t.Fatal(err)
+	}
+	m2, err := ReadArtifactsManifest(commitFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m2, m) {
+		t.Errorf("got manifest %+v, want %+v", m2, m)
+	}
+
+	// The manifest doesn't list itself.
+	if artifacts, err := ListArtifacts(commitFS, nil); err != nil {
+		t.Fatal(err)
+	} else if len(artifacts) != 2 {
+		t.Errorf("got %d artifacts, want 2", len(artifacts))
+	}
+}
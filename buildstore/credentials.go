@@ -0,0 +1,495 @@
+package buildstore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Credentials authenticate requests to a remote build store (or
+// another endpoint that srclib uploads to, such as a Prometheus
+// Pushgateway). Which fields are used depends on the endpoint: S3
+// stores use the AWS keys, and HTTP(S) endpoints use Token (as a
+// bearer token) or, if it's empty, Username and Password (with basic
+// authentication).
+type Credentials struct {
+	AccessKeyID     string `json:",omitempty"`
+	SecretAccessKey string `json:",omitempty"`
+	SessionToken    string `json:",omitempty"`
+
+	Token string `json:",omitempty"`
+
+	Username string `json:",omitempty"`
+	Password string `json:",omitempty"`
+}
+
+// usableFor reports whether c has the credentials that requests to
+// the endpoint at u need.
+func (c *Credentials) usableFor(u *url.URL) bool {
+	if u.Scheme == "s3" {
+		return c.AccessKeyID != ""
+	}
+	return c.Token != "" || c.Username != ""
+}
+
+// A CredentialHelper provides credentials for remote endpoints.
+type CredentialHelper interface {
+	// Credentials returns the credentials for the endpoint at u (an
+	// s3, http, or https URL), or nil if it has none for u.
+	Credentials(u *url.URL) (*Credentials, error)
+}
+
+// CredentialHelperFunc is a func that implements CredentialHelper.
+type CredentialHelperFunc func(u *url.URL) (*Credentials, error)
+
+func (f CredentialHelperFunc) Credentials(u *url.URL) (*Credentials, error) { return f(u) }
+
+// CredentialHelpers are the names of the credential helpers that are
+// asked for credentials, in order, by LookupCredentials. Besides the
+// registered helpers (see RegisterCredentialHelper), a name may be
+// "exec:PROGRAM", which runs PROGRAM with the endpoint's URL as its
+// argument; PROGRAM prints the Credentials as JSON, or nothing if it
+// has none for the URL.
+//
+// It is initialized from the SRCLIB_CREDENTIAL_HELPERS environment
+// variable (a comma-separated list), so that credentials are
+// configured once for all commands. The default is "env,aws,gcp,netrc".
+var CredentialHelpers = credentialHelpersFromEnv(os.Getenv("SRCLIB_CREDENTIAL_HELPERS"))
+
+func credentialHelpersFromEnv(v string) []string {
+	if v == "" {
+		return []string{"env", "aws", "gcp", "netrc"}
+	}
+	var names []string
+	for _, name := range strings.Split(v, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+var credentialHelpers = map[string]CredentialHelper{}
+
+// RegisterCredentialHelper makes a credential helper available by
+// name, for use in CredentialHelpers. If RegisterCredentialHelper is
+// called twice with the same name, or if h is nil, it panics.
+func RegisterCredentialHelper(name string, h CredentialHelper) {
+	if _, dup := credentialHelpers[name]; dup {
+		panic("buildstore: RegisterCredentialHelper called twice for name " + name)
+	}
+	if h == nil {
+		panic("buildstore: RegisterCredentialHelper helper is nil")
+	}
+	credentialHelpers[name] = h
+}
+
+func init() {
+	RegisterCredentialHelper("env", CredentialHelperFunc(envCredentials))
+	RegisterCredentialHelper("aws", CredentialHelperFunc(awsCredentials))
+	RegisterCredentialHelper("gcp", CredentialHelperFunc(gcpCredentials))
+	RegisterCredentialHelper("netrc", CredentialHelperFunc(netrcCredentials))
+}
+
+// LookupCredentials asks each of the CredentialHelpers, in order, for
+// the credentials for the endpoint at u, and returns the first that
+// are usable for it. If no helper has any, it returns nil.
+func LookupCredentials(u *url.URL) (*Credentials, error) {
+	for _, name := range CredentialHelpers {
+		var h CredentialHelper
+		if strings.HasPrefix(name, "exec:") {
+			h = execCredentialHelper(strings.TrimPrefix(name, "exec:"))
+		} else if h = credentialHelpers[name]; h == nil {
+			return nil, fmt.Errorf("unknown credential helper %q in $SRCLIB_CREDENTIAL_HELPERS", name)
+		}
+		c, err := h.Credentials(u)
+		if err != nil {
+			return nil, fmt.Errorf("credential helper %s: %s", name, err)
+		}
+		if c != nil && c.usableFor(u) {
+			return c, nil
+		}
+	}
+	return nil, nil
+}
+
+// HTTPClient returns an HTTP client that authenticates its requests
+// with the credentials for the HTTP(S) endpoint at u (see
+// LookupCredentials), or http.DefaultClient if there are none.
+func HTTPClient(u *url.URL) (*http.Client, error) {
+	c, err := LookupCredentials(u)
+	if err != nil || c == nil {
+		return http.DefaultClient, err
+	}
+	return &http.Client{Transport: &credentialsTransport{creds: c, host: u.Host}}, nil
+}
+
+// credentialsTransport adds an Authorization header (from creds) to
+// requests to host (but not to other hosts that they are redirected
+// to).
+type credentialsTransport struct {
+	creds *Credentials
+	host  string
+	base  http.RoundTripper // default: http.DefaultTransport
+}
+
+func (t *credentialsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.URL.Host != t.host || req.Header.Get("Authorization") != "" {
+		return base.RoundTrip(req)
+	}
+	req2 := new(http.Request)
+	*req2 = *req
+	req2.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		req2.Header[k] = v
+	}
+	if t.creds.Token != "" {
+		req2.Header.Set("Authorization", "Bearer "+t.creds.Token)
+	} else {
+		req2.SetBasicAuth(t.creds.Username, t.creds.Password)
+	}
+	return base.RoundTrip(req2)
+}
+
+// envCredentials reads credentials from environment variables:
+// $AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY, and $AWS_SESSION_TOKEN
+// for S3, and $SRCLIB_BUILDSTORE_TOKEN or $SRCLIB_BUILDSTORE_USERNAME
+// and $SRCLIB_BUILDSTORE_PASSWORD for HTTP(S).
+func envCredentials(u *url.URL) (*Credentials, error) {
+	if u.Scheme == "s3" {
+		return &Credentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+	return &Credentials{
+		Token:    os.Getenv("SRCLIB_BUILDSTORE_TOKEN"),
+		Username: os.Getenv("SRCLIB_BUILDSTORE_USERNAME"),
+		Password: os.Getenv("SRCLIB_BUILDSTORE_PASSWORD"),
+	}, nil
+}
+
+// metadataClient is the client for requests to cloud instance
+// metadata services, which aren't reachable (and time out quickly)
+// outside of the cloud.
+var metadataClient = &http.Client{Timeout: time.Second}
+
+// awsCredentials provides S3 credentials from the AWS shared
+// credentials file ($AWS_SHARED_CREDENTIALS_FILE, or
+// ~/.aws/credentials) for the profile $AWS_PROFILE (default:
+// "default"), or else from the ECS container credentials endpoint or
+// the EC2 instance metadata service, as the AWS SDKs' default
+// credential chain does.
+func awsCredentials(u *url.URL) (*Credentials, error) {
+	if u.Scheme != "s3" {
+		return nil, nil
+	}
+	file := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if file == "" {
+		if home := homeDir(); home != "" {
+			file = filepath.Join(home, ".aws", "credentials")
+		}
+	}
+	if file != "" {
+		profile := os.Getenv("AWS_PROFILE")
+		if profile == "" {
+			profile = "default"
+		}
+		c, err := readAWSCredentialsFile(file, profile)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if c != nil {
+			return c, nil
+		}
+	}
+
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		return fetchAWSCredentials(metadataClient, "http://169.254.170.2"+uri, nil)
+	}
+	return ec2Credentials(metadataClient, "http://169.254.169.254")
+}
+
+// readAWSCredentialsFile reads the credentials of profile from an AWS
+// shared credentials file (an INI file with a section for each
+// profile). If the profile isn't in the file, it returns nil.
+func readAWSCredentialsFile(file, profile string) (*Credentials, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var c *Credentials
+	inProfile := false
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			inProfile = strings.TrimSpace(line[1:len(line)-1]) == profile
+			if inProfile && c == nil {
+				c = &Credentials{}
+			}
+			continue
+		}
+		if !inProfile {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i == -1 {
+			continue
+		}
+		v := strings.TrimSpace(line[i+1:])
+		switch strings.TrimSpace(line[:i]) {
+		case "aws_access_key_id":
+			c.AccessKeyID = v
+		case "aws_secret_access_key":
+			c.SecretAccessKey = v
+		case "aws_session_token":
+			c.SessionToken = v
+		}
+	}
+	return c, s.Err()
+}
+
+// ec2Credentials gets the credentials of the EC2 instance's role from
+// the instance metadata service (IMDSv2) at endpoint. If the service
+// can't be reached (e.g., because this isn't an EC2 instance), it
+// returns nil.
+func ec2Credentials(client *http.Client, endpoint string) (*Credentials, error) {
+	req, err := http.NewRequest("PUT", endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "60")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil
+	}
+	token, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return nil, nil
+	}
+	header := http.Header{"X-Aws-Ec2-Metadata-Token": {string(token)}}
+
+	rolesURL := endpoint + "/latest/meta-data/iam/security-credentials/"
+	req, err = http.NewRequest("GET", rolesURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	resp, err = client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil // no role
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", rolesURL, resp.Status)
+	}
+	role := strings.TrimSpace(strings.SplitN(string(roles), "\n", 2)[0])
+	if role == "" {
+		return nil, nil
+	}
+	return fetchAWSCredentials(client, rolesURL+role, header)
+}
+
+// fetchAWSCredentials gets temporary credentials from an ECS or EC2
+// credentials endpoint.
+func fetchAWSCredentials(client *http.Client, credsURL string, header http.Header) (*Credentials, error) {
+	req, err := http.NewRequest("GET", credsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if header != nil {
+		req.Header = header
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", credsURL, resp.Status)
+	}
+	var v struct{ AccessKeyId, SecretAccessKey, Token string }
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return nil, fmt.Errorf("GET %s: %s", credsURL, err)
+	}
+	return &Credentials{AccessKeyID: v.AccessKeyId, SecretAccessKey: v.SecretAccessKey, SessionToken: v.Token}, nil
+}
+
+// gcpCredentials provides an OAuth2 access token for Google Cloud
+// endpoints (https://*.googleapis.com, such as Cloud Storage's XML
+// API) from the application default credentials (with "gcloud auth
+// application-default print-access-token") or else from the GCE
+// metadata server. The token isn't sent to other hosts.
+func gcpCredentials(u *url.URL) (*Credentials, error) {
+	if u.Scheme != "https" || !strings.HasSuffix(hostname(u), ".googleapis.com") {
+		return nil, nil
+	}
+	if _, err := exec.LookPath("gcloud"); err == nil {
+		var stderr bytes.Buffer
+		cmd := exec.Command("gcloud", "auth", "application-default", "print-access-token")
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("gcloud auth application-default print-access-token: %s: %s", err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		return &Credentials{Token: strings.TrimSpace(string(out))}, nil
+	}
+
+	req, err := http.NewRequest("GET", "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return nil, nil // not on GCE
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil
+	}
+	var v struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return nil, err
+	}
+	return &Credentials{Token: v.AccessToken}, nil
+}
+
+// netrcCredentials provides the login and password for the endpoint's
+// host (or the default) in the netrc file ($NETRC, or ~/.netrc), for
+// HTTP(S) basic authentication.
+func netrcCredentials(u *url.URL) (*Credentials, error) {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, nil
+	}
+	file := os.Getenv("NETRC")
+	if file == "" {
+		home := homeDir()
+		if home == "" {
+			return nil, nil
+		}
+		file = filepath.Join(home, ".netrc")
+	}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return parseNetrc(data, hostname(u)), nil
+}
+
+// parseNetrc returns the login and password for host (or, if there are
+// none, the default) in the netrc file data, or nil if there are
+// neither.
+func parseNetrc(data []byte, host string) *Credentials {
+	var (
+		match, def *Credentials
+		cur        *Credentials
+	)
+	fields := strings.Fields(string(data))
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			cur = nil
+			if i+1 < len(fields) {
+				i++
+				if fields[i] == host && match == nil {
+					match = &Credentials{}
+					cur = match
+				}
+			}
+		case "default":
+			cur = nil
+			if def == nil {
+				def = &Credentials{}
+				cur = def
+			}
+		case "login", "password", "account":
+			if i+1 < len(fields) {
+				i++
+				if cur != nil && fields[i-1] == "login" {
+					cur.Username = fields[i]
+				} else if cur != nil && fields[i-1] == "password" {
+					cur.Password = fields[i]
+				}
+			}
+		case "macdef":
+			// The macro definition ends at a blank line, which
+			// strings.Fields doesn't preserve, so ignore the rest
+			// of the file.
+			i = len(fields)
+		}
+	}
+	if match != nil {
+		return match
+	}
+	return def
+}
+
+// execCredentialHelper returns a helper that runs program with the
+// endpoint's URL as its argument and reads the Credentials that it
+// prints as JSON (or nothing, if it has none for the URL).
+func execCredentialHelper(program string) CredentialHelper {
+	return CredentialHelperFunc(func(u *url.URL) (*Credentials, error) {
+		var stderr bytes.Buffer
+		cmd := exec.Command(program, u.String())
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		if len(bytes.TrimSpace(out)) == 0 {
+			return nil, nil
+		}
+		var c Credentials
+		if err := json.Unmarshal(out, &c); err != nil {
+			return nil, fmt.Errorf("parsing credentials: %s", err)
+		}
+		return &c, nil
+	})
+}
+
+func homeDir() string {
+	if home := os.Getenv("HOME"); home != "" {
+		return home
+	}
+	return os.Getenv("USERPROFILE")
+}
+
+// hostname returns u's host without the port.
+func hostname(u *url.URL) string {
+	if host, _, err := net.SplitHostPort(u.Host); err == nil {
+		return host
+	}
+	return u.Host
+}
@@ -0,0 +1,188 @@
+package buildstore
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	netrc := `machine a.example.com login alice password pa
+default login anon password pd
+machine b.example.com
+  login bob
+  password pb
+`
+	tests := map[string]*Credentials{
+		"a.example.com": {Username: "alice", Password: "pa"},
+		"b.example.com": {Username: "bob", Password: "pb"},
+		"c.example.com": {Username: "anon", Password: "pd"},
+	}
+	for host, want := range tests {
+		if got := parseNetrc([]byte(netrc), host); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", host, got, want)
+		}
+	}
+	if got := parseNetrc([]byte("machine a login x password y"), "b"); got != nil {
+		t.Errorf("got %+v for a host that isn't in the file, want nil", got)
+	}
+}
+
+func TestReadAWSCredentialsFile(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "srclib-aws-credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	file := filepath.Join(tmpdir, "credentials")
+	data := `[default]
+aws_access_key_id = AKD
+aws_secret_access_key = skd
+
+# A comment.
+[other]
+aws_access_key_id=AKO
+aws_secret_access_key=sko
+aws_session_token=tok
+`
+	if err := ioutil.WriteFile(file, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]*Credentials{
+		"default": {AccessKeyID: "AKD", SecretAccessKey: "skd"},
+		"other":   {AccessKeyID: "AKO", SecretAccessKey: "sko", SessionToken: "tok"},
+		"missing": nil,
+	}
+	for profile, want := range tests {
+		c, err := readAWSCredentialsFile(file, profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(c, want) {
+			t.Errorf("%s: got %+v, want %+v", profile, c, want)
+		}
+	}
+}
+
+func TestEC2Credentials(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/latest/api/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			http.Error(w, "bad method", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Write([]byte("t0k"))
+	})
+	mux.HandleFunc("/latest/meta-data/iam/security-credentials/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Aws-Ec2-Metadata-Token") != "t0k" {
+			http.Error(w, "no token", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/latest/meta-data/iam/security-credentials/" {
+			w.Write([]byte("role\n"))
+			return
+		}
+		w.Write([]byte(`{"AccessKeyId": "AK", "SecretAccessKey": "sk", "Token": "st"}`))
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	c, err := ec2Credentials(http.DefaultClient, s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&Credentials{AccessKeyID: "AK", SecretAccessKey: "sk", SessionToken: "st"}); !reflect.DeepEqual(c, want) {
+		t.Errorf("got %+v, want %+v", c, want)
+	}
+}
+
+func TestLookupCredentials(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test credential helper is a shell script")
+	}
+	tmpdir, err := ioutil.TempDir("", "srclib-credential-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	helper := filepath.Join(tmpdir, "helper")
+	script := `#!/bin/sh
+case "$1" in
+https://a.example.com/*) echo '{"Token": "a-token"}' ;;
+https://b.example.com/*) echo '{"AccessKeyID": "AK"}' ;;
+esac
+`
+	if err := ioutil.WriteFile(helper, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls []string
+	RegisterCredentialHelper("test", CredentialHelperFunc(func(u *url.URL) (*Credentials, error) {
+		calls = append(calls, u.String())
+		return &Credentials{Username: "u", Password: "p"}, nil
+	}))
+	defer delete(credentialHelpers, "test")
+	defer func(orig []string) { CredentialHelpers = orig }(CredentialHelpers)
+	CredentialHelpers = credentialHelpersFromEnv("exec:" + helper + ", test")
+
+	tests := map[string]*Credentials{
+		"https://a.example.com/store": {Token: "a-token"},
+		// The helper's credentials aren't usable for HTTPS, so the
+		// next helper is asked.
+		"https://b.example.com/store": {Username: "u", Password: "p"},
+		"s3://bucket/prefix":          nil,
+	}
+	for urlStr, want := range tests {
+		u, _ := url.Parse(urlStr)
+		c, err := LookupCredentials(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(c, want) {
+			t.Errorf("%s: got %+v, want %+v", urlStr, c, want)
+		}
+	}
+	if len(calls) != 2 {
+		t.Errorf("got %d calls of the test helper, want 2", len(calls))
+	}
+
+	CredentialHelpers = []string{"nonexistent"}
+	if _, err := LookupCredentials(&url.URL{Scheme: "https", Host: "a.example.com"}); err == nil {
+		t.Error("got no error for an unknown credential helper")
+	}
+}
+
+func TestCredentialsTransport(t *testing.T) {
+	var got []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("Authorization"))
+	}))
+	defer s.Close()
+	u, _ := url.Parse(s.URL)
+
+	for _, creds := range []*Credentials{{Token: "tok"}, {Username: "u", Password: "p"}} {
+		client := &http.Client{Transport: &credentialsTransport{creds: creds, host: u.Host}}
+		resp, err := client.Get(s.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	// Requests to other hosts aren't authenticated.
+	client := &http.Client{Transport: &credentialsTransport{creds: &Credentials{Token: "tok"}, host: "other.example.com"}}
+	resp, err := client.Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if want := []string{"Bearer tok", "Basic dTpw", ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got Authorization headers %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,181 @@
+package buildstore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"golang.org/x/tools/godoc/vfs"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+)
+
+// EncryptionKeyFile is the file containing the key that build data in
+// remote (non-local) stores opened with OpenURL is encrypted with (see
+// Encrypted). If empty, remote build data isn't encrypted. It is
+// initialized from the SRCLIB_BUILDSTORE_KEY_FILE environment
+// variable.
+var EncryptionKeyFile = os.Getenv("SRCLIB_BUILDSTORE_KEY_FILE")
+
+// ReadEncryptionKey reads a key for Encrypted from file, which must
+// contain the hex encoding of a 32-byte (AES-256) key (e.g., the output
+// of "openssl rand -hex 32").
+func ReadEncryptionKey(file string) ([]byte, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("invalid encryption key in %s: must be 64 hex digits (32 bytes)", file)
+	}
+	return key, nil
+}
+
+// encryptedMagic begins every file written by an encrypted VFS.
+var encryptedMagic = []byte("srclib-enc-v1\n")
+
+// ErrNotEncrypted occurs when a file read from an encrypted VFS wasn't
+// written by one.
+var ErrNotEncrypted = errors.New("file is not encrypted")
+
+// Encrypted returns a VFS that encrypts files written to fs with key
+// (using AES-GCM) and decrypts files read from it, so that the build
+// data stored in fs (e.g., a shared S3 bucket) is never stored
+// unencrypted. (It also encrypts graph stores at rest; see "srclib
+// store --encryption-key-file".) The key must be 16, 24, or 32 bytes
+// long (for AES-128, AES-192, or AES-256).
+//
+// Each file's path is authenticated along with its contents, so
+// encrypted files can't be moved or swapped without being detected.
+// Reading a file that isn't encrypted (or was encrypted with another
+// key) fails. File names and sizes are not encrypted.
+func Encrypted(fs rwvfs.FileSystem, key []byte) (rwvfs.FileSystem, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedFS{FileSystem: fs, aead: aead}, nil
+}
+
+type encryptedFS struct {
+	rwvfs.FileSystem
+	aead cipher.AEAD
+}
+
+func (fs *encryptedFS) String() string { return "encrypted(" + fs.FileSystem.String() + ")" }
+
+// overhead is how much longer an encrypted file is than its plaintext.
+func (fs *encryptedFS) overhead() int64 {
+	return int64(len(encryptedMagic) + fs.aead.NonceSize() + fs.aead.Overhead())
+}
+
+func (fs *encryptedFS) Open(p string) (vfs.ReadSeekCloser, error) {
+	f, err := fs.FileSystem.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := fs.decrypt(p, data)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: p, Err: err}
+	}
+	return nopCloser{bytes.NewReader(plaintext)}, nil
+}
+
+func (fs *encryptedFS) decrypt(p string, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, encryptedMagic) {
+		return nil, ErrNotEncrypted
+	}
+	data = data[len(encryptedMagic):]
+	if len(data) < fs.aead.NonceSize() {
+		return nil, errors.New("encrypted build data file is truncated")
+	}
+	nonce, ciphertext := data[:fs.aead.NonceSize()], data[fs.aead.NonceSize():]
+	plaintext, err := fs.aead.Open(nil, nonce, ciphertext, []byte(path.Clean(p)))
+	if err != nil {
+		return nil, errors.New("decrypting file failed (wrong key or corrupted file)")
+	}
+	return plaintext, nil
+}
+
+// Create returns a writer whose contents are encrypted and written to
+// the file when it is closed.
+func (fs *encryptedFS) Create(p string) (io.WriteCloser, error) {
+	f, err := fs.FileSystem.Create(p)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedWriter{fs: fs, path: p, f: f}, nil
+}
+
+type encryptedWriter struct {
+	bytes.Buffer
+	fs   *encryptedFS
+	path string
+	f    io.WriteCloser
+}
+
+func (w *encryptedWriter) Close() error {
+	nonce := make([]byte, w.fs.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		w.f.Close()
+		return err
+	}
+	out := append(append([]byte{}, encryptedMagic...), nonce...)
+	out = w.fs.aead.Seal(out, nonce, w.Bytes(), []byte(path.Clean(w.path)))
+	if _, err := w.f.Write(out); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+func (fs *encryptedFS) Lstat(p string) (os.FileInfo, error) {
+	fi, err := fs.FileSystem.Lstat(p)
+	return fs.plaintextInfo(fi), err
+}
+
+func (fs *encryptedFS) Stat(p string) (os.FileInfo, error) {
+	fi, err := fs.FileSystem.Stat(p)
+	return fs.plaintextInfo(fi), err
+}
+
+func (fs *encryptedFS) ReadDir(p string) ([]os.FileInfo, error) {
+	fis, err := fs.FileSystem.ReadDir(p)
+	for i, fi := range fis {
+		fis[i] = fs.plaintextInfo(fi)
+	}
+	return fis, err
+}
+
+// plaintextInfo returns fi with the size of the file's plaintext.
+func (fs *encryptedFS) plaintextInfo(fi os.FileInfo) os.FileInfo {
+	if fi == nil || !fi.Mode().IsRegular() || fi.Size() < fs.overhead() {
+		return fi
+	}
+	return plaintextFileInfo{fi, fi.Size() - fs.overhead()}
+}
+
+type plaintextFileInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (fi plaintextFileInfo) Size() int64 { return fi.size }
@@ -0,0 +1,74 @@
+package buildstore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+)
+
+func TestEncrypted(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	files := map[string]string{}
+	enc, err := Encrypted(rwvfs.Map(files), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rwvfs.MkdirAll(enc, "c1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(enc, "c1/a.graph.json", []byte("secret doc")); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains([]byte(files["c1/a.graph.json"]), []byte("secret")) {
+		t.Errorf("got stored file %q, want it to be encrypted", files["c1/a.graph.json"])
+	}
+
+	data, err := readFile(enc, "c1/a.graph.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "secret doc" {
+		t.Errorf("got decrypted %q, want %q", data, "secret doc")
+	}
+	if fi, err := enc.Stat("c1/a.graph.json"); err != nil {
+		t.Fatal(err)
+	} else if fi.Size() != int64(len("secret doc")) {
+		t.Errorf("got size %d, want plaintext size %d", fi.Size(), len("secret doc"))
+	}
+
+	// A file moved to another path, or read with another key, can't be
+	// decrypted.
+	files["c1/b.graph.json"] = files["c1/a.graph.json"]
+	if _, err := readFile(enc, "c1/b.graph.json"); err == nil {
+		t.Error("got no error reading a moved file")
+	}
+	other, _ := Encrypted(rwvfs.Map(files), bytes.Repeat([]byte{2}, 32))
+	if _, err := readFile(other, "c1/a.graph.json"); err == nil {
+		t.Error("got no error reading with the wrong key")
+	}
+
+	files["c1/plain.json"] = "x"
+	if _, err := readFile(enc, "c1/plain.json"); err == nil || err.(*os.PathError).Err != ErrNotEncrypted {
+		t.Errorf("got error %v reading an unencrypted file, want ErrNotEncrypted", err)
+	}
+}
+
+func TestReadEncryptionKey(t *testing.T) {
+	f, err := ioutil.TempFile("", "srclib-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("0102030405060708091011121314151617181920212223242526272829303132\n")
+	f.Close()
+	key, err := ReadEncryptionKey(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != 32 || key[0] != 1 {
+		t.Errorf("got key %x, want 32 bytes", key)
+	}
+}
@@ -0,0 +1,61 @@
+package buildstore
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/vcs"
+)
+
+// RenamesFilename is the name of the file, in a commit's build data
+// directory, that records the files that were renamed since the
+// previously built commit (see Renames).
+const RenamesFilename = "renames.json"
+
+// Renames records the files that were renamed between a commit and
+// the commit that was built before it (by "srclib make --commits"),
+// so that the defs in renamed files can be followed from one commit's
+// build data to the next (e.g., by the def history) instead of
+// appearing to be deleted and added.
+type Renames struct {
+	// Base is the commit that the files were renamed since.
+	Base string
+
+	// Files are the renamed files, sorted by their old paths.
+	Files []vcs.Rename
+}
+
+// ReadRenames reads the renames recorded in commitFS. If none were
+// recorded, the error satisfies os.IsNotExist.
+func ReadRenames(commitFS rwvfs.FileSystem) (*Renames, error) {
+	data, err := readFile(commitFS, RenamesFilename)
+	if err != nil {
+		return nil, err
+	}
+	var r Renames
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("%s: %s", RenamesFilename, err)
+	}
+	return &r, nil
+}
+
+// WriteRenames writes r to commitFS, replacing the existing record of
+// the commit's renames.
+func WriteRenames(commitFS rwvfs.FileSystem, r *Renames) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(commitFS, RenamesFilename, append(data, '\n'))
+}
+
+// Map returns a map from the old path of each renamed file to its new
+// path.
+func (r *Renames) Map() map[string]string {
+	m := make(map[string]string, len(r.Files))
+	for _, f := range r.Files {
+		m[f.OrigFile] = f.File
+	}
+	return m
+}
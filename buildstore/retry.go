@@ -0,0 +1,241 @@
+package buildstore
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/tools/godoc/vfs"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+)
+
+// RetryAttempts and RetryBackoff configure the retrying of failed
+// operations on remote (non-local) stores opened with OpenURL (see
+// Retrying). They are initialized from the SRCLIB_BUILDSTORE_RETRIES
+// and SRCLIB_BUILDSTORE_RETRY_BACKOFF (e.g., "500ms") environment
+// variables, and default to 5 attempts and 1s.
+var (
+	RetryAttempts = 5
+	RetryBackoff  = time.Second
+)
+
+func init() {
+	if n, err := strconv.Atoi(os.Getenv("SRCLIB_BUILDSTORE_RETRIES")); err == nil && n > 0 {
+		RetryAttempts = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("SRCLIB_BUILDSTORE_RETRY_BACKOFF")); err == nil && d >= 0 {
+		RetryBackoff = d
+	}
+}
+
+// A RetryError is the error of an operation on a retrying VFS (see
+// Retrying) that failed every time it was attempted.
+type RetryError struct {
+	Op       string // operation (e.g., "open" or "create")
+	Path     string // path of the file or directory
+	Attempts int
+	Err      error // error of the last attempt
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%s %s: failed after %d attempts: %s", e.Op, e.Path, e.Attempts, e.Err)
+}
+
+// A StatusError is the error of a request to a remote store that got
+// an unsuccessful HTTP response.
+type StatusError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Status     string // e.g., "503 Service Unavailable"
+	Msg        []byte // (the start of) the response body
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s: %s: %s", e.Method, e.Path, e.Status, e.Msg)
+}
+
+// Retrying returns a VFS that retries operations on fs that fail,
+// making up to attempts attempts and waiting backoff after the first
+// failure and twice as long after each subsequent one, so that
+// transient network errors don't fail long runs. Only operations that
+// fail with network errors (including timeouts and reads that are cut
+// short) or with *StatusErrors for 5xx and 429 (Too Many Requests)
+// responses are retried; other errors (such as those of files that
+// don't exist or of requests that are denied) are returned as is.
+// Errors of operations that fail on every attempt are *RetryErrors.
+//
+// Files are read in full when they are opened, so reads that are cut
+// short are retried too. Files that are created are written to fs when
+// they are closed.
+func Retrying(fs rwvfs.FileSystem, attempts int, backoff time.Duration) rwvfs.FileSystem {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return &retryingFS{fs: fs, attempts: attempts, backoff: backoff, sleep: time.Sleep}
+}
+
+type retryingFS struct {
+	fs       rwvfs.FileSystem
+	attempts int
+	backoff  time.Duration
+	sleep    func(time.Duration)
+}
+
+func (fs *retryingFS) String() string { return "retrying(" + fs.fs.String() + ")" }
+
+// retry calls f until it succeeds, it fails with an error that
+// isn't worth retrying, or fs.attempts attempts have failed.
+func (fs *retryingFS) retry(op, path string, f func() error) error {
+	wait := fs.backoff
+	var err error
+	for i := 0; i < fs.attempts; i++ {
+		if i > 0 {
+			fs.sleep(wait)
+			wait *= 2
+		}
+		if err = f(); err == nil || !isRetryable(err) {
+			return err
+		}
+	}
+	return &RetryError{Op: op, Path: path, Attempts: fs.attempts, Err: err}
+}
+
+// isRetryable reports whether an operation that failed with err might
+// succeed if it is attempted again.
+func isRetryable(err error) bool {
+	switch e := err.(type) {
+	case *StatusError:
+		return retryableStatus(e.StatusCode)
+	case *url.Error:
+		return isRetryable(e.Err)
+	case *net.OpError:
+		return true
+	case *net.DNSError:
+		return e.IsTimeout || e.IsTemporary
+	case net.Error:
+		return e.Timeout()
+	}
+	return err == io.ErrUnexpectedEOF
+}
+
+// retryableStatus reports whether a request that got a response with
+// the HTTP status code might succeed if it is sent again.
+func retryableStatus(code int) bool {
+	return code >= 500 || code == http.StatusTooManyRequests
+}
+
+// retryableStatusClient returns a client that sends requests with c
+// but fails them with a *StatusError if the response has a status
+// that is retried (see retryableStatus), so that clients that don't
+// distinguish response statuses (such as rwvfs.HTTP's) return errors
+// that Retrying can tell apart.
+func retryableStatusClient(c *http.Client) *http.Client {
+	c2 := *c
+	c2.Transport = &retryableStatusTransport{base: c.Transport}
+	return &c2
+}
+
+type retryableStatusTransport struct {
+	base http.RoundTripper // default: http.DefaultTransport
+}
+
+func (t *retryableStatusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if !retryableStatus(resp.StatusCode) {
+		return resp, nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	resp.Body.Close()
+	return nil, &StatusError{Method: req.Method, Path: req.URL.Path, StatusCode: resp.StatusCode, Status: resp.Status, Msg: bytes.TrimSpace(msg)}
+}
+
+func (fs *retryingFS) Open(p string) (vfs.ReadSeekCloser, error) {
+	var data []byte
+	err := fs.retry("open", p, func() error {
+		f, err := fs.fs.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		data, err = ioutil.ReadAll(f)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nopCloser{bytes.NewReader(data)}, nil
+}
+
+func (fs *retryingFS) Lstat(p string) (fi os.FileInfo, err error) {
+	err = fs.retry("lstat", p, func() error {
+		fi, err = fs.fs.Lstat(p)
+		return err
+	})
+	return fi, err
+}
+
+func (fs *retryingFS) Stat(p string) (fi os.FileInfo, err error) {
+	err = fs.retry("stat", p, func() error {
+		fi, err = fs.fs.Stat(p)
+		return err
+	})
+	return fi, err
+}
+
+func (fs *retryingFS) ReadDir(p string) (fis []os.FileInfo, err error) {
+	err = fs.retry("readdir", p, func() error {
+		fis, err = fs.fs.ReadDir(p)
+		return err
+	})
+	return fis, err
+}
+
+func (fs *retryingFS) Create(p string) (io.WriteCloser, error) {
+	return &retryingWriter{fs: fs, path: p}, nil
+}
+
+// retryingWriter buffers a file that is written to a retrying VFS, and
+// writes it to the underlying VFS when it is closed.
+type retryingWriter struct {
+	bytes.Buffer
+	fs   *retryingFS
+	path string
+}
+
+func (w *retryingWriter) Close() error {
+	return w.fs.retry("create", w.path, func() error {
+		f, err := w.fs.fs.Create(w.path)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(w.Bytes()); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+}
+
+func (fs *retryingFS) Mkdir(p string) error {
+	return fs.retry("mkdir", p, func() error { return fs.fs.Mkdir(p) })
+}
+
+func (fs *retryingFS) Remove(p string) error {
+	return fs.retry("remove", p, func() error { return fs.fs.Remove(p) })
+}
@@ -0,0 +1,163 @@
+package buildstore
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/godoc/vfs"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+)
+
+var errFlaky = &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset")}
+
+// flakyFS is a VFS whose opens and creates fail (or, for opens, whose
+// reads are cut short) until failures is 0.
+type flakyFS struct {
+	rwvfs.FileSystem
+	failures int
+}
+
+func (fs *flakyFS) Open(p string) (vfs.ReadSeekCloser, error) {
+	f, err := fs.FileSystem.Open(p)
+	if err != nil || fs.failures == 0 {
+		return f, err
+	}
+	fs.failures--
+	if fs.failures%2 == 0 {
+		f.Close()
+		return nil, errFlaky
+	}
+	return truncatedFile{f}, nil
+}
+
+func (fs *flakyFS) Create(p string) (io.WriteCloser, error) {
+	if fs.failures > 0 {
+		fs.failures--
+		return nil, errFlaky
+	}
+	return fs.FileSystem.Create(p)
+}
+
+// truncatedFile is a file whose reads fail after the first byte.
+type truncatedFile struct{ vfs.ReadSeekCloser }
+
+func (f truncatedFile) Read(p []byte) (int, error) {
+	if len(p) > 1 {
+		p = p[:1]
+	}
+	if n, err := f.ReadSeekCloser.Read(p); n == 0 || err != nil {
+		return n, err
+	}
+	return 1, io.ErrUnexpectedEOF
+}
+
+func TestRetrying(t *testing.T) {
+	flaky := &flakyFS{FileSystem: rwvfs.Map(map[string]string{"a": "hello"})}
+	var waits []time.Duration
+	fs := Retrying(flaky, 3, time.Second).(*retryingFS)
+	fs.sleep = func(d time.Duration) { waits = append(waits, d) }
+
+	// An error and a partial read, then success.
+	flaky.failures = 2
+	data, err := readFile(fs, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("got %q, want %q", data, "hello")
+	}
+	if want := []time.Duration{time.Second, 2 * time.Second}; !reflect.DeepEqual(waits, want) {
+		t.Errorf("got waits %v, want %v", waits, want)
+	}
+
+	flaky.failures = 2
+	if err := writeFile(fs, "b", []byte("world")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := readFile(flaky, "b"); err != nil || string(data) != "world" {
+		t.Errorf("got %q, %v, want %q", data, err, "world")
+	}
+
+	// Persistent failures name the operation and the file.
+	flaky.failures = 3
+	_, err = readFile(fs, "a")
+	if e, ok := err.(*RetryError); !ok || e.Op != "open" || e.Path != "a" || e.Attempts != 3 {
+		t.Errorf("got error %v, want a RetryError for open a after 3 attempts", err)
+	}
+
+	// Missing files aren't retried.
+	flaky.failures = 0
+	waits = nil
+	if _, err := fs.Open("missing"); !os.IsNotExist(err) {
+		t.Errorf("got error %v, want a not-exist error", err)
+	}
+	if len(waits) != 0 {
+		t.Errorf("got waits %v for a missing file, want none", waits)
+	}
+}
+
+// failingFS is a VFS whose opens fail with err.
+type failingFS struct {
+	rwvfs.FileSystem
+	err   error
+	opens int
+}
+
+func (fs *failingFS) Open(p string) (vfs.ReadSeekCloser, error) {
+	fs.opens++
+	return nil, fs.err
+}
+
+func TestRetrying_status(t *testing.T) {
+	tests := map[int]int{
+		http.StatusForbidden:          1,
+		http.StatusBadRequest:         1,
+		http.StatusTooManyRequests:    3,
+		http.StatusServiceUnavailable: 3,
+	}
+	for code, wantOpens := range tests {
+		failing := &failingFS{FileSystem: rwvfs.Map(map[string]string{}), err: &StatusError{Method: "GET", Path: "/a", StatusCode: code, Status: http.StatusText(code)}}
+		fs := Retrying(failing, 3, time.Second).(*retryingFS)
+		fs.sleep = func(time.Duration) {}
+		_, err := fs.Open("a")
+		if failing.opens != wantOpens {
+			t.Errorf("status %d: got %d attempts, want %d", code, failing.opens, wantOpens)
+		}
+		if _, retried := err.(*RetryError); retried != (wantOpens > 1) {
+			t.Errorf("status %d: got error %v", code, err)
+		}
+	}
+}
+
+func TestRetryableStatusClient(t *testing.T) {
+	var code int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", code)
+	}))
+	defer s.Close()
+	c := retryableStatusClient(http.DefaultClient)
+
+	// Statuses that aren't retried are passed through.
+	code = http.StatusForbidden
+	resp, err := c.Get(s.URL + "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != code {
+		t.Errorf("got status %d, want %d", resp.StatusCode, code)
+	}
+
+	code = http.StatusBadGateway
+	if _, err := c.Get(s.URL + "/a"); !isRetryable(err) {
+		t.Errorf("got error %v, want a retryable error", err)
+	}
+}
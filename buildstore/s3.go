@@ -0,0 +1,282 @@
+package buildstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/smithy-go/encoding/httpbinding"
+	"golang.org/x/tools/godoc/vfs"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+)
+
+// S3 returns a VFS for the objects under prefix in an Amazon S3 (or
+// S3-compatible) bucket. S3 has no directories; a path is a directory
+// if there are objects under it, and Mkdir does nothing.
+//
+// Requests are signed with creds (see LookupCredentials), for the
+// region in AWS_REGION (default: us-east-1). If creds is nil,
+// requests are signed with empty credentials. The S3 endpoint URL may
+// be overridden with $SRCLIB_S3_ENDPOINT (e.g., for a local
+// S3-compatible server).
+func S3(bucket, prefix string, creds *Credentials) rwvfs.WalkableFileSystem {
+	if creds == nil {
+		creds = &Credentials{}
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := os.Getenv("SRCLIB_S3_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	return rwvfs.Walkable(&s3FS{
+		endpoint:     strings.TrimSuffix(endpoint, "/"),
+		bucket:       bucket,
+		prefix:       strings.Trim(prefix, "/"),
+		region:       region,
+		accessKey:    creds.AccessKeyID,
+		secretKey:    creds.SecretAccessKey,
+		sessionToken: creds.SessionToken,
+		client:       http.DefaultClient,
+	})
+}
+
+type s3FS struct {
+	endpoint, bucket, prefix string
+	region                   string
+	accessKey, secretKey     string
+	sessionToken             string
+	client                   *http.Client
+}
+
+func (fs *s3FS) String() string { return "s3(" + path.Join(fs.bucket, fs.prefix) + ")" }
+
+// key returns the object key for the path p.
+func (fs *s3FS) key(p string) string {
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if fs.prefix == "" {
+		return p
+	}
+	if p == "" {
+		return fs.prefix
+	}
+	return fs.prefix + "/" + p
+}
+
+func (fs *s3FS) Open(p string) (vfs.ReadSeekCloser, error) {
+	resp, err := fs.do("GET", fs.key(p), nil, nil)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: p, Err: err}
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return nopCloser{bytes.NewReader(data)}, nil
+}
+
+type nopCloser struct{ io.ReadSeeker }
+
+func (nopCloser) Close() error { return nil }
+
+func (fs *s3FS) Lstat(p string) (os.FileInfo, error) { return fs.Stat(p) }
+
+func (fs *s3FS) Stat(p string) (os.FileInfo, error) {
+	name := path.Base(path.Clean("/" + p))
+	if key := fs.key(p); key != "" && key != fs.prefix {
+		resp, err := fs.do("HEAD", key, nil, nil)
+		if err == nil {
+			resp.Body.Close()
+			modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+			return s3FileInfo{name: name, size: resp.ContentLength, modTime: modTime}, nil
+		} else if !os.IsNotExist(err) {
+			return nil, &os.PathError{Op: "stat", Path: p, Err: err}
+		}
+	}
+
+	// It's a directory if there are any objects under it.
+	list, err := fs.list(p, 1)
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: p, Err: err}
+	}
+	if len(list) == 0 && fs.key(p) != fs.prefix {
+		return nil, &os.PathError{Op: "stat", Path: p, Err: os.ErrNotExist}
+	}
+	return s3FileInfo{name: name, dir: true}, nil
+}
+
+func (fs *s3FS) ReadDir(p string) ([]os.FileInfo, error) {
+	fis, err := fs.list(p, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: p, Err: err}
+	}
+	return fis, nil
+}
+
+// list lists the objects and "directories" directly under p, stopping
+// after max entries if max > 0.
+func (fs *s3FS) list(p string, max int) ([]os.FileInfo, error) {
+	prefix := fs.key(p)
+	if prefix != "" {
+		prefix += "/"
+	}
+	var fis []os.FileInfo
+	var token string
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}, "delimiter": {"/"}}
+		if max > 0 {
+			q.Set("max-keys", fmt.Sprint(max))
+		}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		resp, err := fs.do("GET", "", q, nil)
+		if err != nil {
+			return nil, err
+		}
+		var res struct {
+			Contents []struct {
+				Key          string
+				Size         int64
+				LastModified time.Time
+			}
+			CommonPrefixes []struct {
+				Prefix string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range res.Contents {
+			fis = append(fis, s3FileInfo{name: path.Base(o.Key), size: o.Size, modTime: o.LastModified})
+		}
+		for _, cp := range res.CommonPrefixes {
+			fis = append(fis, s3FileInfo{name: path.Base(cp.Prefix), dir: true})
+		}
+		if !res.IsTruncated || (max > 0 && len(fis) >= max) {
+			return fis, nil
+		}
+		token = res.NextContinuationToken
+	}
+}
+
+// Create returns a writer whose contents are uploaded to the object
+// when it is closed.
+func (fs *s3FS) Create(p string) (io.WriteCloser, error) {
+	return &s3Writer{fs: fs, key: fs.key(p)}, nil
+}
+
+type s3Writer struct {
+	bytes.Buffer
+	fs  *s3FS
+	key string
+}
+
+func (w *s3Writer) Close() error {
+	resp, err := w.fs.do("PUT", w.key, nil, w.Bytes())
+	if err != nil {
+		return &os.PathError{Op: "create", Path: w.key, Err: err}
+	}
+	return resp.Body.Close()
+}
+
+// Mkdir does nothing, because S3 has no directories.
+func (fs *s3FS) Mkdir(p string) error { return nil }
+
+func (fs *s3FS) Remove(p string) error {
+	resp, err := fs.do("DELETE", fs.key(p), nil, nil)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: p, Err: err}
+	}
+	return resp.Body.Close()
+}
+
+// do sends a signed request for the object key (or, if key is empty,
+// the bucket). It returns os.ErrNotExist if the response status is 404
+// and a *StatusError if it is otherwise unsuccessful.
+func (fs *s3FS) do(method, key string, query url.Values, body []byte) (*http.Response, error) {
+	u, err := url.Parse(fs.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = "/" + fs.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = httpbinding.EscapePath(u.Path, false)
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.sign(req, body, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	resp, err := fs.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, os.ErrNotExist
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, &StatusError{Method: method, Path: u.Path, StatusCode: resp.StatusCode, Status: resp.Status, Msg: bytes.TrimSpace(msg)}
+	}
+	return resp, nil
+}
+
+// s3Signer signs requests with AWS Signature Version 4. S3 signs
+// each request's path as it is sent (escaped once by do) rather than
+// escaping it again.
+var s3Signer = v4.NewSigner(func(o *v4.SignerOptions) { o.DisableURIPathEscaping = true })
+
+// sign signs req, whose payload is body.
+func (fs *s3FS) sign(req *http.Request, body []byte, now time.Time) error {
+	payloadHash := checksum(body)
+	// S3 requires the payload's hash to be sent, too.
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	creds := aws.Credentials{AccessKeyID: fs.accessKey, SecretAccessKey: fs.secretKey, SessionToken: fs.sessionToken}
+	return s3Signer.SignHTTP(context.Background(), creds, req, payloadHash, "s3", fs.region, now)
+}
+
+type s3FileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (fi s3FileInfo) Name() string       { return fi.name }
+func (fi s3FileInfo) Size() int64        { return fi.size }
+func (fi s3FileInfo) ModTime() time.Time { return fi.modTime }
+func (fi s3FileInfo) IsDir() bool        { return fi.dir }
+func (fi s3FileInfo) Sys() interface{}   { return nil }
+func (fi s3FileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
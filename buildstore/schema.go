@@ -0,0 +1,291 @@
+package buildstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/kr/fs"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+)
+
+// SchemaVersion is the current version of the format of build data
+// files. When the format of a registered data type (see
+// RegisterDataType) changes, SchemaVersion is incremented and a
+// migration that upgrades files of the data type from the previous
+// version is registered (see RegisterMigration), so that existing
+// build data can be upgraded in place (see Migrate) instead of being
+// rebuilt.
+//
+// Version 0 is the version of build data files written before schema
+// versions were recorded.
+const SchemaVersion = 1
+
+// SchemaFilename is the name of the file, in a commit's build data
+// directory, that records the schema version of each of the commit's
+// build data files (see Schema).
+const SchemaFilename = "schema.json"
+
+// QuarantineDirName is the name of the directory, in a commit's build
+// data directory, to which corrupt build data files are moved. Files
+// in it aren't migrated.
+const QuarantineDirName = "quarantine"
+
+// A Schema records the schema versions of a commit's build data
+// files. The versions are recorded in a separate file (see
+// SchemaFilename) rather than in the build data files themselves,
+// whose formats (such as the JSON arrays of dep resolutions) are read
+// and written by toolchains and other programs that don't know about
+// schema versions.
+type Schema struct {
+	// Files maps each build data file (relative to the commit's build
+	// data directory, with forward slashes) to the schema version that
+	// it was written with. Files that aren't listed have version 0.
+	Files map[string]int
+}
+
+// Version returns the schema version of file.
+func (s *Schema) Version(file string) int { return s.Files[path.Clean(file)] }
+
+// Stamp records files as having the current SchemaVersion.
+func (s *Schema) Stamp(files ...string) {
+	if s.Files == nil {
+		s.Files = make(map[string]int, len(files))
+	}
+	for _, file := range files {
+		s.Files[path.Clean(file)] = SchemaVersion
+	}
+}
+
+// ReadSchema reads the schema versions of the build data files in
+// commitFS. If none were recorded, it returns an empty Schema.
+func ReadSchema(commitFS rwvfs.FileSystem) (*Schema, error) {
+	data, err := readFile(commitFS, SchemaFilename)
+	if os.IsNotExist(err) {
+		return &Schema{Files: map[string]int{}}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %s", SchemaFilename, err)
+	}
+	if s.Files == nil {
+		s.Files = map[string]int{}
+	}
+	return &s, nil
+}
+
+// WriteSchema writes s to commitFS, replacing the existing record of
+// the schema versions of its build data files.
+func WriteSchema(commitFS rwvfs.FileSystem, s *Schema) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(commitFS, SchemaFilename, append(data, '\n'))
+}
+
+// StampSchema records files (build data files in commitFS that were
+// just written) as having the current SchemaVersion.
+func StampSchema(commitFS rwvfs.FileSystem, files []string) error {
+	if len(files) == 0 {
+		return nil
+	}
+	s, err := ReadSchema(commitFS)
+	if err != nil {
+		return err
+	}
+	s.Stamp(files...)
+	return WriteSchema(commitFS, s)
+}
+
+// A MigrateFunc upgrades the contents of a build data file by one
+// schema version.
+type MigrateFunc func(data []byte) ([]byte, error)
+
+// migrations maps data type names to the migrations that upgrade
+// files of that type from each schema version.
+var migrations = map[string]map[int]MigrateFunc{}
+
+// RegisterMigration registers f to upgrade build data files of the
+// named data type (see RegisterDataType) from schema version from to
+// version from+1. Files of data types that have no migration from a
+// version are unchanged by the upgrade (other than their recorded
+// version).
+//
+// If RegisterMigration is called twice for the same data type and
+// version, or if from isn't less than SchemaVersion, it panics.
+func RegisterMigration(dataType string, from int, f MigrateFunc) {
+	if from < 0 || from >= SchemaVersion {
+		panic(fmt.Sprintf("buildstore: RegisterMigration called for data type %s with invalid version %d", dataType, from))
+	}
+	if migrations[dataType] == nil {
+		migrations[dataType] = map[int]MigrateFunc{}
+	}
+	if _, dup := migrations[dataType][from]; dup {
+		panic(fmt.Sprintf("buildstore: RegisterMigration called twice for data type %s version %d", dataType, from))
+	}
+	migrations[dataType][from] = f
+}
+
+// MigrateResult describes what Migrate upgraded.
+type MigrateResult struct {
+	Commits  int // number of commits whose build data was checked
+	Migrated int // number of files whose contents were upgraded
+	Stamped  int // number of files that only needed their version recorded
+	Current  int // number of files that were already at the current version
+}
+
+// Migrate upgrades the build data for the given commits (or, if
+// commits is empty, for all commits) in the repo build store rooted at
+// fs to the current SchemaVersion, in place (see MigrateCommit). If
+// dryRun is true, the files that would be upgraded are counted, but
+// nothing is written.
+func Migrate(fs rwvfs.WalkableFileSystem, commits []string, dryRun bool) (*MigrateResult, error) {
+	if len(commits) == 0 {
+		var err error
+		if commits, err = Commits(fs); err != nil {
+			return nil, err
+		}
+	}
+	store := Repo(fs)
+	var res MigrateResult
+	for _, commitID := range commits {
+		if err := MigrateCommit(store.Commit(commitID), dryRun, &res); err != nil {
+			return &res, fmt.Errorf("migrating build data for commit %s: %s", commitID, err)
+		}
+		res.Commits++
+	}
+	return &res, nil
+}
+
+// MigrateCommit upgrades the build data files in a commit's build
+// data directory to the current SchemaVersion by applying the
+// registered migrations for their data types (see RegisterMigration)
+// in order, and records their new versions. Files that aren't of a
+// registered data type and quarantined files are skipped. If the
+// commit has a sync manifest (see SyncManifestName), the checksums of
+// the upgraded files are updated in it.
+//
+// It is an error for a file to have a newer version than
+// SchemaVersion, which means that it was written by a newer version
+// of srclib.
+func MigrateCommit(commitFS rwvfs.WalkableFileSystem, dryRun bool, res *MigrateResult) error {
+	s, err := ReadSchema(commitFS)
+	if err != nil {
+		return err
+	}
+	files, err := dataFiles(commitFS)
+	if err != nil {
+		return err
+	}
+
+	changed := map[string][]byte{}
+	var stamped []string
+	for _, file := range files {
+		dataType, _ := DataType(path.Base(file))
+		version := s.Version(file)
+		if version > SchemaVersion {
+			return fmt.Errorf("%s has schema version %d, which is newer than this version of srclib supports (%d)", file, version, SchemaVersion)
+		}
+		if version == SchemaVersion {
+			res.Current++
+			continue
+		}
+
+		var data []byte
+		for v := version; v < SchemaVersion; v++ {
+			f := migrations[dataType][v]
+			if f == nil {
+				continue
+			}
+			if data == nil {
+				if data, err = readFile(commitFS, file); err != nil {
+					return err
+				}
+			}
+			if data, err = f(data); err != nil {
+				return fmt.Errorf("%s: upgrading from schema version %d: %s", file, v, err)
+			}
+		}
+		if data != nil {
+			changed[file] = data
+			res.Migrated++
+		} else {
+			res.Stamped++
+		}
+		stamped = append(stamped, file)
+	}
+	if dryRun || len(stamped) == 0 {
+		return nil
+	}
+
+	for _, file := range stamped {
+		if data, present := changed[file]; present {
+			if err := writeFile(commitFS, file, data); err != nil {
+				return err
+			}
+		}
+	}
+	s.Stamp(stamped...)
+	if err := WriteSchema(commitFS, s); err != nil {
+		return err
+	}
+	return updateSyncManifest(commitFS, changed)
+}
+
+// dataFiles returns the paths of the files of registered data types
+// (see RegisterDataType) in a commit's build data directory, excluding
+// quarantined files.
+func dataFiles(commitFS rwvfs.WalkableFileSystem) ([]string, error) {
+	var files []string
+	w := fs.WalkFS(".", commitFS)
+	for w.Step() {
+		if err := w.Err(); err != nil {
+			return nil, err
+		}
+		p := path.Clean(w.Path())
+		if w.Stat().IsDir() {
+			if p == QuarantineDirName {
+				w.SkipDir()
+			}
+			continue
+		}
+		if dataType, _ := DataType(path.Base(p)); dataType == "" {
+			continue
+		}
+		files = append(files, p)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// updateSyncManifest updates the checksums of the changed files, and
+// of the schema file, in the commit's sync manifest (if it has one),
+// so that the migrated build data is still considered complete and
+// verifiable.
+func updateSyncManifest(commitFS rwvfs.FileSystem, changed map[string][]byte) error {
+	m, err := ReadSyncManifest(commitFS)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for file, data := range changed {
+		m.Files[file] = checksum(data)
+	}
+	schema, err := readFile(commitFS, SchemaFilename)
+	if err != nil {
+		return err
+	}
+	m.Files[SchemaFilename] = checksum(schema)
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(commitFS, SyncManifestName, data)
+}
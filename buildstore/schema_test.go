@@ -0,0 +1,104 @@
+package buildstore
+
+import (
+	"strings"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+)
+
+type schemaTestData struct{}
+
+func init() {
+	RegisterDataType("schematest", &schemaTestData{})
+	RegisterMigration("schematest", 0, func(data []byte) ([]byte, error) {
+		return []byte(strings.ToUpper(string(data))), nil
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	files := map[string]string{
+		"c1/a.schematest.json":            "a",
+		"c1/x/b.schematest.json":          "b",
+		"c1/c.other.json":                 "c",
+		"c1/quarantine/d.schematest.json": "d",
+		"c2/e.schematest.json":            "e",
+		"c2/" + SchemaFilename:            `{"Files": {"e.schematest.json": 1}}`,
+	}
+	fs := rwvfs.Walkable(rwvfs.Map(files))
+
+	res, err := Migrate(fs, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (MigrateResult{Commits: 2, Migrated: 2, Current: 1}); *res != want {
+		t.Errorf("dry run: got result %+v, want %+v", *res, want)
+	}
+	if files["c1/a.schematest.json"] != "a" {
+		t.Error("dry run changed files")
+	}
+
+	res, err = Migrate(fs, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (MigrateResult{Commits: 2, Migrated: 2, Current: 1}); *res != want {
+		t.Errorf("got result %+v, want %+v", *res, want)
+	}
+	for file, want := range map[string]string{
+		"c1/a.schematest.json":            "A",
+		"c1/x/b.schematest.json":          "B",
+		"c1/c.other.json":                 "c",
+		"c1/quarantine/d.schematest.json": "d",
+		"c2/e.schematest.json":            "e",
+	} {
+		if got := files[file]; got != want {
+			t.Errorf("%s: got %q, want %q", file, got, want)
+		}
+	}
+	s, err := ReadSchema(Repo(fs).Commit("c1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Version("a.schematest.json") != SchemaVersion || s.Version("x/b.schematest.json") != SchemaVersion {
+		t.Errorf("got schema %+v, want files stamped with version %d", s, SchemaVersion)
+	}
+
+	// Migrating again does nothing.
+	res, err = Migrate(fs, []string{"c1"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (MigrateResult{Commits: 1, Current: 2}); *res != want {
+		t.Errorf("got result %+v, want %+v", *res, want)
+	}
+
+	// Files from a newer version of srclib can't be migrated.
+	files["c2/"+SchemaFilename] = `{"Files": {"e.schematest.json": 999}}`
+	if _, err := Migrate(fs, []string{"c2"}, false); err == nil {
+		t.Error("got no error migrating a file with a newer schema version")
+	}
+}
+
+func TestMigrate_syncManifest(t *testing.T) {
+	src := rwvfs.Walkable(rwvfs.Map(map[string]string{"c1/a.schematest.json": "a"}))
+	dst := rwvfs.Walkable(rwvfs.Map(map[string]string{}))
+	if _, err := Sync(src, dst, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Migrate(dst, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// The migrated store is still a valid sync source.
+	if _, err := Sync(dst, rwvfs.Walkable(rwvfs.Map(map[string]string{})), nil); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ReadSyncManifest(Repo(dst).Commit("c1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Files["a.schematest.json"] != checksum([]byte("A")) {
+		t.Errorf("got manifest %+v, want the checksum of the migrated file", m)
+	}
+}
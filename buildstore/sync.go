@@ -0,0 +1,218 @@
+package buildstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/kr/fs"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+)
+
+// SyncManifestName is the name of the file, in a commit's build data
+// directory, that Sync writes after it has copied all of the commit's
+// build data. Its presence means that the commit's build data in the
+// store is complete.
+const SyncManifestName = ".srclib-sync.json"
+
+// A SyncManifest lists the build data files for a commit (that were
+// copied by Sync) and their checksums.
+type SyncManifest struct {
+	CommitID string
+
+	// Files maps each file's path (relative to the commit's build data
+	// directory, with forward slashes) to the hex-encoded SHA-256 hash
+	// of its contents.
+	Files map[string]string
+}
+
+// SyncResult describes what Sync copied.
+type SyncResult struct {
+	Commits int   // number of commits synced
+	Copied  int   // number of files copied
+	Skipped int   // number of files that were already in the destination
+	Bytes   int64 // total size of the copied files
+}
+
+// Sync copies the build data for the given commits (or, if commits is
+// empty, for all commits) from the src repo build store to the dst
+// repo build store.
+//
+// Transfers are resumable: a file that already exists in dst with the
+// same contents isn't copied again, so rerunning an interrupted Sync
+// only copies the remaining files. Each copied file is read back from
+// dst and its checksum is verified. If src has a sync manifest for a
+// commit (i.e., it was itself populated by Sync), the files it lists
+// are copied (which doesn't require src to support listing
+// directories) and their checksums are verified, too.
+//
+// A commit's sync manifest (see SyncManifestName) is written to dst
+// last, after all of its files have been copied and verified, so that
+// consumers can check for it to avoid reading partially published
+// build data.
+func Sync(src, dst rwvfs.WalkableFileSystem, commits []string) (*SyncResult, error) {
+	if len(commits) == 0 {
+		var err error
+		if commits, err = Commits(src); err != nil {
+			return nil, err
+		}
+	}
+	srcStore, dstStore := Repo(src), Repo(dst)
+	var res SyncResult
+	for _, commitID := range commits {
+		if err := rwvfs.MkdirAll(dst, commitID); err != nil {
+			return &res, err
+		}
+		if err := syncCommit(srcStore.Commit(commitID), dstStore.Commit(commitID), commitID, &res); err != nil {
+			return &res, fmt.Errorf("syncing build data for commit %s: %s", commitID, err)
+		}
+		res.Commits++
+	}
+	return &res, nil
+}
+
+// Commits returns the IDs of the commits that have build data in
+// the repo build store rooted at fs.
+func Commits(fs rwvfs.FileSystem) ([]string, error) {
+	fis, err := fs.ReadDir(".")
+	if err != nil {
+		return nil, err
+	}
+	var commits []string
+	for _, fi := range fis {
+		if fi.IsDir() {
+			commits = append(commits, fi.Name())
+		}
+	}
+	return commits, nil
+}
+
+func syncCommit(src, dst rwvfs.WalkableFileSystem, commitID string, res *SyncResult) error {
+	want, err := ReadSyncManifest(src)
+	if os.IsNotExist(err) {
+		want = nil
+	} else if err != nil {
+		return err
+	}
+	var files []string
+	if want != nil {
+		for file := range want.Files {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+	} else if files, err = commitFiles(src); err != nil {
+		return err
+	}
+
+	// Remove dst's old manifest (if any) first, so that the commit's
+	// build data isn't considered complete while it's being changed.
+	if err := dst.Remove(SyncManifestName); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	m := &SyncManifest{CommitID: commitID, Files: make(map[string]string, len(files))}
+	for _, file := range files {
+		data, err := readFile(src, file)
+		if err != nil {
+			return err
+		}
+		sum := checksum(data)
+		if want != nil && want.Files[file] != sum {
+			return fmt.Errorf("checksum mismatch for %s in source (manifest has %s, file has %s)", file, want.Files[file], sum)
+		}
+		m.Files[file] = sum
+
+		if old, err := readFile(dst, file); err == nil && checksum(old) == sum {
+			res.Skipped++
+			continue
+		} else if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := writeFile(dst, file, data); err != nil {
+			return err
+		}
+		copied, err := readFile(dst, file)
+		if err != nil {
+			return err
+		}
+		if got := checksum(copied); got != sum {
+			return fmt.Errorf("checksum mismatch for %s after copying (source has %s, destination has %s)", file, sum, got)
+		}
+		res.Copied++
+		res.Bytes += int64(len(data))
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(dst, SyncManifestName, data)
+}
+
+// ReadSyncManifest reads the sync manifest in a commit's build data
+// directory. If there is none, it returns an error satisfying
+// os.IsNotExist.
+func ReadSyncManifest(commitFS rwvfs.FileSystem) (*SyncManifest, error) {
+	data, err := readFile(commitFS, SyncManifestName)
+	if err != nil {
+		return nil, err
+	}
+	var m SyncManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %s", SyncManifestName, err)
+	}
+	return &m, nil
+}
+
+// commitFiles returns the paths of all of the files (except the sync
+// manifest) in a commit's build data directory.
+func commitFiles(commitFS rwvfs.WalkableFileSystem) ([]string, error) {
+	var files []string
+	w := fs.WalkFS(".", commitFS)
+	for w.Step() {
+		if err := w.Err(); err != nil {
+			return nil, err
+		}
+		if w.Stat().IsDir() || w.Path() == SyncManifestName {
+			continue
+		}
+		files = append(files, path.Clean(w.Path()))
+	}
+	return files, nil
+}
+
+func readFile(fs rwvfs.FileSystem, file string) ([]byte, error) {
+	f, err := fs.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+func writeFile(fs rwvfs.FileSystem, file string, data []byte) error {
+	if err := rwvfs.MkdirAll(fs, path.Dir(file)); err != nil {
+		return err
+	}
+	f, err := fs.Create(file)
+	if err != nil {
+		return err
+	}
+	if _, err := bytes.NewReader(data).WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
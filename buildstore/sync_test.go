@@ -0,0 +1,54 @@
+package buildstore
+
+import (
+	"testing"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+)
+
+func TestSync(t *testing.T) {
+	src := rwvfs.Walkable(rwvfs.Map(map[string]string{
+		"c1/a.unit.json":    "a",
+		"c1/x/b.graph.json": "b",
+		"c2/c.unit.json":    "c",
+	}))
+	dstFiles := map[string]string{}
+	dst := rwvfs.Walkable(rwvfs.Map(dstFiles))
+
+	res, err := Sync(src, dst, []string{"c1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (SyncResult{Commits: 1, Copied: 2, Bytes: 2}); *res != want {
+		t.Errorf("got result %+v, want %+v", *res, want)
+	}
+	if dstFiles["c1/x/b.graph.json"] != "b" {
+		t.Errorf("got dst files %v, want c1/x/b.graph.json to be copied", dstFiles)
+	}
+	if _, present := dstFiles["c2/c.unit.json"]; present {
+		t.Errorf("got dst files %v, want commit c2 not to be copied", dstFiles)
+	}
+	m, err := ReadSyncManifest(Repo(dst).Commit("c1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != 2 || m.Files["a.unit.json"] != checksum([]byte("a")) {
+		t.Errorf("got manifest %+v, want checksums of 2 files", m)
+	}
+
+	// Resuming (syncing all commits) only copies the files that aren't
+	// in dst yet.
+	res, err = Sync(src, dst, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (SyncResult{Commits: 2, Copied: 1, Skipped: 2, Bytes: 1}); *res != want {
+		t.Errorf("got result %+v, want %+v", *res, want)
+	}
+
+	// Syncing from a store with a manifest verifies the checksums.
+	dstFiles["c1/a.unit.json"] = "corrupted"
+	if _, err := Sync(dst, rwvfs.Walkable(rwvfs.Map(map[string]string{})), []string{"c1"}); err == nil {
+		t.Error("got no error syncing a file whose checksum doesn't match the manifest")
+	}
+}
@@ -0,0 +1,87 @@
+package buildstore
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+)
+
+// OpenURL returns a VFS for the repo build store (a directory that
+// contains a subdirectory of build data for each commit, like a
+// repository's .srclib-cache directory) at storeURL, which is one of:
+//
+//	DIR or file:///DIR            a local directory (created if needed)
+//	s3://BUCKET/PREFIX            objects in an S3 bucket (see S3)
+//	http://HOST/PATH (or https)   an HTTP server that serves rwvfs.HTTPHandler
+//
+// Requests to remote (S3 and HTTP) stores are authenticated with the
+// credentials that the CredentialHelpers provide for storeURL (see
+// LookupCredentials).
+//
+// Failed operations on remote (S3 and HTTP) stores are retried (see
+// Retrying, RetryAttempts, and RetryBackoff). If EncryptionKeyFile is
+// set, the build data in remote stores is encrypted with its key (see
+// Encrypted).
+func OpenURL(storeURL string) (rwvfs.WalkableFileSystem, error) {
+	u, err := url.Parse(storeURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "", "file":
+		dir := storeURL
+		if u.Scheme == "file" {
+			dir = filepath.FromSlash(u.Path)
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		fs := rwvfs.OS(dir)
+		setCreateParentDirs(fs)
+		return rwvfs.Walkable(fs), nil
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("no bucket in S3 build store URL %q", storeURL)
+		}
+		creds, err := LookupCredentials(u)
+		if err != nil {
+			return nil, err
+		}
+		return encryptRemote(S3(u.Host, u.Path, creds))
+	case "http", "https":
+		client, err := HTTPClient(u)
+		if err != nil {
+			return nil, err
+		}
+		return encryptRemote(rwvfs.HTTP(u, retryableStatusClient(client)))
+	}
+	return nil, fmt.Errorf("unsupported build store URL scheme %q in %q (use a local directory or an s3, http, or https URL)", u.Scheme, storeURL)
+}
+
+// encryptRemote returns fs, retrying failed operations and encrypted
+// with the key in EncryptionKeyFile if it is set.
+func encryptRemote(fs rwvfs.FileSystem) (rwvfs.WalkableFileSystem, error) {
+	// Retry beneath encryption, so that only complete files are
+	// decrypted.
+	fs = Retrying(fs, RetryAttempts, RetryBackoff)
+	if EncryptionKeyFile != "" {
+		key, err := ReadEncryptionKey(EncryptionKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if fs, err = Encrypted(fs, key); err != nil {
+			return nil, err
+		}
+	}
+	return rwvfs.Walkable(fs), nil
+}
+
+// IsLocalURL reports whether storeURL (see OpenURL) refers to a local
+// directory.
+func IsLocalURL(storeURL string) bool {
+	u, err := url.Parse(storeURL)
+	return err == nil && (u.Scheme == "" || u.Scheme == "file")
+}
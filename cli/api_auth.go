@@ -0,0 +1,237 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+)
+
+// An APIPrincipal is a client of "srclib api serve" that authenticated
+// with a token (see APIService.Authenticate) or a TLS client
+// certificate. The principals that may connect are listed in the
+// server's --acl file (a JSON array of APIPrincipals).
+type APIPrincipal struct {
+	// Name identifies the principal. A client certificate whose
+	// subject common name is Name authenticates the principal.
+	Name string
+
+	// TokenSHA256 is the hex-encoded SHA-256 hash of the principal's
+	// token (e.g., the output of "printf %s TOKEN | sha256sum"), if it
+	// may authenticate with one.
+	TokenSHA256 string `json:",omitempty"`
+
+	// Repos are the URIs of the repositories that the principal may
+	// query, as path.Match patterns (e.g., "github.com/org/*"). If
+	// empty, the principal may query all repositories. They are
+	// checked by the "acl" authorizer (see APIAuthorizer).
+	Repos []string `json:",omitempty"`
+}
+
+// An APIAuthorizer decides whether authenticated principals may query
+// the data of a repository served by "srclib api serve". Authorizers
+// other than the default ("acl", which checks the principal's Repos)
+// are registered with RegisterAPIAuthorizer, typically in the init
+// function of a package that is linked into the srclib program (e.g.,
+// to consult an organization's permissions service), and are selected
+// with "srclib api serve --authorizer".
+type APIAuthorizer interface {
+	// Authorize returns nil if p may query the repository repoURI
+	// (which is empty if the repository's URI isn't known), or else
+	// an error describing why not.
+	Authorize(p *APIPrincipal, repoURI string) error
+}
+
+// APIAuthorizerFunc adapts an ordinary function to an APIAuthorizer.
+type APIAuthorizerFunc func(p *APIPrincipal, repoURI string) error
+
+// Authorize calls f(p, repoURI).
+func (f APIAuthorizerFunc) Authorize(p *APIPrincipal, repoURI string) error { return f(p, repoURI) }
+
+// DefaultAPIAuthorizer is the name of the APIAuthorizer that is used
+// when none is selected. It allows principals to query the
+// repositories that match their Repos.
+const DefaultAPIAuthorizer = "acl"
+
+// apiAuthorizers holds the registered APIAuthorizers, keyed by name.
+var apiAuthorizers = map[string]APIAuthorizer{
+	DefaultAPIAuthorizer: APIAuthorizerFunc(aclAuthorize),
+}
+
+// RegisterAPIAuthorizer makes an APIAuthorizer available by name. If
+// RegisterAPIAuthorizer is called twice with the same name or if a is
+// nil, it panics.
+func RegisterAPIAuthorizer(name string, a APIAuthorizer) {
+	if a == nil {
+		panic("cli: RegisterAPIAuthorizer authorizer is nil")
+	}
+	if _, dup := apiAuthorizers[name]; dup {
+		panic("cli: RegisterAPIAuthorizer called twice for authorizer " + name)
+	}
+	apiAuthorizers[name] = a
+}
+
+// lookupAPIAuthorizer returns the registered APIAuthorizer with the
+// given name, or the default APIAuthorizer if name is empty.
+func lookupAPIAuthorizer(name string) (APIAuthorizer, error) {
+	if name == "" {
+		name = DefaultAPIAuthorizer
+	}
+	if a, ok := apiAuthorizers[name]; ok {
+		return a, nil
+	}
+	names := make([]string, 0, len(apiAuthorizers))
+	for name := range apiAuthorizers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown API authorizer %q (registered authorizers are: %s)", name, strings.Join(names, ", "))
+}
+
+// aclAuthorize allows p to query the repositories that match p.Repos.
+func aclAuthorize(p *APIPrincipal, repoURI string) error {
+	if len(p.Repos) == 0 {
+		return nil
+	}
+	for _, pat := range p.Repos {
+		if match, _ := path.Match(pat, repoURI); match {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s may not query repository %q", p.Name, repoURI)
+}
+
+var (
+	errAPIUnauthenticated = errors.New("not authenticated (call API.Authenticate with a token first)")
+	errAPIBadToken        = errors.New("invalid token")
+)
+
+// apiAuth authenticates and authorizes the clients of "srclib api
+// serve". A nil *apiAuth allows all clients.
+type apiAuth struct {
+	principals []*APIPrincipal // from the --acl file (nil if none was given)
+	authorizer APIAuthorizer
+}
+
+// readAPIPrincipals reads the JSON array of APIPrincipals in file.
+func readAPIPrincipals(file string) ([]*APIPrincipal, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var ps []*APIPrincipal
+	if err := json.Unmarshal(data, &ps); err != nil {
+		return nil, fmt.Errorf("reading API principals from %s: %s", file, err)
+	}
+	seen := map[string]bool{}
+	for _, p := range ps {
+		if p.Name == "" {
+			return nil, fmt.Errorf("API principal in %s has no Name", file)
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("API principal %q is listed twice in %s", p.Name, file)
+		}
+		seen[p.Name] = true
+		if p.TokenSHA256 != "" {
+			if sum, err := hex.DecodeString(p.TokenSHA256); err != nil || len(sum) != sha256.Size {
+				return nil, fmt.Errorf("API principal %q in %s: TokenSHA256 must be 64 hex digits", p.Name, file)
+			}
+		}
+		for _, pat := range p.Repos {
+			if _, err := path.Match(pat, ""); err != nil {
+				return nil, fmt.Errorf("API principal %q in %s: invalid repository pattern %q", p.Name, file, pat)
+			}
+		}
+	}
+	return ps, nil
+}
+
+// tokenPrincipal returns the principal whose token is token.
+func (a *apiAuth) tokenPrincipal(token string) (*APIPrincipal, error) {
+	sum := sha256.Sum256([]byte(token))
+	for _, p := range a.principals {
+		want, _ := hex.DecodeString(p.TokenSHA256)
+		if len(want) == len(sum) && subtle.ConstantTimeCompare(sum[:], want) == 1 {
+			return p, nil
+		}
+	}
+	return nil, errAPIBadToken
+}
+
+// certPrincipal returns the principal that the (verified) client
+// certificate cert authenticates: the one named by its subject common
+// name, or, if no principals were listed, a principal with that name
+// that may query all repositories.
+func (a *apiAuth) certPrincipal(cert *x509.Certificate) (*APIPrincipal, error) {
+	name := cert.Subject.CommonName
+	if name == "" {
+		return nil, errors.New("client certificate has no subject common name")
+	}
+	if a.principals == nil {
+		return &APIPrincipal{Name: name}, nil
+	}
+	for _, p := range a.principals {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("client certificate names unknown principal %q", name)
+}
+
+// connPrincipal returns the principal that conn's verified TLS client
+// certificate authenticates, or nil if conn isn't a TLS connection or
+// has no client certificate (in which case the client must
+// authenticate with a token).
+func (a *apiAuth) connPrincipal(conn *tls.Conn) (*APIPrincipal, error) {
+	if err := conn.Handshake(); err != nil {
+		return nil, err
+	}
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, nil
+	}
+	return a.certPrincipal(certs[0])
+}
+
+// authorize returns nil if p may query the repository repoURI.
+func (a *apiAuth) authorize(p *APIPrincipal, repoURI string) error {
+	if a == nil {
+		return nil
+	}
+	if p == nil {
+		return errAPIUnauthenticated
+	}
+	return a.authorizer.Authorize(p, repoURI)
+}
+
+// apiTLSConfig returns the TLS configuration for serving with the
+// certificate and key in certFile and keyFile and, if clientCAFile is
+// set, requiring client certificates signed by one of the CAs in it.
+func apiTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if clientCAFile != "" {
+		pem, err := ioutil.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates in %s", clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
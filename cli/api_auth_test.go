@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAPIService_auth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-api-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hash := func(token string) string {
+		sum := sha256.Sum256([]byte(token))
+		return hex.EncodeToString(sum[:])
+	}
+	acl := filepath.Join(dir, "acl.json")
+	if err := ioutil.WriteFile(acl, []byte(`[
+		{"Name": "ci", "TokenSHA256": "`+hash("t1")+`", "Repos": ["github.com/org/*"]},
+		{"Name": "other", "TokenSHA256": "`+hash("t2")+`", "Repos": ["github.com/elsewhere/*"]}
+	]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	auth, _, err := (&APIServeCmd{ACL: acl}).auth()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc := &APIService{repo: &Repo{}, repoURI: "github.com/org/repo", cache: newAPICache(&countingRepoStore{}, 1), auth: auth}
+
+	// Each connection has its own session.
+	s1, s2 := svc.session(nil), svc.session(nil)
+	var stats APICacheStats
+	if err := s1.CacheStats(&struct{}{}, &stats); err != errAPIUnauthenticated {
+		t.Errorf("got error %v before authenticating, want errAPIUnauthenticated", err)
+	}
+	if err := s1.Authenticate(&APIAuthenticateArgs{Token: "bad"}, &APIAuthenticateReply{}); err != errAPIBadToken {
+		t.Errorf("got error %v for a bad token, want errAPIBadToken", err)
+	}
+	var reply APIAuthenticateReply
+	if err := s1.Authenticate(&APIAuthenticateArgs{Token: "t1"}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Name != "ci" {
+		t.Errorf("got principal %q, want ci", reply.Name)
+	}
+	if err := s1.CacheStats(&struct{}{}, &stats); err != nil {
+		t.Errorf("got error %v after authenticating, want nil", err)
+	}
+	if err := s2.CacheStats(&struct{}{}, &stats); err != errAPIUnauthenticated {
+		t.Errorf("got error %v in another session, want errAPIUnauthenticated", err)
+	}
+
+	// A principal whose Repos don't match the repository isn't
+	// authorized.
+	if err := s2.Authenticate(&APIAuthenticateArgs{Token: "t2"}, &APIAuthenticateReply{}); err == nil {
+		t.Error("got no error authenticating a principal without access to the repository")
+	}
+}
+
+func TestAPIServeCmd_auth(t *testing.T) {
+	tests := map[string]APIServeCmd{
+		"key without cert":        {TLSKey: "k.pem"},
+		"client CA without cert":  {TLSClientCA: "ca.pem"},
+		"authorizer without auth": {Authorizer: "acl"},
+	}
+	for label, c := range tests {
+		if _, _, err := c.auth(); err == nil {
+			t.Errorf("%s: got no error, want an error", label)
+		}
+	}
+
+	auth, tlsConfig, err := (&APIServeCmd{}).auth()
+	if auth != nil || tlsConfig != nil || err != nil {
+		t.Errorf("got %v, %v, %v without options, want nil, nil, nil", auth, tlsConfig, err)
+	}
+	if err := auth.authorize(nil, "r"); err != nil {
+		t.Errorf("got error %v authorizing without authentication, want nil", err)
+	}
+}
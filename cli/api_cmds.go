@@ -0,0 +1,748 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alexsaveliev/go-colorable-wrapper"
+	"sourcegraph.com/sourcegraph/go-flags"
+
+	"sourcegraph.com/sourcegraph/srclib/authorship"
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/docurl"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func init() {
+	cliInit = append(cliInit, func(cli *flags.Command) {
+		c, err := cli.AddCommand("api",
+			"API commands (for editor plugins and scripts)",
+			"The api subcommands query the data that was imported into the local repository's store (by `srclib store import`) and print the results as text or JSON.",
+			&apiCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = c.AddCommand("authors",
+			"show who wrote a def",
+			`Shows the authors of a def (according to "git blame" or the equivalent), in descending order of the number of the def's lines that they last changed.
+
+Authorship is only computed for source units whose Config sets "`+authorship.ConfigKey+`" to "true" (e.g., in the Srcfile's Config or UnitOverrides).`,
+			&apiAuthorsCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		impactC, err := c.AddCommand("impact",
+			"list the code that renaming a def would change",
+			`Lists every location that would need to change if a def were renamed: its definition and all refs to it, grouped by repository, source unit, and file.
+
+The def is specified either by its path (--def, with --unit-type and --unit if the path is ambiguous) or by the position of its definition or of any ref to it (--file and --start-byte). With a MultiRepoStore (--type MultiRepoStore), refs from all repositories in the store are listed; specify the def's repository with --repo.
+
+Line numbers are only computed for files in the local repository.`,
+			&apiImpactCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+		setLocalStoreRootDefault(impactC.Group)
+
+		_, err = c.AddCommand("describe",
+			"describe the defs and refs at positions in files",
+			`Describes the def or ref at each of the given positions: the ref (if any) whose span contains the position, and the def that it defines or refers to. Positions are given as FILE:OFFSET arguments (where OFFSET is a byte offset in FILE), or, if there are no arguments, as a JSON array of {"File": FILE, "StartByte": OFFSET} objects on stdin.
+
+The results are printed as a JSON array, in the order of the positions. A position with no def or ref has an Error. The repository and its store are opened once for all of the positions, and each file's refs are read once, so it's much faster to describe many positions (e.g., all of the identifiers visible in an editor) in one invocation than in one invocation per position.`,
+			&apiDescribeCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = c.AddCommand("hover",
+			"show editor hover content for the defs and refs at positions in files",
+			`Prints ready-to-render hover content for the def or ref at each of the given positions (given as for "srclib api describe"): the def's signature in a Markdown code block, its documentation (truncated to --max-doc-length characters), and a link to its URL (made from the URL templates, as for "srclib api url").
+
+The results are printed as a JSON array, in the order of the positions, with each position's Markdown Contents, the span (Start and End) of the ref at the position, and the URL that the content links to. A position with no def or ref has an Error. With --markdown, only the contents are printed.
+
+Defs whose source unit type has a registered def formatter are formatted with it; others are shown as their kind and name. Defs in other repositories (which aren't in the store) are shown by name.`,
+			&apiHoverCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = c.AddCommand("url",
+			"print the URLs of a def",
+			`Prints the browsable URLs (e.g., on godoc.org or Sourcegraph) of a def, specified by its key, one per line after the name of the URL template it was made from.
+
+URLs are made from the URL templates that apply to the def's source unit type and repository: those given with --template, then those in the Srcfile's DocURLs, then the built-in templates. Only the first applicable template with each name is used. A template is a URL with the placeholders {repo}, {commit}, {unit-type}, {unit}, {path}, {dotpath} (the path with "/" replaced by "."), and {name} (the last component of the path).`,
+			&apiURLCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = c.AddCommand("deps",
+			"list the external dependencies of a file or source unit",
+			`Lists the external dependencies (repositories and source units) whose defs are referred to by a file (--file) or a source unit (--unit-type and --unit), with the number of refs to each dependency and the number of distinct defs referred to. Dependencies are listed in descending order of refs.
+
+The version that each dependency resolved to is taken from the depresolve data of the referring source units. Dependencies that weren't found in the depresolve data are shown as unresolved.`,
+			&apiDepsCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = c.AddCommand("xrefs-out",
+			"list the external repositories that a commit refers to",
+			`Lists the external repositories whose defs are referred to by the refs in the build data of the current commit (or --commit), with the number of refs to each repository, the number of distinct defs referred to, and the number of source units that refer to it. Repositories are listed in descending order of refs.
+
+Unlike "srclib api deps", it reads the build data (see "srclib make"), not the store, and doesn't match the repositories with depresolve data.`,
+			&apiXrefsOutCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = c.AddCommand("serve",
+			"serve the api commands over JSON-RPC",
+			`Serves the api commands over JSON-RPC (version 1.0, as implemented by Go's net/rpc/jsonrpc package), on stdin and stdout or on a TCP address (--listen), for editor plugins that make many queries. The methods are API.Describe (whose params are {"Positions": [{"File": FILE, "StartByte": OFFSET}, ...], "CommitID": COMMIT} and whose result is {"Results": [...]}, as printed by "srclib api describe"), API.Hover (whose params are those of API.Describe plus the optional "MaxDocLength", "Link", and "NoLink", as for "srclib api hover", and whose result is {"Results": [...]}, as printed by "srclib api hover"), API.InboundRefs (see below), API.RepoInfo (whose result is {"URI": ..., "CommitID": ..., "Tags": [...], "Metadata": {...}}, with the repository-level tags and metadata in its Srcfile), API.CacheStats, API.ClearCache, and API.Authenticate (see below). API.Describe and API.Hover also accept "CommitIDs" (e.g., the base and head commits of a pull request) instead of "CommitID", in which case the commits are queried concurrently and the results for each commit are returned in the result's "ByCommit" object (keyed by commit ID) instead of "Results".
+
+The decoded defs and refs of the most recently queried source units are kept in memory (up to --cache-units units, evicting the least recently used ones), so repeated queries of the same files are answered without reading the store again. Call API.ClearCache after reimporting data for a commit that was queried.
+
+With --xref-store DIR, API.InboundRefs answers which files in other repositories refer to a def, from the MultiRepoStore rooted at DIR (into which the repositories' data was imported with "srclib store import --type MultiRepoStore"). Its params are {"Def": {"Repo": REPO, "UnitType": TYPE, "Unit": UNIT, "Path": PATH}, "Offset": N, "Limit": N}, and its result is {"Files": [{"Repo": ..., "CommitID": ..., "File": ..., "Refs": N}, ...], "TotalFiles": N, "TotalRepos": N, "NextOffset": N}, listing at most Limit files (default 100) starting at Offset. To get the next page, call it again with the result's NextOffset, which is omitted on the last page. Refs from all imported commits of the other repositories are listed, but only from repositories that the client may query. With "Tags": [TAG, ...] and "Metadata": {KEY: VALUE, ...} in its params, only refs in source units with all of those tags and metadata are listed (e.g., the repository-level tags and metadata from the repositories' Srcfiles or "srclib store import --repo-tag/--repo-meta", to list only the refs from one team's repositories).
+
+To share a server within an organization, serve over TLS (--tls-cert and --tls-key) and require clients to authenticate. With --acl FILE, clients must authenticate as one of the principals listed in FILE, a JSON array of objects with a "Name", an optional "TokenSHA256" (the hex SHA-256 hash of the principal's token), and optional "Repos" (path.Match patterns of the repository URIs that the principal may query; all if empty). A client authenticates by calling API.Authenticate (whose params are {"Token": TOKEN}) before its other requests, or, with --tls-client-ca, by presenting a client certificate signed by one of the CAs in that file, whose subject common name is the principal's name (without --acl, any such certificate is accepted). The principal's access to the repository is checked on every request by the authorizer (--authorizer; the default, "acl", checks the principal's Repos). Other authorizers (e.g., ones that consult an organization's permissions service) can be registered by programs that link in srclib's cli package (see RegisterAPIAuthorizer).
+
+If the store is encrypted (see "srclib store"), give its key with --store-encryption-key-file or $SRCLIB_STORE_KEY_FILE.
+
+With --metrics-listen ADDR, Prometheus metrics are served over HTTP at http://ADDR/metrics: the number of requests by method and status (srclib_api_requests_total), their latencies (srclib_api_request_duration_seconds), the number of accepted and rejected connections (srclib_api_connections_total), and the use of the cache (srclib_api_cache_*).
+
+With --trace-listen ADDR, each request is traced (with its method as the trace's title), and the traces of the active, recent, slowest, and failed requests are served over HTTP at http://ADDR/debug/requests (only to clients on the same host). To profile the server process itself, use the global --cpuprofile, --memprofile, and --trace options; they are written when the server exits.`,
+			&apiServeCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	})
+}
+
+type APICmd struct{}
+
+var apiCmd APICmd
+
+func (c *APICmd) Execute(args []string) error { return nil }
+
+// openAPIStore opens the store of the repository containing the
+// current directory, which is where `srclib store import` imports
+// data to by default.
+func openAPIStore() (*Repo, interface{}, error) {
+	repo, err := OpenLocalRepo()
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := (&StoreCmd{Type: "RepoStore", Root: filepath.Join(repo.RootDir, store.SrclibStoreDir)}).store()
+	if err != nil {
+		return nil, nil, err
+	}
+	return repo, s, nil
+}
+
+type APIAuthorsCmd struct {
+	Def      string `long:"def" required:"yes" description:"path of the def" value-name:"PATH"`
+	UnitType string `long:"unit-type" description:"type of the def's source unit (if the def path is ambiguous)"`
+	Unit     string `long:"unit" description:"name of the def's source unit (if the def path is ambiguous)"`
+	CommitID string `long:"commit" description:"commit ID whose data to query (default: the current commit)"`
+	JSON     bool   `long:"json" description:"print the defs and their authors as JSON"`
+}
+
+var apiAuthorsCmd APIAuthorsCmd
+
+func (c *APIAuthorsCmd) Execute(args []string) error {
+	if (c.UnitType == "") != (c.Unit == "") {
+		return fmt.Errorf("must specify either both or neither of --unit-type and --unit")
+	}
+	repo, s, err := openAPIStore()
+	if err != nil {
+		return err
+	}
+	rs, ok := s.(store.RepoStore)
+	if !ok {
+		return fmt.Errorf("store (type %T) does not implement listing defs", s)
+	}
+
+	commitID := c.CommitID
+	if commitID == "" {
+		commitID = repo.CommitID
+	}
+	fs := []store.DefFilter{store.ByCommitIDs(commitID), store.ByDefPath(c.Def)}
+	if c.Unit != "" {
+		fs = append(fs, store.ByUnits(unit.ID2{Type: c.UnitType, Name: c.Unit}))
+	}
+	defs, err := rs.Defs(fs...)
+	if err != nil {
+		return err
+	}
+	if len(defs) == 0 {
+		return fmt.Errorf("no def with path %q found at commit %s (did you run `srclib store import`?)", c.Def, commitID)
+	}
+
+	if c.JSON {
+		type defAuthors struct {
+			graph.DefKey
+			Authors []*graph.DefAuthor
+		}
+		out := make([]defAuthors, len(defs))
+		for i, def := range defs {
+			out[i] = defAuthors{def.DefKey, def.Authors}
+		}
+		PrintJSON(out, "  ")
+		return nil
+	}
+
+	for i, def := range defs {
+		if i > 0 {
+			fmt.Println()
+		}
+		colorable.Println(colorable.Cyan(fmt.Sprintf("%s %s %s", def.UnitType, def.Unit, def.Path)))
+		if len(def.Authors) == 0 {
+			fmt.Printf("  no authorship data (set %q to \"true\" in the unit's Config to compute it)\n", authorship.ConfigKey)
+			continue
+		}
+		for _, a := range def.Authors {
+			commit := a.LastCommitID
+			if len(commit) > 7 {
+				commit = commit[:7]
+			}
+			fmt.Printf("  %-40s %4d lines  last changed in %s (%s)\n", authorLabel(a), a.Lines, commit, a.LastCommitDate)
+		}
+	}
+	return nil
+}
+
+// authorLabel returns "Name <email>" (or whichever of the two is
+// known) for a.
+func authorLabel(a *graph.DefAuthor) string {
+	switch {
+	case a.Name == "":
+		return "<" + a.Email + ">"
+	case a.Email == "":
+		return a.Name
+	}
+	return a.Name + " <" + a.Email + ">"
+}
+
+type APIImpactCmd struct {
+	StoreCmd
+
+	Repo     string `long:"repo" description:"repository of the def (in a MultiRepoStore)"`
+	CommitID string `long:"commit" description:"commit ID of the def's repository whose data to query (default: the current commit)"`
+
+	Def      string `long:"def" description:"path of the def" value-name:"PATH"`
+	UnitType string `long:"unit-type" description:"type of the def's source unit"`
+	Unit     string `long:"unit" description:"name of the def's source unit"`
+
+	File      string `long:"file" description:"file containing the def or a ref to it" value-name:"FILE"`
+	StartByte uint32 `long:"start-byte" description:"byte offset in --file of the def's name or of a ref to it" value-name:"OFFSET"`
+
+	JSON bool `long:"json" description:"print the locations as JSON"`
+}
+
+var apiImpactCmd APIImpactCmd
+
+// An impactRef is a location that would need to change if a def were
+// renamed.
+type impactRef struct {
+	Start, End uint32
+	Line       int  `json:",omitempty"` // 1-indexed; only known for local files
+	Def        bool `json:",omitempty"` // whether this is the def's definition
+}
+
+type impactFile struct {
+	File string
+	Refs []impactRef
+}
+
+type impactUnit struct {
+	UnitType string
+	Unit     string
+	Files    []*impactFile
+}
+
+type impactRepo struct {
+	Repo  string `json:",omitempty"`
+	Units []*impactUnit
+}
+
+// An impact is the result of "srclib api impact".
+type impact struct {
+	Def     graph.DefKey
+	NumRefs int
+	Repos   []*impactRepo
+}
+
+func (c *APIImpactCmd) Execute(args []string) error {
+	if (c.Def == "") == (c.File == "") {
+		return fmt.Errorf("must specify either --def or --file and --start-byte")
+	}
+	if (c.UnitType == "") != (c.Unit == "") {
+		return fmt.Errorf("must specify either both or neither of --unit-type and --unit")
+	}
+
+	repo, err := OpenLocalRepo()
+	if err != nil {
+		return err
+	}
+	s, err := c.store()
+	if err != nil {
+		return err
+	}
+	rs, ok := s.(store.RepoStore)
+	if !ok {
+		return fmt.Errorf("store (type %T) does not implement listing refs", s)
+	}
+	commitID := c.CommitID
+	if commitID == "" {
+		commitID = repo.CommitID
+	}
+
+	// Filters that select the def's repository and commit.
+	var scope []store.RefFilter
+	if c.Repo != "" {
+		scope = append(scope, store.ByRepos(c.Repo))
+	}
+	scope = append(scope, store.ByCommitIDs(commitID))
+
+	var def graph.RefDefKey
+	if c.File != "" {
+		file, err := repoRelPath(repo.RootDir, c.File)
+		if err != nil {
+			return err
+		}
+		start := c.StartByte
+		fs := append(scope, store.ByFiles(true, file), store.RefFilterFunc(func(r *graph.Ref) bool {
+			return r.Start <= start && start < r.End
+		}))
+		refs, err := rs.Refs(fs...)
+		if err != nil {
+			return err
+		}
+		if len(refs) == 0 {
+			return fmt.Errorf("no def or ref found at %s:%d at commit %s (did you run `srclib store import`?)", file, start, commitID)
+		}
+		dk := refDefKey(refs[0])
+		def = graph.RefDefKey{DefRepo: dk.Repo, DefUnitType: dk.UnitType, DefUnit: dk.Unit, DefPath: dk.Path}
+	} else {
+		def = graph.RefDefKey{DefRepo: c.Repo, DefUnitType: c.UnitType, DefUnit: c.Unit, DefPath: c.Def}
+		if def.DefUnit == "" {
+			// Find the def's unit, which ByRefDef requires when
+			// matching refs from other units.
+			defs, err := rs.Defs(store.ByCommitIDs(commitID), store.ByDefPath(c.Def))
+			if err != nil {
+				return err
+			}
+			switch len(defs) {
+			case 0:
+				return fmt.Errorf("no def with path %q found at commit %s (did you run `srclib store import`?)", c.Def, commitID)
+			case 1:
+				def.DefUnitType, def.DefUnit = defs[0].UnitType, defs[0].Unit
+			default:
+				return fmt.Errorf("def path %q is ambiguous (found in %d source units); specify --unit-type and --unit", c.Def, len(defs))
+			}
+		}
+	}
+
+	// List refs in the def's repository at commitID and in other
+	// repositories at any commit.
+	defRepo, defCommitID := def.DefRepo, commitID
+	refs, err := rs.Refs(store.ByRefDef(def), store.AbsRefFilterFunc(func(r *graph.Ref) bool {
+		return r.Repo != defRepo || r.CommitID == defCommitID
+	}))
+	if err != nil {
+		return err
+	}
+
+	im := groupImpact(graph.DefKey{Repo: def.DefRepo, CommitID: commitID, UnitType: def.DefUnitType, Unit: def.DefUnit, Path: def.DefPath}, refs)
+	srcs := map[string][]byte{}
+	for _, r := range im.Repos {
+		if r.Repo != "" && r.Repo != c.Repo {
+			continue
+		}
+		for _, u := range r.Units {
+			for _, f := range u.Files {
+				src, ok := srcs[f.File]
+				if !ok {
+					src, _ = ioutil.ReadFile(filepath.Join(repo.RootDir, filepath.FromSlash(f.File)))
+					srcs[f.File] = src
+				}
+				if src == nil {
+					continue
+				}
+				for i := range f.Refs {
+					f.Refs[i].Line = authorship.LineOf(src, f.Refs[i].Start)
+				}
+			}
+		}
+	}
+
+	if c.JSON {
+		PrintJSON(im, "  ")
+		return nil
+	}
+	colorable.Println(colorable.Cyan(fmt.Sprintf("%s %s %s: %d locations", im.Def.UnitType, im.Def.Unit, im.Def.Path, im.NumRefs)))
+	for _, r := range im.Repos {
+		for _, u := range r.Units {
+			label := u.Unit + " (" + u.UnitType + ")"
+			if r.Repo != "" {
+				label = r.Repo + " " + label
+			}
+			fmt.Println(label)
+			for _, f := range u.Files {
+				for _, ref := range f.Refs {
+					pos := fmt.Sprintf("%s:%d-%d", f.File, ref.Start, ref.End)
+					if ref.Line != 0 {
+						pos = fmt.Sprintf("%s:%d", f.File, ref.Line)
+					}
+					if ref.Def {
+						pos += " (definition)"
+					}
+					fmt.Println("  " + pos)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// groupImpact groups refs to the def by repository, source unit, and
+// file, sorting each group.
+func groupImpact(def graph.DefKey, refs []*graph.Ref) *impact {
+	sort.Sort(graph.Refs(refs))
+	im := &impact{Def: def, NumRefs: len(refs)}
+	repos := map[string]*impactRepo{}
+	units := map[[3]string]*impactUnit{}
+	files := map[[4]string]*impactFile{}
+	for _, r := range refs {
+		rp := repos[r.Repo]
+		if rp == nil {
+			rp = &impactRepo{Repo: r.Repo}
+			repos[r.Repo] = rp
+			im.Repos = append(im.Repos, rp)
+		}
+		uk := [3]string{r.Repo, r.UnitType, r.Unit}
+		u := units[uk]
+		if u == nil {
+			u = &impactUnit{UnitType: r.UnitType, Unit: r.Unit}
+			units[uk] = u
+			rp.Units = append(rp.Units, u)
+		}
+		fk := [4]string{r.Repo, r.UnitType, r.Unit, r.File}
+		f := files[fk]
+		if f == nil {
+			f = &impactFile{File: r.File}
+			files[fk] = f
+			u.Files = append(u.Files, f)
+		}
+		f.Refs = append(f.Refs, impactRef{Start: r.Start, End: r.End, Def: r.Def})
+	}
+
+	sort.Sort(impactReposByName(im.Repos))
+	for _, rp := range im.Repos {
+		sort.Sort(impactUnitsByName(rp.Units))
+		for _, u := range rp.Units {
+			sort.Sort(impactFilesByName(u.Files))
+			for _, f := range u.Files {
+				sort.Sort(impactRefsByStart(f.Refs))
+			}
+		}
+	}
+	return im
+}
+
+// repoRelPath returns the slash-separated path of file (relative to
+// the current directory) relative to rootDir.
+func repoRelPath(rootDir, file string) (string, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(rootDir, abs)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+type impactReposByName []*impactRepo
+
+func (v impactReposByName) Len() int           { return len(v) }
+func (v impactReposByName) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v impactReposByName) Less(i, j int) bool { return v[i].Repo < v[j].Repo }
+
+type impactUnitsByName []*impactUnit
+
+func (v impactUnitsByName) Len() int      { return len(v) }
+func (v impactUnitsByName) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v impactUnitsByName) Less(i, j int) bool {
+	if v[i].UnitType != v[j].UnitType {
+		return v[i].UnitType < v[j].UnitType
+	}
+	return v[i].Unit < v[j].Unit
+}
+
+type impactFilesByName []*impactFile
+
+func (v impactFilesByName) Len() int           { return len(v) }
+func (v impactFilesByName) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v impactFilesByName) Less(i, j int) bool { return v[i].File < v[j].File }
+
+type impactRefsByStart []impactRef
+
+func (v impactRefsByStart) Len() int           { return len(v) }
+func (v impactRefsByStart) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v impactRefsByStart) Less(i, j int) bool { return v[i].Start < v[j].Start }
+
+type APIDescribeCmd struct {
+	CommitID string `long:"commit" description:"commit ID whose data to query (default: the current commit)"`
+
+	Args struct {
+		Positions []string `name:"FILE:OFFSET" description:"positions to describe (default: read a JSON array of positions from stdin)"`
+	} `positional-args:"yes"`
+}
+
+var apiDescribeCmd APIDescribeCmd
+
+// A describePosition is a position passed to "srclib api describe".
+type describePosition struct {
+	File      string
+	StartByte uint32
+}
+
+// A describeResult is the result of "srclib api describe" for a
+// position.
+type describeResult struct {
+	describePosition
+	Ref   *graph.Ref `json:",omitempty"` // the innermost ref containing the position
+	Def   *graph.Def `json:",omitempty"` // the def that Ref defines or refers to (if it's in the store)
+	Error string     `json:",omitempty"`
+}
+
+func (c *APIDescribeCmd) Execute(args []string) error {
+	var positions []describePosition
+	if len(c.Args.Positions) == 0 {
+		if err := json.NewDecoder(os.Stdin).Decode(&positions); err != nil {
+			return fmt.Errorf("reading positions from stdin: %s", err)
+		}
+	}
+	for _, arg := range c.Args.Positions {
+		p, err := parseDescribePosition(arg)
+		if err != nil {
+			return err
+		}
+		positions = append(positions, p)
+	}
+
+	repo, s, err := openAPIStore()
+	if err != nil {
+		return err
+	}
+	rs, ok := s.(store.RepoStore)
+	if !ok {
+		return fmt.Errorf("store (type %T) does not implement listing refs", s)
+	}
+	commitID := c.CommitID
+	if commitID == "" {
+		commitID = repo.CommitID
+	}
+
+	results, err := describePositions(newStoreDescribeSource(rs), repo.RootDir, commitID, positions)
+	if err != nil {
+		return err
+	}
+	PrintJSON(results, "  ")
+	return nil
+}
+
+// A describeSource provides the refs and defs that describePositions
+// looks up.
+type describeSource interface {
+	// fileRefs returns the refs in file (relative to the repository
+	// root) at commitID.
+	fileRefs(commitID, file string) ([]*graph.Ref, error)
+
+	// def returns the def (in the repository) with key k at commitID,
+	// or nil if there is none.
+	def(commitID string, k graph.DefKey) (*graph.Def, error)
+}
+
+// describePositions describes the def or ref at each position (see
+// APIDescribeCmd). Positions are relative to the current directory,
+// and rootDir is the repository's root directory.
+func describePositions(src describeSource, rootDir, commitID string, positions []describePosition) ([]*describeResult, error) {
+	results := make([]*describeResult, len(positions))
+	for i, p := range positions {
+		res := &describeResult{describePosition: p}
+		results[i] = res
+		file, err := repoRelPath(rootDir, p.File)
+		if err != nil {
+			res.Error = err.Error()
+			continue
+		}
+		refs, err := src.fileRefs(commitID, file)
+		if err != nil {
+			return nil, err
+		}
+		res.Ref = refAt(refs, p.StartByte)
+		if res.Ref == nil {
+			res.Error = fmt.Sprintf("no def or ref found at %s:%d at commit %s", file, p.StartByte, commitID)
+			continue
+		}
+		if dk := refDefKey(res.Ref); dk.Repo == res.Ref.Repo {
+			if res.Def, err = src.def(commitID, dk); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return results, nil
+}
+
+// storeDescribeSource is a describeSource that queries a store,
+// remembering the results for the duration of a single "srclib api
+// describe" invocation.
+type storeDescribeSource struct {
+	rs   store.RepoStore
+	refs map[[2]string][]*graph.Ref // keyed by commit ID and file
+	defs map[graph.DefKey]*graph.Def
+}
+
+func newStoreDescribeSource(rs store.RepoStore) *storeDescribeSource {
+	return &storeDescribeSource{rs: rs, refs: map[[2]string][]*graph.Ref{}, defs: map[graph.DefKey]*graph.Def{}}
+}
+
+func (s *storeDescribeSource) fileRefs(commitID, file string) ([]*graph.Ref, error) {
+	if refs, present := s.refs[[2]string{commitID, file}]; present {
+		return refs, nil
+	}
+	refs, err := s.rs.Refs(store.ByCommitIDs(commitID), store.ByFiles(true, file))
+	if err != nil {
+		return nil, err
+	}
+	s.refs[[2]string{commitID, file}] = refs
+	return refs, nil
+}
+
+func (s *storeDescribeSource) def(commitID string, k graph.DefKey) (*graph.Def, error) {
+	k.CommitID = commitID
+	if def, present := s.defs[k]; present {
+		return def, nil
+	}
+	defs, err := s.rs.Defs(store.ByCommitIDs(commitID), store.ByUnits(unit.ID2{Type: k.UnitType, Name: k.Unit}), store.ByDefPath(k.Path))
+	if err != nil {
+		return nil, err
+	}
+	var def *graph.Def
+	if len(defs) > 0 {
+		def = defs[0]
+	}
+	s.defs[k] = def
+	return def, nil
+}
+
+// parseDescribePosition parses a position of the form "FILE:OFFSET".
+func parseDescribePosition(s string) (describePosition, error) {
+	i := strings.LastIndex(s, ":")
+	if i <= 0 {
+		return describePosition{}, fmt.Errorf("invalid position %q (expected FILE:OFFSET)", s)
+	}
+	off, err := strconv.ParseUint(s[i+1:], 10, 32)
+	if err != nil {
+		return describePosition{}, fmt.Errorf("invalid position %q (expected FILE:OFFSET): %s", s, err)
+	}
+	return describePosition{File: s[:i], StartByte: uint32(off)}, nil
+}
+
+// refAt returns the innermost (shortest) ref in refs whose span
+// contains the byte offset off, or nil if there is none.
+func refAt(refs []*graph.Ref, off uint32) *graph.Ref {
+	var found *graph.Ref
+	for _, r := range refs {
+		if r.Start <= off && off < r.End && (found == nil || r.End-r.Start < found.End-found.Start) {
+			found = r
+		}
+	}
+	return found
+}
+
+type APIURLCmd struct {
+	Def       string   `long:"def" required:"yes" description:"path of the def" value-name:"PATH"`
+	UnitType  string   `long:"unit-type" required:"yes" description:"type of the def's source unit"`
+	Unit      string   `long:"unit" required:"yes" description:"name of the def's source unit"`
+	Repo      string   `long:"repo" description:"URI of the def's repository (default: the current repository's)"`
+	CommitID  string   `long:"commit" description:"commit ID of the def (for templates with a {commit} placeholder)"`
+	Templates []string `long:"template" description:"URL template that takes precedence over the Srcfile's and built-in ones (repeatable)" value-name:"NAME=URL"`
+	Name      string   `long:"name" description:"only print the URL made from the template with this name (e.g., godoc)"`
+	JSON      bool     `long:"json" description:"print the URLs as JSON"`
+}
+
+var apiURLCmd APIURLCmd
+
+func (c *APIURLCmd) Execute(args []string) error {
+	var templates []*docurl.Template
+	for _, t := range c.Templates {
+		i := strings.Index(t, "=")
+		if i <= 0 {
+			return fmt.Errorf("invalid --template %q (expected NAME=URL)", t)
+		}
+		templates = append(templates, &docurl.Template{Name: t[:i], URL: t[i+1:]})
+	}
+
+	key := graph.DefKey{Repo: c.Repo, CommitID: c.CommitID, UnitType: c.UnitType, Unit: c.Unit, Path: c.Def}
+
+	// Outside of a repository, only the --template and built-in
+	// templates are used.
+	if repo, err := OpenRepo("."); err == nil {
+		if key.Repo == "" && repo.CloneURL != "" {
+			key.Repo = graph.MakeURI(repo.CloneURL)
+		}
+		cfg, err := config.ReadRepository(repo.RootDir)
+		if err != nil {
+			return err
+		}
+		templates = append(templates, cfg.DocURLs...)
+	}
+	templates = append(templates, docurl.Defaults...)
+
+	var urls []*docurl.URL
+	for _, u := range docurl.URLs(templates, key) {
+		if c.Name == "" || u.Name == c.Name {
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) == 0 {
+		return fmt.Errorf("no URL template applies to def %s %s %s (add one to the Srcfile's DocURLs or with --template)", c.UnitType, c.Unit, c.Def)
+	}
+
+	if c.JSON {
+		PrintJSON(urls, "  ")
+		return nil
+	}
+	for _, u := range urls {
+		if c.Name != "" {
+			fmt.Println(u.URL)
+		} else {
+			fmt.Printf("%-12s %s\n", u.Name, u.URL)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/dep"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestGroupImpact(t *testing.T) {
+	def := graph.DefKey{UnitType: "t", Unit: "u", Path: "F"}
+	refs := []*graph.Ref{
+		{Repo: "r2", UnitType: "t", Unit: "x", File: "x.go", Start: 5, End: 6},
+		{UnitType: "t", Unit: "u", File: "b.go", Start: 30, End: 31},
+		{UnitType: "t", Unit: "u", File: "a.go", Start: 10, End: 11, Def: true},
+		{UnitType: "t", Unit: "u", File: "b.go", Start: 3, End: 4},
+		{UnitType: "t", Unit: "a", File: "c.go", Start: 1, End: 2},
+	}
+	want := &impact{
+		Def:     def,
+		NumRefs: 5,
+		Repos: []*impactRepo{
+			{Units: []*impactUnit{
+				{UnitType: "t", Unit: "a", Files: []*impactFile{
+					{File: "c.go", Refs: []impactRef{{Start: 1, End: 2}}},
+				}},
+				{UnitType: "t", Unit: "u", Files: []*impactFile{
+					{File: "a.go", Refs: []impactRef{{Start: 10, End: 11, Def: true}}},
+					{File: "b.go", Refs: []impactRef{{Start: 3, End: 4}, {Start: 30, End: 31}}},
+				}},
+			}},
+			{Repo: "r2", Units: []*impactUnit{
+				{UnitType: "t", Unit: "x", Files: []*impactFile{
+					{File: "x.go", Refs: []impactRef{{Start: 5, End: 6}}},
+				}},
+			}},
+		},
+	}
+	if got := groupImpact(def, refs); !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(want)
+		t.Errorf("got %s, want %s", gotJSON, wantJSON)
+	}
+}
+
+func TestParseDescribePosition(t *testing.T) {
+	tests := map[string]*describePosition{
+		"a.go:12":          {File: "a.go", StartByte: 12},
+		"c:/x/a.go:0":      {File: "c:/x/a.go", StartByte: 0},
+		"a.go":             nil,
+		":12":              nil,
+		"a.go:x":           nil,
+		"a.go:99999999999": nil,
+	}
+	for s, want := range tests {
+		got, err := parseDescribePosition(s)
+		if want == nil {
+			if err == nil {
+				t.Errorf("%q: got nil error, want error", s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", s, err)
+			continue
+		}
+		if got != *want {
+			t.Errorf("%q: got %+v, want %+v", s, got, *want)
+		}
+	}
+}
+
+func TestRefAt(t *testing.T) {
+	outer := &graph.Ref{File: "a.go", Start: 0, End: 10}
+	inner := &graph.Ref{File: "a.go", Start: 4, End: 6}
+	refs := []*graph.Ref{outer, inner}
+	tests := map[uint32]*graph.Ref{0: outer, 4: inner, 5: inner, 6: outer, 10: nil}
+	for off, want := range tests {
+		if got := refAt(refs, off); got != want {
+			t.Errorf("offset %d: got %+v, want %+v", off, got, want)
+		}
+	}
+}
+
+func TestFormatHover(t *testing.T) {
+	def := &graph.Def{
+		DefKey: graph.DefKey{UnitType: "t", Unit: "u", Path: "p/F"},
+		Name:   "F",
+		Kind:   "func",
+		File:   "a.py",
+		Docs:   []*graph.DefDoc{{Format: "text/html", Data: "<p>F does &amp; returns things.</p>"}},
+	}
+	got := formatHover(def, def.DefKey, "https://example.com/F", 15)
+	want := "```python\nfunc F\n```\n\nF does &…\n\n[View documentation](https://example.com/F)"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got = formatHover(nil, graph.DefKey{Repo: "r", Unit: "u", Path: "p/G"}, "", 0)
+	want = "```\nG\n```\n\nDefined in u (r)"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTruncateDoc(t *testing.T) {
+	tests := []struct {
+		doc  string
+		max  int
+		want string
+	}{
+		{"short", 0, "short"},
+		{"short", 5, "short"},
+		{"one two three", 9, "one two…"},
+		{"onetwothree", 3, "one…"},
+		{"héllo wörld", 7, "héllo…"},
+	}
+	for _, test := range tests {
+		if got := truncateDoc(test.doc, test.max); got != test.want {
+			t.Errorf("truncateDoc(%q, %d): got %q, want %q", test.doc, test.max, got, test.want)
+		}
+	}
+}
+
+func TestExternalDeps(t *testing.T) {
+	refs := []*graph.Ref{
+		{UnitType: "t", Unit: "u", DefUnitType: "t", DefUnit: "u", DefPath: "A"},
+		{UnitType: "t", Unit: "u", DefRepo: "r", DefUnitType: "t", DefUnit: "u", DefPath: "A"},
+		{UnitType: "t", Unit: "u", DefRepo: "github.com/a/b", DefUnitType: "t", DefUnit: "b", DefPath: "X"},
+		{UnitType: "t", Unit: "u", DefRepo: "github.com/a/b", DefUnitType: "t", DefUnit: "b", DefPath: "X"},
+		{UnitType: "t", Unit: "u", DefRepo: "github.com/a/b", DefUnitType: "t", DefUnit: "b", DefPath: "Y"},
+		{UnitType: "t", Unit: "u", DefRepo: "github.com/c/d", DefUnitType: "t", DefUnit: "d", DefPath: "Z"},
+	}
+	resolutions := map[unit.ID2][]*dep.Resolution{
+		{Type: "t", Name: "u"}: {
+			{Raw: "c/d", Error: "not found"},
+			{Raw: "a/b", Target: &dep.ResolvedTarget{ToRepoCloneURL: "https://github.com/a/b.git", ToUnit: "b", ToUnitType: "t", ToVersionString: "v1.2.0", ToRevSpec: "abc"}},
+		},
+	}
+	want := []*apiDep{
+		{Repo: "github.com/a/b", UnitType: "t", Unit: "b", Resolved: true, Version: "v1.2.0", RevSpec: "abc", Refs: 3, Defs: 2},
+		{Repo: "github.com/c/d", UnitType: "t", Unit: "d", Refs: 1, Defs: 1},
+	}
+	if got := externalDeps("r", refs, resolutions); !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(want)
+		t.Errorf("got %s, want %s", gotJSON, wantJSON)
+	}
+}
+
+func TestExternalRefRepos(t *testing.T) {
+	refs := []*graph.Ref{
+		{UnitType: "t", Unit: "u", DefUnitType: "t", DefUnit: "u", DefPath: "A"},
+		{UnitType: "t", Unit: "u", DefRepo: "r", DefUnitType: "t", DefUnit: "u", DefPath: "A"},
+		{UnitType: "t", Unit: "u", DefRepo: "github.com/a/b", DefUnitType: "t", DefUnit: "b", DefPath: "X"},
+		{UnitType: "t", Unit: "v", DefRepo: "github.com/a/b", DefUnitType: "t", DefUnit: "b", DefPath: "X"},
+		{UnitType: "t", Unit: "u", DefRepo: "github.com/a/b", DefUnitType: "t", DefUnit: "c", DefPath: "X"},
+		{UnitType: "t", Unit: "u", DefRepo: "github.com/c/d", DefUnitType: "t", DefUnit: "d", DefPath: "Z"},
+	}
+	want := []*apiXrefRepo{
+		{Repo: "github.com/a/b", Refs: 3, Defs: 2, Units: 2},
+		{Repo: "github.com/c/d", Refs: 1, Defs: 1, Units: 1},
+	}
+	if got := externalRefRepos("r", refs); !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(want)
+		t.Errorf("got %s, want %s", gotJSON, wantJSON)
+	}
+}
@@ -0,0 +1,228 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"golang.org/x/tools/godoc/vfs"
+
+	"sourcegraph.com/sourcegraph/srclib/dep"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+type APIDepsCmd struct {
+	File     string `long:"file" description:"list the dependencies of this file" value-name:"FILE"`
+	UnitType string `long:"unit-type" description:"type of the source unit whose dependencies to list"`
+	Unit     string `long:"unit" description:"name of the source unit whose dependencies to list"`
+	CommitID string `long:"commit" description:"commit ID whose data to query (default: the current commit)"`
+	JSON     bool   `long:"json" description:"print the dependencies as JSON"`
+}
+
+var apiDepsCmd APIDepsCmd
+
+// An apiDep is an external dependency of a file or source unit, as
+// listed by "srclib api deps".
+type apiDep struct {
+	Repo     string
+	UnitType string `json:",omitempty"`
+	Unit     string `json:",omitempty"`
+
+	// Resolved is whether the dependency was found in the depresolve
+	// data of the source unit(s) that refer to it. If so, Version and
+	// RevSpec are the version and VCS revision that it resolved to (if
+	// known).
+	Resolved bool
+	Version  string `json:",omitempty"`
+	RevSpec  string `json:",omitempty"`
+
+	Refs int // number of refs to the dependency's defs
+	Defs int // number of distinct defs referred to
+}
+
+func (c *APIDepsCmd) Execute(args []string) error {
+	if (c.File == "") == (c.Unit == "") {
+		return fmt.Errorf("must specify either --file or --unit-type and --unit")
+	}
+	if (c.UnitType == "") != (c.Unit == "") {
+		return fmt.Errorf("must specify either both or neither of --unit-type and --unit")
+	}
+
+	repo, s, err := openAPIStore()
+	if err != nil {
+		return err
+	}
+	rs, ok := s.(store.RepoStore)
+	if !ok {
+		return fmt.Errorf("store (type %T) does not implement listing refs", s)
+	}
+	commitID := c.CommitID
+	if commitID == "" {
+		commitID = repo.CommitID
+	}
+
+	fs := []store.RefFilter{store.ByCommitIDs(commitID)}
+	if c.File != "" {
+		file, err := repoRelPath(repo.RootDir, c.File)
+		if err != nil {
+			return err
+		}
+		fs = append(fs, store.ByFiles(true, file))
+	} else {
+		fs = append(fs, store.ByUnits(unit.ID2{Type: c.UnitType, Name: c.Unit}))
+	}
+	refs, err := rs.Refs(fs...)
+	if err != nil {
+		return err
+	}
+
+	var repoURI string
+	if repo.CloneURL != "" {
+		repoURI = graph.MakeURI(repo.CloneURL)
+	}
+
+	// Read the depresolve data of the source units that the refs are
+	// in.
+	bdfs, err := GetBuildDataFS(commitID)
+	if err != nil {
+		return err
+	}
+	resolutions := map[unit.ID2][]*dep.Resolution{}
+	for _, ref := range refs {
+		u := unit.ID2{Type: ref.UnitType, Name: ref.Unit}
+		if _, present := resolutions[u]; present {
+			continue
+		}
+		res, err := readDepresolveData(bdfs, u)
+		if err != nil {
+			return err
+		}
+		resolutions[u] = res
+	}
+
+	deps := externalDeps(repoURI, refs, resolutions)
+
+	if c.JSON {
+		if deps == nil {
+			deps = []*apiDep{}
+		}
+		PrintJSON(deps, "  ")
+		return nil
+	}
+	for _, d := range deps {
+		target := d.Repo
+		if d.Unit != "" {
+			target += " " + d.Unit
+		}
+		switch {
+		case d.Version != "":
+			target += " (" + d.Version + ")"
+		case !d.Resolved:
+			target += " (unresolved)"
+		}
+		fmt.Printf("%6d refs %5d defs  %s\n", d.Refs, d.Defs, target)
+	}
+	return nil
+}
+
+// readDepresolveData reads the depresolve data of the source unit u in
+// the build data filesystem bdfs. If the unit has no depresolve data,
+// it returns nil and no error.
+func readDepresolveData(bdfs vfs.FileSystem, u unit.ID2) ([]*dep.Resolution, error) {
+	file := plan.SourceUnitDataFilename([]*dep.ResolvedDep{}, &unit.SourceUnit{Key: unit.Key{Type: u.Type, Name: u.Name}})
+	var res []*dep.Resolution
+	if err := readBuildDataJSON(bdfs, file, &res); err != nil {
+		if os.IsNotExist(err) || err == errEmptyJSONFile {
+			if GlobalOpt.Verbose {
+				log.Printf("No depresolve data for unit %s %s.", u.Type, u.Name)
+			}
+			return nil, nil
+		}
+		if isCorruptJSONFile(err) {
+			log.Printf("Warning: skipping depresolve data for unit %s %s: %s.", u.Type, u.Name, err)
+			return nil, nil
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// externalDeps groups the refs to defs outside of the repository
+// repoURI by the repository and source unit of the defs, and matches
+// each group with the depresolve resolutions of the refs' source
+// units. The deps are sorted by descending number of refs.
+func externalDeps(repoURI string, refs []*graph.Ref, resolutions map[unit.ID2][]*dep.Resolution) []*apiDep {
+	type depKey struct{ repo, unitType, unit string }
+	deps := map[depKey]*apiDep{}
+	defs := map[depKey]map[string]struct{}{}
+	for _, ref := range refs {
+		if ref.DefRepo == "" || graph.URIEqual(ref.DefRepo, repoURI) {
+			continue // internal ref
+		}
+		k := depKey{ref.DefRepo, ref.DefUnitType, ref.DefUnit}
+		d, present := deps[k]
+		if !present {
+			d = &apiDep{Repo: ref.DefRepo, UnitType: ref.DefUnitType, Unit: ref.DefUnit}
+			if t := matchResolution(ref, resolutions[unit.ID2{Type: ref.UnitType, Name: ref.Unit}]); t != nil {
+				d.Resolved = true
+				d.Version = t.ToVersionString
+				d.RevSpec = t.ToRevSpec
+			}
+			deps[k] = d
+			defs[k] = map[string]struct{}{}
+		}
+		d.Refs++
+		defs[k][ref.DefPath] = struct{}{}
+	}
+
+	var list []*apiDep
+	for k, d := range deps {
+		d.Defs = len(defs[k])
+		list = append(list, d)
+	}
+	sort.Sort(apiDepsByRefs(list))
+	return list
+}
+
+// matchResolution returns the target of the resolution (among res)
+// of the dependency that ref refers to: the one with the ref's def
+// repository and source unit, or, failing that, the first one with
+// the ref's def repository.
+func matchResolution(ref *graph.Ref, res []*dep.Resolution) *dep.ResolvedTarget {
+	var repoMatch *dep.ResolvedTarget
+	for _, r := range res {
+		t := r.Target
+		if t == nil || t.ToRepoCloneURL == "" {
+			continue
+		}
+		uri, err := graph.TryMakeURI(t.ToRepoCloneURL)
+		if err != nil || !graph.URIEqual(uri, ref.DefRepo) {
+			continue
+		}
+		if t.ToUnit == ref.DefUnit && (t.ToUnitType == "" || t.ToUnitType == ref.DefUnitType) {
+			return t
+		}
+		if repoMatch == nil {
+			repoMatch = t
+		}
+	}
+	return repoMatch
+}
+
+type apiDepsByRefs []*apiDep
+
+func (v apiDepsByRefs) Len() int      { return len(v) }
+func (v apiDepsByRefs) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v apiDepsByRefs) Less(i, j int) bool {
+	if v[i].Refs != v[j].Refs {
+		return v[i].Refs > v[j].Refs
+	}
+	if v[i].Repo != v[j].Repo {
+		return v[i].Repo < v[j].Repo
+	}
+	return v[i].Unit < v[j].Unit
+}
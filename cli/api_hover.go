@@ -0,0 +1,294 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/docurl"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+)
+
+type APIHoverCmd struct {
+	CommitID     string   `long:"commit" description:"commit ID whose data to query (default: the current commit)"`
+	MaxDocLength int      `long:"max-doc-length" description:"truncate each def's documentation to this many characters (0 means no limit)" default:"1000" value-name:"N"`
+	Link         string   `long:"link" description:"link to the def's URL made from the URL template with this name (default: the first applicable template)" value-name:"NAME"`
+	NoLink       bool     `long:"no-link" description:"don't link to the def's URL"`
+	Templates    []string `long:"template" description:"URL template that takes precedence over the Srcfile's and built-in ones (repeatable)" value-name:"NAME=URL"`
+	Markdown     bool     `long:"markdown" description:"print only the Markdown contents of each position (separated by blank lines) instead of JSON"`
+
+	Args struct {
+		Positions []string `name:"FILE:OFFSET" description:"positions to show hover content for (default: read a JSON array of positions from stdin)"`
+	} `positional-args:"yes"`
+}
+
+var apiHoverCmd APIHoverCmd
+
+// hoverOptions configures the formatting of hover content.
+type hoverOptions struct {
+	// MaxDocLength is the maximum number of characters of a def's
+	// documentation to include (0 means no limit).
+	MaxDocLength int
+
+	// Link is the name of the URL template to link to the def with,
+	// or empty to use the first applicable one. If NoLink is true,
+	// defs aren't linked.
+	Link   string
+	NoLink bool
+
+	// Templates are the URL templates (see docurl.URLs), and Repo is
+	// the URI of the repository, which is assumed to define the defs
+	// whose keys don't specify a repository.
+	Templates []*docurl.Template
+	Repo      string
+}
+
+// A hoverResult is the result of "srclib api hover" for a position.
+type hoverResult struct {
+	describePosition
+
+	// Contents is the hover content, in Markdown: the def's signature
+	// (in a code block), its documentation, and a link to its URL.
+	Contents string `json:",omitempty"`
+
+	// Start and End are the byte offsets of the span of the ref at the
+	// position (which editors may highlight).
+	Start, End uint32 `json:",omitempty"`
+
+	// URL is the URL that the content links to, if any.
+	URL string `json:",omitempty"`
+
+	Error string `json:",omitempty"`
+}
+
+func (c *APIHoverCmd) Execute(args []string) error {
+	var positions []describePosition
+	if len(c.Args.Positions) == 0 {
+		if err := json.NewDecoder(os.Stdin).Decode(&positions); err != nil {
+			return fmt.Errorf("reading positions from stdin: %s", err)
+		}
+	}
+	for _, arg := range c.Args.Positions {
+		p, err := parseDescribePosition(arg)
+		if err != nil {
+			return err
+		}
+		positions = append(positions, p)
+	}
+
+	repo, s, err := openAPIStore()
+	if err != nil {
+		return err
+	}
+	rs, ok := s.(store.RepoStore)
+	if !ok {
+		return fmt.Errorf("store (type %T) does not implement listing refs", s)
+	}
+	commitID := c.CommitID
+	if commitID == "" {
+		commitID = repo.CommitID
+	}
+
+	opt := &hoverOptions{MaxDocLength: c.MaxDocLength, Link: c.Link, NoLink: c.NoLink}
+	for _, t := range c.Templates {
+		i := strings.Index(t, "=")
+		if i <= 0 {
+			return fmt.Errorf("invalid --template %q (expected NAME=URL)", t)
+		}
+		opt.Templates = append(opt.Templates, &docurl.Template{Name: t[:i], URL: t[i+1:]})
+	}
+	if err := opt.addRepoTemplates(repo); err != nil {
+		return err
+	}
+
+	results, err := hoverPositions(newStoreDescribeSource(rs), repo.RootDir, commitID, positions, opt)
+	if err != nil {
+		return err
+	}
+	if !c.Markdown {
+		PrintJSON(results, "  ")
+		return nil
+	}
+	for i, res := range results {
+		if i > 0 {
+			fmt.Println()
+		}
+		if res.Error != "" {
+			fmt.Fprintln(os.Stderr, res.Error)
+			continue
+		}
+		fmt.Println(res.Contents)
+	}
+	return nil
+}
+
+// addRepoTemplates sets opt's repository to repo's, and adds the URL
+// templates in repo's Srcfile and the built-in templates to opt's.
+func (opt *hoverOptions) addRepoTemplates(repo *Repo) error {
+	if repo.CloneURL != "" {
+		opt.Repo = graph.MakeURI(repo.CloneURL)
+	}
+	cfg, err := config.ReadRepository(repo.RootDir)
+	if err != nil {
+		return err
+	}
+	opt.Templates = append(opt.Templates, cfg.DocURLs...)
+	opt.Templates = append(opt.Templates, docurl.Defaults...)
+	return nil
+}
+
+// hoverPositions returns the hover content for the def or ref at each
+// position (see describePositions).
+func hoverPositions(src describeSource, rootDir, commitID string, positions []describePosition, opt *hoverOptions) ([]*hoverResult, error) {
+	described, err := describePositions(src, rootDir, commitID, positions)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*hoverResult, len(described))
+	for i, d := range described {
+		res := &hoverResult{describePosition: d.describePosition, Error: d.Error}
+		results[i] = res
+		if d.Ref == nil {
+			continue
+		}
+		res.Start, res.End = d.Ref.Start, d.Ref.End
+
+		key := refDefKey(d.Ref)
+		if d.Def != nil {
+			key.CommitID = commitID
+		}
+		if key.Repo == "" {
+			key.Repo = opt.Repo
+		}
+		if !opt.NoLink {
+			res.URL = opt.url(key)
+		}
+		res.Contents = formatHover(d.Def, key, res.URL, opt.MaxDocLength)
+	}
+	return results, nil
+}
+
+// url returns the URL of the def with the given key made from the
+// URL template named opt.Link (or from the first applicable one, if
+// opt.Link is empty), or "" if there is none.
+func (opt *hoverOptions) url(key graph.DefKey) string {
+	for _, u := range docurl.URLs(opt.Templates, key) {
+		if opt.Link == "" || u.Name == opt.Link {
+			return u.URL
+		}
+	}
+	return ""
+}
+
+// formatHover returns the Markdown hover content for def (whose key,
+// with its repository filled in, is key), linking to url
+// (if non-empty). If def is nil (because it's not in the store, such
+// as a def in another repository), only its name is shown. Its
+// documentation is truncated to maxDocLength characters (if
+// maxDocLength > 0).
+func formatHover(def *graph.Def, key graph.DefKey, url string, maxDocLength int) string {
+	var b bytes.Buffer
+	if def == nil {
+		fmt.Fprintf(&b, "```\n%s\n```\n", path.Base(key.Path))
+		fmt.Fprintf(&b, "\nDefined in %s", key.Unit)
+		if key.Repo != "" {
+			fmt.Fprintf(&b, " (%s)", key.Repo)
+		}
+		b.WriteString("\n")
+	} else {
+		lang, sig := defSignature(def)
+		fmt.Fprintf(&b, "```%s\n%s\n```\n", lang, sig)
+		if doc := defDocMarkdown(def.Docs); doc != "" {
+			b.WriteString("\n")
+			b.WriteString(truncateDoc(doc, maxDocLength))
+			b.WriteString("\n")
+		}
+	}
+	if url != "" {
+		fmt.Fprintf(&b, "\n[View documentation](%s)\n", url)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// fenceLangs maps the names of languages (as used by "srclib
+// coverage") to the names that Markdown renderers recognize in the
+// info strings of code blocks, if they differ from the lowercase
+// language name.
+var fenceLangs = map[string]string{
+	"C++":         "cpp",
+	"C#":          "csharp",
+	"Objective-C": "objectivec",
+	"Shell":       "sh",
+}
+
+// defSignature returns def's signature and the name of its language
+// (for the code block's info string, or "" if unknown). Defs whose
+// unit type has a registered DefFormatter (see
+// graph.RegisterMakeDefFormatter) are formatted with it; others are
+// shown as their kind and name.
+func defSignature(def *graph.Def) (lang, sig string) {
+	if _, ok := graph.MakeDefFormatters[def.UnitType]; ok {
+		f := def.Fmt()
+		sig = strings.TrimSpace(f.DefKeyword() + " " + f.Name(graph.ScopeQualified) + f.NameAndTypeSeparator() + f.Type(graph.ScopeQualified))
+		lang = f.Language()
+	} else {
+		kind := def.RawKind
+		if kind == "" {
+			kind = def.Kind
+		}
+		sig = strings.TrimSpace(kind + " " + def.Name)
+		lang = extToLang[strings.ToLower(filepath.Ext(def.File))]
+	}
+	if l, ok := fenceLangs[lang]; ok {
+		return l, sig
+	}
+	return strings.ToLower(lang), sig
+}
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// defDocMarkdown returns the Markdown form of the first of docs in
+// the most suitable format: Markdown as is, then plain text, then
+// HTML (with its tags removed).
+func defDocMarkdown(docs []*graph.DefDoc) string {
+	for _, format := range []string{"text/x-markdown", "text/markdown", "text/plain", "text/html"} {
+		for _, doc := range docs {
+			if doc.Format != format {
+				continue
+			}
+			data := doc.Data
+			if format == "text/html" {
+				data = html.UnescapeString(htmlTagPattern.ReplaceAllString(data, ""))
+			}
+			return strings.TrimSpace(data)
+		}
+	}
+	if len(docs) > 0 {
+		return strings.TrimSpace(docs[0].Data)
+	}
+	return ""
+}
+
+// truncateDoc truncates doc to max characters (if max > 0), at a
+// word boundary if there is one, appending an ellipsis if it was
+// truncated.
+func truncateDoc(doc string, max int) string {
+	if max <= 0 || utf8.RuneCountInString(doc) <= max {
+		return doc
+	}
+	runes := []rune(doc)[:max]
+	s := string(runes)
+	if i := strings.LastIndexAny(s, " \n\t"); i > 0 {
+		s = s[:i]
+	}
+	return strings.TrimRight(s, " \n\t.,;:") + "…"
+}
@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+)
+
+const (
+	defaultInboundRefsLimit = 100
+	maxInboundRefsLimit     = 1000
+)
+
+// APIInboundRefsArgs are the arguments of the API.InboundRefs method.
+type APIInboundRefsArgs struct {
+	// Def is the def whose inbound refs to list. Its Repo, UnitType,
+	// Unit, and Path must be set; its CommitID is ignored (refs from
+	// all imported commits of other repositories are listed).
+	Def graph.DefKey
+
+	// Offset is the number of files to skip (the previous page's
+	// NextOffset), and Limit is the maximum number of files to return
+	// (default 100, at most 1000).
+	Offset int
+	Limit  int
+
+	// Tags and Metadata, if set, restrict the listed refs to those in
+	// source units that have all of the tags and metadata, such as the
+	// repository-level tags and metadata of the repositories they are
+	// in (see config.Repository's Tags and Metadata).
+	Tags     []string          `json:",omitempty"`
+	Metadata map[string]string `json:",omitempty"`
+}
+
+// APIInboundRefsReply is the result of the API.InboundRefs method.
+type APIInboundRefsReply struct {
+	// Files are the files in other repositories that refer to the def,
+	// sorted by repository, commit, and path.
+	Files []*inboundRefFile
+
+	TotalFiles int // number of files (on all pages)
+	TotalRepos int // number of repositories (on all pages)
+
+	// NextOffset is the Offset of the next page, or 0 if this is the
+	// last page.
+	NextOffset int `json:",omitempty"`
+}
+
+// An inboundRefFile is a file in another repository that refers to a
+// def, as listed by API.InboundRefs.
+type inboundRefFile struct {
+	Repo     string
+	CommitID string
+	File     string
+	Refs     int
+}
+
+// InboundRefs lists the files in other repositories (in the
+// cross-repo store, see APIServeCmd.XrefStore) that refer to a def,
+// one page at a time. Only repositories that the connection's client
+// may query are listed.
+func (s *APIService) InboundRefs(args *APIInboundRefsArgs, reply *APIInboundRefsReply) error {
+	if s.xrefs == nil {
+		return fmt.Errorf("API.InboundRefs requires a cross-repo store (serve with --xref-store)")
+	}
+	d := args.Def
+	if d.Repo == "" || d.UnitType == "" || d.Unit == "" || d.Path == "" {
+		return fmt.Errorf("the def's Repo, UnitType, Unit, and Path must be set")
+	}
+	limit := args.Limit
+	if limit <= 0 {
+		limit = defaultInboundRefsLimit
+	} else if limit > maxInboundRefsLimit {
+		return fmt.Errorf("Limit must be at most %d", maxInboundRefsLimit)
+	}
+	if args.Offset < 0 {
+		return fmt.Errorf("Offset must not be negative")
+	}
+
+	s.mu.Lock()
+	p := s.principal
+	s.mu.Unlock()
+	if err := s.auth.authorize(p, d.Repo); err != nil {
+		return err
+	}
+
+	inUnits, err := s.xrefUnits(args.Tags, args.Metadata)
+	if err != nil {
+		return err
+	}
+	refs, err := s.xrefs.Refs(store.ByRefDef(graph.RefDefKey{DefRepo: d.Repo, DefUnitType: d.UnitType, DefUnit: d.Unit, DefPath: d.Path}), store.AbsRefFilterFunc(func(r *graph.Ref) bool {
+		return !graph.URIEqual(r.Repo, d.Repo) && inUnits(r)
+	}))
+	if err != nil {
+		return err
+	}
+	files := inboundRefFiles(refs, func(repo string) bool {
+		return s.auth.authorize(p, repo) == nil
+	})
+
+	reply.TotalFiles = len(files)
+	repos := map[string]struct{}{}
+	for _, f := range files {
+		repos[f.Repo] = struct{}{}
+	}
+	reply.TotalRepos = len(repos)
+	if args.Offset < len(files) {
+		files = files[args.Offset:]
+		if len(files) > limit {
+			files = files[:limit]
+			reply.NextOffset = args.Offset + limit
+		}
+		reply.Files = files
+	}
+	if reply.Files == nil {
+		reply.Files = []*inboundRefFile{}
+	}
+	return nil
+}
+
+// xrefUnits returns a func that reports whether a ref in the
+// cross-repo store is in a source unit that has all of the tags and
+// metadata.
+func (s *APIService) xrefUnits(tags []string, metadata map[string]string) (func(*graph.Ref) bool, error) {
+	if len(tags) == 0 && len(metadata) == 0 {
+		return func(*graph.Ref) bool { return true }, nil
+	}
+	var fs []store.UnitFilter
+	if len(tags) > 0 {
+		fs = append(fs, store.ByUnitTags(tags...))
+	}
+	for k, v := range metadata {
+		fs = append(fs, store.ByUnitMetadata(k, v))
+	}
+	units, err := s.xrefs.Units(fs...)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[[4]string]struct{}, len(units))
+	for _, u := range units {
+		keys[[4]string{u.Repo, u.CommitID, u.Type, u.Name}] = struct{}{}
+	}
+	return func(r *graph.Ref) bool {
+		_, present := keys[[4]string{r.Repo, r.CommitID, r.UnitType, r.Unit}]
+		return present
+	}, nil
+}
+
+// inboundRefFiles groups refs by their repository, commit, and file,
+// omitting refs in repositories that allowRepo returns false for. The
+// files are sorted by repository, commit, and path.
+func inboundRefFiles(refs []*graph.Ref, allowRepo func(repo string) bool) []*inboundRefFile {
+	allowed := map[string]bool{}
+	files := map[[3]string]*inboundRefFile{}
+	var list []*inboundRefFile
+	for _, r := range refs {
+		ok, present := allowed[r.Repo]
+		if !present {
+			ok = allowRepo(r.Repo)
+			allowed[r.Repo] = ok
+		}
+		if !ok {
+			continue
+		}
+		k := [3]string{r.Repo, r.CommitID, r.File}
+		f := files[k]
+		if f == nil {
+			f = &inboundRefFile{Repo: r.Repo, CommitID: r.CommitID, File: r.File}
+			files[k] = f
+			list = append(list, f)
+		}
+		f.Refs++
+	}
+	sort.Sort(inboundRefFilesByPath(list))
+	return list
+}
+
+type inboundRefFilesByPath []*inboundRefFile
+
+func (v inboundRefFilesByPath) Len() int      { return len(v) }
+func (v inboundRefFilesByPath) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v inboundRefFilesByPath) Less(i, j int) bool {
+	if v[i].Repo != v[j].Repo {
+		return v[i].Repo < v[j].Repo
+	}
+	if v[i].CommitID != v[j].CommitID {
+		return v[i].CommitID < v[j].CommitID
+	}
+	return v[i].File < v[j].File
+}
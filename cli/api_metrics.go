@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"net/http"
+	"net/rpc"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// apiMetrics are the metrics of "srclib api serve" (see
+// APIServeCmd.MetricsListen).
+type apiMetrics struct {
+	reg         *prometheus.Registry
+	requests    *prometheus.CounterVec   // by method and status
+	durations   *prometheus.HistogramVec // by method
+	connections *prometheus.CounterVec   // by result ("accepted" or "rejected")
+}
+
+func newAPIMetrics(cache *apiCache) *apiMetrics {
+	m := &apiMetrics{
+		reg: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "srclib_api_requests_total",
+			Help: "JSON-RPC requests handled, by method and status (ok or error).",
+		}, []string{"method", "status"}),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "srclib_api_request_duration_seconds",
+			Help:    "Time taken to handle JSON-RPC requests, by method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method"}),
+		connections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "srclib_api_connections_total",
+			Help: "Client connections, by result (accepted or rejected, if the client failed to authenticate).",
+		}, []string{"result"}),
+	}
+	stat := func(f func(st APICacheStats) int) func() float64 {
+		return func() float64 { return float64(f(cache.stats())) }
+	}
+	m.reg.MustRegister(
+		m.requests,
+		m.durations,
+		m.connections,
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "srclib_api_cache_hits_total",
+			Help: "Queries of source units whose data was in the cache.",
+		}, stat(func(st APICacheStats) int { return st.Hits })),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "srclib_api_cache_misses_total",
+			Help: "Queries of source units whose data was read from the store.",
+		}, stat(func(st APICacheStats) int { return st.Misses })),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "srclib_api_cache_evictions_total",
+			Help: "Source units evicted from the cache.",
+		}, stat(func(st APICacheStats) int { return st.Evictions })),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "srclib_api_cache_units",
+			Help: "Source units whose data is in the cache.",
+		}, stat(func(st APICacheStats) int { return st.Units })),
+	)
+	return m
+}
+
+// serve serves the metrics over HTTP on addr, at /metrics.
+func (m *apiMetrics) serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.reg, promhttp.HandlerOpts{}))
+	return http.ListenAndServe(addr, mux)
+}
+
+// codec returns a codec that records the requests that c serves in m.
+// If m is nil, it returns c.
+func (m *apiMetrics) codec(c rpc.ServerCodec) rpc.ServerCodec {
+	if m == nil {
+		return c
+	}
+	return &metricsCodec{ServerCodec: c, m: m, started: map[uint64]time.Time{}}
+}
+
+// metricsCodec is a codec that records the number and durations of the
+// requests that it serves.
+type metricsCodec struct {
+	rpc.ServerCodec
+	m *apiMetrics
+
+	mu      sync.Mutex
+	started map[uint64]time.Time // keyed by request sequence number
+}
+
+func (c *metricsCodec) ReadRequestHeader(r *rpc.Request) error {
+	err := c.ServerCodec.ReadRequestHeader(r)
+	if err == nil {
+		c.mu.Lock()
+		c.started[r.Seq] = time.Now()
+		c.mu.Unlock()
+	}
+	return err
+}
+
+func (c *metricsCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	c.mu.Lock()
+	start, ok := c.started[r.Seq]
+	delete(c.started, r.Seq)
+	c.mu.Unlock()
+	if ok {
+		status := "ok"
+		if r.Error != "" {
+			status = "error"
+		}
+		// Don't record the names of methods that clients called
+		// but that don't exist (which net/rpc reports with errors
+		// beginning with "rpc: ") as labels.
+		method := r.ServiceMethod
+		if strings.HasPrefix(r.Error, "rpc: ") {
+			method = "unknown"
+		}
+		c.m.requests.WithLabelValues(method, status).Inc()
+		c.m.durations.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	}
+	return c.ServerCodec.WriteResponse(r, body)
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/rpc"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// nopServerCodec is a server codec whose requests are read by the
+// caller.
+type nopServerCodec struct{}
+
+func (nopServerCodec) ReadRequestHeader(*rpc.Request) error           { return nil }
+func (nopServerCodec) ReadRequestBody(interface{}) error              { return nil }
+func (nopServerCodec) WriteResponse(*rpc.Response, interface{}) error { return nil }
+func (nopServerCodec) Close() error                                   { return nil }
+
+func TestAPIMetrics(t *testing.T) {
+	m := newAPIMetrics(newAPICache(nil, 1))
+	c := m.codec(nopServerCodec{})
+	for seq, resp := range []*rpc.Response{
+		{ServiceMethod: "API.Describe"},
+		{ServiceMethod: "API.Describe", Error: "no such file"},
+		{ServiceMethod: "API.Bogus", Error: "rpc: can't find method API.Bogus"},
+	} {
+		if err := c.ReadRequestHeader(&rpc.Request{ServiceMethod: resp.ServiceMethod, Seq: uint64(seq)}); err != nil {
+			t.Fatal(err)
+		}
+		resp.Seq = uint64(seq)
+		if err := c.WriteResponse(resp, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.connections.WithLabelValues("accepted").Inc()
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	promhttp.HandlerFor(m.reg, promhttp.HandlerOpts{}).ServeHTTP(rec, req)
+	for _, want := range []string{
+		`srclib_api_requests_total{method="API.Describe",status="ok"} 1`,
+		`srclib_api_requests_total{method="API.Describe",status="error"} 1`,
+		`srclib_api_requests_total{method="unknown",status="error"} 1`,
+		`srclib_api_request_duration_seconds_count{method="API.Describe"} 2`,
+		`srclib_api_connections_total{result="accepted"} 1`,
+		`srclib_api_cache_units 0`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("metrics don't contain %q:\n%s", want, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,616 @@
+package cli
+
+import (
+	"container/list"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"sync"
+
+	"github.com/neelance/parallel"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+type APIServeCmd struct {
+	Listen     string `long:"listen" description:"accept JSON-RPC connections on this TCP address (default: serve a single connection on stdin and stdout)" value-name:"ADDR"`
+	CacheUnits int    `long:"cache-units" description:"maximum number of source units whose decoded data is kept in memory" default:"64" value-name:"N"`
+
+	ACL         string `long:"acl" description:"require clients to authenticate (with a token or a TLS client certificate) as one of the principals listed in this JSON file" value-name:"FILE"`
+	Authorizer  string `long:"authorizer" description:"name of the registered authorizer that decides whether principals may query the repository (default: acl, which checks the principals' Repos)" value-name:"NAME"`
+	TLSCert     string `long:"tls-cert" description:"serve over TLS with the PEM certificate in this file (requires --tls-key)" value-name:"FILE"`
+	TLSKey      string `long:"tls-key" description:"PEM private key of the --tls-cert certificate" value-name:"FILE"`
+	TLSClientCA string `long:"tls-client-ca" description:"require TLS client certificates signed by a CA in this PEM file; a certificate's subject common name names its principal" value-name:"FILE"`
+
+	MetricsListen string `long:"metrics-listen" description:"serve Prometheus metrics (requests, latencies, and cache use) over HTTP on this TCP address, at /metrics" value-name:"ADDR"`
+	TraceListen   string `long:"trace-listen" description:"trace each request and serve the recent and slowest requests' traces over HTTP on this TCP address, at /debug/requests (only to clients on the same host)" value-name:"ADDR"`
+	OTLPEndpoint  string `long:"otlp-endpoint" description:"export a span of each request with OpenTelemetry to the OTLP/HTTP traces endpoint at this URL (e.g., http://localhost:4318/v1/traces)" value-name:"URL"`
+
+	XrefStore string `long:"xref-store" description:"answer API.InboundRefs from the MultiRepoStore rooted at this directory" value-name:"DIR"`
+
+	StoreKeyFile string `long:"store-encryption-key-file" description:"decrypt the store with the hex-encoded 32-byte key in this file (overrides $SRCLIB_STORE_KEY_FILE)" value-name:"FILE"`
+}
+
+var apiServeCmd APIServeCmd
+
+func (c *APIServeCmd) Execute(args []string) error {
+	if c.CacheUnits <= 0 {
+		return fmt.Errorf("--cache-units must be > 0")
+	}
+	auth, tlsConfig, err := c.auth()
+	if err != nil {
+		return err
+	}
+	if c.Listen == "" && (auth != nil || tlsConfig != nil) {
+		return fmt.Errorf("--acl, --authorizer, and --tls-* require --listen")
+	}
+	if c.StoreKeyFile != "" {
+		storeKeyFile = c.StoreKeyFile
+	}
+	repo, s, err := openAPIStore()
+	if err != nil {
+		return err
+	}
+	rs, ok := s.(store.RepoStore)
+	if !ok {
+		return fmt.Errorf("store (type %T) does not implement listing refs", s)
+	}
+
+	hover := &hoverOptions{}
+	if err := hover.addRepoTemplates(repo); err != nil {
+		return err
+	}
+
+	svc := &APIService{repo: repo, cache: newAPICache(rs, c.CacheUnits), hover: hover, auth: auth}
+	if repo.CloneURL != "" {
+		svc.repoURI = graph.MakeURI(repo.CloneURL)
+	}
+	if svc.info, err = apiRepoInfo(repo, svc.repoURI); err != nil {
+		return err
+	}
+	if c.XrefStore != "" {
+		xs, err := (&StoreCmd{Type: "MultiRepoStore", Root: c.XrefStore}).store()
+		if err != nil {
+			return err
+		}
+		svc.xrefs = xs.(store.RepoStore)
+	}
+	if c.MetricsListen != "" {
+		svc.metrics = newAPIMetrics(svc.cache)
+		go func() {
+			log.Fatalf("Serving metrics on %s failed: %s", c.MetricsListen, svc.metrics.serve(c.MetricsListen))
+		}()
+	}
+	if c.TraceListen != "" {
+		svc.traces = true
+		go func() {
+			log.Fatalf("Serving traces on %s failed: %s", c.TraceListen, serveTraces(c.TraceListen))
+		}()
+	}
+	if c.OTLPEndpoint != "" {
+		tracer, shutdown, err := newAPITracer(c.OTLPEndpoint)
+		if err != nil {
+			return fmt.Errorf("--otlp-endpoint: %s", err)
+		}
+		defer func() {
+			if err := shutdown(); err != nil {
+				log.Printf("Exporting spans to %s failed: %s", c.OTLPEndpoint, err)
+			}
+		}()
+		svc.tracer = tracer
+	}
+
+	if c.Listen == "" {
+		srv := rpc.NewServer()
+		if err := srv.RegisterName("API", svc); err != nil {
+			return err
+		}
+		srv.ServeCodec(svc.codec(jsonrpc.NewServerCodec(stdioConn{os.Stdin, os.Stdout})))
+		return nil
+	}
+	l, err := net.Listen("tcp", c.Listen)
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+	}
+	log.Printf("Serving the API for %s on %s", repo.RootDir, l.Addr())
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go svc.serveConn(conn)
+	}
+}
+
+// auth returns the authentication and authorization of clients (nil
+// if clients needn't authenticate) and the TLS configuration (nil if
+// not serving over TLS) that c's options specify.
+func (c *APIServeCmd) auth() (*apiAuth, *tls.Config, error) {
+	var tlsConfig *tls.Config
+	if c.TLSCert != "" || c.TLSKey != "" {
+		if c.TLSCert == "" || c.TLSKey == "" {
+			return nil, nil, fmt.Errorf("--tls-cert and --tls-key must be given together")
+		}
+		var err error
+		if tlsConfig, err = apiTLSConfig(c.TLSCert, c.TLSKey, c.TLSClientCA); err != nil {
+			return nil, nil, err
+		}
+	} else if c.TLSClientCA != "" {
+		return nil, nil, fmt.Errorf("--tls-client-ca requires --tls-cert and --tls-key")
+	}
+
+	if c.ACL == "" && c.TLSClientCA == "" {
+		if c.Authorizer != "" {
+			return nil, nil, fmt.Errorf("--authorizer requires --acl or --tls-client-ca (to authenticate the principals to authorize)")
+		}
+		return nil, tlsConfig, nil
+	}
+	authorizer, err := lookupAPIAuthorizer(c.Authorizer)
+	if err != nil {
+		return nil, nil, err
+	}
+	auth := &apiAuth{authorizer: authorizer}
+	if c.ACL != "" {
+		if auth.principals, err = readAPIPrincipals(c.ACL); err != nil {
+			return nil, nil, err
+		}
+	}
+	return auth, tlsConfig, nil
+}
+
+// serveConn serves the API on conn, with a session of its own (so
+// that the principal that its client authenticates as applies only to
+// its requests).
+func (s *APIService) serveConn(conn net.Conn) {
+	var p *APIPrincipal
+	if tc, ok := conn.(*tls.Conn); ok && s.auth != nil {
+		var err error
+		if p, err = s.auth.connPrincipal(tc); err != nil {
+			log.Printf("Rejected API connection from %s: %s", conn.RemoteAddr(), err)
+			if s.metrics != nil {
+				s.metrics.connections.WithLabelValues("rejected").Inc()
+			}
+			conn.Close()
+			return
+		}
+	}
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("API", s.session(p)); err != nil {
+		log.Printf("Serving API connection from %s failed: %s", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	if s.metrics != nil {
+		s.metrics.connections.WithLabelValues("accepted").Inc()
+	}
+	srv.ServeCodec(s.codec(jsonrpc.NewServerCodec(conn)))
+}
+
+// codec returns a codec that serves requests with c, recording their
+// metrics and traces (if enabled).
+func (s *APIService) codec(c rpc.ServerCodec) rpc.ServerCodec {
+	return s.metrics.codec(traceCodec(c, s.traces, s.tracer))
+}
+
+// stdioConn is a connection over stdin and stdout.
+type stdioConn struct {
+	io.Reader
+	io.Writer
+}
+
+func (stdioConn) Close() error { return nil }
+
+// APIService implements the JSON-RPC methods of "srclib api serve".
+type APIService struct {
+	repo    *Repo
+	repoURI string // the repository's URI (if known), for authorization
+	cache   *apiCache
+	hover   *hoverOptions     // the repository's URL templates, for API.Hover
+	xrefs   store.RepoStore   // the cross-repo store (a MultiRepoStore), for API.InboundRefs; nil if none
+	info    *APIRepoInfoReply // the repository's URI, commit, tags, and metadata, for API.RepoInfo
+	auth    *apiAuth          // nil if clients needn't authenticate
+	metrics *apiMetrics       // nil if metrics aren't served
+	traces  bool              // whether requests are traced (see traceCodec)
+	tracer  oteltrace.Tracer  // nil if requests' spans aren't exported
+
+	mu        sync.Mutex
+	principal *APIPrincipal // the principal that the connection's client authenticated as
+}
+
+// session returns a service for one connection, whose client
+// authenticated as p (if p is not nil), that shares s's repository
+// and cache.
+func (s *APIService) session(p *APIPrincipal) *APIService {
+	return &APIService{repo: s.repo, repoURI: s.repoURI, cache: s.cache, hover: s.hover, xrefs: s.xrefs, info: s.info, auth: s.auth, metrics: s.metrics, traces: s.traces, tracer: s.tracer, principal: p}
+}
+
+// authorize returns nil if the connection's client may query the
+// repository.
+func (s *APIService) authorize() error {
+	s.mu.Lock()
+	p := s.principal
+	s.mu.Unlock()
+	return s.auth.authorize(p, s.repoURI)
+}
+
+// APIAuthenticateArgs are the arguments of the API.Authenticate
+// method.
+type APIAuthenticateArgs struct {
+	Token string
+}
+
+// APIAuthenticateReply is the result of the API.Authenticate method.
+type APIAuthenticateReply struct {
+	Name string // the name of the principal that the token authenticates
+}
+
+// Authenticate authenticates the connection's client as the principal
+// whose token is args.Token, for the connection's later requests.
+func (s *APIService) Authenticate(args *APIAuthenticateArgs, reply *APIAuthenticateReply) error {
+	if s.auth == nil {
+		return nil
+	}
+	p, err := s.auth.tokenPrincipal(args.Token)
+	if err != nil {
+		return err
+	}
+	if err := s.auth.authorize(p, s.repoURI); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.principal = p
+	s.mu.Unlock()
+	reply.Name = p.Name
+	return nil
+}
+
+// APIDescribeArgs are the arguments of the API.Describe method.
+type APIDescribeArgs struct {
+	Positions []describePosition
+	CommitID  string // default: the repository's commit when the server started
+
+	// CommitIDs, if set, are the commits (e.g., the base and head of a
+	// pull request) at which to query the positions, instead of
+	// CommitID. The commits are queried concurrently, and the results
+	// are returned in the reply's ByCommit.
+	CommitIDs []string `json:",omitempty"`
+}
+
+// APIDescribeReply is the result of the API.Describe method.
+type APIDescribeReply struct {
+	Results  []*describeResult
+	ByCommit map[string][]*describeResult `json:",omitempty"` // results for each of the args' CommitIDs
+}
+
+// Describe describes the def or ref at each position, as "srclib api
+// describe" does.
+func (s *APIService) Describe(args *APIDescribeArgs, reply *APIDescribeReply) error {
+	if err := s.authorize(); err != nil {
+		return err
+	}
+	if len(args.CommitIDs) > 0 {
+		reply.ByCommit = make(map[string][]*describeResult, len(args.CommitIDs))
+	}
+	var mu sync.Mutex
+	return s.eachCommit(args, func(commitID string) error {
+		results, err := describePositions(s.cache, s.repo.RootDir, commitID, args.Positions)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if reply.ByCommit != nil {
+			reply.ByCommit[commitID] = results
+		} else {
+			reply.Results = results
+		}
+		return nil
+	})
+}
+
+// eachCommit calls f with each of the commits that the request with
+// args queries: args.CommitIDs (concurrently), or else args.CommitID
+// (or the server's commit, if it's empty).
+func (s *APIService) eachCommit(args *APIDescribeArgs, f func(commitID string) error) error {
+	if len(args.CommitIDs) == 0 {
+		commitID := args.CommitID
+		if commitID == "" {
+			commitID = s.repo.CommitID
+		}
+		return f(commitID)
+	}
+	for _, commitID := range args.CommitIDs {
+		if commitID == "" {
+			return fmt.Errorf("empty commit ID in CommitIDs")
+		}
+	}
+	par := parallel.NewRun(len(args.CommitIDs))
+	for _, commitID_ := range args.CommitIDs {
+		commitID := commitID_
+		par.Acquire()
+		go func() {
+			defer par.Release()
+			if err := f(commitID); err != nil {
+				par.Error(err)
+			}
+		}()
+	}
+	return par.Wait()
+}
+
+// APIHoverArgs are the arguments of the API.Hover method.
+type APIHoverArgs struct {
+	APIDescribeArgs
+
+	MaxDocLength int    // 0 means no limit
+	Link         string // name of the URL template to link with (default: the first applicable one)
+	NoLink       bool
+}
+
+// APIHoverReply is the result of the API.Hover method.
+type APIHoverReply struct {
+	Results  []*hoverResult
+	ByCommit map[string][]*hoverResult `json:",omitempty"` // results for each of the args' CommitIDs
+}
+
+// Hover returns the hover content for the def or ref at each
+// position, as "srclib api hover" does.
+func (s *APIService) Hover(args *APIHoverArgs, reply *APIHoverReply) error {
+	if err := s.authorize(); err != nil {
+		return err
+	}
+	opt := *s.hover
+	opt.MaxDocLength, opt.Link, opt.NoLink = args.MaxDocLength, args.Link, args.NoLink
+	if len(args.CommitIDs) > 0 {
+		reply.ByCommit = make(map[string][]*hoverResult, len(args.CommitIDs))
+	}
+	var mu sync.Mutex
+	return s.eachCommit(&args.APIDescribeArgs, func(commitID string) error {
+		results, err := hoverPositions(s.cache, s.repo.RootDir, commitID, args.Positions, &opt)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if reply.ByCommit != nil {
+			reply.ByCommit[commitID] = results
+		} else {
+			reply.Results = results
+		}
+		return nil
+	})
+}
+
+// APICacheStats describes the use of the server's cache.
+type APICacheStats struct {
+	Units        int // number of source units in the cache
+	MaxUnits     int
+	Hits, Misses int
+	Evictions    int
+	Commits      int // number of commits whose lists of source units are cached
+}
+
+// CacheStats reports the use of the server's cache.
+func (s *APIService) CacheStats(args *struct{}, reply *APICacheStats) error {
+	if err := s.authorize(); err != nil {
+		return err
+	}
+	*reply = s.cache.stats()
+	return nil
+}
+
+// ClearCache empties the server's cache (e.g., after data for a cached
+// commit was reimported).
+func (s *APIService) ClearCache(args *struct{}, reply *struct{}) error {
+	if err := s.authorize(); err != nil {
+		return err
+	}
+	s.cache.clear()
+	return nil
+}
+
+// APIRepoInfoReply is the result of the API.RepoInfo method.
+type APIRepoInfoReply struct {
+	URI      string `json:",omitempty"` // the repository's URI (if known)
+	CommitID string // the commit that the server started at
+
+	// Tags and Metadata are the repository-level tags (e.g., topics)
+	// and metadata (e.g., team and service tier) in its Srcfile (see
+	// config.Repository's Tags and Metadata).
+	Tags     []string          `json:",omitempty"`
+	Metadata map[string]string `json:",omitempty"`
+}
+
+// apiRepoInfo returns the API.RepoInfo result for repo, whose URI is
+// uri, from its Srcfile.
+func apiRepoInfo(repo *Repo, uri string) (*APIRepoInfoReply, error) {
+	cfg, err := config.ReadRepository(repo.RootDir)
+	if err != nil {
+		return nil, err
+	}
+	return &APIRepoInfoReply{URI: uri, CommitID: repo.CommitID, Tags: cfg.Tags, Metadata: cfg.Metadata}, nil
+}
+
+// RepoInfo describes the served repository, including its
+// repository-level tags and metadata, so that clients serving many
+// repositories can tell them apart (e.g., by team).
+func (s *APIService) RepoInfo(args *struct{}, reply *APIRepoInfoReply) error {
+	if err := s.authorize(); err != nil {
+		return err
+	}
+	*reply = *s.info
+	return nil
+}
+
+// apiCache is a describeSource that keeps the decoded defs and refs of
+// the most recently used source units (keyed by commit and unit) in
+// memory, so that repeated queries of the same files (e.g., hovers in
+// an editor) don't need to read and decode them from the store again.
+// When it holds more than max units, the least recently used unit is
+// evicted.
+type apiCache struct {
+	rs  store.RepoStore
+	max int
+
+	mu      sync.Mutex
+	lru     *list.List // of *apiCacheEntry, most recently used first
+	entries map[apiCacheKey]*list.Element
+	units   map[string][]*unit.SourceUnit // keyed by commit ID
+
+	hits, misses, evictions int
+}
+
+type apiCacheKey struct {
+	CommitID string
+	Unit     unit.ID2
+}
+
+type apiCacheEntry struct {
+	key  apiCacheKey
+	refs map[string][]*graph.Ref // keyed by file
+	defs map[string]*graph.Def   // keyed by def path
+}
+
+func newAPICache(rs store.RepoStore, max int) *apiCache {
+	return &apiCache{
+		rs:      rs,
+		max:     max,
+		lru:     list.New(),
+		entries: map[apiCacheKey]*list.Element{},
+		units:   map[string][]*unit.SourceUnit{},
+	}
+}
+
+func (c *apiCache) fileRefs(commitID, file string) ([]*graph.Ref, error) {
+	units, err := c.commitUnits(commitID)
+	if err != nil {
+		return nil, err
+	}
+	var refs []*graph.Ref
+	for _, u := range units {
+		if !unitHasFile(u, file) {
+			continue
+		}
+		e, err := c.get(apiCacheKey{commitID, u.ID2()})
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, e.refs[file]...)
+	}
+	return refs, nil
+}
+
+func (c *apiCache) def(commitID string, k graph.DefKey) (*graph.Def, error) {
+	e, err := c.get(apiCacheKey{commitID, unit.ID2{Type: k.UnitType, Name: k.Unit}})
+	if err != nil {
+		return nil, err
+	}
+	return e.defs[k.Path], nil
+}
+
+func unitHasFile(u *unit.SourceUnit, file string) bool {
+	for _, f := range u.Files {
+		if f == file {
+			return true
+		}
+	}
+	return false
+}
+
+// commitUnits returns the source units at commitID.
+func (c *apiCache) commitUnits(commitID string) ([]*unit.SourceUnit, error) {
+	c.mu.Lock()
+	units, present := c.units[commitID]
+	c.mu.Unlock()
+	if present {
+		return units, nil
+	}
+	units, err := c.rs.Units(store.ByCommitIDs(commitID))
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.units[commitID] = units
+	c.mu.Unlock()
+	return units, nil
+}
+
+// get returns the cache entry for key, reading the unit's data from
+// the store if it's not cached.
+func (c *apiCache) get(key apiCacheKey) (*apiCacheEntry, error) {
+	c.mu.Lock()
+	if el, present := c.entries[key]; present {
+		c.lru.MoveToFront(el)
+		c.hits++
+		c.mu.Unlock()
+		return el.Value.(*apiCacheEntry), nil
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	// Read the unit's data without holding the lock, so that queries
+	// of cached units aren't blocked. (Concurrent misses of the same
+	// unit read it more than once, which is harmless.)
+	e := &apiCacheEntry{key: key, refs: map[string][]*graph.Ref{}, defs: map[string]*graph.Def{}}
+	refs, err := c.rs.Refs(store.ByCommitIDs(key.CommitID), store.ByUnits(key.Unit))
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range refs {
+		e.refs[r.File] = append(e.refs[r.File], r)
+	}
+	defs, err := c.rs.Defs(store.ByCommitIDs(key.CommitID), store.ByUnits(key.Unit))
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range defs {
+		e.defs[d.Path] = d
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, present := c.entries[key]; present {
+		return el.Value.(*apiCacheEntry), nil
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.max {
+		el := c.lru.Back()
+		c.lru.Remove(el)
+		delete(c.entries, el.Value.(*apiCacheEntry).key)
+		c.evictions++
+	}
+	return e, nil
+}
+
+func (c *apiCache) stats() APICacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return APICacheStats{
+		Units:     c.lru.Len(),
+		MaxUnits:  c.max,
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Commits:   len(c.units),
+	}
+}
+
+func (c *apiCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	c.entries = map[apiCacheKey]*list.Element{}
+	c.units = map[string][]*unit.SourceUnit{}
+}
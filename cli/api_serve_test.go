@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// countingRepoStore is a RepoStore that counts the calls to Refs.
+type countingRepoStore struct {
+	units []*unit.SourceUnit
+	defs  []*graph.Def
+	refs  []*graph.Ref
+
+	refsCalls int
+}
+
+func (s *countingRepoStore) Versions(...store.VersionFilter) ([]*store.Version, error) {
+	return nil, nil
+}
+
+func (s *countingRepoStore) Units(...store.UnitFilter) ([]*unit.SourceUnit, error) {
+	return s.units, nil
+}
+
+func (s *countingRepoStore) Defs(fs ...store.DefFilter) ([]*graph.Def, error) {
+	var defs []*graph.Def
+	for _, d := range s.defs {
+		if selectDef(d, fs) {
+			defs = append(defs, d)
+		}
+	}
+	return defs, nil
+}
+
+func (s *countingRepoStore) Refs(fs ...store.RefFilter) ([]*graph.Ref, error) {
+	s.refsCalls++
+	var refs []*graph.Ref
+	for _, r := range s.refs {
+		if selectRef(r, fs) {
+			refs = append(refs, r)
+		}
+	}
+	return refs, nil
+}
+
+func selectDef(d *graph.Def, fs []store.DefFilter) bool {
+	for _, f := range fs {
+		if !f.SelectDef(d) {
+			return false
+		}
+	}
+	return true
+}
+
+func selectRef(r *graph.Ref, fs []store.RefFilter) bool {
+	for _, f := range fs {
+		if !f.SelectRef(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAPICache(t *testing.T) {
+	rs := &countingRepoStore{
+		units: []*unit.SourceUnit{
+			{Key: unit.Key{Type: "t", Name: "u1"}, Info: unit.Info{Files: []string{"a.go"}}},
+			{Key: unit.Key{Type: "t", Name: "u2"}, Info: unit.Info{Files: []string{"b.go"}}},
+		},
+		defs: []*graph.Def{
+			{DefKey: graph.DefKey{CommitID: "c", UnitType: "t", Unit: "u1", Path: "F"}, Name: "F"},
+		},
+		refs: []*graph.Ref{
+			{CommitID: "c", UnitType: "t", Unit: "u1", DefUnitType: "t", DefUnit: "u1", DefPath: "F", File: "a.go", Start: 0, End: 1, Def: true},
+			{CommitID: "c", UnitType: "t", Unit: "u2", DefUnitType: "t", DefUnit: "u1", DefPath: "F", File: "b.go", Start: 5, End: 6},
+		},
+	}
+	c := newAPICache(rs, 1)
+
+	for i := 0; i < 2; i++ {
+		refs, err := c.fileRefs("c", "b.go")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(refs) != 1 || refs[0].Start != 5 {
+			t.Errorf("got refs %v, want the ref in b.go", refs)
+		}
+	}
+	if rs.refsCalls != 1 {
+		t.Errorf("got %d store queries, want 1 (the second should hit the cache)", rs.refsCalls)
+	}
+
+	// Looking up the def loads unit u1, which evicts u2.
+	def, err := c.def("c", graph.DefKey{UnitType: "t", Unit: "u1", Path: "F"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def == nil || def.Name != "F" {
+		t.Errorf("got def %v, want F", def)
+	}
+	if st := c.stats(); st.Units != 1 || st.Hits != 1 || st.Misses != 2 || st.Evictions != 1 {
+		t.Errorf("got stats %+v, want 1 unit, 1 hit, 2 misses, and 1 eviction", st)
+	}
+}
+
+func TestInboundRefFiles(t *testing.T) {
+	refs := []*graph.Ref{
+		{Repo: "b", CommitID: "c1", File: "f2"},
+		{Repo: "b", CommitID: "c1", File: "f1"},
+		{Repo: "b", CommitID: "c1", File: "f2"},
+		{Repo: "a", CommitID: "c2", File: "f"},
+		{Repo: "secret", CommitID: "c3", File: "f"},
+	}
+	files := inboundRefFiles(refs, func(repo string) bool { return repo != "secret" })
+	want := []*inboundRefFile{
+		{Repo: "a", CommitID: "c2", File: "f", Refs: 1},
+		{Repo: "b", CommitID: "c1", File: "f1", Refs: 1},
+		{Repo: "b", CommitID: "c1", File: "f2", Refs: 2},
+	}
+	if !reflect.DeepEqual(files, want) {
+		gotJSON, _ := json.Marshal(files)
+		wantJSON, _ := json.Marshal(want)
+		t.Errorf("got %s, want %s", gotJSON, wantJSON)
+	}
+}
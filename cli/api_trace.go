@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"context"
+	"net/http"
+	"net/rpc"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/trace"
+)
+
+// apiTraceFamily is the family of the traces of "srclib api serve"
+// requests (see APIServeCmd.TraceListen), under which they are listed
+// at /debug/requests.
+const apiTraceFamily = "srclib.API"
+
+// serveTraces serves the traces of requests (recorded by traceCodec)
+// and the event logs over HTTP on addr, at /debug/requests and
+// /debug/events. As is the trace package's default, only clients on
+// the same host may view them.
+func serveTraces(addr string) error {
+	mux := http.NewServeMux()
+	// The trace package registers its handlers on the default mux.
+	mux.Handle("/debug/requests", http.DefaultServeMux)
+	mux.Handle("/debug/events", http.DefaultServeMux)
+	return http.ListenAndServe(addr, mux)
+}
+
+// apiTracerName is the name of the OpenTelemetry tracer that creates
+// the spans of "srclib api serve" requests (see
+// APIServeCmd.OTLPEndpoint).
+const apiTracerName = "sourcegraph.com/sourcegraph/srclib/cli"
+
+// newAPITracer returns a tracer whose spans are exported with
+// OpenTelemetry to the OTLP/HTTP traces endpoint at url (e.g.,
+// http://localhost:4318/v1/traces), in batches. The returned func
+// exports the remaining spans and stops exporting.
+func newAPITracer(url string) (oteltrace.Tracer, func() error, error) {
+	exp, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(url))
+	if err != nil {
+		return nil, nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "srclib"))),
+	)
+	shutdown := func() error { return tp.Shutdown(context.Background()) }
+	return tp.Tracer(apiTracerName), shutdown, nil
+}
+
+// traceCodec returns a codec that records a trace of each request that
+// c serves, with the request's method as its title, if traces is
+// true, and a span of each request with tracer, if tracer is not nil.
+// If neither is enabled, it returns c.
+func traceCodec(c rpc.ServerCodec, traces bool, tracer oteltrace.Tracer) rpc.ServerCodec {
+	if !traces && tracer == nil {
+		return c
+	}
+	return &tracingCodec{ServerCodec: c, traces: traces, tracer: tracer, reqs: map[uint64]*tracedRequest{}}
+}
+
+// tracingCodec is a codec that records a trace and span of each
+// request that it serves.
+type tracingCodec struct {
+	rpc.ServerCodec
+	traces bool             // whether to record x/net/trace traces
+	tracer oteltrace.Tracer // nil if spans aren't recorded
+
+	mu   sync.Mutex
+	reqs map[uint64]*tracedRequest // keyed by request sequence number
+}
+
+// A tracedRequest is the trace and span of a request that is being
+// served.
+type tracedRequest struct {
+	tr   trace.Trace    // nil if traces aren't recorded
+	span oteltrace.Span // nil if spans aren't recorded
+}
+
+func (c *tracingCodec) ReadRequestHeader(r *rpc.Request) error {
+	err := c.ServerCodec.ReadRequestHeader(r)
+	if err == nil {
+		var req tracedRequest
+		if c.traces {
+			req.tr = trace.New(apiTraceFamily, r.ServiceMethod)
+		}
+		if c.tracer != nil {
+			_, req.span = c.tracer.Start(context.Background(), r.ServiceMethod, oteltrace.WithSpanKind(oteltrace.SpanKindServer))
+		}
+		c.mu.Lock()
+		c.reqs[r.Seq] = &req
+		c.mu.Unlock()
+	}
+	return err
+}
+
+func (c *tracingCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	c.mu.Lock()
+	req, ok := c.reqs[r.Seq]
+	delete(c.reqs, r.Seq)
+	c.mu.Unlock()
+	err := c.ServerCodec.WriteResponse(r, body)
+	if !ok {
+		return err
+	}
+	if tr := req.tr; tr != nil {
+		if r.Error != "" {
+			tr.LazyPrintf("error: %s", r.Error)
+			tr.SetError()
+		}
+		if err != nil {
+			tr.LazyPrintf("writing response: %s", err)
+			tr.SetError()
+		}
+		tr.Finish()
+	}
+	if span := req.span; span != nil {
+		if r.Error != "" {
+			span.SetStatus(codes.Error, r.Error)
+		} else if err != nil {
+			span.SetStatus(codes.Error, "writing response: "+err.Error())
+		}
+		span.End()
+	}
+	return err
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"net/rpc"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestAPISpans(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	c := traceCodec(nopServerCodec{}, false, tp.Tracer(apiTracerName))
+	for seq, resp := range []*rpc.Response{
+		{ServiceMethod: "API.Describe"},
+		{ServiceMethod: "API.Units", Error: "no such file"},
+	} {
+		if err := c.ReadRequestHeader(&rpc.Request{ServiceMethod: resp.ServiceMethod, Seq: uint64(seq)}); err != nil {
+			t.Fatal(err)
+		}
+		resp.Seq = uint64(seq)
+		if err := c.WriteResponse(resp, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	if s := spans[0]; s.Name() != "API.Describe" || s.Status().Code != codes.Unset {
+		t.Errorf("got span %q with status %v, want API.Describe with no error", s.Name(), s.Status())
+	}
+	if s := spans[1]; s.Name() != "API.Units" || s.Status().Code != codes.Error || s.Status().Description != "no such file" {
+		t.Errorf("got span %q with status %v, want API.Units with the request's error", s.Name(), s.Status())
+	}
+
+	// Without traces or a tracer, the codec is unchanged.
+	if c := traceCodec(nopServerCodec{}, false, nil); c != (nopServerCodec{}) {
+		t.Errorf("got codec %T, want the original codec", c)
+	}
+}
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+type APIXrefsOutCmd struct {
+	CommitID string `long:"commit" description:"commit ID whose build data to read (default: the current commit)"`
+	JSON     bool   `long:"json" description:"print the repositories as JSON"`
+}
+
+var apiXrefsOutCmd APIXrefsOutCmd
+
+// An apiXrefRepo is an external repository that the refs of a commit
+// refer to, as listed by "srclib api xrefs-out".
+type apiXrefRepo struct {
+	Repo string
+
+	Refs  int // number of refs to the repository's defs
+	Defs  int // number of distinct defs referred to
+	Units int // number of source units (in this repository) that refer to it
+}
+
+func (c *APIXrefsOutCmd) Execute(args []string) error {
+	repo, err := OpenRepo(".")
+	if err != nil {
+		return err
+	}
+	commitID := c.CommitID
+	if commitID == "" {
+		commitID = repo.CommitID
+	}
+	var repoURI string
+	if repo.CloneURL != "" {
+		repoURI = graph.MakeURI(repo.CloneURL)
+	}
+
+	var refs []*graph.Ref
+	err = readBuildDataGraphs(commitID, func(u *unit.SourceUnit, o *graph.Output) {
+		if o != nil {
+			refs = append(refs, o.Refs...)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	repos := externalRefRepos(repoURI, refs)
+
+	if c.JSON {
+		if repos == nil {
+			repos = []*apiXrefRepo{}
+		}
+		PrintJSON(repos, "  ")
+		return nil
+	}
+	for _, r := range repos {
+		fmt.Printf("%6d refs %5d defs %4d units  %s\n", r.Refs, r.Defs, r.Units, r.Repo)
+	}
+	return nil
+}
+
+// externalRefRepos groups the refs to defs outside of the repository
+// repoURI by the repository of the defs. The repositories are sorted
+// by descending number of refs.
+func externalRefRepos(repoURI string, refs []*graph.Ref) []*apiXrefRepo {
+	repos := map[string]*apiXrefRepo{}
+	defs := map[string]map[graph.DefKey]struct{}{}
+	units := map[string]map[unit.ID2]struct{}{}
+	for _, ref := range refs {
+		if ref.DefRepo == "" || graph.URIEqual(ref.DefRepo, repoURI) {
+			continue // internal ref
+		}
+		r, present := repos[ref.DefRepo]
+		if !present {
+			r = &apiXrefRepo{Repo: ref.DefRepo}
+			repos[ref.DefRepo] = r
+			defs[ref.DefRepo] = map[graph.DefKey]struct{}{}
+			units[ref.DefRepo] = map[unit.ID2]struct{}{}
+		}
+		r.Refs++
+		defs[ref.DefRepo][graph.DefKey{UnitType: ref.DefUnitType, Unit: ref.DefUnit, Path: ref.DefPath}] = struct{}{}
+		units[ref.DefRepo][unit.ID2{Type: ref.UnitType, Name: ref.Unit}] = struct{}{}
+	}
+
+	var list []*apiXrefRepo
+	for repo, r := range repos {
+		r.Defs = len(defs[repo])
+		r.Units = len(units[repo])
+		list = append(list, r)
+	}
+	sort.Sort(apiXrefReposByRefs(list))
+	return list
+}
+
+type apiXrefReposByRefs []*apiXrefRepo
+
+func (v apiXrefReposByRefs) Len() int      { return len(v) }
+func (v apiXrefReposByRefs) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v apiXrefReposByRefs) Less(i, j int) bool {
+	if v[i].Refs != v[j].Refs {
+		return v[i].Refs > v[j].Refs
+	}
+	return v[i].Repo < v[j].Repo
+}
@@ -0,0 +1,247 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alexsaveliev/go-colorable-wrapper"
+	"sourcegraph.com/sourcegraph/go-flags"
+	"sourcegraph.com/sourcegraph/rwvfs"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+)
+
+func init() {
+	cliInit = append(cliInit, func(cli *flags.Command) {
+		c, err := cli.AddCommand("buildstore",
+			"build data store commands",
+			"The buildstore subcommands operate on repository build data stores (directories, like a repository's .srclib-cache, that contain the build data for each commit).",
+			&buildstoreCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = c.AddCommand("sync",
+			"copy build data between stores",
+			`Copies the build data for the specified commits (or all commits) from one repository build data store to another. Each store is a local directory (or file:// URL), an S3 URL (s3://BUCKET/PREFIX, in the region in $AWS_REGION), or an HTTP(S) URL.
+
+Requests to remote stores (and to the Pushgateway that "srclib make --metrics-push" pushes to) are authenticated with credentials from the credential helpers listed in $SRCLIB_CREDENTIAL_HELPERS (comma-separated, asked in order until one has credentials for the URL; default: env,aws,gcp,netrc), so that credentials are configured once for all commands. The helpers are: env ($AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY, and $AWS_SESSION_TOKEN for S3; $SRCLIB_BUILDSTORE_TOKEN, a bearer token, or $SRCLIB_BUILDSTORE_USERNAME and $SRCLIB_BUILDSTORE_PASSWORD for HTTP), aws (the AWS shared credentials file's $AWS_PROFILE profile, or the ECS or EC2 instance role), gcp (an access token for *.googleapis.com from gcloud's application default credentials or the GCE metadata server), netrc ($NETRC or ~/.netrc, for HTTP basic authentication), and exec:PROGRAM (a custom helper, which is run with the URL as its argument and prints a JSON object with AccessKeyID, SecretAccessKey, and SessionToken, or Token, or Username and Password; or nothing if it has no credentials for the URL). Programs that link in srclib's buildstore package can register other helpers (see buildstore.RegisterCredentialHelper).
+
+Files that are already in the destination store with the same contents aren't copied again, so an interrupted sync can be resumed by running it again. Copied files are verified by their SHA-256 checksums. After all of a commit's files are copied, a manifest listing them and their checksums is written to the commit's directory in the destination store (as `+buildstore.SyncManifestName+`), so that consumers can tell when the commit's build data has been completely published. A store with manifests can be used as the source even if it can't list its files (e.g., an HTTP server).
+
+If an encryption key is configured (with --encryption-key-file or $SRCLIB_BUILDSTORE_KEY_FILE), build data written to remote (S3 and HTTP) stores is encrypted with AES-256-GCM before it leaves this machine, and build data read from them is decrypted, so that source snippets and docs in the build data aren't stored unencrypted in shared storage. Checksums are of the unencrypted data. Local stores are never encrypted.
+
+Operations on remote stores that fail (e.g., because of a transient network error, or a read that was cut short) are retried with exponential backoff (see --retries and --retry-backoff). An operation that fails on every attempt fails the sync with an error that names the operation and the file.`,
+			&buildstoreSyncCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = c.AddCommand("migrate",
+			"upgrade build data to the current schema",
+			`Upgrades the build data for the specified commits (or all commits) in a repository build data store (by default, the current repository's) to the current build data schema version, in place, so that build data written by an older version of srclib can be used without rebuilding it.
+
+The schema version of each build data file is recorded in its commit's `+buildstore.SchemaFilename+` file; files without a recorded version were written before versions were recorded. If a commit has a sync manifest (see "srclib buildstore sync"), its checksums are updated. Quarantined files are skipped.`,
+			&buildstoreMigrateCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = c.AddCommand("ls",
+			"list a commit's build data files",
+			`Lists the build data files for a commit (by default, the current repository's commit) in a repository build data store (by default, the current repository's; or a directory or URL, as in "srclib buildstore sync"), with their sizes and the rules and source units that produced them.
+
+The list is read from the commit's artifacts manifest (`+buildstore.ArtifactsManifestName+`), which "srclib make" writes after it succeeds. If there is none, the commit's files are listed without the rules that produced them.`,
+			&buildstoreLsCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	})
+}
+
+type BuildstoreCmd struct{}
+
+var buildstoreCmd BuildstoreCmd
+
+func (c *BuildstoreCmd) Execute(args []string) error { return nil }
+
+type BuildstoreSyncCmd struct {
+	Commits []string `long:"commit" description:"commit ID whose build data to copy; repeat to copy multiple commits (default: all commits in the source store)" value-name:"COMMIT"`
+
+	EncryptionKeyFile string `long:"encryption-key-file" description:"encrypt build data in remote (S3 and HTTP) stores with the hex-encoded 32-byte key in this file, and decrypt it when reading (overrides $SRCLIB_BUILDSTORE_KEY_FILE)" value-name:"FILE"`
+
+	Retries      int           `long:"retries" description:"number of times to attempt each operation on a remote store before failing (overrides $SRCLIB_BUILDSTORE_RETRIES; default: 5)" value-name:"N"`
+	RetryBackoff time.Duration `long:"retry-backoff" description:"how long to wait after the first failed attempt of an operation on a remote store, doubling after each further failure (overrides $SRCLIB_BUILDSTORE_RETRY_BACKOFF; default: 1s)" value-name:"DURATION"`
+
+	Args struct {
+		Src string `name:"SRC-URL" description:"source build data store (directory or URL)"`
+		Dst string `name:"DST-URL" description:"destination build data store (directory or URL)"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var buildstoreSyncCmd BuildstoreSyncCmd
+
+func (c *BuildstoreSyncCmd) Execute(args []string) error {
+	for _, storeURL := range []string{c.Args.Src, c.Args.Dst} {
+		if !buildstore.IsLocalURL(storeURL) {
+			if err := srclib.CheckOnline("syncing build data with " + storeURL); err != nil {
+				return err
+			}
+		}
+	}
+	if c.EncryptionKeyFile != "" {
+		buildstore.EncryptionKeyFile = c.EncryptionKeyFile
+	}
+	if c.Retries > 0 {
+		buildstore.RetryAttempts = c.Retries
+	}
+	if c.RetryBackoff > 0 {
+		buildstore.RetryBackoff = c.RetryBackoff
+	}
+	src, err := buildstore.OpenURL(c.Args.Src)
+	if err != nil {
+		return err
+	}
+	dst, err := buildstore.OpenURL(c.Args.Dst)
+	if err != nil {
+		return err
+	}
+
+	res, err := buildstore.Sync(src, dst, c.Commits)
+	if res != nil {
+		log.Printf("Synced %d commits: copied %d files (%d bytes), skipped %d files already in %s.", res.Commits, res.Copied, res.Bytes, res.Skipped, c.Args.Dst)
+	}
+	if err != nil {
+		return err
+	}
+	log.Println(colorable.Green("Done."))
+	return nil
+}
+
+type BuildstoreMigrateCmd struct {
+	Commits []string `long:"commit" description:"commit ID whose build data to upgrade; repeat to upgrade multiple commits (default: all commits in the store)" value-name:"COMMIT"`
+	DryRun  bool     `short:"n" long:"dry-run" description:"report what would be upgraded without changing anything"`
+
+	Args struct {
+		Dir string `name:"DIR" description:"repository build data store directory (default: the current repository's)"`
+	} `positional-args:"yes"`
+}
+
+var buildstoreMigrateCmd BuildstoreMigrateCmd
+
+func (c *BuildstoreMigrateCmd) Execute(args []string) error {
+	dir := c.Args.Dir
+	if dir == "" {
+		repo, err := OpenRepo(".")
+		if err != nil {
+			return err
+		}
+		dir = filepath.Join(repo.RootDir, buildstore.BuildDataDirName)
+	}
+	if fi, err := os.Stat(dir); err != nil {
+		return err
+	} else if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	res, err := buildstore.Migrate(rwvfs.Walkable(rwvfs.OS(dir)), c.Commits, c.DryRun)
+	if res != nil {
+		verb := "Upgraded"
+		if c.DryRun {
+			verb = "Would upgrade"
+		}
+		log.Printf("%s build data for %d commits to schema version %d: %d files migrated, %d files stamped, %d files already current.", verb, res.Commits, buildstore.SchemaVersion, res.Migrated, res.Stamped, res.Current)
+	}
+	if err != nil {
+		return err
+	}
+	log.Println(colorable.Green("Done."))
+	return nil
+}
+
+type BuildstoreLsCmd struct {
+	Store  string `long:"store" description:"repository build data store (directory or URL; default: the current repository's)" value-name:"URL"`
+	Format string `long:"format" description:"output format" default:"table" value-name:"table|json"`
+
+	Args struct {
+		CommitID string `name:"COMMIT" description:"commit ID whose build data to list (default: the current repository's commit)"`
+	} `positional-args:"yes"`
+}
+
+var buildstoreLsCmd BuildstoreLsCmd
+
+func (c *BuildstoreLsCmd) Execute(args []string) error {
+	if c.Format != "table" && c.Format != "json" {
+		return fmt.Errorf("unknown output format %q (expected table or json)", c.Format)
+	}
+
+	commitID, storeURL := c.Args.CommitID, c.Store
+	if commitID == "" || storeURL == "" {
+		repo, err := OpenRepo(".")
+		if err != nil {
+			return err
+		}
+		if commitID == "" {
+			commitID = repo.CommitID
+		}
+		if storeURL == "" {
+			storeURL = filepath.Join(repo.RootDir, buildstore.BuildDataDirName)
+		}
+	}
+	fs, err := buildstore.OpenURL(storeURL)
+	if err != nil {
+		return err
+	}
+	commitFS := buildstore.Repo(fs).Commit(commitID)
+
+	m, err := buildstore.ReadArtifactsManifest(commitFS)
+	if os.IsNotExist(err) {
+		artifacts, err := buildstore.ListArtifacts(commitFS, nil)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no build data for commit %s in %s", commitID, storeURL)
+		} else if err != nil {
+			return err
+		}
+		m = &buildstore.ArtifactsManifest{CommitID: commitID, Artifacts: artifacts}
+	} else if err != nil {
+		return err
+	}
+
+	if c.Format == "json" {
+		PrintJSON(m, "  ")
+		return nil
+	}
+	printArtifacts(os.Stdout, m.Artifacts)
+	return nil
+}
+
+// printArtifacts prints a table of build data files.
+func printArtifacts(w io.Writer, artifacts []*buildstore.Artifact) {
+	var total int64
+	for _, a := range artifacts {
+		var producer []string
+		if a.Unit != "" || a.UnitType != "" {
+			producer = append(producer, a.UnitType+" "+a.Unit)
+		}
+		if a.Duration > 0 {
+			producer = append(producer, (a.Duration - a.Duration%time.Millisecond).String())
+		}
+		desc := ""
+		if len(producer) > 0 {
+			desc = "  (" + strings.Join(producer, ", ") + ")"
+		}
+		fmt.Fprintf(w, "%10d  %s%s\n", a.Size, a.Path, desc)
+		total += a.Size
+	}
+	fmt.Fprintf(w, "%d files, %d bytes\n", len(artifacts), total)
+}
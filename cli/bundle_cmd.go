@@ -0,0 +1,206 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"sourcegraph.com/sourcegraph/go-flags"
+
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unitbundle"
+)
+
+func init() {
+	cliInit = append(cliInit, func(cli *flags.Command) {
+		_, err := cli.AddCommand("bundle",
+			"package a source unit's files for graphing elsewhere",
+			`Packages exactly the files that a source unit's grapher needs (the unit's files and the repository's Srcfile), along with the unit's definition and the grapher (and its version) that graphs it, into a gzipped tarball. The bundle can be graphed with "srclib run-bundle" on another machine, without the rest of the repository (e.g., to reproduce a toolchain bug from a bundle that a user submitted).
+
+UNIT is a source unit name (which must match a single unit) or a source unit ID (NAME@TYPE) in the cached config of the current repository (see "srclib config").`,
+			&bundleCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = cli.AddCommand("run-bundle",
+			"graph a source unit bundle",
+			`Extracts a source unit bundle (created by "srclib bundle") to a temporary directory, runs the bundle's grapher on its source unit there, and prints the normalized graph output (as "srclib make" stores it).
+
+The installed version of the grapher's toolchain is used; a warning is printed if it differs from the version that the bundle was created with.`,
+			&runBundleCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	})
+}
+
+type BundleCmd struct {
+	Output string `short:"o" long:"output" description:"write the bundle to FILE (default: UNIT.srclib-bundle.tar.gz)" value-name:"FILE"`
+
+	Args struct {
+		Unit string `name:"UNIT" description:"source unit name or ID (NAME@TYPE)"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var bundleCmd BundleCmd
+
+func (c *BundleCmd) Execute(args []string) error {
+	lrepo, err := OpenLocalRepo()
+	if err != nil {
+		return err
+	}
+	buildStore, err := buildstore.LocalRepo(lrepo.RootDir)
+	if err != nil {
+		return err
+	}
+	cfg, err := config.ReadCached(buildStore.Commit(lrepo.CommitID))
+	if err != nil {
+		return err
+	}
+	units, err := matchUnits(cfg.SourceUnits, c.Args.Unit)
+	if err != nil {
+		return err
+	}
+	if len(units) > 1 {
+		return fmt.Errorf("source unit name %q is ambiguous (it matches %d units); specify NAME@TYPE", c.Args.Unit, len(units))
+	}
+	u := units[0]
+
+	tool, err := toolchain.ChooseTool("graph", u.Type)
+	if err != nil {
+		return err
+	}
+	m := &unitbundle.Manifest{Unit: u, Tool: tool, CommitID: lrepo.CommitID, Created: time.Now()}
+	if tc, err := toolchain.Lookup(tool.Toolchain); err == nil {
+		m.ToolchainVersion, _ = tc.Version()
+	}
+	var extra []string
+	if _, err := os.Stat(filepath.Join(lrepo.RootDir, config.Filename)); err == nil {
+		extra = append(extra, config.Filename)
+	}
+	m.Files = unitbundle.UnitFiles(u, extra...)
+
+	output := c.Output
+	if output == "" {
+		output = strings.Replace(u.Name, "/", "_", -1) + ".srclib-bundle.tar.gz"
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if err := unitbundle.Write(f, lrepo.RootDir, m); err != nil {
+		f.Close()
+		os.Remove(output)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Printf("Bundled %d files of source unit %s %s in %s.", len(m.Files), u.Type, u.Name, output)
+	return nil
+}
+
+type RunBundleCmd struct {
+	Output string `short:"o" long:"output" description:"write the graph output to FILE (default: stdout)" value-name:"FILE"`
+
+	Args struct {
+		Bundle string `name:"BUNDLE" description:"source unit bundle file (created by 'srclib bundle')"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var runBundleCmd RunBundleCmd
+
+func (c *RunBundleCmd) Execute(args []string) error {
+	f, err := os.Open(c.Args.Bundle)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dir, err := ioutil.TempDir("", "srclib-bundle")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	m, err := unitbundle.Extract(f, dir)
+	if err != nil {
+		return fmt.Errorf("extracting %s: %s", c.Args.Bundle, err)
+	}
+
+	tc, err := toolchain.Lookup(m.Tool.Toolchain)
+	if err != nil {
+		return err
+	}
+	if v, err := tc.Version(); err == nil && m.ToolchainVersion != "" && v != m.ToolchainVersion {
+		log.Printf("Warning: the bundle was created with version %s of toolchain %s, but version %s is installed.", m.ToolchainVersion, m.Tool.Toolchain, v)
+	}
+
+	o, err := runBundleGrapher(filepath.Join(dir, unitbundle.FilesDir), m)
+	if err != nil {
+		return err
+	}
+	data, err := grapher.MarshalOutput(o)
+	if err != nil {
+		return err
+	}
+	if c.Output == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(c.Output, data, 0600)
+}
+
+// runBundleGrapher runs the grapher of a bundle whose manifest is m on
+// its source unit in the directory of its extracted files, and
+// returns the normalized graph output.
+func runBundleGrapher(filesDir string, m *unitbundle.Manifest) (*graph.Output, error) {
+	cmdName, err := toolchain.Command(m.Tool.Toolchain)
+	if err != nil {
+		return nil, err
+	}
+	unitData, err := json.Marshal(m.Unit)
+	if err != nil {
+		return nil, err
+	}
+	var stdout bytes.Buffer
+	cmd := exec.Command(cmdName, m.Tool.Subcmd)
+	cmd.Dir = filesDir
+	if cmd.Env, err = toolchain.ToolEnv(m.Tool.Toolchain, os.Environ(), m.Unit.Env); err != nil {
+		return nil, err
+	}
+	cmd.Stdin = bytes.NewReader(unitData)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if GlobalOpt.Verbose {
+		log.Printf("Running tool: %v in %s", cmd.Args, filesDir)
+	}
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("running %s %s: %s", m.Tool.Toolchain, m.Tool.Subcmd, err)
+	}
+
+	var o *graph.Output
+	if err := json.Unmarshal(stdout.Bytes(), &o); err != nil {
+		return nil, fmt.Errorf("decoding output of %s %s: %s", m.Tool.Toolchain, m.Tool.Subcmd, err)
+	}
+	offsets, err := grapher.ToolchainOffsets(m.Tool.Toolchain)
+	if err != nil {
+		return nil, err
+	}
+	if err := grapher.NormalizeDataOffsets(m.Unit.Type, ".", offsets, o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
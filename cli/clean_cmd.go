@@ -0,0 +1,193 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/alexsaveliev/go-colorable-wrapper"
+
+	"sourcegraph.com/sourcegraph/go-flags"
+
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/cvg"
+	"sourcegraph.com/sourcegraph/srclib/store"
+)
+
+func init() {
+	cliInit = append(cliInit, func(cli *flags.Command) {
+		_, err := cli.AddCommand("clean",
+			"remove generated build data and caches",
+			`Removes the files that srclib generated for the current repository and that it can regenerate: the build data of the current commit (in `+buildstore.BuildDataDirName+`), including its cached scan results (the source units and config key), tool logs, and quarantined files, but not its coverage record (see "srclib coverage --history"); and, for all other commits, their quarantined files (see "srclib buildstore migrate") and the checkpoints of interrupted makes and store imports.
+
+With --all, the whole build data directory (the build data of all commits, the def history, and coverage records) and the imported store (`+store.SrclibStoreDir+`) are removed.
+
+With --dry-run, the files that would be removed are listed (with their sizes) without removing them.`,
+			&cleanCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	})
+}
+
+type CleanCmd struct {
+	All    bool `long:"all" description:"remove the build data of all commits and the imported store"`
+	DryRun bool `short:"n" long:"dry-run" description:"list the files that would be removed without removing them"`
+}
+
+var cleanCmd CleanCmd
+
+// A cleanTarget is a file or directory that "srclib clean" removes.
+type cleanTarget struct {
+	Path string
+	What string   // a description of what it contains
+	Size int64    // total size of its files (except Keep)
+	Keep []string // names of files in the directory at Path to keep
+}
+
+func (c *CleanCmd) Execute(args []string) error {
+	repo, err := OpenRepo(".")
+	if err != nil {
+		return err
+	}
+	targets, err := cleanTargets(repo.RootDir, repo.CommitID, c.All)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, t := range targets {
+		rel, err := filepath.Rel(repo.RootDir, t.Path)
+		if err != nil {
+			rel = t.Path
+		}
+		if c.DryRun {
+			fmt.Printf("Would remove %s (%s, %d bytes)\n", rel, t.What, t.Size)
+		} else {
+			if err := t.remove(); err != nil {
+				return err
+			}
+			if GlobalOpt.Verbose {
+				log.Printf("Removed %s (%s, %d bytes).", rel, t.What, t.Size)
+			}
+		}
+		total += t.Size
+	}
+
+	switch {
+	case len(targets) == 0:
+		log.Println("Nothing to clean.")
+	case c.DryRun:
+		log.Printf("Would remove %d files and directories (%d bytes).", len(targets), total)
+	default:
+		log.Println(colorable.Green(fmt.Sprintf("Removed %d files and directories (%d bytes).", len(targets), total)))
+	}
+	return nil
+}
+
+// cleanTargets returns the existing files and directories, in the
+// repository whose root is rootDir, that "srclib clean" removes (see
+// its description) for the current commit commitID, or, if all is
+// true, for all commits.
+func cleanTargets(rootDir, commitID string, all bool) ([]*cleanTarget, error) {
+	var targets []*cleanTarget
+	add := func(path, what string, keep ...string) error {
+		size, err := diskUsage(path)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		for _, name := range keep {
+			kept, err := diskUsage(filepath.Join(path, name))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			size -= kept
+		}
+		targets = append(targets, &cleanTarget{Path: path, What: what, Size: size, Keep: keep})
+		return nil
+	}
+
+	dataDir := filepath.Join(rootDir, buildstore.BuildDataDirName)
+	if all {
+		if err := add(dataDir, "build data of all commits"); err != nil {
+			return nil, err
+		}
+		if err := add(filepath.Join(rootDir, store.SrclibStoreDir), "imported store"); err != nil {
+			return nil, err
+		}
+		return targets, nil
+	}
+
+	if commitID != "" {
+		// The coverage record is part of the coverage history (which
+		// only --all removes), not build data.
+		if err := add(filepath.Join(dataDir, commitID), "build data of the current commit", cvg.RecordFilename); err != nil {
+			return nil, err
+		}
+	}
+	fis, err := ioutil.ReadDir(dataDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, fi := range fis {
+		if !fi.IsDir() || fi.Name() == commitID {
+			continue
+		}
+		commitDir := filepath.Join(dataDir, fi.Name())
+		for _, f := range []struct{ name, what string }{
+			{buildstore.QuarantineDirName, "quarantined files"},
+			{makeCheckpointFile, "checkpoint of an interrupted make"},
+			{importCheckpointFile, "checkpoint of an interrupted store import"},
+		} {
+			if err := add(filepath.Join(commitDir, f.name), f.what); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return targets, nil
+}
+
+// remove removes t's file or directory or, if t.Keep is set, the
+// files in its directory other than those in t.Keep.
+func (t *cleanTarget) remove() error {
+	if len(t.Keep) == 0 {
+		return os.RemoveAll(t.Path)
+	}
+	fis, err := ioutil.ReadDir(t.Path)
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]bool, len(t.Keep))
+	for _, name := range t.Keep {
+		keep[name] = true
+	}
+	for _, fi := range fis {
+		if !keep[fi.Name()] {
+			if err := os.RemoveAll(filepath.Join(t.Path, fi.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// diskUsage returns the total size of the file at path or, if it is a
+// directory, of the files in it.
+func diskUsage(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size, err
+}
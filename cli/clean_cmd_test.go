@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/cvg"
+	"sourcegraph.com/sourcegraph/srclib/store"
+)
+
+func TestCleanTargets(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "srclib-clean")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootDir)
+	dataDir := filepath.Join(rootDir, buildstore.BuildDataDirName)
+	for file, data := range map[string]string{
+		"c1/a.graph.json":                           "abc",
+		"c1/" + cvg.RecordFilename:                  "cov",
+		"c1/" + buildstore.QuarantineDirName + "/x": "x",
+		"c2/b.graph.json":                           "b",
+		"c2/" + buildstore.QuarantineDirName + "/y": "yy",
+		"c2/" + makeCheckpointFile:                  "{}",
+		"c3/c.graph.json":                           "c",
+		"def-history.json":                          "{}",
+		"../" + store.SrclibStoreDir + "/r/def.dat": "d",
+	} {
+		file = filepath.Join(dataDir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	targets, err := cleanTargets(rootDir, "c1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*cleanTarget{
+		{Path: filepath.Join(dataDir, "c1"), What: "build data of the current commit", Size: 4, Keep: []string{cvg.RecordFilename}},
+		{Path: filepath.Join(dataDir, "c2", buildstore.QuarantineDirName), What: "quarantined files", Size: 2},
+		{Path: filepath.Join(dataDir, "c2", makeCheckpointFile), What: "checkpoint of an interrupted make", Size: 2},
+	}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("got targets %+v, want %+v", targets, want)
+	}
+	if err := targets[0].remove(); err != nil {
+		t.Fatal(err)
+	}
+	if fis, err := ioutil.ReadDir(filepath.Join(dataDir, "c1")); err != nil || len(fis) != 1 || fis[0].Name() != cvg.RecordFilename {
+		t.Errorf("got %v, %v after removing the current commit's build data, want only the coverage record", fis, err)
+	}
+
+	targets, err = cleanTargets(rootDir, "c1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []*cleanTarget{
+		{Path: dataDir, What: "build data of all commits", Size: 11},
+		{Path: filepath.Join(rootDir, store.SrclibStoreDir), What: "imported store", Size: 1},
+	}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("got targets with --all %+v, want %+v", targets, want)
+	}
+}
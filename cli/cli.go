@@ -26,6 +26,19 @@ func AddCommands(c *flags.Command) {
 // GlobalOpt contains global options.
 var GlobalOpt struct {
 	Verbose bool `short:"v" description:"show verbose output"`
+
+	CloneURL string   `long:"clone-url" description:"use this clone URL for the current repo instead of detecting it from VCS remotes (overrides $SRCLIB_CLONE_URL and the Srcfile)" value-name:"URL"`
+	Remotes  []string `long:"remote" description:"name of the VCS remote whose URL is the current repo's clone URL; repeat to list remotes in order of preference (overrides $SRCLIB_REMOTES and the Srcfile)" value-name:"NAME"`
+
+	// Offline forbids network access (see network.go).
+	Offline func() `long:"offline" description:"forbid network access (e.g., toolchain installs and corpus fetches), failing operations that need it, and tell the programs srclib runs not to fetch anything (same as $SRCLIB_OFFLINE=1)"`
+
+	// Profiling options (see pprof.go). These profile the srclib
+	// process itself, not the toolchains or other srclib processes
+	// that it runs.
+	CPUProfile func(string) `long:"cpuprofile" description:"write a CPU profile of the command to FILE" value-name:"FILE"`
+	MemProfile func(string) `long:"memprofile" description:"write a heap profile to FILE after the command runs" value-name:"FILE"`
+	Trace      func(string) `long:"trace" description:"write an execution trace of the command to FILE" value-name:"FILE"`
 }
 
 func Main() error {
@@ -33,12 +46,25 @@ func Main() error {
 	log.SetPrefix("")
 	log.SetOutput(colorable.Stderr)
 
+	// Route the network fetches of the programs that srclib runs
+	// through $SRCLIB_PROXY, or forbid them if $SRCLIB_OFFLINE is set.
+	if err := srclib.ApplyNetworkEnv(); err != nil {
+		return err
+	}
+
+	// Let the current project's toolchains (if any) take precedence
+	// over the global ones.
+	if _, err := srclib.UseProjectToolchains("."); err != nil {
+		return err
+	}
+
 	cli := flags.NewNamedParser(srclib.CommandName, flags.Default ^ flags.PrintErrors)
 	cli.LongDescription = "srclib builds projects, analyzes source code, and queries Sourcegraph."
 	cli.AddGroup("Global options", "", &GlobalOpt)
 	AddCommands(cli.Command)
 
 	_, err := cli.Parse()
+	stopProfiling()
 	if err != nil {
 		colorable.Println(err)
 	}
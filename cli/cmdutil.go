@@ -1,9 +1,14 @@
 package cli
 
 import (
+	"errors"
 	"log"
+	"os"
+	"path/filepath"
 
 	"sourcegraph.com/sourcegraph/go-flags"
+
+	"sourcegraph.com/sourcegraph/srclib/store"
 )
 
 func SetOptionDefaultValue(g *flags.Group, longName string, defaultVal ...string) {
@@ -15,3 +20,79 @@ func SetOptionDefaultValue(g *flags.Group, longName string, defaultVal ...string
 	}
 	log.Fatalf("Failed to set default value %v for option %q (not found).", defaultVal, longName)
 }
+
+// setLocalStoreRootDefault sets the default value of g's --root
+// option (see StoreCmd) to the store directory of the repository
+// containing the current directory, if any.
+func setLocalStoreRootDefault(g *flags.Group) {
+	lrepo, _ := OpenLocalRepo()
+	if lrepo != nil && lrepo.RootDir != "" {
+		absDir, err := os.Getwd()
+		if err != nil {
+			log.Fatal(err)
+		}
+		relDir, err := filepath.Rel(absDir, lrepo.RootDir)
+		if err == nil {
+			SetOptionDefaultValue(g, "root", filepath.Join(relDir, store.SrclibStoreDir))
+		}
+	}
+}
+
+// TestCodeOpt is embedded in commands that can exclude test code from
+// their results, or restrict their results to test code (see
+// graph.IsTestFile and config.Tree's TestFiles).
+type TestCodeOpt struct {
+	ExcludeTests bool `long:"exclude-tests" description:"exclude test code"`
+	OnlyTests    bool `long:"only-tests" description:"only include test code"`
+}
+
+// check returns an error if o's options conflict.
+func (o *TestCodeOpt) check() error {
+	if o.ExcludeTests && o.OnlyTests {
+		return errors.New("must specify at most one of --exclude-tests and --only-tests")
+	}
+	return nil
+}
+
+// testCodeFilter returns the filter that selects the defs, refs, and
+// units that o includes, or nil if o includes all of them.
+func (o *TestCodeOpt) testCodeFilter() interface {
+	store.DefFilter
+	store.RefFilter
+	store.UnitFilter
+} {
+	if err := o.check(); err != nil {
+		log.Fatal(err)
+	}
+	switch {
+	case o.ExcludeTests:
+		return store.ByTestCode(false)
+	case o.OnlyTests:
+		return store.ByTestCode(true)
+	}
+	return nil
+}
+
+// includesFile reports whether o includes the file, given whether it's
+// a test file.
+func (o *TestCodeOpt) includesFile(test bool) bool {
+	return !(o.ExcludeTests && test) && !(o.OnlyTests && !test)
+}
+
+// OnlyUnitsOpt is embedded in commands that can restrict the build to
+// some of the source units (e.g., to iterate on one toolchain without
+// waiting for the others).
+type OnlyUnitsOpt struct {
+	OnlyUnits []string `long:"only-units" description:"only build source units with this name; may be repeated" value-name:"NAME"`
+	OnlyTypes []string `long:"only-types" description:"only build source units of this type (e.g., GoPackage); may be repeated" value-name:"TYPE"`
+	OnlyLangs []string `long:"only-langs" description:"only build source units containing files in this language (e.g., Go); may be repeated" value-name:"LANG"`
+}
+
+// selector returns the selector of the units that o restricts the
+// build to, or nil if o doesn't restrict it.
+func (o *OnlyUnitsOpt) selector() *unitSelector {
+	if o == nil || (len(o.OnlyUnits) == 0 && len(o.OnlyTypes) == 0 && len(o.OnlyLangs) == 0) {
+		return nil
+	}
+	return &unitSelector{Names: o.OnlyUnits, Types: o.OnlyTypes, Langs: o.OnlyLangs}
+}
@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/util"
+)
+
+// walkCodeFiles calls fn with the path (relative to rootDir), the
+// language, and the contents of each code file in the tree rooted at
+// rootDir. Files are recognized by their extension (see langToExts)
+// or, for executable files without an extension, by their shebang
+// line. Hidden directories, special files (see shouldIgnoreFile), and
+// files that source units skip because they are too large or binary
+// (see (*config.Tree).SkipFiles) are skipped.
+func walkCodeFiles(rootDir string, repoConfig *config.Repository, fn func(path, lang string, data []byte) error) error {
+	return util.Walk(rootDir, repoConfig.SymlinkPolicy(), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if util.IsSymlinkError(err) {
+				return err
+			}
+			return nil // skip unreadable files and dirs
+		}
+		fullPath := path
+		if filepath.IsAbs(path) {
+			var err error
+			path, err = filepath.Rel(rootDir, path)
+			if err != nil {
+				return err
+			}
+		}
+
+		if info.IsDir() {
+			if strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir // don't search hidden directories
+			}
+			return nil
+		}
+
+		// Use the file's name exactly as the file system reports it
+		// (without escaping or Unicode normalization), as toolchains
+		// are required to, so that it matches the files in the graph
+		// data.
+		path = graph.CleanFile(filepath.ToSlash(path))
+
+		ext := strings.ToLower(filepath.Ext(path))
+		lang, isCodeFile := extToLang[ext]
+		if !isCodeFile && ext == "" && info.Mode()&0111 != 0 {
+			// Count executable scripts without an extension (such
+			// as bin/ and script/ files) under the language named by
+			// their shebang line.
+			lang, isCodeFile = scriptLang(fullPath)
+		}
+		if !isCodeFile {
+			return nil
+		}
+
+		// omitting special files (auto-generated, temporary, ...)
+		if shouldIgnoreFile(path, lang) {
+			return nil
+		}
+
+		// Skip files that were removed from their source units
+		// because they were too large or binary (see
+		// (*config.Tree).SkipFiles), instead of reading them.
+		if reason, _, err := repoConfig.CheckFile(filepath.Dir(fullPath), info.Name()); err != nil {
+			return err
+		} else if reason != "" {
+			return nil
+		}
+
+		b, err := ioutil.ReadFile(fullPath)
+		if err != nil {
+			return err
+		}
+		return fn(path, lang, b)
+	})
+}
+
+// hashCommentLangs are the languages whose line comments start with
+// "#", which numLines (which uses Go's tokenizer) doesn't recognize as
+// comments.
+var hashCommentLangs = map[string]bool{
+	"Python": true,
+	"Ruby":   true,
+	"Shell":  true,
+}
+
+// countLoC counts the lines of code in data, the contents of a file
+// in the given language: the lines that aren't blank and aren't
+// comments.
+func countLoC(lang string, data []byte) int {
+	if hashCommentLangs[lang] {
+		return numHashCommentedLines(data, lang == "Ruby")
+	}
+	return numLines(data)
+}
+
+// numHashCommentedLines counts the lines of data that aren't blank
+// and don't start with "#" (comments and shebang lines). If
+// rubyBlocks is true, lines from "=begin" to "=end" (Ruby's block
+// comments) aren't counted either.
+func numHashCommentedLines(data []byte, rubyBlocks bool) int {
+	var n int
+	inBlock := false
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if rubyBlocks {
+			if inBlock {
+				inBlock = !bytes.HasPrefix(line, []byte("=end"))
+				continue
+			}
+			if bytes.HasPrefix(line, []byte("=begin")) {
+				inBlock = true
+				continue
+			}
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 && line[0] != '#' {
+			n++
+		}
+	}
+	return n
+}
@@ -4,17 +4,24 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"sort"
 
+	"github.com/alexsaveliev/go-colorable-wrapper"
+
 	"sourcegraph.com/sourcegraph/go-flags"
 
 	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib"
 	"sourcegraph.com/sourcegraph/srclib/buildstore"
 	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/cvg"
 	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/scan"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
 
 	"sourcegraph.com/sourcegraph/srclib/unit"
 )
@@ -39,13 +46,37 @@ The steps are:
 			log.Fatal(err)
 		}
 		c.Aliases = []string{"c"}
+		c.SubcommandsOptional = true
+
+		_, err = c.AddCommand("lint",
+			"check the Srcfile for errors",
+			`Checks the Srcfile in the root directory of the repository containing DIR (or the current directory if not specified) for syntax errors, unknown keys, toolchains that aren't installed, malformed globs, and conflicting source unit definitions.
+
+Each problem is reported with its line and column in the Srcfile. The command exits with an error if any problems are found.`,
+			&configLintCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = c.AddCommand("convert",
+			"convert the Srcfile between JSON and YAML",
+			`Converts the Srcfile in the root directory of the repository containing DIR (or the current directory if not specified) from JSON to YAML (Srcfile.yaml) or vice versa, and prints the result. With --write, the Srcfile is replaced by the converted file.
+
+Comments are not preserved.`,
+			&configConvertCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
 	})
 }
 
 // getInitialConfig gets the initial config (i.e., the config that comes solely
 // from the Srcfile, if any, and the external user config, before running the
-// scanners).
-func getInitialConfig(dir string) (*config.Repository, error) {
+// scanners). If profile is non-empty, the Srcfile profile with that name is
+// applied.
+func getInitialConfig(dir, profile string) (*config.Repository, error) {
 	r, err := OpenRepo(dir)
 	if err != nil {
 		return nil, err
@@ -55,6 +86,14 @@ func getInitialConfig(dir string) (*config.Repository, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to read repository at %s: %s", r.RootDir, err)
 	}
+	if err := applyNetworkConfig(cfg); err != nil {
+		return nil, err
+	}
+	if profile != "" {
+		if err := cfg.ApplyProfile(profile); err != nil {
+			return nil, err
+		}
+	}
 
 	if cfg.Scanners == nil {
 		x, err := config.SrclibPathConfig()
@@ -62,6 +101,9 @@ func getInitialConfig(dir string) (*config.Repository, error) {
 			return nil, err
 		}
 		cfg.Scanners = x.Scanners
+		for _, name := range scan.DefaultBuiltins {
+			cfg.Scanners = append(cfg.Scanners, &srclib.ToolRef{Toolchain: scan.BuiltinToolchain, Subcmd: name})
+		}
 	}
 
 	return cfg, nil
@@ -76,7 +118,8 @@ type ConfigCmd struct {
 		Dir Directory `name:"DIR" default:"." description:"root directory of tree to configure"`
 	} `positional-args:"yes"`
 
-	Quiet bool `short:"q" long:"quiet" description:"silence all output"`
+	Quiet   bool   `short:"q" long:"quiet" description:"silence all output"`
+	Profile string `long:"profile" description:"apply the named profile from the Srcfile (default: $SRCLIB_PROFILE)" value-name:"NAME"`
 
 	w io.Writer // output stream to print to (defaults to os.Stdout)
 }
@@ -91,12 +134,13 @@ func (c *ConfigCmd) Execute(args []string) error {
 		c.w = nopWriteCloser{}
 	}
 
-	cfg, err := getInitialConfig(c.Args.Dir.String())
+	cfg, err := getInitialConfig(c.Args.Dir.String(), profileName(c.Profile))
 	if err != nil {
 		return err
 	}
 
-	if err := scanUnitsIntoConfig(cfg, c.Quiet); err != nil {
+	skipped, err := scanUnitsIntoConfig(cfg, c.Quiet)
+	if err != nil {
 		return fmt.Errorf("failed to scan for source units: %s", err)
 	}
 
@@ -110,12 +154,18 @@ func (c *ConfigCmd) Execute(args []string) error {
 	}
 	commitFS := buildStore.Commit(localRepo.CommitID)
 
-	// Write source units to build cache.
+	// Write source units to build cache, replacing any that were
+	// previously cached.
 	if err := rwvfs.MkdirAll(commitFS, "."); err != nil {
 		return err
 	}
+	if err := config.RemoveCached(commitFS); err != nil {
+		return err
+	}
+	var unitFiles []string
 	for _, u := range cfg.SourceUnits {
 		unitFile := plan.SourceUnitDataFilename(unit.SourceUnit{}, u)
+		unitFiles = append(unitFiles, filepath.ToSlash(unitFile))
 		if err := rwvfs.MkdirAll(commitFS, filepath.Dir(unitFile)); err != nil {
 			return err
 		}
@@ -132,6 +182,22 @@ func (c *ConfigCmd) Execute(args []string) error {
 			return err
 		}
 	}
+	if err := buildstore.StampSchema(commitFS, unitFiles); err != nil {
+		return err
+	}
+	if err := config.WriteSkippedFiles(commitFS, skipped); err != nil {
+		return err
+	}
+
+	// Record the inputs of the cached config so that it is recreated
+	// when they change (see ensureCachedConfig).
+	cacheKey, err := configCacheKey(localRepo.RootDir, profileName(c.Profile))
+	if err != nil {
+		return err
+	}
+	if err := config.WriteCacheKey(commitFS, cacheKey); err != nil {
+		return err
+	}
 
 	if c.Output.Output == "json" {
 		PrintJSON(cfg, "")
@@ -157,6 +223,172 @@ func (c *ConfigCmd) Execute(args []string) error {
 	return nil
 }
 
+type ConfigLintCmd struct {
+	Args struct {
+		Dir Directory `name:"DIR" default:"." description:"directory in the repository whose Srcfile to check"`
+	} `positional-args:"yes"`
+}
+
+var configLintCmd ConfigLintCmd
+
+func (c *ConfigLintCmd) Execute(args []string) error {
+	r, err := OpenRepo(c.Args.Dir.String())
+	if err != nil {
+		return err
+	}
+
+	errs, err := config.Lint(r.RootDir, config.LintOptions{
+		ToolchainInstalled: func(path string) bool {
+			if path == scan.BuiltinToolchain {
+				return true
+			}
+			_, err := toolchain.Lookup(path)
+			return err == nil
+		},
+		CoverageScorerRegistered: func(name string) bool {
+			_, err := cvg.LookupFileScorer(name)
+			return err == nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for _, e := range errs {
+		colorable.Println(e)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("found %d problems in the Srcfile", len(errs))
+	}
+	if GlobalOpt.Verbose {
+		log.Printf("No problems found in the Srcfile in %s.", r.RootDir)
+	}
+	return nil
+}
+
+type ConfigConvertCmd struct {
+	To    string `long:"to" description:"format to convert the Srcfile to (defaults to the format it is not in)" value-name:"json|yaml"`
+	Write bool   `short:"w" long:"write" description:"replace the Srcfile with the converted one (instead of printing it)"`
+
+	Args struct {
+		Dir Directory `name:"DIR" default:"." description:"directory in the repository whose Srcfile to convert"`
+	} `positional-args:"yes"`
+}
+
+var configConvertCmd ConfigConvertCmd
+
+func (c *ConfigConvertCmd) Execute(args []string) error {
+	r, err := OpenRepo(c.Args.Dir.String())
+	if err != nil {
+		return err
+	}
+	file, err := config.FindFile(r.RootDir)
+	if err != nil {
+		return err
+	}
+	if file == "" {
+		return fmt.Errorf("no Srcfile found in %s", r.RootDir)
+	}
+
+	to := c.To
+	if to == "" {
+		if config.IsYAML(file) {
+			to = "json"
+		} else {
+			to = "yaml"
+		}
+	}
+	if (to == "yaml") == config.IsYAML(file) {
+		return fmt.Errorf("%s is already in %s format", file, to)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var newFile string
+	switch to {
+	case "json":
+		data, err = config.ConvertToJSON(file, data)
+		newFile = filepath.Join(r.RootDir, config.Filename)
+	case "yaml":
+		data, err = config.ConvertToYAML(data)
+		newFile = filepath.Join(r.RootDir, "Srcfile.yaml")
+	default:
+		return fmt.Errorf("unknown format %q (must be json or yaml)", to)
+	}
+	if err != nil {
+		return fmt.Errorf("converting %s: %s", file, err)
+	}
+
+	if !c.Write {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := ioutil.WriteFile(newFile, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Remove(file); err != nil {
+		return err
+	}
+	log.Printf("Converted %s to %s.", file, newFile)
+	return nil
+}
+
+// configCacheKey returns the key of the cached config for the
+// repository whose root is rootDir (see config.CacheKey).
+func configCacheKey(rootDir, profile string) (string, error) {
+	toolchains, err := toolchain.List()
+	if err != nil {
+		return "", err
+	}
+	versions := make(map[string]string, len(toolchains))
+	for _, tc := range toolchains {
+		v, err := tc.Version()
+		if err != nil {
+			return "", err
+		}
+		versions[tc.Path] = v
+	}
+	return config.CacheKey(rootDir, profile, versions)
+}
+
+// ensureCachedConfig runs the config step (as "srclib config" does)
+// if the cached config for the current repository is missing or stale,
+// or if force is true.
+func ensureCachedConfig(profile string, force bool) error {
+	localRepo, err := OpenRepo(".")
+	if err != nil {
+		return err
+	}
+	if !force {
+		buildStore, err := buildstore.LocalRepo(localRepo.RootDir)
+		if err != nil {
+			return err
+		}
+		key, err := configCacheKey(localRepo.RootDir, profile)
+		if err != nil {
+			return err
+		}
+		err = config.CheckCacheKey(buildStore.Commit(localRepo.CommitID), key)
+		if err == nil {
+			return nil
+		} else if err != config.ErrStaleCache {
+			return err
+		}
+		log.Printf("The %s. Recreating it.", err)
+	}
+	return (&ConfigCmd{Quiet: !GlobalOpt.Verbose, Profile: profile}).Execute(nil)
+}
+
+// profileName returns the name of the selected Srcfile profile: name
+// if it is non-empty, and otherwise the value of $SRCLIB_PROFILE.
+func profileName(name string) string {
+	if name != "" {
+		return name
+	}
+	return os.Getenv("SRCLIB_PROFILE")
+}
+
 func sortedMap(m map[string]interface{}) [][2]interface{} {
 	keys := make([]string, len(m))
 	i := 0
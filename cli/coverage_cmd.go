@@ -4,9 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"math"
 	"os"
 	"path/filepath"
 
@@ -22,16 +20,23 @@ import (
 	"sourcegraph.com/sourcegraph/srclib/graph"
 	"sourcegraph.com/sourcegraph/srclib/grapher"
 	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/stdlib"
 	"sourcegraph.com/sourcegraph/srclib/unit"
 )
 
-const fileTokThresh float64 = 0.7
-
 func init() {
 	cliInit = append(cliInit, func(cli *flags.Command) {
 		_, err := cli.AddCommand("coverage",
 			"srclib coverage",
-			"compute approximate amount of code successfully analyzed by srclib",
+			`compute approximate amount of code successfully analyzed by srclib
+
+Files are counted under the language of their extension. Executable files without an extension are counted under the language of the interpreter named by their shebang line (e.g., "#!/usr/bin/env python").
+
+Whether each file counts as covered is decided by a coverage scorer (see cvg.FileScorer): by default, a file is covered if it has more than 0.7 defs and valid refs per line of code. Another registered scorer can be selected with --scorer or the Srcfile's CoverageScorer.
+
+With --workspace FILE, the coverage of each repository listed in the workspace file is computed, and a report is printed (as JSON) with the coverage of each repository (identified by its URI, or its path relative to the workspace file), the combined coverage of each language across all of the repositories, and the repositories whose coverage of any language is below the thresholds (by default, the same thresholds as "srclib test --corpus"; use the --min-* options to override them).
+
+The coverage of the current repository is recorded in the build data of its commit. With --history N, the recorded coverage of each language in the last N analyzed commits is printed instead, oldest first, with scores that dropped since the previous commit marked with "*".`,
 			&coverageCmd,
 		)
 		if err != nil {
@@ -41,29 +46,106 @@ func init() {
 }
 
 type codeFileDatum struct {
-	LoC          int
-	NumRefs      int
-	NumDefs      int
-	NumRefsValid int
-	Language     string
-	Seen         bool
+	LoC              int
+	NumRefs          int
+	NumDefs          int
+	NumRefsValid     int
+	NumRefsAmbiguous int // valid refs resolved to their top candidate
+	NumExported      int // number of exported defs
+	NumDocDefs       int // number of exported defs with docs
+	Language         string
+	Seen             bool
+}
+
+// file returns the data that the file at path is scored from (see
+// cvg.FileScorer).
+func (d *codeFileDatum) file(path string) *cvg.File {
+	return &cvg.File{
+		Path:       path,
+		Language:   d.Language,
+		LoC:        d.LoC,
+		Defs:       d.NumDefs,
+		Refs:       d.NumRefs,
+		ValidRefs:  d.NumRefsValid,
+		Exported:   d.NumExported,
+		Documented: d.NumDocDefs,
+	}
+}
+
+// countDefs counts the defs in the files in codeFileData, and the
+// exported ones and those of them that have docs (non-blank docs in
+// docs with their paths). Aliases aren't counted, since they aren't
+// separate symbols.
+func countDefs(codeFileData map[string]*codeFileDatum, defs []*graph.Def, docs []*graph.Doc) {
+	documented := make(map[string]struct{}, len(docs))
+	for _, doc := range docs {
+		if doc.Path != "" && strings.TrimSpace(doc.Data) != "" {
+			documented[doc.Path] = struct{}{}
+		}
+	}
+
+	for _, def := range defs {
+		if def.AliasOf != nil {
+			continue
+		}
+		if datum, exists := codeFileData[graph.CleanFile(def.File)]; exists {
+			datum.NumDefs++
+			if def.Exported {
+				datum.NumExported++
+				if _, hasDoc := documented[def.Path]; hasDoc {
+					datum.NumDocDefs++
+				}
+			}
+		}
+	}
 }
 
 type CoverageCmd struct {
+	WorkspaceOpt
+
+	Generated bool `long:"generated" description:"also count generated files (see graph.IsGenerated), which are excluded by default"`
+
+	TestCodeOpt
+
+	Scorer string `long:"scorer" description:"name of the coverage scorer that decides whether each file is covered (default: the Srcfile's CoverageScorer, or \"density\")" value-name:"NAME"`
+
+	// Minimum scores for the --workspace report.
+	MinFileScore  float64 `long:"min-file-score" description:"with --workspace, report repositories whose FileScore in any language is below this (default: the standard thresholds)" value-name:"SCORE"`
+	MinRefScore   float64 `long:"min-ref-score" description:"with --workspace, report repositories whose RefScore in any language is below this" value-name:"SCORE"`
+	MinTokDensity float64 `long:"min-tok-density" description:"with --workspace, report repositories whose TokDensity in any language is below this" value-name:"DENSITY"`
+	MinDocScore   float64 `long:"min-doc-score" description:"with --workspace, report repositories whose DocScore in any language is below this" value-name:"SCORE"`
+
+	History int `long:"history" description:"print the coverage of each language in the last N commits whose coverage was recorded (instead of computing it)" value-name:"N"`
 }
 
 var coverageCmd CoverageCmd
 
 func (c *CoverageCmd) Execute(args []string) error {
+	if err := c.TestCodeOpt.check(); err != nil {
+		return err
+	}
+	if c.History < 0 {
+		return fmt.Errorf("--history must be positive")
+	}
+	if c.History > 0 {
+		return c.coverageHistory(c.History)
+	}
+	if c.Workspace != "" {
+		return c.workspaceCoverage()
+	}
+
 	repo, err := OpenLocalRepo()
 	if err != nil {
 		return err
 	}
 
-	cvg, err := coverage(repo)
+	cvg, err := coverage(repo, c.Generated, &c.TestCodeOpt, c.Scorer)
 	if err != nil {
 		return err
 	}
+	if err := recordCoverage(repo, cvg); err != nil {
+		return fmt.Errorf("recording coverage: %s", err)
+	}
 
 	out, err := json.MarshalIndent(cvg, "", "  ")
 	if err != nil {
@@ -74,6 +156,99 @@ func (c *CoverageCmd) Execute(args []string) error {
 	return nil
 }
 
+// workspaceCoverageReport is the output of "srclib coverage
+// --workspace".
+type workspaceCoverageReport struct {
+	// Repos maps each repository (its URI, or its path relative to
+	// the workspace file) to its coverage in each language.
+	Repos map[string]map[string]*cvg.Coverage
+
+	// Combined is the coverage of each language across all of the
+	// repositories.
+	Combined map[string]*cvg.Coverage
+
+	// BelowThresholds maps each repository whose coverage of some
+	// language is below the minimum to descriptions of the scores
+	// that are too low.
+	BelowThresholds map[string][]string `json:",omitempty"`
+
+	// Failed lists the repositories whose coverage couldn't be
+	// computed.
+	Failed []string `json:",omitempty"`
+}
+
+// minCoverage returns the minimum coverage that each language in each
+// repository must have in a workspace report.
+func (c *CoverageCmd) minCoverage() *cvg.Coverage {
+	if c.MinFileScore == 0 && c.MinRefScore == 0 && c.MinTokDensity == 0 && c.MinDocScore == 0 {
+		return defaultMinCoverage
+	}
+	return &cvg.Coverage{FileScore: c.MinFileScore, RefScore: c.MinRefScore, TokDensity: c.MinTokDensity, DocScore: c.MinDocScore}
+}
+
+// workspaceCoverage prints a report of the coverage of each
+// repository in the workspace and of all of them combined. If
+// computing the coverage of some repositories fails, the report still
+// covers the others.
+func (c *CoverageCmd) workspaceCoverage() error {
+	outputs, wsErr := outputInWorkspace(c.Workspace)
+	w, err := config.ReadWorkspace(c.Workspace)
+	if err != nil {
+		return err
+	}
+
+	repoCovs := make(map[string]map[string]*cvg.Coverage, len(outputs))
+	for label, out := range outputs {
+		var cov map[string]*cvg.Coverage
+		if err := json.Unmarshal(out, &cov); err != nil {
+			return fmt.Errorf("parsing coverage output of %s: %s", label, err)
+		}
+		repoCovs[label] = cov
+	}
+	report := workspaceCoverage(repoCovs, c.minCoverage())
+	for _, r := range w.Repos {
+		if label := workspaceRepoLabel(w, r); repoCovs[label] == nil {
+			report.Failed = append(report.Failed, label)
+		}
+	}
+
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+
+	if len(report.BelowThresholds) > 0 {
+		log.Printf("%d of %d repositories have coverage below the thresholds.", len(report.BelowThresholds), len(w.Repos))
+	}
+	return wsErr
+}
+
+// workspaceCoverage combines the coverage of each repository in a
+// workspace and checks it against min.
+func workspaceCoverage(repoCovs map[string]map[string]*cvg.Coverage, min *cvg.Coverage) *workspaceCoverageReport {
+	report := &workspaceCoverageReport{
+		Repos:           repoCovs,
+		Combined:        map[string]*cvg.Coverage{},
+		BelowThresholds: map[string][]string{},
+	}
+	langCovs := map[string][]*cvg.Coverage{}
+	for label, cov := range repoCovs {
+		mins := make(map[string]*cvg.Coverage, len(cov))
+		for lang, langCov := range cov {
+			langCovs[lang] = append(langCovs[lang], langCov)
+			mins[lang] = min
+		}
+		if failures := corpusCoverageFailures(cov, mins); len(failures) > 0 {
+			report.BelowThresholds[label] = failures
+		}
+	}
+	for lang, covs := range langCovs {
+		report.Combined[lang] = cvg.Combine(covs...)
+	}
+	return report
+}
+
 var langToExts = map[string][]string{
 	"Go":          {".go"},
 	"Java":        {".java"},
@@ -85,6 +260,7 @@ var langToExts = map[string][]string{
 	"JavaScript":  {".js"},
 	"PHP":         {".php"},
 	"Objective-C": {".m", ".mm"},
+	"Shell":       {".sh", ".bash"},
 }
 var extToLang map[string]string
 
@@ -97,44 +273,41 @@ func init() {
 	}
 }
 
-func coverage(repo *Repo) (map[string]*cvg.Coverage, error) {
+// coverage computes the coverage of each language in repo. Generated
+// files are omitted unless includeGenerated is true, and test files
+// are omitted or counted according to tests. Files are scored with the
+// named cvg.FileScorer, or if scorerName is empty, with the Srcfile's
+// CoverageScorer (or the default).
+func coverage(repo *Repo, includeGenerated bool, tests *TestCodeOpt, scorerName string) (map[string]*cvg.Coverage, error) {
+	// The cached config doesn't record the Srcfile's test file
+	// patterns.
+	repoConfig, err := config.ReadRepository(repo.RootDir)
+	if err != nil {
+		return nil, err
+	}
+	if scorerName == "" {
+		scorerName = repoConfig.CoverageScorer
+	}
+	scorer, err := cvg.LookupFileScorer(scorerName)
+	if err != nil {
+		return nil, err
+	}
+
 	// Gather file data
 	codeFileData := make(map[string]*codeFileDatum) // data for each file needed to compute coverage
-	filepath.Walk(repo.RootDir, func(path string, info os.FileInfo, err error) error {
-		if filepath.IsAbs(path) {
-			var err error
-			path, err = filepath.Rel(repo.RootDir, path)
-			if err != nil {
-				return err
-			}
-		}
-
-		if info.IsDir() {
-			if strings.HasPrefix(info.Name(), ".") {
-				return filepath.SkipDir // don't search hidden directories
-			}
+	err = walkCodeFiles(repo.RootDir, repoConfig, func(path, lang string, data []byte) error {
+		if !includeGenerated && graph.IsGenerated(path, data) {
 			return nil
 		}
-
-		path = filepath.ToSlash(path)
-
-		ext := strings.ToLower(filepath.Ext(path))
-		if lang, isCodeFile := extToLang[ext]; isCodeFile {
-
-			// omitting special files (auto-generated, temporary, ...)
-			if shouldIgnoreFile(path, lang) {
-				return nil
-			}
-
-			b, err := ioutil.ReadFile(path)
-			if err != nil {
-				return err
-			}
-			loc := numLines(b)
-			codeFileData[path] = &codeFileDatum{LoC: loc, Language: lang}
+		if !tests.includesFile(repoConfig.IsTestFile(path)) {
+			return nil
 		}
+		codeFileData[path] = &codeFileDatum{LoC: countLoC(lang, data), Language: lang}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	// Gather ref/def data for each file
 	bdfs, err := GetBuildDataFS(repo.CommitID)
@@ -151,25 +324,33 @@ func coverage(repo *Repo) (map[string]*cvg.Coverage, error) {
 	}
 
 	defKeys := make(map[graph.DefKey]struct{})
+	aliases := graph.Aliases{}
 	data := make([]graph.Output, 0, len(mf.Rules))
+	var interner graph.Interner // shares strings across all units' data
 
 	parseGraphData := func(graphFile string, sourceUnit *unit.SourceUnit) error {
 		var item graph.Output
-		if err := readJSONFileFS(bdfs, graphFile, &item); err != nil {
+		if err := readBuildDataJSON(bdfs, graphFile, &item); err != nil {
 			if err == errEmptyJSONFile {
 				log.Printf("Warning: the JSON file is empty for unit %s %s.", sourceUnit.Type, sourceUnit.Name)
 				return nil
 			}
+			if isCorruptJSONFile(err) {
+				log.Printf("Warning: skipping unit %s %s: %s.", sourceUnit.Type, sourceUnit.Name, err)
+				return nil
+			}
 			if os.IsNotExist(err) {
 				log.Printf("Warning: no build data for unit %s %s.", sourceUnit.Type, sourceUnit.Name)
 				return nil
 			}
 			return fmt.Errorf("error reading JSON file %s for unit %s %s: %s", graphFile, sourceUnit.Type, sourceUnit.Name, err)
 		}
+		item.Refs = graph.DedupRefs(item.Refs)
+		interner.Output(&item)
 		data = append(data, item)
 
 		for _, file := range sourceUnit.Files {
-			if datum, exists := codeFileData[file]; exists {
+			if datum, exists := codeFileData[graph.CleanFile(file)]; exists {
 				datum.Seen = true
 			}
 		}
@@ -177,6 +358,7 @@ func coverage(repo *Repo) (map[string]*cvg.Coverage, error) {
 		for _, def := range item.Defs {
 			defKeys[def.DefKey] = struct{}{}
 		}
+		aliases.Add(item.Defs...)
 
 		return nil
 	}
@@ -196,20 +378,48 @@ func coverage(repo *Repo) (map[string]*cvg.Coverage, error) {
 		}
 	}
 
+	// Refs to standard library defs (that are listed in an installed
+	// stdlib manifest) are valid, too.
+	stdlibs, err := stdlib.LoadInstalled()
+	if err != nil {
+		return nil, err
+	}
+
 	missingKeys := make(map[graph.DefKey]struct{})
 
 	for _, item := range data {
 		var validRefs []*graph.Ref
 		for _, ref := range item.Refs {
-			if datum, exists := codeFileData[ref.File]; exists {
+			if datum, exists := codeFileData[graph.CleanFile(ref.File)]; exists {
 				datum.NumRefs++
 
+				// Refs to aliases are valid iff the def that they
+				// (transitively) alias exists.
+				if key, ok := aliases.Resolve(ref.DefKey()); !ok {
+					continue
+				} else if key != ref.DefKey() {
+					resolved := *ref
+					resolved.SetFromDefKey(key)
+					ref = &resolved
+				}
+
+				// An ambiguous ref is valid if its top candidate
+				// (which its def fields name; see
+				// graph.Ref.SortCandidates) is.
+				valid := false
 				if ref.DefUnitType == "URL" || ref.DefRepo != "" {
-					validRefs = append(validRefs, ref)
-					datum.NumRefsValid++
+					valid = true
 				} else if _, defExists := defKeys[ref.DefKey()]; defExists {
+					valid = true
+				} else if stdlibs.Lookup(ref) != nil {
+					valid = true
+				}
+				if valid {
 					validRefs = append(validRefs, ref)
 					datum.NumRefsValid++
+					if ref.Ambiguous() {
+						datum.NumRefsAmbiguous++
+					}
 				} else if GlobalOpt.Verbose {
 					if _, reported := missingKeys[ref.DefKey()]; !reported {
 						missingKeys[ref.DefKey()] = struct{}{}
@@ -226,23 +436,14 @@ func coverage(repo *Repo) (map[string]*cvg.Coverage, error) {
 			}
 		}
 
-		for _, def := range item.Defs {
-			if datum, exists := codeFileData[def.File]; exists {
-				datum.NumDefs++
-			}
-		}
+		countDefs(codeFileData, item.Defs, item.Docs)
 	}
 
 	// Compute coverage from per-file data
 	type langStats struct {
-		numFiles          int
-		numIndexedFiles   int
-		numDefs           int
-		numRefs           int
-		numRefsValid      int
+		counts            cvg.Counts
 		uncoveredFiles    []string
 		undiscoveredFiles []string
-		loc               int
 	}
 	stats := make(map[string]*langStats)
 	for file, datum := range codeFileData {
@@ -251,20 +452,22 @@ func coverage(repo *Repo) (map[string]*cvg.Coverage, error) {
 		}
 
 		s := stats[datum.Language]
-		s.loc += datum.LoC
-		s.numDefs += datum.NumDefs
-		s.numRefs += datum.NumRefs
-		s.numRefsValid += datum.NumRefsValid
+		s.counts.LoC += datum.LoC
+		s.counts.Defs += datum.NumDefs
+		s.counts.Refs += datum.NumRefs
+		s.counts.ValidRefs += datum.NumRefsValid
+		s.counts.AmbiguousRefs += datum.NumRefsAmbiguous
+		s.counts.Exported += datum.NumExported
+		s.counts.Documented += datum.NumDocDefs
 		if datum.Seen {
 			// this file is listed in the source unit and found by the scanner
-			s.numFiles++
-			density := float64(datum.NumDefs+datum.NumRefsValid) / float64(datum.LoC)
-			if density > fileTokThresh {
-				s.numIndexedFiles++
+			s.counts.Files++
+			if scorer.Covered(datum.file(file)) {
+				s.counts.IndexedFiles++
 			} else {
 				if GlobalOpt.Verbose {
-					log.Printf("Uncovered file %s - density: %f, defs: %d, refs: %d, lines of code: %d",
-						file, density, datum.NumDefs, datum.NumRefsValid, datum.LoC)
+					log.Printf("Uncovered file %s - defs: %d, refs: %d, lines of code: %d",
+						file, datum.NumDefs, datum.NumRefsValid, datum.LoC)
 				}
 				s.uncoveredFiles = append(s.uncoveredFiles, file)
 			}
@@ -279,13 +482,10 @@ func coverage(repo *Repo) (map[string]*cvg.Coverage, error) {
 
 	cov := make(map[string]*cvg.Coverage)
 	for lang, s := range stats {
-		cov[lang] = &cvg.Coverage{
-			FileScore:         divideSentinel(float64(s.numIndexedFiles), float64(s.numFiles), -1),
-			RefScore:          divideSentinel(float64(s.numRefsValid), float64(s.numRefs), -1),
-			TokDensity:        divideSentinel(float64(s.numDefs+s.numRefs), float64(s.loc), -1),
-			UncoveredFiles:    s.uncoveredFiles,
-			UndiscoveredFiles: s.undiscoveredFiles,
-		}
+		c := cvg.FromCounts(&s.counts)
+		c.UncoveredFiles = s.uncoveredFiles
+		c.UndiscoveredFiles = s.undiscoveredFiles
+		cov[lang] = c
 	}
 	return cov, nil
 }
@@ -307,14 +507,6 @@ func shouldIgnoreFile(filename, language string) bool {
 	return false
 }
 
-func divideSentinel(x, y, sentinel float64) float64 {
-	q := x / y
-	if math.IsNaN(q) {
-		return sentinel
-	}
-	return q
-}
-
 // numLines counts the number of lines that
 // - are not blank
 // - do not look like comments
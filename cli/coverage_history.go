@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/cvg"
+)
+
+// recordCoverage records the coverage of each language in repo's
+// current commit in the commit's build data (see cvg.WriteRecord), so
+// that "srclib coverage --history" can show it.
+func recordCoverage(repo *Repo, cov map[string]*cvg.Coverage) error {
+	if repo.CommitID == "" {
+		return nil
+	}
+	bs, err := buildstore.LocalRepo(repo.RootDir)
+	if err != nil {
+		return err
+	}
+	return cvg.WriteRecord(bs.Commit(repo.CommitID), &cvg.Record{
+		CommitID: repo.CommitID,
+		Time:     time.Now().UTC(),
+		Coverage: cov,
+	})
+}
+
+// readCoverageRecords returns the coverage records of all of the
+// commits in repo's build store.
+func readCoverageRecords(repo *Repo) ([]*cvg.Record, error) {
+	bs, err := buildstore.LocalRepo(repo.RootDir)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := buildstore.Commits(rwvfs.OS(filepath.Join(repo.RootDir, buildstore.BuildDataDirName)))
+	if err != nil {
+		return nil, err
+	}
+	var records []*cvg.Record
+	for _, commitID := range commits {
+		r, err := cvg.ReadRecord(bs.Commit(commitID))
+		if err != nil {
+			return nil, fmt.Errorf("reading coverage of commit %s: %s", commitID, err)
+		}
+		if r != nil {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+// printCoverageTrend prints a table of the coverage of each language
+// (sorted by name) in each commit of trend, oldest first. Scores that
+// are lower than in the previous commit are marked with "*".
+func printCoverageTrend(w io.Writer, trend map[string][]cvg.TrendPoint) {
+	langs := make([]string, 0, len(trend))
+	for lang := range trend {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+
+	score := func(v, prev float64, hasPrev bool) string {
+		s := fmt.Sprintf("%.3f", v)
+		if hasPrev && v < prev {
+			s += "*"
+		}
+		return s
+	}
+	for i, lang := range langs {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, lang)
+		fmt.Fprintf(w, "%-7s  %-16s  %-8s  %-8s  %-8s  %s\n", "COMMIT", "DATE", "FILES", "REFS", "DENSITY", "DOCS")
+		var prev *cvg.Coverage
+		for _, p := range trend[lang] {
+			commit := p.CommitID
+			if len(commit) > 7 {
+				commit = commit[:7]
+			}
+			var pc cvg.Coverage
+			if prev != nil {
+				pc = *prev
+			}
+			fmt.Fprintf(w, "%-7s  %-16s  %-8s  %-8s  %-8s  %s\n",
+				commit, p.Time.Format("2006-01-02 15:04"),
+				score(p.FileScore, pc.FileScore, prev != nil),
+				score(p.RefScore, pc.RefScore, prev != nil),
+				score(p.TokDensity, pc.TokDensity, prev != nil),
+				score(p.DocScore, pc.DocScore, prev != nil),
+			)
+			prev = p.Coverage
+		}
+	}
+}
+
+// coverageHistory prints the trend of the coverage of each language
+// over the last n commits of the current repository whose coverage was
+// recorded.
+func (c *CoverageCmd) coverageHistory(n int) error {
+	repo, err := OpenRepo(".")
+	if err != nil {
+		return err
+	}
+	records, err := readCoverageRecords(repo)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("no coverage has been recorded (run 'srclib coverage' after building each commit)")
+	}
+	printCoverageTrend(os.Stdout, cvg.Trend(records, n))
+	return nil
+}
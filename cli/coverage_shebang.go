@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// interpreterToLang maps the names of script interpreters (without
+// version suffixes) to the languages of the scripts that they run.
+var interpreterToLang = map[string]string{
+	"python":  "Python",
+	"pypy":    "Python",
+	"ruby":    "Ruby",
+	"jruby":   "Ruby",
+	"node":    "JavaScript",
+	"nodejs":  "JavaScript",
+	"php":     "PHP",
+	"sh":      "Shell",
+	"bash":    "Shell",
+	"dash":    "Shell",
+	"ksh":     "Shell",
+	"zsh":     "Shell",
+	"ts-node": "TypeScript",
+}
+
+// maxShebangLen is the number of bytes at the beginning of a file
+// that are read to find its shebang line.
+const maxShebangLen = 256
+
+// scriptLang returns the language of the executable script at file,
+// according to the interpreter named by its shebang line (e.g.,
+// "#!/usr/bin/env python3"). It is used to determine the language of
+// files without an extension. It returns false if the file isn't a
+// script in a known language.
+func scriptLang(file string) (string, bool) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	head := make([]byte, maxShebangLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", false
+	}
+	return shebangLang(head[:n])
+}
+
+// shebangLang returns the language of the script whose beginning is
+// data, according to the interpreter named by its shebang line.
+func shebangLang(data []byte) (string, bool) {
+	if !bytes.HasPrefix(data, []byte("#!")) {
+		return "", false
+	}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		data = data[:i]
+	}
+	args := strings.Fields(string(data[2:]))
+	if len(args) == 0 {
+		return "", false
+	}
+
+	interp := path.Base(args[0])
+	if interp == "env" {
+		// Skip env's options and variable assignments (as in
+		// "#!/usr/bin/env -S FOO=1 python -u").
+		interp = ""
+		for _, arg := range args[1:] {
+			if !strings.HasPrefix(arg, "-") && !strings.Contains(arg, "=") {
+				interp = path.Base(arg)
+				break
+			}
+		}
+	}
+
+	// Strip version suffixes (as in "python3" or "ruby2.7").
+	interp = strings.TrimRight(interp, "0123456789.")
+	lang, ok := interpreterToLang[interp]
+	return lang, ok
+}
@@ -1,8 +1,14 @@
 package cli
 
 import (
+	"bytes"
 	"io/ioutil"
+	"reflect"
 	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/srclib/cvg"
+	"sourcegraph.com/sourcegraph/srclib/graph"
 )
 
 func TestStripCode(t *testing.T) {
@@ -65,3 +71,129 @@ func TestNumLines(t *testing.T) {
 	}
 
 }
+
+func TestShebangLang(t *testing.T) {
+	tests := map[string]string{
+		"#!/usr/bin/env python\nprint(1)\n":       "Python",
+		"#!/usr/bin/python3.8 -u\n":               "Python",
+		"#!/bin/bash\n":                           "Shell",
+		"#! /usr/bin/env ruby\n":                  "Ruby",
+		"#!/usr/bin/env -S NODE_ENV=1 node --x\n": "JavaScript",
+		"#!/usr/bin/env perl\n":                   "",
+		"#!\n":                                    "",
+		"print(1)\n":                              "",
+	}
+	for data, want := range tests {
+		lang, ok := shebangLang([]byte(data))
+		if lang != want || ok != (want != "") {
+			t.Errorf("%q: got %q, %v, want %q", data, lang, ok, want)
+		}
+	}
+}
+
+func TestWorkspaceCoverage(t *testing.T) {
+	repoCovs := map[string]map[string]*cvg.Coverage{
+		"a": {"Go": cvg.FromCounts(&cvg.Counts{Files: 10, IndexedFiles: 10, Refs: 100, ValidRefs: 100, Defs: 50, LoC: 100})},
+		"b": {"Go": cvg.FromCounts(&cvg.Counts{Files: 10, IndexedFiles: 6, Refs: 100, ValidRefs: 80, Defs: 50, LoC: 100})},
+	}
+	report := workspaceCoverage(repoCovs, &cvg.Coverage{FileScore: 0.7, RefScore: 0.9})
+
+	combined := report.Combined["Go"]
+	if combined == nil {
+		t.Fatal("no combined Go coverage")
+	}
+	if combined.FileScore != 0.8 || combined.RefScore != 0.9 || combined.TokDensity != 1.5 {
+		t.Errorf("got combined coverage %+v, want FileScore 0.8, RefScore 0.9, TokDensity 1.5", combined)
+	}
+
+	want := map[string][]string{"b": {"Go: FileScore 0.600 < 0.700", "Go: RefScore 0.800 < 0.900"}}
+	if !reflect.DeepEqual(report.BelowThresholds, want) {
+		t.Errorf("got below thresholds %v, want %v", report.BelowThresholds, want)
+	}
+}
+
+func TestDocScore(t *testing.T) {
+	def := func(path string, exported bool) *graph.Def {
+		return &graph.Def{DefKey: graph.DefKey{Path: path}, File: "a.go", Exported: exported}
+	}
+	doc := func(path, data string) *graph.Doc {
+		return &graph.Doc{DefKey: graph.DefKey{Path: path}, Data: data}
+	}
+	alias := def("B", true)
+	alias.AliasOf = &graph.DefKey{Path: "A"}
+
+	tests := map[string]struct {
+		defs []*graph.Def
+		docs []*graph.Doc
+		want float64
+	}{
+		"documented":   {defs: []*graph.Def{def("A", true)}, docs: []*graph.Doc{doc("A", "A does x.")}, want: 1},
+		"undocumented": {defs: []*graph.Def{def("A", true)}, want: 0},
+		"blank doc":    {defs: []*graph.Def{def("A", true)}, docs: []*graph.Doc{doc("A", " \n")}, want: 0},
+		"other def's doc": {
+			defs: []*graph.Def{def("A", true)},
+			docs: []*graph.Doc{doc("B", "B does x.")},
+			want: 0,
+		},
+		"mixed": {
+			defs: []*graph.Def{def("A", true), def("B", true), def("c", false), def("d", false)},
+			docs: []*graph.Doc{doc("A", "A does x."), doc("c", "c does x.")},
+			want: 0.5,
+		},
+		"alias": {
+			defs: []*graph.Def{def("A", true), alias},
+			docs: []*graph.Doc{doc("A", "A does x.")},
+			want: 1,
+		},
+		// With no exported defs, DocScore is -1, like the other
+		// scores with a zero denominator.
+		"only unexported": {defs: []*graph.Def{def("c", false)}, docs: []*graph.Doc{doc("c", "c does x.")}, want: -1},
+		"no defs":         {want: -1},
+	}
+	for label, test := range tests {
+		datum := &codeFileDatum{}
+		countDefs(map[string]*codeFileDatum{"a.go": datum}, test.defs, test.docs)
+		got := cvg.FromCounts(&cvg.Counts{Exported: datum.NumExported, Documented: datum.NumDocDefs}).DocScore
+		if got != test.want {
+			t.Errorf("%s: got DocScore %v, want %v", label, got, test.want)
+		}
+	}
+}
+
+func TestPrintCoverageTrend(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2015, 6, d, 0, 0, 0, 0, time.UTC) }
+	trend := map[string][]cvg.TrendPoint{
+		"Go": {
+			{CommitID: "0123456789", Time: day(1), Coverage: &cvg.Coverage{FileScore: 0.9, RefScore: 0.8, TokDensity: 1, DocScore: 0.5}},
+			{CommitID: "abcdef0123", Time: day(2), Coverage: &cvg.Coverage{FileScore: 0.8, RefScore: 0.85, TokDensity: 1, DocScore: 0.5}},
+		},
+	}
+	var buf bytes.Buffer
+	printCoverageTrend(&buf, trend)
+	want := `Go
+COMMIT   DATE              FILES     REFS      DENSITY   DOCS
+0123456  2015-06-01 00:00  0.900     0.800     1.000     0.500
+abcdef0  2015-06-02 00:00  0.800*    0.850     1.000     0.500
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCountLoC(t *testing.T) {
+	tests := []struct {
+		lang, data string
+		want       int
+	}{
+		{"Python", "#!/usr/bin/env python\n# comment\n\nx = 1\n  # indented\nprint(x)  # trailing\n", 2},
+		{"Shell", "#!/bin/sh\necho hi\n", 1},
+		{"Ruby", "# c\n=begin\nx = 1\n=end\ny = 2\n", 1},
+		{"Python", "=begin\nx = 1\n", 2},
+		{"Go", "// c\npackage a\n", 1},
+	}
+	for _, test := range tests {
+		if got := countLoC(test.lang, []byte(test.data)); got != test.want {
+			t.Errorf("%s %q: got %d, want %d", test.lang, test.data, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"sort"
+
+	"sourcegraph.com/sourcegraph/go-flags"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func init() {
+	cliInit = append(cliInit, func(cli *flags.Command) {
+		c, err := cli.AddCommand("deadcode",
+			"list exported defs that nothing refers to",
+			`Lists dead code candidates: the exported defs in the store that have no refs, either from within their repository or (with a MultiRepoStore) from any other repository in the store.
+
+Exported defs are often used by code that srclib doesn't know about, so the results are only candidates. To reduce false positives, entry points (defs named main or init, or matching the --entrypoint patterns), defs in test code (unless --tests is given), and defs of the --exclude-kind kinds (such as kinds that are commonly used via reflection) are not listed.
+
+Run "srclib store import" first to import the current commit's build data into the store.`,
+			&deadcodeCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+		setLocalStoreRootDefault(c.Group)
+	})
+}
+
+// defaultEntrypoints are the names of the defs that are entry points
+// (and are called by the runtime, not referred to in code) if no
+// --entrypoint patterns are given.
+var defaultEntrypoints = []string{"main", "init"}
+
+type DeadcodeCmd struct {
+	StoreCmd
+
+	Repo     string `long:"repo" description:"only list defs in this repository"`
+	CommitID string `long:"commit" description:"only list defs (and count refs) at this commit (default: the current commit, for a RepoStore)"`
+	UnitType string `long:"unit-type" description:"only list defs in source units of this type"`
+	Unit     string `long:"unit" description:"only list defs in the source unit with this name (requires --unit-type)"`
+
+	Entrypoints  []string `long:"entrypoint" description:"don't list defs whose name matches this pattern (as in path.Match), which are entry points; may be repeated (default: main and init)" value-name:"PATTERN"`
+	Tests        bool     `long:"tests" description:"also list defs in test code"`
+	Generated    bool     `long:"generated" description:"also list defs in generated files"`
+	ExcludeKinds []string `long:"exclude-kind" description:"don't list defs of this kind (e.g., field); may be repeated" value-name:"KIND"`
+
+	Format string `long:"format" description:"output format" default:"table" value-name:"table|json"`
+}
+
+var deadcodeCmd DeadcodeCmd
+
+func (c *DeadcodeCmd) Execute(args []string) error {
+	if c.Format != "table" && c.Format != "json" {
+		return fmt.Errorf("unknown output format %q (expected table or json)", c.Format)
+	}
+	if c.Unit != "" && c.UnitType == "" {
+		return fmt.Errorf("--unit requires --unit-type")
+	}
+	for _, pat := range c.Entrypoints {
+		if _, err := path.Match(pat, ""); err != nil {
+			return fmt.Errorf("invalid --entrypoint pattern %q: %s", pat, err)
+		}
+	}
+
+	s, err := c.store()
+	if err != nil {
+		return err
+	}
+	rs, ok := s.(store.RepoStore)
+	if !ok {
+		return fmt.Errorf("store (type %T) does not implement listing defs and refs", s)
+	}
+
+	commitID := c.CommitID
+	if _, isMulti := s.(store.MultiRepoStore); commitID == "" && !isMulti {
+		repo, err := OpenLocalRepo()
+		if err != nil {
+			return err
+		}
+		commitID = repo.CommitID
+	}
+
+	var defFilters []store.DefFilter
+	// Don't count a def's own definition as a ref to it.
+	refFilters := []store.RefFilter{store.RefFilterFunc(func(r *graph.Ref) bool { return !r.Def })}
+	if c.Repo != "" {
+		defFilters = append(defFilters, store.ByRepos(c.Repo))
+	}
+	if commitID != "" {
+		defFilters = append(defFilters, store.ByCommitIDs(commitID))
+		if c.Repo == "" {
+			refFilters = append(refFilters, store.ByCommitIDs(commitID))
+		} else {
+			// Count refs from other repositories at any commit, but
+			// only refs at commitID from the defs' repository.
+			repo := c.Repo
+			refFilters = append(refFilters, store.AbsRefFilterFunc(func(r *graph.Ref) bool {
+				return r.Repo != repo || r.CommitID == commitID
+			}))
+		}
+	}
+	if c.UnitType != "" {
+		if c.Unit != "" {
+			defFilters = append(defFilters, store.ByUnits(unit.ID2{Type: c.UnitType, Name: c.Unit}))
+		} else {
+			unitType := c.UnitType
+			defFilters = append(defFilters, store.DefFilterFunc(func(d *graph.Def) bool { return d.UnitType == unitType }))
+		}
+	}
+
+	defs, err := rs.Defs(defFilters...)
+	if err != nil {
+		return err
+	}
+
+	entrypoints := c.Entrypoints
+	if len(entrypoints) == 0 {
+		entrypoints = defaultEntrypoints
+	}
+	opt := deadcodeOpt{
+		Entrypoints:  entrypoints,
+		Tests:        c.Tests,
+		Generated:    c.Generated,
+		ExcludeKinds: c.ExcludeKinds,
+	}
+	// Look up each candidate's refs with a ByRefDef filter (which
+	// uses the def-to-refs indexes) instead of loading every ref in
+	// the store.
+	dead, err := deadDefs(defs, opt, func(d *graph.Def, aliases graph.Aliases) (bool, error) {
+		def := graph.RefDefKey{DefRepo: d.Repo, DefUnitType: d.UnitType, DefUnit: d.Unit, DefPath: d.Path}
+		refs, err := rs.Refs(append([]store.RefFilter{store.ByRefDefOrAliases(def, aliases)}, refFilters...)...)
+		return len(refs) > 0, err
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.Format == "json" {
+		type deadDef struct {
+			graph.DefKey
+			Name string
+			Kind string `json:",omitempty"`
+			File string
+		}
+		out := make([]deadDef, len(dead))
+		for i, d := range dead {
+			out[i] = deadDef{DefKey: d.DefKey, Name: d.Name, Kind: d.Kind, File: d.File}
+		}
+		PrintJSON(out, "  ")
+		return nil
+	}
+	for _, d := range dead {
+		fmt.Printf("%-40s %-10s %s\n", statsDefLabel(statsDefKey(d.DefKey)), d.Kind, d.File)
+	}
+	if len(dead) == 0 {
+		log.Println("No dead code candidates found.")
+	}
+	return nil
+}
+
+// deadcodeOpt configures deadDefs.
+type deadcodeOpt struct {
+	Entrypoints  []string // patterns (as in path.Match) of entry point def names
+	Tests        bool     // whether to include defs in test code
+	Generated    bool     // whether to include defs in generated files
+	ExcludeKinds []string // def kinds to exclude
+}
+
+// deadDefs returns the exported (non-local) defs for which hasRefs
+// reports no refs, excluding aliases, entry points, test defs,
+// generated defs, and defs of excluded kinds as specified by opt.
+// hasRefs is called with the aliases defined by defs and should
+// report whether any ref (other than a def's own definition) refers
+// to the def, directly or via one of the aliases. The result is
+// sorted by def key.
+func deadDefs(defs []*graph.Def, opt deadcodeOpt, hasRefs func(def *graph.Def, aliases graph.Aliases) (bool, error)) ([]*graph.Def, error) {
+	aliases := graph.NewAliases(defs)
+	var dead []*graph.Def
+	for _, d := range defs {
+		if d.AliasOf != nil || !d.Exported || d.Local || (d.Test && !opt.Tests) || (d.Generated && !opt.Generated) || containsFold(opt.ExcludeKinds, d.Kind) || isEntrypoint(d.Name, opt.Entrypoints) {
+			continue
+		}
+		referenced, err := hasRefs(d, aliases)
+		if err != nil {
+			return nil, err
+		}
+		if !referenced {
+			dead = append(dead, d)
+		}
+	}
+	sort.Sort(defsByKey(dead))
+	return dead, nil
+}
+
+// isEntrypoint reports whether name matches any of the entry point
+// patterns.
+func isEntrypoint(name string, patterns []string) bool {
+	for _, pat := range patterns {
+		if ok, _ := path.Match(pat, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type defsByKey []*graph.Def
+
+func (v defsByKey) Len() int           { return len(v) }
+func (v defsByKey) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v defsByKey) Less(i, j int) bool { return defKeyLess(v[i].DefKey, v[j].DefKey) }
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestDeadDefs(t *testing.T) {
+	def := func(path, name, kind string, exported, test bool) *graph.Def {
+		return &graph.Def{
+			DefKey:   graph.DefKey{Repo: "r", CommitID: "c", UnitType: "t", Unit: "u", Path: path},
+			Name:     name,
+			Kind:     kind,
+			Exported: exported,
+			Test:     test,
+		}
+	}
+	defs := []*graph.Def{
+		def("Used", "Used", "func", true, false),
+		def("UsedExternally", "UsedExternally", "func", true, false),
+		def("Dead", "Dead", "func", true, false),
+		def("unexported", "unexported", "func", false, false),
+		def("main", "main", "func", true, false),
+		def("TestFoo", "TestFoo", "func", true, true),
+		def("T/Field", "Field", "field", true, false),
+		def("OnlyDefRef", "OnlyDefRef", "func", true, false),
+		{DefKey: graph.DefKey{Repo: "r", CommitID: "c", UnitType: "t", Unit: "u", Path: "Foo/String"}, Name: "String", Kind: "method", Exported: true, Generated: true},
+		def("UsedViaAlias", "UsedViaAlias", "func", true, false),
+		{DefKey: graph.DefKey{Repo: "r", CommitID: "c", UnitType: "t", Unit: "u", Path: "Alias"}, Name: "Alias", Kind: "func", Exported: true, AliasOf: &graph.DefKey{Path: "UsedViaAlias"}},
+	}
+	refs := []*graph.Ref{
+		{Repo: "r", CommitID: "c", UnitType: "t", Unit: "u", DefUnitType: "t", DefUnit: "u", DefPath: "Used"},
+		{Repo: "r2", UnitType: "t", Unit: "v", DefRepo: "r", DefUnitType: "t", DefUnit: "u", DefPath: "UsedExternally"},
+		{Repo: "r", CommitID: "c", UnitType: "t", Unit: "u", DefUnitType: "t", DefUnit: "u", DefPath: "OnlyDefRef", Def: true},
+		{Repo: "r2", UnitType: "t", Unit: "v", DefRepo: "r", DefUnitType: "t", DefUnit: "u", DefPath: "Alias"},
+	}
+
+	hasRefs := func(d *graph.Def, aliases graph.Aliases) (bool, error) {
+		keys := map[graph.DefKey]struct{}{statsDefKey(d.DefKey): {}}
+		for _, k := range aliases.AliasesOf(d.DefKey) {
+			keys[k] = struct{}{}
+		}
+		for _, r := range refs {
+			if _, ok := keys[refDefKey(r)]; ok && !r.Def {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	tests := []struct {
+		opt  deadcodeOpt
+		want []string
+	}{
+		{
+			opt:  deadcodeOpt{Entrypoints: defaultEntrypoints},
+			want: []string{"Dead", "OnlyDefRef", "T/Field"},
+		},
+		{
+			opt:  deadcodeOpt{Entrypoints: defaultEntrypoints, Tests: true, ExcludeKinds: []string{"Field"}},
+			want: []string{"Dead", "OnlyDefRef", "TestFoo"},
+		},
+		{
+			opt:  deadcodeOpt{Entrypoints: []string{"Dead", "Only*"}},
+			want: []string{"T/Field", "main"},
+		},
+		{
+			opt:  deadcodeOpt{Entrypoints: defaultEntrypoints, Generated: true},
+			want: []string{"Dead", "Foo/String", "OnlyDefRef", "T/Field"},
+		},
+	}
+	for _, test := range tests {
+		dead, err := deadDefs(defs, test.opt, hasRefs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, d := range dead {
+			got = append(got, d.Path)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%+v: got %v, want %v", test.opt, got, test.want)
+		}
+	}
+}
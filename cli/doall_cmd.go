@@ -22,7 +22,8 @@ func init() {
 }
 
 type DoAllCmd struct {
-	Dir Directory `short:"C" long:"directory" description:"change to DIR before doing anything" value-name:"DIR"`
+	Dir     Directory `short:"C" long:"directory" description:"change to DIR before doing anything" value-name:"DIR"`
+	Profile string    `long:"profile" description:"apply the named profile from the Srcfile (default: $SRCLIB_PROFILE)" value-name:"NAME"`
 }
 
 var doAllCmd DoAllCmd
@@ -35,13 +36,13 @@ func (c *DoAllCmd) Execute(args []string) error {
 	}
 
 	// config
-	configCmd := &ConfigCmd{}
+	configCmd := &ConfigCmd{Profile: c.Profile}
 	if err := configCmd.Execute(nil); err != nil {
 		return err
 	}
 
 	// make
-	makeCmd := &MakeCmd{}
+	makeCmd := &MakeCmd{Profile: c.Profile}
 	if err := makeCmd.Execute(nil); err != nil {
 		return err
 	}
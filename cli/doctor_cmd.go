@@ -0,0 +1,270 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/alexsaveliev/go-colorable-wrapper"
+
+	"sourcegraph.com/sourcegraph/go-flags"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+)
+
+func init() {
+	cliInit = append(cliInit, func(cli *flags.Command) {
+		_, err := cli.AddCommand("doctor",
+			"check the srclib environment",
+			`Checks the environment that srclib needs to build a repository: the SRCLIBPATH, the installed toolchains (and their versions), the programs that srclib and toolchains run (sh, make, and Docker), the repository in the current directory (and its Srcfile), and the repository's build data directory.
+
+For each problem found, a fix is suggested. The command exits with an error if any check fails.`,
+			&doctorCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	})
+}
+
+type DoctorCmd struct {
+	Dir Directory `short:"C" long:"directory" description:"check the repository in DIR" value-name:"DIR"`
+}
+
+var doctorCmd DoctorCmd
+
+// doctorStatus is the outcome of a single doctor check.
+type doctorStatus int
+
+const (
+	doctorOK doctorStatus = iota
+	doctorWarn
+	doctorFail
+)
+
+func (s doctorStatus) String() string {
+	switch s {
+	case doctorOK:
+		return colorable.Green("ok  ")
+	case doctorWarn:
+		return colorable.Yellow("warn")
+	default:
+		return colorable.Red("FAIL")
+	}
+}
+
+// doctorResult is the result of a single doctor check. Fix, if set,
+// describes how to fix a warning or failure.
+type doctorResult struct {
+	Status  doctorStatus
+	Message string
+	Fix     string
+}
+
+func (c *DoctorCmd) Execute(args []string) error {
+	dir := c.Dir.String()
+
+	sections := []struct {
+		name  string
+		check func() []doctorResult
+	}{
+		{"SRCLIBPATH", doctorSrclibPath},
+		{"Toolchains", doctorToolchains},
+		{"Programs", doctorPrograms},
+		{"Repository", func() []doctorResult { return doctorRepo(dir) }},
+	}
+
+	var failed int
+	for _, s := range sections {
+		colorable.Println(colorable.Cyan(s.name))
+		for _, r := range s.check() {
+			colorable.Printf("  [%s] %s\n", r.Status, r.Message)
+			if r.Fix != "" && r.Status != doctorOK {
+				colorable.Printf("         -> %s\n", r.Fix)
+			}
+			if r.Status == doctorFail {
+				failed++
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	colorable.Println(colorable.Green("No problems found."))
+	return nil
+}
+
+// doctorSrclibPath checks that the SRCLIBPATH entries exist and that
+// the first one (where toolchains are installed and build data is
+// cached) is writable.
+func doctorSrclibPath() []doctorResult {
+	var rs []doctorResult
+	for i, dir := range filepath.SplitList(srclib.Path) {
+		fi, err := os.Stat(dir)
+		switch {
+		case os.IsNotExist(err) && i == 0:
+			rs = append(rs, doctorResult{doctorFail, fmt.Sprintf("%s does not exist", dir), fmt.Sprintf("Create it (mkdir -p %s) or run %q.", dir, "srclib toolchain install")})
+			continue
+		case os.IsNotExist(err):
+			rs = append(rs, doctorResult{doctorWarn, fmt.Sprintf("%s does not exist", dir), "Create it or remove it from $SRCLIBPATH."})
+			continue
+		case err != nil:
+			rs = append(rs, doctorResult{doctorFail, err.Error(), ""})
+			continue
+		case !fi.Mode().IsDir():
+			rs = append(rs, doctorResult{doctorFail, fmt.Sprintf("%s is not a directory", dir), "Set $SRCLIBPATH to a list of directories."})
+			continue
+		}
+		if i == 0 {
+			if err := checkWritable(dir); err != nil {
+				rs = append(rs, doctorResult{doctorFail, fmt.Sprintf("%s is not writable: %s", dir, err), "Fix its permissions or set $SRCLIBPATH to a writable directory."})
+				continue
+			}
+		}
+		rs = append(rs, doctorResult{Status: doctorOK, Message: dir})
+	}
+	if len(rs) == 0 {
+		rs = append(rs, doctorResult{doctorFail, "SRCLIBPATH is empty", "Set $SRCLIBPATH (the default is ~/.srclib)."})
+	}
+	return rs
+}
+
+// doctorToolchains checks that toolchains are installed, that their
+// programs are executable, and that they provide scanners (without
+// which no source units are found).
+func doctorToolchains() []doctorResult {
+	tcs, err := toolchain.List()
+	if err != nil {
+		return []doctorResult{{doctorFail, fmt.Sprintf("listing toolchains: %s", err), "Check that the SRCLIBPATH directories are readable."}}
+	}
+	if len(tcs) == 0 {
+		return []doctorResult{{doctorFail, "no toolchains installed", fmt.Sprintf("Run %q to install toolchains.", "srclib toolchain install")}}
+	}
+
+	var rs []doctorResult
+	for _, tc := range tcs {
+		rs = append(rs, doctorToolchain(tc))
+	}
+
+	cfg, err := config.SrclibPathConfig()
+	if err != nil {
+		rs = append(rs, doctorResult{doctorFail, fmt.Sprintf("reading toolchain configs: %s", err), ""})
+	} else if len(cfg.Scanners) == 0 {
+		rs = append(rs, doctorResult{doctorFail, "no installed toolchain provides a scanner", fmt.Sprintf("Run %q to install toolchains with scanners.", "srclib toolchain install")})
+	} else {
+		rs = append(rs, doctorResult{Status: doctorOK, Message: fmt.Sprintf("%d scanner(s) available", len(cfg.Scanners))})
+	}
+	return rs
+}
+
+func doctorToolchain(tc *toolchain.Info) doctorResult {
+	reinstall := fmt.Sprintf("Reinstall it (srclib toolchain install) or remove %s.", tc.Dir)
+	if _, err := tc.ReadConfig(); err != nil {
+		return doctorResult{doctorFail, fmt.Sprintf("%s: bad %s: %s", tc.Path, tc.ConfigFile, err), reinstall}
+	}
+	if tc.Program == "" {
+		return doctorResult{doctorFail, fmt.Sprintf("%s: no program found (expected .bin/%s)", tc.Path, filepath.Base(tc.Path)), fmt.Sprintf("Build the toolchain (usually by running make in %s) or reinstall it.", tc.Dir)}
+	}
+	fi, err := os.Stat(filepath.Join(tc.Dir, tc.Program))
+	if err != nil {
+		return doctorResult{doctorFail, fmt.Sprintf("%s: %s", tc.Path, err), reinstall}
+	}
+	if fi.Mode()&0111 == 0 {
+		return doctorResult{doctorFail, fmt.Sprintf("%s: program %s is not executable", tc.Path, tc.Program), fmt.Sprintf("Run chmod +x %s.", filepath.Join(tc.Dir, tc.Program))}
+	}
+	version, err := tc.Version()
+	if err != nil {
+		return doctorResult{doctorFail, fmt.Sprintf("%s: %s", tc.Path, err), reinstall}
+	}
+	return doctorResult{Status: doctorOK, Message: fmt.Sprintf("%s (version %s)", tc.Path, version[:12])}
+}
+
+// doctorPrograms checks that the external programs that srclib and
+// toolchains run are in the PATH.
+func doctorPrograms() []doctorResult {
+	programs := []struct {
+		name    string
+		status  doctorStatus // status if the program is not found
+		purpose string
+	}{
+		{"sh", doctorFail, "runs build rule recipes and toolchain bundle commands"},
+		{"make", doctorWarn, "needed by 'srclib toolchain install' and to run Makefiles from 'srclib makefile'"},
+		{"git", doctorWarn, "needed to build git repositories"},
+		{"docker", doctorWarn, "needed only by toolchains that run their tools in Docker containers"},
+	}
+
+	var rs []doctorResult
+	for _, p := range programs {
+		path, err := exec.LookPath(p.name)
+		if err != nil {
+			rs = append(rs, doctorResult{p.status, fmt.Sprintf("%s not found in PATH (%s)", p.name, p.purpose), fmt.Sprintf("Install %s or add it to your PATH.", p.name)})
+			continue
+		}
+		rs = append(rs, doctorResult{Status: doctorOK, Message: fmt.Sprintf("%s: %s", p.name, path)})
+	}
+	return rs
+}
+
+// doctorRepo checks that dir is in a repository that srclib can
+// detect, that the repository's Srcfile (if any) is valid, and that
+// its build data directory is writable.
+func doctorRepo(dir string) []doctorResult {
+	repo, err := OpenRepo(dir)
+	if err != nil {
+		return []doctorResult{{doctorFail, err.Error(), "Run srclib in a git or hg repository (or a subdirectory of one)."}}
+	}
+	rs := []doctorResult{{Status: doctorOK, Message: fmt.Sprintf("%s repository at %s (commit %s)", repo.VCSType, repo.RootDir, repo.CommitID)}}
+
+	if repo.CloneURL == "" {
+		rs = append(rs, doctorResult{doctorWarn, "no clone URL detected", "Add a VCS remote, set CloneURL in the Srcfile, or pass --clone-url."})
+	} else {
+		rs = append(rs, doctorResult{Status: doctorOK, Message: fmt.Sprintf("clone URL %s", repo.CloneURL)})
+	}
+
+	if file, err := config.FindFile(repo.RootDir); err != nil {
+		rs = append(rs, doctorResult{doctorFail, err.Error(), ""})
+	} else if file == "" {
+		rs = append(rs, doctorResult{Status: doctorOK, Message: fmt.Sprintf("no Srcfile (all scanners are used; run %q to create one)", "srclib init")})
+	} else if _, err := config.ReadRepository(repo.RootDir); err != nil {
+		rs = append(rs, doctorResult{doctorFail, fmt.Sprintf("invalid %s: %s", file, err), fmt.Sprintf("Run %q for details.", "srclib config lint")})
+	} else {
+		rs = append(rs, doctorResult{Status: doctorOK, Message: fmt.Sprintf("%s is valid", file)})
+	}
+
+	storeDir := filepath.Join(repo.RootDir, buildstore.BuildDataDirName)
+	if _, err := buildstore.LocalRepo(repo.RootDir); err != nil {
+		rs = append(rs, doctorResult{doctorFail, fmt.Sprintf("can't create build data directory: %s", err), fmt.Sprintf("Fix the permissions of %s.", repo.RootDir)})
+	} else if err := checkWritable(storeDir); err != nil {
+		rs = append(rs, doctorResult{doctorFail, fmt.Sprintf("%s is not writable: %s", storeDir, err), fmt.Sprintf("Fix its permissions or remove it (rm -rf %s).", storeDir)})
+	} else {
+		rs = append(rs, doctorResult{Status: doctorOK, Message: fmt.Sprintf("build data directory %s is writable", storeDir)})
+	}
+	return rs
+}
+
+// checkWritable returns an error if a file can't be created in dir.
+func checkWritable(dir string) error {
+	f, err := ioutil.TempFile(dir, ".srclib-doctor")
+	if err != nil {
+		if pe, ok := err.(*os.PathError); ok {
+			return pe.Err
+		}
+		return err
+	}
+	name := f.Name()
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil {
+		return errors.New("can't remove " + name + ": " + err.Error())
+	}
+	return nil
+}
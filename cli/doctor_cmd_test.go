@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+)
+
+func TestDoctorToolchain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-doctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := checkWritable(dir); err != nil {
+		t.Fatalf("checkWritable: %s", err)
+	}
+
+	tc := &toolchain.Info{Path: "example.com/tc", Dir: dir, ConfigFile: toolchain.ConfigFilename}
+	if r := doctorToolchain(tc); r.Status != doctorFail {
+		t.Errorf("with no Srclibtoolchain file: got status %v, want FAIL", r.Status)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, toolchain.ConfigFilename), []byte(`{"Tools": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if r := doctorToolchain(tc); r.Status != doctorFail {
+		t.Errorf("with no program: got status %v, want FAIL", r.Status)
+	}
+
+	tc.Program = "tc"
+	prog := filepath.Join(dir, tc.Program)
+	if err := ioutil.WriteFile(prog, []byte("#!/bin/sh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if r := doctorToolchain(tc); r.Status != doctorFail || r.Fix == "" {
+		t.Errorf("with non-executable program: got %+v, want FAIL with fix", r)
+	}
+
+	if err := os.Chmod(prog, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if r := doctorToolchain(tc); r.Status != doctorOK {
+		t.Errorf("with executable program: got %+v, want ok", r)
+	}
+}
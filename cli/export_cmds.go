@@ -0,0 +1,620 @@
+package cli
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/go-flags"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/parquet"
+	"sourcegraph.com/sourcegraph/srclib/store"
+)
+
+func init() {
+	cliInit = append(cliInit, func(cli *flags.Command) {
+		c, err := cli.AddCommand("export",
+			"export data in a store for use by other tools",
+			"The export subcommands write the data that was imported into a store (by `srclib store import`), or metrics computed from it, in formats that other tools (or people) can consume.",
+			&exportCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+		setLocalStoreRootDefault(c.Group)
+
+		_, err = c.AddCommand("heatmap",
+			"per-file and per-directory def and ref metrics",
+			`Writes the number of defs, refs, and incoming refs of each file and directory in the store, for visualizing which parts of the codebase are most depended upon (e.g., as a treemap whose areas are the def counts and whose colors are the incoming ref counts).
+
+Each row describes a file or a directory (including the root directory, "."), and the metrics of a directory include those of the files and directories under it. Its Parent is the directory that contains it, so the rows form a tree. The metrics are:
+
+  Defs            the number of defs defined in the file or directory
+  Refs            the number of refs in it (not counting refs from defs' own definitions)
+  RefsIn          the number of refs from outside it to the defs in it
+  ExternalRefsIn  the number of refs from other source units (or repositories) to the defs in it
+
+Refs to defs that aren't in the store (e.g., defs in dependencies) are counted in Refs but not attributed to any file.`,
+			&exportHeatmapCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = c.AddCommand("anonymized",
+			"graph data without source-derived contents",
+			`Writes graph data (as JSON) with the contents derived from source code removed, so that it can be shared (e.g., with a toolchain's developers, to debug it) without disclosing the source code. The defs and refs of the current commit in the store are written, or, if files are given, the graph data in those build data files (such as the *.graph.json files in .srclib-cache).
+
+Removed are: the docs (docs in graph data, and defs' Docs), defs' and anns' Data (which often contains type signatures and other source snippets), and defs' Authors. The structure of the data is preserved: the number of defs, refs, docs, and anns, their keys, files, kinds, and byte ranges, and the defs' names. (Names and def paths are usually derived from identifiers in the source code; they are not removed, because the data can't be interpreted without them.)`,
+			&exportAnonymizedCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = c.AddCommand("table",
+			"defs or refs as a CSV or Parquet table",
+			`Writes the defs or refs in the store as a flat table, with one row per def or ref, for ad-hoc analysis with SQL engines and data warehouses (such as DuckDB, BigQuery, or Spark). The table is written as CSV (with a header row) or as a Parquet file.
+
+The columns of the defs table are:
+
+  repo, commit_id, unit_type, unit, path   the def's key
+  tree_path, name, kind, raw_kind
+  file, start, end                         the byte range of the def's definition
+  exported, local, test, generated, visibility, ref_count
+
+The columns of the refs table are:
+
+  repo, commit_id, unit_type, unit         the source unit that contains the ref
+  file, start, end                         the byte range of the ref
+  def                                      whether the ref is the def's own definition
+  def_repo, def_unit_type, def_unit, def_path   the key of the referenced def
+  generated, test
+  candidates                               the number of candidate defs, if the ref is ambiguous
+
+Values that aren't set are empty strings, 0, or false; Parquet columns are not nullable. Def and ref data, docs, and authors are not exported.
+
+For example, to find the most referenced defs with DuckDB:
+
+  srclib export table --what=refs --format=parquet -o refs.parquet
+  duckdb -c "SELECT def_unit, def_path, count(*) AS n FROM 'refs.parquet' WHERE NOT def GROUP BY ALL ORDER BY n DESC LIMIT 20"`,
+			&exportTableCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	})
+}
+
+type ExportCmd struct {
+	StoreCmd
+}
+
+var exportCmd ExportCmd
+
+func (c *ExportCmd) Execute(args []string) error { return nil }
+
+type ExportHeatmapCmd struct {
+	Repo     string `long:"repo" description:"only export files in this repository"`
+	CommitID string `long:"commit" description:"only count defs and refs at this commit (default: the current commit, for a RepoStore)"`
+
+	Format string `long:"format" description:"output format" default:"json" value-name:"json|csv"`
+}
+
+var exportHeatmapCmd ExportHeatmapCmd
+
+func (c *ExportHeatmapCmd) Execute(args []string) error {
+	if c.Format != "json" && c.Format != "csv" {
+		return fmt.Errorf("unknown output format %q (expected json or csv)", c.Format)
+	}
+
+	s, err := exportCmd.store()
+	if err != nil {
+		return err
+	}
+	rs, ok := s.(store.RepoStore)
+	if !ok {
+		return fmt.Errorf("store (type %T) does not implement listing defs and refs", s)
+	}
+
+	commitID := c.CommitID
+	if _, isMulti := s.(store.MultiRepoStore); commitID == "" && !isMulti {
+		repo, err := OpenLocalRepo()
+		if err != nil {
+			return err
+		}
+		commitID = repo.CommitID
+	}
+	var defFilters []store.DefFilter
+	var refFilters []store.RefFilter
+	if c.Repo != "" {
+		defFilters = append(defFilters, store.ByRepos(c.Repo))
+	}
+	if commitID != "" {
+		defFilters = append(defFilters, store.ByCommitIDs(commitID))
+		if c.Repo == "" {
+			refFilters = append(refFilters, store.ByCommitIDs(commitID))
+		} else {
+			// Count refs from other repositories at any commit, but
+			// only refs at commitID from the exported repository.
+			repo := c.Repo
+			refFilters = append(refFilters, store.RefFilterFunc(func(r *graph.Ref) bool {
+				return r.Repo != repo || r.CommitID == commitID
+			}))
+		}
+	}
+
+	defs, err := rs.Defs(defFilters...)
+	if err != nil {
+		return err
+	}
+	refs, err := rs.Refs(refFilters...)
+	if err != nil {
+		return err
+	}
+
+	rows := computeHeatmap(defs, refs)
+	if c.Repo != "" {
+		// Refs from other repositories were only needed to count
+		// incoming refs; don't export those repositories' files.
+		var repoRows []*heatmapRow
+		for _, row := range rows {
+			if row.Repo == c.Repo {
+				repoRows = append(repoRows, row)
+			}
+		}
+		rows = repoRows
+	}
+
+	if c.Format == "csv" {
+		return writeHeatmapCSV(os.Stdout, rows)
+	}
+	PrintJSON(rows, "  ")
+	return nil
+}
+
+// heatmapRow holds the metrics of a file or directory, as computed by
+// computeHeatmap.
+type heatmapRow struct {
+	Repo   string `json:",omitempty"`
+	Path   string // slash-separated, relative to the repository root
+	Parent string `json:",omitempty"` // empty for the root directory
+	Dir    bool
+
+	Defs           int
+	Refs           int // not counting refs from defs' own definitions
+	RefsIn         int // refs from outside this file or directory to defs in it
+	ExternalRefsIn int // refs from other source units or repositories to defs in it
+}
+
+// computeHeatmap computes the metrics of each file that contains defs
+// or refs and of each directory containing such files. The rows are
+// sorted by repository and path (so that each directory precedes its
+// contents).
+func computeHeatmap(defs []*graph.Def, refs []*graph.Ref) []*heatmapRow {
+	type rowKey struct{ repo, path string }
+	rows := map[rowKey]*heatmapRow{}
+
+	// ancestors returns the rows for file and the directories that
+	// contain it (creating them if needed), innermost first.
+	ancestors := func(repo, file string) []*heatmapRow {
+		var rs []*heatmapRow
+		p, dir := path.Clean(file), false
+		for {
+			row := rows[rowKey{repo, p}]
+			if row == nil {
+				row = &heatmapRow{Repo: repo, Path: p, Dir: dir}
+				if p != "." {
+					row.Parent = path.Dir(p)
+				}
+				rows[rowKey{repo, p}] = row
+			}
+			rs = append(rs, row)
+			if p == "." {
+				return rs
+			}
+			p, dir = path.Dir(p), true
+		}
+	}
+
+	defFiles := make(map[graph.DefKey]string, len(defs))
+	for _, d := range defs {
+		defFiles[statsDefKey(d.DefKey)] = d.File
+		if d.File == "" {
+			continue
+		}
+		for _, row := range ancestors(d.Repo, d.File) {
+			row.Defs++
+		}
+	}
+
+	for _, r := range refs {
+		if r.Def {
+			continue
+		}
+		if r.File != "" {
+			for _, row := range ancestors(r.Repo, r.File) {
+				row.Refs++
+			}
+		}
+
+		dk := refDefKey(r)
+		defFile, ok := defFiles[dk]
+		if !ok || defFile == "" {
+			continue
+		}
+		external := dk.Repo != r.Repo || dk.UnitType != r.UnitType || dk.Unit != r.Unit
+		for _, row := range ancestors(dk.Repo, defFile) {
+			if r.Repo != row.Repo || !heatmapContains(row, r.File) {
+				row.RefsIn++
+			}
+			if external {
+				row.ExternalRefsIn++
+			}
+		}
+	}
+
+	sorted := make([]*heatmapRow, 0, len(rows))
+	for _, row := range rows {
+		sorted = append(sorted, row)
+	}
+	sort.Sort(heatmapRowsByPath(sorted))
+	return sorted
+}
+
+// heatmapContains reports whether file is row's file or is in row's
+// directory.
+func heatmapContains(row *heatmapRow, file string) bool {
+	file = path.Clean(file)
+	switch {
+	case !row.Dir:
+		return file == row.Path
+	case row.Path == ".":
+		return true
+	}
+	return strings.HasPrefix(file, row.Path+"/")
+}
+
+// writeHeatmapCSV writes rows as CSV, with a header row.
+func writeHeatmapCSV(w io.Writer, rows []*heatmapRow) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"repo", "path", "parent", "dir", "defs", "refs", "refs_in", "external_refs_in"})
+	for _, row := range rows {
+		cw.Write([]string{
+			row.Repo,
+			row.Path,
+			row.Parent,
+			strconv.FormatBool(row.Dir),
+			strconv.Itoa(row.Defs),
+			strconv.Itoa(row.Refs),
+			strconv.Itoa(row.RefsIn),
+			strconv.Itoa(row.ExternalRefsIn),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+type heatmapRowsByPath []*heatmapRow
+
+func (v heatmapRowsByPath) Len() int      { return len(v) }
+func (v heatmapRowsByPath) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v heatmapRowsByPath) Less(i, j int) bool {
+	if v[i].Repo != v[j].Repo {
+		return v[i].Repo < v[j].Repo
+	}
+	return v[i].Path < v[j].Path
+}
+
+type ExportAnonymizedCmd struct {
+	Repo     string `long:"repo" description:"only export defs and refs in this repository"`
+	CommitID string `long:"commit" description:"only export defs and refs at this commit (default: the current commit, for a RepoStore)"`
+
+	Args struct {
+		Files []string `name:"FILE" description:"graph data files to read instead of the store"`
+	} `positional-args:"yes"`
+}
+
+var exportAnonymizedCmd ExportAnonymizedCmd
+
+func (c *ExportAnonymizedCmd) Execute(args []string) error {
+	var o *graph.Output
+	if len(c.Args.Files) > 0 {
+		if c.Repo != "" || c.CommitID != "" {
+			return fmt.Errorf("--repo and --commit only apply to data in the store, not to graph data files")
+		}
+		o = &graph.Output{}
+		for _, file := range c.Args.Files {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			fo, err := decodeGraphData(data)
+			if err != nil {
+				return fmt.Errorf("%s: %s", file, err)
+			}
+			o.Defs = append(o.Defs, fo.Defs...)
+			o.Refs = append(o.Refs, fo.Refs...)
+			o.Docs = append(o.Docs, fo.Docs...)
+			o.Anns = append(o.Anns, fo.Anns...)
+		}
+	} else {
+		var err error
+		if o, err = c.storeGraphData(); err != nil {
+			return err
+		}
+	}
+
+	PrintJSON(anonymizeGraphData(o), "")
+	return nil
+}
+
+// storeGraphData returns the defs and refs in the store.
+func (c *ExportAnonymizedCmd) storeGraphData() (*graph.Output, error) {
+	rs, defFilters, refFilters, err := exportRepoStore(c.Repo, c.CommitID)
+	if err != nil {
+		return nil, err
+	}
+	defs, err := rs.Defs(defFilters...)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := rs.Refs(refFilters...)
+	if err != nil {
+		return nil, err
+	}
+	return &graph.Output{Defs: defs, Refs: refs}, nil
+}
+
+// exportRepoStore opens the store that is exported from and returns
+// filters for the defs and refs in repo (or all repositories, if
+// empty) at commitID. If commitID is empty and the store holds a
+// single repository, it is the current commit of the local
+// repository.
+func exportRepoStore(repo, commitID string) (store.RepoStore, []store.DefFilter, []store.RefFilter, error) {
+	s, err := exportCmd.store()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	rs, ok := s.(store.RepoStore)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("store (type %T) does not implement listing defs and refs", s)
+	}
+
+	if _, isMulti := s.(store.MultiRepoStore); commitID == "" && !isMulti {
+		localRepo, err := OpenLocalRepo()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		commitID = localRepo.CommitID
+	}
+	var defFilters []store.DefFilter
+	var refFilters []store.RefFilter
+	if repo != "" {
+		defFilters = append(defFilters, store.ByRepos(repo))
+		refFilters = append(refFilters, store.ByRepos(repo))
+	}
+	if commitID != "" {
+		defFilters = append(defFilters, store.ByCommitIDs(commitID))
+		refFilters = append(refFilters, store.ByCommitIDs(commitID))
+	}
+	return rs, defFilters, refFilters, nil
+}
+
+// anonymizeGraphData returns a copy of o without the contents that
+// are derived from source code (docs, def and ann data, and def
+// authors). Everything else, including the number and order of the
+// defs, refs, docs, and anns, is preserved.
+func anonymizeGraphData(o *graph.Output) *graph.Output {
+	o2 := &graph.Output{Refs: o.Refs}
+	for _, def := range o.Defs {
+		def2 := *def
+		def2.Data = nil
+		def2.Docs = nil
+		def2.Authors = nil
+		o2.Defs = append(o2.Defs, &def2)
+	}
+	for _, doc := range o.Docs {
+		doc2 := *doc
+		doc2.Data = ""
+		o2.Docs = append(o2.Docs, &doc2)
+	}
+	for _, a := range o.Anns {
+		a2 := *a
+		a2.Data = nil
+		o2.Anns = append(o2.Anns, &a2)
+	}
+	return o2
+}
+
+type ExportTableCmd struct {
+	What     string `long:"what" description:"what to export" required:"yes" value-name:"defs|refs"`
+	Format   string `long:"format" description:"output format" default:"csv" value-name:"csv|parquet"`
+	Output   string `short:"o" long:"output" description:"write the table to FILE (default: stdout)" value-name:"FILE"`
+	Repo     string `long:"repo" description:"only export defs or refs in this repository"`
+	CommitID string `long:"commit" description:"only export defs or refs at this commit (default: the current commit, for a RepoStore)"`
+}
+
+var exportTableCmd ExportTableCmd
+
+func (c *ExportTableCmd) Execute(args []string) error {
+	if c.What != "defs" && c.What != "refs" {
+		return fmt.Errorf("unknown table %q (expected defs or refs)", c.What)
+	}
+	if c.Format != "csv" && c.Format != "parquet" {
+		return fmt.Errorf("unknown output format %q (expected csv or parquet)", c.Format)
+	}
+
+	rs, defFilters, refFilters, err := exportRepoStore(c.Repo, c.CommitID)
+	if err != nil {
+		return err
+	}
+	var t *exportTable
+	if c.What == "defs" {
+		defs, err := rs.Defs(defFilters...)
+		if err != nil {
+			return err
+		}
+		t = defsTable(defs)
+	} else {
+		refs, err := rs.Refs(refFilters...)
+		if err != nil {
+			return err
+		}
+		t = refsTable(refs)
+	}
+
+	if c.Output == "" {
+		return t.write(os.Stdout, c.Format)
+	}
+	f, err := os.Create(c.Output)
+	if err != nil {
+		return err
+	}
+	if err := t.write(f, c.Format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// An exportTable is a table of defs or refs (see ExportTableCmd). Each
+// value is a string, int64, or bool, according to its column's type.
+type exportTable struct {
+	columns []parquet.Column
+	rows    [][]interface{}
+}
+
+var defsTableColumns = []parquet.Column{
+	{Name: "repo", Type: parquet.String},
+	{Name: "commit_id", Type: parquet.String},
+	{Name: "unit_type", Type: parquet.String},
+	{Name: "unit", Type: parquet.String},
+	{Name: "path", Type: parquet.String},
+	{Name: "tree_path", Type: parquet.String},
+	{Name: "name", Type: parquet.String},
+	{Name: "kind", Type: parquet.String},
+	{Name: "raw_kind", Type: parquet.String},
+	{Name: "file", Type: parquet.String},
+	{Name: "start", Type: parquet.Int64},
+	{Name: "end", Type: parquet.Int64},
+	{Name: "exported", Type: parquet.Boolean},
+	{Name: "local", Type: parquet.Boolean},
+	{Name: "test", Type: parquet.Boolean},
+	{Name: "generated", Type: parquet.Boolean},
+	{Name: "visibility", Type: parquet.String},
+	{Name: "ref_count", Type: parquet.Int64},
+}
+
+// defsTable returns the table of defs.
+func defsTable(defs []*graph.Def) *exportTable {
+	t := &exportTable{columns: defsTableColumns, rows: make([][]interface{}, len(defs))}
+	for i, d := range defs {
+		t.rows[i] = []interface{}{
+			d.Repo, d.CommitID, d.UnitType, d.Unit, d.Path,
+			d.TreePath, d.Name, d.Kind, d.RawKind,
+			d.File, int64(d.DefStart), int64(d.DefEnd),
+			d.Exported, d.Local, d.Test, d.Generated, d.Visibility, int64(d.RefCount),
+		}
+	}
+	return t
+}
+
+var refsTableColumns = []parquet.Column{
+	{Name: "repo", Type: parquet.String},
+	{Name: "commit_id", Type: parquet.String},
+	{Name: "unit_type", Type: parquet.String},
+	{Name: "unit", Type: parquet.String},
+	{Name: "file", Type: parquet.String},
+	{Name: "start", Type: parquet.Int64},
+	{Name: "end", Type: parquet.Int64},
+	{Name: "def", Type: parquet.Boolean},
+	{Name: "def_repo", Type: parquet.String},
+	{Name: "def_unit_type", Type: parquet.String},
+	{Name: "def_unit", Type: parquet.String},
+	{Name: "def_path", Type: parquet.String},
+	{Name: "generated", Type: parquet.Boolean},
+	{Name: "test", Type: parquet.Boolean},
+	{Name: "candidates", Type: parquet.Int64},
+}
+
+// refsTable returns the table of refs. The def key columns are those
+// of the def that each ref refers to, with the implied repository,
+// unit type, and unit (those of the ref) filled in.
+func refsTable(refs []*graph.Ref) *exportTable {
+	t := &exportTable{columns: refsTableColumns, rows: make([][]interface{}, len(refs))}
+	for i, r := range refs {
+		dk := r.DefKey()
+		if dk.Repo == "" {
+			dk.Repo = r.Repo
+		}
+		if dk.UnitType == "" {
+			dk.UnitType = r.UnitType
+		}
+		if dk.Unit == "" {
+			dk.Unit = r.Unit
+		}
+		t.rows[i] = []interface{}{
+			r.Repo, r.CommitID, r.UnitType, r.Unit,
+			r.File, int64(r.Start), int64(r.End), r.Def,
+			dk.Repo, dk.UnitType, dk.Unit, dk.Path,
+			r.Generated, r.Test, int64(len(r.Candidates)),
+		}
+	}
+	return t
+}
+
+// write writes t in format ("csv" or "parquet").
+func (t *exportTable) write(w io.Writer, format string) error {
+	if format == "parquet" {
+		return t.writeParquet(w)
+	}
+	return t.writeCSV(w)
+}
+
+// writeCSV writes t as CSV, with a header row.
+func (t *exportTable) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	record := make([]string, len(t.columns))
+	for i, col := range t.columns {
+		record[i] = col.Name
+	}
+	cw.Write(record)
+	for _, row := range t.rows {
+		for i, v := range row {
+			switch v := v.(type) {
+			case string:
+				record[i] = v
+			case int64:
+				record[i] = strconv.FormatInt(v, 10)
+			case bool:
+				record[i] = strconv.FormatBool(v)
+			}
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeParquet writes t as a Parquet file.
+func (t *exportTable) writeParquet(w io.Writer) error {
+	pw, err := parquet.NewWriter(w, t.columns)
+	if err != nil {
+		return err
+	}
+	for _, row := range t.rows {
+		if err := pw.Write(row...); err != nil {
+			return err
+		}
+	}
+	return pw.Close()
+}
@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/ann"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestComputeHeatmap(t *testing.T) {
+	def := func(unit, path, file string) *graph.Def {
+		return &graph.Def{DefKey: graph.DefKey{UnitType: "t", Unit: unit, Path: path, CommitID: "c"}, File: file}
+	}
+	ref := func(unit, file, defUnit, defPath string) *graph.Ref {
+		return &graph.Ref{UnitType: "t", Unit: unit, File: file, DefUnitType: "t", DefUnit: defUnit, DefPath: defPath, CommitID: "c"}
+	}
+	defs := []*graph.Def{
+		def("a", "A", "a/a.go"),
+		def("a", "A2", "a/a2.go"),
+		def("b", "B", "b/b.go"),
+	}
+	refs := []*graph.Ref{
+		{UnitType: "t", Unit: "a", File: "a/a.go", DefUnitType: "t", DefUnit: "a", DefPath: "A", Def: true},
+		ref("a", "a/a2.go", "a", "A"),
+		ref("b", "b/b.go", "a", "A"),
+		ref("b", "b/b.go", "ext", "X"),
+	}
+
+	got := map[string]heatmapRow{}
+	var paths []string
+	for _, row := range computeHeatmap(defs, refs) {
+		got[row.Path] = *row
+		paths = append(paths, row.Path)
+	}
+	if want := ".,a,a/a.go,a/a2.go,b,b/b.go"; strings.Join(paths, ",") != want {
+		t.Errorf("got paths %v, want %s", paths, want)
+	}
+
+	want := []heatmapRow{
+		{Path: ".", Dir: true, Defs: 3, Refs: 3, RefsIn: 0, ExternalRefsIn: 1},
+		{Path: "a", Parent: ".", Dir: true, Defs: 2, Refs: 1, RefsIn: 1, ExternalRefsIn: 1},
+		{Path: "a/a.go", Parent: "a", Defs: 1, RefsIn: 2, ExternalRefsIn: 1},
+		{Path: "a/a2.go", Parent: "a", Defs: 1, Refs: 1},
+		{Path: "b", Parent: ".", Dir: true, Defs: 1, Refs: 2},
+		{Path: "b/b.go", Parent: "b", Defs: 1, Refs: 2},
+	}
+	for _, w := range want {
+		if got[w.Path] != w {
+			t.Errorf("%s: got %+v, want %+v", w.Path, got[w.Path], w)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writeHeatmapCSV(&buf, []*heatmapRow{{Path: "a", Parent: ".", Dir: true, Defs: 2, Refs: 1, RefsIn: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "repo,path,parent,dir,defs,refs,refs_in,external_refs_in\n,a,.,true,2,1,1,0\n"; buf.String() != want {
+		t.Errorf("got CSV %q, want %q", buf.String(), want)
+	}
+}
+
+func TestAnonymizeGraphData(t *testing.T) {
+	o := &graph.Output{
+		Defs: []*graph.Def{{
+			DefKey:   graph.DefKey{Unit: "u", Path: "A"},
+			Name:     "A",
+			File:     "a.go",
+			DefStart: 1,
+			DefEnd:   9,
+			Data:     []byte(`{"TypeString":"func A(secret int)"}`),
+			Docs:     []*graph.DefDoc{{Format: "text/plain", Data: "A does secret things."}},
+			Authors:  []*graph.DefAuthor{{Email: "alice@example.com"}},
+		}},
+		Refs: []*graph.Ref{{DefUnit: "u", DefPath: "A", File: "b.go", Start: 3, End: 4}},
+		Docs: []*graph.Doc{{DefKey: graph.DefKey{Path: "A"}, Format: "text/plain", Data: "A does secret things.", File: "a.go", Start: 0, End: 20}},
+		Anns: []*ann.Ann{{File: "a.go", StartLine: 1, EndLine: 1, Type: "link", Data: []byte(`{"URL":"https://internal.example.com"}`)}},
+	}
+	want := &graph.Output{
+		Defs: []*graph.Def{{DefKey: graph.DefKey{Unit: "u", Path: "A"}, Name: "A", File: "a.go", DefStart: 1, DefEnd: 9}},
+		Refs: o.Refs,
+		Docs: []*graph.Doc{{DefKey: graph.DefKey{Path: "A"}, Format: "text/plain", File: "a.go", Start: 0, End: 20}},
+		Anns: []*ann.Ann{{File: "a.go", StartLine: 1, EndLine: 1, Type: "link"}},
+	}
+	if got := anonymizeGraphData(o); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if o.Defs[0].Data == nil || o.Docs[0].Data == "" {
+		t.Error("anonymizeGraphData modified its input")
+	}
+}
+
+func TestExportTable(t *testing.T) {
+	refs := []*graph.Ref{
+		{Repo: "r", CommitID: "c", UnitType: "t", Unit: "u", DefPath: "A", File: "a.go", Start: 1, End: 2},
+		{Repo: "r", CommitID: "c", UnitType: "t", Unit: "u", DefRepo: "r2", DefUnitType: "t", DefUnit: "u2", DefPath: "B,\"C\"", File: "a.go", Start: 3, End: 4, Candidates: []*graph.RefCandidate{{DefPath: "B"}, {DefPath: "C"}}},
+	}
+	var buf bytes.Buffer
+	if err := refsTable(refs).write(&buf, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	want := `repo,commit_id,unit_type,unit,file,start,end,def,def_repo,def_unit_type,def_unit,def_path,generated,test,candidates
+r,c,t,u,a.go,1,2,false,r,t,u,A,false,false,0
+r,c,t,u,a.go,3,4,false,r2,t,u2,"B,""C""",false,false,2
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got CSV\n%s\nwant\n%s", got, want)
+	}
+
+	// Each row must have a value of the right type for each column
+	// for the table to be written as Parquet.
+	defs := []*graph.Def{{DefKey: graph.DefKey{Repo: "r", Path: "A"}, Name: "A", DefStart: 1, DefEnd: 9, Exported: true}}
+	buf.Reset()
+	if err := defsTable(defs).write(&buf, "parquet"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "PAR1") {
+		t.Errorf("got %q, want a Parquet file", buf.String())
+	}
+	buf.Reset()
+	if err := refsTable(refs).write(&buf, "parquet"); err != nil {
+		t.Fatal(err)
+	}
+}
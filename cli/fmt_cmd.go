@@ -0,0 +1,361 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/alexsaveliev/go-colorable-wrapper"
+
+	"sourcegraph.com/sourcegraph/go-flags"
+
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func init() {
+	cliInit = append(cliInit, func(cli *flags.Command) {
+		_, err := cli.AddCommand("fmt",
+			"pretty-print build data files",
+			`Pretty-prints build data files (such as the *.graph.json and *.unit.json files in .srclib-cache). If no files are given (or FILE is "-"), the data is read from stdin.
+
+Graph data (in JSON or protobuf format) can be filtered: --defs, --refs, --docs, and --anns select which of its sections are printed (all of them, by default), and --file selects the defs, refs, docs, and anns in the given source files. With --summary, counts are printed instead of the data itself.
+
+The type of data in a file is determined by its name (e.g., "*.graph.json"). For stdin or other files, use --type, or else the data is treated as graph data if it looks like it.`,
+			&fmtCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	})
+}
+
+type FmtCmd struct {
+	Type string `long:"type" description:"build data type of the input (e.g., graph, unit, depresolve)" value-name:"TYPE"`
+
+	Defs  bool     `long:"defs" description:"print the defs in graph data"`
+	Refs  bool     `long:"refs" description:"print the refs in graph data"`
+	Docs  bool     `long:"docs" description:"print the docs in graph data"`
+	Anns  bool     `long:"anns" description:"print the anns in graph data"`
+	Files []string `long:"file" description:"only print graph data in this source file (repeatable)" value-name:"PATH"`
+
+	Summary bool `long:"summary" description:"print a summary (counts) instead of the data"`
+
+	Args struct {
+		Files []string `name:"FILE" description:"build data files"`
+	} `positional-args:"yes"`
+}
+
+var fmtCmd FmtCmd
+
+func (c *FmtCmd) Execute(args []string) error {
+	files := c.Args.Files
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	for i, file := range files {
+		if len(files) > 1 {
+			if i > 0 {
+				fmt.Println()
+			}
+			colorable.Println(colorable.Cyan("# " + file))
+		}
+		if err := c.fmtFile(file); err != nil {
+			return fmt.Errorf("%s: %s", file, err)
+		}
+	}
+	return nil
+}
+
+// graphFilter selects parts of graph data.
+type graphFilter struct {
+	Defs, Refs, Docs, Anns bool // sections to keep (all if none is set)
+	Files                  []string
+}
+
+func (c *FmtCmd) filter() graphFilter {
+	return graphFilter{Defs: c.Defs, Refs: c.Refs, Docs: c.Docs, Anns: c.Anns, Files: c.Files}
+}
+
+func (f graphFilter) isZero() bool {
+	return !f.Defs && !f.Refs && !f.Docs && !f.Anns && len(f.Files) == 0
+}
+
+func (c *FmtCmd) fmtFile(file string) error {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		return err
+	}
+
+	typeName := c.Type
+	if typeName == "" && file != "-" {
+		typeName, _ = buildstore.DataType(filepath.Base(file))
+	}
+	if typeName == "" && looksLikeGraphData(data) {
+		typeName = "graph"
+	}
+	if typeName != "graph" {
+		if !c.filter().isZero() {
+			return fmt.Errorf("--defs, --refs, --docs, --anns, and --file only apply to graph data (got %s data)", fmtTypeName(typeName))
+		}
+		return fmtOtherData(typeName, data, c.Summary)
+	}
+
+	o, err := decodeGraphData(data)
+	if err != nil {
+		return err
+	}
+	o = filterGraphData(o, c.filter())
+	if c.Summary {
+		printGraphSummary(summarizeGraphData(o))
+		return nil
+	}
+	PrintJSON(o, "")
+	return nil
+}
+
+func fmtTypeName(typeName string) string {
+	if typeName == "" {
+		return "unknown"
+	}
+	return typeName
+}
+
+// looksLikeGraphData reports whether data is protobuf-encoded or is a
+// JSON object with any of the keys of graph.Output.
+func looksLikeGraphData(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return false
+	}
+	if data[0] != '{' {
+		return data[0] != '['
+	}
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return false
+	}
+	for _, k := range []string{"Defs", "Refs", "Docs", "Anns"} {
+		if _, present := keys[k]; present {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeGraphData decodes JSON or protobuf graph data.
+func decodeGraphData(data []byte) (*graph.Output, error) {
+	var o graph.Output
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, &o); err != nil {
+			return nil, err
+		}
+		return &o, nil
+	}
+	if err := o.Unmarshal(data); err != nil {
+		return nil, fmt.Errorf("decoding protobuf graph data: %s", err)
+	}
+	return &o, nil
+}
+
+// filterGraphData returns the parts of o selected by f.
+func filterGraphData(o *graph.Output, f graphFilter) *graph.Output {
+	all := !f.Defs && !f.Refs && !f.Docs && !f.Anns
+	inFiles := func(file string) bool {
+		if len(f.Files) == 0 {
+			return true
+		}
+		for _, f := range f.Files {
+			if filepath.ToSlash(filepath.Clean(f)) == filepath.ToSlash(filepath.Clean(file)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var o2 graph.Output
+	if all || f.Defs {
+		for _, def := range o.Defs {
+			if inFiles(def.File) {
+				o2.Defs = append(o2.Defs, def)
+			}
+		}
+	}
+	if all || f.Refs {
+		for _, ref := range o.Refs {
+			if inFiles(ref.File) {
+				o2.Refs = append(o2.Refs, ref)
+			}
+		}
+	}
+	if all || f.Docs {
+		for _, doc := range o.Docs {
+			if inFiles(doc.File) {
+				o2.Docs = append(o2.Docs, doc)
+			}
+		}
+	}
+	if all || f.Anns {
+		for _, a := range o.Anns {
+			if inFiles(a.File) {
+				o2.Anns = append(o2.Anns, a)
+			}
+		}
+	}
+	return &o2
+}
+
+// graphSummary summarizes graph data.
+type graphSummary struct {
+	Defs, Refs, Docs, Anns int
+
+	DefKinds map[string]int // number of defs of each kind
+	AnnTypes map[string]int // number of anns of each type
+	Files    []*fileSummary
+
+	// UnresolvedRefs is the number of refs to defs in unresolved
+	// repositories.
+	UnresolvedRefs int
+}
+
+// fileSummary counts the graph data in a source file.
+type fileSummary struct {
+	File                   string
+	Defs, Refs, Docs, Anns int
+}
+
+func summarizeGraphData(o *graph.Output) *graphSummary {
+	s := &graphSummary{
+		Defs:     len(o.Defs),
+		Refs:     len(o.Refs),
+		Docs:     len(o.Docs),
+		Anns:     len(o.Anns),
+		DefKinds: map[string]int{},
+		AnnTypes: map[string]int{},
+	}
+	files := map[string]*fileSummary{}
+	file := func(name string) *fileSummary {
+		fs, present := files[name]
+		if !present {
+			fs = &fileSummary{File: name}
+			files[name] = fs
+			s.Files = append(s.Files, fs)
+		}
+		return fs
+	}
+	for _, def := range o.Defs {
+		s.DefKinds[def.Kind]++
+		file(def.File).Defs++
+	}
+	for _, ref := range o.Refs {
+		if ref.DefRepo == unit.UnitRepoUnresolved {
+			s.UnresolvedRefs++
+		}
+		file(ref.File).Refs++
+	}
+	for _, doc := range o.Docs {
+		file(doc.File).Docs++
+	}
+	for _, a := range o.Anns {
+		s.AnnTypes[a.Type]++
+		file(a.File).Anns++
+	}
+	sort.Sort(fileSummariesByName(s.Files))
+	return s
+}
+
+type fileSummariesByName []*fileSummary
+
+func (v fileSummariesByName) Len() int           { return len(v) }
+func (v fileSummariesByName) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v fileSummariesByName) Less(i, j int) bool { return v[i].File < v[j].File }
+
+func printGraphSummary(s *graphSummary) {
+	colorable.Printf("%d defs, %d refs (%d unresolved), %d docs, %d anns\n", s.Defs, s.Refs, s.UnresolvedRefs, s.Docs, s.Anns)
+	printCounts := func(title string, counts map[string]int) {
+		if len(counts) == 0 {
+			return
+		}
+		keys := make([]string, 0, len(counts))
+		for k := range counts {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		colorable.Println()
+		colorable.Println(colorable.Cyan(title))
+		for _, k := range keys {
+			if k == "" {
+				colorable.Printf("  %-20s  %6d\n", "(none)", counts[k])
+			} else {
+				colorable.Printf("  %-20s  %6d\n", k, counts[k])
+			}
+		}
+	}
+	printCounts("Def kinds", s.DefKinds)
+	printCounts("Ann types", s.AnnTypes)
+
+	if len(s.Files) > 0 {
+		colorable.Println()
+		colorable.Println(colorable.Cyan("Files"))
+		fmtStr := "  %-50s  %6s  %6s  %6s  %6s\n"
+		colorable.Printf(fmtStr, "FILE", "DEFS", "REFS", "DOCS", "ANNS")
+		for _, f := range s.Files {
+			name := f.File
+			if name == "" {
+				name = "(none)"
+			}
+			colorable.Printf(fmtStr, name, fmt.Sprint(f.Defs), fmt.Sprint(f.Refs), fmt.Sprint(f.Docs), fmt.Sprint(f.Anns))
+		}
+	}
+}
+
+// fmtOtherData pretty-prints (or, if summary is set, summarizes)
+// build data that isn't graph data.
+func fmtOtherData(typeName string, data []byte, summary bool) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("decoding %s data: %s", fmtTypeName(typeName), err)
+	}
+	if !summary {
+		PrintJSON(v, "")
+		return nil
+	}
+
+	colorable.Printf("%s data: ", fmtTypeName(typeName))
+	switch v := v.(type) {
+	case []interface{}:
+		colorable.Printf("array of %d elements\n", len(v))
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		colorable.Printf("object with %d keys\n", len(v))
+		for _, k := range keys {
+			switch e := v[k].(type) {
+			case []interface{}:
+				colorable.Printf("  %-20s  %d elements\n", k, len(e))
+			case map[string]interface{}:
+				colorable.Printf("  %-20s  %d keys\n", k, len(e))
+			default:
+				colorable.Printf("  %-20s  %v\n", k, e)
+			}
+		}
+	default:
+		colorable.Printf("%v\n", v)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/ann"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestFilterGraphData(t *testing.T) {
+	o := &graph.Output{
+		Defs: []*graph.Def{{DefKey: graph.DefKey{Path: "A"}, File: "a.go"}, {DefKey: graph.DefKey{Path: "B"}, File: "b.go"}},
+		Refs: []*graph.Ref{{DefPath: "A", File: "b.go"}, {DefPath: "B", File: "./a.go"}},
+		Docs: []*graph.Doc{{DefKey: graph.DefKey{Path: "A"}, File: "a.go"}},
+		Anns: []*ann.Ann{{File: "a.go", Type: "t"}},
+	}
+
+	if got := filterGraphData(o, graphFilter{}); !reflect.DeepEqual(got, o) {
+		t.Errorf("got %+v with no filter, want all data", got)
+	}
+
+	got := filterGraphData(o, graphFilter{Refs: true})
+	if len(got.Defs) != 0 || len(got.Docs) != 0 || len(got.Anns) != 0 || len(got.Refs) != 2 {
+		t.Errorf("got %+v with --refs, want only refs", got)
+	}
+
+	got = filterGraphData(o, graphFilter{Defs: true, Refs: true, Files: []string{"a.go"}})
+	if len(got.Defs) != 1 || got.Defs[0].Path != "A" || len(got.Refs) != 1 || got.Refs[0].DefPath != "B" || len(got.Docs) != 0 {
+		t.Errorf("got %+v with --defs --refs --file=a.go, want def A and ref to B", got)
+	}
+}
+
+func TestSummarizeGraphData(t *testing.T) {
+	o := &graph.Output{
+		Defs: []*graph.Def{{File: "b.go", Kind: "func"}, {File: "a.go", Kind: "func"}, {File: "a.go", Kind: "type"}},
+		Refs: []*graph.Ref{{File: "a.go", DefRepo: "?"}, {File: "a.go"}},
+		Anns: []*ann.Ann{{File: "b.go", Type: "link"}},
+	}
+	want := &graphSummary{
+		Defs:           3,
+		Refs:           2,
+		Anns:           1,
+		DefKinds:       map[string]int{"func": 2, "type": 1},
+		AnnTypes:       map[string]int{"link": 1},
+		Files:          []*fileSummary{{File: "a.go", Defs: 2, Refs: 2}, {File: "b.go", Defs: 1, Anns: 1}},
+		UnresolvedRefs: 1,
+	}
+	if got := summarizeGraphData(o); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeGraphData(t *testing.T) {
+	o := &graph.Output{Refs: []*graph.Ref{{DefPath: "A", File: "a.go", Start: 1, End: 2}}}
+	pb, err := o.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for label, data := range map[string][]byte{
+		"json":     []byte(` {"Refs": [{"DefPath": "A", "File": "a.go", "Start": 1, "End": 2}]}`),
+		"protobuf": pb,
+	} {
+		if !looksLikeGraphData(data) {
+			t.Errorf("%s: got looksLikeGraphData false, want true", label)
+		}
+		got, err := decodeGraphData(data)
+		if err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, o) {
+			t.Errorf("%s: got %+v, want %+v", label, got, o)
+		}
+	}
+
+	if looksLikeGraphData([]byte(`{"key": {"Name": "x"}}`)) {
+		t.Error("got looksLikeGraphData true for unit data, want false")
+	}
+}
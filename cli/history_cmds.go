@@ -0,0 +1,215 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"sourcegraph.com/sourcegraph/go-flags"
+	"sourcegraph.com/sourcegraph/rwvfs"
+
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/defhistory"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/vcs"
+)
+
+func init() {
+	cliInit = append(cliInit, func(cli *flags.Command) {
+		c, err := cli.AddCommand("history",
+			"track defs across commits",
+			`The history subcommands track the identity of defs across the commits of the current repository, even as they move to different files or def paths, and show when each def appeared, moved, or was deleted.
+
+The history is built from the build data of each commit (see "srclib make --commits") and is stored in the repository's build data directory.`,
+			&struct{}{},
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = c.AddCommand("update",
+			"add commits to the def history",
+			"The update command adds the commits in a range (oldest first) to the def history. Commits that are already in the history, or that have not been built, are skipped. Defs in files that were renamed since the previously added commit are matched with their defs at that commit as if the files hadn't moved.",
+			&historyUpdateCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = c.AddCommand("def",
+			"show the history of a def",
+			"The def command shows the commits at which a def (identified by its key at any commit in the history) appeared, moved, or was deleted.",
+			&historyDefCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	})
+}
+
+// openDefHistoryFS returns the filesystem (the root of the local
+// repository's build data directory) that stores its def history.
+func openDefHistoryFS() (rwvfs.FileSystem, error) {
+	repo, err := OpenRepo(".")
+	if err != nil {
+		return nil, err
+	}
+	return rwvfs.OS(filepath.Join(repo.RootDir, buildstore.BuildDataDirName)), nil
+}
+
+type HistoryUpdateCmd struct {
+	Commits string `long:"commits" description:"range of commits to add, oldest first" value-name:"A..B" required:"yes"`
+}
+
+var historyUpdateCmd HistoryUpdateCmd
+
+func (c *HistoryUpdateCmd) Execute(args []string) error {
+	base, head, err := parseCommitRange(c.Commits)
+	if err != nil {
+		return err
+	}
+	repo, err := OpenRepo(".")
+	if err != nil {
+		return err
+	}
+	commits, err := repo.VCS.Commits(repo.RootDir, base, head)
+	if err != nil {
+		return err
+	}
+	bs, err := buildstore.LocalRepo(repo.RootDir)
+	if err != nil {
+		return err
+	}
+
+	fs, err := openDefHistoryFS()
+	if err != nil {
+		return err
+	}
+	h, err := defhistory.Read(fs)
+	if err != nil {
+		return err
+	}
+	added := map[string]struct{}{}
+	for _, commitID := range h.Commits {
+		added[commitID] = struct{}{}
+	}
+
+	var prevCommit string
+	if len(h.Commits) > 0 {
+		prevCommit = h.Commits[len(h.Commits)-1]
+	}
+	var n int
+	for _, commitID := range commits {
+		if _, ok := added[commitID]; ok {
+			continue
+		}
+		if exists, err := buildstore.BuildDataExistsForCommit(bs, commitID); err != nil {
+			return err
+		} else if !exists {
+			log.Printf("Skipping commit %s, which has not been built.", commitID)
+			continue
+		}
+		defs, err := readBuildDataDefs(commitID)
+		if err != nil {
+			return err
+		}
+		var renames map[string]string
+		if prevCommit != "" {
+			if renames, err = commitRenames(repo, bs, prevCommit, commitID); err != nil {
+				return err
+			}
+		}
+		if err := h.AddRenamed(commitID, defs, renames); err != nil {
+			return err
+		}
+		prevCommit = commitID
+		n++
+	}
+	if err := defhistory.Write(fs, h); err != nil {
+		return err
+	}
+	log.Printf("Added %d commits to the def history (%d commits, %d defs).", n, len(h.Commits), len(h.Lineages))
+	return nil
+}
+
+// commitRenames returns a map from the old path to the new path of
+// each file that was renamed between commits from and to. It uses the
+// renames recorded in to's build data (by "srclib make --commits"), if
+// they were recorded since from, and otherwise asks the VCS.
+func commitRenames(repo *Repo, bs buildstore.RepoBuildStore, from, to string) (map[string]string, error) {
+	r, err := buildstore.ReadRenames(bs.Commit(to))
+	if err == nil && r.Base == from {
+		return r.Map(), nil
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	files, err := repo.VCS.Renames(repo.RootDir, from, to)
+	if err == vcs.ErrNoHistory {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return (&buildstore.Renames{Base: from, Files: files}).Map(), nil
+}
+
+type HistoryDefCmd struct {
+	UnitType string `long:"unit-type" description:"def's source unit type (e.g., GoPackage)"`
+	Unit     string `long:"unit" description:"def's source unit name (e.g., net/http)"`
+	Format   string `long:"format" description:"output format" default:"table" value-name:"table|json"`
+	Args     struct {
+		Path string `name:"PATH" description:"def path (e.g., Client/Do)"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var historyDefCmd HistoryDefCmd
+
+func (c *HistoryDefCmd) Execute(args []string) error {
+	fs, err := openDefHistoryFS()
+	if err != nil {
+		return err
+	}
+	h, err := defhistory.Read(fs)
+	if err != nil {
+		return err
+	}
+	if len(h.Commits) == 0 {
+		return fmt.Errorf("the def history is empty (run 'srclib history update' to add commits)")
+	}
+
+	ls := h.Lookup(graph.DefKey{UnitType: c.UnitType, Unit: c.Unit, Path: c.Args.Path})
+	if len(ls) == 0 {
+		return fmt.Errorf("no def with path %q in the def history", c.Args.Path)
+	}
+
+	switch c.Format {
+	case "json":
+		PrintJSON(ls, "  ")
+	case "table":
+		for i, l := range ls {
+			if i > 0 {
+				fmt.Println()
+			}
+			for _, e := range l.Events {
+				commit := e.CommitID
+				if len(commit) > 7 {
+					commit = commit[:7]
+				}
+				fmt.Printf("%-7s  %-8s  %s\n", commit, e.Type, historyEventLabel(e))
+			}
+		}
+	default:
+		return fmt.Errorf("unknown output format %q (expected table or json)", c.Format)
+	}
+	return nil
+}
+
+// historyEventLabel describes the def's key and file after (and, for
+// moves, before) the event.
+func historyEventLabel(e *defhistory.Event) string {
+	s := fmt.Sprintf("%s %s (%s)", e.Key.Unit, e.Key.Path, e.File)
+	if e.From != nil {
+		s = fmt.Sprintf("%s %s (%s) -> %s", e.From.Unit, e.From.Path, e.FromFile, s)
+	}
+	return s
+}
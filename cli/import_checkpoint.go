@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// importCheckpointFile is the name of the file (in a commit's build
+// data directory) in which Import records its progress.
+const importCheckpointFile = "store-import-checkpoint.json"
+
+// importCheckpoint records the source units that an import has
+// finished importing, so that an interrupted import can be resumed
+// (with ImportOpt's Resume) without importing them again.
+type importCheckpoint struct {
+	// Store, Repo, CommitID, Unit, UnitType, Downsample, and
+	// NormalizeDefData identify the import (see ImportOpt). A
+	// checkpoint can only be resumed by an import with the same values.
+	Store            string `json:",omitempty"`
+	Repo             string `json:",omitempty"`
+	CommitID         string `json:",omitempty"`
+	Unit             string `json:",omitempty"`
+	UnitType         string `json:",omitempty"`
+	Downsample       bool   `json:",omitempty"`
+	NormalizeDefData bool   `json:",omitempty"`
+
+	// Units lists the source units that have been imported.
+	Units []unit.ID2
+
+	// HasData is whether any of the Units had graph data (and so the
+	// store needs to be indexed when the import finishes).
+	HasData bool `json:",omitempty"`
+}
+
+func newImportCheckpoint(opt ImportOpt) *importCheckpoint {
+	return &importCheckpoint{Store: opt.Store, Repo: opt.Repo, CommitID: opt.CommitID, Unit: opt.Unit, UnitType: opt.UnitType, Downsample: opt.Downsample, NormalizeDefData: opt.NormalizeDefData}
+}
+
+// matches reports whether c is a checkpoint of the import with the
+// given options.
+func (c *importCheckpoint) matches(opt ImportOpt) bool {
+	o := newImportCheckpoint(opt)
+	return c.Store == o.Store && c.Repo == o.Repo && c.CommitID == o.CommitID && c.Unit == o.Unit && c.UnitType == o.UnitType && c.Downsample == o.Downsample && c.NormalizeDefData == o.NormalizeDefData
+}
+
+// done returns the set of units that c lists as imported.
+func (c *importCheckpoint) done() map[unit.ID2]struct{} {
+	done := make(map[unit.ID2]struct{}, len(c.Units))
+	for _, u := range c.Units {
+		done[u] = struct{}{}
+	}
+	return done
+}
+
+// readImportCheckpoint reads the import checkpoint in fs. If there is
+// none, it returns nil and no error.
+func readImportCheckpoint(fs rwvfs.FileSystem) (*importCheckpoint, error) {
+	var c importCheckpoint
+	if err := readJSONFileFS(fs, importCheckpointFile, &c); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading import checkpoint %s (rerun the import without --resume to start over): %s", importCheckpointFile, err)
+	}
+	return &c, nil
+}
+
+// writeImportCheckpoint writes c to fs, replacing any existing import
+// checkpoint.
+func writeImportCheckpoint(fs rwvfs.FileSystem, c *importCheckpoint) (err error) {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := fs.Create(importCheckpointFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := f.Close()
+		if err == nil {
+			err = err2
+		}
+	}()
+	_, err = f.Write(data)
+	return err
+}
+
+// removeImportCheckpoint removes the import checkpoint in fs, if any.
+func removeImportCheckpoint(fs rwvfs.FileSystem) error {
+	if err := fs.Remove(importCheckpointFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
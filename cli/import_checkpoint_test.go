@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestImportCheckpoint(t *testing.T) {
+	fs := rwvfs.Map(map[string]string{})
+
+	if c, err := readImportCheckpoint(fs); err != nil || c != nil {
+		t.Fatalf("got checkpoint %+v and error %v, want none", c, err)
+	}
+
+	opt := ImportOpt{Store: "RepoStore:/s", Repo: "r", CommitID: "c"}
+	c := newImportCheckpoint(opt)
+	c.Units = []unit.ID2{{Type: "t", Name: "a"}, {Type: "t", Name: "b"}}
+	c.HasData = true
+	if err := writeImportCheckpoint(fs, c); err != nil {
+		t.Fatal(err)
+	}
+
+	c2, err := readImportCheckpoint(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c2, c) {
+		t.Errorf("got checkpoint %+v, want %+v", c2, c)
+	}
+	if !c2.matches(opt) {
+		t.Errorf("checkpoint doesn't match the import that wrote it")
+	}
+	if other := (ImportOpt{Store: "RepoStore:/other", Repo: "r", CommitID: "c"}); c2.matches(other) {
+		t.Errorf("checkpoint matches an import into another store")
+	}
+	if _, done := c2.done()[unit.ID2{Type: "t", Name: "b"}]; !done {
+		t.Errorf("unit t b isn't done")
+	}
+
+	if err := removeImportCheckpoint(fs); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := readImportCheckpoint(fs); err != nil || c != nil {
+		t.Errorf("got checkpoint %+v and error %v after removing it, want none", c, err)
+	}
+	if err := removeImportCheckpoint(fs); err != nil {
+		t.Errorf("removing a nonexistent checkpoint: %s", err)
+	}
+}
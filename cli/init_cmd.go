@@ -0,0 +1,275 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alexsaveliev/go-colorable-wrapper"
+
+	"sourcegraph.com/sourcegraph/go-flags"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/scan"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func init() {
+	cliInit = append(cliInit, func(cli *flags.Command) {
+		_, err := cli.AddCommand("init",
+			"create a Srcfile for the current repository",
+			`Scans the current repository with all available scanners, asks which of the detected toolchains (and the languages and source units they found) to enable, and writes a commented Srcfile to the repository's root directory.
+
+Directories listed in the repository's top-level .gitignore are added to the Srcfile's SkipDirs.`,
+			&initCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	})
+}
+
+type InitCmd struct {
+	Yes   bool `short:"y" long:"yes" description:"enable all detected toolchains without asking"`
+	Force bool `short:"f" long:"force" description:"overwrite an existing Srcfile"`
+
+	in io.Reader // input stream to read answers from (defaults to os.Stdin)
+}
+
+var initCmd InitCmd
+
+// initScanResult is the set of source units found by a single
+// scanner.
+type initScanResult struct {
+	scanner *srclib.ToolRef
+	units   []*unit.SourceUnit
+}
+
+func (c *InitCmd) Execute(args []string) error {
+	if c.in == nil {
+		c.in = os.Stdin
+	}
+
+	repo, err := OpenRepo(".")
+	if err != nil {
+		return err
+	}
+	srcfile := filepath.Join(repo.RootDir, config.Filename)
+	if existing, err := config.FindFile(repo.RootDir); err != nil {
+		return err
+	} else if existing != "" && (!c.Force || existing != srcfile) {
+		return fmt.Errorf("%s already exists (use --force to overwrite a JSON Srcfile)", existing)
+	}
+
+	// Start from the scanners in the user srclib config, not from the
+	// existing Srcfile (if any), so that all toolchains are offered.
+	userCfg, err := config.SrclibPathConfig()
+	if err != nil {
+		return err
+	}
+	if len(userCfg.Scanners) == 0 {
+		return fmt.Errorf("no scanners found (install toolchains with %q first)", "srclib toolchain install")
+	}
+
+	var results []initScanResult
+	for _, scannerRef := range userCfg.Scanners {
+		cmd, err := scan.Command(scannerRef)
+		if err != nil {
+			return err
+		}
+		units, err := scan.Scan(cmd, scan.Options{Quiet: !GlobalOpt.Verbose}, nil)
+		if err != nil {
+			log.Printf("Scanner %s failed: %s. Skipping it.", scannerRef, err)
+			continue
+		}
+		if len(units) == 0 {
+			if GlobalOpt.Verbose {
+				log.Printf("Scanner %s found no source units. Skipping it.", scannerRef)
+			}
+			continue
+		}
+		results = append(results, initScanResult{scanner: scannerRef, units: units})
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("no source units found in %s by any scanner", repo.RootDir)
+	}
+
+	in := bufio.NewReader(c.in)
+	var enabled []*srclib.ToolRef
+	for _, r := range results {
+		colorable.Printf("Toolchain %s found %s:\n", r.scanner.Toolchain, describeUnitTypes(r.units))
+		for _, u := range r.units {
+			colorable.Printf(" - %s: %s\n", u.Type, u.Name)
+		}
+		if c.Yes || askYesNo(in, fmt.Sprintf("Enable %s?", r.scanner.Toolchain), true) {
+			enabled = append(enabled, r.scanner)
+		}
+	}
+	if len(enabled) == 0 {
+		return fmt.Errorf("no toolchains enabled; not writing %s", srcfile)
+	}
+
+	skipDirs, err := gitignoreSkipDirs(repo.RootDir)
+	if err != nil {
+		return err
+	}
+
+	data, err := initSrcfile(enabled, skipDirs)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(srcfile, data, 0644); err != nil {
+		return err
+	}
+	colorable.Printf("Wrote %s.\n", srcfile)
+	return nil
+}
+
+// describeUnitTypes returns a summary of the number of source units
+// of each type in units, such as "2 GoPackage units".
+func describeUnitTypes(units []*unit.SourceUnit) string {
+	counts := map[string]int{}
+	for _, u := range units {
+		counts[u.Type]++
+	}
+	types := make([]string, 0, len(counts))
+	for typ := range counts {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	descs := make([]string, len(types))
+	for i, typ := range types {
+		if counts[typ] == 1 {
+			descs[i] = fmt.Sprintf("1 %s unit", typ)
+		} else {
+			descs[i] = fmt.Sprintf("%d %s units", counts[typ], typ)
+		}
+	}
+	return strings.Join(descs, ", ")
+}
+
+// askYesNo prints question and reads a yes/no answer from in. An
+// empty answer (or EOF) selects def.
+func askYesNo(in *bufio.Reader, question string, def bool) bool {
+	choices := "[y/N]"
+	if def {
+		choices = "[Y/n]"
+	}
+	for {
+		colorable.Printf("%s %s ", question, choices)
+		line, err := in.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		case "":
+			return def
+		}
+		if err != nil {
+			return def
+		}
+	}
+}
+
+// gitignoreSkipDirs returns the directories under rootDir that are
+// listed in rootDir's .gitignore file. Only patterns that literally
+// name an existing directory are returned; glob and negated patterns
+// are ignored.
+func gitignoreSkipDirs(rootDir string) ([]string, error) {
+	f, err := os.Open(filepath.Join(rootDir, ".gitignore"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var dirs []string
+	seen := map[string]bool{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+		if strings.ContainsAny(line, "*?[\\") {
+			continue
+		}
+		dir := strings.Trim(line, "/")
+		if dir == "" || seen[dir] || !isDir(filepath.Join(rootDir, filepath.FromSlash(dir))) {
+			continue
+		}
+		seen[dir] = true
+		dirs = append(dirs, dir)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return dirs, nil
+}
+
+// initSrcfile returns the contents of a commented Srcfile that
+// enables the given scanners and skips skipDirs.
+func initSrcfile(scanners []*srclib.ToolRef, skipDirs []string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(`// Srcfile generated by "srclib init". Lines beginning with "//" are
+// comments. Run "srclib config" to see the resulting configuration.
+{
+  // Scanners are the toolchain tools that find the source units
+  // (packages, modules, etc.) in this repository.
+  "Scanners": [
+`)
+	for i, s := range scanners {
+		data, err := json.Marshal(s)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString("    ")
+		buf.Write(data)
+		if i < len(scanners)-1 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("  ],\n\n")
+
+	buf.WriteString(`  // SkipDirs are directory trees whose source units are not built.
+  // These were taken from .gitignore.
+  "SkipDirs": [`)
+	for i, dir := range skipDirs {
+		data, err := json.Marshal(dir)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString("    ")
+		buf.Write(data)
+		if i < len(skipDirs)-1 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+	}
+	if len(skipDirs) > 0 {
+		buf.WriteString("  ")
+	}
+	buf.WriteString("],\n\n")
+
+	buf.WriteString(`  // SkipUnits are individual source units that are not built, such
+  // as {"Name": "example.com/foo", "Type": "GoPackage"}.
+  "SkipUnits": []
+}
+`)
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/config"
+)
+
+func TestInitSrcfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-init")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, d := range []string{"build", "node_modules", "vendor/x"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gitignore := "# comment\n/build/\nnode_modules\n*.o\n!vendor/x\nmissing/\nbuild\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, ".gitignore"), []byte(gitignore), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	skipDirs, err := gitignoreSkipDirs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"build", "node_modules"}; !reflect.DeepEqual(skipDirs, want) {
+		t.Errorf("got skipDirs %v, want %v", skipDirs, want)
+	}
+
+	scanners := []*srclib.ToolRef{{Toolchain: "sourcegraph.com/sourcegraph/srclib-go", Subcmd: "scan"}}
+	data, err := initSrcfile(scanners, skipDirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, config.Filename), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.ReadRepository(dir)
+	if err != nil {
+		t.Fatalf("generated Srcfile is invalid: %s\n\n%s", err, data)
+	}
+	if !reflect.DeepEqual(cfg.Scanners, scanners) {
+		t.Errorf("got Scanners %v, want %v", cfg.Scanners, scanners)
+	}
+	if !reflect.DeepEqual(cfg.SkipDirs, skipDirs) {
+		t.Errorf("got SkipDirs %v, want %v", cfg.SkipDirs, skipDirs)
+	}
+}
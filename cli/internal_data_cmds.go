@@ -2,12 +2,20 @@ package cli
 
 import (
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 
+	"golang.org/x/tools/godoc/vfs"
 	"sourcegraph.com/sourcegraph/go-flags"
 
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/authorship"
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/dep"
 	"sourcegraph.com/sourcegraph/srclib/graph"
 	"sourcegraph.com/sourcegraph/srclib/grapher"
 	"sourcegraph.com/sourcegraph/srclib/plan"
@@ -30,6 +38,21 @@ func init() {
 		if err != nil {
 			log.Fatal(err)
 		}
+
+		_, err = c.AddCommand("blame-defs", "", "", &blameDefsCmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = c.AddCommand("stitch", "", "", &stitchCmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = c.AddCommand("clone-url", "", "", &cloneURLCmd)
+		if err != nil {
+			log.Fatal(err)
+		}
 	})
 }
 
@@ -68,6 +91,12 @@ type NormalizeGraphDataCmd struct {
 	Dir      string `long:"dir" description:"directory of source unit (SourceUnit.Dir field)"`
 	Multi    bool   `long:"multi" description:"the input contains graph data for multiple units; output will be split into different files per source unit"`
 	DataDir  string `long:"data-dir" description:"output data dir"`
+	Offsets  string `long:"offsets" description:"unit of the offsets in the graph data: bytes, runes, or auto (detect)" value-name:"UNIT"`
+
+	Unit           string           `long:"unit" description:"source unit name (passed to post-processors; not needed with --multi)"`
+	PostProcessors []srclib.ToolRef `long:"post-process" description:"run the normalized graph data through this tool (repeatable)" value-name:"TOOLCHAIN:TOOL"`
+
+	TestFiles []string `long:"test-files" description:"mark defs and refs in files matching this glob pattern as test code (repeatable)" value-name:"PATTERN"`
 }
 
 var normalizeGraphDataCmd NormalizeGraphDataCmd
@@ -81,11 +110,12 @@ func (c *NormalizeGraphDataCmd) Execute(args []string) error {
 	}
 
 	if !c.Multi {
-		if err := grapher.NormalizeData(c.UnitType, c.Dir, o); err != nil {
+		o, err := c.normalize(c.Unit, o)
+		if err != nil {
 			return err
 		}
 
-		data, err := json.MarshalIndent(o, "", "  ")
+		data, err := grapher.MarshalOutput(o)
 		if err != nil {
 			return err
 		}
@@ -144,28 +174,153 @@ func (c *NormalizeGraphDataCmd) Execute(args []string) error {
 		graphPerUnit[a.Unit].Anns = append(graphPerUnit[a.Unit].Anns, a)
 	}
 
-	// Write the graph data to a separate file for each source unit.
-	for unitName, graphData := range graphPerUnit {
-		if err := grapher.NormalizeData(c.UnitType, c.Dir, graphData); err != nil {
+	// Write the graph data to a separate file for each source unit,
+	// in a deterministic order.
+	unitNames := make([]string, 0, len(graphPerUnit))
+	for unitName := range graphPerUnit {
+		unitNames = append(unitNames, unitName)
+	}
+	sort.Strings(unitNames)
+	for _, unitName := range unitNames {
+		graphData, err := c.normalize(unitName, graphPerUnit[unitName])
+		if err != nil {
 			log.Printf("skipping unit %s because failed to normalize data: %s", unitName, err)
 			continue
 		}
 
 		path := filepath.ToSlash(filepath.Join(c.DataDir, plan.SourceUnitDataFilename(&graph.Output{}, &unit.SourceUnit{Key: unit.Key{Name: unitName, Type: c.UnitType}})))
-		graphFile, err := os.Create(path)
+		data, err := grapher.MarshalOutput(graphData)
 		if err != nil {
 			return err
 		}
-
-		data, err := json.MarshalIndent(graphData, "", "  ")
-		if err != nil {
+		if err := ioutil.WriteFile(path, data, 0666); err != nil {
 			return err
 		}
+	}
+
+	return nil
+}
+
+// normalize normalizes the graph data of the named source unit and
+// runs it through the post-processors, if any.
+func (c *NormalizeGraphDataCmd) normalize(unitName string, o *graph.Output) (*graph.Output, error) {
+	offsets, err := grapher.ParseOffsetUnit(c.Offsets)
+	if err != nil {
+		return nil, err
+	}
+	if err := grapher.NormalizeDataOffsets(c.UnitType, c.Dir, offsets, o); err != nil {
+		return nil, err
+	}
+	if errs := grapher.VerifyOffsets(c.Dir, o); len(errs) > 0 {
+		label := c.UnitType
+		if unitName != "" {
+			label += " " + unitName
+		}
+		log.Printf("Warning: %d invalid offset ranges in the graph data of %s (the first is: %s); graph data offsets must be byte offsets.", len(errs), label, errs[0])
+	}
+	if len(c.TestFiles) > 0 {
+		tree := &config.Tree{TestFiles: c.TestFiles}
+		grapher.MarkTests(o, tree.IsTestFile)
+	}
+	if len(c.PostProcessors) == 0 {
+		return o, nil
+	}
+	tools := make([]*srclib.ToolRef, len(c.PostProcessors))
+	for i := range c.PostProcessors {
+		tools[i] = &c.PostProcessors[i]
+	}
+	return grapher.PostProcess(tools, c.UnitType, unitName, o)
+}
+
+type BlameDefsCmd struct {
+	Args struct {
+		GraphFile string `name:"GRAPH-FILE" description:"graph output file of the source unit whose defs to blame"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var blameDefsCmd BlameDefsCmd
+
+func (c *BlameDefsCmd) Execute(args []string) error {
+	var o graph.Output
+	if err := readJSONFile(c.Args.GraphFile, &o); err != nil && err != errEmptyJSONFile {
+		return err
+	}
+
+	repo, err := OpenRepo(".")
+	if err != nil {
+		return err
+	}
+	authors, err := authorship.Compute(".", repo.VCS, o.Defs)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(authors, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+type StitchCmd struct {
+	DataDir   string           `long:"data-dir" description:"build data dir containing the source units and their graph data" required:"yes"`
+	Stitchers []srclib.ToolRef `long:"stitcher" description:"run this stitcher on the graph data (repeatable)" value-name:"TOOLCHAIN:TOOL"`
+}
 
-		if _, err := graphFile.Write(data); err != nil {
+var stitchCmd StitchCmd
+
+func (c *StitchCmd) Execute(args []string) error {
+	bdfs := vfs.OS(c.DataDir)
+	treeConfig, err := config.ReadCached(bdfs)
+	if err != nil {
+		return err
+	}
+
+	var units []*grapher.StitchUnit
+	for _, u := range treeConfig.SourceUnits {
+		var o graph.Output
+		if err := readBuildDataJSON(bdfs, plan.SourceUnitDataFilename(&graph.Output{}, u), &o); err != nil {
+			if os.IsNotExist(err) || err == errEmptyJSONFile || isCorruptJSONFile(err) {
+				log.Printf("Warning: not stitching unit %s %s: %s.", u.Type, u.Name, err)
+				continue
+			}
 			return err
 		}
+		units = append(units, &grapher.StitchUnit{Unit: u, Defs: o.Defs})
+	}
+
+	tools := make([]*srclib.ToolRef, len(c.Stitchers))
+	for i := range c.Stitchers {
+		tools[i] = &c.Stitchers[i]
+	}
+	refs, err := grapher.Stitch(tools, units)
+	if err != nil {
+		return err
 	}
+	if refs == nil {
+		refs = []*graph.Ref{}
+	}
+	return json.NewEncoder(os.Stdout).Encode(refs)
+}
+
+// CloneURLCmd prints the clone URL of the GitHub or GitLab repository
+// of a dependency, for dep resolvers that aren't written in Go (see
+// dep.CloneURLResolver).
+type CloneURLCmd struct {
+	Key  string `long:"key" description:"package that lists the repository URL (e.g., npm:lodash), which identifies the cached result (default: the URL)" value-name:"PACKAGE"`
+	Args struct {
+		URL string `name:"URL" description:"repository URL from the package's metadata"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var cloneURLCmd CloneURLCmd
 
+func (c *CloneURLCmd) Execute(args []string) error {
+	cloneURL, err := dep.NewCloneURLResolver().Resolve(c.Key, c.Args.URL)
+	if err != nil {
+		return err
+	}
+	fmt.Println(cloneURL)
 	return nil
 }
@@ -0,0 +1,178 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"sourcegraph.com/sourcegraph/go-flags"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func init() {
+	cliInit = append(cliInit, func(cli *flags.Command) {
+		_, err := cli.AddCommand("langs",
+			"show the languages in the current repository",
+			`Lists the languages of the code files in the current repository, with the number of files and lines of code (non-blank, non-comment lines) in each, and the source units that the toolchains' scanners detect for each. It doesn't need build data, so it can be used to check what srclib thinks the repository contains before running "srclib make".
+
+Files are counted under the language of their extension (or of their shebang line), as in "srclib coverage". A unit is listed under each language of its files. Files that aren't in any detected unit (and so won't be analyzed) are counted in Unanalyzed.
+
+With --tree, a source tree that isn't checked out (a git revision or an archive) is examined, as in "srclib make --tree".`,
+			&langsCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	})
+}
+
+type LangsCmd struct {
+	Generated bool   `long:"generated" description:"also count generated files (see graph.IsGenerated), which are excluded by default"`
+	NoUnits   bool   `long:"no-units" description:"don't scan for source units (which runs the toolchains' scanners)"`
+	Profile   string `long:"profile" description:"apply the named profile from the Srcfile when scanning for source units (default: $SRCLIB_PROFILE)" value-name:"NAME"`
+	Format    string `long:"format" description:"output format" default:"table" value-name:"table|json"`
+
+	TreeOpt
+}
+
+var langsCmd LangsCmd
+
+// langStats are the statistics of a language in "srclib langs".
+type langStats struct {
+	Language string
+	Files    int
+	LoC      int
+
+	// Unanalyzed is the number of files that aren't in any source
+	// unit (if units were scanned).
+	Unanalyzed int `json:",omitempty"`
+
+	// Units lists the IDs of the source units with files in the
+	// language, sorted.
+	Units []string `json:",omitempty"`
+}
+
+func (c *LangsCmd) Execute(args []string) error {
+	if c.Format != "table" && c.Format != "json" {
+		return fmt.Errorf("unknown output format %q (expected table or json)", c.Format)
+	}
+	if c.Tree != "" {
+		if err := c.useTree(); err != nil {
+			return err
+		}
+	}
+	repo, err := OpenRepo(".")
+	if err != nil {
+		return err
+	}
+	cfg, err := getInitialConfig(repo.RootDir, profileName(c.Profile))
+	if err != nil {
+		return err
+	}
+
+	files := map[string]string{} // file -> language
+	locs := map[string]int{}     // file -> LoC
+	err = walkCodeFiles(repo.RootDir, cfg, func(path, lang string, data []byte) error {
+		if !c.Generated && graph.IsGenerated(path, data) {
+			return nil
+		}
+		files[path] = lang
+		locs[path] = countLoC(lang, data)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var units []*unit.SourceUnit
+	if !c.NoUnits {
+		if _, err := scanUnitsIntoConfig(cfg, true); err != nil {
+			return err
+		}
+		units = cfg.SourceUnits
+	}
+	stats := computeLangStats(files, locs, units, !c.NoUnits)
+
+	if c.Format == "json" {
+		PrintJSON(stats, "  ")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	if c.NoUnits {
+		fmt.Fprintln(w, "LANGUAGE\tFILES\tLOC")
+	} else {
+		fmt.Fprintln(w, "LANGUAGE\tFILES\tLOC\tUNANALYZED\tUNITS")
+	}
+	for _, s := range stats {
+		if c.NoUnits {
+			fmt.Fprintf(w, "%s\t%d\t%d\n", s.Language, s.Files, s.LoC)
+		} else {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\n", s.Language, s.Files, s.LoC, s.Unanalyzed, strings.Join(s.Units, ", "))
+		}
+	}
+	return w.Flush()
+}
+
+// computeLangStats returns the statistics of each language of files
+// (which maps each file to its language), sorted by descending LoC,
+// given the LoC of each file and the source units. If countUnanalyzed
+// is true, files that aren't in any unit are counted as unanalyzed.
+func computeLangStats(files map[string]string, locs map[string]int, units []*unit.SourceUnit, countUnanalyzed bool) []*langStats {
+	byLang := map[string]*langStats{}
+	get := func(lang string) *langStats {
+		s, ok := byLang[lang]
+		if !ok {
+			s = &langStats{Language: lang}
+			byLang[lang] = s
+		}
+		return s
+	}
+
+	inUnit := map[string]bool{}
+	for _, u := range units {
+		langs := map[string]bool{}
+		for _, f := range u.Files {
+			f = graph.CleanFile(f)
+			inUnit[f] = true
+			if lang, ok := files[f]; ok {
+				langs[lang] = true
+			}
+		}
+		for lang := range langs {
+			s := get(lang)
+			s.Units = append(s.Units, string(u.ID()))
+		}
+	}
+	for f, lang := range files {
+		s := get(lang)
+		s.Files++
+		s.LoC += locs[f]
+		if countUnanalyzed && !inUnit[f] {
+			s.Unanalyzed++
+		}
+	}
+
+	stats := make([]*langStats, 0, len(byLang))
+	for _, s := range byLang {
+		sort.Strings(s.Units)
+		stats = append(stats, s)
+	}
+	sort.Sort(langStatsByLoC(stats))
+	return stats
+}
+
+type langStatsByLoC []*langStats
+
+func (v langStatsByLoC) Len() int      { return len(v) }
+func (v langStatsByLoC) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v langStatsByLoC) Less(i, j int) bool {
+	if v[i].LoC != v[j].LoC {
+		return v[i].LoC > v[j].LoC
+	}
+	return v[i].Language < v[j].Language
+}
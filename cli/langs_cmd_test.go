@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestComputeLangStats(t *testing.T) {
+	files := map[string]string{"a.go": "Go", "b.go": "Go", "x.py": "Python", "y.py": "Python"}
+	locs := map[string]int{"a.go": 10, "b.go": 5, "x.py": 20, "y.py": 1}
+	units := []*unit.SourceUnit{
+		{Key: unit.Key{Type: "GoPackage", Name: "a"}, Info: unit.Info{Files: []string{"./a.go", "gone.go"}}},
+		{Key: unit.Key{Type: "PipPackage", Name: "p"}, Info: unit.Info{Files: []string{"x.py", "a.go"}}},
+	}
+
+	got := computeLangStats(files, locs, units, true)
+	want := []*langStats{
+		{Language: "Python", Files: 2, LoC: 21, Unanalyzed: 1, Units: []string{"p@PipPackage"}},
+		{Language: "Go", Files: 2, LoC: 15, Unanalyzed: 1, Units: []string{"a@GoPackage", "p@PipPackage"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	got = computeLangStats(files, locs, nil, false)
+	if len(got) != 2 || got[0].Unanalyzed != 0 || got[1].Units != nil {
+		t.Errorf("without units, got %+v", got)
+	}
+}
@@ -22,7 +22,7 @@ import (
 
 func init() {
 	cliInit = append(cliInit, func(cli *flags.Command) {
-		_, err := cli.AddCommand("lint",
+		c, err := cli.AddCommand("lint",
 			"detect common issues in srclib output data",
 			`The lint command checks srclib output files (*.graph.json, *.unit.json, *.depresolve.json, etc.) for common data integrity and correctness issues:
 
@@ -30,6 +30,8 @@ func init() {
 
 * Refs, defs, and source units whose 'Files' and/or 'Dir' fields do not exist in the repository
 
+* Refs, defs, and docs whose ranges are not byte offset ranges in their files (e.g., because the grapher emitted character offsets): ranges past the end of the file or not on UTF-8 character boundaries, and defs whose ranges don't contain their names
+
 Note that the lint command operates on single files at a time, so it can't detect cross-source-unit or cross-repo ref resolution errors (only those on refs to defs in the same source unit).
 
 If no PATHs are specified, the current directory is used. If a PATH is a directory, it is traversed recursively for files named with any of the above suffixes.
@@ -41,6 +43,18 @@ To suppress specific kinds of warnings, or to include only specific kinds of war
 		if err != nil {
 			log.Fatal(err)
 		}
+		c.SubcommandsOptional = true
+
+		_, err = c.AddCommand("dupdefs",
+			"find defs with duplicate keys",
+			`Finds the def keys (source unit type, source unit, and def path) that were emitted more than once in the graph build data of the current commit (or --commit): by multiple source units, or at multiple positions in one source unit's graph data. Duplicate keys silently shadow each other in the store, so go-to-definition may go to the wrong def.
+
+Each duplicate key is reported with the locations of its defs, the source units whose graph data they were emitted in, and the toolchains that graphed those units (as recorded in the tool logs by "srclib make"). The command exits with an error if any duplicates are found.`,
+			&lintDupDefsCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
 	})
 }
 
@@ -302,6 +316,12 @@ func lintGraphOutput(baseDir, repoURI, unitType, unitName, path string, checkFil
 	addMultiErrorAsIssues(grapher.ValidateRefs(o.Refs))
 	addMultiErrorAsIssues(grapher.ValidateDocs(o.Docs))
 
+	// Check that offsets are byte offsets in the files (which must be
+	// those at the commit the data was built from).
+	if checkFilesExist {
+		addMultiErrorAsIssues(grapher.VerifyOffsets(baseDir, &o))
+	}
+
 	// TODO(sqs): check that docs point to valid defs in the same source unit
 
 	unresolvedInternalRefsByDefKey := grapher.UnresolvedInternalRefs(repoURI, o.Refs, o.Defs)
@@ -0,0 +1,181 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/alexsaveliev/go-colorable-wrapper"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+type LintDupDefsCmd struct {
+	CommitID string `long:"commit" description:"commit ID whose build data to check (default: the current commit)"`
+	JSON     bool   `long:"json" description:"print the duplicate defs as JSON"`
+}
+
+var lintDupDefsCmd LintDupDefsCmd
+
+// A dupDef is a def key that was emitted more than once, as reported
+// by "srclib lint dupdefs".
+type dupDef struct {
+	graph.DefKey
+	Defs []*dupDefLocation
+}
+
+// A dupDefLocation is where one of the defs with a duplicate key was
+// defined, and the source unit (and the toolchain that graphed it)
+// whose graph data it was emitted in.
+type dupDefLocation struct {
+	File      string
+	DefStart  uint32
+	DefEnd    uint32
+	EmittedBy unit.ID2
+	Toolchain string `json:",omitempty"`
+}
+
+func (c *LintDupDefsCmd) Execute(args []string) error {
+	repo, err := OpenRepo(".")
+	if err != nil {
+		return err
+	}
+	commitID := c.CommitID
+	if commitID == "" {
+		commitID = repo.CommitID
+	}
+	bdfs, err := GetBuildDataFS(commitID)
+	if err != nil {
+		return err
+	}
+
+	var units []*unit.SourceUnit
+	outputs := map[unit.ID2]*graph.Output{}
+	err = readBuildDataGraphs(commitID, func(u *unit.SourceUnit, o *graph.Output) {
+		if o != nil {
+			units = append(units, u)
+			outputs[u.ID2()] = o
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// The toolchain that graphed each unit is recorded in its graph
+	// tool log (by "srclib make").
+	logs, err := readToolLogs(bdfs, units, "graph")
+	if err != nil {
+		return err
+	}
+	toolchains := map[unit.ID2]string{}
+	for _, l := range logs {
+		toolchains[unit.ID2{Type: l.Unit.Type, Name: l.Unit.Name}] = l.Toolchain
+	}
+	unitToolchain := func(u unit.ID2) string {
+		if tc, present := toolchains[u]; present {
+			return tc
+		}
+		return toolchains[unit.ID2{Type: u.Type}] // graphed with all units of its type
+	}
+
+	dups := findDupDefs(units, outputs, unitToolchain)
+
+	if c.JSON {
+		if dups == nil {
+			dups = []*dupDef{}
+		}
+		PrintJSON(dups, "  ")
+	} else {
+		for _, d := range dups {
+			colorable.Println(colorable.Cyan(fmt.Sprintf("%s %s %s: %d defs", d.UnitType, d.Unit, d.Path, len(d.Defs))))
+			for _, l := range d.Defs {
+				tc := l.Toolchain
+				if tc == "" {
+					tc = "unknown toolchain"
+				}
+				fmt.Printf("  %s:%d-%d (emitted by %s %s, %s)\n", l.File, l.DefStart, l.DefEnd, l.EmittedBy.Type, l.EmittedBy.Name, tc)
+			}
+		}
+	}
+	if len(dups) > 0 {
+		return fmt.Errorf("found %d def keys that were emitted more than once", len(dups))
+	}
+	return nil
+}
+
+// findDupDefs returns the def keys (within the repository) that were
+// emitted more than once in the graph outputs of units: by multiple
+// units, or at multiple positions (or more than once at the same
+// position) in one unit's output. Defs whose UnitType and Unit are
+// empty are in the unit whose output they were emitted in. The
+// duplicates are sorted by key.
+func findDupDefs(units []*unit.SourceUnit, outputs map[unit.ID2]*graph.Output, toolchain func(unit.ID2) string) []*dupDef {
+	type key struct{ unitType, unit, path string }
+	byKey := map[key][]*dupDefLocation{}
+	for _, u := range units {
+		o := outputs[u.ID2()]
+		if o == nil {
+			continue
+		}
+		for _, d := range o.Defs {
+			k := key{d.UnitType, d.Unit, d.Path}
+			if k.unitType == "" && k.unit == "" {
+				k.unitType, k.unit = u.Type, u.Name
+			}
+			byKey[k] = append(byKey[k], &dupDefLocation{
+				File:      d.File,
+				DefStart:  d.DefStart,
+				DefEnd:    d.DefEnd,
+				EmittedBy: u.ID2(),
+				Toolchain: toolchain(u.ID2()),
+			})
+		}
+	}
+
+	var dups []*dupDef
+	for k, locs := range byKey {
+		if len(locs) < 2 {
+			continue
+		}
+		sort.Sort(dupDefLocations(locs))
+		dups = append(dups, &dupDef{
+			DefKey: graph.DefKey{UnitType: k.unitType, Unit: k.unit, Path: k.path},
+			Defs:   locs,
+		})
+	}
+	sort.Sort(dupDefsByKey(dups))
+	return dups
+}
+
+type dupDefLocations []*dupDefLocation
+
+func (v dupDefLocations) Len() int      { return len(v) }
+func (v dupDefLocations) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v dupDefLocations) Less(i, j int) bool {
+	a, b := v[i], v[j]
+	if a.EmittedBy != b.EmittedBy {
+		if a.EmittedBy.Type != b.EmittedBy.Type {
+			return a.EmittedBy.Type < b.EmittedBy.Type
+		}
+		return a.EmittedBy.Name < b.EmittedBy.Name
+	}
+	if a.File != b.File {
+		return a.File < b.File
+	}
+	return a.DefStart < b.DefStart
+}
+
+type dupDefsByKey []*dupDef
+
+func (v dupDefsByKey) Len() int      { return len(v) }
+func (v dupDefsByKey) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v dupDefsByKey) Less(i, j int) bool {
+	a, b := v[i].DefKey, v[j].DefKey
+	if a.UnitType != b.UnitType {
+		return a.UnitType < b.UnitType
+	}
+	if a.Unit != b.Unit {
+		return a.Unit < b.Unit
+	}
+	return a.Path < b.Path
+}
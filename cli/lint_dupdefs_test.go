@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestFindDupDefs(t *testing.T) {
+	u1 := &unit.SourceUnit{Key: unit.Key{Type: "t", Name: "u1"}}
+	u2 := &unit.SourceUnit{Key: unit.Key{Type: "t", Name: "u2"}}
+	outputs := map[unit.ID2]*graph.Output{
+		u1.ID2(): {Defs: []*graph.Def{
+			{DefKey: graph.DefKey{Path: "A"}, File: "a", DefStart: 1, DefEnd: 2},
+			{DefKey: graph.DefKey{Path: "A"}, File: "a", DefStart: 5, DefEnd: 6},
+			{DefKey: graph.DefKey{Path: "B"}, File: "a", DefStart: 9, DefEnd: 10},
+			{DefKey: graph.DefKey{UnitType: "t", Unit: "u1", Path: "C"}, File: "a", DefStart: 20, DefEnd: 21},
+		}},
+		u2.ID2(): {Defs: []*graph.Def{
+			{DefKey: graph.DefKey{Path: "B"}, File: "b", DefStart: 1, DefEnd: 2},
+			{DefKey: graph.DefKey{UnitType: "t", Unit: "u1", Path: "C"}, File: "b", DefStart: 3, DefEnd: 4},
+		}},
+	}
+	toolchain := func(u unit.ID2) string { return "tc-" + u.Name }
+
+	dups := findDupDefs([]*unit.SourceUnit{u2, u1}, outputs, toolchain)
+	want := []*dupDef{
+		{DefKey: graph.DefKey{UnitType: "t", Unit: "u1", Path: "A"}, Defs: []*dupDefLocation{
+			{File: "a", DefStart: 1, DefEnd: 2, EmittedBy: u1.ID2(), Toolchain: "tc-u1"},
+			{File: "a", DefStart: 5, DefEnd: 6, EmittedBy: u1.ID2(), Toolchain: "tc-u1"},
+		}},
+		{DefKey: graph.DefKey{UnitType: "t", Unit: "u1", Path: "C"}, Defs: []*dupDefLocation{
+			{File: "a", DefStart: 20, DefEnd: 21, EmittedBy: u1.ID2(), Toolchain: "tc-u1"},
+			{File: "b", DefStart: 3, DefEnd: 4, EmittedBy: u2.ID2(), Toolchain: "tc-u2"},
+		}},
+	}
+	if !reflect.DeepEqual(dups, want) {
+		gotJSON, _ := json.Marshal(dups)
+		wantJSON, _ := json.Marshal(want)
+		t.Errorf("got %s, want %s", gotJSON, wantJSON)
+	}
+}
@@ -0,0 +1,218 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alexsaveliev/go-colorable-wrapper"
+	"golang.org/x/tools/godoc/vfs"
+
+	"sourcegraph.com/sourcegraph/go-flags"
+
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func init() {
+	cliInit = append(cliInit, func(cli *flags.Command) {
+		_, err := cli.AddCommand("logs",
+			"show toolchain logs of source units",
+			`Shows the logs of the toolchain tool runs (their output, duration, and exit code) that were recorded for source units by the last "srclib make" of the current commit.
+
+UNIT is a source unit name (which matches units of any type) or a source unit ID (NAME@TYPE). If UNIT is omitted, a summary of all logs is shown.
+
+The structured errors that the tools reported (see toolchain.ErrorsFileEnv) are shown with each log. With --sarif, only they are printed, as a SARIF log.`,
+			&logsCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	})
+}
+
+type LogsCmd struct {
+	Op    string `long:"op" description:"only show logs of the named operation (e.g., graph or depresolve)" value-name:"OP"`
+	JSON  bool   `long:"json" description:"print the logs as JSON"`
+	SARIF bool   `long:"sarif" description:"print the errors reported by the tools as a SARIF log"`
+
+	Args struct {
+		Unit string `name:"UNIT" description:"source unit name or ID (NAME@TYPE)"`
+	} `positional-args:"yes"`
+}
+
+var logsCmd LogsCmd
+
+// unitToolLog is a tool log recorded for a source unit (or, for
+// operations run on all units of a type at once, for a unit type).
+type unitToolLog struct {
+	Unit *unit.SourceUnit
+	Op   string
+	*plan.ToolLog
+}
+
+func (c *LogsCmd) Execute(args []string) error {
+	lrepo, err := OpenLocalRepo()
+	if err != nil {
+		return err
+	}
+	buildStore, err := buildstore.LocalRepo(lrepo.RootDir)
+	if err != nil {
+		return err
+	}
+	commitFS := buildStore.Commit(lrepo.CommitID)
+	cfg, err := config.ReadCached(commitFS)
+	if err != nil {
+		return err
+	}
+
+	units := cfg.SourceUnits
+	if c.Args.Unit != "" {
+		units, err = matchUnits(units, c.Args.Unit)
+		if err != nil {
+			return err
+		}
+	}
+
+	logs, err := readToolLogs(commitFS, units, c.Op)
+	if err != nil {
+		return err
+	}
+	if len(logs) == 0 {
+		return fmt.Errorf("no logs found (run %q first)", "srclib make")
+	}
+
+	if c.JSON {
+		PrintJSON(logs, "")
+		return nil
+	}
+	if c.SARIF {
+		PrintJSON(toolErrorsSARIF(logs), "  ")
+		return nil
+	}
+	for _, l := range logs {
+		if c.Args.Unit == "" {
+			colorable.Printf("%s %s: %s\n", exitStatus(l.ExitCode), unitLogLabel(l), describeToolLog(l.ToolLog))
+			for _, e := range l.Errors {
+				colorable.Printf("     %s\n", describeToolError(e))
+			}
+			continue
+		}
+		colorable.Println(colorable.Cyan(fmt.Sprintf("==> %s <==", unitLogLabel(l))))
+		colorable.Printf("%s %s\n", exitStatus(l.ExitCode), describeToolLog(l.ToolLog))
+		if l.Error != "" {
+			colorable.Printf("error: %s\n", l.Error)
+		}
+		for _, e := range l.Errors {
+			colorable.Printf("%s\n", describeToolError(e))
+		}
+		if l.Stderr != "" {
+			colorable.Println(strings.TrimRight(l.Stderr, "\n"))
+		}
+		colorable.Println()
+	}
+	return nil
+}
+
+// matchUnits returns the units whose name is unitSpec, or (if
+// unitSpec is a source unit ID) whose ID is unitSpec.
+func matchUnits(units []*unit.SourceUnit, unitSpec string) ([]*unit.SourceUnit, error) {
+	name, typ, err := unit.ParseID(unitSpec)
+	if err != nil {
+		name, typ = unitSpec, ""
+	}
+	var matched []*unit.SourceUnit
+	for _, u := range units {
+		if u.Name == name && (typ == "" || u.Type == typ) {
+			matched = append(matched, u)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no source unit %q in the cached config (run %q to list source units)", unitSpec, "srclib units")
+	}
+	return matched, nil
+}
+
+// readToolLogs reads the tool logs in bdfs for each operation (or
+// only for op, if it is non-empty) run on units. Logs of operations
+// that are run on all units of a type at once are included once per
+// type.
+func readToolLogs(bdfs vfs.FileSystem, units []*unit.SourceUnit, op string) ([]*unitToolLog, error) {
+	var ops []string
+	if op != "" {
+		ops = []string{op}
+	} else {
+		for name := range plan.RuleMakers {
+			ops = append(ops, name)
+		}
+		sort.Strings(ops)
+	}
+
+	var logs []*unitToolLog
+	seenTypes := map[string]bool{}
+	read := func(u *unit.SourceUnit, op string) error {
+		f, err := bdfs.Open(plan.LogFilename(op, u))
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		defer f.Close()
+		var l plan.ToolLog
+		if err := json.NewDecoder(f).Decode(&l); err != nil {
+			return fmt.Errorf("reading %s log of %s: %s", op, u.ID(), err)
+		}
+		logs = append(logs, &unitToolLog{Unit: u, Op: op, ToolLog: &l})
+		return nil
+	}
+	for _, u := range units {
+		for _, op := range ops {
+			if err := read(u, op); err != nil {
+				return nil, err
+			}
+		}
+		if !seenTypes[u.Type] {
+			seenTypes[u.Type] = true
+			for _, op := range ops {
+				if err := read(&unit.SourceUnit{Key: unit.Key{Type: u.Type}}, op); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return logs, nil
+}
+
+func unitLogLabel(l *unitToolLog) string {
+	if l.Unit.Name == "" {
+		return fmt.Sprintf("%s units %s", l.Unit.Type, l.Op)
+	}
+	return fmt.Sprintf("%s %s %s", l.Unit.Type, l.Unit.Name, l.Op)
+}
+
+func exitStatus(code int) string {
+	if code == 0 {
+		return colorable.Green("OK  ")
+	}
+	return colorable.Red("FAIL")
+}
+
+func describeToolLog(l *plan.ToolLog) string {
+	return fmt.Sprintf("%s %s exited with code %d after %s (started %s, %d bytes of output)", l.Toolchain, l.Tool, l.ExitCode, l.Duration-l.Duration%time.Millisecond, l.Start.Format(time.RFC3339), l.StdoutBytes)
+}
+
+// describeToolError describes an error reported by a tool, noting
+// whether the tool recovered from it.
+func describeToolError(e *toolchain.ToolError) string {
+	if e.Recoverable {
+		return "warning: " + e.Error()
+	}
+	return "error: " + e.Error()
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"testing"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestReadToolLogs(t *testing.T) {
+	units := []*unit.SourceUnit{
+		{Key: unit.Key{Name: "a", Type: "t"}},
+		{Key: unit.Key{Name: "b", Type: "t"}},
+	}
+	bdfs := rwvfs.Map(map[string]string{
+		plan.LogFilename("graph", units[0]):                                       `{"Tool": "graph", "ExitCode": 1, "Stderr": "oops"}`,
+		plan.LogFilename("depresolve", units[0]):                                  `{"Tool": "depresolve"}`,
+		plan.LogFilename("graph-all", &unit.SourceUnit{Key: unit.Key{Type: "t"}}): `{"Tool": "graph"}`,
+	})
+
+	logs, err := readToolLogs(bdfs, units, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, l := range logs {
+		got = append(got, unitLogLabel(l))
+	}
+	want := []string{"t a depresolve", "t a graph", "t units graph-all"}
+	if len(got) != len(want) {
+		t.Fatalf("got logs %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got logs %v, want %v", got, want)
+			break
+		}
+	}
+	if logs[1].ExitCode != 1 || logs[1].Stderr != "oops" {
+		t.Errorf("got graph log %+v, want exit code 1 and stderr", logs[1].ToolLog)
+	}
+
+	logs, err = readToolLogs(bdfs, units[1:], "graph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 0 {
+		t.Errorf("got %d logs for unit with none, want 0", len(logs))
+	}
+}
+
+func TestToolErrorsSARIF(t *testing.T) {
+	u := &unit.SourceUnit{Key: unit.Key{Name: "a", Type: "MavenArtifact"}}
+	logs := []*unitToolLog{
+		{Unit: u, Op: "graph", ToolLog: &plan.ToolLog{Toolchain: "tc/java", Tool: "graph", Errors: []*toolchain.ToolError{
+			{Code: "missing-dependency", Message: "missing dependency com.foo:bar:1.2", File: "pom.xml", Line: 47},
+			{Message: "couldn't parse file", Recoverable: true},
+		}}},
+		{Unit: u, Op: "depresolve", ToolLog: &plan.ToolLog{Toolchain: "tc/java", Tool: "depresolve"}},
+	}
+
+	s := toolErrorsSARIF(logs)
+	if len(s.Runs) != 1 || s.Runs[0].Tool.Driver.Name != "tc/java" {
+		t.Fatalf("got runs %+v, want 1 run of tc/java", s.Runs)
+	}
+	rs := s.Runs[0].Results
+	if len(rs) != 2 {
+		t.Fatalf("got %d results, want 2", len(rs))
+	}
+	if rs[0].RuleID != "missing-dependency" || rs[0].Level != "error" || rs[0].Properties["unit"] != "a" {
+		t.Errorf("got result %+v, want missing-dependency error in unit a", rs[0])
+	}
+	if len(rs[0].Locations) != 1 || rs[0].Locations[0].PhysicalLocation.ArtifactLocation.URI != "pom.xml" || rs[0].Locations[0].PhysicalLocation.Region.StartLine != 47 {
+		t.Errorf("got locations %+v, want pom.xml:47", rs[0].Locations)
+	}
+	if rs[1].Level != "warning" || rs[1].Locations != nil {
+		t.Errorf("got result %+v, want warning without location", rs[1])
+	}
+}
+
+func TestHeadWriter(t *testing.T) {
+	w := &headWriter{max: 4}
+	w.Write([]byte("ab"))
+	w.Write([]byte("cdef"))
+	w.Write([]byte("g"))
+	if got := w.buf.String(); got != "abcd" {
+		t.Errorf("got head %q, want %q", got, "abcd")
+	}
+	if w.n != 7 {
+		t.Errorf("got %d bytes, want 7", w.n)
+	}
+}
@@ -0,0 +1,106 @@
+package cli
+
+import "sort"
+
+// The types below are the subset of the SARIF 2.1.0 format (Static
+// Analysis Results Interchange Format) that "srclib logs --sarif"
+// uses to report the errors that tools reported (see
+// toolchain.ErrorsFileEnv), so that they can be shown by code review
+// and CI systems that read SARIF.
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver struct {
+		Name string `json:"name"`
+	} `json:"driver"`
+}
+
+type sarifResult struct {
+	RuleID     string            `json:"ruleId,omitempty"`
+	Level      string            `json:"level"`
+	Message    sarifMessage      `json:"message"`
+	Locations  []sarifLocation   `json:"locations,omitempty"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region *sarifRegion `json:"region,omitempty"`
+	} `json:"physicalLocation"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// toolErrorsSARIF returns a SARIF log of the errors in logs, with a
+// run for each toolchain (sorted by path) that reported errors.
+// Recoverable errors are reported as warnings.
+func toolErrorsSARIF(logs []*unitToolLog) *sarifLog {
+	runs := map[string]*sarifRun{}
+	for _, l := range logs {
+		for _, e := range l.Errors {
+			run, ok := runs[l.Toolchain]
+			if !ok {
+				run = &sarifRun{Results: []sarifResult{}}
+				run.Tool.Driver.Name = l.Toolchain
+				runs[l.Toolchain] = run
+			}
+
+			r := sarifResult{
+				RuleID:     e.Code,
+				Level:      "error",
+				Message:    sarifMessage{Text: e.Message},
+				Properties: map[string]string{"op": l.Op, "tool": l.Tool, "unitType": l.Unit.Type},
+			}
+			if e.Recoverable {
+				r.Level = "warning"
+			}
+			if l.Unit.Name != "" {
+				r.Properties["unit"] = l.Unit.Name
+			}
+			if e.File != "" {
+				var loc sarifLocation
+				loc.PhysicalLocation.ArtifactLocation.URI = e.File
+				if e.Line > 0 {
+					loc.PhysicalLocation.Region = &sarifRegion{StartLine: e.Line, StartColumn: e.Column}
+				}
+				r.Locations = []sarifLocation{loc}
+			}
+			run.Results = append(run.Results, r)
+		}
+	}
+
+	paths := make([]string, 0, len(runs))
+	for path := range runs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	s := &sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs:    []sarifRun{},
+	}
+	for _, path := range paths {
+		s.Runs = append(s.Runs, *runs[path])
+	}
+	return s
+}
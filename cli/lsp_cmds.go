@@ -0,0 +1,217 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/go-flags"
+
+	"sourcegraph.com/sourcegraph/srclib/lsp"
+	"sourcegraph.com/sourcegraph/srclib/scan"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+	"sourcegraph.com/sourcegraph/srclib/util"
+)
+
+func init() {
+	cliInit = append(cliInit, func(cli *flags.Command) {
+		c, err := cli.AddCommand("lsp-adapter",
+			"run a language server as a toolchain",
+			`Runs a language server (that speaks the Language Server Protocol) as a srclib toolchain program, so that languages with a language server but no srclib toolchain can be analyzed. The scan subcommand emits a source unit containing the files with the given extensions, and the graph subcommand starts the language server and converts its documentSymbol, references, and definition responses for the source unit's files into graph data.
+
+This command is usually run by a toolchain created with "srclib toolchain add-lsp", not directly.`,
+			&lspAdapterCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = c.AddCommand("scan",
+			"scan for source units",
+			"Prints a source unit (as a JSON array, as scanners do) containing the files in the current directory (and its subdirectories) with the given extensions.",
+			&lspAdapterScanCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = c.AddCommand("graph",
+			"graph a source unit",
+			"Reads a source unit (as JSON) from stdin, graphs it with the language server (in the current directory), and prints the graph data (as JSON).",
+			&lspAdapterGraphCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	})
+}
+
+type LSPAdapterCmd struct {
+	Server     string   `long:"server" description:"command (and arguments, separated by spaces) that runs the language server on stdin and stdout" required:"yes" value-name:"CMD"`
+	UnitType   string   `long:"unit-type" description:"source unit type" required:"yes"`
+	LanguageID string   `long:"language-id" description:"LSP language identifier of the files (e.g., ruby)" required:"yes" value-name:"ID"`
+	Extensions []string `long:"ext" description:"extension of the language's files (e.g., .rb); may be repeated" required:"yes" value-name:"EXT"`
+}
+
+var lspAdapterCmd LSPAdapterCmd
+
+func (c *LSPAdapterCmd) Execute(args []string) error { return nil }
+
+func (c *LSPAdapterCmd) config() *lsp.Config {
+	return &lsp.Config{UnitType: c.UnitType, LanguageID: c.LanguageID, Extensions: c.Extensions}
+}
+
+type LSPAdapterScanCmd struct{}
+
+var lspAdapterScanCmd LSPAdapterScanCmd
+
+func (c *LSPAdapterScanCmd) Execute(args []string) error {
+	// The tree config (on stdin) isn't used, but read it so that
+	// srclib doesn't fail to write it.
+	io.Copy(ioutil.Discard, os.Stdin)
+
+	lspConfig := lspAdapterCmd.config()
+	symlinks, err := util.ParseSymlinkPolicy(os.Getenv(scan.SymlinksEnvVar))
+	if err != nil {
+		return err
+	}
+	lspConfig.Symlinks = symlinks
+	units, err := lsp.Scan(".", lspConfig)
+	if err != nil {
+		return err
+	}
+	if units == nil {
+		units = []*unit.SourceUnit{}
+	}
+	return json.NewEncoder(os.Stdout).Encode(units)
+}
+
+type LSPAdapterGraphCmd struct{}
+
+var lspAdapterGraphCmd LSPAdapterGraphCmd
+
+func (c *LSPAdapterGraphCmd) Execute(args []string) error {
+	var u *unit.SourceUnit
+	if err := json.NewDecoder(os.Stdin).Decode(&u); err != nil {
+		return err
+	}
+	rootDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	server := strings.Fields(lspAdapterCmd.Server)
+	if len(server) == 0 {
+		return fmt.Errorf("no language server command given (--server)")
+	}
+	cmd := exec.Command(server[0], server[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if GlobalOpt.Verbose {
+		log.Printf("Starting language server: %v", cmd.Args)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting language server %v: %s", cmd.Args, err)
+	}
+	defer func() {
+		if cmd.Process != nil {
+			cmd.Process.Kill()
+		}
+	}()
+
+	conn := lsp.NewConn(struct {
+		io.Reader
+		io.Writer
+	}{stdout, stdin})
+	if err := conn.Initialize(rootDir); err != nil {
+		return err
+	}
+	o, err := lsp.Graph(conn, rootDir, u, lspAdapterCmd.config())
+	if err != nil {
+		return err
+	}
+	if err := conn.Shutdown(); err != nil {
+		log.Printf("Warning: language server didn't shut down: %s.", err)
+	} else {
+		stdin.Close()
+		cmd.Wait()
+	}
+	return json.NewEncoder(os.Stdout).Encode(o)
+}
+
+type ToolchainAddLSPCmd struct {
+	LSPAdapterCmd
+
+	Args struct {
+		Toolchain ToolchainPath `name:"TOOLCHAIN" description:"toolchain path of the toolchain to create (e.g., lsp/ruby)" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+var toolchainAddLSPCmd ToolchainAddLSPCmd
+
+func (c *ToolchainAddLSPCmd) Execute(args []string) error {
+	toolchainPath := string(c.Args.Toolchain)
+	dir, err := toolchain.Dir(toolchainPath)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(dir, toolchain.ConfigFilename)); err == nil {
+		return fmt.Errorf("toolchain %s already exists in %s", toolchainPath, dir)
+	}
+
+	config := toolchain.Config{Tools: []*toolchain.ToolInfo{
+		{Subcmd: "scan", Op: "scan"},
+		{Subcmd: "graph", Op: "graph", SourceUnitTypes: []string{c.UnitType}},
+	}}
+	configData, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, ".bin"), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, toolchain.ConfigFilename), configData, 0644); err != nil {
+		return err
+	}
+	prog := filepath.Join(dir, ".bin", filepath.Base(toolchainPath))
+	if err := ioutil.WriteFile(prog, []byte(lspToolchainScript(&c.LSPAdapterCmd)), 0755); err != nil {
+		return err
+	}
+	log.Printf("Created toolchain %s in %s.", toolchainPath, dir)
+	return nil
+}
+
+// lspToolchainScript returns the program of a toolchain that runs
+// "srclib lsp-adapter" with c's options.
+func lspToolchainScript(c *LSPAdapterCmd) string {
+	args := []string{"exec", "srclib", "lsp-adapter",
+		"--server", shellQuote(c.Server),
+		"--unit-type", shellQuote(c.UnitType),
+		"--language-id", shellQuote(c.LanguageID),
+	}
+	for _, ext := range c.Extensions {
+		args = append(args, "--ext", shellQuote(ext))
+	}
+	args = append(args, `"$@"`)
+	return "#!/bin/sh\n" + strings.Join(args, " ") + "\n"
+}
+
+// shellQuote quotes s for sh.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,13 @@
+package cli
+
+import "testing"
+
+func TestLSPToolchainScript(t *testing.T) {
+	c := &LSPAdapterCmd{Server: "srv --stdio", UnitType: "XLSP", LanguageID: "x", Extensions: []string{".x", ".x'y"}}
+	want := `#!/bin/sh
+exec srclib lsp-adapter --server 'srv --stdio' --unit-type 'XLSP' --language-id 'x' --ext '.x' --ext '.x'\''y' "$@"
+`
+	if got := lspToolchainScript(c); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/makex"
+
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// logArgPattern matches the "srclib tool --log" flag (see
+// plan.LogArgs) in a rule's recipes.
+var logArgPattern = regexp.MustCompile(` --log ("(?:[^"\\]|\\.)*")`)
+
+// artifactProducers returns the rules of mf that produce each build
+// data file (relative to the build data directory dataDir): their
+// targets and the logs of the tools that they run.
+func artifactProducers(mf *makex.Makefile, dataDir string) map[string]*buildstore.ArtifactProducer {
+	producers := map[string]*buildstore.ArtifactProducer{}
+	for _, rule := range mf.Rules {
+		var logFiles []string
+		for _, recipe := range rule.Recipes() {
+			for _, m := range logArgPattern.FindAllStringSubmatch(recipe, -1) {
+				if file, err := strconv.Unquote(m[1]); err == nil {
+					logFiles = append(logFiles, file)
+				}
+			}
+		}
+		p := buildstore.ArtifactProducer{Rule: rule.Target()}
+		for _, file := range logFiles {
+			if data, err := ioutil.ReadFile(filepath.FromSlash(file)); err == nil {
+				var l plan.ToolLog
+				if json.Unmarshal(data, &l) == nil {
+					p.Duration += l.Duration
+				}
+			}
+		}
+
+		add := func(file string, u *unit.SourceUnit) {
+			if !strings.HasPrefix(file, dataDir) {
+				return
+			}
+			p := p
+			if u != nil {
+				p.UnitType, p.Unit = u.Type, u.Name
+			}
+			producers[strings.TrimPrefix(file, dataDir)] = &p
+		}
+		var u *unit.SourceUnit
+		if job := newWorkerJob(rule); job != nil {
+			u = job.Unit
+		}
+		if r, ok := rule.(*grapher.GraphMultiUnitsRule); ok {
+			for target, u := range r.Targets() {
+				add(filepath.ToSlash(target), u)
+			}
+		} else {
+			add(filepath.ToSlash(rule.Target()), u)
+		}
+		for _, file := range logFiles {
+			add(file, u)
+		}
+	}
+	return producers
+}
+
+// writeArtifactsManifest writes the artifacts manifest (see
+// buildstore.ArtifactsManifest) for the current repository's commit,
+// attributing its build data files to the rules of mf.
+func writeArtifactsManifest(mf *makex.Makefile) error {
+	localRepo, err := OpenRepo(".")
+	if err != nil {
+		return err
+	}
+	buildStore, err := buildstore.LocalRepo(localRepo.RootDir)
+	if err != nil {
+		return err
+	}
+	bdfs := buildStore.Commit(localRepo.CommitID)
+	dataDir := filepath.ToSlash(filepath.Join(buildstore.BuildDataDirName, localRepo.CommitID)) + "/"
+	artifacts, err := buildstore.ListArtifacts(bdfs, artifactProducers(mf, dataDir))
+	if err != nil {
+		return err
+	}
+	return buildstore.WriteArtifactsManifest(bdfs, &buildstore.ArtifactsManifest{CommitID: localRepo.CommitID, Artifacts: artifacts})
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/makex"
+
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+)
+
+func TestArtifactProducers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	if err := os.MkdirAll("d/u", 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("d/u/T.graph.log.json", []byte(`{"Duration": 2000000000}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mf := &makex.Makefile{Rules: []makex.Rule{
+		&makex.BasicRule{TargetFile: "all", PrereqFiles: []string{"d/u/T.graph.json"}},
+		&makex.BasicRule{TargetFile: "d/u/T.graph.json", RecipeCmds: []string{`srclib tool --log "d/u/T.graph.log.json" "tc" "graph" < $< 1> $@`}},
+	}}
+	got := artifactProducers(mf, "d/")
+	p := &buildstore.ArtifactProducer{Rule: "d/u/T.graph.json", Duration: 2 * time.Second}
+	want := map[string]*buildstore.ArtifactProducer{"u/T.graph.json": p, "u/T.graph.log.json": p}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got producers %+v, want %+v", got, want)
+	}
+}
+
+func TestPrintArtifacts(t *testing.T) {
+	var buf bytes.Buffer
+	printArtifacts(&buf, []*buildstore.Artifact{
+		{Path: "a.json", Size: 12},
+		{Path: "u/T.graph.json", Size: 3, ArtifactProducer: buildstore.ArtifactProducer{UnitType: "T", Unit: "u", Duration: 1500 * time.Millisecond}},
+	})
+	want := "        12  a.json\n         3  u/T.graph.json  (T u, 1.5s)\n2 files, 15 bytes\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got output:\n%s\nwant:\n%s", got, want)
+	}
+}
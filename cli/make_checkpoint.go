@@ -0,0 +1,325 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"sourcegraph.com/sourcegraph/makex"
+
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+)
+
+// makeCheckpointFile is the name of the file (in a commit's build data
+// directory) in which "srclib make" records the rules that it has
+// completed, so that an interrupted make can be resumed (with
+// --resume). It is removed when the make succeeds.
+const makeCheckpointFile = "make-checkpoint.json"
+
+// A makeCheckpointEntry is a line of a make checkpoint file. The first
+// line records when the make started; each of the others records a
+// target that a rule completed (and the target's size and
+// modification time when it did, so that targets that were modified
+// afterwards aren't trusted).
+type makeCheckpointEntry struct {
+	Start *time.Time `json:",omitempty"`
+
+	Target  string     `json:",omitempty"`
+	Size    int64      `json:",omitempty"`
+	ModTime *time.Time `json:",omitempty"`
+}
+
+// makeCheckpoint is a parsed make checkpoint file.
+type makeCheckpoint struct {
+	Start time.Time
+	Done  map[string]makeCheckpointEntry // completed targets
+}
+
+// startMakeCheckpoint creates the make checkpoint file, replacing any
+// existing one, and records that the make started at start.
+func startMakeCheckpoint(file string, start time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	return writeMakeCheckpointEntries(file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, []makeCheckpointEntry{{Start: &start}})
+}
+
+// appendMakeCheckpoint records in the make checkpoint file that the
+// targets were completed.
+func appendMakeCheckpoint(file string, targets []string) error {
+	entries := make([]makeCheckpointEntry, len(targets))
+	for i, target := range targets {
+		fi, err := os.Stat(filepath.FromSlash(target))
+		if err != nil {
+			return err
+		}
+		modTime := fi.ModTime()
+		entries[i] = makeCheckpointEntry{Target: target, Size: fi.Size(), ModTime: &modTime}
+	}
+	return writeMakeCheckpointEntries(file, os.O_APPEND|os.O_WRONLY, entries)
+}
+
+// writeMakeCheckpointEntries writes entries to file in a single write
+// (so that rules that complete at the same time don't interleave
+// their entries).
+func writeMakeCheckpointEntries(file string, flag int, entries []makeCheckpointEntry) (err error) {
+	var data []byte
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	f, err := os.OpenFile(file, flag, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := f.Close()
+		if err == nil {
+			err = err2
+		}
+	}()
+	_, err = f.Write(data)
+	return err
+}
+
+// readMakeCheckpoint reads the make checkpoint file. If there is none,
+// it returns nil and no error. A truncated last line (written when
+// the make was killed) is ignored.
+func readMakeCheckpoint(file string) (*makeCheckpoint, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c := &makeCheckpoint{Done: map[string]makeCheckpointEntry{}}
+	s := bufio.NewScanner(f)
+	for first := true; s.Scan(); first = false {
+		var e makeCheckpointEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			break
+		}
+		switch {
+		case first && e.Start != nil:
+			c.Start = *e.Start
+		case first:
+			return nil, fmt.Errorf("make checkpoint %s has no start time (rerun without --resume to start over)", file)
+		case e.Target != "" && e.ModTime != nil:
+			c.Done[e.Target] = e
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if c.Start.IsZero() {
+		return nil, fmt.Errorf("make checkpoint %s is empty (rerun without --resume to start over)", file)
+	}
+	return c, nil
+}
+
+// completed reports whether a rule of the checkpointed make completed
+// target (whose file info is fi) and target hasn't been modified
+// since.
+func (c *makeCheckpoint) completed(target string, fi os.FileInfo) bool {
+	e, done := c.Done[target]
+	return done && e.Size == fi.Size() && e.ModTime.Equal(fi.ModTime())
+}
+
+// partialTargets returns the existing targets of mf's rules that were
+// modified after the checkpointed make started but that no rule
+// completed (or that were modified again afterwards). They may have
+// been only partly written when the make was interrupted.
+func (c *makeCheckpoint) partialTargets(mf *makex.Makefile, stat func(string) (os.FileInfo, error)) []string {
+	var partial []string
+	for _, rule := range mf.Rules {
+		for _, target := range explainTargets(rule) {
+			fi, err := stat(target)
+			if err != nil || fi.ModTime().Before(c.Start) || c.completed(target, fi) {
+				continue
+			}
+			partial = append(partial, target)
+		}
+	}
+	return partial
+}
+
+// remainingMakefile returns a copy of mf without the rules that the
+// checkpointed make completed (all of whose targets are unchanged
+// since), so that they aren't run again. Rules that build goals, and
+// rules with prerequisites that the remaining rules build, are kept.
+func (c *makeCheckpoint) remainingMakefile(mf *makex.Makefile, goals []string, stat func(string) (os.FileInfo, error)) *makex.Makefile {
+	remaining := map[string]bool{} // targets of the kept rules
+	keep := make([]bool, len(mf.Rules))
+	for i, rule := range mf.Rules {
+		keep[i] = !c.ruleCompleted(rule, stat)
+		for _, goal := range goals {
+			if rule.Target() == goal {
+				keep[i] = true
+			}
+		}
+		if keep[i] {
+			for _, target := range explainTargets(rule) {
+				remaining[target] = true
+			}
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for i, rule := range mf.Rules {
+			if keep[i] {
+				continue
+			}
+			for _, prereq := range rule.Prereqs() {
+				if remaining[prereq] {
+					keep[i], changed = true, true
+					for _, target := range explainTargets(rule) {
+						remaining[target] = true
+					}
+					break
+				}
+			}
+		}
+	}
+
+	var rules []makex.Rule
+	for i, rule := range mf.Rules {
+		if keep[i] {
+			rules = append(rules, rule)
+		}
+	}
+	return &makex.Makefile{Rules: rules}
+}
+
+// ruleCompleted reports whether the checkpointed make completed rule.
+func (c *makeCheckpoint) ruleCompleted(rule makex.Rule, stat func(string) (os.FileInfo, error)) bool {
+	if len(rule.Recipes()) == 0 {
+		return false
+	}
+	for _, target := range explainTargets(rule) {
+		fi, err := stat(target)
+		if err != nil || !c.completed(target, fi) {
+			return false
+		}
+	}
+	return true
+}
+
+// A ruleOutputFunc returns the writers that receive the output of a
+// rule's recipes (see makex.Maker's RuleOutput).
+type ruleOutputFunc func(makex.Rule) (out io.WriteCloser, err io.WriteCloser, logger *log.Logger)
+
+// checkpointRuleOutput returns a RuleOutput for makex that sends the
+// output of each rule to output and that, for the rules that build
+// files in dataDir, records their targets in the make checkpoint file
+// when makex closes the rule's output after running its recipes.
+func checkpointRuleOutput(output ruleOutputFunc, dataDir, file string) ruleOutputFunc {
+	return func(rule makex.Rule) (io.WriteCloser, io.WriteCloser, *log.Logger) {
+		out, errOut, logger := output(rule)
+		if len(rule.Recipes()) == 0 {
+			return out, errOut, logger
+		}
+		targets := explainTargets(rule)
+		for _, target := range targets {
+			if !strings.HasPrefix(target, dataDir) {
+				return out, errOut, logger
+			}
+		}
+		return &checkpointWriter{WriteCloser: out, file: file, targets: targets, start: time.Now()}, errOut, logger
+	}
+}
+
+// A checkpointWriter is the output of a rule that records the rule's
+// targets in the make checkpoint file when it is closed, if the rule
+// wrote all of them (after start, when it began running). A rule
+// whose recipes failed after writing its targets is recorded too,
+// since its targets are newer than its prerequisites and so would be
+// up to date for a make without --resume as well.
+type checkpointWriter struct {
+	io.WriteCloser
+	file    string
+	targets []string
+	start   time.Time
+}
+
+func (w *checkpointWriter) Close() error {
+	err := w.WriteCloser.Close()
+	// Allow for file systems that record modification times only to
+	// the second.
+	start := w.start.Truncate(time.Second)
+	for _, target := range w.targets {
+		if fi, statErr := os.Stat(filepath.FromSlash(target)); statErr != nil || fi.ModTime().Before(start) {
+			return err
+		}
+	}
+	if err2 := appendMakeCheckpoint(w.file, w.targets); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// beginCheckpoint starts recording the rules that the make completes
+// (see makeCheckpointFile). If c.Resume is set, the targets of mf
+// that the interrupted make may have written only partly are removed
+// first (so that they are rebuilt), and the existing checkpoint is
+// kept.
+func (c *MakeCmd) beginCheckpoint(mf *makex.Makefile) error {
+	localRepo, err := OpenRepo(".")
+	if err != nil {
+		return err
+	}
+	dataDir := filepath.ToSlash(filepath.Join(buildstore.BuildDataDirName, localRepo.CommitID)) + "/"
+	file := dataDir + makeCheckpointFile
+	c.checkpointDataDir, c.checkpointFile = dataDir, file
+
+	if c.Resume {
+		cp, err := readMakeCheckpoint(filepath.FromSlash(file))
+		if err != nil {
+			return err
+		}
+		if cp != nil {
+			partial := cp.partialTargets(mf, statTarget)
+			if !c.Quiet {
+				log.Printf("Resuming the make started at %s (%d targets completed, %d partly written targets to rebuild).", cp.Start.Format(time.RFC3339), len(cp.Done), len(partial))
+			}
+			for _, target := range partial {
+				if err := os.Remove(filepath.FromSlash(target)); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
+			c.resumed = cp
+			return nil
+		}
+		if !c.Quiet {
+			log.Printf("No make checkpoint found; running a full make.")
+		}
+	}
+	return startMakeCheckpoint(filepath.FromSlash(file), time.Now())
+}
+
+// endCheckpoint removes the make checkpoint file after a successful
+// make.
+func (c *MakeCmd) endCheckpoint() error {
+	if c.checkpointFile == "" {
+		return nil
+	}
+	if err := os.Remove(filepath.FromSlash(c.checkpointFile)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// statTarget returns the file info of a (slash-separated) target.
+func statTarget(target string) (os.FileInfo, error) {
+	return os.Stat(filepath.FromSlash(target))
+}
@@ -0,0 +1,168 @@
+package cli
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/makex"
+)
+
+func TestMakeCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-make-checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	write := func(name, data string, modTime time.Time) {
+		if err := ioutil.WriteFile(name, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Date(2015, 6, 2, 0, 0, 0, 0, time.UTC)
+	if err := os.MkdirAll("d", 0700); err != nil {
+		t.Fatal(err)
+	}
+	write("d/old", "x", start.Add(-time.Hour)) // built by an earlier make
+	write("d/done", "x", start.Add(time.Minute))
+	write("d/changed", "x", start.Add(time.Minute))
+
+	file := filepath.Join("d", makeCheckpointFile)
+	if err := startMakeCheckpoint(file, start); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendMakeCheckpoint(file, []string{"d/done", "d/changed"}); err != nil {
+		t.Fatal(err)
+	}
+	write("d/changed", "xy", start.Add(2*time.Minute))
+	write("d/partial", "x", start.Add(3*time.Minute))
+
+	// Simulate a make that was killed while writing an entry.
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte(`{"Target":"d/par`)); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	cp, err := readMakeCheckpoint(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cp.Start.Equal(start) || len(cp.Done) != 2 {
+		t.Errorf("got checkpoint %+v", cp)
+	}
+
+	mf := &makex.Makefile{Rules: []makex.Rule{
+		&makex.BasicRule{TargetFile: "all", PrereqFiles: []string{"d/old"}},
+		&makex.BasicRule{TargetFile: "d/old", RecipeCmds: []string{"true"}},
+		&makex.BasicRule{TargetFile: "d/done", RecipeCmds: []string{"true"}},
+		&makex.BasicRule{TargetFile: "d/changed", RecipeCmds: []string{"true"}},
+		&makex.BasicRule{TargetFile: "d/partial", RecipeCmds: []string{"true"}},
+		&makex.BasicRule{TargetFile: "d/missing", RecipeCmds: []string{"true"}},
+	}}
+	if got, want := cp.partialTargets(mf, os.Stat), []string{"d/changed", "d/partial"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got partial targets %v, want %v", got, want)
+	}
+
+	if cp, err := readMakeCheckpoint("nonexistent"); cp != nil || err != nil {
+		t.Errorf("got %v, %v for missing checkpoint, want nil, nil", cp, err)
+	}
+
+	// The completed rules aren't run again, unless they build a goal
+	// or a prerequisite of theirs is rebuilt.
+	mf.Rules = append(mf.Rules,
+		&makex.BasicRule{TargetFile: "d/goal", PrereqFiles: []string{"d/done"}, RecipeCmds: []string{"true"}},
+		&makex.BasicRule{TargetFile: "d/after", PrereqFiles: []string{"d/partial"}, RecipeCmds: []string{"true"}},
+	)
+	for _, target := range []string{"d/goal", "d/after"} {
+		modTime := start.Add(time.Minute)
+		write(target, "x", modTime)
+		cp.Done[target] = makeCheckpointEntry{Target: target, Size: 1, ModTime: &modTime}
+	}
+	var remaining []string
+	for _, rule := range cp.remainingMakefile(mf, []string{"d/goal"}, os.Stat).Rules {
+		remaining = append(remaining, rule.Target())
+	}
+	if want := []string{"all", "d/old", "d/changed", "d/partial", "d/missing", "d/goal", "d/after"}; !reflect.DeepEqual(remaining, want) {
+		t.Errorf("got remaining rules %v, want %v", remaining, want)
+	}
+}
+
+func TestCheckpointRuleOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-make-checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	if err := os.MkdirAll("d", 0700); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join("d", makeCheckpointFile)
+	if err := startMakeCheckpoint(file, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	var outputs []makex.Rule
+	output := checkpointRuleOutput(func(r makex.Rule) (io.WriteCloser, io.WriteCloser, *log.Logger) {
+		outputs = append(outputs, r)
+		return nopWriteCloser{}, nopWriteCloser{}, log.New(nopWriteCloser{}, "", 0)
+	}, "d/", file)
+
+	run := func(rule *makex.BasicRule, write bool) {
+		out, _, _ := output(rule)
+		if write {
+			if err := ioutil.WriteFile(filepath.FromSlash(rule.TargetFile), []byte("x"), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := out.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run(&makex.BasicRule{TargetFile: "d/built", RecipeCmds: []string{"true"}}, true)
+	run(&makex.BasicRule{TargetFile: "d/failed", RecipeCmds: []string{"false"}}, false)
+	run(&makex.BasicRule{TargetFile: "outside", RecipeCmds: []string{"true"}}, true)
+	if len(outputs) != 3 {
+		t.Errorf("got output for %d rules, want 3", len(outputs))
+	}
+
+	cp, err := readMakeCheckpoint(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var done []string
+	for target := range cp.Done {
+		done = append(done, target)
+	}
+	if want := []string{"d/built"}; !reflect.DeepEqual(done, want) {
+		t.Errorf("got completed targets %v, want %v", done, want)
+	}
+}
@@ -2,27 +2,59 @@ package cli
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strings"
 
 	"github.com/alexsaveliev/go-colorable-wrapper"
 	"sourcegraph.com/sourcegraph/go-flags"
 
 	"sourcegraph.com/sourcegraph/makex"
+	"sourcegraph.com/sourcegraph/rwvfs"
 	"sourcegraph.com/sourcegraph/srclib"
 	"sourcegraph.com/sourcegraph/srclib/buildstore"
 	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/dep"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
 	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
 )
 
 func init() {
 	cliInit = append(cliInit, func(cli *flags.Command) {
 		_, err := cli.AddCommand("make",
 			"plans and executes plan",
-			`Generates a plan (in Makefile form, in memory) for analyzing the tree and executes the plan. `,
+			`Generates a plan (in Makefile form, in memory) for analyzing the tree and executes the plan.
+
+If the cached config (created by "srclib config") is missing or was created from a different Srcfile, profile, or set of installed toolchains, it is recreated first.
+
+With --commits A..B, each commit in the range (that is reachable from B but not from A) is checked out and built in turn, oldest first, and the originally checked-out revision is restored afterwards. The working tree must be clean (srclib refuses to run if tracked files have uncommitted changes). Build data for source units whose definition and files are unchanged since the previous commit in the range is copied instead of being recomputed. The files renamed since the previous commit are recorded in each commit's build data (in renames.json); build data for a source unit whose files were only renamed is also copied, with the renamed files' paths updated, unless its def paths may depend on the files' names.
+
+With --only-units, --only-types, or --only-langs, only the matching source units are built (e.g., to iterate on one toolchain without waiting for the others' graphers). Units are matched by exact name, by type, or by the language of any of their files (as in "srclib units --lang").
+
+Source units are graphed after the units in the same repository that their dependency resolution output says they depend on (resolutions without a repository clone URL), and the graph output files of those units are passed to the grapher in $SRCLIB_DEP_GRAPH_DATA. If some units' dependencies haven't been resolved yet, they are resolved before the other rules are planned.
+
+With --explain, nothing is built; instead, each rule is listed with whether it will run or be skipped and why: a missing target, inputs that changed since the target was built (which are listed), a prerequisite that will be rebuilt, or a change in the version of a toolchain that produced the target (unless --keep-stale is given). If multiple toolchains can graph (or resolve the dependencies of) a type of source unit, the one whose scanner gives the highest confidence score for a sample of the units' files is used, and the scores are shown too. Use --format json for machine-readable output.
+
+Each completed rule is recorded in a checkpoint file in the build data directory (which is removed when the make succeeds). With --resume, an interrupted make (e.g., one that was killed) continues where it left off: the targets that it wrote but whose rules it didn't complete (which may be only partly written) are removed and rebuilt, along with the rules that it hadn't run yet.
+
+With --max-memory MB, the tools that the rules run (in parallel, up to --jobs) reserve the memory that they are expected to need from the budget before they start, waiting while the tools already running have reserved too much of it. A tool is expected to need the peak memory that it used on the same source unit in the previous make (as recorded in its log), or else the memory that its Srclibtoolchain file declares (the tool's "Memory", in megabytes), or else 512 MB. A tool (with its child processes) that uses more than its reservation plus --memory-slack is killed, so that one runaway unit can't take the memory reserved by the others. Memory is only measured (and tools only killed) on Linux; on other platforms, the reservations only limit how many tools run at once.
+
+With --scheduler grpc://HOST:PORT[,HOST:PORT...], the rules that graph a single source unit or resolve its dependencies are run on the listed "srclib worker" daemons (spread across them, up to --jobs at a time) instead of locally: each rule's source unit, unit files, and prerequisite build data files are sent to a worker, which makes and runs the rule with its own installed tools, and the build data that it creates is written back to the build data directory. Units are sent after the units that they depend on are graphed. The remaining rules run locally. The workers should have the same toolchain versions installed. Workers are reached over gRPC; use grpcs:// to connect over TLS (verifying the workers' certificates with --scheduler-ca, and presenting the client certificate in --scheduler-cert and --scheduler-key, if the workers require one). Requests are authenticated with the shared token in $`+WorkerTokenEnv+` (see "srclib worker").
+
+With --metrics-push URL or --metrics-file FILE, Prometheus metrics about each make are pushed to a Pushgateway (as job `+makeMetricsJob+`, grouped by repository) or written to a file (e.g., for node_exporter's textfile collector) when it finishes, so that analysis pipelines can be monitored without scraping logs: the number of source units graphed and resolved by toolchain and result (srclib_make_units_total, whose result is built or failed), the duration (srclib_make_duration_seconds), and whether it succeeded (srclib_make_success). Requests to the Pushgateway are authenticated with the configured credential helpers (see "srclib buildstore sync"). Failing to report metrics doesn't fail the make.
+
+After a successful make, a manifest listing every build data file for the commit (with its size, checksum, data type, the rule and source unit that produced it, and how long the rule's tool took) is written to `+buildstore.ArtifactsManifestName+` in the commit's build data directory. List it with "srclib buildstore ls".
+
+With --tree DIR@REV or --tree ARCHIVE, a source tree that isn't checked out is built: a revision of a git repository (which may be bare; files are read from its object store) or a .zip, .tar, .tar.gz, or .tgz archive. Its files are materialized into a directory (--tree-dir, or by default one in the system's temporary directory that is reused for the same tree, so that its build data is kept between runs), and the make runs there. With --tree-path DIR (which may be repeated), only the files in those directories and the tree's top-level files are materialized, so that a unit of a huge repository can be built without checking all of it out (scanners then only see those files). The commit ID of the build data is the git commit's ID or the SHA-1 of the archive.
+
+With --workspace FILE, the command (with its other options) is run in each repository listed in the workspace file, and the repositories that failed to build are reported at the end.`,
 			&makeCmd,
 		)
 		if err != nil {
@@ -35,36 +67,317 @@ type MakeCmd struct {
 	Quiet  bool `short:"q" long:"quiet" description:"silence all output"`
 	DryRun bool `short:"n" long:"dry-run" description:"print what would be done and exit"`
 
+	Explain bool   `long:"explain" description:"print whether each rule will run or be skipped, and why, and exit"`
+	Format  string `long:"format" description:"output format of --explain" default:"text" value-name:"text|json"`
+
 	Parallel int `short:"j" long:"jobs" description:"allow N parallel jobs" value-name:"N" default-mask:"GOMAXPROCS"`
 
 	Dir Directory `short:"C" long:"directory" description:"change to DIR before doing anything" value-name:"DIR"`
 
+	Profile string `long:"profile" description:"apply the named profile's skip rules and limits from the Srcfile (default: $SRCLIB_PROFILE)" value-name:"NAME"`
+	NoCache bool   `long:"no-cache" description:"recreate the cached config (as 'srclib config' does) even if it is up to date"`
+
+	KeepStale bool `long:"keep-stale" description:"don't rebuild build data that was produced by different toolchain versions than the installed ones (only warn about it)"`
+
+	Commits string `long:"commits" description:"build each commit in the range A..B, oldest first" value-name:"A..B"`
+
+	MaxMemory   int64 `long:"max-memory" description:"limit the memory reserved by the tools running at once to MB megabytes, and (on Linux only) kill tools that use more than they reserved" value-name:"MB"`
+	MemorySlack int64 `long:"memory-slack" description:"with --max-memory, let tools use up to MB megabytes more than they reserved before they're killed" default:"256" value-name:"MB"`
+
+	Resume bool `long:"resume" description:"resume an interrupted make, rebuilding only the rules that it hadn't completed"`
+
+	Scheduler     string `long:"scheduler" description:"run source unit rules on the 'srclib worker' daemons at these addresses" value-name:"grpc[s]://HOST:PORT[,HOST:PORT...]"`
+	SchedulerCA   string `long:"scheduler-ca" description:"verify the certificates of grpcs:// workers with the CAs in this PEM file (default: the system's CAs)" value-name:"FILE"`
+	SchedulerCert string `long:"scheduler-cert" description:"present the PEM client certificate in this file to grpcs:// workers (requires --scheduler-key)" value-name:"FILE"`
+	SchedulerKey  string `long:"scheduler-key" description:"PEM private key of the --scheduler-cert certificate" value-name:"FILE"`
+
+	MetricsPush string `long:"metrics-push" description:"push Prometheus metrics about the make (duration, outcome, and source units built and failed by toolchain) to the Pushgateway at this URL" value-name:"URL"`
+	MetricsFile string `long:"metrics-file" description:"write Prometheus metrics about the make to this file (e.g., for node_exporter's textfile collector)" value-name:"FILE"`
+
+	OnlyUnitsOpt
+
+	WorkspaceOpt
+
+	TreeOpt
+
 	Args struct {
 		Goals []string `name:"GOALS..." description:"Makefile targets to build (default: all)"`
 	} `positional-args:"yes"`
+
+	// checkpointDataDir and checkpointFile are the build data directory
+	// and the make checkpoint file (see beginCheckpoint) of the make
+	// being run, if any.
+	checkpointDataDir, checkpointFile string
+
+	// resumed is the checkpoint of the interrupted make that is being
+	// resumed, if any.
+	resumed *makeCheckpoint
+
+	// metrics are the metrics of the make being run, if they are
+	// pushed or written (see MetricsPush and MetricsFile).
+	metrics *makeMetrics
 }
 
 var makeCmd MakeCmd
 
 func (c *MakeCmd) Execute(args []string) error {
+	if c.Workspace != "" {
+		return runInWorkspace(c.Workspace)
+	}
+	if c.Tree != "" {
+		if c.Dir != "" {
+			return errors.New("--tree can't be used with -C/--directory")
+		}
+		if err := c.useTree(); err != nil {
+			return err
+		}
+	}
+	if c.Dir != "" {
+		if err := os.Chdir(c.Dir.String()); err != nil {
+			return err
+		}
+		if _, err := srclib.UseProjectToolchains("."); err != nil {
+			return err
+		}
+	}
+
+	profile := profileName(c.Profile)
+	if c.Parallel == 0 && profile != "" {
+		p, err := readProfile(".", profile)
+		if err != nil {
+			return err
+		}
+		c.Parallel = p.Jobs
+	}
 	if c.Parallel == 0 {
 		c.Parallel = runtime.GOMAXPROCS(0)
 	}
 	if c.Parallel <= 0 {
 		return errors.New("-j/--jobs (parallelism) must be > 0")
 	}
+	if c.MaxMemory < 0 {
+		return errors.New("--max-memory must be >= 0")
+	}
+	if c.MemorySlack < 0 {
+		return errors.New("--memory-slack must be >= 0")
+	}
 
-	if c.Dir != "" {
-		if err := os.Chdir(c.Dir.String()); err != nil {
-			return err
+	if c.Commits != "" {
+		if len(c.Args.Goals) > 0 {
+			return errors.New("--commits can't be used with GOALS")
+		}
+		if c.Explain {
+			return errors.New("--commits can't be used with --explain")
 		}
+		if c.Scheduler != "" {
+			return errors.New("--commits can't be used with --scheduler")
+		}
+		if c.Resume {
+			return errors.New("--commits can't be used with --resume")
+		}
+		return c.makeCommits(profile)
+	}
+
+	if c.Scheduler != "" && len(c.Args.Goals) > 0 {
+		return errors.New("--scheduler can't be used with GOALS")
+	}
+
+	if err := ensureCachedConfig(profile, c.NoCache); err != nil {
+		return err
+	}
+	mf, err := CreateMakefile(profile, &c.OnlyUnitsOpt)
+	if err != nil {
+		return err
+	}
+	if c.Explain {
+		return c.explain(mf)
+	}
+	if c.DryRun {
+		return c.run(mf)
+	}
+	return c.build(profile, mf)
+}
+
+// build records the versions of the toolchains that the Makefile mf
+// (created by CreateMakefile for profile) runs, executes it (see
+// stampToolchainVersions and runAndStampSchema), and writes the
+// artifacts manifest (see writeArtifactsManifest). If metrics are
+// requested, they are reported when it finishes (see makeMetrics).
+//
+// If no goals were given and some source units' dependencies haven't
+// been resolved yet, they are resolved first, and the Makefile is
+// recreated, so that units are graphed after the units in the
+// repository that they depend on (see grapher.DepGraphDataEnv).
+func (c *MakeCmd) build(profile string, mf *makex.Makefile) (err error) {
+	if c.MetricsPush != "" || c.MetricsFile != "" {
+		c.metrics = newMakeMetrics()
+		defer func() {
+			c.metrics.report(err, c.MetricsPush, c.MetricsFile)
+			c.metrics = nil
+		}()
+	}
+	if err := c.beginCheckpoint(mf); err != nil {
+		return err
+	}
+	if err := stampToolchainVersions(mf, !c.KeepStale); err != nil {
+		return err
+	}
+	if len(c.Args.Goals) == 0 {
+		if depMf := unresolvedDepsMakefile(mf); depMf != nil {
+			if !c.Quiet {
+				log.Printf("Resolving the dependencies of %d source units before graphing them.", len(depMf.Rules)-1)
+			}
+			if err := c.runAndStampSchema(depMf); err != nil {
+				return err
+			}
+			var err error
+			if mf, err = CreateMakefile(profile, &c.OnlyUnitsOpt); err != nil {
+				return err
+			}
+		}
+	}
+	if err := c.runAndStampSchema(mf); err != nil {
+		return err
+	}
+	if err := c.endCheckpoint(); err != nil {
+		return err
+	}
+	return writeArtifactsManifest(mf)
+}
+
+// unresolvedDepsMakefile returns a Makefile with the rules of mf that
+// resolve the dependencies of source units whose dependencies haven't
+// been resolved yet, or nil if there are none.
+func unresolvedDepsMakefile(mf *makex.Makefile) *makex.Makefile {
+	var rules []makex.Rule
+	var targets []string
+	for _, rule := range mf.Rules {
+		if r, ok := rule.(*dep.ResolveDepsRule); ok {
+			if _, err := os.Stat(filepath.FromSlash(r.Target())); os.IsNotExist(err) {
+				rules = append(rules, r)
+				targets = append(targets, r.Target())
+			}
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	all := &makex.BasicRule{TargetFile: "all", PrereqFiles: targets}
+	return &makex.Makefile{Rules: append([]makex.Rule{all}, rules...)}
+}
+
+// runAndStampSchema executes the Makefile mf (see run) and records the
+// current build data schema version (see buildstore.SchemaVersion) of
+// the build data files that it creates or rebuilds (whose modification
+// times or sizes changed during the run). Existing files that weren't
+// rebuilt and were written with an older schema version are kept, and
+// a warning is logged.
+func (c *MakeCmd) runAndStampSchema(mf *makex.Makefile) error {
+	localRepo, err := OpenRepo(".")
+	if err != nil {
+		return err
+	}
+	buildStore, err := buildstore.LocalRepo(localRepo.RootDir)
+	if err != nil {
+		return err
+	}
+	bdfs := buildStore.Commit(localRepo.CommitID)
+	schema, err := buildstore.ReadSchema(bdfs)
+	if err != nil {
+		return err
 	}
 
-	mf, err := CreateMakefile()
+	dataDir := filepath.ToSlash(filepath.Join(buildstore.BuildDataDirName, localRepo.CommitID)) + "/"
+	var files []string
+	for _, file := range ruleTargets(mf, dataDir) {
+		if dataType, _ := buildstore.DataType(file); dataType == "" {
+			continue
+		}
+		files = append(files, file)
+	}
+	before, err := statFiles(bdfs, files)
 	if err != nil {
 		return err
 	}
 
+	runErr := c.metrics.run(mf, func() error { return c.run(mf) })
+
+	after, err := statFiles(bdfs, files)
+	if err != nil && runErr == nil {
+		return err
+	}
+	built := changedFiles(before, after)
+	old := 0
+	for file := range after {
+		if !built[file] && schema.Version(file) < buildstore.SchemaVersion {
+			old++
+		}
+	}
+	var stamp []string
+	for file := range built {
+		stamp = append(stamp, file)
+	}
+	if old > 0 && !c.Quiet {
+		log.Println(colorable.Yellow(fmt.Sprintf("Warning: %d build data files were written with an older schema version; upgrade them by running '%s buildstore migrate'.", old, srclib.CommandName)))
+	}
+	if err := buildstore.StampSchema(bdfs, stamp); err != nil && runErr == nil {
+		return err
+	}
+	return runErr
+}
+
+// statFiles returns the FileInfos of those of files that exist in fs.
+func statFiles(fs rwvfs.FileSystem, files []string) (map[string]os.FileInfo, error) {
+	fis := make(map[string]os.FileInfo, len(files))
+	for _, file := range files {
+		fi, err := fs.Stat(file)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		fis[file] = fi
+	}
+	return fis, nil
+}
+
+// changedFiles returns the files in after that weren't in before or
+// whose modification times or sizes differ (i.e., that were created or
+// rebuilt in between).
+func changedFiles(before, after map[string]os.FileInfo) map[string]bool {
+	changed := map[string]bool{}
+	for file, fi := range after {
+		if prev, ok := before[file]; !ok || !fi.ModTime().Equal(prev.ModTime()) || fi.Size() != prev.Size() {
+			changed[file] = true
+		}
+	}
+	return changed
+}
+
+// ruleTargets returns the targets of mf's rules that are in the build
+// data directory dataDir, relative to it.
+func ruleTargets(mf *makex.Makefile, dataDir string) []string {
+	var files []string
+	add := func(target string) {
+		if strings.HasPrefix(target, dataDir) {
+			files = append(files, strings.TrimPrefix(target, dataDir))
+		}
+	}
+	for _, rule := range mf.Rules {
+		if r, ok := rule.(*grapher.GraphMultiUnitsRule); ok {
+			for target := range r.Targets() {
+				add(filepath.ToSlash(target))
+			}
+			continue
+		}
+		add(filepath.ToSlash(rule.Target()))
+	}
+	sort.Strings(files)
+	return files
+}
+
+// run executes the Makefile mf.
+func (c *MakeCmd) run(mf *makex.Makefile) error {
 	goals := c.Args.Goals
 	if len(goals) == 0 {
 		if defaultRule := mf.DefaultRule(); defaultRule != nil {
@@ -72,9 +385,14 @@ func (c *MakeCmd) Execute(args []string) error {
 		}
 	}
 
+	mkMf := mf
+	if c.resumed != nil {
+		mkMf = c.resumed.remainingMakefile(mf, goals, statTarget)
+	}
+
 	mkConf := &makex.Default
 	mkConf.ParallelJobs = c.Parallel
-	mk := mkConf.NewMaker(mf, goals...)
+	mk := mkConf.NewMaker(mkMf, goals...)
 	mk.Verbose = GlobalOpt.Verbose
 
 	if c.Quiet {
@@ -83,11 +401,33 @@ func (c *MakeCmd) Execute(args []string) error {
 				log.New(nopWriteCloser{}, "", 0)
 		}
 	}
+	if c.checkpointFile != "" && !c.DryRun {
+		output := mk.RuleOutput
+		if output == nil {
+			output = func(r makex.Rule) (out io.WriteCloser, err io.WriteCloser, logger *log.Logger) {
+				return stdWriteCloser{os.Stdout}, stdWriteCloser{os.Stderr}, log.New(os.Stderr, "", 0)
+			}
+		}
+		mk.RuleOutput = checkpointRuleOutput(output, c.checkpointDataDir, c.checkpointFile)
+	}
 
 	if c.DryRun {
 		return mk.DryRun(os.Stdout)
 	}
-	err = mk.Run()
+	if c.MaxMemory > 0 {
+		stop, err := startMemoryBudget(c.MaxMemory, c.MemorySlack)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+	var err error
+	if c.Scheduler != "" {
+		err = c.runRemote(mf)
+	}
+	if err == nil {
+		err = mk.Run()
+	}
 	switch {
 	case c.Quiet:
 		// Skip output
@@ -101,8 +441,11 @@ func (c *MakeCmd) Execute(args []string) error {
 
 // CreateMakefile creates a Makefile to build a tree. The cwd should
 // be the root of the tree you want to make (due to some probably
-// unnecessary assumptions that CreateMaker makes).
-func CreateMakefile() (*makex.Makefile, error) {
+// unnecessary assumptions that CreateMaker makes). If profile is
+// non-empty, only the source units that the named Srcfile profile
+// doesn't skip are built. If only is non-nil, only the source units
+// that it selects are built.
+func CreateMakefile(profile string, only *OnlyUnitsOpt) (*makex.Makefile, error) {
 	localRepo, err := OpenRepo(".")
 	if err != nil {
 		return nil, err
@@ -116,6 +459,35 @@ func CreateMakefile() (*makex.Makefile, error) {
 	if err != nil {
 		return nil, err
 	}
+	if profile != "" {
+		p, err := readProfile(localRepo.RootDir, profile)
+		if err != nil {
+			return nil, err
+		}
+		treeConfig.SourceUnits = filterUnitsForProfile(treeConfig.SourceUnits, p)
+	}
+	if sel := only.selector(); sel != nil && len(treeConfig.SourceUnits) > 0 {
+		n := len(treeConfig.SourceUnits)
+		treeConfig.SourceUnits = sel.selectUnits(treeConfig.SourceUnits)
+		if len(treeConfig.SourceUnits) == 0 {
+			return nil, fmt.Errorf("none of the %d source units match the --only-units, --only-types, and --only-langs filters", n)
+		}
+		log.Printf("Building %d of %d source units (selected by --only-* filters).", len(treeConfig.SourceUnits), n)
+	}
+
+	// The cached config doesn't record the Srcfile's graph
+	// post-processors, stitchers, test file patterns, or network
+	// settings.
+	cfg, err := config.ReadRepository(localRepo.RootDir)
+	if err != nil {
+		return nil, err
+	}
+	treeConfig.GraphPostProcessors = cfg.GraphPostProcessors
+	treeConfig.Stitchers = cfg.Stitchers
+	treeConfig.TestFiles = cfg.TestFiles
+	if err := applyNetworkConfig(cfg); err != nil {
+		return nil, err
+	}
 	if len(treeConfig.SourceUnits) == 0 {
 		log.Printf("No source unit files found. Did you mean to run `%s config`? (This is not an error; it just means that srclib didn't find anything to build or analyze here.)", srclib.CommandName)
 	}
@@ -128,3 +500,178 @@ func CreateMakefile() (*makex.Makefile, error) {
 	}
 	return mf, nil
 }
+
+// stampToolchainVersions records the versions of the toolchains that
+// the Makefile mf runs, and of those that produce each of its rules'
+// targets, in the current repository's build data for the current
+// commit (see toolchain.WriteVersions), so that it's known which
+// toolchain versions produced the build data.
+//
+// Existing targets that were produced by different toolchain versions
+// than the installed ones (or by unknown versions) are stale. If
+// rebuildStale is true, they are removed, so that mf rebuilds them;
+// otherwise, they are kept (and their old versions remain recorded),
+// and a warning is logged.
+func stampToolchainVersions(mf *makex.Makefile, rebuildStale bool) error {
+	localRepo, err := OpenRepo(".")
+	if err != nil {
+		return err
+	}
+	buildStore, err := buildstore.LocalRepo(localRepo.RootDir)
+	if err != nil {
+		return err
+	}
+	bdfs := buildStore.Commit(localRepo.CommitID)
+	old, err := toolchain.ReadVersions(bdfs)
+	if os.IsNotExist(err) {
+		old = &toolchain.BuildVersions{}
+	} else if err != nil {
+		return err
+	}
+	recs, targetVersions, err := ruleToolchainVersions(mf)
+	if err != nil {
+		return err
+	}
+
+	// Stamp each rule's targets, and remove (or keep) stale ones.
+	dataDir := filepath.ToSlash(filepath.Join(buildstore.BuildDataDirName, localRepo.CommitID)) + "/"
+	v := &toolchain.BuildVersions{Toolchains: recs, Targets: map[string]toolchain.TargetVersions{}}
+	stale := 0
+	for target, cur := range targetVersions {
+		file := strings.TrimPrefix(target, dataDir)
+		v.Targets[file] = cur
+		if _, err := bdfs.Stat(file); os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if prev, present := old.Targets[file]; present && prev.Equal(cur) {
+			continue
+		}
+		stale++
+		if rebuildStale {
+			if err := bdfs.Remove(file); err != nil {
+				return err
+			}
+		} else if prev, present := old.Targets[file]; present {
+			v.Targets[file] = prev
+		} else {
+			delete(v.Targets, file)
+		}
+	}
+	if stale > 0 {
+		if rebuildStale {
+			log.Printf("Rebuilding %d build data files that were produced by different toolchain versions than the installed ones.", stale)
+		} else {
+			log.Println(colorable.Yellow(fmt.Sprintf("Warning: %d build data files were produced by different toolchain versions than the installed ones; rebuild them by running without --keep-stale.", stale)))
+		}
+	}
+	return toolchain.WriteVersions(bdfs, v)
+}
+
+// ruleToolchainVersions returns the versions of the toolchains that
+// the Makefile mf runs, and the versions of the toolchains (the
+// grapher or dep resolver and any post-processors) that produce each
+// of its rules' targets, keyed by target.
+func ruleToolchainVersions(mf *makex.Makefile) ([]*toolchain.VersionRecord, map[string]toolchain.TargetVersions, error) {
+	ruleTools := map[string][]*srclib.ToolRef{} // target -> tools
+	seen := map[string]bool{}
+	var paths []string
+	add := func(targets []string, tools ...*srclib.ToolRef) {
+		var ts []*srclib.ToolRef
+		for _, t := range tools {
+			if t == nil {
+				continue
+			}
+			ts = append(ts, t)
+			if !seen[t.Toolchain] {
+				seen[t.Toolchain] = true
+				paths = append(paths, t.Toolchain)
+			}
+		}
+		if len(ts) == 0 {
+			return
+		}
+		for _, target := range targets {
+			ruleTools[target] = ts
+		}
+	}
+	for _, rule := range mf.Rules {
+		switch r := rule.(type) {
+		case *grapher.GraphUnitRule:
+			add([]string{r.Target()}, append([]*srclib.ToolRef{r.Tool}, r.PostProcessors...)...)
+		case *grapher.GraphMultiUnitsRule:
+			var targets []string
+			for target := range r.Targets() {
+				targets = append(targets, target)
+			}
+			add(targets, append([]*srclib.ToolRef{r.Tool}, r.PostProcessors...)...)
+		case *dep.ResolveDepsRule:
+			add([]string{r.Target()}, r.Tool)
+		}
+	}
+	recs, err := toolchain.Versions(paths)
+	if err != nil {
+		return nil, nil, err
+	}
+	versions := make(map[string]string, len(recs))
+	for _, rec := range recs {
+		versions[rec.Path] = rec.Version
+	}
+
+	targetVersions := make(map[string]toolchain.TargetVersions, len(ruleTools))
+	for target, tools := range ruleTools {
+		cur := toolchain.TargetVersions{}
+		for _, t := range tools {
+			cur[t.Toolchain] = versions[t.Toolchain]
+		}
+		targetVersions[target] = cur
+	}
+	return recs, targetVersions, nil
+}
+
+// readProfile reads the named profile from the Srcfile of the
+// repository containing dir.
+func readProfile(dir, name string) (*config.Profile, error) {
+	r, err := OpenRepo(dir)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.ReadRepository(r.RootDir)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Profile(name)
+}
+
+// filterUnitsForProfile returns the units that are not skipped by the
+// profile p, up to p.MaxUnits units. The cached source units were
+// scanned with the Srcfile's (and possibly another profile's) skip
+// rules, so p's skip rules are applied again here.
+func filterUnitsForProfile(units []*unit.SourceUnit, p *config.Profile) []*unit.SourceUnit {
+	var kept []*unit.SourceUnit
+	for _, u := range units {
+		if p.MaxUnits > 0 && len(kept) == p.MaxUnits {
+			log.Printf("Profile limits the build to %d source units; skipping the remaining %d.", p.MaxUnits, len(units)-len(kept))
+			break
+		}
+		unitDir := u.Dir
+		if unitDir == "" && len(u.Files) > 0 {
+			unitDir = filepath.Dir(u.Files[0])
+		}
+		if pathHasAnyPrefix(unitDir, p.SkipDirs) {
+			continue
+		}
+		skip := false
+		for _, skipUnit := range p.SkipUnits {
+			if u.Name == skipUnit.Name && u.Type == skipUnit.Type {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			kept = append(kept, u)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+)
+
+func TestChangedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-changed-files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, data string, modTime time.Time) {
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Date(2015, 6, 2, 0, 0, 0, 0, time.UTC)
+	write("kept.graph.json", "x", start)
+	write("rebuilt.graph.json", "x", start)
+	write("resized.graph.json", "x", start)
+
+	fs := rwvfs.OS(dir)
+	files := []string{"kept.graph.json", "rebuilt.graph.json", "resized.graph.json", "created.graph.json", "missing.graph.json"}
+	before, err := statFiles(fs, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write("rebuilt.graph.json", "y", start.Add(time.Minute))
+	write("resized.graph.json", "xy", start)
+	write("created.graph.json", "x", start)
+
+	after, err := statFiles(fs, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{"rebuilt.graph.json": true, "resized.graph.json": true, "created.graph.json": true}
+	if changed := changedFiles(before, after); !reflect.DeepEqual(changed, want) {
+		t.Errorf("got changed files %v, want %v", changed, want)
+	}
+}
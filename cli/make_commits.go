@@ -0,0 +1,704 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/dep"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+	"sourcegraph.com/sourcegraph/srclib/vcs"
+)
+
+// parseCommitRange parses a commit range of the form "A..B".
+func parseCommitRange(r string) (base, head string, err error) {
+	i := strings.Index(r, "..")
+	if i == -1 || strings.Contains(r, "...") {
+		return "", "", fmt.Errorf("invalid commit range %q (expected A..B)", r)
+	}
+	base, head = r[:i], r[i+2:]
+	if base == "" || head == "" {
+		return "", "", fmt.Errorf("invalid commit range %q (expected A..B)", r)
+	}
+	return base, head, nil
+}
+
+// makeCommits builds each commit in the range c.Commits, oldest
+// first, reusing the build data of unchanged (or only renamed) source
+// units from the previous commit. The files that were renamed since
+// the previous commit are recorded in each commit's build data (see
+// buildstore.Renames).
+func (c *MakeCmd) makeCommits(profile string) (err error) {
+	base, head, err := parseCommitRange(c.Commits)
+	if err != nil {
+		return err
+	}
+	repo, err := OpenRepo(".")
+	if err != nil {
+		return err
+	}
+	commits, err := repo.VCS.Commits(repo.RootDir, base, head)
+	if err != nil {
+		return err
+	}
+	if len(commits) == 0 {
+		return fmt.Errorf("no commits in range %s", c.Commits)
+	}
+	if c.DryRun {
+		for _, commitID := range commits {
+			fmt.Println(commitID)
+		}
+		return nil
+	}
+
+	// Uncommitted changes would be carried over into (or conflict
+	// with) each commit that is checked out.
+	if dirty, err := repo.VCS.Dirty(repo.RootDir); err != nil {
+		return err
+	} else if dirty {
+		return fmt.Errorf("the working tree of %s has uncommitted changes (commit or stash them to build commits %s)", repo.RootDir, c.Commits)
+	}
+
+	buildStore, err := buildstore.LocalRepo(repo.RootDir)
+	if err != nil {
+		return err
+	}
+
+	var (
+		restore    string             // revision to check out when done
+		prevCommit string             // previously built commit
+		prevHashes map[unit.ID]string // content hashes of prevCommit's units
+	)
+	defer func() {
+		if restore == "" {
+			return
+		}
+		if _, err2 := repo.VCS.Checkout(repo.RootDir, restore); err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	for i, commitID := range commits {
+		prev, err := repo.VCS.Checkout(repo.RootDir, commitID)
+		if err != nil {
+			return err
+		}
+		if restore == "" {
+			restore = prev
+		}
+		if !c.Quiet {
+			log.Printf("Building commit %s (%d of %d)", commitID, i+1, len(commits))
+		}
+
+		if err := ensureCachedConfig(profile, c.NoCache); err != nil {
+			return err
+		}
+		units, err := cachedUnits(buildStore, commitID)
+		if err != nil {
+			return err
+		}
+		hashes, err := unitContentHashes(repo.RootDir, units)
+		if err != nil {
+			return err
+		}
+		if prevCommit != "" {
+			renames, err := recordRenames(repo, buildStore, prevCommit, commitID)
+			if err != nil {
+				return err
+			}
+			n, err := reuseUnitBuildData(buildStore, repo.RootDir, prevCommit, commitID, prevHashes, hashes, renames)
+			if err != nil {
+				return err
+			}
+			if !c.Quiet && n > 0 {
+				log.Printf("Reused build data for %d of %d source units from commit %s.", n, len(units), prevCommit)
+			}
+		}
+
+		mf, err := CreateMakefile(profile, &c.OnlyUnitsOpt)
+		if err != nil {
+			return err
+		}
+		if err := c.build(profile, mf); err != nil {
+			return fmt.Errorf("commit %s: %s", commitID, err)
+		}
+		prevCommit, prevHashes = commitID, hashes
+	}
+	return nil
+}
+
+// cachedUnits returns the source units in the cached config for
+// commitID.
+func cachedUnits(bs buildstore.RepoBuildStore, commitID string) ([]*unit.SourceUnit, error) {
+	t, err := config.ReadCached(bs.Commit(commitID))
+	if err != nil {
+		return nil, err
+	}
+	return t.SourceUnits, nil
+}
+
+// unitContentHashes returns the content hashes (see
+// (*unit.SourceUnit).ContentHash) of units, keyed by unit ID.
+func unitContentHashes(rootDir string, units []*unit.SourceUnit) (map[unit.ID]string, error) {
+	hashes := make(map[unit.ID]string, len(units))
+	for _, u := range units {
+		h, err := u.ContentHash(rootDir)
+		if err != nil {
+			return nil, err
+		}
+		hashes[u.ID()] = h
+	}
+	return hashes, nil
+}
+
+// recordRenames records the files that were renamed between commits
+// from and to in to's build data (see buildstore.Renames) and returns
+// a map from their old paths to their new paths. If the repository
+// has no history, it returns nil.
+func recordRenames(repo *Repo, bs buildstore.RepoBuildStore, from, to string) (map[string]string, error) {
+	files, err := repo.VCS.Renames(repo.RootDir, from, to)
+	if err == vcs.ErrNoHistory {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	r := &buildstore.Renames{Base: from, Files: files}
+	if err := buildstore.WriteRenames(bs.Commit(to), r); err != nil {
+		return nil, err
+	}
+	return r.Map(), nil
+}
+
+// reuseUnitBuildData copies the per-unit build data (other than the
+// source unit files themselves, which the config step writes) of each
+// source unit in commit to from the build data of commit from, if
+// the unit's definition and content hash are the same in both
+// commits. Existing build data for commit to is not overwritten. It
+// returns the number of units whose build data was reused.
+//
+// The build data of a unit whose files were only renamed (according
+// to renames, which maps old paths to new paths) is also reused, if
+// its graph data can be updated by replacing the files' paths (see
+// renameGraphFiles). The unit's current files are read from rootDir
+// to check that they weren't changed.
+//
+// A unit that was itself renamed (e.g., because its directory was
+// moved, which changes its name and so its ID) is matched to the unit
+// that was removed from commit from by their content hashes, which
+// don't depend on the unit's name or directory (see renamedUnit). Its
+// graph data is reused if it can be updated for the new name (see
+// renameGraphUnit), and then so are its dependency resolutions, which
+// are updated to originate from the new unit.
+//
+// The copied files are newer than the source unit files and the
+// unit's source files, so the Makefile rules that would create them
+// are up to date.
+func reuseUnitBuildData(bs buildstore.RepoBuildStore, rootDir, from, to string, fromHashes, toHashes map[unit.ID]string, renames map[string]string) (int, error) {
+	fromUnits, err := cachedUnits(bs, from)
+	if err != nil {
+		return 0, err
+	}
+	toUnits, err := cachedUnits(bs, to)
+	if err != nil {
+		return 0, err
+	}
+	fromByID := make(map[unit.ID]*unit.SourceUnit, len(fromUnits))
+	for _, u := range fromUnits {
+		fromByID[u.ID()] = u
+	}
+	removed := removedUnitsByHash(fromUnits, toUnits, fromHashes)
+
+	fromFS, toFS := bs.Commit(from), bs.Commit(to)
+	n := 0
+	copiedFiles := map[string]string{} // copied file -> its name in commit from
+	for _, u := range toUnits {
+		id := u.ID()
+		fu := fromByID[id]
+		var unitRenames map[string]string // the renames of u's files
+		var rename func(*graph.Output) bool
+		switch {
+		case fu == nil:
+			if fu = renamedUnit(removed, u, toHashes[id]); fu == nil {
+				continue
+			}
+			unitRenames = unitFileRenames(fu, u)
+			rename = func(o *graph.Output) bool { return renameGraphUnit(o, fu, u, unitRenames) }
+		case fromHashes[id] == "":
+			continue
+		case fromHashes[id] != toHashes[id] || !reflect.DeepEqual(fu, u):
+			var ok bool
+			if unitRenames, ok, err = onlyRenamed(rootDir, fu, u, fromHashes[id], renames); err != nil {
+				return n, err
+			} else if !ok {
+				continue
+			}
+			rename = func(o *graph.Output) bool { return renameGraphFiles(o, unitRenames) }
+		}
+
+		reused, graphReused := false, false
+		for _, empty := range buildstore.DataTypes {
+			if _, isUnit := empty.(unit.SourceUnit); isUnit {
+				continue
+			}
+			fromFile, file := plan.SourceUnitDataFilename(empty, fu), plan.SourceUnitDataFilename(empty, u)
+			var copied bool
+			_, isGraph := empty.(*graph.Output)
+			switch {
+			case isGraph && rename != nil:
+				copied, err = copyRenamedGraphData(fromFS, toFS, fromFile, file, rename)
+				graphReused = copied
+			case fu.Name != u.Name:
+				// Other build data (e.g., blame output) may refer to
+				// the unit by its old name. (Its dependency
+				// resolutions are copied below.)
+				continue
+			default:
+				copied, err = copyBuildDataFile(fromFS, toFS, fromFile, file)
+			}
+			if err != nil {
+				return n, err
+			}
+			if copied {
+				copiedFiles[filepath.ToSlash(file)] = filepath.ToSlash(fromFile)
+			}
+			reused = reused || copied
+		}
+		if fu.Name != u.Name && graphReused {
+			// The dependency resolutions are only valid along with the
+			// graph data that was resolved from them.
+			var empty []*dep.ResolvedDep
+			fromFile, file := plan.SourceUnitDataFilename(empty, fu), plan.SourceUnitDataFilename(empty, u)
+			copied, err := copyRenamedDeps(fromFS, toFS, fromFile, file, u)
+			if err != nil {
+				return n, err
+			}
+			if copied {
+				copiedFiles[filepath.ToSlash(file)] = filepath.ToSlash(fromFile)
+			}
+		}
+		if reused {
+			n++
+		}
+	}
+	if len(copiedFiles) > 0 {
+		if err := copyTargetVersions(fromFS, toFS, copiedFiles); err != nil {
+			return n, err
+		}
+		if err := copySchemaVersions(fromFS, toFS, copiedFiles); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// removedUnitsByHash returns the units in fromUnits that aren't in
+// toUnits (by ID), keyed by their content hashes (in fromHashes).
+// Units whose content hashes aren't unique are omitted, since it's
+// ambiguous which of them a renamed unit was.
+func removedUnitsByHash(fromUnits, toUnits []*unit.SourceUnit, fromHashes map[unit.ID]string) map[string]*unit.SourceUnit {
+	toIDs := make(map[unit.ID]bool, len(toUnits))
+	for _, u := range toUnits {
+		toIDs[u.ID()] = true
+	}
+	removed := map[string]*unit.SourceUnit{}
+	dup := map[string]bool{}
+	for _, fu := range fromUnits {
+		h := fromHashes[fu.ID()]
+		if h == "" || toIDs[fu.ID()] {
+			continue
+		}
+		if _, seen := removed[h]; seen {
+			dup[h] = true
+		}
+		removed[h] = fu
+	}
+	for h := range dup {
+		delete(removed, h)
+	}
+	return removed
+}
+
+// renamedUnit returns the unit in removed (see removedUnitsByHash)
+// that the new unit u (whose content hash is hash) was renamed from,
+// or nil if there is none. The units must have the same content hash
+// (so their types and their files' contents and paths relative to
+// their directories are the same) and be the same except for their
+// names, directories, and files' paths.
+func renamedUnit(removed map[string]*unit.SourceUnit, u *unit.SourceUnit, hash string) *unit.SourceUnit {
+	fu := removed[hash]
+	if fu == nil || len(fu.Files) != len(u.Files) {
+		return nil
+	}
+	a, b := *fu, *u
+	a.Name, a.Dir, a.Files = "", "", nil
+	b.Name, b.Dir, b.Files = "", "", nil
+	if !reflect.DeepEqual(&a, &b) {
+		return nil
+	}
+	return fu
+}
+
+// unitFileRenames returns the renames (old path -> new path) of the
+// files of the unit u, which was renamed from fu, pairing the files
+// that have the same path relative to the units' directories.
+func unitFileRenames(fu, u *unit.SourceUnit) map[string]string {
+	byRel := make(map[string]string, len(fu.Files))
+	for _, f := range fu.Files {
+		byRel[unitRelPath(fu, f)] = f
+	}
+	renames := make(map[string]string, len(u.Files))
+	for _, f := range u.Files {
+		if old, present := byRel[unitRelPath(u, f)]; present && old != f {
+			renames[old] = f
+		}
+	}
+	return renames
+}
+
+// unitRelPath returns the slash-separated path of u's file relative
+// to u's directory (or file itself if it isn't in the directory), as
+// (*unit.SourceUnit).ContentHash does.
+func unitRelPath(u *unit.SourceUnit, file string) string {
+	rel, err := filepath.Rel(filepath.FromSlash(u.Dir), filepath.FromSlash(file))
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return file
+	}
+	return filepath.ToSlash(rel)
+}
+
+// renameGraphUnit updates the graph data o of the source unit fu for
+// its new name (u's), replacing the unit's name in its defs, refs,
+// docs, and anns and the paths of its files (renames maps old paths to
+// new paths). Toolchains often derive def paths from the unit's
+// directory (e.g., from a module path), and those can't be updated,
+// so if the name of fu's directory (or of a renamed file, as in
+// renameGraphFiles) occurs in any def path in o, o is left unchanged
+// and renameGraphUnit returns false.
+func renameGraphUnit(o *graph.Output, fu, u *unit.SourceUnit, renames map[string]string) bool {
+	if dir := path.Base(path.Clean(fu.Dir)); dir != "." && dir != "/" && dir != path.Base(path.Clean(u.Dir)) {
+		for _, d := range o.Defs {
+			if strings.Contains(d.Path, dir) || strings.Contains(d.TreePath, dir) {
+				return false
+			}
+		}
+		for _, r := range o.Refs {
+			if strings.Contains(r.DefPath, dir) {
+				return false
+			}
+		}
+	}
+	if !renameGraphFiles(o, renames) {
+		return false
+	}
+
+	rename := func(typ string, name *string) {
+		if typ == fu.Type && *name == fu.Name {
+			*name = u.Name
+		}
+	}
+	for _, d := range o.Defs {
+		rename(d.UnitType, &d.Unit)
+	}
+	for _, r := range o.Refs {
+		rename(r.UnitType, &r.Unit)
+		rename(r.DefUnitType, &r.DefUnit)
+	}
+	for _, d := range o.Docs {
+		rename(d.UnitType, &d.Unit)
+		rename(d.UnitType, &d.DocUnit)
+	}
+	for _, a := range o.Anns {
+		rename(a.UnitType, &a.Unit)
+	}
+	return true
+}
+
+// onlyRenamed reports whether the source unit u (at the current
+// commit, checked out in rootDir) is the same as fu (at the previous
+// commit, whose content hash was fromHash), except that some of its
+// files were renamed (according to renames) without being changed. If
+// so, it returns the renames of u's files.
+func onlyRenamed(rootDir string, fu, u *unit.SourceUnit, fromHash string, renames map[string]string) (map[string]string, bool, error) {
+	origFiles := map[string]string{} // new path -> old path
+	unitRenames := map[string]string{}
+	for old, file := range renames {
+		for _, f := range u.Files {
+			if f == file {
+				origFiles[file] = old
+				unitRenames[old] = file
+				break
+			}
+		}
+	}
+	if len(origFiles) == 0 {
+		return nil, false, nil
+	}
+
+	// The unit at the previous commit must be the same, with its
+	// files' old paths.
+	orig := *u
+	orig.Files = make([]string, len(u.Files))
+	for i, f := range u.Files {
+		if old, renamed := origFiles[f]; renamed {
+			f = old
+		}
+		orig.Files[i] = f
+	}
+	if !reflect.DeepEqual(fu, &orig) {
+		return nil, false, nil
+	}
+
+	h, err := u.ContentHashRenamed(rootDir, origFiles)
+	if err != nil {
+		return nil, false, err
+	}
+	return unitRenames, h == fromHash, nil
+}
+
+// copyRenamedGraphData copies the graph data file srcFile from one
+// commit's build data to dstFile in another's, updating the graph data
+// with rename (e.g., renameGraphFiles). It reports whether the file
+// was copied; it isn't if it doesn't exist in src or already exists in
+// dst, or if rename returns false.
+func copyRenamedGraphData(src, dst rwvfs.FileSystem, srcFile, dstFile string, rename func(*graph.Output) bool) (bool, error) {
+	if _, err := dst.Stat(dstFile); err == nil {
+		return false, nil
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+	in, err := src.Open(srcFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	data, err := ioutil.ReadAll(in)
+	in.Close()
+	if err != nil {
+		return false, err
+	}
+	o, err := decodeGraphData(data)
+	if err != nil {
+		return false, fmt.Errorf("%s: %s", srcFile, err)
+	}
+	if !rename(o) {
+		return false, nil
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		data, err = json.Marshal(o)
+	} else {
+		data, err = o.Marshal()
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := rwvfs.MkdirAll(dst, filepath.Dir(dstFile)); err != nil {
+		return false, err
+	}
+	f, err := dst.Create(dstFile)
+	if err != nil {
+		return false, err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return false, err
+	}
+	return true, f.Close()
+}
+
+// renameGraphFiles replaces the paths of the renamed files (renames
+// maps old paths to new paths) in the defs, refs, docs, and anns of o.
+// Toolchains often derive def paths from file names (e.g., from module
+// names), and those can't be updated, so if the name (without the
+// extension) of a file whose name (not only its directory) changed
+// occurs in any def path in o, o is left unchanged and
+// renameGraphFiles returns false.
+func renameGraphFiles(o *graph.Output, renames map[string]string) bool {
+	var stems []string
+	for old, file := range renames {
+		if path.Base(old) == path.Base(file) {
+			continue
+		}
+		if stem := strings.TrimSuffix(path.Base(old), path.Ext(old)); stem != "" {
+			stems = append(stems, stem)
+		}
+	}
+	inDefPath := func(defPath string) bool {
+		for _, stem := range stems {
+			if strings.Contains(defPath, stem) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, d := range o.Defs {
+		if inDefPath(d.Path) || inDefPath(d.TreePath) {
+			return false
+		}
+	}
+	for _, r := range o.Refs {
+		if inDefPath(r.DefPath) {
+			return false
+		}
+	}
+
+	rename := func(file *string) {
+		if f, renamed := renames[*file]; renamed {
+			*file = f
+		}
+	}
+	for _, d := range o.Defs {
+		rename(&d.File)
+	}
+	for _, r := range o.Refs {
+		rename(&r.File)
+	}
+	for _, d := range o.Docs {
+		rename(&d.File)
+	}
+	for _, a := range o.Anns {
+		rename(&a.File)
+	}
+	return true
+}
+
+// copyTargetVersions copies the recorded versions of the toolchains
+// that produced files (see toolchain.BuildVersions) from one commit's
+// build data to another's, so that reused build data isn't considered
+// stale. The keys of files are the copied files and the values are
+// their names in src.
+func copyTargetVersions(src, dst rwvfs.FileSystem, files map[string]string) error {
+	from, err := toolchain.ReadVersions(src)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	to, err := toolchain.ReadVersions(dst)
+	if os.IsNotExist(err) {
+		to = &toolchain.BuildVersions{}
+	} else if err != nil {
+		return err
+	}
+	if to.Targets == nil {
+		to.Targets = map[string]toolchain.TargetVersions{}
+	}
+	for file, srcFile := range files {
+		if v, present := from.Targets[srcFile]; present {
+			to.Targets[file] = v
+		}
+	}
+	return toolchain.WriteVersions(dst, to)
+}
+
+// copySchemaVersions copies the recorded schema versions of files
+// (see buildstore.Schema) from one commit's build data to another's,
+// so that reused build data keeps the version it was written with.
+// files is as in copyTargetVersions.
+func copySchemaVersions(src, dst rwvfs.FileSystem, files map[string]string) error {
+	from, err := buildstore.ReadSchema(src)
+	if err != nil {
+		return err
+	}
+	to, err := buildstore.ReadSchema(dst)
+	if err != nil {
+		return err
+	}
+	for file, srcFile := range files {
+		if v, present := from.Files[srcFile]; present {
+			to.Files[file] = v
+		} else {
+			delete(to.Files, file)
+		}
+	}
+	return buildstore.WriteSchema(dst, to)
+}
+
+// copyRenamedDeps copies the dependency resolutions in srcFile in src
+// to dstFile in dst (unless dstFile already exists), updating them to
+// originate from the unit u. It returns whether the file was copied.
+func copyRenamedDeps(src, dst rwvfs.FileSystem, srcFile, dstFile string, u *unit.SourceUnit) (bool, error) {
+	if _, err := dst.Stat(dstFile); err == nil {
+		return false, nil
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+	in, err := src.Open(srcFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	var deps []*dep.ResolvedDep
+	err = json.NewDecoder(in).Decode(&deps)
+	in.Close()
+	if err != nil {
+		return false, fmt.Errorf("%s: %s", srcFile, err)
+	}
+	for _, d := range deps {
+		d.FromUnit, d.FromUnitType = u.Name, u.Type
+	}
+	data, err := json.Marshal(deps)
+	if err != nil {
+		return false, err
+	}
+	if err := rwvfs.MkdirAll(dst, filepath.Dir(dstFile)); err != nil {
+		return false, err
+	}
+	f, err := dst.Create(dstFile)
+	if err != nil {
+		return false, err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return false, err
+	}
+	return true, f.Close()
+}
+
+// copyBuildDataFile copies srcFile from one commit's build data to
+// dstFile in another's. It reports whether the file was copied; it
+// isn't if it doesn't exist in src or already exists in dst.
+func copyBuildDataFile(src, dst rwvfs.FileSystem, srcFile, dstFile string) (bool, error) {
+	if _, err := dst.Stat(dstFile); err == nil {
+		return false, nil
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+	in, err := src.Open(srcFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer in.Close()
+	if err := rwvfs.MkdirAll(dst, filepath.Dir(dstFile)); err != nil {
+		return false, err
+	}
+	out, err := dst.Create(dstFile)
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return false, err
+	}
+	if err := out.Close(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
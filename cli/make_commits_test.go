@@ -0,0 +1,190 @@
+package cli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/dep"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestParseCommitRange(t *testing.T) {
+	tests := []struct {
+		r          string
+		base, head string
+		wantErr    bool
+	}{
+		{r: "a..b", base: "a", head: "b"},
+		{r: "v1.0..HEAD", base: "v1.0", head: "HEAD"},
+		{r: "HEAD~3..HEAD", base: "HEAD~3", head: "HEAD"},
+		{r: "a", wantErr: true},
+		{r: "a..", wantErr: true},
+		{r: "..b", wantErr: true},
+		{r: "a...b", wantErr: true},
+	}
+	for _, test := range tests {
+		base, head, err := parseCommitRange(test.r)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%q: got nil error, want error", test.r)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", test.r, err)
+			continue
+		}
+		if base != test.base || head != test.head {
+			t.Errorf("%q: got %q..%q, want %q..%q", test.r, base, head, test.base, test.head)
+		}
+	}
+}
+
+func TestCopyTargetVersions(t *testing.T) {
+	v1 := toolchain.TargetVersions{"t": "v1"}
+	from, to := rwvfs.Map(map[string]string{}), rwvfs.Map(map[string]string{})
+	if err := toolchain.WriteVersions(from, &toolchain.BuildVersions{Targets: map[string]toolchain.TargetVersions{"a.graph.json": v1, "b.graph.json": v1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyTargetVersions(from, to, map[string]string{"a.graph.json": "a.graph.json"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := toolchain.ReadVersions(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Targets) != 1 || !got.Targets["a.graph.json"].Equal(v1) {
+		t.Errorf("got target versions %v, want only a.graph.json's to be copied", got.Targets)
+	}
+}
+
+func TestReuseUnitBuildData_renamedUnit(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "srclib-make-commits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootDir)
+	for _, dir := range []string{"olddir", "newdir"} {
+		if err := os.Mkdir(filepath.Join(rootDir, dir), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(rootDir, dir, "x.t"), []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The unit's directory was moved from olddir to newdir, which
+	// changed its name (and ID) but not its content hash.
+	newUnit := func(dir string) *unit.SourceUnit {
+		return &unit.SourceUnit{Key: unit.Key{Name: dir, Type: "T"}, Info: unit.Info{Dir: dir, Files: []string{dir + "/x.t"}}}
+	}
+	fu, u := newUnit("olddir"), newUnit("newdir")
+	graphData := func(defPath string) *graph.Output {
+		return &graph.Output{
+			Defs: []*graph.Def{{DefKey: graph.DefKey{UnitType: "T", Unit: "olddir", Path: defPath}, File: "olddir/x.t"}},
+			Refs: []*graph.Ref{{DefUnitType: "T", DefUnit: "olddir", DefPath: defPath, UnitType: "T", Unit: "olddir", File: "olddir/x.t"}},
+		}
+	}
+
+	tests := map[string]struct {
+		graph      *graph.Output
+		wantReused bool
+	}{
+		"reused": {graph: graphData("p"), wantReused: true},
+
+		// The def path may have been derived from the unit's
+		// directory, so it can't be updated.
+		"def path from dir": {graph: graphData("olddir/p"), wantReused: false},
+	}
+	for label, test := range tests {
+		fs := rwvfs.Map(map[string]string{})
+		put := func(file string, v interface{}) {
+			data, err := json.Marshal(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := rwvfs.MkdirAll(fs, filepath.Dir(file)); err != nil {
+				t.Fatal(err)
+			}
+			f, err := fs.Create(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.Write(data); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		put(filepath.Join("c1", plan.SourceUnitDataFilename(unit.SourceUnit{}, fu)), fu)
+		put(filepath.Join("c1", plan.SourceUnitDataFilename(&graph.Output{}, fu)), test.graph)
+		put(filepath.Join("c1", plan.SourceUnitDataFilename([]*dep.ResolvedDep{}, fu)), []*dep.ResolvedDep{{FromUnit: "olddir", FromUnitType: "T", ToUnit: "d"}})
+		put(filepath.Join("c2", plan.SourceUnitDataFilename(unit.SourceUnit{}, u)), u)
+		bs := buildstore.Repo(rwvfs.Walkable(fs))
+
+		fromHashes, err := unitContentHashes(rootDir, []*unit.SourceUnit{fu})
+		if err != nil {
+			t.Fatal(err)
+		}
+		toHashes, err := unitContentHashes(rootDir, []*unit.SourceUnit{u})
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := reuseUnitBuildData(bs, rootDir, "c1", "c2", fromHashes, toHashes, nil)
+		if err != nil {
+			t.Fatalf("%s: %s", label, err)
+		}
+		if reused := n == 1; reused != test.wantReused {
+			t.Errorf("%s: got reused %v, want %v", label, reused, test.wantReused)
+		}
+		if !test.wantReused {
+			if _, err := bs.Commit("c2").Stat(plan.SourceUnitDataFilename([]*dep.ResolvedDep{}, u)); !os.IsNotExist(err) {
+				t.Errorf("%s: got error %v statting depresolve data, want it not to be copied without the graph data", label, err)
+			}
+			continue
+		}
+
+		f, err := bs.Commit("c2").Open(plan.SourceUnitDataFilename(&graph.Output{}, u))
+		if err != nil {
+			t.Fatalf("%s: %s", label, err)
+		}
+		data, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var o graph.Output
+		if err := json.Unmarshal(data, &o); err != nil {
+			t.Fatal(err)
+		}
+		if d := o.Defs[0]; d.Unit != "newdir" || d.File != "newdir/x.t" {
+			t.Errorf("%s: got def unit %q file %q, want the new unit and file", label, d.Unit, d.File)
+		}
+		if r := o.Refs[0]; r.Unit != "newdir" || r.DefUnit != "newdir" || r.File != "newdir/x.t" {
+			t.Errorf("%s: got ref unit %q def unit %q file %q, want the new unit and file", label, r.Unit, r.DefUnit, r.File)
+		}
+		f, err = bs.Commit("c2").Open(plan.SourceUnitDataFilename([]*dep.ResolvedDep{}, u))
+		if err != nil {
+			t.Errorf("%s: depresolve data wasn't copied: %s", label, err)
+			continue
+		}
+		var deps []*dep.ResolvedDep
+		err = json.NewDecoder(f).Decode(&deps)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deps) != 1 || deps[0].FromUnit != "newdir" || deps[0].FromUnitType != "T" {
+			t.Errorf("%s: got deps %+v, want them to originate from the new unit", label, deps)
+		}
+	}
+}
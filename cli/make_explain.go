@@ -0,0 +1,318 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/makex"
+
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/dep"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+)
+
+// Reasons that a Makefile rule will run (or be skipped), as explained
+// by "srclib make --explain".
+const (
+	explainMissingTarget    = "missing target"
+	explainToolchainChanged = "toolchain version changed"
+	explainChangedInputs    = "changed inputs"
+	explainPrereqRebuilt    = "prerequisite will be rebuilt"
+	explainUpToDate         = "up to date"
+)
+
+// A ruleExplanation says whether a Makefile rule will run and why.
+type ruleExplanation struct {
+	Target string
+	Run    bool
+	Reason string // one of the explain* reasons
+
+	// Files are the files that the reason applies to: the missing
+	// targets, the changed inputs, or the prerequisites that will be
+	// rebuilt.
+	Files []string `json:",omitempty"`
+
+	// Toolchains describes the toolchain version changes (e.g.,
+	// "sourcegraph.com/sourcegraph/srclib-go 0.1 -> 0.2"), if the
+	// reason is explainToolchainChanged.
+	Toolchains []string `json:",omitempty"`
+
+	// ToolChoice is how the toolchain that runs the rule was chosen,
+	// if multiple toolchains could run it (see
+	// toolchain.ToolChoices).
+	ToolChoice *toolchain.ToolChoice `json:",omitempty"`
+}
+
+// makeExplainer explains which of a Makefile's rules will run.
+type makeExplainer struct {
+	mf *makex.Makefile
+
+	// dataDir is the build data directory (with a trailing slash)
+	// that targets are relative to in oldVersions.
+	dataDir string
+
+	// oldVersions are the recorded toolchain versions of the existing
+	// targets, and curVersions the versions of the toolchains that
+	// would produce them now (keyed by target). If rebuildStale is
+	// false, targets produced by other versions are kept.
+	oldVersions  *toolchain.BuildVersions
+	curVersions  map[string]toolchain.TargetVersions
+	rebuildStale bool
+
+	stat func(string) (os.FileInfo, error)
+
+	ruleOf map[string]makex.Rule // rule that produces each target
+	memo   map[makex.Rule]*ruleExplanation
+}
+
+// explain returns an explanation for each of the Makefile's rules, in
+// order.
+func (e *makeExplainer) explain() []*ruleExplanation {
+	e.ruleOf = map[string]makex.Rule{}
+	e.memo = map[makex.Rule]*ruleExplanation{}
+	for _, rule := range e.mf.Rules {
+		for _, target := range explainTargets(rule) {
+			e.ruleOf[target] = rule
+		}
+	}
+	exps := make([]*ruleExplanation, len(e.mf.Rules))
+	for i, rule := range e.mf.Rules {
+		exps[i] = e.explainRule(rule)
+		exps[i].ToolChoice = ruleToolChoice(rule)
+	}
+	return exps
+}
+
+// ruleToolChoice returns the choice of the toolchain that runs rule,
+// if the toolchain was chosen among multiple toolchains.
+func ruleToolChoice(rule makex.Rule) *toolchain.ToolChoice {
+	var op, unitType string
+	switch r := rule.(type) {
+	case *grapher.GraphUnitRule:
+		op, unitType = "graph", r.Unit.Type
+	case *grapher.GraphMultiUnitsRule:
+		op, unitType = "graph", r.UnitsType
+	case *dep.ResolveDepsRule:
+		op, unitType = "depresolve", r.Unit.Type
+	default:
+		return nil
+	}
+	c := toolchain.LookupToolChoice(unitType)
+	if c == nil {
+		return nil
+	}
+	for _, o := range c.Ops {
+		if o == op {
+			return c
+		}
+	}
+	return nil
+}
+
+func (e *makeExplainer) explainRule(rule makex.Rule) *ruleExplanation {
+	if exp, done := e.memo[rule]; done {
+		return exp
+	}
+	// Guard against cycles (which makex rejects anyway).
+	exp := &ruleExplanation{Target: rule.Target(), Reason: explainUpToDate}
+	e.memo[rule] = exp
+
+	targets := explainTargets(rule)
+	var oldest os.FileInfo // least recently modified target
+	for _, target := range targets {
+		fi, err := e.stat(target)
+		if err != nil {
+			exp.Files = append(exp.Files, target)
+			continue
+		}
+		if oldest == nil || fi.ModTime().Before(oldest.ModTime()) {
+			oldest = fi
+		}
+	}
+	if len(exp.Files) > 0 {
+		exp.Run, exp.Reason = true, explainMissingTarget
+		return exp
+	}
+
+	if e.rebuildStale {
+		for _, target := range targets {
+			cur, present := e.curVersions[target]
+			if !present {
+				continue
+			}
+			prev := e.oldVersions.Targets[strings.TrimPrefix(target, e.dataDir)]
+			if prev.Equal(cur) {
+				continue
+			}
+			exp.Toolchains = append(exp.Toolchains, versionChanges(prev, cur)...)
+		}
+		if len(exp.Toolchains) > 0 {
+			exp.Run, exp.Reason = true, explainToolchainChanged
+			exp.Toolchains = dedupSorted(exp.Toolchains)
+			return exp
+		}
+	}
+
+	var rebuilt, changed []string
+	for _, prereq := range rule.Prereqs() {
+		if r, ok := e.ruleOf[prereq]; ok && r != rule && e.explainRule(r).Run {
+			rebuilt = append(rebuilt, prereq)
+			continue
+		}
+		if fi, err := e.stat(prereq); err == nil && oldest != nil && fi.ModTime().After(oldest.ModTime()) {
+			changed = append(changed, prereq)
+		}
+	}
+	switch {
+	case len(rebuilt) > 0:
+		exp.Run, exp.Reason, exp.Files = true, explainPrereqRebuilt, rebuilt
+	case len(changed) > 0:
+		exp.Run, exp.Reason, exp.Files = true, explainChangedInputs, changed
+	}
+	return exp
+}
+
+// explainTargets returns the files that rule produces. (The target of
+// a rule that graphs multiple units is a placeholder; see
+// (*grapher.GraphMultiUnitsRule).Target.)
+func explainTargets(rule makex.Rule) []string {
+	if r, ok := rule.(*grapher.GraphMultiUnitsRule); ok {
+		var targets []string
+		for target := range r.Targets() {
+			targets = append(targets, target)
+		}
+		sort.Strings(targets)
+		return targets
+	}
+	return []string{rule.Target()}
+}
+
+// versionChanges describes how each toolchain's version differs
+// between prev and cur.
+func versionChanges(prev, cur toolchain.TargetVersions) []string {
+	var changes []string
+	for path, v := range cur {
+		old, present := prev[path]
+		if !present {
+			old = "unknown version"
+		}
+		if old != v {
+			changes = append(changes, fmt.Sprintf("%s %s -> %s", path, old, v))
+		}
+	}
+	for path, old := range prev {
+		if _, present := cur[path]; !present {
+			changes = append(changes, fmt.Sprintf("%s %s -> not used", path, old))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+func dedupSorted(ss []string) []string {
+	sort.Strings(ss)
+	var out []string
+	for i, s := range ss {
+		if i == 0 || s != ss[i-1] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// maxExplainFiles is the maximum number of files listed for each rule
+// in the text form of "srclib make --explain".
+const maxExplainFiles = 5
+
+// printExplanations prints the explanations of a Makefile's rules in
+// text form.
+func printExplanations(w io.Writer, exps []*ruleExplanation) {
+	run := 0
+	for _, exp := range exps {
+		action := "SKIP"
+		if exp.Run {
+			action = "RUN "
+			run++
+		}
+		details := exp.Files
+		if exp.Reason == explainToolchainChanged {
+			details = exp.Toolchains
+		}
+		reason := exp.Reason
+		if len(details) > 0 {
+			shown := details
+			if len(shown) > maxExplainFiles {
+				shown = shown[:maxExplainFiles]
+			}
+			reason += ": " + strings.Join(shown, ", ")
+			if n := len(details) - len(shown); n > 0 {
+				reason += fmt.Sprintf(", and %d more", n)
+			}
+		}
+		fmt.Fprintf(w, "%s  %s (%s)\n", action, exp.Target, reason)
+	}
+	fmt.Fprintf(w, "\n%d of %d rules will run.\n", run, len(exps))
+
+	seen := map[*toolchain.ToolChoice]bool{}
+	for _, exp := range exps {
+		c := exp.ToolChoice
+		if c == nil || seen[c] {
+			continue
+		}
+		seen[c] = true
+		scores := make([]string, len(c.Scores))
+		for i, s := range c.Scores {
+			scores[i] = fmt.Sprintf("%s %g", s.Toolchain, s.Confidence)
+			if s.Error != "" {
+				scores[i] += " (" + s.Error + ")"
+			}
+		}
+		fmt.Fprintf(w, "\nChose toolchain %s for %s source units (%s) by scoring %d sampled files: %s.\n", c.Toolchain, c.UnitType, strings.Join(c.Ops, ", "), len(c.Files), strings.Join(scores, ", "))
+	}
+}
+
+// explain prints, for each of mf's rules, whether it will run and why.
+func (c *MakeCmd) explain(mf *makex.Makefile) error {
+	localRepo, err := OpenRepo(".")
+	if err != nil {
+		return err
+	}
+	buildStore, err := buildstore.LocalRepo(localRepo.RootDir)
+	if err != nil {
+		return err
+	}
+	old, err := toolchain.ReadVersions(buildStore.Commit(localRepo.CommitID))
+	if os.IsNotExist(err) {
+		old = &toolchain.BuildVersions{}
+	} else if err != nil {
+		return err
+	}
+	_, cur, err := ruleToolchainVersions(mf)
+	if err != nil {
+		return err
+	}
+
+	e := &makeExplainer{
+		mf:           mf,
+		dataDir:      filepath.ToSlash(filepath.Join(buildstore.BuildDataDirName, localRepo.CommitID)) + "/",
+		oldVersions:  old,
+		curVersions:  cur,
+		rebuildStale: !c.KeepStale,
+		stat:         os.Stat,
+	}
+	exps := e.explain()
+	switch c.Format {
+	case "json":
+		PrintJSON(exps, "  ")
+	case "text":
+		printExplanations(os.Stdout, exps)
+	default:
+		return fmt.Errorf("unknown output format %q (expected text or json)", c.Format)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/makex"
+
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+)
+
+type explainFileInfo struct {
+	os.FileInfo
+	modTime time.Time
+}
+
+func (fi explainFileInfo) ModTime() time.Time { return fi.modTime }
+
+func TestMakeExplainer(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2015, 6, d, 0, 0, 0, 0, time.UTC) }
+	files := map[string]time.Time{
+		"a.go":        day(1),
+		"b.go":        day(3),
+		"d/a.unit":    day(1),
+		"d/a.graph":   day(2),
+		"d/b.unit":    day(1),
+		"d/b.graph":   day(2),
+		"d/c.unit":    day(1),
+		"d/c.graph":   day(2),
+		"d/c.depresl": day(2),
+	}
+	stat := func(name string) (os.FileInfo, error) {
+		if t, ok := files[name]; ok {
+			return explainFileInfo{modTime: t}, nil
+		}
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	mf := &makex.Makefile{Rules: []makex.Rule{
+		&makex.BasicRule{TargetFile: "d/a.graph", PrereqFiles: []string{"d/a.unit", "a.go"}},
+		&makex.BasicRule{TargetFile: "d/b.graph", PrereqFiles: []string{"d/b.unit", "b.go"}},
+		&makex.BasicRule{TargetFile: "d/all", PrereqFiles: []string{"d/a.graph", "d/b.graph"}},
+		&makex.BasicRule{TargetFile: "d/c.graph", PrereqFiles: []string{"d/c.unit"}},
+		&makex.BasicRule{TargetFile: "d/c.depresl", PrereqFiles: []string{"d/c.unit"}},
+	}}
+	e := &makeExplainer{
+		mf:      mf,
+		dataDir: "d/",
+		oldVersions: &toolchain.BuildVersions{Targets: map[string]toolchain.TargetVersions{
+			"c.graph":   {"tc": "1"},
+			"c.depresl": {"tc": "1"},
+		}},
+		curVersions: map[string]toolchain.TargetVersions{
+			"d/c.graph":   {"tc": "2"},
+			"d/c.depresl": {"tc": "1"},
+		},
+		rebuildStale: true,
+		stat:         stat,
+	}
+
+	want := []*ruleExplanation{
+		{Target: "d/a.graph", Reason: explainUpToDate},
+		{Target: "d/b.graph", Run: true, Reason: explainChangedInputs, Files: []string{"b.go"}},
+		{Target: "d/all", Run: true, Reason: explainMissingTarget, Files: []string{"d/all"}},
+		{Target: "d/c.graph", Run: true, Reason: explainToolchainChanged, Toolchains: []string{"tc 1 -> 2"}},
+		{Target: "d/c.depresl", Reason: explainUpToDate},
+	}
+	exps := e.explain()
+	if !reflect.DeepEqual(exps, want) {
+		for i := range exps {
+			t.Errorf("rule %d: got %+v", i, exps[i])
+		}
+		t.Fatal("explanations differ")
+	}
+
+	// Rules whose prerequisites will be rebuilt run too.
+	files["d/all"] = day(4)
+	e.rebuildStale = false
+	exps = e.explain()
+	if got, want := exps[2], (&ruleExplanation{Target: "d/all", Run: true, Reason: explainPrereqRebuilt, Files: []string{"d/b.graph"}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if exps[3].Run {
+		t.Errorf("got %+v, want stale target kept with rebuildStale false", exps[3])
+	}
+
+	var buf bytes.Buffer
+	printExplanations(&buf, exps)
+	if out := buf.String(); !strings.Contains(out, "RUN   d/b.graph (changed inputs: b.go)\n") || !strings.Contains(out, "2 of 5 rules will run.") {
+		t.Errorf("got output:\n%s", out)
+	}
+}
@@ -0,0 +1,168 @@
+package cli
+
+import (
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alexsaveliev/go-colorable-wrapper"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+
+	"sourcegraph.com/sourcegraph/makex"
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/dep"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+)
+
+// makeMetricsJob is the Pushgateway job that make metrics are pushed
+// as.
+const makeMetricsJob = "srclib_make"
+
+// makeMetrics are the metrics of a make (see MakeCmd.MetricsPush and
+// MetricsFile).
+type makeMetrics struct {
+	reg      *prometheus.Registry
+	start    time.Time
+	units    *prometheus.CounterVec // by op, toolchain, and result
+	duration prometheus.Gauge
+	success  prometheus.Gauge
+	finished prometheus.Gauge
+}
+
+func newMakeMetrics() *makeMetrics {
+	m := &makeMetrics{
+		reg:   prometheus.NewRegistry(),
+		start: time.Now(),
+		units: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "srclib_make_units_total",
+			Help: "Source units that the make graphed or resolved the dependencies of (op), by toolchain and result (built, or failed if the unit's rule failed or the make stopped before running it). Units whose build data was up to date aren't counted.",
+		}, []string{"op", "toolchain", "result"}),
+		duration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "srclib_make_duration_seconds",
+			Help: "Time taken by the make.",
+		}),
+		success: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "srclib_make_success",
+			Help: "Whether the make succeeded (1) or failed (0).",
+		}),
+		finished: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "srclib_make_last_run_timestamp_seconds",
+			Help: "Unix time when the make finished.",
+		}),
+	}
+	m.reg.MustRegister(m.units, m.duration, m.success, m.finished)
+	return m
+}
+
+// A unitTarget is the build data file that a source unit rule
+// creates.
+type unitTarget struct {
+	op        string // "graph" or "depresolve"
+	toolchain string
+	file      string
+}
+
+// unitTargets returns the targets of the rules in mf that graph
+// source units or resolve their dependencies.
+func unitTargets(mf *makex.Makefile) []unitTarget {
+	toolchain := func(t *srclib.ToolRef) string {
+		if t == nil {
+			return ""
+		}
+		return t.Toolchain
+	}
+	var targets []unitTarget
+	for _, rule := range mf.Rules {
+		switch r := rule.(type) {
+		case *grapher.GraphUnitRule:
+			targets = append(targets, unitTarget{"graph", toolchain(r.Tool), r.Target()})
+		case *grapher.GraphMultiUnitsRule:
+			for target := range r.Targets() {
+				targets = append(targets, unitTarget{"graph", toolchain(r.Tool), target})
+			}
+		case *dep.ResolveDepsRule:
+			targets = append(targets, unitTarget{"depresolve", toolchain(r.Tool), r.Target()})
+		}
+	}
+	return targets
+}
+
+// run calls run (which executes mf) and counts the source units whose
+// targets it built or failed to build. If m is nil, it just calls run.
+func (m *makeMetrics) run(mf *makex.Makefile, run func() error) error {
+	if m == nil {
+		return run()
+	}
+	var pending []unitTarget
+	for _, t := range unitTargets(mf) {
+		if _, err := os.Stat(filepath.FromSlash(t.file)); os.IsNotExist(err) {
+			pending = append(pending, t)
+		}
+	}
+	err := run()
+	for _, t := range pending {
+		result := "built"
+		if _, err := os.Stat(filepath.FromSlash(t.file)); err != nil {
+			result = "failed"
+		}
+		m.units.WithLabelValues(t.op, t.toolchain, result).Inc()
+	}
+	return err
+}
+
+// report records the outcome of the make (whose error is makeErr) and
+// pushes the metrics to the Pushgateway at pushURL and writes them to
+// file, if they're set. Failing to report metrics doesn't fail the
+// make, so it is only logged.
+func (m *makeMetrics) report(makeErr error, pushURL, file string) {
+	m.duration.Set(time.Since(m.start).Seconds())
+	if makeErr == nil {
+		m.success.Set(1)
+	} else {
+		m.success.Set(0)
+	}
+	m.finished.Set(float64(time.Now().Unix()))
+
+	if file != "" {
+		// WriteToTextfile replaces file atomically, so that readers
+		// (such as node_exporter's textfile collector) never see a
+		// partly written file.
+		if err := prometheus.WriteToTextfile(file, m.reg); err != nil {
+			log.Println(colorable.Yellow("Warning: writing make metrics failed: " + err.Error()))
+		}
+	}
+	if pushURL != "" {
+		if err := srclib.CheckOnline("pushing make metrics"); err != nil {
+			log.Println(colorable.Yellow("Warning: " + err.Error()))
+		} else if p, err := m.pusher(pushURL); err != nil {
+			log.Println(colorable.Yellow("Warning: getting credentials for pushing make metrics failed: " + err.Error()))
+		} else if err := p.Push(); err != nil {
+			log.Println(colorable.Yellow("Warning: pushing make metrics failed: " + err.Error()))
+		}
+	}
+}
+
+// pusher returns a pusher that replaces the metrics of the make's job
+// (grouped by the repository, if known) on the Pushgateway at pushURL
+// with m's, authenticating with the credentials for pushURL (see
+// buildstore.LookupCredentials).
+func (m *makeMetrics) pusher(pushURL string) (*push.Pusher, error) {
+	u, err := url.Parse(pushURL)
+	if err != nil {
+		return nil, err
+	}
+	client, err := buildstore.HTTPClient(u)
+	if err != nil {
+		return nil, err
+	}
+	p := push.New(pushURL, makeMetricsJob).Gatherer(m.reg).Client(client)
+	if repo, err := OpenRepo("."); err == nil && repo.CloneURL != "" {
+		p = p.Grouping("repo", graph.MakeURI(repo.CloneURL))
+	}
+	return p, nil
+}
@@ -0,0 +1,282 @@
+package cli
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"sourcegraph.com/sourcegraph/makex"
+
+	"sourcegraph.com/sourcegraph/srclib/dep"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+)
+
+// parseScheduler parses the value of "srclib make --scheduler"
+// (grpc://HOST:PORT[,HOST:PORT...], or grpcs:// for TLS) and returns
+// the worker addresses and whether to connect to them over TLS.
+func parseScheduler(s string) (addrs []string, useTLS bool, err error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, false, err
+	}
+	switch u.Scheme {
+	case "grpc":
+	case "grpcs":
+		useTLS = true
+	default:
+		return nil, false, fmt.Errorf("unsupported scheduler URL scheme %q in %q (expected grpc://HOST:PORT[,HOST:PORT...], or grpcs:// for TLS)", u.Scheme, s)
+	}
+	for _, addr := range strings.Split(u.Host, ",") {
+		if addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, false, fmt.Errorf("no worker addresses in scheduler URL %q", s)
+	}
+	return addrs, useTLS, nil
+}
+
+// A remoteRule is a Makefile rule to execute on a worker.
+type remoteRule struct {
+	rule makex.Rule
+	job  *WorkerJob // the rule's parts, without Files
+}
+
+// newWorkerJob returns the job that describes rule to a worker if it
+// is a rule that can be executed on one (graphing a single unit or
+// resolving its dependencies), or nil otherwise.
+func newWorkerJob(rule makex.Rule) *WorkerJob {
+	switch r := rule.(type) {
+	case *grapher.GraphUnitRule:
+		return &WorkerJob{Op: workerGraphOp, DataDir: filepath.ToSlash(r.DataDir()), Unit: r.Unit, PostProcessors: r.PostProcessors, TestFiles: r.TestFiles, DepGraphFiles: r.DepGraphFiles}
+	case *dep.ResolveDepsRule:
+		return &WorkerJob{Op: workerDepresolveOp, DataDir: filepath.ToSlash(r.DataDir()), Unit: r.Unit}
+	}
+	return nil
+}
+
+// runRemote executes the rules of mf that need to run and that can
+// be executed on a worker on the workers listed in c.Scheduler,
+// writing the build data files that they create. The other rules are
+// left for run to execute locally.
+func (c *MakeCmd) runRemote(mf *makex.Makefile) error {
+	addrs, useTLS, err := parseScheduler(c.Scheduler)
+	if err != nil {
+		return err
+	}
+	token := os.Getenv(WorkerTokenEnv)
+
+	e := &makeExplainer{mf: mf, oldVersions: &toolchain.BuildVersions{}, stat: os.Stat}
+	var rules []*remoteRule
+	for i, exp := range e.explain() {
+		if !exp.Run {
+			continue
+		}
+		if job := newWorkerJob(mf.Rules[i]); job != nil {
+			job.Token = token
+			rules = append(rules, &remoteRule{rule: mf.Rules[i], job: job})
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	var tlsConfig *tls.Config
+	if useTLS {
+		if tlsConfig, err = schedulerTLSConfig(c.SchedulerCA, c.SchedulerCert, c.SchedulerKey); err != nil {
+			return err
+		}
+	} else if token == "" {
+		return fmt.Errorf("set $%s to the workers' shared token, or connect to them over TLS (grpcs://) with a client certificate", WorkerTokenEnv)
+	}
+	clients := make([]*grpc.ClientConn, len(addrs))
+	for i, addr := range addrs {
+		cl, err := dialWorker(addr, tlsConfig)
+		if err != nil {
+			return fmt.Errorf("connecting to worker %s: %s", addr, err)
+		}
+		defer cl.Close()
+		clients[i] = cl
+	}
+	if !c.Quiet {
+		log.Printf("Running %d source unit rules on %d workers.", len(rules), len(clients))
+	}
+	var done func(makex.Rule) error
+	if c.checkpointFile != "" {
+		done = func(rule makex.Rule) error {
+			return appendMakeCheckpoint(filepath.FromSlash(c.checkpointFile), explainTargets(rule))
+		}
+	}
+	return runRemoteRules(rules, clients, addrs, c.Parallel, !c.Quiet, done)
+}
+
+// dialWorker connects to the worker at addr, over TLS if tlsConfig is
+// non-nil.
+func dialWorker(addr string, tlsConfig *tls.Config) (*grpc.ClientConn, error) {
+	opts := []grpc.DialOption{grpc.WithCodec(workerCodec{})}
+	if tlsConfig == nil {
+		opts = append(opts, grpc.WithInsecure())
+	} else {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	}
+	return grpc.Dial(addr, opts...)
+}
+
+// schedulerTLSConfig returns the TLS configuration for connecting to
+// workers whose certificates are signed by one of the CAs in caFile
+// (or by the system's CAs, if caFile is empty), presenting the client
+// certificate in certFile and keyFile (if set).
+func schedulerTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates in %s", caFile)
+		}
+	}
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, errors.New("--scheduler-cert and --scheduler-key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// runRemoteRules executes rules on the workers (whose addresses are
+// addrs) using up to jobs connections at once, calling done (if
+// non-nil) after each rule completes. Rules run after the rules in the
+// list that produce their prerequisites.
+func runRemoteRules(rules []*remoteRule, clients []*grpc.ClientConn, addrs []string, jobs int, verbose bool, done func(makex.Rule) error) error {
+	if jobs < len(clients) {
+		jobs = len(clients)
+	}
+	pending := make(map[string]*remoteRule, len(rules))
+	for _, r := range rules {
+		pending[r.rule.Target()] = r
+	}
+	for len(pending) > 0 {
+		// Run the rules whose prerequisites aren't pending.
+		var wave []*remoteRule
+		for _, r := range rules {
+			if pending[r.rule.Target()] != r {
+				continue
+			}
+			ready := true
+			for _, prereq := range r.rule.Prereqs() {
+				if p, ok := pending[prereq]; ok && p != r {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				wave = append(wave, r)
+			}
+		}
+		if len(wave) == 0 {
+			return fmt.Errorf("remote rules have circular prerequisites (%d rules pending)", len(pending))
+		}
+
+		ch := make(chan *remoteRule)
+		errc := make(chan error, len(wave))
+		var wg sync.WaitGroup
+		for i := 0; i < jobs && i < len(wave); i++ {
+			wg.Add(1)
+			go func(cl *grpc.ClientConn, addr string) {
+				defer wg.Done()
+				for r := range ch {
+					if err := runRemoteRule(cl, r); err != nil {
+						errc <- fmt.Errorf("building %s on worker %s: %s", r.rule.Target(), addr, err)
+						continue
+					}
+					if verbose {
+						log.Printf("Built %s on worker %s", r.rule.Target(), addr)
+					}
+					if done != nil {
+						if err := done(r.rule); err != nil {
+							errc <- err
+						}
+					}
+				}
+			}(clients[i%len(clients)], addrs[i%len(clients)])
+		}
+		for _, r := range wave {
+			ch <- r
+		}
+		close(ch)
+		wg.Wait()
+		close(errc)
+		if err := <-errc; err != nil {
+			return err
+		}
+		for _, r := range wave {
+			delete(pending, r.rule.Target())
+		}
+	}
+	return nil
+}
+
+// runRemoteRule executes r on a worker and writes the files that it
+// created.
+func runRemoteRule(cl *grpc.ClientConn, r *remoteRule) error {
+	job := *r.job
+	job.Files = map[string][]byte{}
+	names := append([]string{}, r.rule.Prereqs()...)
+	if job.Unit != nil {
+		names = append(names, job.Unit.Files...)
+	}
+	for _, name := range names {
+		name = filepath.ToSlash(name)
+		if _, present := job.Files[name]; present {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.FromSlash(name))
+		if err != nil {
+			return err
+		}
+		job.Files[name] = data
+	}
+
+	res, err := callWorker(context.Background(), cl, &job)
+	if err != nil {
+		return err
+	}
+	target := filepath.ToSlash(r.rule.Target())
+	if _, ok := res.Files[target]; !ok {
+		return fmt.Errorf("worker did not create the target\n%s", res.Output)
+	}
+	for name, data := range res.Files {
+		if err := checkRelPath(name); err != nil {
+			return err
+		}
+		file := filepath.FromSlash(name)
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(file, data, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
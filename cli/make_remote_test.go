@@ -0,0 +1,210 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"sourcegraph.com/sourcegraph/makex"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestParseScheduler(t *testing.T) {
+	type result struct {
+		addrs  []string
+		useTLS bool
+	}
+	tests := map[string]*result{
+		"grpc://a:1":       {addrs: []string{"a:1"}},
+		"grpc://a:1,b:2":   {addrs: []string{"a:1", "b:2"}},
+		"grpcs://a:1":      {addrs: []string{"a:1"}, useTLS: true},
+		"rpc://a:1":        nil,
+		"grpc://":          nil,
+		"a:1":              nil,
+		"grpc://a:1,,b:2/": {addrs: []string{"a:1", "b:2"}},
+	}
+	for s, want := range tests {
+		addrs, useTLS, err := parseScheduler(s)
+		if want == nil {
+			if err == nil {
+				t.Errorf("%q: got addrs %v, want error", s, addrs)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", s, err)
+			continue
+		}
+		if got := (&result{addrs, useTLS}); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %+v, want %+v", s, got, want)
+		}
+	}
+}
+
+func TestRunWorkerJob_invalidPath(t *testing.T) {
+	rule := &makex.BasicRule{TargetFile: "t"}
+	for _, name := range []string{"../x", "/x", "a/../../x"} {
+		job := &WorkerJob{Files: map[string][]byte{name: nil}}
+		if _, err := runWorkerJob(os.TempDir(), job, rule); err == nil {
+			t.Errorf("%q: got no error", name)
+		}
+	}
+	if _, err := workerRule(&WorkerJob{Op: workerGraphOp, DataDir: "../d", Unit: &unit.SourceUnit{}}); err == nil {
+		t.Error("got no error for a data dir outside the tree")
+	}
+}
+
+func TestWorkerService_Run(t *testing.T) {
+	s := newWorkerService(1, "secret")
+	var ran bool
+	s.rule = func(job *WorkerJob) (makex.Rule, error) {
+		ran = true
+		return &makex.BasicRule{TargetFile: "t", RecipeCmds: []string{"echo > $@"}}, nil
+	}
+	for _, token := range []string{"", "wrong"} {
+		if _, err := s.Run(&WorkerJob{Token: token}); err != errWorkerBadToken {
+			t.Errorf("token %q: got error %v, want %v", token, err, errWorkerBadToken)
+		}
+	}
+	if ran {
+		t.Error("ran a job with an invalid token")
+	}
+	res, err := s.Run(&WorkerJob{Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := res.Files["t"]; !ok {
+		t.Errorf("got files %v, want the target", res.Files)
+	}
+}
+
+func TestExpandAutoVars(t *testing.T) {
+	rule := &makex.BasicRule{TargetFile: "d/$(x).out", PrereqFiles: []string{"a b", "c"}}
+	got := expandAutoVars("cat $< $^ > $@", rule)
+	if want := `cat "a b" "a b" "c" > 'd/$''(x).out'`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestRunRemoteRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-make-remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	if err := os.MkdirAll("src", 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{"src/a.txt": "a", "src/b.txt": "b"} {
+		if err := ioutil.WriteFile(filepath.FromSlash(name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// d/ab.out depends on d/a.out, which is built by another rule; the
+	// rule for d/a.out also reads src/b.txt (which isn't a
+	// prerequisite but is one of its unit's files). The worker makes
+	// the rules from the jobs' ops, as workerRule does from real ops.
+	workerRules := map[string]makex.Rule{
+		"ab":   &makex.BasicRule{TargetFile: "d/ab.out", PrereqFiles: []string{"d/a.out", "src/b.txt"}, RecipeCmds: []string{"cat $^ > $@"}},
+		"a":    &makex.BasicRule{TargetFile: "d/a.out", PrereqFiles: []string{"src/a.txt"}, RecipeCmds: []string{"cat $< src/b.txt > $@", "echo log > d/a.log"}},
+		"fail": &makex.BasicRule{TargetFile: "d/fail.out", RecipeCmds: []string{"exit 1"}},
+	}
+	cl, addr, stop := startTestWorker(t, func(job *WorkerJob) (makex.Rule, error) { return workerRules[job.Op], nil })
+	defer stop()
+
+	remote := func(op string, files ...string) *remoteRule {
+		return &remoteRule{
+			rule: workerRules[op],
+			job:  &WorkerJob{Token: "secret", Op: op, Unit: &unit.SourceUnit{Info: unit.Info{Files: files}}},
+		}
+	}
+	rules := []*remoteRule{remote("ab"), remote("a", "src/b.txt")}
+	if err := runRemoteRules(rules, []*grpc.ClientConn{cl}, []string{addr}, 2, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"d/a.out": "ab", "d/a.log": "log\n", "d/ab.out": "abb"} {
+		data, err := ioutil.ReadFile(filepath.FromSlash(name))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(data) != want {
+			t.Errorf("%s: got %q, want %q", name, data, want)
+		}
+	}
+
+	// Failing recipes are reported.
+	rules = []*remoteRule{remote("fail")}
+	if err := runRemoteRules(rules, []*grpc.ClientConn{cl}, []string{addr}, 1, false, nil); err == nil {
+		t.Error("got no error for failing recipe")
+	}
+}
+
+// startTestWorker serves a worker service (with the token "secret")
+// that makes the rules for jobs with rule, and returns a connection
+// to it and its address.
+func startTestWorker(t *testing.T, rule func(*WorkerJob) (makex.Rule, error)) (cl *grpc.ClientConn, addr string, stop func()) {
+	s := newWorkerService(2, "secret")
+	s.rule = rule
+	srv := grpc.NewServer(grpc.CustomCodec(workerCodec{}))
+	srv.RegisterService(&workerServiceDesc, s)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+	cl, err = dialWorker(l.Addr().String(), nil)
+	if err != nil {
+		srv.Stop()
+		t.Fatal(err)
+	}
+	return cl, l.Addr().String(), func() {
+		cl.Close()
+		srv.Stop()
+	}
+}
+
+func TestCallWorker(t *testing.T) {
+	// The input is larger than a chunk, and the rule creates an empty
+	// file.
+	big := bytes.Repeat([]byte("x"), 2*workerChunkSize+1)
+	cl, _, stop := startTestWorker(t, func(job *WorkerJob) (makex.Rule, error) {
+		return &makex.BasicRule{TargetFile: "d/out", PrereqFiles: []string{"in"}, RecipeCmds: []string{"cp $< $@", "touch d/empty", "echo done"}}, nil
+	})
+	defer stop()
+
+	res, err := callWorker(context.Background(), cl, &WorkerJob{Token: "secret", Files: map[string][]byte{"in": big}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res.Files["d/out"], big) {
+		t.Errorf("got %d bytes of d/out, want %d", len(res.Files["d/out"]), len(big))
+	}
+	if data, ok := res.Files["d/empty"]; !ok || len(data) != 0 {
+		t.Errorf("got d/empty %q (present: %v), want an empty file", data, ok)
+	}
+	if got, want := string(res.Output), "done\n"; got != want {
+		t.Errorf("got output %q, want %q", got, want)
+	}
+
+	if _, err := callWorker(context.Background(), cl, &WorkerJob{Token: "wrong", Files: map[string][]byte{"in": big}}); grpc.Code(err) != codes.Unauthenticated {
+		t.Errorf("got error %v for an invalid token, want code %s", err, codes.Unauthenticated)
+	}
+}
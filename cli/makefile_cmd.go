@@ -7,6 +7,7 @@ import (
 	"sourcegraph.com/sourcegraph/go-flags"
 
 	"sourcegraph.com/sourcegraph/makex"
+	"sourcegraph.com/sourcegraph/srclib/plan"
 )
 
 func init() {
@@ -22,20 +23,38 @@ func init() {
 	})
 }
 
-type MakefileCmd struct{}
+type MakefileCmd struct {
+	Profile string `long:"profile" description:"apply the named profile from the Srcfile (default: $SRCLIB_PROFILE)" value-name:"NAME"`
+
+	OnlyUnitsOpt
+}
 
 var makefileCmd MakefileCmd
 
 func (c *MakefileCmd) Execute(args []string) error {
-	mf, err := CreateMakefile()
+	mf, err := CreateMakefile(profileName(c.Profile), &c.OnlyUnitsOpt)
 	if err != nil {
 		return err
 	}
 
-	mfData, err := makex.Marshal(mf)
+	mfData, err := makex.Marshal(makeMakefile(mf))
 	if err != nil {
 		return err
 	}
 	_, err = os.Stdout.Write(mfData)
 	return err
 }
+
+// makeMakefile returns a copy of mf (whose recipes are for makex) in
+// which the recipes are escaped for make (see plan.EscapeMakeRecipe).
+func makeMakefile(mf *makex.Makefile) *makex.Makefile {
+	rules := make([]makex.Rule, len(mf.Rules))
+	for i, r := range mf.Rules {
+		recipes := make([]string, len(r.Recipes()))
+		for j, recipe := range r.Recipes() {
+			recipes[j] = plan.EscapeMakeRecipe(recipe)
+		}
+		rules[i] = &makex.BasicRule{TargetFile: r.Target(), PrereqFiles: r.Prereqs(), RecipeCmds: recipes}
+	}
+	return &makex.Makefile{Rules: rules}
+}
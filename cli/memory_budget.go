@@ -0,0 +1,218 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+)
+
+// MemoryBudgetEnv is the environment variable that "srclib make
+// --max-memory" sets (for the tools that its rules run) to the
+// address of its memory budget server. When it is set, "srclib tool"
+// reserves the memory that the tool is expected to need before
+// running it, and (on Linux) kills the tool if it uses more than its
+// reservation plus the budget's slack.
+const MemoryBudgetEnv = "SRCLIB_MEMORY_BUDGET"
+
+// defaultToolMemory is the memory (in megabytes) that a tool is
+// assumed to need if it doesn't declare its needs and hasn't been run
+// on the source unit before.
+const defaultToolMemory = 512
+
+// memorySampleInterval is how often the memory of a tool run under a
+// memory budget is sampled.
+var memorySampleInterval = 500 * time.Millisecond
+
+// A memoryBudget hands out reservations of memory (in megabytes) to
+// tools run by "srclib make --max-memory", so that the tools running
+// at once don't need more than the total.
+//
+// The protocol is line-based: a client connects, sends the number of
+// megabytes that it needs, and receives the slack (the megabytes that
+// the tool may use beyond its reservation before it's killed) when the
+// reservation is granted. The reservation is held until the client
+// closes the connection (or exits).
+type memoryBudget struct {
+	total int64
+	slack int64
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	used int64
+}
+
+func newMemoryBudget(total, slack int64) *memoryBudget {
+	b := &memoryBudget{total: total, slack: slack}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire blocks until n megabytes can be reserved. A reservation that
+// exceeds the total is granted when nothing else is reserved.
+func (b *memoryBudget) acquire(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.used > 0 && b.used+n > b.total {
+		b.cond.Wait()
+	}
+	b.used += n
+}
+
+func (b *memoryBudget) release(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+	b.cond.Broadcast()
+}
+
+// serve serves reservation requests on l until it is closed.
+func (b *memoryBudget) serve(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go b.serveConn(conn)
+	}
+}
+
+func (b *memoryBudget) serveConn(conn net.Conn) {
+	defer conn.Close()
+	var n int64
+	if _, err := fmt.Fscanln(conn, &n); err != nil || n < 0 {
+		return
+	}
+	b.acquire(n)
+	defer b.release(n)
+	if _, err := fmt.Fprintln(conn, b.slack); err != nil {
+		return
+	}
+	io.Copy(ioutil.Discard, conn)
+}
+
+// startMemoryBudget starts a memory budget server for total megabytes
+// (allowing tools slack megabytes beyond their reservations) and sets
+// MemoryBudgetEnv to its address. The returned func stops it.
+func startMemoryBudget(total, slack int64) (stop func(), err error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	go newMemoryBudget(total, slack).serve(l)
+	if err := os.Setenv(MemoryBudgetEnv, l.Addr().String()); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return func() {
+		os.Unsetenv(MemoryBudgetEnv)
+		l.Close()
+	}, nil
+}
+
+// acquireMemory reserves mb megabytes from the memory budget server at
+// addr, blocking until they're available. It returns the budget's
+// slack and a func that releases the reservation.
+func acquireMemory(addr string, mb int64) (slack int64, release func(), err error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return 0, nil, fmt.Errorf("connecting to memory budget server (%s=%s): %s", MemoryBudgetEnv, addr, err)
+	}
+	if _, err := fmt.Fprintln(conn, mb); err != nil {
+		conn.Close()
+		return 0, nil, err
+	}
+	if _, err := fmt.Fscanln(bufio.NewReader(conn), &slack); err != nil {
+		conn.Close()
+		return 0, nil, fmt.Errorf("reserving memory: %s", err)
+	}
+	return slack, func() { conn.Close() }, nil
+}
+
+// toolMemoryEstimate returns the memory (in megabytes) that a tool is
+// expected to need: its peak usage in the previous run logged in
+// logFile (if any), or else the memory that it declares (see
+// toolchain.ToolInfo.Memory), or else defaultToolMemory.
+func toolMemoryEstimate(toolchainPath, subcmd, logFile string) int64 {
+	if logFile != "" {
+		if data, err := ioutil.ReadFile(logFile); err == nil {
+			var prev plan.ToolLog
+			if err := json.Unmarshal(data, &prev); err == nil && prev.MaxRSS > 0 {
+				return prev.MaxRSS
+			}
+		}
+	}
+	if mb, err := toolchain.ToolMemory(toolchainPath, subcmd); err == nil && mb > 0 {
+		return int64(mb)
+	}
+	return defaultToolMemory
+}
+
+// runWithMemoryLimit runs cmd, sampling the memory used by it and its
+// child processes, and kills them if they use more than limit
+// megabytes (if limit > 0). Memory can only be measured on Linux;
+// elsewhere, cmd is run without a limit. It returns the peak memory
+// sampled (0 if memory can't be measured on this platform).
+func runWithMemoryLimit(cmd *exec.Cmd, limit int64) (peak int64, err error) {
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	var (
+		mu     sync.Mutex
+		killed bool
+	)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(memorySampleInterval)
+		defer t.Stop()
+		for {
+			pids, rss, err := processTree(cmd.Process.Pid)
+			if err != nil {
+				return // unsupported
+			}
+			mb := rss >> 20
+			mu.Lock()
+			if mb > peak {
+				peak = mb
+			}
+			if limit > 0 && mb > limit && !killed {
+				killed = true
+				log.Printf("Killing %v, which is using %d MB (more than its limit of %d MB under the memory budget).", cmd.Args, mb, limit)
+				for _, pid := range pids {
+					if p, err := os.FindProcess(pid); err == nil {
+						p.Kill()
+					}
+				}
+			}
+			mu.Unlock()
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+	err = cmd.Wait()
+	close(done)
+	<-stopped
+
+	mu.Lock()
+	defer mu.Unlock()
+	if killed {
+		err = fmt.Errorf("killed after exceeding its limit of %d MB under the memory budget (%s)", limit, err)
+	}
+	return peak, err
+}
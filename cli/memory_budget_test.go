@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	stop, err := startMemoryBudget(100, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	addr := os.Getenv(MemoryBudgetEnv)
+
+	slack, release1, err := acquireMemory(addr, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slack != 20 {
+		t.Errorf("got slack %d, want 20", slack)
+	}
+
+	// A reservation that doesn't fit waits for the first to be
+	// released.
+	acquired := make(chan func())
+	go func() {
+		_, release, err := acquireMemory(addr, 50)
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- release
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("got reservation exceeding the budget")
+	case <-time.After(100 * time.Millisecond):
+	}
+	release1()
+	release2 := <-acquired
+
+	// A reservation larger than the budget is granted when nothing
+	// else is reserved.
+	go func() {
+		_, release, err := acquireMemory(addr, 500)
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- release
+	}()
+	release2()
+	(<-acquired)()
+}
+
+func TestToolMemoryEstimate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-tool-memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logFile := filepath.Join(dir, "graph.log")
+	if got := toolMemoryEstimate("nonexistent/toolchain", "graph", logFile); got != defaultToolMemory {
+		t.Errorf("got %d MB with no log, want default %d MB", got, defaultToolMemory)
+	}
+	if err := ioutil.WriteFile(logFile, []byte(`{"MaxRSS": 1234}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got := toolMemoryEstimate("nonexistent/toolchain", "graph", logFile); got != 1234 {
+		t.Errorf("got %d MB, want 1234 MB (learned from the log)", got)
+	}
+}
+
+func TestRunWithMemoryLimit(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("measuring process memory is only supported on Linux")
+	}
+	defer func(d time.Duration) { memorySampleInterval = d }(memorySampleInterval)
+	memorySampleInterval = 20 * time.Millisecond
+
+	// The shell's child holds about 50 MB.
+	cmd := exec.Command("sh", "-c", `head -c 50000000 /dev/zero | tr '\0' a | (x=$(cat); sleep 10)`)
+	start := time.Now()
+	peak, err := runWithMemoryLimit(cmd, 10)
+	if err == nil || !strings.Contains(err.Error(), "memory budget") {
+		t.Errorf("got error %v, want it to be killed", err)
+	}
+	if peak <= 10 {
+		t.Errorf("got peak %d MB, want > 10 MB", peak)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("took %s to kill", d)
+	}
+
+	peak, err = runWithMemoryLimit(exec.Command("true"), 10)
+	if err != nil {
+		t.Error(err)
+	}
+	if peak > 10 {
+		t.Errorf("got peak %d MB for true", peak)
+	}
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// processTree returns the PIDs of the process pid and its descendants
+// (pid first) and their total resident memory in bytes, as reported
+// by /proc.
+func processTree(pid int) (pids []int, rss int64, err error) {
+	stats, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil {
+		return nil, 0, err
+	}
+	children := map[int][]int{}
+	pages := map[int]int64{}
+	for _, file := range stats {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue // the process exited
+		}
+		// The fields after the command name (which is in parens and
+		// may contain spaces) start with the state, ppid, ...; rss (in
+		// pages) is the 22nd.
+		i := bytes.LastIndexByte(data, ')')
+		if i < 0 {
+			continue
+		}
+		fields := bytes.Fields(data[i+1:])
+		if len(fields) < 22 {
+			continue
+		}
+		p, err := strconv.Atoi(filepath.Base(filepath.Dir(file)))
+		if err != nil {
+			continue
+		}
+		ppid, _ := strconv.Atoi(string(fields[1]))
+		n, _ := strconv.ParseInt(string(fields[21]), 10, 64)
+		children[ppid] = append(children[ppid], p)
+		pages[p] = n
+	}
+	if _, ok := pages[pid]; !ok {
+		return nil, 0, &os.PathError{Op: "stat", Path: "/proc/" + strconv.Itoa(pid), Err: os.ErrNotExist}
+	}
+
+	queue := []int{pid}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		pids = append(pids, p)
+		rss += pages[p] * int64(os.Getpagesize())
+		queue = append(queue, children[p]...)
+	}
+	return pids, rss, nil
+}
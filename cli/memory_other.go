@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package cli
+
+import "errors"
+
+// processTree is not supported on this platform, so tools run under a
+// memory budget are not measured or killed (but their reservations
+// still limit how many run at once).
+func processTree(pid int) (pids []int, rss int64, err error) {
+	return nil, 0, errors.New("measuring process memory is not supported on this platform")
+}
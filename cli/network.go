@@ -0,0 +1,22 @@
+package cli
+
+import (
+	"log"
+
+	"sourcegraph.com/sourcegraph/srclib"
+)
+
+func init() {
+	GlobalOpt.Offline = setOffline
+}
+
+// setOffline puts srclib in offline mode (for the --offline global
+// option). It also sets $SRCLIB_OFFLINE (and the other variables
+// returned by srclib.NetworkEnv), so that the srclib processes that
+// this one runs (e.g., in Makefile recipes) are offline, too.
+func setOffline() {
+	srclib.Offline = true
+	if err := srclib.ApplyNetworkEnv(); err != nil {
+		log.Fatal("--offline: ", err)
+	}
+}
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"sync"
+	"syscall"
+)
+
+func init() {
+	GlobalOpt.CPUProfile = startCPUProfile
+	GlobalOpt.MemProfile = func(file string) {
+		profiling.memProfile = file
+		stopProfilingOnSignal()
+	}
+	GlobalOpt.Trace = startTrace
+}
+
+// profiling holds the state of the profiles requested with the
+// --cpuprofile, --memprofile, and --trace global options. The
+// profiles are started when the options are parsed (before the
+// command runs) and written by stopProfiling (after it returns, or
+// when the process is interrupted, so that long-running commands such
+// as "srclib api serve" can be profiled).
+var profiling struct {
+	cpu, trace *os.File
+	memProfile string
+
+	mu       sync.Mutex // held while writing the profiles
+	onSignal sync.Once
+}
+
+// stopProfilingOnSignal makes the process write the profiles and exit
+// when it is interrupted or terminated.
+func stopProfilingOnSignal() {
+	profiling.onSignal.Do(func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			sig := <-c
+			stopProfiling()
+			log.Fatalf("Exiting on %s.", sig)
+		}()
+	})
+}
+
+func startCPUProfile(file string) {
+	f, err := os.Create(file)
+	if err != nil {
+		log.Fatal("--cpuprofile: ", err)
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		log.Fatal("--cpuprofile: ", err)
+	}
+	profiling.cpu = f
+	stopProfilingOnSignal()
+}
+
+func startTrace(file string) {
+	f, err := os.Create(file)
+	if err != nil {
+		log.Fatal("--trace: ", err)
+	}
+	if err := trace.Start(f); err != nil {
+		log.Fatal("--trace: ", err)
+	}
+	profiling.trace = f
+	stopProfilingOnSignal()
+}
+
+// stopProfiling stops the CPU profile and execution trace (if any)
+// and writes the heap profile (if requested).
+func stopProfiling() {
+	profiling.mu.Lock()
+	defer profiling.mu.Unlock()
+	if profiling.cpu != nil {
+		pprof.StopCPUProfile()
+		profiling.cpu.Close()
+		profiling.cpu = nil
+	}
+	if profiling.trace != nil {
+		trace.Stop()
+		profiling.trace.Close()
+		profiling.trace = nil
+	}
+	if profiling.memProfile != "" {
+		f, err := os.Create(profiling.memProfile)
+		if err != nil {
+			log.Printf("--memprofile: %s", err)
+			return
+		}
+		defer f.Close()
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			log.Printf("--memprofile: %s", err)
+		}
+		profiling.memProfile = ""
+	}
+}
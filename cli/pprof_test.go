@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProfiling(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-pprof")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cpu, mem, tr := filepath.Join(dir, "cpu"), filepath.Join(dir, "mem"), filepath.Join(dir, "trace")
+	startCPUProfile(cpu)
+	profiling.memProfile = mem
+	startTrace(tr)
+	stopProfiling()
+	for _, file := range []string{cpu, mem, tr} {
+		fi, err := os.Stat(file)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if fi.Size() == 0 {
+			t.Errorf("%s is empty", file)
+		}
+	}
+	if profiling.cpu != nil || profiling.trace != nil || profiling.memProfile != "" {
+		t.Error("profiling wasn't stopped")
+	}
+}
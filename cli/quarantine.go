@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"time"
+
+	"golang.org/x/tools/godoc/vfs"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+)
+
+// quarantineManifestFile is the name of the file (in a commit's build
+// data directory) that records the build data files that were moved
+// to the quarantine directory (see buildstore.QuarantineDirName).
+const quarantineManifestFile = buildstore.QuarantineDirName + "/manifest.json"
+
+// A quarantineRecord records a build data file that was quarantined
+// because it was corrupt.
+type quarantineRecord struct {
+	File          string    // the file's original path in the build data directory
+	QuarantinedAs string    // the file's path in the build data directory after it was quarantined
+	Error         string    // the error encountered when reading the file
+	Time          time.Time // when the file was quarantined
+}
+
+// corruptJSONFileError is returned by readBuildDataJSON when a build
+// data file is corrupt.
+type corruptJSONFileError struct {
+	File string
+	Err  error
+
+	// QuarantinedAs is the path to which the file was moved, or empty
+	// if it couldn't be quarantined.
+	QuarantinedAs string
+}
+
+func (e *corruptJSONFileError) Error() string {
+	if e.QuarantinedAs == "" {
+		return fmt.Sprintf("corrupt JSON file %s: %s", e.File, e.Err)
+	}
+	return fmt.Sprintf("corrupt JSON file %s (quarantined as %s): %s", e.File, e.QuarantinedAs, e.Err)
+}
+
+// isCorruptJSONFile reports whether err was returned by
+// readBuildDataJSON for a corrupt file.
+func isCorruptJSONFile(err error) bool {
+	_, ok := err.(*corruptJSONFileError)
+	return ok
+}
+
+// isCorruptJSON reports whether err (returned by readJSONFileFS)
+// indicates that the file is truncated or isn't valid JSON. Errors
+// decoding valid JSON into v (such as type mismatches) don't count,
+// since they are more likely to be caused by an incompatible version
+// of srclib than by a corrupt file.
+func isCorruptJSON(err error) bool {
+	if _, ok := err.(*json.SyntaxError); ok {
+		return true
+	}
+	return err == io.ErrUnexpectedEOF
+}
+
+// readBuildDataJSON is like readJSONFileFS, but if the build data file
+// is truncated or isn't valid JSON, it moves the file to the
+// quarantine directory (if fs is writable), records it in the
+// quarantine manifest, and returns a *corruptJSONFileError. Callers
+// should log the error and continue (as they do for empty files), so
+// that one corrupt file doesn't fail the whole operation, and the file
+// is rebuilt the next time the build data is made.
+func readBuildDataJSON(fs vfs.FileSystem, file string, v interface{}) error {
+	err := readJSONFileFS(fs, file, v)
+	if err == nil || !isCorruptJSON(err) {
+		return err
+	}
+	cerr := &corruptJSONFileError{File: file, Err: err}
+	if rwfs, ok := fs.(rwvfs.FileSystem); ok {
+		qfile, qerr := quarantineFile(rwfs, file, err)
+		if qerr != nil {
+			log.Printf("Warning: failed to quarantine corrupt JSON file %s: %s.", file, qerr)
+		}
+		cerr.QuarantinedAs = qfile
+	}
+	return cerr
+}
+
+// quarantineFile moves the corrupt file to the quarantine directory in
+// fs and records it in the quarantine manifest. It returns the file's
+// new path.
+func quarantineFile(fs rwvfs.FileSystem, file string, readErr error) (string, error) {
+	f, err := fs.Open(file)
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return "", err
+	}
+
+	qfile := path.Join(buildstore.QuarantineDirName, file)
+	if err := rwvfs.MkdirAll(fs, path.Dir(qfile)); err != nil {
+		return "", err
+	}
+	if err := writeFileFS(fs, qfile, data); err != nil {
+		return "", err
+	}
+	if err := fs.Remove(file); err != nil {
+		return "", err
+	}
+
+	records, err := readQuarantineManifest(fs)
+	if err != nil {
+		return qfile, err
+	}
+	records = append(records, &quarantineRecord{
+		File:          file,
+		QuarantinedAs: qfile,
+		Error:         readErr.Error(),
+		Time:          time.Now(),
+	})
+	data, err = json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return qfile, err
+	}
+	return qfile, writeFileFS(fs, quarantineManifestFile, data)
+}
+
+// readQuarantineManifest reads the records of the files quarantined
+// in fs. If none have been, it returns nil and no error.
+func readQuarantineManifest(fs vfs.FileSystem) ([]*quarantineRecord, error) {
+	var records []*quarantineRecord
+	if err := readJSONFileFS(fs, quarantineManifestFile, &records); err != nil && !os.IsNotExist(err) && err != errEmptyJSONFile {
+		return nil, fmt.Errorf("reading quarantine manifest %s: %s", quarantineManifestFile, err)
+	}
+	return records, nil
+}
+
+// writeFileFS writes data to file in fs, replacing any existing file.
+func writeFileFS(fs rwvfs.FileSystem, file string, data []byte) (err error) {
+	f, err := fs.Create(file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := f.Close()
+		if err == nil {
+			err = err2
+		}
+	}()
+	_, err = f.Write(data)
+	return err
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"os"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+)
+
+func TestReadBuildDataJSON(t *testing.T) {
+	fs := rwvfs.Map(map[string]string{
+		"u/good.graph.json":      `{"A": 1}`,
+		"u/truncated.graph.json": `{"A": 1`,
+		"u/invalid.graph.json":   `{"A": x}`,
+		"u/mismatch.graph.json":  `{"A": "x"}`,
+	})
+	var v struct{ A int }
+
+	if err := readBuildDataJSON(fs, "u/good.graph.json", &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.A != 1 {
+		t.Errorf("got A == %d, want 1", v.A)
+	}
+
+	// Type mismatches aren't corruption.
+	if err := readBuildDataJSON(fs, "u/mismatch.graph.json", &v); err == nil || isCorruptJSONFile(err) {
+		t.Errorf("got error %v, want a non-corrupt-file error", err)
+	}
+
+	for _, file := range []string{"u/truncated.graph.json", "u/invalid.graph.json"} {
+		err := readBuildDataJSON(fs, file, &v)
+		if !isCorruptJSONFile(err) {
+			t.Errorf("%s: got error %v, want a corrupt file error", file, err)
+			continue
+		}
+		if want := "quarantine/" + file; err.(*corruptJSONFileError).QuarantinedAs != want {
+			t.Errorf("%s: got QuarantinedAs %q, want %q", file, err.(*corruptJSONFileError).QuarantinedAs, want)
+		}
+		if _, err := fs.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("%s: got Stat error %v, want the file to be removed", file, err)
+		}
+		if _, err := fs.Stat("quarantine/" + file); err != nil {
+			t.Errorf("%s: quarantined file: %s", file, err)
+		}
+	}
+
+	records, err := readQuarantineManifest(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d quarantine records, want 2", len(records))
+	}
+	if r := records[0]; r.File != "u/truncated.graph.json" || r.QuarantinedAs != "quarantine/u/truncated.graph.json" || r.Error == "" {
+		t.Errorf("got record %+v", r)
+	}
+}
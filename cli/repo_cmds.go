@@ -31,5 +31,8 @@ func (c *repoCmd) Execute(args []string) error {
 	colorable.Println("VCS:", repo.VCSType)
 	colorable.Println("Root dir:", repo.RootDir)
 	colorable.Println("Commit ID:", repo.CommitID)
+	if repo.CloneURL != "" {
+		colorable.Println("Clone URL:", repo.CloneURL)
+	}
 	return nil
 }
@@ -1,21 +1,24 @@
 package cli
 
 import (
-	"bytes"
 	"fmt"
-	"path/filepath"
-
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strings"
 
-	"sourcegraph.com/sourcegraph/srclib/util"
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/vcs"
 )
 
 type Repo struct {
 	RootDir  string // Root directory containing repository being analyzed
-	VCSType  string // VCS type (git or hg)
+	VCSType  string // VCS type (git, hg, tree, or dir)
 	CommitID string // CommitID of current working directory
+	CloneURL string // CloneURL of repo (if known)
+
+	// VCS is the backend for the repository's VCS.
+	VCS vcs.VCS `json:"-"`
 }
 
 func OpenRepo(dir string) (*Repo, error) {
@@ -27,59 +30,106 @@ func OpenRepo(dir string) (*Repo, error) {
 
 	// VCS and root directory
 	var err error
-	rc.RootDir, rc.VCSType, err = getRootDir(dir)
-	if err != nil {
-		return nil, fmt.Errorf("detecting git/hg repository in %s: %s", dir, err)
+	rc.RootDir, rc.VCS, err = vcs.FindRoot(dir)
+	if err == vcs.ErrNoRepository && useDirVCS(dir) {
+		rc.RootDir, err = filepath.Abs(dir)
+		rc.VCS = vcs.Dir
+	}
+	if err == vcs.ErrNoRepository {
+		return nil, fmt.Errorf("no repository found in or above %s (to analyze an unversioned tree, set $%s=dir or \"VCS\": \"dir\" in the Srcfile at its top)", dir, VCSEnv)
 	}
-	if rc.RootDir == "" {
-		return nil, fmt.Errorf("no git/hg repository found in or above %s", dir)
+	if err != nil {
+		return nil, fmt.Errorf("detecting repository in %s: %s", dir, err)
 	}
+	rc.VCSType = rc.VCS.Type()
 
-	rc.CommitID, err = resolveWorkingTreeRevision(rc.VCSType, rc.RootDir)
+	rc.CommitID, err = rc.VCS.CommitID(rc.RootDir)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := rc.resolveCloneURL(); err != nil {
+		return nil, err
+	}
+
 	return rc, nil
 }
 
-func resolveWorkingTreeRevision(vcsType string, dir string) (string, error) {
-	var cmd *exec.Cmd
-	switch vcsType {
-	case "git":
-		cmd = exec.Command("git", "rev-parse", "HEAD")
-	case "hg":
-		cmd = exec.Command("hg", "--config", "trusted.users=root", "identify", "--debug", "-i")
-	default:
-		return "", fmt.Errorf("unknown vcs type: %q", vcsType)
+// VCSEnv is the name of the environment variable that, if set to
+// "dir", makes srclib treat a directory that isn't in a repository as
+// an unversioned tree (see vcs.Dir).
+const VCSEnv = "SRCLIB_VCS"
+
+// useDirVCS reports whether dir (which isn't in a repository) should
+// be opened as an unversioned tree: if $SRCLIB_VCS is "dir" or dir's
+// Srcfile sets VCS to "dir". Otherwise, commands that don't need a
+// commit ID (such as "srclib --help" in a home directory) would hash
+// every file under dir.
+func useDirVCS(dir string) bool {
+	if os.Getenv(VCSEnv) == vcs.Dir.Type() {
+		return true
 	}
-	cmd.Dir = dir
+	cfg, err := config.ReadRepository(dir)
+	return err == nil && cfg.VCS == vcs.Dir.Type()
+}
 
-	out, err := cmd.CombinedOutput()
+// resolveCloneURL sets r.CloneURL. An explicit clone URL (from the
+// --clone-url flag, $SRCLIB_CLONE_URL, or the Srcfile's CloneURL, in
+// that order) is used if given. Otherwise the URL of one of the
+// repository's VCS remotes is used, chosen according to the remote
+// selection policy (from the --remote flag, $SRCLIB_REMOTES, the
+// Srcfile's Remotes, or vcs.DefaultRemotes, in that order).
+func (r *Repo) resolveCloneURL() error {
+	// Errors in the Srcfile are reported by the commands that use
+	// it, so don't fail to open the repo because of them here.
+	var cfg config.Repository
+	if c, err := config.ReadRepository(r.RootDir); err == nil {
+		cfg = *c
+	}
+
+	r.CloneURL = firstNonEmpty(GlobalOpt.CloneURL, os.Getenv("SRCLIB_CLONE_URL"), cfg.CloneURL)
+	if r.CloneURL != "" {
+		return nil
+	}
+
+	policy := vcs.DefaultRemotes
+	if len(GlobalOpt.Remotes) > 0 {
+		policy = GlobalOpt.Remotes
+	} else if v := os.Getenv("SRCLIB_REMOTES"); v != "" {
+		policy = strings.Split(v, ",")
+	} else if len(cfg.Remotes) > 0 {
+		policy = cfg.Remotes
+	}
+
+	remotes, err := r.VCS.Remotes(r.RootDir)
 	if err != nil {
-		return "", fmt.Errorf("exec %v failed: %s. Output was:\n\n%s", cmd.Args, err, out)
+		return err
 	}
-	// hg adds a "+" if the wd is dirty
-	return strings.TrimSuffix(string(bytes.TrimSpace(out)), "+"), nil
+	if remote, ok := vcs.SelectRemote(remotes, policy); ok {
+		r.CloneURL = remote.URL
+	}
+	return nil
 }
 
-func getRootDir(dir string) (rootDir string, vcsType string, err error) {
-	dir, err = filepath.Abs(dir)
-	if err != nil {
-		return "", "", err
+// applyNetworkConfig applies the network settings in the Srcfile
+// config cfg: its Proxy is used unless $SRCLIB_PROXY is set, and its
+// Offline enables offline mode. The resulting settings are exported to
+// the environment of the programs that srclib runs.
+func applyNetworkConfig(cfg *config.Repository) error {
+	if srclib.Proxy == "" {
+		srclib.Proxy = cfg.Proxy
+	}
+	if cfg.Offline {
+		srclib.Offline = true
 	}
-	ancestors := util.AncestorDirs(dir, true)
-
-	vcsTypes := []string{"git", "hg"}
-	for i := len(ancestors) - 1; i >= 0; i-- {
-		ancDir := ancestors[i]
-		for _, vt := range vcsTypes {
-			// Don't check that the FileInfo is a dir because git
-			// submodules have a .git file.
-			if _, err := os.Stat(filepath.Join(ancDir, "."+vt)); err == nil {
-				return ancDir, vt, nil
-			}
+	return srclib.ApplyNetworkEnv()
+}
+
+func firstNonEmpty(strs ...string) string {
+	for _, s := range strs {
+		if s != "" {
+			return s
 		}
 	}
-	return "", "", nil
+	return ""
 }
@@ -24,6 +24,13 @@ func OpenLocalRepo() (*Repo, error) {
 	// time, since we never modify it).
 	if localRepo == nil && localRepoErr == nil {
 		localRepo, localRepoErr = OpenRepo(".")
+	} else if localRepo != nil && (GlobalOpt.CloneURL != "" || len(GlobalOpt.Remotes) > 0) {
+		// The local repo may have been opened before the global
+		// options were parsed (e.g., to set flag defaults), so honor
+		// the clone URL options now.
+		if err := localRepo.resolveCloneURL(); err != nil {
+			return nil, err
+		}
 	}
 	return localRepo, localRepoErr
 }
@@ -0,0 +1,530 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/go-flags"
+
+	"sourcegraph.com/sourcegraph/srclib/authorship"
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/defhistory"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+	"sourcegraph.com/sourcegraph/srclib/vcs"
+)
+
+func init() {
+	cliInit = append(cliInit, func(cli *flags.Command) {
+		_, err := cli.AddCommand("review",
+			"annotate the changes between two commits",
+			`Compares the build data of a base and a head commit of the current repository and annotates each hunk of the diff between them with the defs that were added, removed, or renamed in it and the refs in it that no longer resolve. Defs that were removed or renamed are also annotated with the refs elsewhere in the repository that still refer to them (and are now broken).
+
+The annotations are printed as JSON or as SARIF, for posting to code review systems. Both commits must have been built (see "srclib make --commits").`,
+			&reviewCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	})
+}
+
+type ReviewCmd struct {
+	Base   string `long:"base" description:"base commit of the change" value-name:"COMMIT" required:"yes"`
+	Head   string `long:"head" description:"head commit of the change (default: the current commit)" value-name:"COMMIT"`
+	Format string `long:"format" description:"output format" default:"json" value-name:"json|sarif"`
+}
+
+var reviewCmd ReviewCmd
+
+// The types of review annotations.
+const (
+	reviewDefAdded      = "def-added"
+	reviewDefRemoved    = "def-removed"
+	reviewDefRenamed    = "def-renamed"
+	reviewRefUnresolved = "ref-unresolved"
+)
+
+// A reviewReport is the output of "srclib review".
+type reviewReport struct {
+	Base, Head string
+
+	// Hunks lists the hunks of the diff that have annotations, in diff
+	// order.
+	Hunks []*reviewHunk
+
+	// Unplaced lists the annotations of changes that aren't in any
+	// hunk (such as refs in unchanged lines to defs in generated
+	// files), sorted by file and line.
+	Unplaced []*reviewAnnotation `json:",omitempty"`
+}
+
+type reviewHunk struct {
+	vcs.DiffHunk
+	Annotations []*reviewAnnotation
+}
+
+// A reviewAnnotation describes a change to a def or ref.
+type reviewAnnotation struct {
+	Type string
+
+	// Level is the SARIF level of the annotation: "error" for
+	// unresolved refs and for removed or renamed defs that are still
+	// referenced, and "note" otherwise.
+	Level string
+
+	Message string
+
+	// File and Line are the annotated location at the head commit.
+	// For removed defs, they are the location of the hunk that
+	// removed the def, and OrigFile and OrigLine are the def's
+	// location at the base commit (as they are for renamed defs).
+	File     string `json:",omitempty"`
+	Line     int    `json:",omitempty"`
+	OrigFile string `json:",omitempty"`
+	OrigLine int    `json:",omitempty"`
+
+	// Def is the key of the def (or, for refs, of the def that the ref
+	// refers to) without its repository and commit. For renamed defs,
+	// From is the def's key at the base commit.
+	Def  graph.DefKey
+	From *graph.DefKey `json:",omitempty"`
+
+	// BrokenRefs lists the refs at the head commit that refer to a
+	// removed or renamed def by its base key.
+	BrokenRefs []*reviewRef `json:",omitempty"`
+}
+
+type reviewRef struct {
+	File       string
+	Line       int `json:",omitempty"`
+	Start, End uint32
+}
+
+// A reviewCommit is the build data of a commit to review.
+type reviewCommit struct {
+	ID    string
+	Defs  []*graph.Def
+	Refs  []*graph.Ref
+	Units []*unit.SourceUnit
+
+	// ReadFile returns the contents of a file at the commit, which
+	// are used to convert byte offsets to lines.
+	ReadFile func(file string) ([]byte, error)
+
+	files map[string][]byte
+}
+
+func (c *ReviewCmd) Execute(args []string) error {
+	repo, err := OpenRepo(".")
+	if err != nil {
+		return err
+	}
+	head := c.Head
+	if head == "" {
+		head = repo.CommitID
+	}
+	if c.Format != "json" && c.Format != "sarif" {
+		return fmt.Errorf("unknown output format %q (expected json or sarif)", c.Format)
+	}
+	if c.Base == head {
+		return fmt.Errorf("base and head commits are the same (%s)", head)
+	}
+
+	bs, err := buildstore.LocalRepo(repo.RootDir)
+	if err != nil {
+		return err
+	}
+	commits := make([]*reviewCommit, 2)
+	for i, commitID := range []string{c.Base, head} {
+		if exists, err := buildstore.BuildDataExistsForCommit(bs, commitID); err != nil {
+			return err
+		} else if !exists {
+			return fmt.Errorf("commit %s has not been built (run 'srclib make --commits' first)", commitID)
+		}
+		rc := &reviewCommit{ID: commitID}
+		rc.ReadFile = func(file string) ([]byte, error) {
+			return repo.VCS.ReadFileAt(repo.RootDir, rc.ID, file)
+		}
+		err := readBuildDataGraphs(commitID, func(u *unit.SourceUnit, o *graph.Output) {
+			rc.Units = append(rc.Units, u)
+			if o != nil {
+				rc.Defs = append(rc.Defs, o.Defs...)
+				rc.Refs = append(rc.Refs, o.Refs...)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		commits[i] = rc
+	}
+
+	hunks, err := repo.VCS.Diff(repo.RootDir, c.Base, head)
+	if err != nil {
+		return err
+	}
+	report, err := reviewChanges(commits[0], commits[1], hunks)
+	if err != nil {
+		return err
+	}
+	if c.Format == "sarif" {
+		PrintJSON(reviewSARIF(report), "  ")
+	} else {
+		PrintJSON(report, "  ")
+	}
+	return nil
+}
+
+// lineAt returns the line of the byte offset off in file at the
+// commit, or 0 if the file can't be read.
+func (c *reviewCommit) lineAt(file string, off uint32) int {
+	if c.files == nil {
+		c.files = map[string][]byte{}
+	}
+	src, ok := c.files[file]
+	if !ok {
+		var err error
+		if src, err = c.ReadFile(file); err != nil {
+			log.Printf("Warning: couldn't read %s at commit %s: %s.", file, c.ID, err)
+		}
+		c.files[file] = src
+	}
+	if src == nil {
+		return 0
+	}
+	return authorship.LineOf(src, off)
+}
+
+// reviewDefKey returns k without its repository and commit, which
+// don't identify a def across the commits of a repository.
+func reviewDefKey(k graph.DefKey) graph.DefKey {
+	k.Repo, k.CommitID = "", ""
+	return k
+}
+
+// unresolvedRefs returns the refs at commit c that refer to defs
+// that don't exist at c, grouped by the def's key (see reviewDefKey).
+// Refs to defs in other repositories, or in units that aren't in
+// units, are assumed to resolve.
+func (c *reviewCommit) unresolvedRefs(units map[unit.Key]bool) map[graph.DefKey][]*graph.Ref {
+	defs := map[graph.DefKey]bool{}
+	for _, d := range c.Defs {
+		defs[reviewDefKey(d.DefKey)] = true
+	}
+	refs := map[graph.DefKey][]*graph.Ref{}
+	for _, r := range c.Refs {
+		if r.DefRepo != "" && r.DefRepo != r.Repo {
+			continue
+		}
+		k := reviewDefKey(r.DefKey())
+		if k.UnitType == "" && k.Unit == "" {
+			k.UnitType, k.Unit = r.UnitType, r.Unit
+		}
+		if !units[unit.Key{Type: k.UnitType, Name: k.Unit}] || defs[k] {
+			continue
+		}
+		refs[k] = append(refs[k], r)
+	}
+	return refs
+}
+
+// reviewChanges annotates the hunks of the diff between the base and
+// head commits with the changes to their defs and refs.
+//
+// Added, removed, and renamed defs are found with the def history
+// (see package defhistory), which matches defs that moved. An added
+// and a removed def of the same kind and unit in the same hunk are
+// also considered to be a rename.
+func reviewChanges(base, head *reviewCommit, hunks []vcs.DiffHunk) (*reviewReport, error) {
+	h := &defhistory.History{}
+	if err := h.Add(base.ID, base.Defs); err != nil {
+		return nil, err
+	}
+	if err := h.Add(head.ID, head.Defs); err != nil {
+		return nil, err
+	}
+	baseDefs, headDefs := map[graph.DefKey]*graph.Def{}, map[graph.DefKey]*graph.Def{}
+	for _, d := range base.Defs {
+		baseDefs[reviewDefKey(d.DefKey)] = d
+	}
+	for _, d := range head.Defs {
+		headDefs[reviewDefKey(d.DefKey)] = d
+	}
+
+	rh := make([]*reviewHunk, len(hunks))
+	for i, hunk := range hunks {
+		rh[i] = &reviewHunk{DiffHunk: hunk}
+	}
+	// headHunk and baseHunk return the hunk that contains the line of
+	// file at the head or base commit, or nil if there is none.
+	headHunk := func(file string, line int) *reviewHunk {
+		for _, h := range rh {
+			if h.File == file && line >= h.Start && line < h.Start+h.Lines {
+				return h
+			}
+		}
+		return nil
+	}
+	baseHunk := func(file string, line int) *reviewHunk {
+		for _, h := range rh {
+			if h.OrigFile == file && line >= h.OrigStart && line < h.OrigStart+h.OrigLines {
+				return h
+			}
+		}
+		return nil
+	}
+
+	var unplaced []*reviewAnnotation
+	place := func(h *reviewHunk, a *reviewAnnotation) {
+		if h == nil {
+			unplaced = append(unplaced, a)
+		} else {
+			h.Annotations = append(h.Annotations, a)
+		}
+	}
+
+	// Annotate the defs that were added, removed, or renamed.
+	var changed []*reviewAnnotation // removed and renamed defs
+	removedIn := map[*reviewHunk][]*reviewAnnotation{}
+	for _, l := range h.Lineages {
+		e := l.Last()
+		if e.CommitID != head.ID {
+			continue
+		}
+		switch e.Type {
+		case defhistory.Appeared:
+			d := headDefs[e.Key]
+			line := head.lineAt(d.File, d.DefStart)
+			place(headHunk(d.File, line), &reviewAnnotation{Type: reviewDefAdded, File: d.File, Line: line, Def: e.Key})
+		case defhistory.Deleted:
+			d := baseDefs[e.Key]
+			a := &reviewAnnotation{Type: reviewDefRemoved, OrigFile: d.File, OrigLine: base.lineAt(d.File, d.DefStart), Def: e.Key}
+			hunk := baseHunk(a.OrigFile, a.OrigLine)
+			if hunk != nil {
+				// The removed lines are after line Start.
+				a.File, a.Line = hunk.File, hunk.Start
+				if a.Line == 0 {
+					a.Line = 1
+				}
+				removedIn[hunk] = append(removedIn[hunk], a)
+			}
+			place(hunk, a)
+			changed = append(changed, a)
+		case defhistory.Moved:
+			if *e.From == e.Key {
+				// Only its file changed (e.g., because the file was
+				// renamed), which the diff itself shows.
+				continue
+			}
+			d, from := headDefs[e.Key], baseDefs[*e.From]
+			line := head.lineAt(d.File, d.DefStart)
+			a := &reviewAnnotation{Type: reviewDefRenamed, File: d.File, Line: line, OrigFile: from.File, OrigLine: base.lineAt(from.File, from.DefStart), Def: e.Key, From: e.From}
+			place(headHunk(d.File, line), a)
+			changed = append(changed, a)
+		}
+	}
+
+	// Pair the added and removed defs in each hunk as renames, if
+	// the pairing is unambiguous.
+	for _, h := range rh {
+		var added []*reviewAnnotation
+		for _, a := range h.Annotations {
+			if a.Type == reviewDefAdded {
+				added = append(added, a)
+			}
+		}
+		renamed := map[*reviewAnnotation]bool{}
+		for _, a := range added {
+			d := headDefs[a.Def]
+			as := matchingDefs(added, headDefs, d)
+			rs := matchingDefs(removedIn[h], baseDefs, d)
+			if len(as) != 1 || len(rs) != 1 {
+				continue
+			}
+			r := rs[0]
+			from := r.Def
+			r.Type, r.Def, r.From = reviewDefRenamed, a.Def, &from
+			r.File, r.Line = a.File, a.Line
+			renamed[a] = true
+		}
+		anns := h.Annotations[:0]
+		for _, a := range h.Annotations {
+			if !renamed[a] {
+				anns = append(anns, a)
+			}
+		}
+		h.Annotations = anns
+	}
+
+	// Annotate the refs that no longer resolve, and the removed and
+	// renamed defs that they refer to.
+	units := map[unit.Key]bool{}
+	for _, c := range []*reviewCommit{base, head} {
+		for _, u := range c.Units {
+			units[unit.Key{Type: u.Type, Name: u.Name}] = true
+		}
+	}
+	wasUnresolved := base.unresolvedRefs(units)
+	broken := head.unresolvedRefs(units)
+	keys := make([]graph.DefKey, 0, len(broken))
+	for k := range broken {
+		if _, ok := wasUnresolved[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Sort(reviewDefKeys(keys))
+	for _, k := range keys {
+		var def *reviewAnnotation
+		for _, a := range changed {
+			if (a.Type == reviewDefRemoved && a.Def == k) || (a.Type == reviewDefRenamed && *a.From == k) {
+				def = a
+			}
+		}
+		for _, r := range broken[k] {
+			line := head.lineAt(r.File, r.Start)
+			if def != nil {
+				def.BrokenRefs = append(def.BrokenRefs, &reviewRef{File: r.File, Line: line, Start: r.Start, End: r.End})
+			}
+			if hunk := headHunk(r.File, line); hunk != nil || def == nil {
+				place(hunk, &reviewAnnotation{Type: reviewRefUnresolved, File: r.File, Line: line, Def: k})
+			}
+		}
+	}
+
+	report := &reviewReport{Base: base.ID, Head: head.ID, Hunks: []*reviewHunk{}}
+	for _, h := range rh {
+		if len(h.Annotations) > 0 {
+			sort.Stable(reviewAnnotationsByLine(h.Annotations))
+			report.Hunks = append(report.Hunks, h)
+		}
+	}
+	sort.Stable(reviewAnnotationsByLine(unplaced))
+	report.Unplaced = unplaced
+	for _, a := range report.annotations() {
+		a.Level, a.Message = reviewAnnotationMessage(a, baseDefs, headDefs)
+	}
+	return report, nil
+}
+
+// annotations returns all of the report's annotations, those in hunks
+// first.
+func (r *reviewReport) annotations() []*reviewAnnotation {
+	var anns []*reviewAnnotation
+	for _, h := range r.Hunks {
+		anns = append(anns, h.Annotations...)
+	}
+	return append(anns, r.Unplaced...)
+}
+
+// matchingDefs returns the annotations of the defs (in defs) with the
+// same kind and unit as d.
+func matchingDefs(anns []*reviewAnnotation, defs map[graph.DefKey]*graph.Def, d *graph.Def) []*reviewAnnotation {
+	var match []*reviewAnnotation
+	for _, a := range anns {
+		if o := defs[a.Def]; o.Kind == d.Kind && o.UnitType == d.UnitType && o.Unit == d.Unit {
+			match = append(match, a)
+		}
+	}
+	return match
+}
+
+// maxReviewBrokenRefs is the maximum number of broken refs whose
+// locations are listed in an annotation's message.
+const maxReviewBrokenRefs = 5
+
+// reviewAnnotationMessage returns the SARIF level and the message of
+// a.
+func reviewAnnotationMessage(a *reviewAnnotation, baseDefs, headDefs map[graph.DefKey]*graph.Def) (level, msg string) {
+	level = "note"
+	switch a.Type {
+	case reviewDefAdded:
+		msg = fmt.Sprintf("Added %s.", reviewDefLabel(headDefs[a.Def]))
+	case reviewDefRemoved:
+		msg = fmt.Sprintf("Removed %s.", reviewDefLabel(baseDefs[a.Def]))
+	case reviewDefRenamed:
+		msg = fmt.Sprintf("Renamed %s to %s.", reviewDefLabel(baseDefs[*a.From]), a.Def.Path)
+	case reviewRefUnresolved:
+		return "error", fmt.Sprintf("Reference to %s (in %s %s) does not resolve.", a.Def.Path, a.Def.UnitType, a.Def.Unit)
+	}
+	if n := len(a.BrokenRefs); n > 0 {
+		level = "error"
+		locs := make([]string, 0, maxReviewBrokenRefs)
+		for i, r := range a.BrokenRefs {
+			if i == maxReviewBrokenRefs {
+				locs = append(locs, fmt.Sprintf("and %d more", n-i))
+				break
+			}
+			locs = append(locs, fmt.Sprintf("%s:%d", r.File, r.Line))
+		}
+		refs := "references to it are"
+		if n == 1 {
+			refs = "reference to it is"
+		}
+		msg += fmt.Sprintf(" %d %s now broken: %s.", n, refs, strings.Join(locs, ", "))
+	}
+	return level, msg
+}
+
+// reviewDefLabel returns the kind and def path of d.
+func reviewDefLabel(d *graph.Def) string {
+	if d.Kind == "" {
+		return d.Path
+	}
+	return d.Kind + " " + d.Path
+}
+
+// reviewSARIF returns a SARIF log of the annotations in report, with
+// a single run.
+func reviewSARIF(report *reviewReport) *sarifLog {
+	run := sarifRun{Results: []sarifResult{}}
+	run.Tool.Driver.Name = "srclib review"
+	for _, a := range report.annotations() {
+		r := sarifResult{
+			RuleID:     a.Type,
+			Level:      a.Level,
+			Message:    sarifMessage{Text: a.Message},
+			Properties: map[string]string{"unitType": a.Def.UnitType, "unit": a.Def.Unit, "defPath": a.Def.Path},
+		}
+		if a.File != "" {
+			var loc sarifLocation
+			loc.PhysicalLocation.ArtifactLocation.URI = a.File
+			if a.Line > 0 {
+				loc.PhysicalLocation.Region = &sarifRegion{StartLine: a.Line}
+			}
+			r.Locations = []sarifLocation{loc}
+		}
+		run.Results = append(run.Results, r)
+	}
+	return &sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs:    []sarifRun{run},
+	}
+}
+
+type reviewAnnotationsByLine []*reviewAnnotation
+
+func (v reviewAnnotationsByLine) Len() int      { return len(v) }
+func (v reviewAnnotationsByLine) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v reviewAnnotationsByLine) Less(i, j int) bool {
+	if v[i].File != v[j].File {
+		return v[i].File < v[j].File
+	}
+	return v[i].Line < v[j].Line
+}
+
+type reviewDefKeys []graph.DefKey
+
+func (v reviewDefKeys) Len() int      { return len(v) }
+func (v reviewDefKeys) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v reviewDefKeys) Less(i, j int) bool {
+	if v[i].UnitType != v[j].UnitType {
+		return v[i].UnitType < v[j].UnitType
+	}
+	if v[i].Unit != v[j].Unit {
+		return v[i].Unit < v[j].Unit
+	}
+	return v[i].Path < v[j].Path
+}
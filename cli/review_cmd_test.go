@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+	"sourcegraph.com/sourcegraph/srclib/vcs"
+)
+
+func TestReviewChanges(t *testing.T) {
+	def := func(path string, file string, start uint32) *graph.Def {
+		return &graph.Def{DefKey: graph.DefKey{UnitType: "t", Unit: "u", Path: path}, Name: path, Kind: "func", File: file, DefStart: start}
+	}
+	ref := func(path string, file string, start uint32) *graph.Ref {
+		return &graph.Ref{DefUnitType: "t", DefUnit: "u", DefPath: path, UnitType: "t", Unit: "u", File: file, Start: start, End: start + 1}
+	}
+	readFile := func(files map[string]string) func(string) ([]byte, error) {
+		return func(file string) ([]byte, error) {
+			src, ok := files[file]
+			if !ok {
+				return nil, os.ErrNotExist
+			}
+			return []byte(src), nil
+		}
+	}
+	units := []*unit.SourceUnit{{Key: unit.Key{Type: "t", Name: "u"}}}
+
+	// F is removed, G is renamed to G2 (breaking a ref to it), and K
+	// is added. Refs to Missing and to other repositories were already
+	// unresolved and aren't reported.
+	base := &reviewCommit{
+		ID:    "b",
+		Defs:  []*graph.Def{def("F", "a.go", 0), def("G", "a.go", 12), def("H", "a.go", 24)},
+		Refs:  []*graph.Ref{ref("F", "b.go", 0), ref("Missing", "b.go", 4)},
+		Units: units,
+		ReadFile: readFile(map[string]string{
+			"a.go": "func F() {}\nfunc G() {}\nfunc H() {}\n",
+			"b.go": "F()\nMissing()\n",
+		}),
+	}
+	otherRepo := ref("X", "b.go", 4)
+	otherRepo.DefRepo = "example.com/other"
+	head := &reviewCommit{
+		ID:    "h",
+		Defs:  []*graph.Def{def("G2", "a.go", 0), def("H", "a.go", 13), def("K", "a.go", 30)},
+		Refs:  []*graph.Ref{ref("G", "a.go", 24), ref("F", "b.go", 0), ref("Missing", "b.go", 4), otherRepo},
+		Units: units,
+		ReadFile: readFile(map[string]string{
+			"a.go": "func G2() {}\nfunc H() { G() }\nfunc K() {}\n",
+			"b.go": "F()\nMissing()\n",
+		}),
+	}
+	hunks := []vcs.DiffHunk{
+		{OrigFile: "a.go", File: "a.go", OrigStart: 1, OrigLines: 1, Start: 0, Lines: 0},
+		{OrigFile: "a.go", File: "a.go", OrigStart: 2, OrigLines: 1, Start: 1, Lines: 1},
+		{OrigFile: "a.go", File: "a.go", OrigStart: 3, OrigLines: 1, Start: 2, Lines: 1},
+		{OrigFile: "a.go", File: "a.go", OrigStart: 3, OrigLines: 0, Start: 3, Lines: 1},
+	}
+
+	report, err := reviewChanges(base, head, hunks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, h := range report.Hunks {
+		for _, a := range h.Annotations {
+			got = append(got, fmt.Sprintf("%d %s %s %s:%d %s", h.OrigStart, a.Level, a.Type, a.File, a.Line, a.Message))
+		}
+	}
+	want := []string{
+		"1 error def-removed a.go:1 Removed func F. 1 reference to it is now broken: b.go:1.",
+		"2 error def-renamed a.go:1 Renamed func G to G2. 1 reference to it is now broken: a.go:2.",
+		"3 error ref-unresolved a.go:2 Reference to G (in t u) does not resolve.",
+		"3 note def-added a.go:3 Added func K.",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got annotations\n%q\nwant\n%q", got, want)
+	}
+	if len(report.Unplaced) != 0 {
+		t.Errorf("got unplaced annotations %+v, want none", report.Unplaced)
+	}
+
+	s := reviewSARIF(report)
+	if len(s.Runs) != 1 || len(s.Runs[0].Results) != 4 {
+		t.Fatalf("got SARIF runs %+v, want 1 run with 4 results", s.Runs)
+	}
+	if r := s.Runs[0].Results[1]; r.RuleID != reviewDefRenamed || r.Locations[0].PhysicalLocation.Region.StartLine != 1 || r.Properties["defPath"] != "G2" {
+		t.Errorf("got SARIF result %+v, want rename of G2 at line 1", r)
+	}
+}
@@ -0,0 +1,364 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/alexsaveliev/go-colorable-wrapper"
+	"sourcegraph.com/sourcegraph/go-flags"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+)
+
+func init() {
+	cliInit = append(cliInit, func(cli *flags.Command) {
+		c, err := cli.AddCommand("stats",
+			"statistics about the data in a store",
+			"The stats subcommands aggregate the data that was imported into a store (by `srclib store import`).",
+			&statsCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+		setLocalStoreRootDefault(c.Group)
+
+		_, err = c.AddCommand("defs",
+			"def usage statistics",
+			`Counts the refs to each def in the store and reports the most referenced defs, the exported defs that have no refs, and the fan-in and fan-out of each source unit (the number of other source units that refer to it and that it refers to).
+
+Refs from a def's own definition are not counted. With a MultiRepoStore (--type MultiRepoStore), refs across all repositories in the store are counted unless --repo is given.`,
+			&statsDefsCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	})
+}
+
+type StatsCmd struct {
+	StoreCmd
+}
+
+var statsCmd StatsCmd
+
+func (c *StatsCmd) Execute(args []string) error { return nil }
+
+type StatsDefsCmd struct {
+	Repo     string `long:"repo" description:"only count defs and refs in this repository"`
+	CommitID string `long:"commit" description:"only count defs and refs at this commit (default: the current commit, for a RepoStore)"`
+
+	ExportedOnly bool `long:"exported-only" description:"only list exported defs (with public or protected visibility) among the most referenced defs"`
+
+	TestCodeOpt
+
+	Top    int    `short:"n" long:"top" description:"number of most referenced defs to list (0 for all)" default:"20"`
+	Format string `long:"format" description:"output format" default:"table" value-name:"table|json"`
+}
+
+var statsDefsCmd StatsDefsCmd
+
+func (c *StatsDefsCmd) Execute(args []string) error {
+	if c.Format != "table" && c.Format != "json" {
+		return fmt.Errorf("unknown output format %q (expected table or json)", c.Format)
+	}
+
+	s, err := statsCmd.store()
+	if err != nil {
+		return err
+	}
+	rs, ok := s.(store.RepoStore)
+	if !ok {
+		return fmt.Errorf("store (type %T) does not implement listing defs and refs", s)
+	}
+
+	commitID := c.CommitID
+	if _, isMulti := s.(store.MultiRepoStore); commitID == "" && !isMulti {
+		repo, err := OpenLocalRepo()
+		if err != nil {
+			return err
+		}
+		commitID = repo.CommitID
+	}
+	var defFilters []store.DefFilter
+	var refFilters []store.RefFilter
+	if c.Repo != "" {
+		defFilters = append(defFilters, store.ByRepos(c.Repo))
+		refFilters = append(refFilters, store.ByRepos(c.Repo))
+	}
+	if commitID != "" {
+		defFilters = append(defFilters, store.ByCommitIDs(commitID))
+		refFilters = append(refFilters, store.ByCommitIDs(commitID))
+	}
+	if f := c.testCodeFilter(); f != nil {
+		defFilters = append(defFilters, f)
+		refFilters = append(refFilters, f)
+	}
+
+	defs, err := rs.Defs(defFilters...)
+	if err != nil {
+		return err
+	}
+	refs, err := rs.Refs(refFilters...)
+	if err != nil {
+		return err
+	}
+
+	stats := computeDefStats(defs, refs)
+	if c.ExportedOnly {
+		stats.MostReferenced = exportedDefRefCounts(stats.MostReferenced, defs)
+	}
+	if c.Top > 0 && len(stats.MostReferenced) > c.Top {
+		stats.MostReferenced = stats.MostReferenced[:c.Top]
+	}
+
+	if c.Format == "json" {
+		PrintJSON(stats, "  ")
+		return nil
+	}
+	stats.printTable()
+	return nil
+}
+
+// defStats holds the def usage statistics computed by
+// computeDefStats.
+type defStats struct {
+	NumDefs int
+	NumRefs int // not counting refs from defs' own definitions
+
+	// MostReferenced lists the referenced defs in descending order of
+	// ref count.
+	MostReferenced []*defRefCount
+
+	// UnusedExported lists the exported (non-local) defs that have no
+	// refs, sorted by def key.
+	UnusedExported []graph.DefKey
+
+	// Units lists the fan-in and fan-out of each source unit that
+	// contains defs or refs, in descending order of fan-in.
+	Units []*unitFan
+}
+
+type defRefCount struct {
+	graph.DefKey
+	Name string `json:",omitempty"`
+	Kind string `json:",omitempty"`
+	Refs int
+}
+
+type unitFan struct {
+	Repo     string `json:",omitempty"`
+	UnitType string
+	Unit     string
+
+	FanIn   int // number of other units that refer to this unit's defs
+	FanOut  int // number of other units whose defs this unit refers to
+	RefsIn  int // number of refs from other units to this unit's defs
+	RefsOut int // number of refs from this unit to other units' defs
+}
+
+// computeDefStats computes def usage statistics for defs and the refs
+// to them.
+func computeDefStats(defs []*graph.Def, refs []*graph.Ref) *defStats {
+	type unitKey struct{ repo, unitType, unit string }
+
+	counts := map[graph.DefKey]*defRefCount{}
+	for _, d := range defs {
+		k := statsDefKey(d.DefKey)
+		counts[k] = &defRefCount{DefKey: k, Name: d.Name, Kind: d.Kind}
+	}
+
+	units := map[unitKey]*unitFan{}
+	getUnit := func(k unitKey) *unitFan {
+		u := units[k]
+		if u == nil {
+			u = &unitFan{Repo: k.repo, UnitType: k.unitType, Unit: k.unit}
+			units[k] = u
+		}
+		return u
+	}
+	for _, d := range defs {
+		getUnit(unitKey{d.Repo, d.UnitType, d.Unit})
+	}
+
+	fanIn := map[unitKey]map[unitKey]struct{}{}
+	fanOut := map[unitKey]map[unitKey]struct{}{}
+	addEdge := func(m map[unitKey]map[unitKey]struct{}, from, to unitKey) {
+		if m[from] == nil {
+			m[from] = map[unitKey]struct{}{}
+		}
+		m[from][to] = struct{}{}
+	}
+
+	st := &defStats{NumDefs: len(defs)}
+	for _, r := range refs {
+		if r.Def {
+			continue
+		}
+		st.NumRefs++
+
+		dk := refDefKey(r)
+		c := counts[dk]
+		if c == nil {
+			c = &defRefCount{DefKey: dk}
+			counts[dk] = c
+		}
+		c.Refs++
+
+		from := unitKey{r.Repo, r.UnitType, r.Unit}
+		to := unitKey{dk.Repo, dk.UnitType, dk.Unit}
+		getUnit(from)
+		if from == to {
+			continue
+		}
+		getUnit(to).RefsIn++
+		units[from].RefsOut++
+		addEdge(fanIn, to, from)
+		addEdge(fanOut, from, to)
+	}
+
+	for _, c := range counts {
+		if c.Refs > 0 {
+			st.MostReferenced = append(st.MostReferenced, c)
+		}
+	}
+	sort.Sort(defRefCountsByRefs(st.MostReferenced))
+
+	for _, d := range defs {
+		if d.Exported && !d.Local && counts[statsDefKey(d.DefKey)].Refs == 0 {
+			st.UnusedExported = append(st.UnusedExported, statsDefKey(d.DefKey))
+		}
+	}
+	sort.Sort(defKeys(st.UnusedExported))
+
+	for k, u := range units {
+		u.FanIn, u.FanOut = len(fanIn[k]), len(fanOut[k])
+		st.Units = append(st.Units, u)
+	}
+	sort.Sort(unitFansByFanIn(st.Units))
+	return st
+}
+
+// exportedDefRefCounts returns the counts (in the same order) of the
+// defs that are exported defs in defs. Counts of refs to defs that
+// aren't in defs (e.g., defs in other repositories) are omitted,
+// because their visibility is unknown.
+func exportedDefRefCounts(counts []*defRefCount, defs []*graph.Def) []*defRefCount {
+	exported := map[graph.DefKey]struct{}{}
+	for _, d := range defs {
+		if d.Exported {
+			exported[statsDefKey(d.DefKey)] = struct{}{}
+		}
+	}
+	var exportedCounts []*defRefCount
+	for _, c := range counts {
+		if _, ok := exported[c.DefKey]; ok {
+			exportedCounts = append(exportedCounts, c)
+		}
+	}
+	return exportedCounts
+}
+
+// refDefKey returns the key of the def that r refers to, as
+// statsDefKey returns it for the def itself.
+func refDefKey(r *graph.Ref) graph.DefKey {
+	k := r.DefKey()
+	if k.Repo == "" {
+		// Refs to defs in the same repository often omit the def's
+		// repository.
+		k.Repo = r.Repo
+	}
+	return statsDefKey(k)
+}
+
+// statsDefKey returns k without its commit ID, so that a def and the
+// refs to it (which don't specify the def's commit) have the same
+// key.
+func statsDefKey(k graph.DefKey) graph.DefKey {
+	k.CommitID = ""
+	return k
+}
+
+func (st *defStats) printTable() {
+	fmt.Printf("%d defs, %d refs\n", st.NumDefs, st.NumRefs)
+
+	fmt.Println()
+	colorable.Println(colorable.Cyan("Most referenced defs"))
+	if len(st.MostReferenced) == 0 {
+		fmt.Println("  (none)")
+	}
+	for _, c := range st.MostReferenced {
+		fmt.Printf("  %6d  %s\n", c.Refs, statsDefLabel(c.DefKey))
+	}
+
+	fmt.Println()
+	colorable.Println(colorable.Cyan(fmt.Sprintf("Unused exported defs (%d)", len(st.UnusedExported))))
+	for _, k := range st.UnusedExported {
+		fmt.Printf("  %s\n", statsDefLabel(k))
+	}
+
+	fmt.Println()
+	colorable.Println(colorable.Cyan("Source units"))
+	fmt.Printf("  %6s %6s %8s %8s  %s\n", "FAN-IN", "FAN-OUT", "REFS-IN", "REFS-OUT", "UNIT")
+	for _, u := range st.Units {
+		label := u.Unit + " (" + u.UnitType + ")"
+		if u.Repo != "" {
+			label = u.Repo + " " + label
+		}
+		fmt.Printf("  %6d %6d %8d %8d  %s\n", u.FanIn, u.FanOut, u.RefsIn, u.RefsOut, label)
+	}
+}
+
+// statsDefLabel returns a short description of the def with key k.
+func statsDefLabel(k graph.DefKey) string {
+	s := k.Unit + " " + k.Path
+	if k.Repo != "" {
+		s = k.Repo + " " + s
+	}
+	return s
+}
+
+type defRefCountsByRefs []*defRefCount
+
+func (v defRefCountsByRefs) Len() int      { return len(v) }
+func (v defRefCountsByRefs) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v defRefCountsByRefs) Less(i, j int) bool {
+	if v[i].Refs != v[j].Refs {
+		return v[i].Refs > v[j].Refs
+	}
+	return defKeyLess(v[i].DefKey, v[j].DefKey)
+}
+
+type defKeys []graph.DefKey
+
+func (v defKeys) Len() int           { return len(v) }
+func (v defKeys) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v defKeys) Less(i, j int) bool { return defKeyLess(v[i], v[j]) }
+
+func defKeyLess(a, b graph.DefKey) bool {
+	if a.Repo != b.Repo {
+		return a.Repo < b.Repo
+	}
+	if a.UnitType != b.UnitType {
+		return a.UnitType < b.UnitType
+	}
+	if a.Unit != b.Unit {
+		return a.Unit < b.Unit
+	}
+	return a.Path < b.Path
+}
+
+type unitFansByFanIn []*unitFan
+
+func (v unitFansByFanIn) Len() int      { return len(v) }
+func (v unitFansByFanIn) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v unitFansByFanIn) Less(i, j int) bool {
+	if v[i].FanIn != v[j].FanIn {
+		return v[i].FanIn > v[j].FanIn
+	}
+	if v[i].FanOut != v[j].FanOut {
+		return v[i].FanOut > v[j].FanOut
+	}
+	return defKeyLess(graph.DefKey{Repo: v[i].Repo, UnitType: v[i].UnitType, Unit: v[i].Unit}, graph.DefKey{Repo: v[j].Repo, UnitType: v[j].UnitType, Unit: v[j].Unit})
+}
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestComputeDefStats(t *testing.T) {
+	def := func(unit, path string, exported bool) *graph.Def {
+		return &graph.Def{DefKey: graph.DefKey{UnitType: "t", Unit: unit, Path: path, CommitID: "c"}, Exported: exported}
+	}
+	ref := func(unit, defUnit, defPath string) *graph.Ref {
+		return &graph.Ref{UnitType: "t", Unit: unit, DefUnitType: "t", DefUnit: defUnit, DefPath: defPath, CommitID: "c"}
+	}
+	defs := []*graph.Def{
+		def("a", "A", true),
+		def("a", "a", false),
+		def("b", "B", true),
+		def("b", "Unused", true),
+	}
+	refs := []*graph.Ref{
+		{UnitType: "t", Unit: "a", DefUnitType: "t", DefUnit: "a", DefPath: "A", Def: true},
+		ref("a", "a", "a"),
+		ref("a", "b", "B"),
+		ref("c", "b", "B"),
+		ref("c", "a", "A"),
+		ref("c", "ext", "X"),
+	}
+
+	st := computeDefStats(defs, refs)
+	if st.NumDefs != 4 || st.NumRefs != 5 {
+		t.Errorf("got %d defs, %d refs, want 4 defs, 5 refs", st.NumDefs, st.NumRefs)
+	}
+
+	var mostRefd []string
+	for _, c := range st.MostReferenced {
+		mostRefd = append(mostRefd, c.Unit+"/"+c.Path)
+	}
+	if want := []string{"b/B", "a/A", "a/a", "ext/X"}; !reflect.DeepEqual(mostRefd, want) {
+		t.Errorf("got most referenced %v, want %v", mostRefd, want)
+	}
+
+	if want := []graph.DefKey{{UnitType: "t", Unit: "b", Path: "Unused"}}; !reflect.DeepEqual(st.UnusedExported, want) {
+		t.Errorf("got unused exported %v, want %v", st.UnusedExported, want)
+	}
+
+	wantUnits := []*unitFan{
+		{UnitType: "t", Unit: "a", FanIn: 1, FanOut: 1, RefsIn: 1, RefsOut: 1},
+		{UnitType: "t", Unit: "b", FanIn: 2, RefsIn: 2},
+		{UnitType: "t", Unit: "c", FanOut: 3, RefsOut: 3},
+		{UnitType: "t", Unit: "ext", FanIn: 1, RefsIn: 1},
+	}
+	gotUnits := map[string]unitFan{}
+	for _, u := range st.Units {
+		gotUnits[u.Unit] = *u
+	}
+	for _, want := range wantUnits {
+		if got := gotUnits[want.Unit]; got != *want {
+			t.Errorf("unit %s: got %+v, want %+v", want.Unit, got, *want)
+		}
+	}
+	if st.Units[0].Unit != "b" {
+		t.Errorf("got unit %s first, want the unit with the highest fan-in (b)", st.Units[0].Unit)
+	}
+
+	var exportedRefd []string
+	for _, c := range exportedDefRefCounts(st.MostReferenced, defs) {
+		exportedRefd = append(exportedRefd, c.Unit+"/"+c.Path)
+	}
+	if want := []string{"b/B", "a/A"}; !reflect.DeepEqual(exportedRefd, want) {
+		t.Errorf("got most referenced exported %v, want %v", exportedRefd, want)
+	}
+}
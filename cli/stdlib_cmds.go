@@ -0,0 +1,241 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/alexsaveliev/go-colorable-wrapper"
+
+	"sourcegraph.com/sourcegraph/go-flags"
+
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/stdlib"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func init() {
+	cliInit = append(cliInit, func(cli *flags.Command) {
+		c, err := cli.AddCommand("stdlib",
+			"manage standard library def manifests",
+			`Manage the standard library def manifests that refs to standard library defs (e.g., in the Go standard library, the JDK, or the Python standard library) are resolved against. Such refs count as valid in "srclib coverage", and "srclib store import" resolves them to the standard library's repository.
+
+Manifests are *.json files in the "stdlib" subdirectory of an installed toolchain or of a SRCLIBPATH entry.`,
+			&stdlibCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = c.AddCommand("list",
+			"list installed manifests",
+			"List the installed standard library def manifests.",
+			&stdlibListCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = c.AddCommand("gen",
+			"generate a manifest from build data",
+			`Generate a standard library def manifest from the build data of the current repository (which should be the standard library's repository), listing its exported defs. To install the manifest, write it to the "stdlib" subdirectory of a toolchain or of a SRCLIBPATH entry.`,
+			&stdlibGenCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = c.AddCommand("lookup",
+			"look up a def in the installed manifests",
+			"Look up a def in the installed standard library def manifests and print its repository and canonical documentation URL.",
+			&stdlibLookupCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	})
+}
+
+type StdlibCmd struct{}
+
+var stdlibCmd StdlibCmd
+
+func (c *StdlibCmd) Execute(args []string) error { return nil }
+
+type StdlibListCmd struct{}
+
+var stdlibListCmd StdlibListCmd
+
+func (c *StdlibListCmd) Execute(args []string) error {
+	stdlibs, err := stdlib.LoadInstalled()
+	if err != nil {
+		return err
+	}
+	if len(stdlibs.Manifests) == 0 {
+		dirs, err := stdlib.Dirs()
+		if err != nil {
+			return err
+		}
+		log.Printf("No standard library manifests found (looked in %v).", dirs)
+		return nil
+	}
+
+	fmtStr := "%-12s  %-30s  %-10s  %8s  %s\n"
+	colorable.Printf(fmtStr, "LANGUAGE", "REPO", "VERSION", "DEFS", "FILE")
+	for _, m := range stdlibs.Manifests {
+		colorable.Printf(fmtStr, m.Language, m.Repo, m.Version, fmt.Sprint(m.NumDefs()), m.File)
+	}
+	return nil
+}
+
+type StdlibGenCmd struct {
+	Language string `long:"language" description:"language of the standard library (e.g., Go)" required:"yes"`
+	Repo     string `long:"repo" description:"URI of the standard library's repository (default: the current repository's URI)"`
+	Version  string `long:"version" description:"version of the standard library (e.g., go1.5)"`
+	DocURL   string `long:"doc-url" description:"template for defs' documentation URLs, with {unit}, {path}, and {dotpath} placeholders"`
+	Output   string `short:"o" long:"output" description:"write the manifest to this file (default: stdout)" value-name:"FILE"`
+}
+
+var stdlibGenCmd StdlibGenCmd
+
+func (c *StdlibGenCmd) Execute(args []string) error {
+	repo, err := OpenLocalRepo()
+	if err != nil {
+		return err
+	}
+	repoURI := c.Repo
+	if repoURI == "" {
+		if repo.CloneURL == "" {
+			return fmt.Errorf("can't determine the repository URI (no clone URL); use --repo")
+		}
+		repoURI = graph.MakeURI(repo.CloneURL)
+	}
+
+	defs, err := readBuildDataDefs(repo.CommitID)
+	if err != nil {
+		return err
+	}
+	m := stdlib.Generate(c.Language, repoURI, defs)
+	m.Version = c.Version
+	m.DocURL = c.DocURL
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if c.Output == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := ioutil.WriteFile(c.Output, data, 0644); err != nil {
+		return err
+	}
+	log.Printf("Wrote manifest of %d defs in %d source units to %s.", m.NumDefs(), len(m.Units), c.Output)
+	return nil
+}
+
+// readBuildDataDefs reads the defs in the graph build data of all
+// source units at the given commit of the current repository.
+func readBuildDataDefs(commitID string) ([]*graph.Def, error) {
+	var defs []*graph.Def
+	err := readBuildDataGraphs(commitID, func(u *unit.SourceUnit, o *graph.Output) {
+		if o == nil {
+			log.Printf("Warning: no build data for unit %s %s.", u.Type, u.Name)
+			return
+		}
+		defs = append(defs, o.Defs...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return defs, nil
+}
+
+// readBuildDataGraphs reads the graph build data of each source unit
+// at the given commit of the current repository and calls fn with it.
+// If a unit has no graph data (or it is empty or corrupt), fn is
+// called with a nil graph.Output.
+func readBuildDataGraphs(commitID string, fn func(u *unit.SourceUnit, o *graph.Output)) error {
+	bdfs, err := GetBuildDataFS(commitID)
+	if err != nil {
+		return err
+	}
+	treeConfig, err := config.ReadCached(bdfs)
+	if err != nil {
+		return fmt.Errorf("error calling config.ReadCached: %s", err)
+	}
+	mf, err := plan.CreateMakefile(".", nil, "", treeConfig)
+	if err != nil {
+		return fmt.Errorf("error calling plan.Makefile: %s", err)
+	}
+
+	readGraphData := func(graphFile string, u *unit.SourceUnit) error {
+		var o graph.Output
+		if err := readBuildDataJSON(bdfs, graphFile, &o); err != nil {
+			if err == errEmptyJSONFile || os.IsNotExist(err) {
+				fn(u, nil)
+				return nil
+			}
+			if isCorruptJSONFile(err) {
+				log.Printf("Warning: skipping unit %s %s: %s.", u.Type, u.Name, err)
+				fn(u, nil)
+				return nil
+			}
+			return fmt.Errorf("error reading JSON file %s for unit %s %s: %s", graphFile, u.Type, u.Name, err)
+		}
+		fn(u, &o)
+		return nil
+	}
+	for _, rule_ := range mf.Rules {
+		switch rule := rule_.(type) {
+		case *grapher.GraphUnitRule:
+			if err := readGraphData(rule.Target(), rule.Unit); err != nil {
+				return err
+			}
+		case *grapher.GraphMultiUnitsRule:
+			for target, u := range rule.Targets() {
+				if err := readGraphData(target, u); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+type StdlibLookupCmd struct {
+	UnitType string `long:"unit-type" description:"def's source unit type (e.g., GoPackage)" required:"yes"`
+	Unit     string `long:"unit" description:"def's source unit name (e.g., net/http)" required:"yes"`
+	Args     struct {
+		Path string `name:"PATH" description:"def path (e.g., Client/Do)"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var stdlibLookupCmd StdlibLookupCmd
+
+func (c *StdlibLookupCmd) Execute(args []string) error {
+	stdlibs, err := stdlib.LoadInstalled()
+	if err != nil {
+		return err
+	}
+	m := stdlibs.Lookup(&graph.Ref{DefUnitType: c.UnitType, DefUnit: c.Unit, DefPath: c.Args.Path})
+	if m == nil {
+		return fmt.Errorf("no installed standard library manifest lists def %s %s %s", c.UnitType, c.Unit, c.Args.Path)
+	}
+	colorable.Println("Language:", m.Language)
+	colorable.Println("Repo:    ", m.Repo)
+	if m.Version != "" {
+		colorable.Println("Version: ", m.Version)
+	}
+	if url := m.DefDocURL(c.Unit, c.Args.Path); url != "" {
+		colorable.Println("Doc URL: ", url)
+	}
+	colorable.Println("Manifest:", m.File)
+	return nil
+}
@@ -24,11 +24,15 @@ import (
 
 	"sourcegraph.com/sourcegraph/go-flags"
 	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/authorship"
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
 	"sourcegraph.com/sourcegraph/srclib/config"
 	"sourcegraph.com/sourcegraph/srclib/graph"
 	"sourcegraph.com/sourcegraph/srclib/grapher"
 	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/stdlib"
 	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
 	"sourcegraph.com/sourcegraph/srclib/unit"
 )
 
@@ -36,23 +40,15 @@ func init() {
 	cliInit = append(cliInit, func(cli *flags.Command) {
 		storeC, err := cli.AddCommand("store",
 			"graph store commands",
-			"",
+			`The store commands import graph data into a store and query it.
+
+If an encryption key is configured (with --encryption-key-file or $SRCLIB_STORE_KEY_FILE), the store's files are encrypted at rest with AES-256-GCM: they are encrypted when written and decrypted (in memory, a whole file at a time) when read, so that source snippets and docs in a store on a shared server aren't stored unencrypted. All commands that use the store (including "srclib api serve", with --store-encryption-key-file) must be given the same key. File names and sizes aren't encrypted, and an existing unencrypted store can't be read with a key (reimport its data instead).`,
 			&storeCmd,
 		)
 		if err != nil {
 			log.Fatal(err)
 		}
-		lrepo, _ := OpenLocalRepo()
-		if lrepo != nil && lrepo.RootDir != "" {
-			absDir, err := os.Getwd()
-			if err != nil {
-				log.Fatal(err)
-			}
-			relDir, err := filepath.Rel(absDir, lrepo.RootDir)
-			if err == nil {
-				SetOptionDefaultValue(storeC.Group, "root", filepath.Join(relDir, store.SrclibStoreDir))
-			}
-		}
+		setLocalStoreRootDefault(storeC.Group)
 
 		InitStoreCmds(storeC)
 	})
@@ -61,7 +57,11 @@ func init() {
 func InitStoreCmds(c *flags.Command) {
 	importC, err := c.AddCommand("import",
 		"import data",
-		`The import command imports data (from .srclib-cache) into the store.`,
+		`The import command imports data (from .srclib-cache) into the store.
+
+Source units are imported in batches (of --batch-size units). After each batch, the imported units are recorded in a checkpoint file in the commit's build data directory, so that if the import is interrupted, it can be resumed with --resume (which skips the units that were already imported) instead of started over. Only a few source units' data is held in memory at a time, so memory use doesn't grow with the size of the repository. To limit the import's load on the store, use --batch-delay to pause between batches.
+
+With --workspace FILE, the command (with its other options) is run in each repository listed in the workspace file. To import all of the repositories into one store, use a MultiRepoStore with an absolute --root.`,
 		&storeImportCmd,
 	)
 	if err != nil {
@@ -132,6 +132,35 @@ func InitStoreCmds(c *flags.Command) {
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	_, err = c.AddCommand("query",
+		"list defs or refs that match a filter expression",
+		storeQueryLongDescription(),
+		&storeQueryCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = c.AddCommand("search",
+		"search for defs by name, ranked by relevance",
+		`The search command lists the defs whose names match (or start with) the query, ranked by a score that combines how well the name matches, whether the def is exported, how many refs there are to it, and how deeply nested its path is. The columns are the score, the number of refs, the def kind, the source unit, and the def path.`,
+		&storeSearchCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = c.AddCommand("downsample",
+		"replace commits' refs with ref counts",
+		`The downsample command replaces the refs of commits in the store with the number of refs to each def, which reduces the size of their data by about an order of magnitude. Defs can still be listed, looked up, and searched (and are still ranked by their number of refs), but refs can't be listed, so commands that find the def at a position (such as "srclib api describe") don't work at those commits.
+
+It is intended for old commits (--older-than) that are rarely queried. To import a commit's data downsampled (e.g., for a preview index), use "srclib store import --downsample".`,
+		&storeDownsampleCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
 }
 
 // OpenStore is called by all of the store subcommands to open the
@@ -142,8 +171,15 @@ type StoreCmd struct {
 	Type   string `short:"t" long:"type" description:"the (multi-)repo store type to use (RepoStore, MultiRepoStore, etc.)" default:"RepoStore"`
 	Root   string `short:"r" long:"root" description:"the root of the store (repo clone dir for RepoStore, global path for MultiRepoStore, etc.)" default:".srclib-store"`
 	Config string `long:"config" description:"(rarely used) JSON-encoded config for extra config, specific to each store type"`
+
+	EncryptionKeyFile string `long:"encryption-key-file" description:"encrypt the store's files at rest with the hex-encoded 32-byte key in this file (overrides $SRCLIB_STORE_KEY_FILE)" value-name:"FILE"`
 }
 
+// storeKeyFile is the file containing the key that stores' files are
+// encrypted with when StoreCmd.EncryptionKeyFile isn't set. It is
+// initialized from the SRCLIB_STORE_KEY_FILE environment variable.
+var storeKeyFile = os.Getenv("SRCLIB_STORE_KEY_FILE")
+
 var storeCmd StoreCmd
 
 func (c *StoreCmd) Execute(args []string) error { return nil }
@@ -160,6 +196,16 @@ func (c *StoreCmd) store() (interface{}, error) {
 		fs.CreateParentDirs(true)
 	}
 
+	if keyFile := firstNonEmpty(c.EncryptionKeyFile, storeKeyFile); keyFile != "" {
+		key, err := buildstore.ReadEncryptionKey(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		if fs, err = buildstore.Encrypted(fs, key); err != nil {
+			return nil, err
+		}
+	}
+
 	switch c.Type {
 	case "RepoStore":
 		return store.NewFSRepoStore(rwvfs.Walkable(fs)), nil
@@ -172,6 +218,7 @@ func (c *StoreCmd) store() (interface{}, error) {
 
 type StoreImportCmd struct {
 	ImportOpt
+	WorkspaceOpt
 
 	Quiet bool `short:"q" long:"quiet" description:"silence all output"`
 
@@ -184,6 +231,10 @@ type StoreImportCmd struct {
 var storeImportCmd StoreImportCmd
 
 func (c *StoreImportCmd) Execute(args []string) error {
+	if c.Workspace != "" {
+		return runInWorkspace(c.Workspace)
+	}
+
 	start := time.Now()
 
 	s, err := OpenStore()
@@ -203,7 +254,11 @@ func (c *StoreImportCmd) Execute(args []string) error {
 		log.Printf("# Importing build data for %s (commit %s)", c.Repo, c.CommitID)
 	}
 
-	if err := Import(bdfs, s, c.ImportOpt); err != nil {
+	opt := c.ImportOpt
+	if root, err := filepath.Abs(storeCmd.Root); err == nil {
+		opt.Store = storeCmd.Type + ":" + root
+	}
+	if err := Import(bdfs, s, opt); err != nil {
 		return err
 	}
 	if !c.Quiet {
@@ -221,11 +276,97 @@ type ImportOpt struct {
 	UnitType string `long:"unit-type" description:"only import source units with this type"`
 	CommitID string `long:"commit" description:"commit ID of commit whose data to import"`
 
+	BatchSize  int           `long:"batch-size" description:"number of source units to import in each batch, after which progress is checkpointed (0 for all at once)" default:"100"`
+	BatchDelay time.Duration `long:"batch-delay" description:"pause for this long between batches (e.g., 500ms)" value-name:"DURATION"`
+	Resume     bool          `long:"resume" description:"resume an interrupted import from its last checkpoint, skipping the source units that were already imported"`
+
+	Jobs int `short:"j" long:"jobs" description:"import up to N source units, and build up to N indexes, concurrently; lower values use less memory (default: 10 source units and GOMAXPROCS indexes)" value-name:"N"`
+
+	Downsample bool `long:"downsample" description:"import only defs with their ref counts, not refs (e.g., for preview indexes); see 'srclib store downsample'"`
+
+	NormalizeDefData bool `long:"normalize-def-data" description:"add the standard fields (e.g., PackageName) that the toolchains' Def.Data schemas declare to the Data of imported defs"`
+
+	RepoTags     []string `long:"repo-tag" description:"add this repository-level tag (e.g., a topic) to each imported source unit, in addition to the Srcfile's Tags (repeatable)" value-name:"TAG"`
+	RepoMetadata []string `long:"repo-meta" description:"set this repository-level metadata (e.g., team=checkout) on each imported source unit, replacing the Srcfile's value (repeatable)" value-name:"KEY=VALUE"`
+
+	// Store identifies the store being imported into, so that an
+	// import's checkpoint isn't resumed by an import into another
+	// store.
+	Store string
+
 	Verbose bool
 }
 
+// importParallelism is the number of source units that Import imports
+// concurrently, unless ImportOpt's Jobs is set.
+const importParallelism = 10
+
+// importTask is a source unit whose graph data (in the file Target)
+// Import imports.
+// checkDefData checks the Data of the defs of sourceUnit against the
+// toolchains' schemas in reg (see graph.DefDataRegistry), normalizing
+// it if normalize is true, and warns about the defs whose Data doesn't
+// match.
+func checkDefData(reg *graph.DefDataRegistry, sourceUnit *unit.SourceUnit, defs []*graph.Def, normalize bool) {
+	var (
+		n        int
+		firstErr error
+		first    *graph.Def
+	)
+	for _, def := range defs {
+		var err error
+		if normalize {
+			err = reg.Normalize(sourceUnit.Type, def)
+		} else {
+			err = reg.Check(sourceUnit.Type, def)
+		}
+		if err != nil {
+			if n == 0 {
+				first, firstErr = def, err
+			}
+			n++
+		}
+	}
+	if n > 0 {
+		log.Printf("Warning: %d defs in unit %s %s have Data that doesn't match the toolchain's schema (e.g., def %s: %s).", n, sourceUnit.Type, sourceUnit.Name, first.Path, firstErr)
+	}
+}
+
+// readStitchedRefs reads the refs emitted by stitchers (see
+// grapher.StitchedRefsFilename) from the build data filesystem and
+// groups them by the source unit they are in. If there are none, it
+// returns nil and no error.
+func readStitchedRefs(bdfs vfs.FileSystem) (map[unit.ID2][]*graph.Ref, error) {
+	var refs []*graph.Ref
+	if err := readBuildDataJSON(bdfs, grapher.StitchedRefsFilename, &refs); err != nil {
+		if os.IsNotExist(err) || err == errEmptyJSONFile {
+			return nil, nil
+		}
+		if isCorruptJSONFile(err) {
+			log.Printf("Warning: ignoring stitched refs: %s.", err)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading stitched refs: %s", err)
+	}
+	byUnit := map[unit.ID2][]*graph.Ref{}
+	for _, ref := range refs {
+		u := unit.ID2{Type: ref.UnitType, Name: ref.Unit}
+		byUnit[u] = append(byUnit[u], ref)
+	}
+	return byUnit, nil
+}
+
+type importTask struct {
+	Target string
+	Unit   *unit.SourceUnit
+}
+
 // Import imports build data into a RepoStore or MultiRepoStore.
 func Import(buildDataFS vfs.FileSystem, stor interface{}, opt ImportOpt) error {
+	if opt.Jobs > 0 {
+		stor = store.WithIndexBuildJobs(stor, opt.Jobs)
+	}
+
 	// Traverse the build data directory for this repo and commit to
 	// create the makefile that lists the targets (which are the data
 	// files we will import).
@@ -238,6 +379,28 @@ func Import(buildDataFS vfs.FileSystem, stor interface{}, opt ImportOpt) error {
 		return fmt.Errorf("error calling plan.Makefile: %s", err)
 	}
 
+	// Refs to standard library defs are resolved to the standard
+	// library's repository (see package stdlib).
+	stdlibs, err := stdlib.LoadInstalled()
+	if err != nil {
+		return err
+	}
+
+	// Def.Data is checked against (and, if opt.NormalizeDefData,
+	// normalized with) the schemas that the toolchains declare (see
+	// graph.DefDataSchema).
+	defData, err := toolchain.DefDataRegistry()
+	if err != nil {
+		return err
+	}
+
+	// Refs emitted by stitchers (see grapher.Stitch) are imported
+	// along with the graph data of the source units they are in.
+	stitched, err := readStitchedRefs(buildDataFS)
+	if err != nil {
+		return err
+	}
+
 	// hasIndexableData is set if at least one source unit's graph data is
 	// successfully imported to the graph store.
 	//
@@ -253,19 +416,47 @@ func Import(buildDataFS vfs.FileSystem, stor interface{}, opt ImportOpt) error {
 		hasIndexableData bool
 	)
 
+	// refCounts is set if the graph data is downsampled (see
+	// ImportOpt.Downsample).
+	var refCounts graph.RefCounts
+
 	importGraphData := func(graphFile string, sourceUnit *unit.SourceUnit) error {
 		var data graph.Output
-		if err := readJSONFileFS(buildDataFS, graphFile, &data); err != nil {
+		if err := readBuildDataJSON(buildDataFS, graphFile, &data); err != nil {
 			if err == errEmptyJSONFile {
 				log.Printf("Warning: the JSON file is empty for unit %s %s.", sourceUnit.Type, sourceUnit.Name)
 				return nil
 			}
+			if isCorruptJSONFile(err) {
+				log.Printf("Warning: skipping unit %s %s: %s.", sourceUnit.Type, sourceUnit.Name, err)
+				return nil
+			}
 			if os.IsNotExist(err) {
 				log.Printf("Warning: no build data for unit %s %s.", sourceUnit.Type, sourceUnit.Name)
 				return nil
 			}
 			return fmt.Errorf("error reading JSON file %s for unit %s %s: %s", graphFile, sourceUnit.Type, sourceUnit.Name, err)
 		}
+		if refs := stitched[sourceUnit.ID2()]; len(refs) > 0 {
+			if GlobalOpt.Verbose {
+				log.Printf("# Adding %d stitched refs to unit %s %s", len(refs), sourceUnit.Type, sourceUnit.Name)
+			}
+			data.Refs = append(data.Refs, refs...)
+		}
+
+		// Store identical refs once, and share the repeated strings of
+		// the unit's defs and refs (file paths, unit names, and def
+		// paths), which dominate the memory used by units with many
+		// refs to a few defs.
+		if n := len(data.Refs); n > 0 {
+			data.Refs = graph.DedupRefs(data.Refs)
+			if dups := n - len(data.Refs); dups > 0 && GlobalOpt.Verbose {
+				log.Printf("# Removed %d duplicate refs for unit %s %s", dups, sourceUnit.Type, sourceUnit.Name)
+			}
+		}
+		var interner graph.Interner
+		interner.Output(&data)
+
 		if opt.DryRun || GlobalOpt.Verbose {
 			log.Printf("# Importing graph data (%d defs, %d refs, %d docs, %d anns) for unit %s %s", len(data.Defs), len(data.Refs), len(data.Docs), len(data.Anns), sourceUnit.Type, sourceUnit.Name)
 			if opt.DryRun {
@@ -284,6 +475,24 @@ func Import(buildDataFS vfs.FileSystem, stor interface{}, opt ImportOpt) error {
 			}
 		}
 
+		// Transfer authorship data (if it was computed) to [def].Authors.
+		var authors authorship.Output
+		if err := readBuildDataJSON(buildDataFS, plan.SourceUnitDataFilename(&authors, sourceUnit), &authors); err == nil {
+			authorship.Apply(data.Defs, &authors)
+		} else if isCorruptJSONFile(err) {
+			log.Printf("Warning: ignoring authorship data for unit %s %s: %s.", sourceUnit.Type, sourceUnit.Name, err)
+		} else if !os.IsNotExist(err) && err != errEmptyJSONFile {
+			return fmt.Errorf("error reading authorship data for unit %s %s: %s", sourceUnit.Type, sourceUnit.Name, err)
+		}
+
+		if n := stdlibs.ResolveRefs(data.Refs, opt.Repo, treeConfig.SourceUnits); n > 0 && GlobalOpt.Verbose {
+			log.Printf("# Resolved %d refs to standard library defs for unit %s %s", n, sourceUnit.Type, sourceUnit.Name)
+		}
+		checkDefData(defData, sourceUnit, data.Defs, opt.NormalizeDefData)
+		if refCounts != nil {
+			refCounts.Downsample(&data)
+		}
+
 		switch imp := stor.(type) {
 		case store.RepoImporter:
 			if err := imp.Import(opt.CommitID, sourceUnit, data); err != nil {
@@ -304,40 +513,144 @@ func Import(buildDataFS vfs.FileSystem, stor interface{}, opt ImportOpt) error {
 		return nil
 	}
 
-	par := parallel.NewRun(10)
+	var tasks []importTask
 	for _, rule_ := range mf.Rules {
-		rule := rule_
-		switch rule := rule.(type) {
+		switch rule := rule_.(type) {
 		case *grapher.GraphUnitRule:
-			if (opt.Unit != "" && rule.Unit.Name != opt.Unit) || (opt.UnitType != "" && rule.Unit.Type != opt.UnitType) {
+			tasks = append(tasks, importTask{rule.Target(), rule.Unit})
+		case *grapher.GraphMultiUnitsRule:
+			targets := rule.Targets()
+			names := make([]string, 0, len(targets))
+			for target := range targets {
+				names = append(names, target)
+			}
+			sort.Strings(names)
+			for _, target := range names {
+				tasks = append(tasks, importTask{target, targets[target]})
+			}
+		}
+	}
+	filtered := tasks[:0]
+	for _, t := range tasks {
+		if (opt.Unit != "" && t.Unit.Name != opt.Unit) || (opt.UnitType != "" && t.Unit.Type != opt.UnitType) {
+			continue
+		}
+		filtered = append(filtered, t)
+	}
+	tasks = filtered
+
+	// The repository-level tags and metadata given on the command line
+	// are stored with each source unit, like the Srcfile's (which were
+	// added to the units when they were scanned).
+	repoMetadata, err := config.ParseMetadata(opt.RepoMetadata)
+	if err != nil {
+		return err
+	}
+	if len(opt.RepoTags) > 0 || len(repoMetadata) > 0 {
+		override := &config.UnitOverride{Tags: opt.RepoTags, Metadata: repoMetadata}
+		for _, t := range tasks {
+			override.Apply(t.Unit)
+		}
+	}
+
+	if opt.Downsample {
+		// Refs in any source unit may refer to a unit's defs, so
+		// count them all before importing any unit.
+		refCounts = graph.RefCounts{}
+		for _, t := range tasks {
+			var data graph.Output
+			if err := readBuildDataJSON(buildDataFS, t.Target, &data); err != nil {
+				// importGraphData reports the error (or skips the
+				// unit).
 				continue
 			}
+			refCounts.Add(data.Refs)
+			refCounts.Add(stitched[t.Unit.ID2()])
+		}
+	}
+
+	// Checkpoints are written to the build data directory (if it's
+	// writable).
+	checkpointFS, _ := buildDataFS.(rwvfs.FileSystem)
+	if opt.DryRun {
+		checkpointFS = nil
+	}
+	checkpoint := newImportCheckpoint(opt)
+	if opt.Resume {
+		if checkpointFS == nil {
+			return errors.New("can't resume the import because its build data directory isn't writable (so it has no checkpoint)")
+		}
+		c, err := readImportCheckpoint(checkpointFS)
+		if err != nil {
+			return err
+		}
+		switch {
+		case c == nil:
+			log.Printf("# No import checkpoint found; importing all source units.")
+		case !c.matches(opt):
+			return fmt.Errorf("the import checkpoint is for a different import (store %q, repo %q, commit %q, unit %q, unit type %q); rerun the import without --resume to start over", c.Store, c.Repo, c.CommitID, c.Unit, c.UnitType)
+		default:
+			checkpoint = c
+			done := c.done()
+			remaining := tasks[:0]
+			for _, t := range tasks {
+				if _, imported := done[t.Unit.ID2()]; !imported {
+					remaining = append(remaining, t)
+				}
+			}
+			log.Printf("# Resuming import: skipping %d source units imported before the checkpoint, importing %d.", len(tasks)-len(remaining), len(remaining))
+			tasks = remaining
+		}
+	}
+	hasIndexableData = checkpoint.HasData
+
+	jobs := importParallelism
+	if opt.Jobs > 0 {
+		jobs = opt.Jobs
+	}
+
+	batchSize := opt.BatchSize
+	if batchSize <= 0 {
+		batchSize = len(tasks)
+	}
+	for start := 0; start < len(tasks); start += batchSize {
+		if start > 0 && opt.BatchDelay > 0 {
+			time.Sleep(opt.BatchDelay)
+		}
+		end := start + batchSize
+		if end > len(tasks) {
+			end = len(tasks)
+		}
+		batch := tasks[start:end]
+
+		par := parallel.NewRun(jobs)
+		for _, t_ := range batch {
+			t := t_
 			par.Acquire()
 			go func() {
 				defer par.Release()
-				if err := importGraphData(rule.Target(), rule.Unit); err != nil {
+				if err := importGraphData(t.Target, t.Unit); err != nil {
 					par.Error(err)
 				}
 			}()
-		case *grapher.GraphMultiUnitsRule:
-			for target_, sourceUnit_ := range rule.Targets() {
-				target, sourceUnit := target_, sourceUnit_
-				if (opt.Unit != "" && sourceUnit.Name != opt.Unit) || (opt.UnitType != "" && sourceUnit.Type != opt.UnitType) {
-					continue
-				}
-				par.Acquire()
-				go func() {
-					defer par.Release()
-					if err := importGraphData(target, sourceUnit); err != nil {
-						par.Error(err)
-					}
-				}()
+		}
+		if err := par.Wait(); err != nil {
+			return err
+		}
+
+		if checkpointFS != nil {
+			for _, t := range batch {
+				checkpoint.Units = append(checkpoint.Units, t.Unit.ID2())
+			}
+			checkpoint.HasData = hasIndexableData
+			if err := writeImportCheckpoint(checkpointFS, checkpoint); err != nil {
+				return fmt.Errorf("writing import checkpoint: %s", err)
+			}
+			if GlobalOpt.Verbose {
+				log.Printf("# Imported %d of %d source units (checkpointed)", end, len(tasks))
 			}
 		}
 	}
-	if err := par.Wait(); err != nil {
-		return err
-	}
 
 	if hasIndexableData && !opt.NoIndex {
 		if GlobalOpt.Verbose {
@@ -366,6 +679,12 @@ func Import(buildDataFS vfs.FileSystem, stor interface{}, opt ImportOpt) error {
 		}
 	}
 
+	// The import is complete, so there's nothing to resume.
+	if checkpointFS != nil {
+		if err := removeImportCheckpoint(checkpointFS); err != nil {
+			return fmt.Errorf("removing import checkpoint: %s", err)
+		}
+	}
 	return nil
 }
 
@@ -888,6 +1207,12 @@ type StoreUnitsCmd struct {
 	RepoCommitIDs string `long:"repo-commits" description:"comma-separated list of repo@commitID specifiers"`
 
 	File string `long:"file" description:"filter by units whose Files list contains this file"`
+
+	Owner string   `long:"owner" description:"filter by units owned by this owner (e.g., @org/team)"`
+	Tag   string   `long:"tag" description:"filter by units with this tag"`
+	Meta  []string `long:"meta" description:"filter by units with this metadata, e.g. the repository-level team=checkout (repeatable)" value-name:"KEY=VALUE"`
+
+	TestCodeOpt
 }
 
 func (c *StoreUnitsCmd) filters() []store.UnitFilter {
@@ -910,11 +1235,104 @@ func (c *StoreUnitsCmd) filters() []store.UnitFilter {
 	if c.File != "" {
 		fs = append(fs, store.ByFiles(false, path.Clean(c.File)))
 	}
+	if c.Owner != "" {
+		fs = append(fs, store.ByUnitOwners(c.Owner))
+	}
+	if c.Tag != "" {
+		fs = append(fs, store.ByUnitTags(c.Tag))
+	}
+	meta, err := unitMetadataFilters(c.Meta)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fs = append(fs, meta...)
+	if f := c.testCodeFilter(); f != nil {
+		fs = append(fs, f)
+	}
 	return fs
 }
 
+// unitMetadataFilters returns the filters that select the source
+// units with the metadata given as "KEY=VALUE" pairs.
+func unitMetadataFilters(pairs []string) ([]store.UnitFilter, error) {
+	meta, err := config.ParseMetadata(pairs)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fs := make([]store.UnitFilter, len(keys))
+	for i, k := range keys {
+		fs[i] = store.ByUnitMetadata(k, meta[k])
+	}
+	return fs, nil
+}
+
 var storeUnitsCmd StoreUnitsCmd
 
+// unitAttrsFilter returns a filter that selects the defs and refs in
+// the source units in s that are owned by owner (if set), have tag (if
+// set), and have the metadata given as "KEY=VALUE" pairs, or nil if
+// none of these are set.
+func unitAttrsFilter(s interface{}, owner, tag string, meta []string) (interface {
+	store.DefFilter
+	store.RefFilter
+}, error) {
+	var (
+		fs    []store.UnitFilter
+		descs []string
+	)
+	if owner != "" {
+		fs = append(fs, store.ByUnitOwners(owner))
+		descs = append(descs, fmt.Sprintf("are owned by %q", owner))
+	}
+	if tag != "" {
+		fs = append(fs, store.ByUnitTags(tag))
+		descs = append(descs, fmt.Sprintf("have the tag %q", tag))
+	}
+	if len(meta) > 0 {
+		mfs, err := unitMetadataFilters(meta)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, mfs...)
+		descs = append(descs, fmt.Sprintf("have the metadata %s", strings.Join(meta, ", ")))
+	}
+	if len(fs) == 0 {
+		return nil, nil
+	}
+	return unitsFilter(s, strings.Join(descs, " and "), fs...)
+}
+
+// unitsFilter returns a filter that selects the defs and refs in the
+// source units in s that match all of the filters fs. If there are no
+// such units, it returns an error saying that no units match desc
+// (e.g., "are owned by @org/team").
+func unitsFilter(s interface{}, desc string, fs ...store.UnitFilter) (interface {
+	store.DefFilter
+	store.RefFilter
+}, error) {
+	ts, ok := s.(store.TreeStore)
+	if !ok {
+		return nil, fmt.Errorf("store (type %T) does not implement listing source units", s)
+	}
+	units, err := ts.Units(fs...)
+	if err != nil {
+		return nil, err
+	}
+	if len(units) == 0 {
+		return nil, fmt.Errorf("no source units %s", desc)
+	}
+	ids := make([]unit.ID2, len(units))
+	for i, u := range units {
+		ids[i] = u.ID2()
+	}
+	return store.ByUnits(ids...), nil
+}
+
 func (c *StoreUnitsCmd) Execute(args []string) error {
 	s, err := OpenStore()
 	if err != nil {
@@ -937,6 +1355,7 @@ func (c *StoreUnitsCmd) Execute(args []string) error {
 type StoreDefsCmd struct {
 	Repo     string `long:"repo"`
 	Path     string `long:"path"`
+	Kind     string `long:"kind" description:"only list defs of this canonical kind (e.g., class, function)"`
 	UnitType string `long:"unit-type" `
 	Unit     string `long:"unit"`
 	File     string `long:"file"`
@@ -946,6 +1365,14 @@ type StoreDefsCmd struct {
 
 	Query string `long:"query"`
 
+	Owner string   `long:"owner" description:"only list defs in units owned by this owner (e.g., @org/team)"`
+	Tag   string   `long:"tag" description:"only list defs in units with this tag (e.g., a repository topic)"`
+	Meta  []string `long:"meta" description:"only list defs in units with this metadata, e.g. team=checkout (repeatable)" value-name:"KEY=VALUE"`
+
+	ExportedOnly bool `long:"exported-only" description:"only list exported defs (with public or protected visibility)"`
+
+	TestCodeOpt
+
 	Limit  int `short:"n" long:"limit" description:"max results to return (0 for all)"`
 	Offset int `long:"offset" description:"results offset (0 to start with first results)"`
 
@@ -974,6 +1401,15 @@ func (c *StoreDefsCmd) filters() []store.DefFilter {
 	if c.Path != "" {
 		fs = append(fs, store.ByDefPath(c.Path))
 	}
+	if c.Kind != "" {
+		fs = append(fs, store.ByDefKind(c.Kind))
+	}
+	if c.ExportedOnly {
+		fs = append(fs, store.ByDefExported())
+	}
+	if f := c.testCodeFilter(); f != nil {
+		fs = append(fs, f)
+	}
 	if c.File != "" {
 		fs = append(fs, store.ByFiles(false, path.Clean(c.File)))
 	}
@@ -1011,7 +1447,17 @@ func (c *StoreDefsCmd) Get() ([]*graph.Def, error) {
 		return nil, fmt.Errorf("store (type %T) does not implement listing defs", s)
 	}
 
-	defs, err := us.Defs(c.filters()...)
+	fs := c.filters()
+	f, err := unitAttrsFilter(s, c.Owner, c.Tag, c.Meta)
+	if err != nil {
+		return nil, err
+	}
+	if f != nil {
+		// Prepend the filter so that it's applied before any limit.
+		fs = append([]store.DefFilter{f}, fs...)
+	}
+
+	defs, err := us.Defs(fs...)
 	if err != nil {
 		return nil, err
 	}
@@ -1035,13 +1481,25 @@ type StoreRefsCmd struct {
 	DefUnit     string `long:"def-unit"`
 	DefPath     string `long:"def-path"`
 
+	NoAliases bool `long:"no-aliases" description:"with --def-path, don't also list refs to defs that alias the def (e.g., re-exports)"`
+
 	Broken   bool `long:"broken" description:"only show refs that point to nonexistent defs"`
 	Coverage bool `long:"coverage" description:"print a coverage summary (resolved refs, broken refs, total refs)"`
 
 	Format string `long:"format" description:"output format ('json' or 'none')" default:"json"`
 
+	Owner string   `long:"owner" description:"only list refs in units owned by this owner (e.g., @org/team)"`
+	Tag   string   `long:"tag" description:"only list refs in units with this tag (e.g., a repository topic)"`
+	Meta  []string `long:"meta" description:"only list refs in units with this metadata, e.g. team=checkout (repeatable)" value-name:"KEY=VALUE"`
+
+	TestCodeOpt
+
 	Limit  int `short:"n" long:"limit" description:"max results to return (0 for all)"`
 	Offset int `long:"offset" description:"results offset (0 to start with first results)"`
+
+	// aliases are the aliases of defs in the store, which are used to
+	// also list refs to aliases of the --def-path def.
+	aliases graph.Aliases
 }
 
 func (c *StoreRefsCmd) filters() []store.RefFilter {
@@ -1075,12 +1533,12 @@ func (c *StoreRefsCmd) filters() []store.RefFilter {
 		}))
 	}
 	if c.DefPath != "" {
-		fs = append(fs, store.ByRefDef(graph.RefDefKey{
+		fs = append(fs, store.ByRefDefOrAliases(graph.RefDefKey{
 			DefRepo:     c.DefRepo,
 			DefUnitType: c.DefUnitType,
 			DefUnit:     c.DefUnit,
 			DefPath:     c.DefPath,
-		}))
+		}, c.aliases))
 	} else {
 		// Slower filters since they don't use an index.
 		if c.DefRepo != "" {
@@ -1099,6 +1557,9 @@ func (c *StoreRefsCmd) filters() []store.RefFilter {
 			})))
 		}
 	}
+	if f := c.testCodeFilter(); f != nil {
+		fs = append(fs, f)
+	}
 	if c.Limit != 0 || c.Offset != 0 {
 		fs = append(fs, store.Limit(c.Limit, c.Offset))
 	}
@@ -1130,7 +1591,28 @@ func (c *StoreRefsCmd) Get() ([]*graph.Ref, error) {
 		return nil, fmt.Errorf("store (type %T) does not implement listing refs", s)
 	}
 
-	refs, err := us.Refs(c.filters()...)
+	if c.DefPath != "" && !c.NoAliases {
+		var fs []store.DefFilter
+		if c.CommitID != "" {
+			fs = append(fs, store.ByCommitIDs(c.CommitID))
+		}
+		c.aliases, err = store.LoadAliases(us, fs...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fs := c.filters()
+	f, err := unitAttrsFilter(s, c.Owner, c.Tag, c.Meta)
+	if err != nil {
+		return nil, err
+	}
+	if f != nil {
+		// Prepend the filter so that it's applied before any limit.
+		fs = append([]store.RefFilter{f}, fs...)
+	}
+
+	refs, err := us.Refs(fs...)
 	if err != nil {
 		return nil, err
 	}
@@ -1191,6 +1673,14 @@ func brokenRefsOnly(refs []*graph.Ref, s interface{}) ([]*graph.Ref, error) {
 				par.Error(err)
 				return
 			}
+			if len(defs) == 1 && defs[0].AliasOf != nil {
+				// A ref to an alias is broken if the def that it
+				// (transitively) aliases doesn't exist.
+				if defs, err = resolveStoreAlias(s.(store.RepoStore), defs[0]); err != nil {
+					par.Error(err)
+					return
+				}
+			}
 			if len(defs) == 0 {
 				brokenRefMu.Lock()
 				brokenRefs = append(brokenRefs, refs...)
@@ -1203,6 +1693,32 @@ func brokenRefsOnly(refs []*graph.Ref, s interface{}) ([]*graph.Ref, error) {
 	return brokenRefs, err
 }
 
+// resolveStoreAlias follows the chain of aliases starting at the alias
+// def, and returns the def at the end of the chain (or no defs, if the
+// chain is cyclic or ends at a nonexistent def). Aliases of defs in
+// other repositories are assumed to resolve.
+func resolveStoreAlias(rs store.RepoStore, def *graph.Def) ([]*graph.Def, error) {
+	seen := map[graph.DefKey]struct{}{}
+	for def.AliasOf != nil {
+		if _, cyclic := seen[def.DefKey]; cyclic {
+			return nil, nil
+		}
+		seen[def.DefKey] = struct{}{}
+
+		key, _ := def.AliasKey()
+		if key.Repo != def.Repo {
+			return []*graph.Def{def}, nil
+		}
+		key.CommitID = def.CommitID
+		defs, err := rs.Defs(store.ByDefKey(key))
+		if err != nil || len(defs) == 0 {
+			return nil, err
+		}
+		def = defs[0]
+	}
+	return []*graph.Def{def}, nil
+}
+
 func makeRepoCommitIDsFilter(repoCommitIDs string) interface {
 	store.ByRepoCommitIDsFilter
 	store.VersionFilter
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+type StoreDownsampleCmd struct {
+	CommitIDs []string      `long:"commit" description:"downsample the data of this commit (repeatable)" value-name:"COMMIT"`
+	OlderThan time.Duration `long:"older-than" description:"downsample the data of all commits older than this (e.g., 2160h for 90 days), according to the current repository's commit dates" value-name:"DURATION"`
+	DryRun    bool          `short:"n" long:"dry-run" description:"list the commits that would be downsampled, but don't downsample them"`
+}
+
+var storeDownsampleCmd StoreDownsampleCmd
+
+func (c *StoreDownsampleCmd) Execute(args []string) error {
+	if len(c.CommitIDs) == 0 && c.OlderThan <= 0 {
+		return fmt.Errorf("no commits to downsample (specify --commit or --older-than)")
+	}
+	s, err := OpenStore()
+	if err != nil {
+		return err
+	}
+	rs, ok := s.(store.RepoStoreImporter)
+	if !ok {
+		return fmt.Errorf("store (type %T) does not implement importing into a repository", s)
+	}
+
+	commitIDs := c.CommitIDs
+	if c.OlderThan > 0 {
+		repo, err := OpenRepo(".")
+		if err != nil {
+			return err
+		}
+		versions, err := rs.Versions()
+		if err != nil {
+			return err
+		}
+		for _, v := range versions {
+			date, err := repo.VCS.CommitDate(repo.RootDir, v.CommitID)
+			if err != nil {
+				log.Printf("Warning: skipping commit %s, whose date is unknown: %s.", v.CommitID, err)
+				continue
+			}
+			if time.Since(date) > c.OlderThan {
+				commitIDs = append(commitIDs, v.CommitID)
+			}
+		}
+	}
+
+	for _, commitID := range commitIDs {
+		if c.DryRun {
+			fmt.Println(commitID)
+			continue
+		}
+		n, err := downsampleCommit(rs, commitID)
+		if err != nil {
+			return fmt.Errorf("downsampling commit %s: %s", commitID, err)
+		}
+		if n == 0 {
+			log.Printf("Commit %s has no refs (it may already be downsampled).", commitID)
+		} else {
+			log.Printf("Downsampled commit %s (removed %d refs).", commitID, n)
+		}
+	}
+	return nil
+}
+
+// downsampleCommit replaces the data of a commit in s with its defs
+// and their ref counts (see graph.RefCounts), and reindexes it. It
+// returns the number of refs that were removed. Commits without refs
+// (such as those that were already downsampled) are left as is.
+func downsampleCommit(s store.RepoStoreImporter, commitID string) (int, error) {
+	refs, err := s.Refs(store.ByCommitIDs(commitID))
+	if err != nil {
+		return 0, err
+	}
+	if len(refs) == 0 {
+		return 0, nil
+	}
+	counts := graph.RefCounts{}
+	counts.Add(refs)
+
+	units, err := s.Units(store.ByCommitIDs(commitID))
+	if err != nil {
+		return 0, err
+	}
+	defs, err := s.Defs(store.ByCommitIDs(commitID))
+	if err != nil {
+		return 0, err
+	}
+	unitDefs := map[unit.ID2][]*graph.Def{}
+	for _, d := range defs {
+		u := unit.ID2{Type: d.UnitType, Name: d.Unit}
+		unitDefs[u] = append(unitDefs[u], d)
+	}
+	for _, u := range units {
+		data := graph.Output{Defs: unitDefs[u.ID2()]}
+		counts.Downsample(&data)
+		if err := s.Import(commitID, u, data); err != nil {
+			return 0, err
+		}
+	}
+	if x, ok := s.(store.RepoIndexer); ok {
+		if err := x.Index(commitID); err != nil {
+			return 0, err
+		}
+	}
+	return len(refs), nil
+}
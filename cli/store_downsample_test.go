@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"testing"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestDownsampleCommit(t *testing.T) {
+	s := store.NewFSRepoStore(rwvfs.Walkable(rwvfs.Sub(rwvfs.Map(map[string]string{}), "/store")))
+	const commitID = "c"
+	u := &unit.SourceUnit{Key: unit.Key{Type: "t", Name: "u"}, Info: unit.Info{Files: []string{"f"}}}
+	data := graph.Output{
+		Defs: []*graph.Def{
+			{DefKey: graph.DefKey{UnitType: "t", Unit: "u", Path: "F"}, Name: "F", File: "f"},
+			{DefKey: graph.DefKey{UnitType: "t", Unit: "u", Path: "G"}, Name: "G", File: "f"},
+		},
+		Refs: []*graph.Ref{
+			{DefUnitType: "t", DefUnit: "u", DefPath: "F", UnitType: "t", Unit: "u", File: "f", Start: 0, End: 1, Def: true},
+			{DefUnitType: "t", DefUnit: "u", DefPath: "F", UnitType: "t", Unit: "u", File: "f", Start: 5, End: 6},
+			{DefUnitType: "t", DefUnit: "u", DefPath: "F", UnitType: "t", Unit: "u", File: "f", Start: 8, End: 9},
+		},
+	}
+	if err := s.Import(commitID, u, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.(store.RepoIndexer).Index(commitID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateVersion(commitID); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := downsampleCommit(s, commitID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("got %d refs removed, want 3", n)
+	}
+	refs, err := s.Refs(store.ByCommitIDs(commitID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 0 {
+		t.Errorf("got %d refs after downsampling, want 0", len(refs))
+	}
+	defs, err := s.Defs(store.ByCommitIDs(commitID), store.ByDefPath("F"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defs) != 1 || defs[0].RefCount != 2 {
+		t.Errorf("got defs %v, want F with RefCount 2", defs)
+	}
+
+	// Downsampling again does nothing.
+	if n, err := downsampleCommit(s, commitID); err != nil || n != 0 {
+		t.Errorf("got %d refs removed (error %v) when downsampling again, want 0", n, err)
+	}
+}
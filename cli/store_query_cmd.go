@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+)
+
+type StoreQueryCmd struct {
+	Refs      bool     `long:"refs" description:"list refs (instead of defs) that match the filter expression"`
+	CommitIDs []string `long:"commit" description:"only list defs or refs at this commit (repeatable; each result's CommitID tells which commit it's at)" value-name:"COMMIT"`
+
+	Limit  int `short:"n" long:"limit" description:"max results to return (0 for all)"`
+	Offset int `long:"offset" description:"results offset (0 to start with first results)"`
+
+	Args struct {
+		Expr []string `name:"EXPR" description:"filter expression terms (see above)"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var storeQueryCmd StoreQueryCmd
+
+func storeQueryLongDescription() string {
+	var defFields, refFields []string
+	for name := range store.DefExprFields {
+		defFields = append(defFields, name)
+	}
+	for name := range store.RefExprFields {
+		refFields = append(refFields, name)
+	}
+	sort.Strings(defFields)
+	sort.Strings(refFields)
+
+	return `The query command lists all defs (or, with --refs, refs) that match a filter expression, such as:
+
+  kind:func exported:true file:pkg/** name~"^New" -test:true
+
+Each term is FIELD:VALUE, which matches if the field equals the value (or matches it as a glob pattern, in which ** matches any number of path components), or FIELD~REGEXP. A term preceded by "-" is negated. Values may be double-quoted. All terms must match.
+
+With --commit (which may be repeated, e.g., for the base and head commits of a pull request), only defs or refs at the given commits are listed; the commits are queried concurrently.
+
+Def fields: ` + strings.Join(defFields, ", ") + `
+Ref fields: ` + strings.Join(refFields, ", ")
+}
+
+func (c *StoreQueryCmd) Execute(args []string) error {
+	expr, err := store.ParseFilterExpr(strings.Join(c.Args.Expr, " "))
+	if err != nil {
+		return err
+	}
+
+	s, err := OpenStore()
+	if err != nil {
+		return err
+	}
+	us, ok := s.(store.UnitStore)
+	if !ok {
+		return fmt.Errorf("store (type %T) does not implement listing defs and refs", s)
+	}
+
+	if c.Refs {
+		refs, err := c.refs(us, expr)
+		if err != nil {
+			return err
+		}
+		PrintJSON(refs, "  ")
+		return nil
+	}
+	defs, err := c.defs(us, expr)
+	if err != nil {
+		return err
+	}
+	PrintJSON(defs, "  ")
+	return nil
+}
+
+func (c *StoreQueryCmd) defs(us store.UnitStore, expr *store.FilterExpr) ([]*graph.Def, error) {
+	fs, err := expr.DefFilters()
+	if err != nil {
+		return nil, err
+	}
+	if len(c.CommitIDs) > 0 {
+		fs = append(fs, store.ByCommitIDs(c.CommitIDs...))
+	}
+	if c.Limit != 0 || c.Offset != 0 {
+		fs = append(fs, store.Limit(c.Limit, c.Offset))
+	}
+	return us.Defs(fs...)
+}
+
+func (c *StoreQueryCmd) refs(us store.UnitStore, expr *store.FilterExpr) ([]*graph.Ref, error) {
+	fs, err := expr.RefFilters()
+	if err != nil {
+		return nil, err
+	}
+	if len(c.CommitIDs) > 0 {
+		fs = append(fs, store.ByCommitIDs(c.CommitIDs...))
+	}
+	if c.Limit != 0 || c.Offset != 0 {
+		fs = append(fs, store.Limit(c.Limit, c.Offset))
+	}
+	return us.Refs(fs...)
+}
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+type StoreSearchCmd struct {
+	Repo         string `long:"repo"`
+	CommitID     string `long:"commit"`
+	UnitType     string `long:"unit-type"`
+	Unit         string `long:"unit"`
+	ExportedOnly bool   `long:"exported-only" description:"only list exported defs (with public or protected visibility)"`
+
+	Limit  int    `short:"n" long:"limit" description:"max results to return (0 for all)" default:"20"`
+	Format string `long:"format" description:"output format" default:"table" value-name:"table|json"`
+
+	Args struct {
+		Query string `name:"QUERY" description:"def name (or name prefix) to search for"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var storeSearchCmd StoreSearchCmd
+
+// DefScorer is the scorer used by "srclib store search" to rank
+// results. Programs that embed srclib may set it to use their own
+// ranking.
+var DefScorer store.DefScorer = store.DefaultDefScorer
+
+func (c *StoreSearchCmd) filters() []store.DefFilter {
+	var fs []store.DefFilter
+	if c.UnitType != "" && c.Unit != "" {
+		fs = append(fs, store.ByUnits(unit.ID2{Type: c.UnitType, Name: c.Unit}))
+	}
+	if (c.UnitType != "" && c.Unit == "") || (c.UnitType == "" && c.Unit != "") {
+		log.Fatal("must specify either both or neither of --unit-type and --unit (to filter by source unit)")
+	}
+	if c.CommitID != "" {
+		fs = append(fs, store.ByCommitIDs(c.CommitID))
+	}
+	if c.Repo != "" {
+		fs = append(fs, store.ByRepos(c.Repo))
+	}
+	if c.ExportedOnly {
+		fs = append(fs, store.ByDefExported())
+	}
+	return fs
+}
+
+func (c *StoreSearchCmd) Execute(args []string) error {
+	if c.Format != "table" && c.Format != "json" {
+		return fmt.Errorf("unknown output format %q (expected table or json)", c.Format)
+	}
+	if c.Args.Query == "" {
+		return fmt.Errorf("empty search query")
+	}
+
+	s, err := OpenStore()
+	if err != nil {
+		return err
+	}
+	us, ok := s.(store.UnitStore)
+	if !ok {
+		return fmt.Errorf("store (type %T) does not implement listing defs and refs", s)
+	}
+
+	results, err := store.SearchDefs(us, c.Args.Query, DefScorer, c.filters()...)
+	if err != nil {
+		return err
+	}
+	if c.Limit > 0 && len(results) > c.Limit {
+		results = results[:c.Limit]
+	}
+
+	if c.Format == "json" {
+		PrintJSON(results, "  ")
+		return nil
+	}
+	for _, r := range results {
+		def := r.Def
+		fmt.Printf("%6.2f %6d  %-10s %s %s\n", r.Score, r.Refs, def.Kind, def.Unit, def.Path)
+	}
+	return nil
+}
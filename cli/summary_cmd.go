@@ -0,0 +1,241 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"sourcegraph.com/sourcegraph/go-flags"
+	"sourcegraph.com/sourcegraph/rwvfs"
+
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/cvg"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func init() {
+	cliInit = append(cliInit, func(cli *flags.Command) {
+		_, err := cli.AddCommand("summary",
+			"summarize the analysis of the current repository",
+			`Prints a one-screen summary of the build data for the current commit of the current repository: the languages and source units analyzed, the numbers of defs and refs, the coverage of each language (see "srclib coverage"), the versions of the toolchains that produced the build data, the errors that the tools reported (see "srclib logs"), the size of the build data, and when it was last written.
+
+Run "srclib make" first to produce the build data.`,
+			&summaryCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	})
+}
+
+type SummaryCmd struct {
+	NoCoverage bool   `long:"no-coverage" description:"don't compute coverage (which requires scanning the repository's files)"`
+	Format     string `long:"format" description:"output format" default:"table" value-name:"table|json"`
+}
+
+var summaryCmd SummaryCmd
+
+// repoSummary is the output of "srclib summary".
+type repoSummary struct {
+	Repo     string `json:",omitempty"`
+	CommitID string
+
+	// Languages lists the languages that were analyzed (those that
+	// coverage was computed for), sorted.
+	Languages []string `json:",omitempty"`
+
+	Units            int            // number of source units
+	UnitTypes        map[string]int // number of source units of each type
+	UnitsWithoutData int            // number of source units without graph data
+
+	Defs         int
+	ExportedDefs int
+	Refs         int
+
+	// Coverage is the coverage of each language (without its lists
+	// of files), or nil if it wasn't computed.
+	Coverage map[string]*cvg.Coverage `json:",omitempty"`
+
+	Toolchains []*toolchain.VersionRecord `json:",omitempty"`
+
+	BuildDataFiles int
+	BuildDataBytes uint64
+
+	// SkippedFiles is the number of files that were skipped because
+	// they were too large or binary (see config.SkippedFilesFilename).
+	SkippedFiles int `json:",omitempty"`
+
+	// ToolErrors lists the errors that the tools reported for the
+	// source units (see toolchain.ErrorsFileEnv), as "UNIT OP: ERROR".
+	ToolErrors []string `json:",omitempty"`
+
+	// AnalyzedAt is the modification time of the most recently
+	// written build data file.
+	AnalyzedAt time.Time
+}
+
+func (c *SummaryCmd) Execute(args []string) error {
+	if c.Format != "table" && c.Format != "json" {
+		return fmt.Errorf("unknown output format %q (expected table or json)", c.Format)
+	}
+
+	repo, err := OpenLocalRepo()
+	if err != nil {
+		return err
+	}
+	bdfs, err := GetBuildDataFS(repo.CommitID)
+	if err != nil {
+		return err
+	}
+	if _, err := bdfs.Stat("."); os.IsNotExist(err) {
+		return fmt.Errorf("no build data for commit %s (run 'srclib make' first)", repo.CommitID)
+	} else if err != nil {
+		return err
+	}
+
+	s := &repoSummary{CommitID: repo.CommitID, UnitTypes: map[string]int{}}
+	if repo.CloneURL != "" {
+		s.Repo = graph.MakeURI(repo.CloneURL)
+	}
+
+	err = readBuildDataGraphs(repo.CommitID, func(u *unit.SourceUnit, o *graph.Output) {
+		s.Units++
+		s.UnitTypes[u.Type]++
+		if o == nil {
+			s.UnitsWithoutData++
+			return
+		}
+		s.Defs += len(o.Defs)
+		s.Refs += len(o.Refs)
+		for _, def := range o.Defs {
+			if def.Exported {
+				s.ExportedDefs++
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if !c.NoCoverage {
+		covs, err := coverage(repo, false, &TestCodeOpt{}, "")
+		if err != nil {
+			return err
+		}
+		s.Coverage = make(map[string]*cvg.Coverage, len(covs))
+		for lang, cov := range covs {
+			s.Languages = append(s.Languages, lang)
+			s.Coverage[lang] = &cvg.Coverage{FileScore: cov.FileScore, RefScore: cov.RefScore, TokDensity: cov.TokDensity, DocScore: cov.DocScore}
+		}
+		sort.Strings(s.Languages)
+	}
+
+	if v, err := toolchain.ReadVersions(bdfs); err == nil {
+		s.Toolchains = v.Toolchains
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	skipped, err := config.ReadSkippedFiles(bdfs)
+	if err != nil {
+		return err
+	}
+	s.SkippedFiles = len(skipped)
+
+	cfg, err := config.ReadCached(bdfs)
+	if err != nil {
+		return err
+	}
+	logs, err := readToolLogs(bdfs, cfg.SourceUnits, "")
+	if err != nil {
+		return err
+	}
+	for _, l := range logs {
+		for _, e := range l.Errors {
+			s.ToolErrors = append(s.ToolErrors, unitLogLabel(l)+": "+describeToolError(e))
+		}
+	}
+
+	fis, err := rwvfs.StatAllRecursive(".", rwvfs.Walkable(bdfs))
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		if fi.IsDir() {
+			continue
+		}
+		s.BuildDataFiles++
+		s.BuildDataBytes += uint64(fi.Size())
+		if fi.ModTime().After(s.AnalyzedAt) {
+			s.AnalyzedAt = fi.ModTime()
+		}
+	}
+
+	if c.Format == "json" {
+		PrintJSON(s, "  ")
+		return nil
+	}
+	s.printTable()
+	return nil
+}
+
+func (s *repoSummary) printTable() {
+	repo := s.Repo
+	if repo == "" {
+		repo = "(unknown)"
+	}
+	commit := s.CommitID
+	if len(commit) > 7 {
+		commit = commit[:7]
+	}
+	fmt.Printf("Repository:    %s @ %s\n", repo, commit)
+	fmt.Printf("Analyzed:      %s\n", s.AnalyzedAt.Format(time.RFC3339))
+	if len(s.Languages) > 0 {
+		fmt.Printf("Languages:     %s\n", strings.Join(s.Languages, ", "))
+	}
+
+	var types []string
+	for typ, n := range s.UnitTypes {
+		types = append(types, fmt.Sprintf("%d %s", n, typ))
+	}
+	sort.Strings(types)
+	units := fmt.Sprintf("%d", s.Units)
+	if len(types) > 0 {
+		units += " (" + strings.Join(types, ", ") + ")"
+	}
+	if s.UnitsWithoutData > 0 {
+		units += fmt.Sprintf("; %d without graph data", s.UnitsWithoutData)
+	}
+	fmt.Printf("Source units:  %s\n", units)
+	fmt.Printf("Defs:          %d (%d exported)\n", s.Defs, s.ExportedDefs)
+	fmt.Printf("Refs:          %d\n", s.Refs)
+	fmt.Printf("Build data:    %s in %d files\n", bytesString(s.BuildDataBytes), s.BuildDataFiles)
+	if s.SkippedFiles > 0 {
+		fmt.Printf("Skipped files: %d (too large or binary)\n", s.SkippedFiles)
+	}
+
+	if len(s.Toolchains) > 0 {
+		fmt.Println("Toolchains:")
+		for _, t := range s.Toolchains {
+			fmt.Printf("  %s %s\n", t.Path, t.Version)
+		}
+	}
+	if len(s.ToolErrors) > 0 {
+		fmt.Println("Tool errors:")
+		for _, e := range s.ToolErrors {
+			fmt.Printf("  %s\n", e)
+		}
+	}
+	if len(s.Languages) > 0 {
+		fmt.Println("Coverage:")
+		for _, lang := range s.Languages {
+			cov := s.Coverage[lang]
+			fmt.Printf("  %-12s files %5.1f%%  refs %5.1f%%  docs %5.1f%%  tok density %.2f\n", lang, cov.FileScore*100, cov.RefScore*100, cov.DocScore*100, cov.TokDensity)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
@@ -31,7 +32,27 @@ Expected and actual outputs for a tree are stored in TREE/../../{expected,actual
 
 After making the tree, "srclib test" compares the actual test output against the expected test output. Any differences trigger a test failure, and the differinglines are printed.
 
-If the --gen flag is used, the expected test output is removed and regenerated. You should regenerate the expected output whenever you make changes to the toolchain that alter the desired output. Be sure to check the new expected output for errors manually; it's easy to accidentally commit new expected output that is incorrect.
+If the --gen flag is used, the expected test output is removed and regenerated. If the --update flag is used, the tests are run as usual, but the expected output of each tree whose actual output differs is replaced with the actual output. You should regenerate the expected output whenever you make changes to the toolchain that alter the desired output. Be sure to check the new expected output for errors manually; it's easy to accidentally commit new expected output that is incorrect.
+
+NORMALIZATION
+
+Before the expected and actual outputs are compared, the JSON files in both are normalized so that tests don't fail on one platform or machine but pass on another. By default, the defs, refs, docs, anns, and files listed in each file are sorted; backslashes in file paths are converted to slashes; and the absolute path of the tree is replaced with "$TREE". Use --keep-order, --keep-separators, and --keep-abs-paths to disable these normalizations, and use --replace to make other replacements (e.g., to remove toolchain versions or timestamps). Expected output is written in normalized form.
+
+CORPUS TESTS
+
+With --corpus FILE, "srclib test" instead tests the installed toolchains on real repositories. FILE is a JSON file listing the repositories to test, such as:
+
+  {
+    "Repos": [
+      {
+        "CloneURL": "https://github.com/gorilla/mux",
+        "CommitID": "5a8a0400500543e28b2886a8c52d21a435815411",
+        "MinCoverage": {"Go": {"FileScore": 0.9, "RefScore": 0.95}}
+      }
+    ]
+  }
+
+Each repository is cloned into the --corpus-dir directory (or updated, if it was cloned before), and the CommitID (if any) is checked out. Then the repository is analyzed ("srclib do-all"), and its coverage (as computed by "srclib coverage") is checked against the minimum scores for each language in MinCoverage. Repositories without MinCoverage must pass the default coverage thresholds for all languages.
 
 CONFIGURING TESTS
 
@@ -69,6 +90,17 @@ And the actual test output is written to:
 
 type TestCmd struct {
 	GenerateExpected bool `long:"gen" description:"(re)generate expected output for all test cases and exit"`
+	Update           bool `long:"update" description:"replace the expected output of test cases whose actual output differs"`
+
+	Corpus    string `long:"corpus" description:"test the toolchains on the repositories listed in this JSON file and check their coverage" value-name:"FILE"`
+	CorpusDir string `long:"corpus-dir" description:"directory to clone corpus repositories into" default:"testdata/corpus" value-name:"DIR"`
+
+	Normalize struct {
+		KeepOrder      bool     `long:"keep-order" description:"don't sort defs, refs, docs, anns, and files before comparing outputs"`
+		KeepSeparators bool     `long:"keep-separators" description:"don't convert backslashes in file paths to slashes"`
+		KeepAbsPaths   bool     `long:"keep-abs-paths" description:"don't replace the absolute path of the tree with $TREE"`
+		Replace        []string `long:"replace" description:"replace matches of a regexp in all strings in the outputs (e.g., toolchain versions); may be repeated" value-name:"REGEXP=>REPL"`
+	} `group:"normalization"`
 
 	Args struct {
 		Trees []Directory `name:"TREES" description:"trees to treat as test cases"`
@@ -78,6 +110,24 @@ type TestCmd struct {
 var testCmd TestCmd
 
 func (c *TestCmd) Execute(args []string) error {
+	if c.GenerateExpected && c.Update {
+		return fmt.Errorf("--gen and --update can't be used together")
+	}
+	if c.Corpus != "" {
+		if c.GenerateExpected || c.Update || len(c.Args.Trees) > 0 {
+			return fmt.Errorf("--corpus can't be used with --gen, --update, or TREES")
+		}
+		return c.runCorpus(c.Corpus, c.CorpusDir)
+	}
+	var replace []testReplacement
+	for _, r := range c.Normalize.Replace {
+		tr, err := parseTestReplacement(r)
+		if err != nil {
+			return err
+		}
+		replace = append(replace, tr)
+	}
+
 	var trees []string
 	if len(c.Args.Trees) > 0 {
 		for _, tree := range c.Args.Trees {
@@ -105,7 +155,19 @@ func (c *TestCmd) Execute(args []string) error {
 		}
 		expectedDir := filepath.Join("testdata/expected", casepath)
 		actualDir := filepath.Join("testdata/actual", casepath)
-		if err := testTree(tree, expectedDir, actualDir, c.GenerateExpected); err != nil {
+		opt := testNormalization{
+			Sort:    !c.Normalize.KeepOrder,
+			Slashes: !c.Normalize.KeepSeparators,
+			Replace: replace,
+		}
+		if !c.Normalize.KeepAbsPaths {
+			absTree, err := filepath.Abs(tree)
+			if err != nil {
+				return err
+			}
+			opt.AbsPaths = map[string]string{absTree: "$TREE", filepath.ToSlash(absTree): "$TREE"}
+		}
+		if err := testTree(tree, expectedDir, actualDir, c.GenerateExpected, c.Update, opt); err != nil {
 			return fmt.Errorf("testing tree %q: %s", tree, err)
 		}
 	}
@@ -117,7 +179,7 @@ func (c *TestCmd) Execute(args []string) error {
 	return nil
 }
 
-func testTree(treeDir, expectedDir, actualDir string, generateExpected bool) error {
+func testTree(treeDir, expectedDir, actualDir string, generateExpected, update bool, opt testNormalization) error {
 	treeName := filepath.Base(treeDir)
 	if treeName == "." {
 		absTreeDir, err := filepath.Abs(treeDir)
@@ -185,11 +247,37 @@ func testTree(treeDir, expectedDir, actualDir string, generateExpected bool) err
 		return fmt.Errorf("Command %v in %s failed: %s.\n\nOutput was:\n%s", cmd.Args, treeName, err, buf.String())
 	}
 
+	if err := normalizeTestOutput(outputDir, outputDir, opt); err != nil {
+		return err
+	}
 	if generateExpected {
 		log.Printf("Successfully generated expected output for %s in %s.", treeName, expectedDir)
 		return nil
 	}
-	return checkResults(buf, treeDir, actualDir, expectedDir)
+
+	// Normalize a copy of the expected output, which might have been
+	// generated before normalization (or with other options).
+	normExpectedDir, err := ioutil.TempDir("", "srclib-test-expected")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(normExpectedDir)
+	if err := normalizeTestOutput(expectedDir, normExpectedDir, opt); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	err = checkResults(buf, treeDir, actualDir, normExpectedDir)
+	if err != nil && update {
+		if err := os.RemoveAll(expectedDir); err != nil {
+			return err
+		}
+		if err := normalizeTestOutput(actualDir, expectedDir, opt); err != nil {
+			return err
+		}
+		colorable.Println(colorable.Cyan(treeName + " UPDATED"))
+		return nil
+	}
+	return err
 }
 
 func checkResults(output bytes.Buffer, treeDir, actualDir, expectedDir string) error {
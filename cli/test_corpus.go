@@ -0,0 +1,193 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alexsaveliev/go-colorable-wrapper"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/cvg"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// A testCorpus is a list of real repositories that "srclib test
+// --corpus" analyzes with the installed toolchains, checking that
+// the coverage of each is above its thresholds. It is read from a
+// JSON file.
+type testCorpus struct {
+	Repos []*corpusRepo
+}
+
+// A corpusRepo is a repository in a test corpus.
+type corpusRepo struct {
+	// CloneURL is the repository's clone URL (only git repositories
+	// are supported).
+	CloneURL string
+
+	// CommitID is the revision to analyze. If empty, the default
+	// branch's latest commit is analyzed, which may change over time.
+	CommitID string `json:",omitempty"`
+
+	// MinCoverage maps languages (as in "srclib coverage" output) to
+	// the minimum coverage scores for the repository's files in that
+	// language. Zero scores are not checked. If MinCoverage is empty,
+	// the coverage of each language must pass the default thresholds
+	// (see cvg.Coverage's FileScorePass, RefScorePass, and
+	// TokDensityPass methods).
+	MinCoverage map[string]*cvg.Coverage `json:",omitempty"`
+}
+
+// defaultMinCoverage is the minimum coverage for each language of a
+// corpus repository without MinCoverage. (The default thresholds are
+// exclusive, but the difference doesn't matter in practice.)
+var defaultMinCoverage = &cvg.Coverage{
+	FileScore:  cvg.PassFileScore,
+	RefScore:   cvg.PassRefScore,
+	TokDensity: cvg.PassTokDensity,
+}
+
+// readTestCorpus reads a test corpus from a JSON file.
+func readTestCorpus(file string) (*testCorpus, error) {
+	var c testCorpus
+	if err := readJSONFile(file, &c); err != nil {
+		return nil, fmt.Errorf("reading test corpus %s: %s", file, err)
+	}
+	for i, r := range c.Repos {
+		if _, err := graph.TryMakeURI(r.CloneURL); err != nil {
+			return nil, fmt.Errorf("test corpus %s: repo %d: invalid CloneURL %q: %s", file, i, r.CloneURL, err)
+		}
+	}
+	return &c, nil
+}
+
+// runCorpus tests the installed toolchains on each repository in
+// the corpus file, cloning the repositories into dir.
+func (c *TestCmd) runCorpus(file, dir string) error {
+	corpus, err := readTestCorpus(file)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, r := range corpus.Repos {
+		uri := graph.MakeURI(r.CloneURL)
+		repoDir := filepath.Join(dir, filepath.FromSlash(uri))
+		if GlobalOpt.Verbose {
+			log.Printf("Testing corpus repository %s in %s...", uri, repoDir)
+		}
+		if err := testCorpusRepo(r, repoDir); err != nil {
+			colorable.Println(colorable.Red(uri + " FAIL"))
+			colorable.Println(err.Error())
+			failed = append(failed, uri)
+			continue
+		}
+		colorable.Println(colorable.Green(uri + " PASS"))
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d corpus repositories failed: %s", len(failed), len(corpus.Repos), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// testCorpusRepo clones (or updates) r into dir, analyzes it, and
+// checks its coverage.
+func testCorpusRepo(r *corpusRepo, dir string) error {
+	if err := srclib.CheckOnline("fetching corpus repository " + r.CloneURL); err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+			return err
+		}
+		if err := execCmdInDir(filepath.Dir(dir), "git", "clone", "-q", r.CloneURL, filepath.Base(dir)); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else if err := execCmdInDir(dir, "git", "fetch", "-q"); err != nil {
+		return err
+	}
+	rev := r.CommitID
+	if rev == "" {
+		rev = "origin/HEAD" // the default branch, as of the last fetch
+	}
+	if err := execCmdInDir(dir, "git", "checkout", "-q", rev); err != nil {
+		return err
+	}
+
+	if _, err := runSrclib(dir, "-v", "do-all"); err != nil {
+		return err
+	}
+	out, err := runSrclib(dir, "coverage")
+	if err != nil {
+		return err
+	}
+	var cov map[string]*cvg.Coverage
+	if err := json.Unmarshal(out, &cov); err != nil {
+		return fmt.Errorf("parsing coverage output: %s", err)
+	}
+
+	if failures := corpusCoverageFailures(cov, r.MinCoverage); len(failures) > 0 {
+		return fmt.Errorf("coverage below thresholds:\n  %s", strings.Join(failures, "\n  "))
+	}
+	return nil
+}
+
+// corpusCoverageFailures returns descriptions of the languages whose
+// coverage is below the minimum.
+func corpusCoverageFailures(cov, min map[string]*cvg.Coverage) []string {
+	if len(min) == 0 {
+		min = make(map[string]*cvg.Coverage, len(cov))
+		for lang := range cov {
+			min[lang] = defaultMinCoverage
+		}
+	}
+	langs := make([]string, 0, len(min))
+	for lang := range min {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+
+	var failures []string
+	for _, lang := range langs {
+		c := cov[lang]
+		if c == nil {
+			c = &cvg.Coverage{}
+		}
+		for _, below := range c.Below(min[lang]) {
+			failures = append(failures, lang+": "+below)
+		}
+	}
+	return failures
+}
+
+// runSrclib runs srclib with the given arguments in dir and returns
+// its stdout. Its stderr is only shown if it fails (or in verbose
+// mode).
+func runSrclib(dir string, args ...string) ([]byte, error) {
+	// srclib might be embedded as a sub-command in a host, such as
+	// the Sourcegraph app.
+	c := append(strings.Split(srclib.CommandName, " "), args...)
+	cmd := exec.Command(c[0], c[1:]...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	if GlobalOpt.Verbose {
+		cmd.Stderr = io.MultiWriter(&stderr, os.Stderr)
+	} else {
+		cmd.Stderr = &stderr
+	}
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("command %v in %s failed: %s\n\nOutput was:\n%s%s", cmd.Args, dir, err, stdout.String(), stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/cvg"
+)
+
+func TestCorpusCoverageFailures(t *testing.T) {
+	cov := map[string]*cvg.Coverage{
+		"Go":     {FileScore: 0.9, RefScore: 0.99, TokDensity: 2},
+		"Python": {FileScore: 0.5, RefScore: 0.99, TokDensity: 0.5},
+	}
+	tests := []struct {
+		min  map[string]*cvg.Coverage
+		want []string
+	}{
+		{
+			min:  nil,
+			want: []string{"Python: FileScore 0.500 < 0.800", "Python: TokDensity 0.500 < 1.000"},
+		},
+		{
+			min:  map[string]*cvg.Coverage{"Go": {FileScore: 0.95}, "Python": {RefScore: 0.9}},
+			want: []string{"Go: FileScore 0.900 < 0.950"},
+		},
+		{
+			min:  map[string]*cvg.Coverage{"Java": {FileScore: 0.5}},
+			want: []string{"Java: FileScore 0.000 < 0.500"},
+		},
+	}
+	for _, test := range tests {
+		if got := corpusCoverageFailures(cov, test.min); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("min %v: got %q, want %q", test.min, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// testNormalization configures how "srclib test" normalizes the
+// expected and actual outputs of a test case before comparing them,
+// so that differences that don't matter (such as the order of defs,
+// the platform's path separator, or the directory that the test case
+// is in) don't cause test failures.
+type testNormalization struct {
+	// Sort is whether to sort the elements of the arrays in
+	// sortedOutputKeys.
+	Sort bool
+
+	// Slashes is whether to convert backslashes to slashes in the
+	// values of the keys in pathOutputKeys.
+	Slashes bool
+
+	// AbsPaths maps absolute paths (such as the test case's tree) to
+	// the placeholders that replace them in all strings.
+	AbsPaths map[string]string
+
+	// Replace lists regexp replacements to apply to all strings.
+	Replace []testReplacement
+}
+
+// A testReplacement replaces matches of a regexp with a replacement
+// (which may refer to submatches, as in regexp.ReplaceAllString).
+type testReplacement struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+// parseTestReplacement parses a replacement of the form
+// "REGEXP=>REPL".
+func parseTestReplacement(s string) (testReplacement, error) {
+	i := strings.Index(s, "=>")
+	if i == -1 {
+		return testReplacement{}, fmt.Errorf("invalid replacement %q (expected REGEXP=>REPL)", s)
+	}
+	re, err := regexp.Compile(s[:i])
+	if err != nil {
+		return testReplacement{}, fmt.Errorf("invalid replacement %q: %s", s, err)
+	}
+	return testReplacement{re: re, repl: s[i+2:]}, nil
+}
+
+// sortedOutputKeys are the keys of the arrays in build data files
+// whose order is not significant.
+var sortedOutputKeys = map[string]bool{"Defs": true, "Refs": true, "Docs": true, "Anns": true, "Files": true}
+
+// pathOutputKeys are the keys in build data files whose values are
+// file paths (or arrays of file paths).
+var pathOutputKeys = map[string]bool{"File": true, "Files": true, "Dir": true}
+
+// normalizeTestOutput writes the files in the directory src to dst
+// (which may be the same directory), normalizing the JSON files. Other
+// files are copied unchanged.
+func normalizeTestOutput(src, dst string, opt testNormalization) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		dstPath := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(dstPath, 0755)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(path, ".json") {
+			if data, err = normalizeTestJSON(data, opt); err != nil {
+				return fmt.Errorf("normalizing %s: %s", path, err)
+			}
+		}
+		return ioutil.WriteFile(dstPath, data, 0644)
+	})
+}
+
+// normalizeTestJSON normalizes the JSON document data and returns it
+// indented, with object keys sorted.
+func normalizeTestJSON(data []byte, opt testNormalization) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	// Replace longer paths first, in case one contains another.
+	absPaths := make([]string, 0, len(opt.AbsPaths))
+	for p := range opt.AbsPaths {
+		absPaths = append(absPaths, p)
+	}
+	sort.Sort(sort.Reverse(byLen(absPaths)))
+
+	n := &testNormalizer{opt: opt, absPaths: absPaths}
+	v, err := n.value(v, "")
+	if err != nil {
+		return nil, err
+	}
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+type testNormalizer struct {
+	opt      testNormalization
+	absPaths []string
+}
+
+// value normalizes v, the value of key in the enclosing object (or
+// the key of the enclosing array).
+func (n *testNormalizer) value(v interface{}, key string) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return n.string(v, pathOutputKeys[key]), nil
+
+	case map[string]interface{}:
+		for k, e := range v {
+			e, err := n.value(e, k)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = e
+		}
+		return v, nil
+
+	case []interface{}:
+		for i, e := range v {
+			e, err := n.value(e, key)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = e
+		}
+		if n.opt.Sort && sortedOutputKeys[key] {
+			// Sort by each element's JSON encoding, which is
+			// deterministic since object keys are sorted.
+			keys := make([]string, len(v))
+			for i, e := range v {
+				b, err := json.Marshal(e)
+				if err != nil {
+					return nil, err
+				}
+				keys[i] = string(b)
+			}
+			sort.Sort(byKeys{keys, v})
+		}
+		return v, nil
+	}
+	return v, nil
+}
+
+func (n *testNormalizer) string(s string, isPath bool) string {
+	if isPath && n.opt.Slashes {
+		s = strings.Replace(s, `\`, "/", -1)
+	}
+	for _, p := range n.absPaths {
+		s = strings.Replace(s, p, n.opt.AbsPaths[p], -1)
+	}
+	for _, r := range n.opt.Replace {
+		s = r.re.ReplaceAllString(s, r.repl)
+	}
+	return s
+}
+
+type byLen []string
+
+func (v byLen) Len() int           { return len(v) }
+func (v byLen) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v byLen) Less(i, j int) bool { return len(v[i]) < len(v[j]) }
+
+// byKeys sorts vals by the corresponding keys.
+type byKeys struct {
+	keys []string
+	vals []interface{}
+}
+
+func (v byKeys) Len() int { return len(v.keys) }
+func (v byKeys) Swap(i, j int) {
+	v.keys[i], v.keys[j] = v.keys[j], v.keys[i]
+	v.vals[i], v.vals[j] = v.vals[j], v.vals[i]
+}
+func (v byKeys) Less(i, j int) bool { return v.keys[i] < v.keys[j] }
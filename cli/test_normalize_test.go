@@ -0,0 +1,81 @@
+package cli
+
+import "testing"
+
+func TestNormalizeTestJSON(t *testing.T) {
+	replace, err := parseTestReplacement(`go1\.\d+(\.\d+)?=>goX`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := testNormalization{
+		Sort:     true,
+		Slashes:  true,
+		AbsPaths: map[string]string{"/home/me/tree": "$TREE"},
+		Replace:  []testReplacement{replace},
+	}
+
+	input := `{
+  "Defs": [
+    {"Path": "b", "File": "pkg\\b.go", "Data": {"Version": "go1.5.2"}},
+    {"Path": "a", "File": "/home/me/tree/a.go", "DefStart": 12345678901}
+  ],
+  "Refs": [{"DefPath": "b"}, {"DefPath": "a"}],
+  "Other": ["z", "y"],
+  "Doc": "C:\\not\\a\\path"
+}`
+	want := `{
+  "Defs": [
+    {
+      "Data": {
+        "Version": "goX"
+      },
+      "File": "pkg/b.go",
+      "Path": "b"
+    },
+    {
+      "DefStart": 12345678901,
+      "File": "$TREE/a.go",
+      "Path": "a"
+    }
+  ],
+  "Doc": "C:\\not\\a\\path",
+  "Other": [
+    "z",
+    "y"
+  ],
+  "Refs": [
+    {
+      "DefPath": "a"
+    },
+    {
+      "DefPath": "b"
+    }
+  ]
+}
+`
+	got, err := normalizeTestJSON([]byte(input), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// Without normalizations, only the formatting changes.
+	got, err = normalizeTestJSON([]byte(`{"Refs": [{"File": "x\\y"}, {"File": "a"}]}`), testNormalization{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\n  \"Refs\": [\n    {\n      \"File\": \"x\\\\y\"\n    },\n    {\n      \"File\": \"a\"\n    }\n  ]\n}\n"; string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParseTestReplacement(t *testing.T) {
+	if _, err := parseTestReplacement("no-arrow"); err == nil {
+		t.Error("got nil error for replacement without =>, want error")
+	}
+	if _, err := parseTestReplacement("(=>x"); err == nil {
+		t.Error("got nil error for invalid regexp, want error")
+	}
+}
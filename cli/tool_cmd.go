@@ -1,13 +1,23 @@
 package cli
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
 	"sourcegraph.com/sourcegraph/go-flags"
 
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/scan"
 	"sourcegraph.com/sourcegraph/srclib/toolchain"
 )
 
@@ -26,6 +36,9 @@ func init() {
 }
 
 type ToolCmd struct {
+	Env []string `long:"env" description:"extra environment variable to set for the tool" value-name:"NAME=VALUE"`
+	Log string   `long:"log" description:"write a log of the tool's output, duration, and exit code to FILE (as JSON)" value-name:"FILE"`
+
 	Args struct {
 		Toolchain ToolchainPath `name:"TOOLCHAIN" description:"toolchain path of the toolchain to run"`
 		Tool      ToolName      `name:"TOOL" description:"tool subcommand name to run (in TOOLCHAIN)"`
@@ -36,6 +49,11 @@ type ToolCmd struct {
 var toolCmd ToolCmd
 
 func (c *ToolCmd) Execute(args []string) error {
+	if string(c.Args.Toolchain) == scan.BuiltinToolchain {
+		// Built-in tools are run in-process (and aren't logged).
+		return grapher.RunBuiltin(string(c.Args.Tool), os.Stdin, os.Stdout)
+	}
+
 	cmdName, err := toolchain.Command(string(c.Args.Toolchain))
 	if err != nil {
 		log.Fatal(err)
@@ -46,13 +64,142 @@ func (c *ToolCmd) Execute(args []string) error {
 		cmd.Args = append(cmd.Args, string(c.Args.Tool))
 		cmd.Args = append(cmd.Args, c.Args.ToolArgs...)
 	}
+	env := c.Env
+	var errorsFile string
+	if c.Log != "" {
+		// Give the tool a file to report structured errors in, and
+		// record them in its log.
+		f, err := ioutil.TempFile("", "srclib-tool-errors")
+		if err != nil {
+			return err
+		}
+		f.Close()
+		errorsFile = f.Name()
+		defer os.Remove(errorsFile)
+		env = append(env, toolchain.ErrorsFileEnv+"="+errorsFile)
+	}
+	if cmd.Env, err = toolchain.ToolEnv(string(c.Args.Toolchain), os.Environ(), env); err != nil {
+		return err
+	}
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if GlobalOpt.Verbose {
 		log.Printf("Running tool: %v", cmd.Args)
 	}
-	return cmd.Run()
+
+	// Under a memory budget, reserve the memory that the tool is
+	// expected to need, and kill it if it uses more than that plus the
+	// budget's slack (which would eat into the other tools'
+	// reservations).
+	run := func() (int64, error) { return 0, cmd.Run() }
+	if addr := os.Getenv(MemoryBudgetEnv); addr != "" {
+		mb := toolMemoryEstimate(string(c.Args.Toolchain), string(c.Args.Tool), c.Log)
+		slack, release, err := acquireMemory(addr, mb)
+		if err != nil {
+			return err
+		}
+		defer release()
+		run = func() (int64, error) { return runWithMemoryLimit(cmd, mb+slack) }
+	}
+
+	if c.Log == "" {
+		_, err := run()
+		return err
+	}
+
+	toolLog := &plan.ToolLog{
+		Toolchain: string(c.Args.Toolchain),
+		Tool:      string(c.Args.Tool),
+		Args:      c.Args.ToolArgs,
+		Start:     time.Now(),
+	}
+	stdout := &headWriter{max: maxLoggedStdout}
+	var stderr bytes.Buffer
+	cmd.Stdout = io.MultiWriter(os.Stdout, stdout)
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	maxRSS, runErr := run()
+	toolLog.MaxRSS = maxRSS
+	toolLog.Duration = time.Since(toolLog.Start)
+	toolLog.Stdout, toolLog.StdoutBytes = stdout.buf.String(), stdout.n
+	toolLog.Stderr = stderr.String()
+	toolLog.ExitCode = exitCode(runErr)
+	if toolLog.ExitCode != 0 && runErr != nil {
+		toolLog.Error = runErr.Error()
+	}
+	if toolLog.Errors, err = readToolErrors(errorsFile); err != nil {
+		log.Printf("Warning: couldn't read errors reported by %s %s: %s.", c.Args.Toolchain, c.Args.Tool, err)
+	}
+
+	// A failure to write the log shouldn't fail the tool run.
+	if err := writeToolLog(c.Log, toolLog); err != nil {
+		log.Printf("Warning: couldn't write tool log to %s: %s.", c.Log, err)
+	}
+	return runErr
+}
+
+// maxLoggedStdout is the maximum number of bytes of a tool's stdout
+// that are included in its log. The full output is usually stored as
+// build data anyway.
+const maxLoggedStdout = 4096
+
+// headWriter keeps the first max bytes written to it and counts the
+// rest.
+type headWriter struct {
+	buf bytes.Buffer
+	max int
+	n   int64
+}
+
+func (w *headWriter) Write(p []byte) (int, error) {
+	if rem := w.max - w.buf.Len(); rem > 0 {
+		if len(p) < rem {
+			rem = len(p)
+		}
+		w.buf.Write(p[:rem])
+	}
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// exitCode returns the exit code of a process that exited with err
+// (as returned by (*exec.Cmd).Run), or -1 if the process couldn't be
+// run or didn't exit normally.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Exited() {
+			return ws.ExitStatus()
+		}
+	}
+	return -1
+}
+
+// readToolErrors reads the structured errors that a tool wrote to
+// file (see toolchain.ErrorsFileEnv). If some of the file can't be
+// parsed, the errors before it are returned along with the error.
+func readToolErrors(file string) ([]*toolchain.ToolError, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return toolchain.ReadErrors(f)
+}
+
+func writeToolLog(file string, toolLog *plan.ToolLog) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(toolLog, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0600)
 }
 
 type ToolName string
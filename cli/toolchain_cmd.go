@@ -69,6 +69,19 @@ func init() {
 			log.Fatal(err)
 		}
 
+		_, err = c.AddCommand("add-lsp",
+			"create a toolchain that runs a language server",
+			`Creates a toolchain (in the first SRCLIBPATH entry) that scans and graphs the files of a language using a language server that speaks the Language Server Protocol (see "srclib lsp-adapter"). For example:
+
+  srclib toolchain add-lsp lsp/ruby --server "solargraph stdio" --unit-type RubyLSP --language-id ruby --ext .rb
+
+The toolchain's program runs "srclib lsp-adapter", so srclib must be in the PATH.`,
+			&toolchainAddLSPCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
 		_, err = c.AddCommand("install",
 			"install toolchains",
 			"Download and install toolchains",
@@ -298,6 +311,10 @@ func (c *ToolchainInstallCmd) Execute(args []string) error {
 		}
 		is = append(is, i)
 	}
+	// Installing a toolchain fetches its source and dependencies.
+	if err := srclib.CheckOnline("installing toolchains"); err != nil {
+		return err
+	}
 	return installToolchains(is)
 }
 
@@ -667,6 +684,10 @@ func cloneToolchain(destDir, cloneURI string) error {
 		return nil
 	}
 
+	if err := srclib.CheckOnline("downloading toolchain from " + cloneURI); err != nil {
+		return err
+	}
+
 	// Clone
 	if err := os.MkdirAll(filepath.Dir(destDir), 0700); err != nil {
 		return err
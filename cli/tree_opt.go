@@ -0,0 +1,181 @@
+package cli
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/srcfs"
+	"sourcegraph.com/sourcegraph/srclib/vcs"
+)
+
+// TreeOpt is embedded in commands that can analyze a source tree
+// that isn't checked out (see srcfs.Open), by materializing its files
+// into a directory and running there.
+type TreeOpt struct {
+	Tree      string   `long:"tree" description:"analyze this source tree without checking it out: a revision of a git repository (which may be bare), or a .zip, .tar, .tar.gz, or .tgz archive" value-name:"DIR@REV|ARCHIVE"`
+	TreeDir   string   `long:"tree-dir" description:"materialize the --tree's files into this directory (default: a directory in the system's temporary directory that is reused for the same tree)" value-name:"DIR"`
+	TreePaths []string `long:"tree-path" description:"only materialize the --tree's files in this directory (and its top-level files); may be repeated" value-name:"DIR"`
+}
+
+// useTree materializes the files of o.Tree (or, if o.TreePaths are
+// given, only the files in them and the tree's top-level files and
+// .srclib directory) into a directory and changes to it. The
+// directory's previous contents, other than its build data, are
+// removed. The directory is recognized as a tree (see vcs.Tree) whose
+// commit ID is the git commit's or a hash of the archive.
+func (o *TreeOpt) useTree() error {
+	fs, err := srcfs.Open(o.Tree)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	info := &vcs.TreeInfo{Source: o.Tree}
+	switch fs := fs.(type) {
+	case *srcfs.GitFS:
+		info.CommitID = fs.CommitID
+		if info.GitDir, err = filepath.Abs(fs.Dir); err != nil {
+			return err
+		}
+	default:
+		if fi, err := os.Stat(o.Tree); err == nil && fi.IsDir() {
+			return fmt.Errorf("--tree %s is a directory; run srclib in it instead (or give a revision: %s@REV)", o.Tree, o.Tree)
+		}
+		if info.CommitID, err = fileSHA1(o.Tree); err != nil {
+			return err
+		}
+	}
+
+	dir := o.TreeDir
+	if dir == "" {
+		abs, err := filepath.Abs(o.Tree)
+		if err != nil {
+			return err
+		}
+		sum := sha1.Sum([]byte(abs))
+		dir = filepath.Join(os.TempDir(), "srclib-tree-"+hex.EncodeToString(sum[:6]))
+	}
+	if err := cleanTreeDir(dir); err != nil {
+		return err
+	}
+
+	files, err := treeFiles(fs, o.TreePaths)
+	if err != nil {
+		return err
+	}
+	if err := srcfs.Materialize(fs, dir, files); err != nil {
+		return err
+	}
+	if err := vcs.WriteTreeInfo(dir, info); err != nil {
+		return err
+	}
+	if GlobalOpt.Verbose {
+		log.Printf("Materialized %d files of %s into %s", len(files), fs, dir)
+	}
+
+	if err := os.Chdir(dir); err != nil {
+		return err
+	}
+	// The current directory's repository may have been opened (and
+	// cached) already.
+	localRepo, localRepoErr = nil, nil
+	_, err = srclib.UseProjectToolchains(".")
+	return err
+}
+
+// cleanTreeDir creates dir, or removes its contents other than its
+// build data directory.
+func cleanTreeDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		if fi.Name() == buildstore.BuildDataDirName {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, fi.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// treeFiles returns the files (and symbolic links) in fs to
+// materialize: all of them if paths is empty, or else the ones in the
+// directories paths and the top-level files and .srclib directory.
+func treeFiles(fs srcfs.FileSystem, paths []string) ([]string, error) {
+	roots := []string{"."}
+	if len(paths) > 0 {
+		roots = []string{".srclib"}
+		for _, p := range paths {
+			roots = append(roots, path.Clean(filepath.ToSlash(p)))
+		}
+	}
+
+	var files []string
+	seen := map[string]bool{}
+	for _, root := range roots {
+		if _, err := fs.Lstat(root); os.IsNotExist(err) && root == ".srclib" {
+			continue
+		}
+		err := srcfs.Walk(fs, root, func(name string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if name == buildstore.BuildDataDirName || name == vcs.TreeInfoFile {
+				if fi.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !fi.IsDir() && !seen[name] {
+				seen[name] = true
+				files = append(files, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(paths) > 0 {
+		fis, err := fs.ReadDir(".")
+		if err != nil {
+			return nil, err
+		}
+		for _, fi := range fis {
+			if name := fi.Name(); !fi.IsDir() && !seen[name] && name != vcs.TreeInfoFile {
+				seen[name] = true
+				files = append(files, name)
+			}
+		}
+	}
+	return files, nil
+}
+
+// fileSHA1 returns the hex SHA-1 hash of the contents of file.
+func fileSHA1(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/srcfs"
+)
+
+func TestTreeFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-tree-files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"Srcfile", "go.mod", ".srclib/toolchains/t/x", "a/a.go", "a/b/b.go", "c/c.go", ".srclib-cache/c/d.json"} {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs := srcfs.OS(dir)
+
+	files, err := treeFiles(fs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{".srclib/toolchains/t/x", "Srcfile", "a/a.go", "a/b/b.go", "c/c.go", "go.mod"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("got files %v, want %v", files, want)
+	}
+
+	files, err = treeFiles(fs, []string{"a/b/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{".srclib/toolchains/t/x", "a/b/b.go", "Srcfile", "go.mod"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("got files %v with --tree-path, want %v", files, want)
+	}
+
+	if _, err := treeFiles(fs, []string{"nope"}); err == nil {
+		t.Error("got no error for a missing --tree-path")
+	}
+}
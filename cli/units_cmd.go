@@ -1,7 +1,9 @@
 package cli
 
 import (
+	"fmt"
 	"log"
+	"os"
 	"path/filepath"
 
 	"strings"
@@ -9,9 +11,9 @@ import (
 	"github.com/alexsaveliev/go-colorable-wrapper"
 	"sourcegraph.com/sourcegraph/go-flags"
 
+	"sourcegraph.com/sourcegraph/srclib/approx"
 	"sourcegraph.com/sourcegraph/srclib/config"
 	"sourcegraph.com/sourcegraph/srclib/scan"
-	"sourcegraph.com/sourcegraph/srclib/toolchain"
 	"sourcegraph.com/sourcegraph/srclib/unit"
 )
 
@@ -19,7 +21,9 @@ func init() {
 	cliInit = append(cliInit, func(cli *flags.Command) {
 		_, err := cli.AddCommand("units",
 			"lists source units",
-			`Lists source units in the repository or directory tree rooted at DIR (or the current directory if DIR is not specified).`,
+			`Lists source units in the repository or directory tree rooted at DIR (or the current directory if DIR is not specified).
+
+The --lang, --type, --changed-since, and --path-prefix options select a subset of the units; a unit is listed only if it matches all of them. With --format=ids, the IDs of the selected units are printed one per line, for use in scripts.`,
 			&unitsCmd,
 		)
 		if err != nil {
@@ -30,20 +34,21 @@ func init() {
 
 // scanUnitsIntoConfig uses cfg to scan for source units. It modifies
 // cfg.SourceUnits, merging the scanned source units with those already present
-// in cfg.
-func scanUnitsIntoConfig(cfg *config.Repository, quiet bool) error {
+// in cfg. It returns the files that were removed from the units because
+// they were too large or binary (see (*config.Tree).SkipFiles).
+func scanUnitsIntoConfig(cfg *config.Repository, quiet bool) ([]*config.SkippedFile, error) {
 	scanners := make([][]string, len(cfg.Scanners))
 	for i, scannerRef := range cfg.Scanners {
-		cmdName, err := toolchain.Command(scannerRef.Toolchain)
+		cmd, err := scan.Command(scannerRef)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		scanners[i] = []string{cmdName, scannerRef.Subcmd}
+		scanners[i] = cmd
 	}
 
-	units, err := scan.ScanMulti(scanners, scan.Options{Quiet: quiet}, cfg.Config)
+	units, err := scan.ScanMulti(scanners, scan.Options{Quiet: quiet, Symlinks: cfg.SymlinkPolicy()}, cfg.Config)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Merge the repo/tree config with each source unit's config.
@@ -72,7 +77,7 @@ func scanUnitsIntoConfig(cfg *config.Repository, quiet bool) error {
 
 		xf, err := unit.ExpandPaths(".", u.Files)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		u.Files = xf
 	}
@@ -108,14 +113,51 @@ func scanUnitsIntoConfig(cfg *config.Repository, quiet bool) error {
 		cfg.SourceUnits = append(cfg.SourceUnits, u)
 	}
 
-	return nil
+	// Approximate units are only for languages that no other units
+	// (and so no installed toolchain) analyze.
+	cfg.SourceUnits = approx.RemoveAnalyzed(cfg.SourceUnits)
+
+	codeOwners, err := config.ReadCodeOwners(".")
+	if err != nil {
+		return nil, err
+	}
+	var skipped []*config.SkippedFile
+	for _, u := range cfg.SourceUnits {
+		codeOwners.SetUnitOwners(u)
+		cfg.ApplyRepoTags(u)
+		cfg.ApplyUnitOverrides(u)
+		if err := cfg.ApplySymlinkPolicy(".", u); err != nil {
+			return nil, fmt.Errorf("source unit %s %s: %s", u.Type, u.Name, err)
+		}
+		s, err := cfg.SkipFiles(".", u)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range s {
+			log.Printf("Warning: skipping %s file %s (%s) in source unit %s %s.", f.Reason, f.File, bytesString(uint64(f.Size)), u.Type, u.Name)
+		}
+		skipped = append(skipped, s...)
+		cfg.TagTestUnit(u)
+	}
+
+	return skipped, nil
 }
 
 type UnitsCmd struct {
 	Output struct {
-		Output string `short:"o" long:"output" description:"output format" default:"text" value-name:"text|json"`
+		Format string `long:"format" description:"output format" default:"table" value-name:"table|json|ids"`
+		Output string `short:"o" long:"output" description:"output format (deprecated: use --format)" value-name:"text|json"`
 	} `group:"output"`
 
+	Filter struct {
+		Lang         []string `long:"lang" description:"only list units containing files in this language (e.g., Go); may be repeated" value-name:"LANG"`
+		Type         []string `long:"type" description:"only list units of this type (e.g., GoPackage); may be repeated" value-name:"TYPE"`
+		ChangedSince string   `long:"changed-since" description:"only list units containing files that changed between this commit and the current commit" value-name:"COMMIT"`
+		PathPrefix   []string `long:"path-prefix" description:"only list units whose directory is in this path; may be repeated" value-name:"PATH"`
+	} `group:"filter"`
+
+	Profile string `long:"profile" description:"apply the named profile from the Srcfile (default: $SRCLIB_PROFILE)" value-name:"NAME"`
+
 	Args struct {
 		Dir Directory `name:"DIR" default:"." description:"root directory of tree to list units in"`
 	} `positional-args:"yes"`
@@ -124,26 +166,153 @@ type UnitsCmd struct {
 var unitsCmd UnitsCmd
 
 func (c *UnitsCmd) Execute(args []string) error {
-	cfg, err := getInitialConfig(c.Args.Dir.String())
+	cfg, err := getInitialConfig(c.Args.Dir.String(), profileName(c.Profile))
 	if err != nil {
 		return err
 	}
 
-	if err := scanUnitsIntoConfig(cfg, false); err != nil {
+	if _, err := scanUnitsIntoConfig(cfg, false); err != nil {
 		return err
 	}
 
-	if c.Output.Output == "json" {
-		PrintJSON(cfg.SourceUnits, "")
-	} else {
-		for _, u := range cfg.SourceUnits {
+	sel := unitSelector{Langs: c.Filter.Lang, Types: c.Filter.Type, PathPrefixes: c.Filter.PathPrefix}
+	if c.Filter.ChangedSince != "" {
+		sel.ChangedFiles, err = changedFilesSince(c.Args.Dir.String(), c.Filter.ChangedSince)
+		if err != nil {
+			return err
+		}
+	}
+	units := sel.selectUnits(cfg.SourceUnits)
+
+	format := c.Output.Format
+	switch c.Output.Output {
+	case "":
+	case "text":
+		format = "table"
+	default:
+		format = c.Output.Output
+	}
+	switch format {
+	case "json":
+		PrintJSON(units, "")
+	case "ids":
+		for _, u := range units {
+			fmt.Println(u.ID())
+		}
+	case "table":
+		for _, u := range units {
 			colorable.Printf("%-50s  %s\n", u.Name, u.Type)
 		}
+	default:
+		return fmt.Errorf("unknown output format %q (expected table, json, or ids)", format)
 	}
 
 	return nil
 }
 
+// A unitSelector selects source units by their name, language, type,
+// directory, or files. Empty criteria match all units.
+type unitSelector struct {
+	Names        []string // unit names
+	Langs        []string // languages (as in coverage stats) of any of the unit's files
+	Types        []string // unit types
+	PathPrefixes []string // directories containing the unit's directory
+
+	// ChangedFiles, if non-nil, selects units containing any of
+	// these files.
+	ChangedFiles []string
+}
+
+// selectUnits returns the units that match all of s's criteria.
+func (s *unitSelector) selectUnits(units []*unit.SourceUnit) []*unit.SourceUnit {
+	var sel []*unit.SourceUnit
+	for _, u := range units {
+		if s.matches(u) {
+			sel = append(sel, u)
+		}
+	}
+	return sel
+}
+
+func (s *unitSelector) matches(u *unit.SourceUnit) bool {
+	if len(s.Names) > 0 && !contains(s.Names, u.Name) {
+		return false
+	}
+	if len(s.Types) > 0 && !containsFold(s.Types, u.Type) {
+		return false
+	}
+	if len(s.Langs) > 0 {
+		match := false
+		for _, f := range u.Files {
+			if lang, ok := extToLang[strings.ToLower(filepath.Ext(f))]; ok && containsFold(s.Langs, lang) {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	if len(s.PathPrefixes) > 0 {
+		unitDir := u.Dir
+		if unitDir == "" && len(u.Files) > 0 {
+			unitDir = filepath.Dir(u.Files[0])
+		}
+		if !pathHasAnyPrefix(unitDir, s.PathPrefixes) {
+			return false
+		}
+	}
+	if s.ChangedFiles != nil && !u.ContainsAny(s.ChangedFiles) {
+		return false
+	}
+	return true
+}
+
+func contains(ss []string, s string) bool {
+	for _, t := range ss {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(ss []string, s string) bool {
+	for _, t := range ss {
+		if strings.EqualFold(t, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// changedFilesSince returns the files (relative to the current
+// directory, like source unit files) that changed between the base
+// commit and the current commit of the repository containing dir.
+func changedFilesSince(dir, base string) ([]string, error) {
+	repo, err := OpenRepo(dir)
+	if err != nil {
+		return nil, err
+	}
+	files, err := repo.VCS.ChangedFiles(repo.RootDir, base, repo.CommitID)
+	if err != nil {
+		return nil, fmt.Errorf("listing files changed since %s: %s", base, err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	changed := make([]string, 0, len(files))
+	for _, f := range files {
+		rel, err := filepath.Rel(cwd, filepath.Join(repo.RootDir, filepath.FromSlash(f)))
+		if err != nil {
+			return nil, err
+		}
+		changed = append(changed, filepath.ToSlash(rel))
+	}
+	return changed, nil
+}
+
 func pathHasAnyPrefix(path string, prefixes []string) bool {
 	for _, prefix := range prefixes {
 		if pathHasPrefix(path, prefix) {
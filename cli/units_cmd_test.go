@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestUnitSelector(t *testing.T) {
+	units := []*unit.SourceUnit{
+		{Key: unit.Key{Name: "a", Type: "GoPackage"}, Info: unit.Info{Dir: "cmd/a", Files: []string{"cmd/a/a.go"}}},
+		{Key: unit.Key{Name: "b", Type: "GoPackage"}, Info: unit.Info{Files: []string{"lib/b/b.go", "lib/b/b_test.go"}}},
+		{Key: unit.Key{Name: "c", Type: "PipPackage"}, Info: unit.Info{Dir: "py/c", Files: []string{"py/c/setup.py"}}},
+	}
+
+	tests := []struct {
+		sel  unitSelector
+		want []string
+	}{
+		{unitSelector{}, []string{"a", "b", "c"}},
+		{unitSelector{Langs: []string{"go"}}, []string{"a", "b"}},
+		{unitSelector{Langs: []string{"Python", "Ruby"}}, []string{"c"}},
+		{unitSelector{Types: []string{"PipPackage"}}, []string{"c"}},
+		{unitSelector{PathPrefixes: []string{"lib"}}, []string{"b"}},
+		{unitSelector{PathPrefixes: []string{"cmd/"}, Types: []string{"PipPackage"}}, nil},
+		{unitSelector{ChangedFiles: []string{}}, nil},
+		{unitSelector{ChangedFiles: []string{"lib/b/b_test.go", "README"}}, []string{"b"}},
+		{unitSelector{Names: []string{"a", "c"}}, []string{"a", "c"}},
+		{unitSelector{Names: []string{"A"}}, nil},
+		{*(&OnlyUnitsOpt{OnlyTypes: []string{"GoPackage"}, OnlyLangs: []string{"Go"}}).selector(), []string{"a", "b"}},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, u := range test.sel.selectUnits(units) {
+			got = append(got, u.Name)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%+v: got units %v, want %v", test.sel, got, test.want)
+		}
+	}
+}
+
+func TestOnlyUnitsOpt_selector(t *testing.T) {
+	if sel := (&OnlyUnitsOpt{}).selector(); sel != nil {
+		t.Errorf("got selector %+v for no filters, want nil", sel)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math"
 	"os"
@@ -25,6 +26,16 @@ func (w nopWriteCloser) Close() error {
 	return nil
 }
 
+// stdWriteCloser is a writer (such as os.Stdout) that must not be
+// closed, so Close does nothing.
+type stdWriteCloser struct {
+	io.Writer
+}
+
+func (w stdWriteCloser) Close() error {
+	return nil
+}
+
 func isDir(dir string) bool {
 	di, err := os.Stat(dir)
 	return err == nil && di.IsDir()
@@ -0,0 +1,305 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"sourcegraph.com/sourcegraph/go-flags"
+
+	"sourcegraph.com/sourcegraph/makex"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/dep"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func init() {
+	cliInit = append(cliInit, func(cli *flags.Command) {
+		_, err := cli.AddCommand("worker",
+			"run build rules for remote 'srclib make' schedulers",
+			`Serves requests from "srclib make --scheduler" to execute individual source unit rules (graphing a unit or resolving its dependencies). The protocol is gRPC (the srclib.Worker service, whose messages are JSON-encoded), optionally over TLS.
+
+Each request (a stream) names the operation and ships the source unit, the settings that its rule depends on (such as the test file patterns), the unit's files, and the rule's prerequisite build data files. The worker writes the files to a temporary directory, makes the rule itself (choosing this machine's installed tool for the unit's type, which should be the same version as the scheduler's), runs it there, and sends back the files that it created (the rule's build data and logs). Requests never contain commands to run.
+
+Schedulers must authenticate: with a shared token, which both the worker and "srclib make" read from $`+WorkerTokenEnv+`, or with a TLS client certificate signed by a CA in the --tls-client-ca file. The worker refuses to start without one of them. By default, it only accepts connections from the local machine; use --listen to accept others.`,
+			&workerCmd,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	})
+}
+
+// WorkerTokenEnv is the name of the environment variable that holds
+// the shared token with which "srclib make --scheduler" authenticates
+// to "srclib worker".
+const WorkerTokenEnv = "SRCLIB_WORKER_TOKEN"
+
+type WorkerCmd struct {
+	Listen string `long:"listen" description:"accept connections on this TCP address" default:"127.0.0.1:7011" value-name:"ADDR"`
+	Jobs   int    `short:"j" long:"jobs" description:"maximum number of rules to run at once" default:"1" value-name:"N"`
+
+	TLSCert     string `long:"tls-cert" description:"serve over TLS with the PEM certificate in this file (requires --tls-key)" value-name:"FILE"`
+	TLSKey      string `long:"tls-key" description:"PEM private key of the --tls-cert certificate" value-name:"FILE"`
+	TLSClientCA string `long:"tls-client-ca" description:"require TLS client certificates signed by a CA in this PEM file" value-name:"FILE"`
+}
+
+var workerCmd WorkerCmd
+
+func (c *WorkerCmd) Execute(args []string) error {
+	if c.Jobs <= 0 {
+		return errors.New("-j/--jobs must be > 0")
+	}
+	var tlsConfig *tls.Config
+	if c.TLSCert != "" || c.TLSKey != "" {
+		if c.TLSCert == "" || c.TLSKey == "" {
+			return errors.New("--tls-cert and --tls-key must be given together")
+		}
+		var err error
+		if tlsConfig, err = apiTLSConfig(c.TLSCert, c.TLSKey, c.TLSClientCA); err != nil {
+			return err
+		}
+	} else if c.TLSClientCA != "" {
+		return errors.New("--tls-client-ca requires --tls-cert and --tls-key")
+	}
+	token := os.Getenv(WorkerTokenEnv)
+	if token == "" && c.TLSClientCA == "" {
+		return fmt.Errorf("refusing to serve unauthenticated requests: set $%s to a shared token, or require TLS client certificates with --tls-client-ca", WorkerTokenEnv)
+	}
+
+	opts := []grpc.ServerOption{grpc.CustomCodec(workerCodec{})}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	srv := grpc.NewServer(opts...)
+	srv.RegisterService(&workerServiceDesc, newWorkerService(c.Jobs, token))
+	l, err := net.Listen("tcp", c.Listen)
+	if err != nil {
+		return err
+	}
+	log.Printf("Serving build rules on %s (%d at a time)", l.Addr(), c.Jobs)
+	return srv.Serve(l)
+}
+
+// Worker operations (see WorkerJob's Op).
+const (
+	workerGraphOp      = "graph"
+	workerDepresolveOp = "depresolve"
+)
+
+// WorkerJob is a rule for a worker to execute (the request of the
+// srclib.Worker service's Run method; see workerMessage). The worker makes the rule itself from these
+// parts (see workerRule); it runs no commands that it is sent.
+type WorkerJob struct {
+	// Token is the scheduler's shared token (see WorkerTokenEnv).
+	Token string
+
+	// Op is the rule's operation: "graph" or "depresolve".
+	Op string
+
+	// DataDir is the build data directory (relative to the
+	// repository root) that the rule writes to.
+	DataDir string
+
+	// Unit is the source unit that the rule operates on.
+	Unit *unit.SourceUnit
+
+	// PostProcessors, TestFiles, and DepGraphFiles are the fields of
+	// the same names of a "graph" rule (see grapher.GraphUnitRule).
+	PostProcessors []*srclib.ToolRef
+	TestFiles      []string
+	DepGraphFiles  []string
+
+	// Files are the contents of the files (keyed by slash-separated
+	// path relative to the repository root) that the rule reads.
+	Files map[string][]byte
+}
+
+// WorkerResult is the result of the srclib.Worker service's Run
+// method.
+type WorkerResult struct {
+	// Files are the contents of the files that the rule's recipes
+	// created, keyed as in WorkerJob.Files.
+	Files map[string][]byte
+
+	// Output is the recipes' combined standard output and error.
+	Output []byte
+}
+
+// WorkerService implements the srclib.Worker gRPC service of "srclib
+// worker" (see workerServiceDesc).
+type WorkerService struct {
+	sem   chan struct{}
+	token string // if empty, clients are authenticated by TLS
+
+	// rule makes the rule to run for a job (workerRule, except in
+	// tests).
+	rule func(*WorkerJob) (makex.Rule, error)
+}
+
+func newWorkerService(jobs int, token string) *WorkerService {
+	return &WorkerService{sem: make(chan struct{}, jobs), token: token, rule: workerRule}
+}
+
+var errWorkerBadToken = errors.New("invalid worker token")
+
+// authenticate returns an error if token is not the worker's shared
+// token (if it has one).
+func (s *WorkerService) authenticate(token string) error {
+	if s.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		log.Printf("Rejected a job with an invalid token")
+		return errWorkerBadToken
+	}
+	return nil
+}
+
+// Run executes the rule in job.
+func (s *WorkerService) Run(job *WorkerJob) (*WorkerResult, error) {
+	if err := s.authenticate(job.Token); err != nil {
+		return nil, err
+	}
+	rule, err := s.rule(job)
+	if err != nil {
+		return nil, err
+	}
+
+	s.sem <- struct{}{}
+	defer func() { <-s.sem }()
+
+	dir, err := ioutil.TempDir("", "srclib-worker")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	res, err := runWorkerJob(dir, job, rule)
+	if err != nil {
+		log.Printf("Failed to build %s: %s", rule.Target(), err)
+		return nil, err
+	}
+	log.Printf("Built %s", rule.Target())
+	return res, nil
+}
+
+// workerRule makes the rule that job describes, choosing the
+// installed tools to run.
+func workerRule(job *WorkerJob) (makex.Rule, error) {
+	if job.Unit == nil {
+		return nil, errors.New("job has no source unit")
+	}
+	if err := checkRelPath(job.DataDir); err != nil {
+		return nil, err
+	}
+	for _, name := range job.DepGraphFiles {
+		if err := checkRelPath(name); err != nil {
+			return nil, err
+		}
+	}
+	switch job.Op {
+	case workerGraphOp:
+		return grapher.NewGraphUnitRule(job.DataDir, job.Unit, job.PostProcessors, job.TestFiles, job.DepGraphFiles)
+	case workerDepresolveOp:
+		return dep.NewResolveDepsRule(job.DataDir, job.Unit)
+	}
+	return nil, fmt.Errorf("unknown worker operation %q", job.Op)
+}
+
+// runWorkerJob writes job's files to dir, runs rule's recipes there,
+// and returns the files that they created.
+func runWorkerJob(dir string, job *WorkerJob, rule makex.Rule) (*WorkerResult, error) {
+	for name, data := range job.Files {
+		if err := checkRelPath(name); err != nil {
+			return nil, err
+		}
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(file, data, 0600); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkRelPath(rule.Target()); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, filepath.FromSlash(path.Dir(rule.Target()))), 0700); err != nil {
+		return nil, err
+	}
+
+	var output bytes.Buffer
+	for _, recipe := range rule.Recipes() {
+		recipe = expandAutoVars(recipe, rule)
+		cmd := exec.Command("sh", "-c", recipe)
+		cmd.Dir = dir
+		cmd.Stdout, cmd.Stderr = &output, &output
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("recipe %q failed: %s\n%s", recipe, err, output.Bytes())
+		}
+	}
+
+	res := &WorkerResult{Files: map[string][]byte{}, Output: output.Bytes()}
+	err := filepath.Walk(dir, func(file string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if _, shipped := job.Files[name]; shipped {
+			return nil
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		res.Files[name] = data
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// expandAutoVars expands the automatic variables $@ (the target), $<
+// (the first prerequisite), and $^ (all prerequisites) in a recipe of
+// rule, as makex does, but quoting each file name for sh.
+func expandAutoVars(recipe string, rule makex.Rule) string {
+	prereqs := rule.Prereqs()
+	quoted := make([]string, len(prereqs))
+	for i, p := range prereqs {
+		quoted[i] = plan.ShellQuote(p)
+	}
+	var first string
+	if len(quoted) > 0 {
+		first = quoted[0]
+	}
+	return strings.NewReplacer("$@", plan.ShellQuote(rule.Target()), "$<", first, "$^", strings.Join(quoted, " ")).Replace(recipe)
+}
+
+// checkRelPath returns an error if name (a slash-separated path) is
+// not relative to, and inside, the directory that it's resolved
+// against.
+func checkRelPath(name string) error {
+	clean := path.Clean(name)
+	if name == "" || path.IsAbs(clean) || filepath.IsAbs(name) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("invalid path %q (must be relative and not contain '..')", name)
+	}
+	return nil
+}
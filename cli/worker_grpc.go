@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// workerServiceName is the name of the gRPC service that "srclib
+// worker" serves.
+const workerServiceName = "srclib.Worker"
+
+// workerCodec encodes the messages of the worker service as JSON, as
+// srclib encodes source units and build data elsewhere. (The messages
+// are Go structs, not protobuf messages.)
+type workerCodec struct{}
+
+func (workerCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (workerCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (workerCodec) String() string                             { return "json" }
+
+// workerChunkSize is the maximum number of bytes of a file that are
+// sent in a single message, to stay well below gRPC's default
+// message size limit.
+const workerChunkSize = 1 << 20
+
+// A workerMessage is a message of the worker service's Run stream.
+// The scheduler sends the job (without its Files), then the job's
+// files; the worker replies with the files that the rule created, then
+// the recipes' output.
+type workerMessage struct {
+	Job *WorkerJob `json:",omitempty"`
+
+	// File and Data are a chunk of a file (keyed as in
+	// WorkerJob.Files). Larger files are sent in consecutive chunks.
+	File string `json:",omitempty"`
+	Data []byte `json:",omitempty"`
+
+	// Output is the recipes' output (see WorkerResult.Output).
+	Output []byte `json:",omitempty"`
+}
+
+// workerServer is the interface of the implementation of the worker
+// service (see WorkerService).
+type workerServer interface {
+	authenticate(token string) error
+	Run(*WorkerJob) (*WorkerResult, error)
+}
+
+var workerServiceDesc = grpc.ServiceDesc{
+	ServiceName: workerServiceName,
+	HandlerType: (*workerServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Run",
+			Handler:       serveWorkerRun,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+}
+
+// serveWorkerRun serves a Run stream: it receives the job and its
+// files, runs it, and sends back the result.
+func serveWorkerRun(srv interface{}, stream grpc.ServerStream) error {
+	s := srv.(workerServer)
+	var first workerMessage
+	if err := stream.RecvMsg(&first); err != nil {
+		return err
+	}
+	job := first.Job
+	if job == nil {
+		return grpc.Errorf(codes.InvalidArgument, "the first message must contain the job")
+	}
+	// Authenticate before accepting any files.
+	if err := s.authenticate(job.Token); err != nil {
+		return grpc.Errorf(codes.Unauthenticated, "%s", err)
+	}
+	job.Files = map[string][]byte{}
+	for {
+		var m workerMessage
+		err := stream.RecvMsg(&m)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		job.Files[m.File] = append(job.Files[m.File], m.Data...)
+	}
+
+	res, err := s.Run(job)
+	if err != nil {
+		return err
+	}
+	if err := sendWorkerFiles(stream, res.Files); err != nil {
+		return err
+	}
+	return stream.SendMsg(&workerMessage{Output: res.Output})
+}
+
+// callWorker runs job on the worker that cc is connected to.
+func callWorker(ctx context.Context, cc *grpc.ClientConn, job *WorkerJob) (*WorkerResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := grpc.NewClientStream(ctx, &workerServiceDesc.Streams[0], cc, "/"+workerServiceName+"/Run")
+	if err != nil {
+		return nil, err
+	}
+
+	err = func() error {
+		head := *job
+		head.Files = nil
+		if err := stream.SendMsg(&workerMessage{Job: &head}); err != nil {
+			return err
+		}
+		if err := sendWorkerFiles(stream, job.Files); err != nil {
+			return err
+		}
+		return stream.CloseSend()
+	}()
+	// If the worker ended the stream early (e.g., rejecting the
+	// token), its error is received below.
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	res := &WorkerResult{Files: map[string][]byte{}}
+	for {
+		var m workerMessage
+		err := stream.RecvMsg(&m)
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if m.File != "" {
+			res.Files[m.File] = append(res.Files[m.File], m.Data...)
+		}
+		if m.Output != nil {
+			res.Output = m.Output
+		}
+	}
+}
+
+// sendWorkerFiles sends files on stream in chunks, in order of their
+// names.
+func sendWorkerFiles(stream interface {
+	SendMsg(interface{}) error
+}, files map[string][]byte) error {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data := files[name]
+		for first := true; first || len(data) > 0; first = false {
+			n := len(data)
+			if n > workerChunkSize {
+				n = workerChunkSize
+			}
+			if err := stream.SendMsg(&workerMessage{File: name, Data: data[:n]}); err != nil {
+				return err
+			}
+			data = data[n:]
+		}
+	}
+	return nil
+}
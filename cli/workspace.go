@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/alexsaveliev/go-colorable-wrapper"
+
+	"sourcegraph.com/sourcegraph/srclib/config"
+)
+
+// WorkspaceOpt is embedded in commands that can operate on all of the
+// repositories in a workspace (see config.Workspace).
+type WorkspaceOpt struct {
+	Workspace string `long:"workspace" description:"run the command in each repository listed in this workspace file and aggregate the results" value-name:"FILE"`
+}
+
+// workspaceRepoLabel returns the name of r in aggregated output: its
+// URI if the workspace specifies one, or else its path relative to the
+// workspace file's directory.
+func workspaceRepoLabel(w *config.Workspace, r *config.WorkspaceRepo) string {
+	if r.URI != "" {
+		return r.URI
+	}
+	if rel, err := filepath.Rel(filepath.Dir(w.File), r.Path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return r.Path
+}
+
+// workspaceArgs returns args (the srclib process's arguments, without
+// the program name) with the --workspace flag removed, so that the
+// same command can be run in each of the workspace's repositories.
+func workspaceArgs(args []string) []string {
+	var out []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--":
+			return append(out, args[i:]...)
+		case args[i] == "--workspace":
+			i++ // skip the value
+		case strings.HasPrefix(args[i], "--workspace="):
+		default:
+			out = append(out, args[i])
+		}
+	}
+	return out
+}
+
+// workspaceRepoCmd returns a command that runs this srclib process's
+// command (without --workspace) in the workspace repository r. If
+// r.URI is set, it is used as the repository's clone URL.
+func workspaceRepoCmd(r *config.WorkspaceRepo) *exec.Cmd {
+	prog := os.Args[0]
+	if strings.ContainsRune(prog, filepath.Separator) {
+		if abs, err := filepath.Abs(prog); err == nil {
+			prog = abs
+		}
+	}
+	cmd := exec.Command(prog, workspaceArgs(os.Args[1:])...)
+	cmd.Dir = r.Path
+	cmd.Env = os.Environ()
+	if r.URI != "" {
+		cmd.Env = append(cmd.Env, "SRCLIB_CLONE_URL="+r.URI)
+	}
+	return cmd
+}
+
+// runInWorkspace runs this srclib process's command in each
+// repository in the workspace file, in order, with their output
+// passed through, and reports which of them failed.
+func runInWorkspace(file string) error {
+	return forEachWorkspaceRepo(file, func(w *config.Workspace, r *config.WorkspaceRepo) error {
+		cmd := workspaceRepoCmd(r)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	})
+}
+
+// outputInWorkspace runs this srclib process's command in each
+// repository in the workspace file and returns the standard output of
+// each successful run, keyed by the repository's label (see
+// workspaceRepoLabel).
+func outputInWorkspace(file string) (map[string][]byte, error) {
+	outputs := map[string][]byte{}
+	err := forEachWorkspaceRepo(file, func(w *config.Workspace, r *config.WorkspaceRepo) error {
+		var stdout, stderr bytes.Buffer
+		cmd := workspaceRepoCmd(r)
+		cmd.Stdout = &stdout
+		if GlobalOpt.Verbose {
+			cmd.Stderr = io.MultiWriter(&stderr, os.Stderr)
+		} else {
+			cmd.Stderr = &stderr
+		}
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s\n\nOutput was:\n%s", err, stderr.String())
+		}
+		outputs[workspaceRepoLabel(w, r)] = stdout.Bytes()
+		return nil
+	})
+	return outputs, err
+}
+
+// forEachWorkspaceRepo calls f for each repository in the workspace
+// file, in order. A failure in one repository doesn't stop the others
+// from being processed; the returned error lists all of the
+// repositories that failed.
+func forEachWorkspaceRepo(file string, f func(*config.Workspace, *config.WorkspaceRepo) error) error {
+	if GlobalOpt.CloneURL != "" {
+		return fmt.Errorf("--clone-url can't be used with --workspace (set each repository's URI in the workspace file instead)")
+	}
+	w, err := config.ReadWorkspace(file)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, r := range w.Repos {
+		label := workspaceRepoLabel(w, r)
+		log.Println(colorable.Cyan("# " + label))
+		if err := f(w, r); err != nil {
+			log.Println(colorable.Red(fmt.Sprintf("%s FAIL: %s", label, err)))
+			failed = append(failed, label)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d workspace repositories failed: %s", len(failed), len(w.Repos), strings.Join(failed, ", "))
+	}
+	return nil
+}
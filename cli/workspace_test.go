@@ -0,0 +1,22 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWorkspaceArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"make", "--workspace", "ws.json", "-j", "2"}, []string{"make", "-j", "2"}},
+		{[]string{"-v", "coverage", "--workspace=ws.json"}, []string{"-v", "coverage"}},
+		{[]string{"make", "--", "--workspace"}, []string{"make", "--", "--workspace"}},
+	}
+	for _, test := range tests {
+		if got := workspaceArgs(test.args); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got %v, want %v", test.args, got, test.want)
+		}
+	}
+}
@@ -11,7 +11,9 @@ import (
 
 	"sourcegraph.com/sourcegraph/srclib/cli"
 	_ "sourcegraph.com/sourcegraph/srclib/dep"
+	_ "sourcegraph.com/sourcegraph/srclib/golang"
 	_ "sourcegraph.com/sourcegraph/srclib/scan"
+	_ "sourcegraph.com/sourcegraph/srclib/schema"
 )
 
 func main() {
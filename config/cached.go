@@ -32,17 +32,9 @@ func ReadCached(bdfs vfs.FileSystem) (*Tree, error) {
 		return nil, err
 	}
 
-	// Collect all **/*.unit.json files.
-	var unitFiles []string
-	unitSuffix := buildstore.DataTypeSuffix(unit.SourceUnit{})
-	w := fs.WalkFS(".", rwvfs.Walkable(rwvfs.ReadOnly(bdfs)))
-	for w.Step() {
-		if err := w.Err(); err != nil {
-			return nil, err
-		}
-		if path := w.Path(); strings.HasSuffix(path, unitSuffix) {
-			unitFiles = append(unitFiles, path)
-		}
+	unitFiles, err := cachedUnitFiles(bdfs)
+	if err != nil {
+		return nil, err
 	}
 
 	// Parse units
@@ -61,7 +53,7 @@ func ReadCached(bdfs vfs.FileSystem) (*Tree, error) {
 			}
 			if err := json.NewDecoder(f).Decode(&units[i]); err != nil {
 				f.Close()
-				par.Error(err)
+				par.Error(&Error{File: unitFile, Msg: err.Error()})
 				return
 			}
 			if err := f.Close(); err != nil {
@@ -75,3 +67,39 @@ func ReadCached(bdfs vfs.FileSystem) (*Tree, error) {
 	}
 	return &Tree{SourceUnits: units}, nil
 }
+
+// RemoveCached removes all of the cached source unit definition files
+// in bdfs, so that source units that no longer exist (e.g., because
+// the Srcfile changed) don't linger in the cached config.
+func RemoveCached(bdfs rwvfs.FileSystem) error {
+	if _, err := bdfs.Lstat("."); os.IsNotExist(err) {
+		return nil
+	}
+	unitFiles, err := cachedUnitFiles(bdfs)
+	if err != nil {
+		return err
+	}
+	for _, unitFile := range unitFiles {
+		if err := bdfs.Remove(unitFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cachedUnitFiles returns the paths of all **/*.unit.json files in
+// bdfs.
+func cachedUnitFiles(bdfs vfs.FileSystem) ([]string, error) {
+	var unitFiles []string
+	unitSuffix := buildstore.DataTypeSuffix(unit.SourceUnit{})
+	w := fs.WalkFS(".", rwvfs.Walkable(rwvfs.ReadOnly(bdfs)))
+	for w.Step() {
+		if err := w.Err(); err != nil {
+			return nil, err
+		}
+		if path := w.Path(); strings.HasSuffix(path, unitSuffix) {
+			unitFiles = append(unitFiles, path)
+		}
+	}
+	return unitFiles, nil
+}
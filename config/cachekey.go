@@ -0,0 +1,95 @@
+package config
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/godoc/vfs"
+	"sourcegraph.com/sourcegraph/rwvfs"
+)
+
+// CacheKeyFilename is the name of the file, in a commit's build data
+// directory, that holds the key of the cached config (see CacheKey).
+const CacheKeyFilename = "config.key"
+
+// ErrStaleCache indicates that the cached config was created from a
+// different Srcfile, profile, or set of toolchains than the current
+// ones (or that it has no cache key), so it must be recreated.
+var ErrStaleCache = errors.New("cached config is stale (the Srcfile, profile, or installed toolchains changed)")
+
+// CacheKey returns a key that identifies the inputs from which the
+// cached config for the repository whose root is dir is created: the
+// contents of the Srcfile (if any), the name of the selected profile
+// (if any), and the installed toolchains' versions (keyed by toolchain
+// path).
+//
+// The cached source unit files do not depend on the commit alone, so
+// the key is stored alongside them (see WriteCacheKey) and compared
+// before they are used (see CheckCacheKey).
+func CacheKey(dir, profile string, toolchainVersions map[string]string) (string, error) {
+	h := sha1.New()
+	file, err := FindFile(dir)
+	if err != nil {
+		return "", err
+	}
+	if file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", file[len(dir):], len(data))
+		h.Write(data)
+	}
+	fmt.Fprintf(h, "profile %s\x00", profile)
+
+	paths := make([]string, 0, len(toolchainVersions))
+	for path := range toolchainVersions {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Fprintf(h, "toolchain %s %s\x00", path, toolchainVersions[path])
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// WriteCacheKey records key as the key of the cached config in bdfs,
+// which should be a VFS obtained from a call to
+// (buildstore.RepoBuildStore).Commit.
+func WriteCacheKey(bdfs rwvfs.FileSystem, key string) error {
+	f, err := bdfs.Create(CacheKeyFilename)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write([]byte(key + "\n")); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// CheckCacheKey returns ErrStaleCache if the cached config in bdfs
+// was not recorded with the given key (see WriteCacheKey).
+func CheckCacheKey(bdfs vfs.FileSystem, key string) error {
+	f, err := bdfs.Open(CacheKeyFilename)
+	if os.IsNotExist(err) {
+		return ErrStaleCache
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(data)) != key {
+		return ErrStaleCache
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+)
+
+func TestCacheKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-cachekey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	versions := map[string]string{"a": "1", "b": "2"}
+	key := func(profile string, versions map[string]string) string {
+		k, err := CacheKey(dir, profile, versions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	k0 := key("", versions)
+	if err := ioutil.WriteFile(filepath.Join(dir, Filename), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	k1 := key("", versions)
+	if k1 == k0 {
+		t.Error("key didn't change when Srcfile was created")
+	}
+	if k := key("ci", versions); k == k1 {
+		t.Error("key didn't change with profile")
+	}
+	if k := key("", map[string]string{"a": "1", "b": "3"}); k == k1 {
+		t.Error("key didn't change with toolchain version")
+	}
+	if k := key("", map[string]string{"b": "2", "a": "1"}); k != k1 {
+		t.Error("key changed with same toolchain versions")
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "cache"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	bdfs := rwvfs.OS(filepath.Join(dir, "cache"))
+	if err := CheckCacheKey(bdfs, k1); err != ErrStaleCache {
+		t.Errorf("with no cache key: got %v, want ErrStaleCache", err)
+	}
+	if err := WriteCacheKey(bdfs, k1); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckCacheKey(bdfs, k1); err != nil {
+		t.Errorf("with same cache key: got %v, want nil", err)
+	}
+	if err := CheckCacheKey(bdfs, k0); err != ErrStaleCache {
+		t.Errorf("with different cache key: got %v, want ErrStaleCache", err)
+	}
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// CodeOwnersFiles are the paths, relative to the repository root and
+// in order of precedence, at which a CODEOWNERS file is looked for.
+var CodeOwnersFiles = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// CodeOwners is a parsed CODEOWNERS file, which lists the owners of
+// files in a repository. Each line holds a gitignore-style path
+// pattern followed by the owners of the files it matches; the last
+// matching line takes precedence.
+type CodeOwners []codeOwnersRule
+
+type codeOwnersRule struct {
+	pattern *regexp.Regexp
+	owners  []string
+}
+
+// ParseCodeOwners parses the contents of a CODEOWNERS file.
+func ParseCodeOwners(data []byte) (CodeOwners, error) {
+	var c CodeOwners
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; s.Scan(); line++ {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		var owners []string
+		for _, f := range fields[1:] {
+			if strings.HasPrefix(f, "#") {
+				break
+			}
+			owners = append(owners, f)
+		}
+		pat, err := codeOwnersPattern(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("CODEOWNERS line %d: %s", line, err)
+		}
+		c = append(c, codeOwnersRule{pattern: pat, owners: owners})
+	}
+	return c, s.Err()
+}
+
+// ReadCodeOwners reads and parses the CODEOWNERS file in the
+// repository rooted at dir. If there is none, it returns nil.
+func ReadCodeOwners(dir string) (CodeOwners, error) {
+	for _, name := range CodeOwnersFiles {
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		return ParseCodeOwners(data)
+	}
+	return nil, nil
+}
+
+// codeOwnersPattern converts a gitignore-style pattern to a regexp
+// that matches the slash-separated paths (relative to the repository
+// root) of the files and directories it matches, and of the files and
+// directories beneath them.
+func codeOwnersPattern(pat string) (*regexp.Regexp, error) {
+	p := strings.TrimSuffix(pat, "/")
+	anchored := strings.Contains(p, "/") // as in gitignore
+	p = strings.TrimPrefix(p, "/")
+
+	var re bytes.Buffer
+	re.WriteString("^")
+	if !anchored {
+		re.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(p); i++ {
+		switch {
+		case strings.HasPrefix(p[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case p[i] == '*':
+			re.WriteString("[^/]*")
+		case p[i] == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		}
+	}
+	re.WriteString("(?:/.*)?$")
+	return regexp.Compile(re.String())
+}
+
+// Owners returns the owners of the file or directory at the
+// slash-separated path p (relative to the repository root).
+func (c CodeOwners) Owners(p string) []string {
+	p = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(p)), "/")
+	for i := len(c) - 1; i >= 0; i-- {
+		if c[i].pattern.MatchString(p) {
+			return c[i].owners
+		}
+	}
+	return nil
+}
+
+// SetUnitOwners sets the Owners of u, if it has none, to the owners of
+// its directory (its Dir, or the directory of its first file).
+func (c CodeOwners) SetUnitOwners(u *unit.SourceUnit) {
+	if len(u.Owners) > 0 || len(c) == 0 {
+		return
+	}
+	dir := u.Dir
+	if dir == "" && len(u.Files) > 0 {
+		dir = filepath.Dir(u.Files[0])
+	}
+	if owners := c.Owners(dir); len(owners) > 0 {
+		u.Owners = append([]string(nil), owners...)
+	}
+}
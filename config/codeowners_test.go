@@ -0,0 +1,55 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestCodeOwners(t *testing.T) {
+	c, err := ParseCodeOwners([]byte(`# Default owners.
+*           @org/everyone
+
+docs/       @org/docs   # trailing comment
+/cmd/       @org/cli
+*.js        @org/frontend
+/lib/**/internal @org/core
+cmd/tool    @alice @bob
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]string{
+		"":                       {"@org/everyone"},
+		"README":                 {"@org/everyone"},
+		"docs":                   {"@org/docs"},
+		"docs/a/b.md":            {"@org/docs"},
+		"src/docs/x":             {"@org/docs"},
+		"cmd/foo":                {"@org/cli"},
+		"src/cmd/foo":            {"@org/everyone"},
+		"cmd/tool":               {"@alice", "@bob"},
+		"cmd/tool/main.go":       {"@alice", "@bob"},
+		"web/app.js":             {"@org/frontend"},
+		"lib/internal/x.go":      {"@org/core"},
+		"lib/a/b/internal":       {"@org/core"},
+		"lib/a/b/internalx/y.go": {"@org/everyone"},
+	}
+	for path, want := range tests {
+		if got := c.Owners(path); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got owners %v, want %v", path, got, want)
+		}
+	}
+
+	u := &unit.SourceUnit{Info: unit.Info{Files: []string{"cmd/foo/main.go"}}}
+	c.SetUnitOwners(u)
+	if want := []string{"@org/cli"}; !reflect.DeepEqual(u.Owners, want) {
+		t.Errorf("got unit owners %v, want %v", u.Owners, want)
+	}
+	u = &unit.SourceUnit{Info: unit.Info{Dir: "docs", Owners: []string{"@carol"}}}
+	c.SetUnitOwners(u)
+	if want := []string{"@carol"}; !reflect.DeepEqual(u.Owners, want) {
+		t.Errorf("got unit owners %v, want %v (scanner-provided owners should be kept)", u.Owners, want)
+	}
+}
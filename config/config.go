@@ -1,11 +1,12 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
-	"os"
-	"path/filepath"
+	"io/ioutil"
 
 	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/docurl"
 	"sourcegraph.com/sourcegraph/srclib/unit"
 )
 
@@ -15,6 +16,63 @@ var Filename = "Srcfile"
 
 // Repository represents the config for an entire repository.
 type Repository struct {
+	// CloneURL, if set, is used as the repository's clone URL (and
+	// therefore determines its URI), regardless of the repository's VCS
+	// remotes.
+	CloneURL string `json:",omitempty"`
+
+	// Remotes is the list of VCS remote names, in order of preference,
+	// whose URL is used as the repository's clone URL. If empty, the
+	// default policy (vcs.DefaultRemotes) is used.
+	Remotes []string `json:",omitempty"`
+
+	// Proxy, if set, is the URL of an HTTP (caching) proxy that
+	// toolchain installs and dep resolution route their network
+	// fetches through. $SRCLIB_PROXY takes precedence (see
+	// srclib.Proxy).
+	Proxy string `json:",omitempty"`
+
+	// Offline, if true, forbids network fetches while building the
+	// repository, so that builds that would need to fetch something
+	// fail fast (see srclib.Offline).
+	Offline bool `json:",omitempty"`
+
+	// Profiles are named sets of settings that override the rest of
+	// the Srcfile when selected (e.g., with --profile=NAME).
+	Profiles map[string]*Profile `json:",omitempty"`
+
+	// DocURLs are templates for the URLs of defs (e.g., on a
+	// documentation site for the repository's language or host),
+	// which take precedence over the built-in templates of the same
+	// name (see docurl.Defaults and "srclib api url").
+	DocURLs []*docurl.Template `json:",omitempty"`
+
+	// CoverageScorer is the name of the coverage scorer (see
+	// cvg.FileScorer) that decides whether each file counts as
+	// covered by "srclib coverage". If empty, the default scorer is
+	// used.
+	CoverageScorer string `json:",omitempty"`
+
+	// Tags are labels for the whole repository, such as its topics
+	// (e.g., "payments") or service tier (e.g., "tier-1"). They are
+	// added to the Tags of each of the repository's source units, so
+	// that they are stored with its data and queries across
+	// repositories can be filtered by them (e.g., with "srclib store
+	// units --tag").
+	Tags []string `json:",omitempty"`
+
+	// Metadata describes the whole repository (e.g., its "team"). It
+	// is merged into the Metadata of each of the repository's source
+	// units, like Tags. Values that a unit already has (e.g., from its
+	// scanner) are kept, and UnitOverrides' Metadata replaces these.
+	Metadata map[string]string `json:",omitempty"`
+
+	// VCS, if "dir", marks the directory that contains the Srcfile as
+	// the root of an unversioned tree (e.g., an extracted tarball),
+	// whose commit ID is a hash of its files (see vcs.Dir). It is
+	// ignored if the directory is in a repository of another VCS.
+	VCS string `json:",omitempty"`
+
 	// Tree is the configuration for the top-level directory tree in the
 	// repository.
 	Tree
@@ -26,7 +84,10 @@ type Tree struct {
 	// manually in the Srcfile or discovered automatically by the scanner.
 	SourceUnits []*unit.SourceUnit `json:",omitempty"`
 
-	// Scanners to use to scan for source units in this tree.
+	// Scanners to use to scan for source units in this tree. Besides
+	// the scanners of installed toolchains, the scanners built into
+	// srclib (whose toolchain path is "srclib"; see scan.Builtins) may
+	// be used.
 	Scanners []*srclib.ToolRef `json:",omitempty"`
 
 	// SkipDirs is a list of directory trees that are skipped. That is, any
@@ -39,6 +100,71 @@ type Tree struct {
 	// name and type pair in SkipUnits is skipped.
 	SkipUnits []struct{ Name, Type string } `json:",omitempty"`
 
+	// UnitOverrides is a list of settings for individual source units
+	// (or groups of units matched by a name pattern), such as extra
+	// environment variables or files to exclude. Later overrides take
+	// precedence over earlier ones.
+	UnitOverrides []*UnitOverride `json:",omitempty"`
+
+	// GraphPostProcessors is a list of tools (in toolchains found in
+	// the SRCLIBPATH) that filter or augment each source unit's graph
+	// output before it is written to the build store. They are run in
+	// order, each receiving the graph output on stdin and writing the
+	// modified graph output to stdout (see grapher.PostProcess).
+	//
+	// Because the cached source unit files don't record the Srcfile's
+	// GraphPostProcessors, they are read from the Srcfile when the
+	// Makefile is created.
+	GraphPostProcessors []*srclib.ToolRef `json:",omitempty"`
+
+	// TestFiles is a list of glob patterns (as accepted by path.Match)
+	// of files that contain test code, in addition to those that are
+	// test files by the conventions of their language (see
+	// graph.IsTestFile). A pattern that matches a directory matches
+	// all of the files in it. Defs and refs in test files are marked
+	// as Test, and source units whose files are all test files are
+	// tagged "test".
+	//
+	// Like GraphPostProcessors, TestFiles is read from the Srcfile
+	// when the Makefile is created.
+	TestFiles []string `json:",omitempty"`
+
+	// Stitchers is a list of tools (in toolchains found in the
+	// SRCLIBPATH) that connect defs across languages, such as the
+	// defs in code generated from IDL files (protobuf, Thrift, or
+	// OpenAPI) and the IDL defs they were generated from. After all
+	// source units are graphed, each stitcher is given the defs of all
+	// units and emits refs (e.g., from a generated Go client method to
+	// the .proto service method) that are imported along with the
+	// units' own refs (see grapher.Stitch).
+	//
+	// Like GraphPostProcessors, Stitchers is read from the Srcfile
+	// when the Makefile is created.
+	Stitchers []*srclib.ToolRef `json:",omitempty"`
+
+	// MaxFileSize is the size (in bytes) above which source unit files
+	// are skipped (removed from the units' Files, so that they aren't
+	// passed to graphers or counted by coverage), so that huge
+	// generated files don't exhaust graphers' memory. If 0,
+	// DefaultMaxFileSize is used; if negative, files of any size are
+	// allowed. Skipped files are recorded in the build data (see
+	// SkippedFilesFilename).
+	MaxFileSize int64 `json:",omitempty"`
+
+	// IncludeBinaryFiles, if true, keeps binary files (see IsBinary) in
+	// source units' Files. By default, they are skipped like files
+	// larger than MaxFileSize.
+	IncludeBinaryFiles bool `json:",omitempty"`
+
+	// Symlinks is the policy for symbolic links in the repository
+	// (see util.SymlinkPolicy): "ignore" (the default) skips them,
+	// "follow" follows those whose targets are inside the repository
+	// (visiting each file only once, so that cycles terminate), and
+	// "error" fails. It applies to the coverage walk, the built-in
+	// scanners (and scanners that read $SRCLIB_SYMLINKS), and source
+	// units' Files.
+	Symlinks string `json:",omitempty"`
+
 	// TODO(sqs): Add some type of field that lets the Srcfile and the scanners
 	// have input into which tools get used during the execution phase. Right
 	// now, we're going to try just using the system defaults (srclib-*) and
@@ -53,25 +179,51 @@ type Tree struct {
 // Srcfile exists, it returns the default configuration for the repository. If
 // an overridden configuration is specified for the repository (hard-coded in
 // the Go code), then it is used instead of the Srcfile or the default
-// configuration.
+// configuration. The Srcfile may be in any of the formats listed in
+// Filenames. Lines in a JSON Srcfile that begin with "//" are comments.
 func ReadRepository(dir string) (*Repository, error) {
+	file, err := FindFile(dir)
+	if err != nil {
+		return nil, err
+	}
+
 	var c *Repository
-	if f, err := os.Open(filepath.Join(dir, Filename)); err == nil {
-		defer f.Close()
-		err = json.NewDecoder(f).Decode(&c)
+	if file != "" {
+		data, err := ioutil.ReadFile(file)
 		if err != nil {
 			return nil, err
 		}
-	} else if os.IsNotExist(err) {
-		err = nil
-		c = new(Repository)
+		if IsYAML(file) {
+			if data, err = ConvertToJSON(file, data); err != nil {
+				return nil, err
+			}
+		} else {
+			data = stripComments(data)
+		}
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, decodeError(file, data, err)
+		}
 	} else {
-		return nil, err
+		c = new(Repository)
 	}
 
 	return c.finish()
 }
 
+// stripComments blanks out comment lines (lines whose first
+// non-whitespace characters are "//") in a Srcfile, so that Srcfiles
+// may be annotated. Line numbers are preserved so that JSON syntax
+// errors still point to the right place.
+func stripComments(data []byte) []byte {
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		if bytes.HasPrefix(bytes.TrimSpace(line), []byte("//")) {
+			lines[i] = nil
+		}
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
 func (c *Repository) finish() (*Repository, error) {
 	if err := c.validate(); err != nil {
 		return nil, err
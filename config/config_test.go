@@ -0,0 +1,35 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadRepository_comments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcfile := `// A comment.
+{
+  // Another comment.
+  "SkipDirs": ["a", "http://example.com//b"]
+}
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, Filename), []byte(srcfile), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := ReadRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "http://example.com//b"}; !reflect.DeepEqual(c.SkipDirs, want) {
+		t.Errorf("got SkipDirs %v, want %v", c.SkipDirs, want)
+	}
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// An Error is a problem with a configuration file, such as a syntax
+// error or an invalid setting in a Srcfile.
+type Error struct {
+	File string // path of the file containing the error
+
+	// Line and Column are the 1-based position of the error in File,
+	// or 0 if unknown.
+	Line, Column int
+
+	Msg string // description of the problem
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.Line > 0 && e.Column > 0:
+		return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Msg)
+	case e.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+	default:
+		return fmt.Sprintf("%s: %s", e.File, e.Msg)
+	}
+}
+
+// An ErrorList is a list of configuration errors.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// newError returns an Error at the given byte offset in data, which
+// is the contents of file.
+func newError(file string, data []byte, offset int, format string, args ...interface{}) *Error {
+	e := &Error{File: file, Msg: fmt.Sprintf(format, args...)}
+	if offset >= 0 && offset <= len(data) {
+		e.Line = bytes.Count(data[:offset], []byte("\n")) + 1
+		e.Column = offset - (bytes.LastIndex(data[:offset], []byte("\n")) + 1) + 1
+	}
+	return e
+}
+
+// jsonError converts an error returned by encoding/json while
+// decoding data (the contents of file) into an *Error that includes
+// the position of the problem, if known.
+func jsonError(file string, data []byte, err error) *Error {
+	switch err := err.(type) {
+	case *json.SyntaxError:
+		return newError(file, data, int(err.Offset), "%s", err)
+	case *json.UnmarshalTypeError:
+		return newError(file, data, int(err.Offset), "%s", err)
+	}
+	return &Error{File: file, Msg: err.Error()}
+}
+
+func (l ErrorList) Len() int      { return len(l) }
+func (l ErrorList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l ErrorList) Less(i, j int) bool {
+	if l[i].Line != l[j].Line {
+		return l[i].Line < l[j].Line
+	}
+	return l[i].Column < l[j].Column
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/tools/godoc/vfs"
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// DefaultMaxFileSize is the size (in bytes) above which files are
+// skipped if the tree's MaxFileSize is 0.
+const DefaultMaxFileSize = 10 << 20
+
+// binarySniffLen is the number of bytes at the beginning of a file
+// that are checked by IsBinary (the same number that git checks).
+const binarySniffLen = 8000
+
+// SkippedFilesFilename is the name of the file, in a commit's build
+// data directory, that lists the files that were skipped because they
+// were too large or binary (see WriteSkippedFiles).
+const SkippedFilesFilename = "skipped_files.json"
+
+// Reasons that files are skipped.
+const (
+	SkippedTooLarge = "too large"
+	SkippedBinary   = "binary"
+)
+
+// A SkippedFile is a file that was removed from a source unit's Files
+// (and so wasn't passed to the unit's grapher) because it exceeded the
+// maximum file size or was binary.
+type SkippedFile struct {
+	Unit     string `json:",omitempty"`
+	UnitType string `json:",omitempty"`
+	File     string
+	Size     int64
+	Reason   string // SkippedTooLarge or SkippedBinary
+}
+
+// MaxFileSizeBytes returns the size (in bytes) above which files in
+// the tree are skipped, or 0 if files of any size are allowed.
+func (c *Tree) MaxFileSizeBytes() int64 {
+	switch {
+	case c.MaxFileSize < 0:
+		return 0
+	case c.MaxFileSize == 0:
+		return DefaultMaxFileSize
+	}
+	return c.MaxFileSize
+}
+
+// CheckFile returns the reason (SkippedTooLarge or SkippedBinary) that
+// file (relative to dir) should be skipped, and its size. If the file
+// shouldn't be skipped (or doesn't exist or isn't a regular file), the
+// reason is empty.
+func (c *Tree) CheckFile(dir, file string) (reason string, size int64, err error) {
+	name := filepath.Join(dir, filepath.FromSlash(file))
+	fi, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		return "", 0, nil
+	} else if err != nil {
+		return "", 0, err
+	}
+	if !fi.Mode().IsRegular() {
+		return "", 0, nil
+	}
+	size = fi.Size()
+	if max := c.MaxFileSizeBytes(); max > 0 && size > max {
+		return SkippedTooLarge, size, nil
+	}
+	if c.IncludeBinaryFiles || size == 0 {
+		return "", size, nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return "", size, err
+	}
+	defer f.Close()
+	head, err := ioutil.ReadAll(io.LimitReader(f, binarySniffLen))
+	if err != nil {
+		return "", size, err
+	}
+	if IsBinary(head) {
+		return SkippedBinary, size, nil
+	}
+	return "", size, nil
+}
+
+// IsBinary reports whether data, the beginning of a file, is binary:
+// whether it contains a NUL byte (the heuristic that git uses).
+func IsBinary(data []byte) bool {
+	if len(data) > binarySniffLen {
+		data = data[:binarySniffLen]
+	}
+	return bytes.IndexByte(data, 0) != -1
+}
+
+// SkipFiles removes the files that are too large or binary (see
+// CheckFile) from u's Files, which are relative to dir, and returns
+// them.
+func (c *Tree) SkipFiles(dir string, u *unit.SourceUnit) ([]*SkippedFile, error) {
+	var skipped []*SkippedFile
+	files := u.Files[:0]
+	for _, f := range u.Files {
+		reason, size, err := c.CheckFile(dir, f)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			skipped = append(skipped, &SkippedFile{Unit: u.Name, UnitType: u.Type, File: f, Size: size, Reason: reason})
+			continue
+		}
+		files = append(files, f)
+	}
+	u.Files = files
+	return skipped, nil
+}
+
+// WriteSkippedFiles records the skipped files in bdfs, which should be
+// a VFS obtained from a call to (buildstore.RepoBuildStore).Commit. If
+// no files were skipped, it removes any existing record.
+func WriteSkippedFiles(bdfs rwvfs.FileSystem, skipped []*SkippedFile) error {
+	if len(skipped) == 0 {
+		if err := bdfs.Remove(SkippedFilesFilename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(skipped, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := bdfs.Create(SkippedFilesFilename)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadSkippedFiles returns the skipped files recorded in bdfs (see
+// WriteSkippedFiles). If none were recorded, it returns nil and no
+// error.
+func ReadSkippedFiles(bdfs vfs.FileSystem) ([]*SkippedFile, error) {
+	f, err := bdfs.Open(SkippedFilesFilename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var skipped []*SkippedFile
+	if err := json.NewDecoder(f).Decode(&skipped); err != nil {
+		return nil, err
+	}
+	return skipped, nil
+}
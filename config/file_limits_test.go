@@ -0,0 +1,101 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestTree_MaxFileSizeBytes(t *testing.T) {
+	tests := map[int64]int64{0: DefaultMaxFileSize, -1: 0, 100: 100}
+	for max, want := range tests {
+		tree := &Tree{MaxFileSize: max}
+		if got := tree.MaxFileSizeBytes(); got != want {
+			t.Errorf("MaxFileSize %d: got %d, want %d", max, got, want)
+		}
+	}
+}
+
+func TestTree_SkipFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-skip-files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"small.go": "package a\n",
+		"big.go":   "package a\n" + strings.Repeat("// x\n", 100),
+		"image.go": "GIF89a\x00\x01",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newUnit := func() *unit.SourceUnit {
+		return &unit.SourceUnit{Key: unit.Key{Name: "u", Type: "t"}, Info: unit.Info{Files: []string{"big.go", "image.go", "missing.go", "small.go"}}}
+	}
+
+	tree := &Tree{MaxFileSize: 100}
+	u := newUnit()
+	skipped, err := tree.SkipFiles(dir, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"missing.go", "small.go"}; !reflect.DeepEqual(u.Files, want) {
+		t.Errorf("got files %v, want %v", u.Files, want)
+	}
+	want := []*SkippedFile{
+		{Unit: "u", UnitType: "t", File: "big.go", Size: int64(len(files["big.go"])), Reason: SkippedTooLarge},
+		{Unit: "u", UnitType: "t", File: "image.go", Size: int64(len(files["image.go"])), Reason: SkippedBinary},
+	}
+	if !reflect.DeepEqual(skipped, want) {
+		t.Errorf("got skipped %+v, want %+v", skipped, want)
+	}
+
+	// With no size limit and binary files included, nothing is
+	// skipped.
+	tree = &Tree{MaxFileSize: -1, IncludeBinaryFiles: true}
+	u = newUnit()
+	if skipped, err := tree.SkipFiles(dir, u); err != nil {
+		t.Fatal(err)
+	} else if len(skipped) != 0 {
+		t.Errorf("got skipped %+v, want none", skipped)
+	}
+	if len(u.Files) != 4 {
+		t.Errorf("got files %v, want all 4", u.Files)
+	}
+}
+
+func TestSkippedFiles(t *testing.T) {
+	fs := rwvfs.Map(map[string]string{})
+	if skipped, err := ReadSkippedFiles(fs); err != nil || skipped != nil {
+		t.Fatalf("got %v, %v, want nil, nil", skipped, err)
+	}
+
+	want := []*SkippedFile{{File: "a.min.js", Size: 1 << 30, Reason: SkippedTooLarge}}
+	if err := WriteSkippedFiles(fs, want); err != nil {
+		t.Fatal(err)
+	}
+	skipped, err := ReadSkippedFiles(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(skipped, want) {
+		t.Errorf("got %+v, want %+v", skipped, want)
+	}
+
+	if err := WriteSkippedFiles(fs, nil); err != nil {
+		t.Fatal(err)
+	}
+	if skipped, err := ReadSkippedFiles(fs); err != nil || skipped != nil {
+		t.Errorf("after removing: got %v, %v, want nil, nil", skipped, err)
+	}
+}
@@ -0,0 +1,473 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Filenames are the names of the files that may configure a
+// repository, in order of preference. The Srcfile may be written in
+// JSON (Filename) or in YAML.
+var Filenames = []string{Filename, "Srcfile.yaml", ".srclib.yml"}
+
+// FindFile returns the path of the Srcfile (with any of the names in
+// Filenames) in dir, or "" if there is none. It is an error for dir to
+// contain more than one Srcfile.
+func FindFile(dir string) (string, error) {
+	var found []string
+	for _, name := range Filenames {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			found = append(found, name)
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", nil
+	case 1:
+		return filepath.Join(dir, found[0]), nil
+	}
+	return "", &Error{File: dir, Msg: fmt.Sprintf("multiple Srcfiles found (%s); remove all but one", strings.Join(found, ", "))}
+}
+
+// IsYAML reports whether the Srcfile named file is written in YAML
+// (based on its extension).
+func IsYAML(file string) bool {
+	ext := filepath.Ext(file)
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// ConvertToYAML converts a JSON Srcfile to YAML, preserving the order
+// of keys. Comments are not preserved.
+func ConvertToYAML(data []byte) ([]byte, error) {
+	return jsonToYAML(data)
+}
+
+// ConvertToJSON converts a YAML Srcfile to indented JSON, preserving
+// the order of keys. Comments are not preserved. The file name is
+// only used in error messages.
+func ConvertToJSON(file string, data []byte) ([]byte, error) {
+	data, _, err := yamlToJSON(file, data)
+	return data, err
+}
+
+// ReadDocument converts data, the contents of file, to JSON if file
+// is YAML (see IsYAML), and returns the JSON and the byte offset in
+// data of each value, keyed by its lowercased path (as described in
+// jsonOffsets). It converts YAML as Srcfiles are converted (see
+// ConvertToJSON), so that other JSON and YAML documents (such as API
+// schemas) can be read with the positions of their values.
+func ReadDocument(file string, data []byte) ([]byte, map[string]int, error) {
+	if !IsYAML(file) {
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, nil, jsonError(file, data, err)
+		}
+		return data, jsonOffsets(data), nil
+	}
+	jsonData, pos, err := yamlToJSON(file, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	lineStarts := []int{0}
+	for i, c := range data {
+		if c == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	offsets := make(map[string]int, len(pos))
+	for path, p := range pos {
+		if p.line >= 1 && p.line <= len(lineStarts) {
+			offsets[path] = lineStarts[p.line-1] + p.col - 1
+		}
+	}
+	return jsonData, offsets, nil
+}
+
+// decodeError converts an error that occurred while decoding the JSON
+// data of the Srcfile named file (which may have been converted from
+// YAML) into an *Error.
+func decodeError(file string, data []byte, err error) *Error {
+	if IsYAML(file) {
+		// Offsets in the converted JSON don't correspond to positions
+		// in the YAML file.
+		return &Error{File: file, Msg: err.Error()}
+	}
+	return jsonError(file, data, err)
+}
+
+// yamlToJSON converts YAML data to indented JSON, preserving the order
+// of keys. It also returns the position in data of each value, keyed
+// by path (as described in jsonOffsets). Anchors, aliases, and merge
+// keys are expanded. Only one document is allowed.
+func yamlToJSON(file string, data []byte) ([]byte, map[string]position, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	var doc yaml.Node
+	if err := dec.Decode(&doc); err != nil && err != io.EOF {
+		return nil, nil, yamlError(file, err)
+	}
+	var next yaml.Node
+	if err := dec.Decode(&next); err == nil {
+		return nil, nil, &Error{File: file, Line: next.Line, Column: next.Column, Msg: "multiple YAML documents are not supported"}
+	} else if err != io.EOF {
+		return nil, nil, yamlError(file, err)
+	}
+
+	c := yamlConverter{file: file, pos: map[string]position{}}
+	var v interface{} = newOrderedMap()
+	if len(doc.Content) > 0 {
+		root := doc.Content[0]
+		c.pos[""] = position{root.Line, root.Column}
+		var err error
+		if v, err = c.value("", root); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, v, ""); err != nil {
+		return nil, nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), c.pos, nil
+}
+
+// yamlErrorRx matches the line number in the errors returned by the
+// yaml package.
+var yamlErrorRx = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// yamlError converts an error returned by the yaml package while
+// decoding file into an *Error.
+func yamlError(file string, err error) *Error {
+	if m := yamlErrorRx.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return &Error{File: file, Line: line, Msg: m[2]}
+	}
+	return &Error{File: file, Msg: strings.TrimPrefix(err.Error(), "yaml: ")}
+}
+
+// yamlConverter converts YAML nodes to values as represented by
+// decodeOrderedJSON, recording their positions.
+type yamlConverter struct {
+	file string
+	pos  map[string]position
+}
+
+func (c *yamlConverter) errorf(n *yaml.Node, format string, args ...interface{}) *Error {
+	return &Error{File: c.file, Line: n.Line, Column: n.Column, Msg: fmt.Sprintf(format, args...)}
+}
+
+// value converts the node n, whose path is path.
+func (c *yamlConverter) value(path string, n *yaml.Node) (interface{}, error) {
+	switch n.Kind {
+	case yaml.AliasNode:
+		return c.value(path, n.Alias)
+	case yaml.MappingNode:
+		m := newOrderedMap()
+		if err := c.mapping(path, n, m, true); err != nil {
+			return nil, err
+		}
+		return m, nil
+	case yaml.SequenceNode:
+		items := make([]interface{}, len(n.Content))
+		for i, item := range n.Content {
+			itemPath := path + "/" + strconv.Itoa(i)
+			c.pos[itemPath] = position{item.Line, item.Column}
+			var err error
+			if items[i], err = c.value(itemPath, item); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case yaml.ScalarNode:
+		return c.scalar(n)
+	}
+	return nil, c.errorf(n, "unexpected YAML node")
+}
+
+// mapping adds the members of the mapping node n, whose path is path,
+// to m. If explicit is false (for mappings merged with the "<<" merge
+// key), members whose keys are already in m are skipped, so that the
+// mapping's own keys take precedence.
+func (c *yamlConverter) mapping(path string, n *yaml.Node, m *orderedMap, explicit bool) error {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		if k.Kind == yaml.ScalarNode && k.ShortTag() == "!!merge" {
+			if err := c.merge(path, v, m); err != nil {
+				return err
+			}
+			continue
+		}
+		if k.Kind != yaml.ScalarNode {
+			return c.errorf(k, "mapping keys must be scalars")
+		}
+		if _, present := m.vals[k.Value]; present {
+			if !explicit {
+				continue
+			}
+			if _, merged := m.merged[k.Value]; !merged {
+				return c.errorf(k, "duplicate key %q", k.Value)
+			}
+			delete(m.merged, k.Value)
+		} else if !explicit {
+			if m.merged == nil {
+				m.merged = map[string]struct{}{}
+			}
+			m.merged[k.Value] = struct{}{}
+		}
+		keyPath := path + "/" + strings.ToLower(k.Value)
+		c.pos[keyPath] = position{k.Line, k.Column}
+		val, err := c.value(keyPath, v)
+		if err != nil {
+			return err
+		}
+		m.set(k.Value, val)
+	}
+	return nil
+}
+
+// merge adds the members of the mapping (or sequence of mappings) v,
+// the value of a "<<" merge key, to m.
+func (c *yamlConverter) merge(path string, v *yaml.Node, m *orderedMap) error {
+	if v.Kind == yaml.AliasNode {
+		v = v.Alias
+	}
+	switch v.Kind {
+	case yaml.MappingNode:
+		return c.mapping(path, v, m, false)
+	case yaml.SequenceNode:
+		for _, item := range v.Content {
+			if err := c.merge(path, item, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return c.errorf(v, "merge key value must be a mapping or a sequence of mappings")
+}
+
+// scalar converts the scalar node n to a JSON value. Numbers are
+// represented as json.Number; timestamps and other tagged values are
+// represented as strings.
+func (c *yamlConverter) scalar(n *yaml.Node) (interface{}, error) {
+	switch n.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var b bool
+		if err := n.Decode(&b); err != nil {
+			return nil, c.errorf(n, "%s", err)
+		}
+		return b, nil
+	case "!!int", "!!float":
+		if jsonNumberRx.MatchString(n.Value) {
+			return json.Number(n.Value), nil
+		}
+		// Convert other notations (e.g., 0x1f or 1_000).
+		var f float64
+		if err := n.Decode(&f); err != nil {
+			return nil, c.errorf(n, "%s", err)
+		}
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, c.errorf(n, "%s can't be represented in JSON", n.Value)
+		}
+		if n.ShortTag() == "!!int" {
+			var i int64
+			if err := n.Decode(&i); err == nil {
+				return json.Number(strconv.FormatInt(i, 10)), nil
+			}
+		}
+		return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+	}
+	return n.Value, nil
+}
+
+// jsonNumberRx matches JSON numbers.
+var jsonNumberRx = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// jsonToYAML converts JSON data (which may contain "//" comment lines,
+// which are dropped) to YAML, preserving the order of keys.
+func jsonToYAML(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(stripComments(data)))
+	dec.UseNumber()
+	v, err := decodeOrderedJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after top-level JSON value")
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(yamlNode(v)); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// yamlNode returns the YAML node that represents the value v (as
+// returned by decodeOrderedJSON). Empty mappings and sequences are
+// written in flow style ({} and []).
+func yamlNode(v interface{}) *yaml.Node {
+	switch v := v.(type) {
+	case *orderedMap:
+		n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		if len(v.keys) == 0 {
+			n.Style = yaml.FlowStyle
+		}
+		for _, k := range v.keys {
+			n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k}, yamlNode(v.vals[k]))
+		}
+		return n
+	case []interface{}:
+		n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		if len(v) == 0 {
+			n.Style = yaml.FlowStyle
+		}
+		for _, item := range v {
+			n.Content = append(n.Content, yamlNode(item))
+		}
+		return n
+	case json.Number:
+		tag := "!!float"
+		if _, err := v.Int64(); err == nil {
+			tag = "!!int"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: string(v)}
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(v)}
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+}
+
+// An orderedMap is a JSON object or YAML mapping whose keys are kept
+// in their original order.
+type orderedMap struct {
+	keys []string
+	vals map[string]interface{}
+
+	// merged are the keys whose values were merged from another
+	// mapping (see yamlConverter.mapping), which the mapping's own
+	// keys may override.
+	merged map[string]struct{}
+}
+
+func newOrderedMap() *orderedMap {
+	return &orderedMap{vals: map[string]interface{}{}}
+}
+
+func (m *orderedMap) set(key string, v interface{}) {
+	if _, present := m.vals[key]; !present {
+		m.keys = append(m.keys, key)
+	}
+	m.vals[key] = v
+}
+
+// decodeOrderedJSON decodes the next JSON value from dec (which should
+// use json.Number for numbers), preserving the order of object keys.
+// Objects are represented as *orderedMap, and other values as in
+// encoding/json.
+func decodeOrderedJSON(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		m := newOrderedMap()
+		for dec.More() {
+			k, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeOrderedJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			m.set(k.(string), v)
+		}
+		_, err := dec.Token()
+		return m, err
+	case json.Delim('['):
+		items := []interface{}{}
+		for dec.More() {
+			v, err := decodeOrderedJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		_, err := dec.Token()
+		return items, err
+	}
+	return tok, nil
+}
+
+// writeJSON writes v as indented JSON, preserving the order of the
+// keys in each *orderedMap.
+func writeJSON(buf *bytes.Buffer, v interface{}, indent string) error {
+	switch v := v.(type) {
+	case *orderedMap:
+		if len(v.keys) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		buf.WriteString("{\n")
+		for i, k := range v.keys {
+			key, _ := json.Marshal(k)
+			buf.WriteString(indent + "  ")
+			buf.Write(key)
+			buf.WriteString(": ")
+			if err := writeJSON(buf, v.vals[k], indent+"  "); err != nil {
+				return err
+			}
+			if i < len(v.keys)-1 {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(indent + "}")
+	case []interface{}:
+		if len(v) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		buf.WriteString("[\n")
+		for i, item := range v {
+			buf.WriteString(indent + "  ")
+			if err := writeJSON(buf, item, indent+"  "); err != nil {
+				return err
+			}
+			if i < len(v)-1 {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(indent + "]")
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConvertToJSON(t *testing.T) {
+	yaml := `# A YAML Srcfile.
+Scanners:
+- Toolchain: sourcegraph.com/sourcegraph/srclib-go  # trailing comment
+  Subcmd: scan
+SkipDirs: [vendor, "testdata", 'it''s']
+SkipUnits:
+  - {Name: a, Type: GoPackage}
+Config:
+  n: 1
+  b: true
+  nil: ~
+  url: http://example.com/#frag
+  text: |
+    line 1
+    line 2
+UnitOverrides: []
+`
+	data, err := ConvertToJSON("Srcfile.yaml", []byte(yaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("invalid JSON: %s\n\n%s", err, data)
+	}
+	var want interface{}
+	wantJSON := `{
+  "Scanners": [{"Toolchain": "sourcegraph.com/sourcegraph/srclib-go", "Subcmd": "scan"}],
+  "SkipDirs": ["vendor", "testdata", "it's"],
+  "SkipUnits": [{"Name": "a", "Type": "GoPackage"}],
+  "Config": {"n": 1, "b": true, "nil": null, "url": "http://example.com/#frag", "text": "line 1\nline 2\n"},
+  "UnitOverrides": []
+}`
+	if err := json.Unmarshal([]byte(wantJSON), &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got JSON\n%s\n\nwant\n%s", data, wantJSON)
+	}
+	if i, j := strings.Index(string(data), "Scanners"), strings.Index(string(data), "SkipDirs"); i > j {
+		t.Errorf("key order not preserved:\n%s", data)
+	}
+}
+
+func TestConvertToJSON_errors(t *testing.T) {
+	tests := map[string]string{
+		"Scanners:\n\t- a\n":        "Srcfile.yaml:2: found character that cannot start any token",
+		"a: 1\na: 2\n":              `Srcfile.yaml:2:1: duplicate key "a"`,
+		"a: *ref\n":                 "Srcfile.yaml: unknown anchor 'ref' referenced",
+		"a: [x, y\n":                "Srcfile.yaml:1: did not find expected ',' or ']'",
+		"a: 1\n---\nb: 2\n":         "Srcfile.yaml:2:1: multiple YAML documents",
+		"a:\n  b: 1\n c: 2\n":       "Srcfile.yaml:2: did not find expected key",
+		"a: \"unterminated\nb: 1\n": "Srcfile.yaml:3: found unexpected end of stream",
+		"a: .inf\n":                 "Srcfile.yaml:1:4: .inf can't be represented in JSON",
+	}
+	for yaml, want := range tests {
+		_, err := ConvertToJSON("Srcfile.yaml", []byte(yaml))
+		if err == nil || !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("%q: got error %v, want prefix %q", yaml, err, want)
+		}
+	}
+}
+
+func TestConvertToJSON_anchors(t *testing.T) {
+	yaml := `defaults: &defaults
+  Toolchain: t
+  Subcmd: scan
+Scanners:
+- <<: *defaults
+  Subcmd: scan-all
+- *defaults
+Config: {n: 0x1f, m: 1_000}
+`
+	data, err := ConvertToJSON("Srcfile.yaml", []byte(yaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("invalid JSON: %s\n\n%s", err, data)
+	}
+	wantJSON := `{
+  "defaults": {"Toolchain": "t", "Subcmd": "scan"},
+  "Scanners": [{"Toolchain": "t", "Subcmd": "scan-all"}, {"Toolchain": "t", "Subcmd": "scan"}],
+  "Config": {"n": 31, "m": 1000}
+}`
+	if err := json.Unmarshal([]byte(wantJSON), &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got JSON\n%s\n\nwant\n%s", data, wantJSON)
+	}
+}
+
+func TestReadDocument(t *testing.T) {
+	docs := map[string]string{
+		"a.yaml": "info:\n  title: T\nItems:\n  - name: x\n",
+		"a.json": "{\n  \"info\": {\"title\": \"T\"},\n  \"Items\": [{\"name\": \"x\"}]\n}\n",
+	}
+	for file, doc := range docs {
+		data, offsets, err := ReadDocument(file, []byte(doc))
+		if err != nil {
+			t.Errorf("%s: %s", file, err)
+			continue
+		}
+		var v map[string]interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			t.Errorf("%s: %s", file, err)
+			continue
+		}
+		for path, key := range map[string]string{"/info/title": "title", "/items": "Items", "/items/0/name": "name"} {
+			off, present := offsets[path]
+			if !present {
+				t.Errorf("%s: no offset for %s", file, path)
+				continue
+			}
+			if rest := strings.TrimLeft(doc[off:], `"`); !strings.HasPrefix(rest, key) {
+				t.Errorf("%s: offset of %s is at %q, want %q", file, path, doc[off:], key)
+			}
+		}
+	}
+
+	if _, _, err := ReadDocument("a.json", []byte("{")); err == nil {
+		t.Error("got nil error for invalid JSON")
+	}
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	srcfile := `// A comment.
+{
+  "Scanners": [{"Toolchain": "t", "Subcmd": "scan"}],
+  "SkipDirs": ["vendor", "", " x", "true", "1.5", "a: b", "#x", "-", "null", "line\nbreak"],
+  "SkipUnits": [],
+  "Config": {"nested": {"list": [[1, 2], [], {}], "empty": {}}, "n": 1.5e3, "s": "<&>"},
+  "UnitOverrides": [{"Name": "a/*", "Env": ["A=1"], "Config": {}}]
+}`
+	yaml, err := ConvertToYAML([]byte(srcfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ConvertToJSON("Srcfile.yaml", yaml)
+	if err != nil {
+		t.Fatalf("converting back to JSON: %s\n\nYAML was:\n%s", err, yaml)
+	}
+
+	var got, want interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(stripComments([]byte(srcfile)), &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip changed Srcfile\n\nYAML:\n%s\n\nJSON:\n%s", yaml, data)
+	}
+}
+
+func TestFindFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if file, err := FindFile(dir); err != nil || file != "" {
+		t.Errorf("empty dir: got %q, %v", file, err)
+	}
+
+	yamlFile := filepath.Join(dir, ".srclib.yml")
+	if err := ioutil.WriteFile(yamlFile, []byte("SkipDirs:\n- a\nBogus: 1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if file, err := FindFile(dir); err != nil || file != yamlFile {
+		t.Errorf("got %q, %v, want %q", file, err, yamlFile)
+	}
+	c, err := ReadRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(c.SkipDirs, want) {
+		t.Errorf("got SkipDirs %v, want %v", c.SkipDirs, want)
+	}
+	errs, err := Lint(dir, LintOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || errs[0].Line != 3 || errs[0].Column != 1 {
+		t.Errorf("got lint errors %v, want 1 error at 3:1", errs)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, Filename), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FindFile(dir); err == nil {
+		t.Error("got no error with multiple Srcfiles")
+	}
+}
@@ -0,0 +1,432 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib"
+)
+
+// LintOptions configures Lint.
+type LintOptions struct {
+	// ToolchainInstalled, if set, is called to check whether each
+	// toolchain referred to by the Srcfile is installed.
+	ToolchainInstalled func(toolchainPath string) bool
+
+	// CoverageScorerRegistered, if set, is called to check whether
+	// the Srcfile's CoverageScorer is registered.
+	CoverageScorerRegistered func(name string) bool
+}
+
+// Lint checks the Srcfile (in any supported format) in dir for
+// problems that ReadRepository either doesn't detect or only reports
+// without a position: syntax errors, unknown (or misspelled) keys,
+// missing or uninstalled toolchains, malformed globs, file paths
+// outside of the repository, and conflicting source unit definitions
+// and overrides. The returned ErrorList is sorted by position. If dir
+// contains no Srcfile, Lint returns nil.
+func Lint(dir string, opt LintOptions) (ErrorList, error) {
+	file, err := FindFile(dir)
+	if err != nil {
+		if e, ok := err.(*Error); ok {
+			return ErrorList{e}, nil
+		}
+		return nil, err
+	}
+	if file == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var pos map[string]position
+	if IsYAML(file) {
+		if data, pos, err = yamlToJSON(file, data); err != nil {
+			if e, ok := err.(*Error); ok {
+				return ErrorList{e}, nil
+			}
+			return nil, err
+		}
+	} else {
+		data = stripComments(data)
+	}
+
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return ErrorList{decodeError(file, data, err)}, nil
+	}
+	var cfg Repository
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return ErrorList{decodeError(file, data, err)}, nil
+	}
+	if pos == nil {
+		pos = jsonPositions(data)
+	}
+
+	l := linter{file: file, pos: pos}
+	l.check(raw, &cfg, opt)
+	sort.Stable(l.errs)
+	return l.errs, nil
+}
+
+// Known JSON keys of objects in a Srcfile. The source unit keys are
+// those of the (unexported) JSON representation of unit.SourceUnit.
+var (
+	repositoryKeys = jsonFieldNames(reflect.TypeOf(Repository{}))
+	sourceUnitKeys = []string{"Name", "Type", "Repo", "CommitID", "Globs", "Files", "Dir", "Dependencies", "Info", "Data", "Config", "Ops", "Owners", "Tags", "Metadata"}
+	toolRefKeys    = []string{"Toolchain", "Subcmd"}
+	skipUnitKeys   = []string{"Name", "Type"}
+	overrideKeys   = jsonFieldNames(reflect.TypeOf(UnitOverride{}))
+	profileKeys    = jsonFieldNames(reflect.TypeOf(Profile{}))
+)
+
+type linter struct {
+	file string
+	pos  map[string]position // position of each value, keyed by path (see jsonOffsets)
+	errs ErrorList
+}
+
+// errorf records an error at the value identified by path.
+func (l *linter) errorf(path string, format string, args ...interface{}) {
+	p := l.pos[strings.ToLower(path)]
+	l.errs = append(l.errs, &Error{File: l.file, Line: p.line, Column: p.col, Msg: fmt.Sprintf(format, args...)})
+}
+
+// line returns the line number of the value at path.
+func (l *linter) line(path string) int {
+	return l.pos[strings.ToLower(path)].line
+}
+
+func (l *linter) check(raw interface{}, cfg *Repository, opt LintOptions) {
+	top, ok := raw.(map[string]interface{})
+	if !ok {
+		l.errorf("", "Srcfile must contain a JSON object")
+		return
+	}
+	l.checkKeys("", top, repositoryKeys)
+	l.checkKeysInList("/SourceUnits", lookupKey(top, "SourceUnits"), sourceUnitKeys)
+	l.checkKeysInList("/Scanners", lookupKey(top, "Scanners"), toolRefKeys)
+	l.checkKeysInList("/GraphPostProcessors", lookupKey(top, "GraphPostProcessors"), toolRefKeys)
+	l.checkKeysInList("/Stitchers", lookupKey(top, "Stitchers"), toolRefKeys)
+	l.checkKeysInList("/SkipUnits", lookupKey(top, "SkipUnits"), skipUnitKeys)
+	l.checkKeysInList("/UnitOverrides", lookupKey(top, "UnitOverrides"), overrideKeys)
+	profiles, _ := lookupKey(top, "Profiles").(map[string]interface{})
+	for name, p := range profiles {
+		if obj, ok := p.(map[string]interface{}); ok {
+			l.checkKeys("/Profiles/"+name, obj, profileKeys)
+		}
+	}
+
+	l.checkToolRefs("/Scanners", "scanner", cfg.Scanners, opt)
+	l.checkToolRefs("/GraphPostProcessors", "graph post-processor", cfg.GraphPostProcessors, opt)
+	l.checkToolRefs("/Stitchers", "stitcher", cfg.Stitchers, opt)
+	if cfg.CoverageScorer != "" && opt.CoverageScorerRegistered != nil && !opt.CoverageScorerRegistered(cfg.CoverageScorer) {
+		l.errorf("/CoverageScorer", "coverage scorer %q is not registered", cfg.CoverageScorer)
+	}
+
+	for i, dir := range cfg.SkipDirs {
+		if isOutsideTree(dir) {
+			l.errorf(fmt.Sprintf("/SkipDirs/%d", i), "SkipDirs entry %q is outside of the repository", dir)
+		}
+	}
+
+	type unitKey struct{ name, typ string }
+	definedAt := map[unitKey]string{}
+	for i, u := range cfg.SourceUnits {
+		path := fmt.Sprintf("/SourceUnits/%d", i)
+		if u == nil {
+			l.errorf(path, "source unit must not be null")
+			continue
+		}
+		if u.Name == "" || u.Type == "" {
+			l.errorf(path, "source unit must have a Name and a Type")
+		}
+		for j, p := range u.Files {
+			filePath := fmt.Sprintf("%s/Files/%d", path, j)
+			if _, err := filepath.Match(p, ""); err != nil {
+				l.errorf(filePath, "malformed glob %q: %s", p, err)
+			} else if isOutsideTree(p) {
+				l.errorf(filePath, "%s: %q", ErrInvalidFilePath, p)
+			}
+		}
+		k := unitKey{u.Name, u.Type}
+		if prev, dup := definedAt[k]; dup {
+			l.errorf(path, "source unit %s %q is defined more than once (also at line %d)", u.Type, u.Name, l.line(prev))
+		} else {
+			definedAt[k] = path
+		}
+	}
+	for i, su := range cfg.SkipUnits {
+		if prev, defined := definedAt[unitKey{su.Name, su.Type}]; defined {
+			l.errorf(fmt.Sprintf("/SkipUnits/%d", i), "source unit %s %q is skipped but is also defined in SourceUnits (at line %d)", su.Type, su.Name, l.line(prev))
+		}
+	}
+	l.checkUnitOverrides(cfg.UnitOverrides)
+}
+
+// checkToolRefs checks that each of the tools (described as what in
+// error messages) names a tool in an installed toolchain.
+func (l *linter) checkToolRefs(listPath, what string, tools []*srclib.ToolRef, opt LintOptions) {
+	for i, t := range tools {
+		path := fmt.Sprintf("%s/%d", listPath, i)
+		if t == nil {
+			l.errorf(path, "%s must not be null", what)
+			continue
+		}
+		if t.Toolchain == "" {
+			l.errorf(path, "%s has no Toolchain", what)
+		} else if opt.ToolchainInstalled != nil && !opt.ToolchainInstalled(t.Toolchain) {
+			l.errorf(path+"/Toolchain", "toolchain %q is not installed", t.Toolchain)
+		}
+		if t.Subcmd == "" {
+			l.errorf(path, "%s has no Subcmd", what)
+		}
+	}
+}
+
+// checkUnitOverrides checks each unit override's patterns and values,
+// and reports overrides for the same units that set the same Config
+// key or environment variable to different values.
+func (l *linter) checkUnitOverrides(overrides []*UnitOverride) {
+	type setting struct{ name, typ, kind, key string }
+	type value struct {
+		v    interface{}
+		path string
+	}
+	set := map[setting]value{}
+	record := func(s setting, v interface{}, path string) {
+		if prev, present := set[s]; present && !reflect.DeepEqual(prev.v, v) {
+			l.errorf(path, "unit override sets %s %q to %v, which conflicts with the override at line %d (which sets it to %v)", s.kind, s.key, v, l.line(prev.path), prev.v)
+			return
+		}
+		set[s] = value{v, path}
+	}
+
+	for i, o := range overrides {
+		path := fmt.Sprintf("/UnitOverrides/%d", i)
+		if o == nil {
+			l.errorf(path, "unit override must not be null")
+			continue
+		}
+		if o.Name == "" {
+			l.errorf(path, "unit override must have a Name")
+		} else if _, err := filepath.Match(o.Name, ""); err != nil {
+			l.errorf(path+"/Name", "malformed Name pattern %q: %s", o.Name, err)
+		}
+		for j, p := range o.ExcludeFiles {
+			if _, err := filepath.Match(p, ""); err != nil {
+				l.errorf(fmt.Sprintf("%s/ExcludeFiles/%d", path, j), "malformed glob %q: %s", p, err)
+			}
+		}
+		for j, kv := range o.Env {
+			envPath := fmt.Sprintf("%s/Env/%d", path, j)
+			eq := strings.Index(kv, "=")
+			if eq <= 0 {
+				l.errorf(envPath, "environment variable %q must be of the form NAME=value", kv)
+				continue
+			}
+			record(setting{o.Name, o.Type, "environment variable", kv[:eq]}, kv[eq+1:], envPath)
+		}
+		for k, v := range o.Config {
+			configPath := path + "/Config/" + k
+			if _, isStr := v.(string); !isStr {
+				l.errorf(configPath, "Config value for %q must be a string", k)
+				continue
+			}
+			record(setting{o.Name, o.Type, "Config key", k}, v, configPath)
+		}
+	}
+}
+
+// checkKeys reports keys of obj (at path) that are not in known. Since
+// encoding/json matches keys case-insensitively, keys that differ from
+// a known key only in case are reported as misspellings.
+func (l *linter) checkKeys(path string, obj map[string]interface{}, known []string) {
+	for k := range obj {
+		var match string
+		for _, kk := range known {
+			if k == kk {
+				match = kk
+				break
+			}
+			if strings.EqualFold(k, kk) {
+				match = kk
+			}
+		}
+		switch {
+		case match == "":
+			l.errorf(path+"/"+k, "unknown key %q (known keys are: %s)", k, strings.Join(known, ", "))
+		case match != k:
+			l.errorf(path+"/"+k, "key %q should be spelled %q", k, match)
+		}
+	}
+}
+
+func (l *linter) checkKeysInList(path string, list interface{}, known []string) {
+	elems, _ := list.([]interface{})
+	for i, e := range elems {
+		if obj, ok := e.(map[string]interface{}); ok {
+			l.checkKeys(fmt.Sprintf("%s/%d", path, i), obj, known)
+		}
+	}
+}
+
+// lookupKey returns the value of the key in obj that matches name,
+// using the same case-insensitive matching as encoding/json.
+func lookupKey(obj map[string]interface{}, name string) interface{} {
+	if v, ok := obj[name]; ok {
+		return v
+	}
+	for k, v := range obj {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+func isOutsideTree(p string) bool {
+	p = filepath.Clean(p)
+	return filepath.IsAbs(p) || p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator))
+}
+
+// jsonFieldNames returns the JSON keys of the fields of struct type
+// t, including those of embedded structs.
+func jsonFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			names = append(names, jsonFieldNames(f.Type)...)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+		name := f.Name
+		if tag := strings.Split(f.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// A position is a 1-based line and column in a file.
+type position struct {
+	line, col int
+}
+
+// jsonPositions is like jsonOffsets, but it returns the line and
+// column of each value.
+func jsonPositions(data []byte) map[string]position {
+	pos := map[string]position{}
+	for path, offset := range jsonOffsets(data) {
+		e := newError("", data, offset, "")
+		pos[path] = position{e.Line, e.Column}
+	}
+	return pos
+}
+
+// jsonOffsets returns the byte offset in data (which must be valid
+// JSON) of each value, keyed by its lowercased path. The path of the
+// top-level value is "", and the paths of object members and array
+// elements are formed by appending "/" and the key or index to the
+// parent's path (e.g., "/sourceunits/0/files"). For object members,
+// the offset is that of the member's key.
+func jsonOffsets(data []byte) map[string]int {
+	s := jsonOffsetScanner{data: data, offsets: map[string]int{}}
+	s.skipSpace()
+	s.offsets[""] = s.pos
+	s.value("")
+	return s.offsets
+}
+
+type jsonOffsetScanner struct {
+	data    []byte
+	pos     int
+	offsets map[string]int
+}
+
+func (s *jsonOffsetScanner) skipSpace() {
+	for s.pos < len(s.data) && strings.IndexByte(" \t\r\n", s.data[s.pos]) != -1 {
+		s.pos++
+	}
+}
+
+func (s *jsonOffsetScanner) value(path string) {
+	s.skipSpace()
+	if s.pos >= len(s.data) {
+		return
+	}
+	switch s.data[s.pos] {
+	case '{':
+		s.pos++
+		for s.pos < len(s.data) {
+			s.skipSpace()
+			switch s.data[s.pos] {
+			case '}':
+				s.pos++
+				return
+			case ',':
+				s.pos++
+				continue
+			}
+			start := s.pos
+			key := s.str()
+			memberPath := path + "/" + strings.ToLower(key)
+			s.offsets[memberPath] = start
+			s.skipSpace()
+			s.pos++ // ':'
+			s.value(memberPath)
+		}
+	case '[':
+		s.pos++
+		for i := 0; s.pos < len(s.data); {
+			s.skipSpace()
+			switch s.data[s.pos] {
+			case ']':
+				s.pos++
+				return
+			case ',':
+				s.pos++
+				continue
+			}
+			elemPath := fmt.Sprintf("%s/%d", path, i)
+			s.offsets[elemPath] = s.pos
+			s.value(elemPath)
+			i++
+		}
+	case '"':
+		s.str()
+	default:
+		for s.pos < len(s.data) && strings.IndexByte(",]} \t\r\n", s.data[s.pos]) == -1 {
+			s.pos++
+		}
+	}
+}
+
+// str consumes and returns the JSON string at the current position.
+func (s *jsonOffsetScanner) str() string {
+	start := s.pos
+	for s.pos++; s.pos < len(s.data); s.pos++ {
+		if s.data[s.pos] == '\\' {
+			s.pos++
+		} else if s.data[s.pos] == '"' {
+			s.pos++
+			break
+		}
+	}
+	var v string
+	json.Unmarshal(s.data[start:s.pos], &v)
+	return v
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	tests := map[string]struct {
+		srcfile string
+		want    []string
+	}{
+		"valid": {
+			srcfile: `{"Scanners": [{"Toolchain": "t", "Subcmd": "scan"}], "SkipDirs": ["vendor"]}`,
+		},
+		"syntax error": {
+			srcfile: "{\n  \"SkipDirs\": [\"a\",]\n}",
+			want:    []string{"Srcfile:2:"},
+		},
+		"type error": {
+			srcfile: "{\n  \"SkipDirs\": \"a\"\n}",
+			want:    []string{"Srcfile:2:"},
+		},
+		"unknown and misspelled keys": {
+			srcfile: "// comment\n{\n  \"SkipDir\": [],\n  \"skipunits\": []\n}",
+			want: []string{
+				`Srcfile:3:3: unknown key "SkipDir"`,
+				`Srcfile:4:3: key "skipunits" should be spelled "SkipUnits"`,
+			},
+		},
+		"scanners": {
+			srcfile: "{\"Scanners\": [\n  {\"Toolchain\": \"missing\", \"Subcmd\": \"scan\"},\n  {\"Subcmd\": \"scan\", \"Foo\": 1}\n]}",
+			want: []string{
+				`Srcfile:2:4: toolchain "missing" is not installed`,
+				`Srcfile:3:3: scanner has no Toolchain`,
+				`Srcfile:3:22: unknown key "Foo"`,
+			},
+		},
+		"graph post-processors": {
+			srcfile: "{\"GraphPostProcessors\": [\n  {\"Toolchain\": \"missing\", \"Subcmd\": \"pp\"},\n  {\"Toolchain\": \"t\"}\n]}",
+			want: []string{
+				`Srcfile:2:4: toolchain "missing" is not installed`,
+				`Srcfile:3:3: graph post-processor has no Subcmd`,
+			},
+		},
+		"source units": {
+			srcfile: `{"SourceUnits": [
+  {"Name": "a", "Type": "t", "Files": ["[a-"]},
+  {"Name": "a", "Type": "t", "Files": ["../x"]}
+],
+"SkipUnits": [{"Name": "a", "Type": "t"}],
+"SkipDirs": ["/abs"]
+}`,
+			want: []string{
+				`Srcfile:2:40: malformed glob "[a-"`,
+				`Srcfile:3:3: source unit t "a" is defined more than once (also at line 2)`,
+				`Srcfile:3:40: invalid file path`,
+				`Srcfile:5:15: source unit t "a" is skipped but is also defined in SourceUnits (at line 2)`,
+				`Srcfile:6:14: SkipDirs entry "/abs" is outside of the repository`,
+			},
+		},
+		"unit overrides": {
+			srcfile: `{"UnitOverrides": [
+  {"Name": "a/*", "Env": ["GOOS=linux", "BAD"], "ExcludeFiles": ["[x"]},
+  {"Name": "a/*", "Env": ["GOOS=darwin"], "Config": {"n": 1}, "Bogus": true}
+]}`,
+			want: []string{
+				`Srcfile:2:41: environment variable "BAD" must be of the form NAME=value`,
+				`Srcfile:2:66: malformed glob "[x"`,
+				`Srcfile:3:27: unit override sets environment variable "GOOS" to darwin, which conflicts with the override at line 2`,
+				`Srcfile:3:54: Config value for "n" must be a string`,
+				`Srcfile:3:63: unknown key "Bogus"`,
+			},
+		},
+		"coverage scorer": {
+			srcfile: `{"CoverageScorer": "unknown"}`,
+			want:    []string{`Srcfile:1:2: coverage scorer "unknown" is not registered`},
+		},
+	}
+
+	opt := LintOptions{
+		ToolchainInstalled:       func(path string) bool { return path != "missing" },
+		CoverageScorerRegistered: func(name string) bool { return name == "density" },
+	}
+	for label, test := range tests {
+		dir, err := ioutil.TempDir("", "srclib-lint")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		if err := ioutil.WriteFile(filepath.Join(dir, Filename), []byte(test.srcfile), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		errs, err := Lint(dir, opt)
+		if err != nil {
+			t.Errorf("%s: Lint: %s", label, err)
+			continue
+		}
+		if len(errs) != len(test.want) {
+			t.Errorf("%s: got %d errors %v, want %d", label, len(errs), errs, len(test.want))
+			continue
+		}
+		for i, e := range errs {
+			if got, want := e.Error(), filepath.Join(dir, test.want[i]); len(got) < len(want) || got[:len(want)] != want {
+				t.Errorf("%s: got error %q, want prefix %q", label, got, want)
+			}
+		}
+	}
+}
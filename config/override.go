@@ -0,0 +1,121 @@
+package config
+
+import (
+	"path"
+	"path/filepath"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// A UnitOverride specifies settings for the source units that it
+// matches, in addition to (and taking precedence over) the settings
+// for the whole tree. It lets units in the same repository (e.g., in
+// a polyglot monorepo) be built with different settings.
+type UnitOverride struct {
+	// Name is the name of the source units that this override applies
+	// to. It may be a glob pattern (as accepted by path.Match).
+	Name string
+
+	// Type is the type of the source units that this override applies
+	// to. If empty, the override applies to units of any type.
+	Type string `json:",omitempty"`
+
+	// Config is merged into each matching unit's Config, replacing any
+	// existing values. Toolchains read unit-specific settings (such as
+	// build tags or the JDK or Python version) from it. Only string
+	// values are supported.
+	Config map[string]interface{} `json:",omitempty"`
+
+	// Env is a list of extra environment variables ("NAME=value") to
+	// set when running the graph and depresolve tools on each
+	// matching unit.
+	Env []string `json:",omitempty"`
+
+	// ExcludeFiles is a list of glob patterns of files to remove from
+	// each matching unit's Files.
+	ExcludeFiles []string `json:",omitempty"`
+
+	// Owners, if set, replaces each matching unit's Owners (such as
+	// "@org/team").
+	Owners []string `json:",omitempty"`
+
+	// Tags is a list of labels to add to each matching unit's Tags.
+	Tags []string `json:",omitempty"`
+
+	// Metadata is merged into each matching unit's Metadata,
+	// replacing any existing values.
+	Metadata map[string]string `json:",omitempty"`
+}
+
+// Matches reports whether o applies to u.
+func (o *UnitOverride) Matches(u *unit.SourceUnit) bool {
+	if o.Type != "" && o.Type != u.Type {
+		return false
+	}
+	if o.Name == u.Name {
+		return true
+	}
+	match, _ := path.Match(o.Name, u.Name)
+	return match
+}
+
+// Apply applies o's settings to u. The caller should check that o
+// matches u.
+func (o *UnitOverride) Apply(u *unit.SourceUnit) {
+	for k, v := range o.Config {
+		if vstr, isStr := v.(string); isStr {
+			if u.Config == nil {
+				u.Config = make(map[string]string)
+			}
+			u.Config[k] = vstr
+		}
+	}
+
+	u.Env = append(u.Env, o.Env...)
+
+	if len(o.ExcludeFiles) > 0 {
+		files := u.Files[:0]
+		for _, f := range u.Files {
+			if !matchAny(o.ExcludeFiles, f) {
+				files = append(files, f)
+			}
+		}
+		u.Files = files
+	}
+
+	if len(o.Owners) > 0 {
+		u.Owners = append([]string(nil), o.Owners...)
+	}
+	for _, t := range o.Tags {
+		if !u.HasTag(t) {
+			u.Tags = append(u.Tags, t)
+		}
+	}
+	for k, v := range o.Metadata {
+		if u.Metadata == nil {
+			u.Metadata = make(map[string]string)
+		}
+		u.Metadata[k] = v
+	}
+}
+
+// ApplyUnitOverrides applies each of the tree's unit overrides that
+// matches u to u, in the order in which they are listed.
+func (c *Tree) ApplyUnitOverrides(u *unit.SourceUnit) {
+	for _, o := range c.UnitOverrides {
+		if o.Matches(u) {
+			o.Apply(u)
+		}
+	}
+}
+
+// matchAny reports whether file matches any of the glob patterns.
+func matchAny(patterns []string, file string) bool {
+	file = filepath.ToSlash(file)
+	for _, p := range patterns {
+		if match, _ := path.Match(filepath.ToSlash(p), file); match {
+			return true
+		}
+	}
+	return false
+}
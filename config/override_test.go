@@ -0,0 +1,48 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestTree_ApplyUnitOverrides(t *testing.T) {
+	tree := &Tree{UnitOverrides: []*UnitOverride{
+		{Name: "cmd/*", Type: "GoPackage", Config: map[string]interface{}{"BuildTags": "a b"}, Env: []string{"GOOS=linux"}},
+		{Name: "cmd/foo", ExcludeFiles: []string{"cmd/foo/*_gen.go"}, Env: []string{"CGO_ENABLED=0"}},
+		{Name: "cmd/*", Type: "JavaArtifact", Config: map[string]interface{}{"JDK": "8"}},
+		{Name: "cmd/*", Owners: []string{"@org/cli"}, Tags: []string{"cmd"}, Metadata: map[string]string{"tier": "1"}},
+	}}
+
+	u := &unit.SourceUnit{
+		Key:  unit.Key{Name: "cmd/foo", Type: "GoPackage"},
+		Info: unit.Info{Files: []string{"cmd/foo/foo.go", "cmd/foo/foo_gen.go"}},
+	}
+	tree.ApplyUnitOverrides(u)
+
+	if want := []string{"cmd/foo/foo.go"}; !reflect.DeepEqual(u.Files, want) {
+		t.Errorf("got Files %v, want %v", u.Files, want)
+	}
+	if want := []string{"GOOS=linux", "CGO_ENABLED=0"}; !reflect.DeepEqual(u.Env, want) {
+		t.Errorf("got Env %v, want %v", u.Env, want)
+	}
+	if got, want := u.Config["BuildTags"], "a b"; got != want {
+		t.Errorf("got BuildTags config %q, want %q", got, want)
+	}
+	if want := map[string]string{"BuildTags": "a b"}; !reflect.DeepEqual(u.Config, want) {
+		t.Errorf("got Config %v, want %v (without the Env)", u.Config, want)
+	}
+	if _, present := u.Config["JDK"]; present {
+		t.Error("override for a different unit type was applied")
+	}
+	if want := []string{"@org/cli"}; !reflect.DeepEqual(u.Owners, want) {
+		t.Errorf("got Owners %v, want %v", u.Owners, want)
+	}
+	if want := []string{"cmd"}; !reflect.DeepEqual(u.Tags, want) {
+		t.Errorf("got Tags %v, want %v", u.Tags, want)
+	}
+	if got, want := u.Metadata["tier"], "1"; got != want {
+		t.Errorf("got tier metadata %q, want %q", got, want)
+	}
+}
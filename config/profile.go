@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib"
+)
+
+// A Profile is a named set of settings in the Srcfile that is applied
+// on top of the Srcfile's other settings when it is selected (e.g.,
+// with "srclib make --profile=NAME"). Profiles let the same
+// repository have, for example, a fast local build and an exhaustive
+// CI build.
+type Profile struct {
+	// Scanners, if set, replaces the Srcfile's Scanners, which
+	// selects the toolchains used to build the repository.
+	Scanners []*srclib.ToolRef `json:",omitempty"`
+
+	// SkipDirs, SkipUnits, and UnitOverrides are added to the
+	// Srcfile's corresponding settings.
+	SkipDirs      []string                      `json:",omitempty"`
+	SkipUnits     []struct{ Name, Type string } `json:",omitempty"`
+	UnitOverrides []*UnitOverride               `json:",omitempty"`
+
+	// Config is merged into the Srcfile's Config, replacing existing
+	// values.
+	Config map[string]interface{} `json:",omitempty"`
+
+	// Jobs is the default number of parallel jobs for "srclib make".
+	Jobs int `json:",omitempty"`
+
+	// MaxUnits, if positive, is the maximum number of source units
+	// that are built.
+	MaxUnits int `json:",omitempty"`
+}
+
+// Profile returns the profile with the given name.
+func (c *Repository) Profile(name string) (*Profile, error) {
+	if p, present := c.Profiles[name]; present && p != nil {
+		return p, nil
+	}
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no profile named %q (the Srcfile defines no profiles)", name)
+	}
+	return nil, fmt.Errorf("no profile named %q (profiles are: %s)", name, strings.Join(names, ", "))
+}
+
+// ApplyProfile applies the settings of the named profile to c.
+func (c *Repository) ApplyProfile(name string) error {
+	p, err := c.Profile(name)
+	if err != nil {
+		return err
+	}
+	if p.Scanners != nil {
+		c.Scanners = p.Scanners
+	}
+	c.SkipDirs = append(c.SkipDirs, p.SkipDirs...)
+	c.SkipUnits = append(c.SkipUnits, p.SkipUnits...)
+	c.UnitOverrides = append(c.UnitOverrides, p.UnitOverrides...)
+	if len(p.Config) > 0 {
+		// Copy c.Config, which may be shared (e.g., with copies of
+		// c or the source units that it was applied to), before
+		// merging into it.
+		config := make(map[string]interface{}, len(c.Config)+len(p.Config))
+		for k, v := range c.Config {
+			config[k] = v
+		}
+		for k, v := range p.Config {
+			config[k] = v
+		}
+		c.Config = config
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib"
+)
+
+func TestRepository_ApplyProfile(t *testing.T) {
+	ciScanners := []*srclib.ToolRef{{Toolchain: "t2", Subcmd: "scan"}}
+	c := &Repository{
+		Profiles: map[string]*Profile{
+			"local": {SkipDirs: []string{"testdata"}, Config: map[string]interface{}{"mode": "fast"}, MaxUnits: 10},
+			"ci":    {Scanners: ciScanners},
+		},
+		Tree: Tree{
+			Scanners: []*srclib.ToolRef{{Toolchain: "t1", Subcmd: "scan"}},
+			SkipDirs: []string{"vendor"},
+			Config:   map[string]interface{}{"mode": "full", "x": "y"},
+		},
+	}
+
+	local := *c
+	if err := local.ApplyProfile("local"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"vendor", "testdata"}; !reflect.DeepEqual(local.SkipDirs, want) {
+		t.Errorf("got SkipDirs %v, want %v", local.SkipDirs, want)
+	}
+	if want := map[string]interface{}{"mode": "fast", "x": "y"}; !reflect.DeepEqual(local.Config, want) {
+		t.Errorf("got Config %v, want %v", local.Config, want)
+	}
+	if want := map[string]interface{}{"mode": "full", "x": "y"}; !reflect.DeepEqual(c.Config, want) {
+		t.Errorf("got original Config %v after applying a profile to a copy, want %v", c.Config, want)
+	}
+	if !reflect.DeepEqual(local.Scanners, c.Scanners) {
+		t.Errorf("got Scanners %v, want unchanged", local.Scanners)
+	}
+
+	ci := *c
+	if err := ci.ApplyProfile("ci"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ci.Scanners, ciScanners) {
+		t.Errorf("got Scanners %v, want %v", ci.Scanners, ciScanners)
+	}
+
+	if err := c.ApplyProfile("nonexistent"); err == nil {
+		t.Error("got no error applying a nonexistent profile")
+	}
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// ApplyRepoTags adds the repository's Tags to u's Tags and its
+// Metadata to u's Metadata, keeping the values that u already has.
+func (c *Repository) ApplyRepoTags(u *unit.SourceUnit) {
+	for _, t := range c.Tags {
+		if !u.HasTag(t) {
+			u.Tags = append(u.Tags, t)
+		}
+	}
+	for k, v := range c.Metadata {
+		if _, present := u.Metadata[k]; present {
+			continue
+		}
+		if u.Metadata == nil {
+			u.Metadata = make(map[string]string)
+		}
+		u.Metadata[k] = v
+	}
+}
+
+// ParseMetadata parses metadata given as "KEY=VALUE" pairs (e.g., on
+// the command line) into a map.
+func ParseMetadata(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	m := make(map[string]string, len(pairs))
+	for _, p := range pairs {
+		i := strings.Index(p, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid metadata %q (expected KEY=VALUE)", p)
+		}
+		m[p[:i]] = p[i+1:]
+	}
+	return m, nil
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestRepository_ApplyRepoTags(t *testing.T) {
+	c := &Repository{
+		Tags:     []string{"payments", "frontend"},
+		Metadata: map[string]string{"team": "checkout", "tier": "1"},
+	}
+	u := &unit.SourceUnit{
+		Key:  unit.Key{Name: "u", Type: "t"},
+		Info: unit.Info{Tags: []string{"frontend"}, Metadata: map[string]string{"tier": "2"}},
+	}
+	c.ApplyRepoTags(u)
+
+	if want := []string{"frontend", "payments"}; !reflect.DeepEqual(u.Tags, want) {
+		t.Errorf("got Tags %v, want %v", u.Tags, want)
+	}
+	if want := map[string]string{"team": "checkout", "tier": "2"}; !reflect.DeepEqual(u.Metadata, want) {
+		t.Errorf("got Metadata %v, want %v", u.Metadata, want)
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	m, err := ParseMetadata([]string{"team=checkout", "url=http://x?a=b", "empty="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"team": "checkout", "url": "http://x?a=b", "empty": ""}; !reflect.DeepEqual(m, want) {
+		t.Errorf("got %v, want %v", m, want)
+	}
+	for _, bad := range []string{"team", "=x"} {
+		if _, err := ParseMetadata([]string{bad}); err == nil {
+			t.Errorf("%q: got no error", bad)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+	"sourcegraph.com/sourcegraph/srclib/util"
+)
+
+// SymlinkPolicy returns the tree's symlink policy (see Symlinks). An
+// invalid policy is reported by validate, so it is treated as the
+// default here.
+func (c *Tree) SymlinkPolicy() util.SymlinkPolicy {
+	p, err := util.ParseSymlinkPolicy(c.Symlinks)
+	if err != nil {
+		return util.IgnoreSymlinks
+	}
+	return p
+}
+
+// ApplySymlinkPolicy applies the tree's symlink policy to u's Files
+// (which are relative to root): with the "ignore" policy, files whose
+// paths contain a symbolic link are removed; with "follow", those
+// whose targets are outside root are removed, as are files that are
+// the same as an earlier file (e.g., through a symlinked directory);
+// and with "error", a *util.SymlinkError is returned for the first
+// such file.
+func (c *Tree) ApplySymlinkPolicy(root string, u *unit.SourceUnit) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	policy := c.SymlinkPolicy()
+	seen := make(map[string]struct{}, len(u.Files))
+	files := u.Files[:0]
+	for _, f := range u.Files {
+		real, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(f)))
+		if os.IsNotExist(err) {
+			files = append(files, f) // let the grapher report it
+			continue
+		} else if err != nil {
+			return err
+		}
+		if rel, err := filepath.Rel(realRoot, real); err != nil || rel != filepath.Clean(filepath.FromSlash(f)) {
+			// The file's path contains a symlink.
+			switch policy {
+			case util.ErrorOnSymlinks:
+				return &util.SymlinkError{Path: f}
+			case util.FollowSymlinks:
+				if !util.IsWithin(realRoot, real) {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+		if _, dup := seen[real]; dup {
+			continue
+		}
+		seen[real] = struct{}{}
+		files = append(files, f)
+	}
+	u.Files = files
+	return nil
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+	"sourcegraph.com/sourcegraph/srclib/util"
+)
+
+func TestTree_ApplySymlinkPolicy(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "srclib-symlinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	root := filepath.Join(tmp, "root")
+	if err := os.MkdirAll(filepath.Join(root, "vendor"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"root/a.go", "root/vendor/v.go", "o.go"} {
+		if err := ioutil.WriteFile(filepath.Join(tmp, file), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{"root/v": "vendor", "root/o.go": "../o.go"} {
+		if err := os.Symlink(target, filepath.Join(tmp, link)); err != nil {
+			t.Skip("symlinks not supported:", err)
+		}
+	}
+
+	newUnit := func() *unit.SourceUnit {
+		return &unit.SourceUnit{Info: unit.Info{Files: []string{"a.go", "vendor/v.go", "v/v.go", "o.go"}}}
+	}
+	tests := map[string][]string{
+		"":       {"a.go", "vendor/v.go"},
+		"ignore": {"a.go", "vendor/v.go"},
+		"follow": {"a.go", "vendor/v.go"}, // v/v.go is a duplicate; o.go is outside
+	}
+	for policy, want := range tests {
+		tree := &Tree{Symlinks: policy}
+		u := newUnit()
+		if err := tree.ApplySymlinkPolicy(root, u); err != nil {
+			t.Errorf("%q: %s", policy, err)
+			continue
+		}
+		if !reflect.DeepEqual(u.Files, want) {
+			t.Errorf("%q: got files %v, want %v", policy, u.Files, want)
+		}
+	}
+
+	tree := &Tree{Symlinks: "error"}
+	if err := tree.ApplySymlinkPolicy(root, newUnit()); !util.IsSymlinkError(err) {
+		t.Errorf("got error %v, want *util.SymlinkError", err)
+	}
+}
+
+func TestTree_validate_symlinks(t *testing.T) {
+	if err := (&Tree{Symlinks: "follow"}).validate(); err != nil {
+		t.Error(err)
+	}
+	if err := (&Tree{Symlinks: "sometimes"}).validate(); err == nil {
+		t.Error("got no error for invalid symlink policy")
+	}
+}
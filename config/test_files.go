@@ -0,0 +1,40 @@
+package config
+
+import (
+	"path"
+	"path/filepath"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// IsTestFile reports whether file (relative to the repository root)
+// contains test code, either by the conventions of its language (see
+// graph.IsTestFile) or because it (or a directory containing it)
+// matches one of the tree's TestFiles patterns.
+func (c *Tree) IsTestFile(file string) bool {
+	file = filepath.ToSlash(file)
+	if graph.IsTestFile(file) {
+		return true
+	}
+	for p := file; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		if matchAny(c.TestFiles, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// TagTestUnit adds unit.TestTag to u's Tags if all of u's files are
+// test files (see IsTestFile).
+func (c *Tree) TagTestUnit(u *unit.SourceUnit) {
+	if len(u.Files) == 0 || u.HasTag(unit.TestTag) {
+		return
+	}
+	for _, f := range u.Files {
+		if !c.IsTestFile(f) {
+			return
+		}
+	}
+	u.Tags = append(u.Tags, unit.TestTag)
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestTree_IsTestFile(t *testing.T) {
+	tree := &Tree{TestFiles: []string{"integration", "*/e2e_*.go"}}
+	tests := map[string]bool{
+		"foo.go":                 false,
+		"foo_test.go":            true,
+		"integration/foo.go":     true,
+		"integration/sub/foo.go": true,
+		"pkg/integration.go":     false,
+		"pkg/e2e_foo.go":         true,
+		"pkg/sub/e2e_foo.go":     false,
+	}
+	for file, want := range tests {
+		if got := tree.IsTestFile(file); got != want {
+			t.Errorf("%s: got %v, want %v", file, got, want)
+		}
+	}
+}
+
+func TestTree_TagTestUnit(t *testing.T) {
+	tree := &Tree{TestFiles: []string{"it"}}
+	tests := []struct {
+		files    []string
+		wantTags []string
+	}{
+		{files: nil, wantTags: nil},
+		{files: []string{"a.go", "a_test.go"}, wantTags: nil},
+		{files: []string{"a_test.go", "it/b.go"}, wantTags: []string{unit.TestTag}},
+	}
+	for _, test := range tests {
+		u := &unit.SourceUnit{Info: unit.Info{Files: test.files}}
+		tree.TagTestUnit(u)
+		if !reflect.DeepEqual(u.Tags, test.wantTags) {
+			t.Errorf("%v: got tags %v, want %v", test.files, u.Tags, test.wantTags)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"path/filepath"
 	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/util"
 )
 
 var (
@@ -13,6 +15,9 @@ var (
 )
 
 func (c *Tree) validate() error {
+	if _, err := util.ParseSymlinkPolicy(c.Symlinks); err != nil {
+		return err
+	}
 	for _, u := range c.SourceUnits {
 		for _, p := range u.Files {
 			p = filepath.Clean(p)
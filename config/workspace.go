@@ -0,0 +1,85 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// A Workspace lists multiple repository checkouts (e.g., a fleet of
+// microservice repositories) that srclib commands run with
+// --workspace operate on together, aggregating their results.
+//
+// A workspace file is JSON (in which lines beginning with "//" are
+// comments) or, if its name ends in ".yml" or ".yaml", YAML.
+type Workspace struct {
+	// Repos lists the repositories in the workspace, in the order in
+	// which they are processed.
+	Repos []*WorkspaceRepo
+
+	// File is the file that the workspace was read from.
+	File string `json:"-"`
+}
+
+// A WorkspaceRepo is a repository checkout in a workspace.
+type WorkspaceRepo struct {
+	// Path is the directory of the checkout. A relative path is
+	// relative to the directory containing the workspace file.
+	// ReadWorkspace makes it absolute.
+	Path string
+
+	// URI is the repository's URI (e.g., "github.com/foo/bar"). If
+	// empty, it is determined from the checkout's VCS remotes (or its
+	// Srcfile's CloneURL), as it is for a single repository.
+	URI string `json:",omitempty"`
+}
+
+// ReadWorkspace reads and validates a workspace file.
+func ReadWorkspace(file string) (*Workspace, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if IsYAML(file) {
+		if data, err = ConvertToJSON(file, data); err != nil {
+			return nil, err
+		}
+	} else {
+		data = stripComments(data)
+	}
+	var w Workspace
+	if err := json.Unmarshal(data, &w); err != nil {
+		return nil, decodeError(file, data, err)
+	}
+	w.File = file
+
+	if len(w.Repos) == 0 {
+		return nil, &Error{File: file, Msg: "workspace lists no Repos"}
+	}
+	seen := make(map[string]struct{}, len(w.Repos))
+	for i, r := range w.Repos {
+		if r == nil || r.Path == "" {
+			return nil, &Error{File: file, Msg: fmt.Sprintf("Repos[%d] has no Path", i)}
+		}
+		if !filepath.IsAbs(r.Path) {
+			r.Path = filepath.Join(filepath.Dir(file), filepath.FromSlash(r.Path))
+		}
+		r.Path, err = filepath.Abs(r.Path)
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := seen[r.Path]; dup {
+			return nil, &Error{File: file, Msg: fmt.Sprintf("Repos[%d]: duplicate Path %s", i, r.Path)}
+		}
+		seen[r.Path] = struct{}{}
+		if r.URI != "" {
+			if _, err := graph.TryMakeURI(r.URI); err != nil {
+				return nil, &Error{File: file, Msg: fmt.Sprintf("Repos[%d]: invalid URI %q: %s", i, r.URI, err)}
+			}
+		}
+	}
+	return &w, nil
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadWorkspace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-workspace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		data    string
+		wantErr bool
+	}{
+		"ok": {data: `// Our services.
+{
+  "Repos": [
+    {"Path": "svc/a", "URI": "github.com/org/a"},
+    {"Path": "/abs/b"}
+  ]
+}`},
+		"no repos":     {data: `{"Repos": []}`, wantErr: true},
+		"no path":      {data: `{"Repos": [{"URI": "github.com/org/a"}]}`, wantErr: true},
+		"dup path":     {data: `{"Repos": [{"Path": "a"}, {"Path": "./a"}]}`, wantErr: true},
+		"invalid URI":  {data: `{"Repos": [{"Path": "a", "URI": "a"}]}`, wantErr: true},
+		"syntax error": {data: `{"Repos": [}`, wantErr: true},
+	}
+	for label, test := range tests {
+		file := filepath.Join(dir, "workspace.json")
+		if err := ioutil.WriteFile(file, []byte(test.data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		w, err := ReadWorkspace(file)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: got nil error, want error", label)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		if len(w.Repos) != 2 {
+			t.Fatalf("%s: got %d repos, want 2", label, len(w.Repos))
+		}
+		if want := filepath.Join(dir, "svc", "a"); w.Repos[0].Path != want {
+			t.Errorf("%s: got repo 0 path %q, want %q", label, w.Repos[0].Path, want)
+		}
+		if want := filepath.FromSlash("/abs/b"); w.Repos[1].Path != want {
+			t.Errorf("%s: got repo 1 path %q, want %q", label, w.Repos[1].Path, want)
+		}
+	}
+}
@@ -1,16 +1,112 @@
 package cvg
 
+import (
+	"fmt"
+	"math"
+)
+
 type Coverage struct {
 	FileScore         float64  // % files successfully processed
 	RefScore          float64  // % internal refs that resolve to a def
 	TokDensity        float64  // average number of refs/defs per LoC
+	DocScore          float64  // % exported defs that have docs
 	UncoveredFiles    []string `json:",omitempty"` // files for which srclib data was not successfully generated (best-effort guess)
 	UndiscoveredFiles []string `json:",omitempty"` // files weren't detected by toolchain(s) (best-effort guess)
+
+	// Counts are the counts that the scores were computed from. They
+	// are used to combine the coverage of multiple repositories (see
+	// Combine).
+	Counts *Counts `json:",omitempty"`
+}
+
+// Counts are the numbers of files, defs, refs, and lines of code in
+// one language that coverage scores are computed from.
+type Counts struct {
+	Files         int // files listed in source units
+	IndexedFiles  int // listed files with enough defs and refs per LoC
+	Defs          int
+	Refs          int
+	ValidRefs     int // refs that resolve to a def
+	AmbiguousRefs int // valid refs with several candidate defs, resolved to the top one
+	Exported      int // exported defs
+	Documented    int // exported defs that have docs
+	LoC           int
+}
+
+// Add adds the counts in m to n.
+func (n *Counts) Add(m *Counts) {
+	n.Files += m.Files
+	n.IndexedFiles += m.IndexedFiles
+	n.Defs += m.Defs
+	n.Refs += m.Refs
+	n.ValidRefs += m.ValidRefs
+	n.AmbiguousRefs += m.AmbiguousRefs
+	n.Exported += m.Exported
+	n.Documented += m.Documented
+	n.LoC += m.LoC
 }
 
-func (c *Coverage) FileScorePass() bool  { return c.FileScore > 0.8 }
-func (c *Coverage) RefScorePass() bool   { return c.RefScore > 0.95 }
-func (c *Coverage) TokDensityPass() bool { return c.TokDensity > 1.0 }
+// FromCounts returns the coverage computed from n. Scores whose
+// denominator is zero are -1.
+func FromCounts(n *Counts) *Coverage {
+	return &Coverage{
+		FileScore:  divideSentinel(float64(n.IndexedFiles), float64(n.Files), -1),
+		RefScore:   divideSentinel(float64(n.ValidRefs), float64(n.Refs), -1),
+		TokDensity: divideSentinel(float64(n.Defs+n.Refs), float64(n.LoC), -1),
+		DocScore:   divideSentinel(float64(n.Documented), float64(n.Exported), -1),
+		Counts:     n,
+	}
+}
+
+func divideSentinel(x, y, sentinel float64) float64 {
+	q := x / y
+	if math.IsNaN(q) {
+		return sentinel
+	}
+	return q
+}
+
+// Combine returns the coverage of all of the code covered by covs
+// (e.g., the coverage of one language in each of several
+// repositories), computed from their total counts. Coverages without
+// Counts are ignored. The combined coverage doesn't list uncovered or
+// undiscovered files.
+func Combine(covs ...*Coverage) *Coverage {
+	var total Counts
+	for _, c := range covs {
+		if c != nil && c.Counts != nil {
+			total.Add(c.Counts)
+		}
+	}
+	return FromCounts(&total)
+}
+
+// The scores above which coverage passes.
+const (
+	PassFileScore  = 0.8
+	PassRefScore   = 0.95
+	PassTokDensity = 1.0
+)
+
+func (c *Coverage) FileScorePass() bool  { return c.FileScore > PassFileScore }
+func (c *Coverage) RefScorePass() bool   { return c.RefScore > PassRefScore }
+func (c *Coverage) TokDensityPass() bool { return c.TokDensity > PassTokDensity }
+
+// Below returns descriptions of the scores in c that are below the
+// corresponding scores in min. Zero scores in min are not checked.
+func (c *Coverage) Below(min *Coverage) []string {
+	var below []string
+	check := func(name string, score, minScore float64) {
+		if minScore != 0 && score < minScore {
+			below = append(below, fmt.Sprintf("%s %.3f < %.3f", name, score, minScore))
+		}
+	}
+	check("FileScore", c.FileScore, min.FileScore)
+	check("RefScore", c.RefScore, min.RefScore)
+	check("TokDensity", c.TokDensity, min.TokDensity)
+	check("DocScore", c.DocScore, min.DocScore)
+	return below
+}
 
 // HasRegressed determines if coverage has regressed from one indexing
 // to the next.
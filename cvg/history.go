@@ -0,0 +1,103 @@
+package cvg
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	"golang.org/x/tools/godoc/vfs"
+	"sourcegraph.com/sourcegraph/rwvfs"
+)
+
+// RecordFilename is the name of the file, in a commit's build data
+// directory, that records the coverage computed for the commit (see
+// WriteRecord).
+const RecordFilename = "coverage.json"
+
+// A Record is the coverage of each language in a commit, as of the
+// last time that it was computed.
+type Record struct {
+	CommitID string
+	Time     time.Time // when the coverage was computed
+
+	// Coverage maps each language to its coverage.
+	Coverage map[string]*Coverage
+}
+
+// WriteRecord records r in bdfs, which should be a VFS obtained from a
+// call to (buildstore.RepoBuildStore).Commit, replacing any existing
+// record.
+func WriteRecord(bdfs rwvfs.FileSystem, r *Record) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := bdfs.Create(RecordFilename)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadRecord returns the coverage recorded in bdfs (see WriteRecord).
+// If none was recorded, it returns nil and no error.
+func ReadRecord(bdfs vfs.FileSystem) (*Record, error) {
+	f, err := bdfs.Open(RecordFilename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r Record
+	if err := json.NewDecoder(f).Decode(&r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// A TrendPoint is the coverage of one language in one commit.
+type TrendPoint struct {
+	CommitID string
+	Time     time.Time
+	*Coverage
+}
+
+// Trend returns the coverage of each language in the last n of the
+// records (by the time that they were computed, or all of them if n
+// is 0 or negative), oldest first. Languages that a record has no
+// coverage for have no point for its commit.
+func Trend(records []*Record, n int) map[string][]TrendPoint {
+	sorted := make([]*Record, 0, len(records))
+	for _, r := range records {
+		if r != nil {
+			sorted = append(sorted, r)
+		}
+	}
+	sort.Stable(recordsByTime(sorted))
+	if n > 0 && len(sorted) > n {
+		sorted = sorted[len(sorted)-n:]
+	}
+
+	trend := make(map[string][]TrendPoint)
+	for _, r := range sorted {
+		for lang, c := range r.Coverage {
+			if c == nil {
+				continue
+			}
+			trend[lang] = append(trend[lang], TrendPoint{CommitID: r.CommitID, Time: r.Time, Coverage: c})
+		}
+	}
+	return trend
+}
+
+type recordsByTime []*Record
+
+func (v recordsByTime) Len() int           { return len(v) }
+func (v recordsByTime) Less(i, j int) bool { return v[i].Time.Before(v[j].Time) }
+func (v recordsByTime) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
@@ -0,0 +1,70 @@
+package cvg
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+)
+
+func TestRecord(t *testing.T) {
+	fs := rwvfs.Map(map[string]string{})
+	if r, err := ReadRecord(fs); err != nil || r != nil {
+		t.Fatalf("got %+v, %v, want no record", r, err)
+	}
+
+	want := &Record{
+		CommitID: "c1",
+		Time:     time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC),
+		Coverage: map[string]*Coverage{"Go": FromCounts(&Counts{Files: 2, IndexedFiles: 1, LoC: 10})},
+	}
+	if err := WriteRecord(fs, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadRecord(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Time.Equal(want.Time) {
+		t.Errorf("got time %v, want %v", got.Time, want.Time)
+	}
+	got.Time = want.Time
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestTrend(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2015, 6, d, 0, 0, 0, 0, time.UTC) }
+	goCov, jsCov := &Coverage{FileScore: 1}, &Coverage{FileScore: 0.5}
+	records := []*Record{
+		{CommitID: "c3", Time: day(3), Coverage: map[string]*Coverage{"Go": goCov}},
+		{CommitID: "c1", Time: day(1), Coverage: map[string]*Coverage{"Go": goCov, "JavaScript": jsCov}},
+		{CommitID: "c2", Time: day(2), Coverage: map[string]*Coverage{"Go": goCov, "JavaScript": jsCov}},
+	}
+
+	commits := func(points []TrendPoint) []string {
+		var ids []string
+		for _, p := range points {
+			ids = append(ids, p.CommitID)
+		}
+		return ids
+	}
+
+	all := Trend(records, 0)
+	if got, want := commits(all["Go"]), []string{"c1", "c2", "c3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("all Go: got %v, want %v", got, want)
+	}
+	if got, want := commits(all["JavaScript"]), []string{"c1", "c2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("all JavaScript: got %v, want %v", got, want)
+	}
+
+	last := Trend(records, 2)
+	if got, want := commits(last["Go"]), []string{"c2", "c3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("last 2 Go: got %v, want %v", got, want)
+	}
+	if got, want := commits(last["JavaScript"]), []string{"c2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("last 2 JavaScript: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,96 @@
+package cvg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A File is the data about one source file that its coverage is
+// computed from.
+type File struct {
+	Path     string
+	Language string
+
+	LoC        int // lines of code (see Counts)
+	Defs       int
+	Refs       int
+	ValidRefs  int // refs that resolve to a def
+	Exported   int // exported defs
+	Documented int // exported defs that have docs
+}
+
+// A FileScorer decides whether srclib's analysis of a file is good
+// enough for the file to count as covered (i.e., as one of the
+// IndexedFiles that FileScore is computed from).
+//
+// Scorers other than the default (DefaultFileScorer) are registered
+// with RegisterFileScorer, typically in the init function of a package
+// that is linked into the srclib program, and are selected by name
+// with the Srcfile's CoverageScorer or "srclib coverage --scorer".
+type FileScorer interface {
+	Covered(f *File) bool
+}
+
+// FileScorerFunc adapts an ordinary function to a FileScorer.
+type FileScorerFunc func(f *File) bool
+
+// Covered calls s(f).
+func (s FileScorerFunc) Covered(f *File) bool { return s(f) }
+
+// DensityScorer is a FileScorer that considers files covered if they
+// have more than Threshold defs and valid refs per line of code.
+type DensityScorer struct {
+	Threshold float64
+}
+
+// Covered reports whether f has more than s.Threshold defs and valid
+// refs per line of code.
+func (s DensityScorer) Covered(f *File) bool {
+	return float64(f.Defs+f.ValidRefs)/float64(f.LoC) > s.Threshold
+}
+
+// DefaultFileScorer is the name of the FileScorer that is used when
+// none is selected: a DensityScorer with a threshold of 0.7.
+const DefaultFileScorer = "density"
+
+// fileScorers holds the registered FileScorers, keyed by name.
+var fileScorers = map[string]FileScorer{
+	DefaultFileScorer: DensityScorer{Threshold: 0.7},
+}
+
+// RegisterFileScorer makes a FileScorer available by name. If
+// RegisterFileScorer is called twice with the same name or if s is
+// nil, it panics.
+func RegisterFileScorer(name string, s FileScorer) {
+	if s == nil {
+		panic("cvg: RegisterFileScorer scorer is nil")
+	}
+	if _, dup := fileScorers[name]; dup {
+		panic("cvg: RegisterFileScorer called twice for scorer " + name)
+	}
+	fileScorers[name] = s
+}
+
+// LookupFileScorer returns the registered FileScorer with the given
+// name, or the default FileScorer if name is empty.
+func LookupFileScorer(name string) (FileScorer, error) {
+	if name == "" {
+		name = DefaultFileScorer
+	}
+	if s, present := fileScorers[name]; present {
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown coverage scorer %q (registered scorers are: %s)", name, strings.Join(FileScorerNames(), ", "))
+}
+
+// FileScorerNames returns the names of the registered FileScorers,
+// sorted.
+func FileScorerNames() []string {
+	names := make([]string, 0, len(fileScorers))
+	for name := range fileScorers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
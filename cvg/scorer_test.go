@@ -0,0 +1,29 @@
+package cvg
+
+import "testing"
+
+func TestLookupFileScorer(t *testing.T) {
+	s, err := LookupFileScorer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Covered(&File{LoC: 10, Defs: 4, ValidRefs: 4}) {
+		t.Error("default scorer: file with density 0.8 not covered")
+	}
+	if s.Covered(&File{LoC: 10, Defs: 2, Refs: 10, ValidRefs: 2}) {
+		t.Error("default scorer: file with density 0.4 covered")
+	}
+
+	RegisterFileScorer("test-refs-per-line", FileScorerFunc(func(f *File) bool { return f.ValidRefs >= f.LoC }))
+	s, err = LookupFileScorer("test-refs-per-line")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Covered(&File{LoC: 10, ValidRefs: 10}) || s.Covered(&File{LoC: 10, Defs: 20, ValidRefs: 9}) {
+		t.Error("registered scorer not used")
+	}
+
+	if _, err := LookupFileScorer("unknown"); err == nil {
+		t.Error("got no error for unknown scorer")
+	}
+}
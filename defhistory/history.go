@@ -0,0 +1,333 @@
+// Package defhistory tracks the identity of defs across the commits
+// of a repository, so that a def can be followed as it moves (to a
+// different file, def path, or source unit) and the commits at which
+// it appeared, moved, and was deleted can be listed.
+//
+// A History is built by adding the defs at each commit, oldest first
+// (see (*History).Add). A def at a commit is the same def as one at
+// the previous commit if they have the same key or, failing that, if
+// they are similar enough (see similarity). The History is persisted
+// in the repository's build data directory (see Read and Write), so
+// that it can be extended with new commits incrementally.
+package defhistory
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// An EventType is the type of an Event in a def's history.
+type EventType string
+
+const (
+	// Appeared is the type of events for a def that was added (or,
+	// after being deleted, re-added).
+	Appeared EventType = "appeared"
+
+	// Moved is the type of events for a def whose key or file
+	// changed.
+	Moved EventType = "moved"
+
+	// Deleted is the type of events for a def that was removed.
+	Deleted EventType = "deleted"
+)
+
+// An Event is a change to a def at a commit.
+type Event struct {
+	Type     EventType
+	CommitID string
+
+	// Key is the def's key (without its Repo and CommitID) after the
+	// event. For Deleted events, it is the def's last key.
+	Key graph.DefKey
+
+	// Name, Kind, and File are those of the def after the event (or,
+	// for Deleted events, before it).
+	Name string `json:",omitempty"`
+	Kind string `json:",omitempty"`
+	File string `json:",omitempty"`
+
+	// From and FromFile are the def's key and file before a Moved
+	// event.
+	From     *graph.DefKey `json:",omitempty"`
+	FromFile string        `json:",omitempty"`
+}
+
+// A Lineage is the history of a single def, which may have had
+// different keys at different commits. Its first event is an Appeared
+// event.
+type Lineage struct {
+	Events []*Event
+}
+
+// Last returns the lineage's most recent event.
+func (l *Lineage) Last() *Event { return l.Events[len(l.Events)-1] }
+
+// Deleted reports whether the def was deleted as of the last commit
+// in the history.
+func (l *Lineage) Deleted() bool { return l.Last().Type == Deleted }
+
+// HasKey reports whether the def has ever had a key that matches
+// key. Empty fields of key match any value.
+func (l *Lineage) HasKey(key graph.DefKey) bool {
+	for _, e := range l.Events {
+		if keyMatches(key, e.Key) || (e.From != nil && keyMatches(key, *e.From)) {
+			return true
+		}
+	}
+	return false
+}
+
+func keyMatches(pattern, key graph.DefKey) bool {
+	return (pattern.UnitType == "" || pattern.UnitType == key.UnitType) &&
+		(pattern.Unit == "" || pattern.Unit == key.Unit) &&
+		pattern.Path == key.Path
+}
+
+// A History records the lineages of the defs in a sequence of
+// commits.
+type History struct {
+	// Commits lists the IDs of the commits that have been added,
+	// oldest first.
+	Commits []string
+
+	// Lineages lists the lineages of all defs that have existed at
+	// any of the Commits, in order of first appearance.
+	Lineages []*Lineage
+}
+
+// Lookup returns the lineages of the defs that have ever had a key
+// that matches key (see (*Lineage).HasKey). Lineages of defs that
+// still exist are listed first.
+func (h *History) Lookup(key graph.DefKey) []*Lineage {
+	var live, deleted []*Lineage
+	for _, l := range h.Lineages {
+		if l.HasKey(key) {
+			if l.Deleted() {
+				deleted = append(deleted, l)
+			} else {
+				live = append(live, l)
+			}
+		}
+	}
+	return append(live, deleted...)
+}
+
+// Add adds the defs at the next commit to the history, recording
+// events for the defs that appeared, moved, or were deleted since the
+// previous commit. Local defs are ignored. Commits must be added in
+// order, oldest first.
+func (h *History) Add(commitID string, defs []*graph.Def) error {
+	return h.AddRenamed(commitID, defs, nil)
+}
+
+// AddRenamed is like Add, but renames maps the old path of each file
+// that was renamed since the previous commit to its new path. A def
+// in a renamed file is considered to be in the same file as before
+// when it is matched by similarity, so that it is recorded as moved
+// even if its def path changed too (as it does in languages whose def
+// paths include file names).
+func (h *History) AddRenamed(commitID string, defs []*graph.Def, renames map[string]string) error {
+	for _, c := range h.Commits {
+		if c == commitID {
+			return fmt.Errorf("commit %s is already in the def history", commitID)
+		}
+	}
+	h.Commits = append(h.Commits, commitID)
+
+	// The defs at the previous commit, by key.
+	prev := map[graph.DefKey]*Lineage{}
+	for _, l := range h.Lineages {
+		if !l.Deleted() {
+			prev[l.Last().Key] = l
+		}
+	}
+
+	// The defs at this commit, by key.
+	cur := map[graph.DefKey]*graph.Def{}
+	var curKeys []graph.DefKey
+	for _, d := range defs {
+		if d.Local {
+			continue
+		}
+		k := historyKey(d.DefKey)
+		if _, dup := cur[k]; dup {
+			continue
+		}
+		cur[k] = d
+		curKeys = append(curKeys, k)
+	}
+	sort.Sort(defKeys(curKeys))
+
+	// Match defs with the same key.
+	var added []graph.DefKey
+	for _, k := range curKeys {
+		d := cur[k]
+		l, ok := prev[k]
+		if !ok {
+			added = append(added, k)
+			continue
+		}
+		delete(prev, k)
+		if last := l.Last(); last.File != d.File {
+			l.Events = append(l.Events, newEvent(Moved, commitID, k, d, &last.Key, last.File))
+		}
+	}
+	var removed []graph.DefKey
+	for k := range prev {
+		removed = append(removed, k)
+	}
+	sort.Sort(defKeys(removed))
+
+	// Match the remaining defs by similarity, most similar pairs
+	// first.
+	var pairs []*candidate
+	for i, pk := range removed {
+		for j, ck := range added {
+			if score := similarity(prev[pk].Last(), ck, cur[ck], renames); score >= minSimilarity {
+				pairs = append(pairs, &candidate{prev: i, cur: j, score: score})
+			}
+		}
+	}
+	sort.Stable(byScore(pairs))
+	prevMatched := make([]bool, len(removed))
+	curMatched := make([]bool, len(added))
+	for _, p := range pairs {
+		if prevMatched[p.prev] || curMatched[p.cur] {
+			continue
+		}
+		prevMatched[p.prev], curMatched[p.cur] = true, true
+		l := prev[removed[p.prev]]
+		last := l.Last()
+		ck := added[p.cur]
+		l.Events = append(l.Events, newEvent(Moved, commitID, ck, cur[ck], &last.Key, last.File))
+	}
+
+	for i, k := range removed {
+		if !prevMatched[i] {
+			l := prev[k]
+			last := l.Last()
+			l.Events = append(l.Events, &Event{Type: Deleted, CommitID: commitID, Key: last.Key, Name: last.Name, Kind: last.Kind, File: last.File})
+		}
+	}
+	for j, k := range added {
+		if curMatched[j] {
+			continue
+		}
+		e := newEvent(Appeared, commitID, k, cur[k], nil, "")
+		if l := h.deletedLineage(k); l != nil {
+			l.Events = append(l.Events, e)
+		} else {
+			h.Lineages = append(h.Lineages, &Lineage{Events: []*Event{e}})
+		}
+	}
+	return nil
+}
+
+// deletedLineage returns the most recently deleted lineage whose last
+// key is key, or nil if there is none.
+func (h *History) deletedLineage(key graph.DefKey) *Lineage {
+	var found *Lineage
+	for _, l := range h.Lineages {
+		if l.Deleted() && l.Last().Key == key {
+			if found == nil || commitIndex(h.Commits, l.Last().CommitID) > commitIndex(h.Commits, found.Last().CommitID) {
+				found = l
+			}
+		}
+	}
+	return found
+}
+
+func commitIndex(commits []string, commitID string) int {
+	for i, c := range commits {
+		if c == commitID {
+			return i
+		}
+	}
+	return -1
+}
+
+func newEvent(typ EventType, commitID string, key graph.DefKey, d *graph.Def, from *graph.DefKey, fromFile string) *Event {
+	e := &Event{Type: typ, CommitID: commitID, Key: key, Name: d.Name, Kind: d.Kind, File: d.File}
+	if from != nil {
+		f := *from
+		e.From, e.FromFile = &f, fromFile
+	}
+	return e
+}
+
+// historyKey returns k without its Repo and CommitID, which don't
+// identify a def within a repository's history.
+func historyKey(k graph.DefKey) graph.DefKey {
+	k.Repo, k.CommitID = "", ""
+	return k
+}
+
+// minSimilarity is the minimum similarity (see similarity) of a
+// deleted def and an added def for them to be considered the same
+// def.
+const minSimilarity = 2
+
+// similarity returns a score of how likely it is that the def added
+// with key k is the same def as the one whose last event is prev. Defs
+// with different names or kinds have a score of 0; otherwise, the
+// score is the sum of:
+//
+//	1 if they're in the same source unit
+//	2 if they're in the same file (or prev's file was renamed to d's file), or else 1 if their files have the same base name
+//	1 for each trailing component (after the last) that their def paths have in common
+//
+// So, for example, a def that moves to a different file in its source
+// unit (with a different def path) isn't matched unless its def path
+// or file name is similar or its file was renamed, because unrelated
+// defs (such as the String methods of two types) often have the same
+// name and kind.
+func similarity(prev *Event, k graph.DefKey, d *graph.Def, renames map[string]string) int {
+	if d.Name == "" || d.Name != prev.Name || d.Kind != prev.Kind {
+		return 0
+	}
+	var score int
+	if k.UnitType == prev.Key.UnitType && k.Unit == prev.Key.Unit {
+		score++
+	}
+	if d.File == prev.File || (d.File != "" && renames[prev.File] == d.File) {
+		score += 2
+	} else if path.Base(d.File) == path.Base(prev.File) {
+		score++
+	}
+	a, b := strings.Split(k.Path, "/"), strings.Split(prev.Key.Path, "/")
+	for i := 2; i <= len(a) && i <= len(b) && a[len(a)-i] == b[len(b)-i]; i++ {
+		score++
+	}
+	return score
+}
+
+type candidate struct {
+	prev, cur int // indexes into the removed and added keys
+	score     int
+}
+
+type byScore []*candidate
+
+func (v byScore) Len() int           { return len(v) }
+func (v byScore) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v byScore) Less(i, j int) bool { return v[i].score > v[j].score }
+
+type defKeys []graph.DefKey
+
+func (v defKeys) Len() int      { return len(v) }
+func (v defKeys) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v defKeys) Less(i, j int) bool {
+	a, b := v[i], v[j]
+	if a.UnitType != b.UnitType {
+		return a.UnitType < b.UnitType
+	}
+	if a.Unit != b.Unit {
+		return a.Unit < b.Unit
+	}
+	return a.Path < b.Path
+}
@@ -0,0 +1,154 @@
+package defhistory
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func def(unit, path, name, file string) *graph.Def {
+	return &graph.Def{DefKey: graph.DefKey{Repo: "r", UnitType: "t", Unit: unit, Path: path}, Name: name, Kind: "func", File: file}
+}
+
+func TestHistory(t *testing.T) {
+	var h History
+	commits := []struct {
+		id   string
+		defs []*graph.Def
+	}{
+		{"c1", []*graph.Def{
+			def("u", "A", "A", "a.go"),
+			def("u", "B", "B", "a.go"),
+			def("u", "T/String", "String", "t.go"),
+			{DefKey: graph.DefKey{UnitType: "t", Unit: "u", Path: "A/x"}, Name: "x", File: "a.go", Local: true},
+		}},
+		{"c2", []*graph.Def{
+			def("u", "A", "A", "b.go"),             // moved to another file
+			def("u2", "B", "B", "a.go"),            // moved to another unit
+			def("u", "U/String", "String", "u.go"), // unrelated def with the same name
+		}},
+		{"c3", []*graph.Def{
+			def("u2", "B", "B", "a.go"),
+			def("u", "U/String", "String", "u.go"),
+		}},
+		{"c4", []*graph.Def{
+			def("u", "A", "A", "b.go"), // re-added
+			def("u2", "B", "B", "a.go"),
+			def("u", "U/String", "String", "u.go"),
+		}},
+	}
+	for _, c := range commits {
+		if err := h.Add(c.id, c.defs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.Add("c4", nil); err == nil {
+		t.Error("got no error adding a commit twice, want error")
+	}
+
+	key := func(unit, path string) graph.DefKey { return graph.DefKey{UnitType: "t", Unit: unit, Path: path} }
+	type event struct {
+		Type     EventType
+		CommitID string
+		Key      graph.DefKey
+	}
+	events := func(l *Lineage) []event {
+		var es []event
+		for _, e := range l.Events {
+			es = append(es, event{e.Type, e.CommitID, e.Key})
+		}
+		return es
+	}
+	tests := map[graph.DefKey][][]event{
+		key("u", "A"): {{
+			{Appeared, "c1", key("u", "A")},
+			{Moved, "c2", key("u", "A")},
+			{Deleted, "c3", key("u", "A")},
+			{Appeared, "c4", key("u", "A")},
+		}},
+		{Path: "B"}: {{
+			{Appeared, "c1", key("u", "B")},
+			{Moved, "c2", key("u2", "B")},
+		}},
+		key("u", "T/String"): {{
+			{Appeared, "c1", key("u", "T/String")},
+			{Deleted, "c2", key("u", "T/String")},
+		}},
+		key("u", "U/String"): {{
+			{Appeared, "c2", key("u", "U/String")},
+		}},
+		key("u", "A/x"): nil,
+	}
+	for k, want := range tests {
+		var got [][]event
+		for _, l := range h.Lookup(k) {
+			got = append(got, events(l))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%+v: got %+v, want %+v", k, got, want)
+		}
+	}
+
+	if e := h.Lookup(key("u", "A"))[0].Events[1]; e.FromFile != "a.go" || e.File != "b.go" {
+		t.Errorf("got move from %q to %q, want a.go to b.go", e.FromFile, e.File)
+	}
+}
+
+func TestHistory_AddRenamed(t *testing.T) {
+	// The def paths include the file name, so they change when the
+	// file is renamed.
+	c1 := []*graph.Def{def("u", "lib/a.js/F", "F", "lib/a.js")}
+	c2 := []*graph.Def{def("u2", "src/b.js/F", "F", "src/b.js")}
+
+	var h History
+	if err := h.Add("c1", c1); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Add("c2", c2); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(h.Lineages); n != 2 {
+		t.Errorf("got %d lineages without renames, want 2 (deleted and added)", n)
+	}
+
+	h = History{}
+	if err := h.Add("c1", c1); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.AddRenamed("c2", c2, map[string]string{"lib/a.js": "src/b.js"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(h.Lineages); n != 1 {
+		t.Fatalf("got %d lineages with renames, want 1", n)
+	}
+	if e := h.Lineages[0].Last(); e.Type != Moved || e.FromFile != "lib/a.js" || e.File != "src/b.js" {
+		t.Errorf("got last event %+v, want a move from lib/a.js to src/b.js", e)
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+	fs := rwvfs.Map(map[string]string{})
+	h, err := Read(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Commits) != 0 || len(h.Lineages) != 0 {
+		t.Errorf("got %+v, want empty history", h)
+	}
+
+	if err := h.Add("c1", []*graph.Def{def("u", "A", "A", "a.go")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(fs, h); err != nil {
+		t.Fatal(err)
+	}
+	h2, err := Read(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(h2, h) {
+		t.Errorf("got %+v, want %+v", h2, h)
+	}
+}
@@ -0,0 +1,51 @@
+package defhistory
+
+import (
+	"encoding/json"
+	"os"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+)
+
+// Filename is the name of the file (in the root of a repository's
+// build data directory, alongside the per-commit build data) in which
+// the repository's def history is stored.
+const Filename = "def-history.json"
+
+// Read reads the def history from fs. If there is none, it returns an
+// empty History.
+func Read(fs rwvfs.FileSystem) (*History, error) {
+	f, err := fs.Open(Filename)
+	if os.IsNotExist(err) {
+		return &History{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var h History
+	if err := json.NewDecoder(f).Decode(&h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// Write writes h to fs, replacing any existing def history.
+func Write(fs rwvfs.FileSystem, h *History) (err error) {
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := fs.Create(Filename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := f.Close()
+		if err == nil {
+			err = err2
+		}
+	}()
+	_, err = f.Write(data)
+	return err
+}
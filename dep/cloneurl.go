@@ -0,0 +1,390 @@
+package dep
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sourcegraph.com/sourcegraph/srclib"
+)
+
+// A CloneURLResolver determines the clone URLs of the GitHub and
+// GitLab repositories that dependencies are in, from the repository
+// URLs that their package metadata lists (which are often not clone
+// URLs, e.g., "git+https://github.com/o/r.git#readme" or "github:o/r",
+// and may name a repository that has since been renamed or
+// transferred). It asks the code host's API for the repository's
+// canonical clone URL.
+//
+// Because dependency resolution looks up the same packages on every
+// build, the results are cached on disk (in CacheDir, which is shared
+// by all of the builds that run on a machine) for MaxAge, after which
+// they are revalidated with conditional requests, which don't count
+// against the code hosts' API rate limits. When a code host's rate
+// limit is exhausted, or in offline mode (see srclib.Offline), stale
+// cached results are used, or else the clone URL is derived from the
+// repository URL without the API.
+//
+// Toolchains that aren't written in Go can use it through "srclib
+// internal clone-url".
+type CloneURLResolver struct {
+	// Client makes the API requests. If nil, http.DefaultClient is
+	// used.
+	Client *http.Client
+
+	// CacheDir is the directory that the results are cached in. If
+	// empty, they aren't cached.
+	CacheDir string
+
+	// MaxAge is how long cached results are used without being
+	// revalidated.
+	MaxAge time.Duration
+
+	// GitHubToken and GitLabToken, if set, authenticate the API
+	// requests, which raises their rate limits (and gives access to
+	// private repositories).
+	GitHubToken, GitLabToken string
+
+	// GitHubAPI and GitLabAPI are the base URLs of the code hosts'
+	// APIs (e.g., of a GitHub Enterprise server).
+	GitHubAPI, GitLabAPI string
+
+	mu          sync.Mutex
+	rateLimited map[string]time.Time // code host -> when its rate limit resets
+}
+
+// NewCloneURLResolver returns a CloneURLResolver that caches results
+// in the srclib cache directory (see srclib.CacheDir) for a day, and
+// whose tokens are read from the environment: SRCLIB_GITHUB_TOKEN (or
+// GITHUB_TOKEN) and SRCLIB_GITLAB_TOKEN (or GITLAB_TOKEN). The API base
+// URLs may be set with SRCLIB_GITHUB_API and SRCLIB_GITLAB_API.
+func NewCloneURLResolver() *CloneURLResolver {
+	return &CloneURLResolver{
+		CacheDir:    filepath.Join(srclib.CacheDir, "clone-urls"),
+		MaxAge:      24 * time.Hour,
+		GitHubToken: firstEnv("SRCLIB_GITHUB_TOKEN", "GITHUB_TOKEN"),
+		GitLabToken: firstEnv("SRCLIB_GITLAB_TOKEN", "GITLAB_TOKEN"),
+		GitHubAPI:   firstEnv("SRCLIB_GITHUB_API"),
+		GitLabAPI:   firstEnv("SRCLIB_GITLAB_API"),
+	}
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+const (
+	defaultGitHubAPI = "https://api.github.com"
+	defaultGitLabAPI = "https://gitlab.com/api/v4"
+)
+
+// A codeHostRepo is a repository on GitHub or GitLab.
+type codeHostRepo struct {
+	host string // "github.com" or "gitlab.com"
+	path string // "owner/name" (GitLab paths may have more components)
+}
+
+// cloneURL returns the clone URL of r that is derived from its path
+// (without the API).
+func (r codeHostRepo) cloneURL() string {
+	return "https://" + r.host + "/" + r.path + ".git"
+}
+
+// parseCodeHostURL parses a repository URL of one of the forms that
+// package metadata uses (e.g., "https://github.com/o/r/tree/master",
+// "git+ssh://git@github.com/o/r.git", "git@gitlab.com:g/s/r.git", or
+// "github:o/r"). It returns false if the repository isn't on GitHub or
+// GitLab.
+func parseCodeHostURL(repoURL string) (codeHostRepo, bool) {
+	s := strings.TrimSpace(repoURL)
+	if i := strings.IndexAny(s, "#?"); i != -1 {
+		s = s[:i]
+	}
+	for _, host := range []string{"github", "gitlab"} {
+		if strings.HasPrefix(s, host+":") && !strings.HasPrefix(s, host+"://") {
+			s = host + ".com/" + s[len(host)+1:]
+		}
+	}
+	s = strings.TrimPrefix(s, "git+")
+	if i := strings.Index(s, "://"); i != -1 {
+		s = s[i+3:]
+	}
+	if i := strings.Index(s, "@"); i != -1 && i < strings.Index(s+"/", "/") {
+		s = s[i+1:] // userinfo
+	}
+	s = strings.Replace(s, ":", "/", 1) // scp-like "host:path"
+	s = strings.TrimPrefix(s, "www.")
+
+	i := strings.Index(s, "/")
+	if i == -1 {
+		return codeHostRepo{}, false
+	}
+	host, path := strings.ToLower(s[:i]), strings.Trim(s[i+1:], "/")
+	var parts []string
+	switch host {
+	case "github.com":
+		parts = strings.SplitN(path, "/", 3)
+		if len(parts) > 2 {
+			parts = parts[:2] // e.g., "tree/master/dir"
+		}
+	case "gitlab.com":
+		if i := strings.Index(path, "/-/"); i != -1 {
+			path = path[:i]
+		}
+		parts = strings.Split(path, "/")
+	default:
+		return codeHostRepo{}, false
+	}
+	if len(parts) < 2 {
+		return codeHostRepo{}, false
+	}
+	parts[len(parts)-1] = strings.TrimSuffix(parts[len(parts)-1], ".git")
+	for _, p := range parts {
+		if p == "" || p == "." || p == ".." {
+			return codeHostRepo{}, false
+		}
+	}
+	return codeHostRepo{host: host, path: strings.Join(parts, "/")}, true
+}
+
+// cloneURLCacheEntry is a cached result of CloneURLResolver.Resolve.
+type cloneURLCacheEntry struct {
+	Key      string
+	RepoURL  string // the repository URL that was resolved
+	CloneURL string
+	ETag     string `json:",omitempty"` // of the API response, for revalidation
+	Fetched  time.Time
+}
+
+// Resolve returns the clone URL of the repository at repoURL (see
+// CloneURLResolver), which is listed by the package identified by key
+// (e.g., "npm:lodash"). The key identifies the cached result, which
+// is resolved again if the package's repository URL changes. If key is
+// empty, repoURL is the key. URLs of repositories that aren't on
+// GitHub or GitLab are returned unchanged.
+func (r *CloneURLResolver) Resolve(key, repoURL string) (string, error) {
+	repo, ok := parseCodeHostURL(repoURL)
+	if !ok {
+		return repoURL, nil
+	}
+	if key == "" {
+		key = repoURL
+	}
+
+	cached := r.readCache(key)
+	if cached != nil && cached.RepoURL != repoURL {
+		cached = nil
+	}
+	if cached != nil && time.Since(cached.Fetched) < r.MaxAge {
+		return cached.CloneURL, nil
+	}
+
+	fallback := func() (string, error) {
+		if cached != nil {
+			return cached.CloneURL, nil
+		}
+		return repo.cloneURL(), nil
+	}
+	if srclib.Offline || r.isRateLimited(repo.host) {
+		return fallback()
+	}
+
+	var etag string
+	if cached != nil {
+		etag = cached.ETag
+	}
+	cloneURL, newETag, err := r.fetch(repo, etag)
+	if err == errNotModified {
+		cloneURL, newETag = cached.CloneURL, cached.ETag
+	} else if err == errRateLimited {
+		return fallback()
+	} else if err != nil {
+		return "", err
+	}
+	r.writeCache(&cloneURLCacheEntry{Key: key, RepoURL: repoURL, CloneURL: cloneURL, ETag: newETag, Fetched: time.Now()})
+	return cloneURL, nil
+}
+
+var (
+	errNotModified = fmt.Errorf("not modified")
+	errRateLimited = fmt.Errorf("rate limited")
+)
+
+// fetch asks repo's code host's API for its clone URL. If etag is set,
+// the request is conditional, and errNotModified is returned if the
+// repository didn't change. If the repository doesn't exist (or isn't
+// accessible), the clone URL derived from its path is returned, so
+// that the result is cached.
+func (r *CloneURLResolver) fetch(repo codeHostRepo, etag string) (cloneURL, newETag string, err error) {
+	var (
+		req   *http.Request
+		field string
+	)
+	switch repo.host {
+	case "github.com":
+		api := r.GitHubAPI
+		if api == "" {
+			api = defaultGitHubAPI
+		}
+		req, err = http.NewRequest("GET", strings.TrimSuffix(api, "/")+"/repos/"+repo.path, nil)
+		if err != nil {
+			return "", "", err
+		}
+		req.Header.Set("Accept", "application/vnd.github.v3+json")
+		if r.GitHubToken != "" {
+			req.Header.Set("Authorization", "token "+r.GitHubToken)
+		}
+		field = "clone_url"
+	case "gitlab.com":
+		api := r.GitLabAPI
+		if api == "" {
+			api = defaultGitLabAPI
+		}
+		req, err = http.NewRequest("GET", strings.TrimSuffix(api, "/")+"/projects/"+url.QueryEscape(repo.path), nil)
+		if err != nil {
+			return "", "", err
+		}
+		if r.GitLabToken != "" {
+			req.Header.Set("Private-Token", r.GitLabToken)
+		}
+		field = "http_url_to_repo"
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return "", "", errNotModified
+	case resp.StatusCode == http.StatusNotFound:
+		return repo.cloneURL(), "", nil
+	case resp.StatusCode == http.StatusTooManyRequests || (resp.StatusCode == http.StatusForbidden && resp.Header.Get("X-RateLimit-Remaining") == "0"):
+		r.setRateLimited(repo.host, rateLimitReset(resp.Header))
+		return "", "", errRateLimited
+	case resp.StatusCode != http.StatusOK:
+		return "", "", fmt.Errorf("%s: HTTP %s", req.URL, resp.Status)
+	}
+
+	var v map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return "", "", fmt.Errorf("%s: %s", req.URL, err)
+	}
+	cloneURL, _ = v[field].(string)
+	if cloneURL == "" {
+		return "", "", fmt.Errorf("%s: no %s in response", req.URL, field)
+	}
+	return cloneURL, resp.Header.Get("ETag"), nil
+}
+
+// rateLimitReset returns when the rate limit that a response's headers
+// report resets (from GitHub's X-RateLimit-Reset or GitLab's
+// RateLimit-Reset, both in Unix time, or from Retry-After). If the
+// headers don't say, it is in a minute.
+func rateLimitReset(h http.Header) time.Time {
+	for _, name := range []string{"X-RateLimit-Reset", "RateLimit-Reset"} {
+		if t, err := strconv.ParseInt(h.Get(name), 10, 64); err == nil {
+			return time.Unix(t, 0)
+		}
+	}
+	if s, err := strconv.Atoi(h.Get("Retry-After")); err == nil {
+		return time.Now().Add(time.Duration(s) * time.Second)
+	}
+	return time.Now().Add(time.Minute)
+}
+
+func (r *CloneURLResolver) isRateLimited(host string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return time.Now().Before(r.rateLimited[host])
+}
+
+func (r *CloneURLResolver) setRateLimited(host string, until time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rateLimited == nil {
+		r.rateLimited = map[string]time.Time{}
+	}
+	r.rateLimited[host] = until
+	log.Printf("Warning: the %s API rate limit is exhausted until %s; using cached or derived clone URLs (set a token to raise the limit).", host, until.Format(time.RFC3339))
+}
+
+// cacheFile returns the file that the result for key is cached in.
+func (r *CloneURLResolver) cacheFile(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(r.CacheDir, hex.EncodeToString(sum[:])+".json")
+}
+
+// readCache returns the cached result for key, or nil if there is none
+// (or it can't be read).
+func (r *CloneURLResolver) readCache(key string) *cloneURLCacheEntry {
+	if r.CacheDir == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(r.cacheFile(key))
+	if err != nil {
+		return nil
+	}
+	var e cloneURLCacheEntry
+	if err := json.Unmarshal(data, &e); err != nil || e.Key != key {
+		return nil
+	}
+	return &e
+}
+
+// writeCache caches e. Because the cache directory is shared by
+// concurrent builds, the file is replaced atomically. Errors are
+// logged, not returned, because caching is an optimization.
+func (r *CloneURLResolver) writeCache(e *cloneURLCacheEntry) {
+	if r.CacheDir == "" {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err == nil {
+		err = os.MkdirAll(r.CacheDir, 0755)
+	}
+	var f *os.File
+	if err == nil {
+		f, err = ioutil.TempFile(r.CacheDir, ".tmp-")
+	}
+	if err == nil {
+		_, err = f.Write(data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(f.Name(), r.cacheFile(e.Key))
+		}
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}
+	if err != nil {
+		log.Printf("Warning: couldn't cache the clone URL of %s: %s.", e.Key, err)
+	}
+}
@@ -0,0 +1,119 @@
+package dep
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseCodeHostURL(t *testing.T) {
+	tests := map[string]string{
+		"https://github.com/o/r":                    "https://github.com/o/r.git",
+		"http://www.github.com/O/R/tree/master/dir": "https://github.com/O/R.git",
+		"git+https://github.com/o/r.git#readme":     "https://github.com/o/r.git",
+		"git+ssh://git@github.com/o/r.git":          "https://github.com/o/r.git",
+		"git://github.com/o/r.git":                  "https://github.com/o/r.git",
+		"git@github.com:o/r.git":                    "https://github.com/o/r.git",
+		"github:o/r":                                "https://github.com/o/r.git",
+		"https://gitlab.com/g/sub/r/-/tree/main":    "https://gitlab.com/g/sub/r.git",
+		"gitlab:g/r":                                "https://gitlab.com/g/r.git",
+		"https://bitbucket.org/o/r":                 "",
+		"https://github.com/o":                      "",
+		"https://github.com/o/..":                   "",
+		"not a url":                                 "",
+	}
+	for in, want := range tests {
+		repo, ok := parseCodeHostURL(in)
+		var got string
+		if ok {
+			got = repo.cloneURL()
+		}
+		if got != want {
+			t.Errorf("%s: got %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCloneURLResolver(t *testing.T) {
+	var requests, conditional int
+	rateLimited := false
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "token tok" {
+			t.Errorf("got Authorization %q", r.Header.Get("Authorization"))
+		}
+		if rateLimited {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/repos/old/r":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				conditional++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte(`{"clone_url": "https://github.com/new/r.git"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	cacheDir, err := ioutil.TempDir("", "srclib-clone-urls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+	newResolver := func(maxAge time.Duration) *CloneURLResolver {
+		return &CloneURLResolver{CacheDir: cacheDir, MaxAge: maxAge, GitHubToken: "tok", GitHubAPI: s.URL}
+	}
+
+	resolve := func(r *CloneURLResolver, key, repoURL, want string) {
+		got, err := r.Resolve(key, repoURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s %s: got %q, want %q", key, repoURL, got, want)
+		}
+	}
+
+	// The first lookup asks the API; later ones (by other resolvers,
+	// e.g., in later builds) use the cache.
+	resolve(newResolver(time.Hour), "npm:r", "github:old/r", "https://github.com/new/r.git")
+	resolve(newResolver(time.Hour), "npm:r", "github:old/r", "https://github.com/new/r.git")
+	if requests != 1 {
+		t.Errorf("got %d requests, want 1", requests)
+	}
+
+	// Stale results are revalidated.
+	resolve(newResolver(0), "npm:r", "github:old/r", "https://github.com/new/r.git")
+	if requests != 2 || conditional != 1 {
+		t.Errorf("got %d requests (%d conditional), want 2 (1 conditional)", requests, conditional)
+	}
+
+	// Nonexistent repositories are cached with their derived clone
+	// URLs.
+	resolve(newResolver(time.Hour), "npm:x", "https://github.com/gone/x", "https://github.com/gone/x.git")
+
+	// When the rate limit is exhausted, stale results are used, and
+	// the API isn't asked again until the limit resets.
+	rateLimited = true
+	r := newResolver(0)
+	resolve(r, "npm:r", "github:old/r", "https://github.com/new/r.git")
+	resolve(r, "npm:y", "github:o/y", "https://github.com/o/y.git")
+	if requests != 4 {
+		t.Errorf("got %d requests, want 4", requests)
+	}
+
+	// Other hosts' URLs are returned unchanged.
+	resolve(r, "", "https://example.com/r.git", "https://example.com/r.git")
+}
@@ -13,6 +13,10 @@ type ResolvedTarget struct {
 	// not ToRepo, so that the dependent repository can be added if it doesn't
 	// exist. The ToRepo URI alone does not specify enough information to add
 	// the repository (because it doesn't specify the VCS type, scheme, etc.).
+	//
+	// If it is empty, the target is a source unit (ToUnit and ToUnitType)
+	// in the same repository. The plan graphs such units before the units
+	// that depend on them (see grapher.DepGraphDataEnv).
 	ToRepoCloneURL string
 
 	// ToUnit is the name of the source unit that is depended on.
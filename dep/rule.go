@@ -25,22 +25,35 @@ func makeDepRules(c *config.Tree, dataDir string, existing []makex.Rule) ([]make
 	const op = depresolveOp
 	var rules []makex.Rule
 	for _, u := range c.SourceUnits {
-		toolRef, err := toolchain.ChooseTool(depresolveOp, u.Type)
+		r, err := NewResolveDepsRule(dataDir, u)
 		if err != nil {
 			return nil, err
 		}
-
-		rules = append(rules, &ResolveDepsRule{dataDir, u, toolRef})
+		rules = append(rules, r)
 	}
 	return rules, nil
 }
 
+// NewResolveDepsRule returns the rule that resolves u's dependencies
+// with the installed tool for its type, writing the output to the
+// build data directory dataDir.
+func NewResolveDepsRule(dataDir string, u *unit.SourceUnit) (*ResolveDepsRule, error) {
+	toolRef, err := toolchain.ChooseTool(depresolveOp, u.Type)
+	if err != nil {
+		return nil, err
+	}
+	return &ResolveDepsRule{dataDir, u, toolRef}, nil
+}
+
 type ResolveDepsRule struct {
 	dataDir string
 	Unit    *unit.SourceUnit
 	Tool    *srclib.ToolRef
 }
 
+// DataDir returns the build data directory that r writes to.
+func (r *ResolveDepsRule) DataDir() string { return r.dataDir }
+
 func (r *ResolveDepsRule) Target() string {
 	return filepath.ToSlash(filepath.Join(r.dataDir, plan.SourceUnitDataFilename([]*ResolvedDep{}, r.Unit)))
 }
@@ -54,6 +67,6 @@ func (r *ResolveDepsRule) Recipes() []string {
 		return nil
 	}
 	return []string{
-		fmt.Sprintf("%s tool %q %q < $^ 1> $@", util.SafeCommandName(srclib.CommandName), r.Tool.Toolchain, r.Tool.Subcmd),
+		fmt.Sprintf("%s tool%s%s %s %s < $^ 1> $@", util.SafeCommandName(srclib.CommandName), plan.EnvArgs(r.Unit), plan.LogArgs(r.dataDir, depresolveOp, r.Unit), plan.ShellQuote(r.Tool.Toolchain), plan.ShellQuote(r.Tool.Subcmd)),
 	}
 }
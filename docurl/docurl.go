@@ -0,0 +1,115 @@
+// Package docurl converts def keys to browsable URLs (of the defs'
+// documentation or source code) using URL templates, so that tools
+// that link to defs don't need to know how each language's
+// documentation sites lay out their URLs.
+//
+// Templates are selected by the def's source unit type and repository.
+// The built-in Defaults can be supplemented or overridden by the
+// DocURLs in a repository's Srcfile (see config.Repository).
+package docurl
+
+import (
+	"path"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// A Template is a template for the URLs of defs.
+type Template struct {
+	// Name is a short name for the kind of URL (e.g., "godoc").
+	Name string
+
+	// UnitType, if set, is the source unit type of the defs that the
+	// template applies to (e.g., "GoPackage").
+	UnitType string `json:",omitempty"`
+
+	// Repo, if set, is a glob pattern (as accepted by path.Match) of
+	// the URIs of the repositories whose defs the template applies to
+	// (e.g., "github.com/*/*"). A template with a Repo pattern doesn't
+	// apply to defs whose repository is unknown.
+	Repo string `json:",omitempty"`
+
+	// URL is the URL template. The placeholders "{repo}", "{commit}",
+	// "{unit-type}", "{unit}", and "{path}" are replaced by the
+	// corresponding fields of the def's key, "{dotpath}" is replaced
+	// by its path with "/" replaced by ".", and "{name}" is replaced
+	// by the last component of its path (e.g.,
+	// "https://godoc.org/{unit}#{dotpath}"). A template whose URL has a
+	// placeholder for an empty field doesn't apply to the def.
+	URL string
+}
+
+// Defaults are the built-in templates.
+var Defaults = []*Template{
+	{Name: "godoc", UnitType: "GoPackage", URL: "https://godoc.org/{unit}#{dotpath}"},
+	{Name: "sourcegraph", URL: "https://sourcegraph.com/{repo}/.{unit-type}/{unit}/.def/{path}"},
+}
+
+// placeholders maps each placeholder in URL templates to a function
+// that returns its value for a def key. Values are percent-encoded
+// (see graph.EscapeDefPath), so that def paths and unit names with
+// non-ASCII or reserved characters yield valid URLs.
+var placeholders = map[string]func(graph.DefKey) string{
+	"{repo}":      func(k graph.DefKey) string { return graph.EscapeDefPath(k.Repo) },
+	"{commit}":    func(k graph.DefKey) string { return graph.EscapeDefPath(k.CommitID) },
+	"{unit-type}": func(k graph.DefKey) string { return graph.EscapeDefPath(k.UnitType) },
+	"{unit}":      func(k graph.DefKey) string { return graph.EscapeDefPath(k.Unit) },
+	"{path}":      func(k graph.DefKey) string { return graph.EscapeDefPath(k.Path) },
+	"{dotpath}":   func(k graph.DefKey) string { return strings.Replace(graph.EscapeDefPath(k.Path), "/", ".", -1) },
+	"{name}":      func(k graph.DefKey) string { return graph.EscapeDefPath(path.Base(k.Path)) },
+}
+
+// Matches reports whether t applies to the def with the given key.
+func (t *Template) Matches(key graph.DefKey) bool {
+	if t.UnitType != "" && t.UnitType != key.UnitType {
+		return false
+	}
+	if t.Repo != "" {
+		if key.Repo == "" {
+			return false
+		}
+		if ok, _ := path.Match(t.Repo, key.Repo); !ok {
+			return false
+		}
+	}
+	for p, value := range placeholders {
+		if strings.Contains(t.URL, p) && value(key) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Expand returns the URL of the def with the given key.
+func (t *Template) Expand(key graph.DefKey) string {
+	var oldnew []string
+	for p, value := range placeholders {
+		oldnew = append(oldnew, p, value(key))
+	}
+	return strings.NewReplacer(oldnew...).Replace(t.URL)
+}
+
+// A URL is the URL of a def.
+type URL struct {
+	Name string // the Name of the template that the URL was made from
+	URL  string
+}
+
+// URLs returns the URLs of the def with the given key, made from each
+// of the templates that applies to it, in order. Only the first
+// applicable template with each name is used, so templates listed
+// earlier (e.g., those in a Srcfile, listed before the Defaults)
+// override templates of the same name listed later.
+func URLs(templates []*Template, key graph.DefKey) []*URL {
+	var urls []*URL
+	seen := map[string]struct{}{}
+	for _, t := range templates {
+		if _, dup := seen[t.Name]; dup || !t.Matches(key) {
+			continue
+		}
+		seen[t.Name] = struct{}{}
+		urls = append(urls, &URL{Name: t.Name, URL: t.Expand(key)})
+	}
+	return urls
+}
@@ -0,0 +1,77 @@
+package docurl
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestURLs(t *testing.T) {
+	srcfile := []*Template{
+		{Name: "godoc", UnitType: "GoPackage", Repo: "example.com/*", URL: "https://godoc.example.com/{unit}#{dotpath}"},
+		{Name: "javadoc", UnitType: "JavaArtifact", URL: "https://javadoc.example.com/{unit}/{path}.html"},
+	}
+	templates := append(srcfile, Defaults...)
+
+	tests := []struct {
+		key  graph.DefKey
+		want []*URL
+	}{
+		{
+			key: graph.DefKey{Repo: "github.com/gorilla/mux", UnitType: "GoPackage", Unit: "github.com/gorilla/mux", Path: "Router/ServeHTTP"},
+			want: []*URL{
+				{Name: "godoc", URL: "https://godoc.org/github.com/gorilla/mux#Router.ServeHTTP"},
+				{Name: "sourcegraph", URL: "https://sourcegraph.com/github.com/gorilla/mux/.GoPackage/github.com/gorilla/mux/.def/Router/ServeHTTP"},
+			},
+		},
+		{
+			key: graph.DefKey{Repo: "example.com/foo", UnitType: "GoPackage", Unit: "example.com/foo/bar", Path: "Baz"},
+			want: []*URL{
+				{Name: "godoc", URL: "https://godoc.example.com/example.com/foo/bar#Baz"},
+				{Name: "sourcegraph", URL: "https://sourcegraph.com/example.com/foo/.GoPackage/example.com/foo/bar/.def/Baz"},
+			},
+		},
+		{
+			// No repo, so the sourcegraph template doesn't apply.
+			key: graph.DefKey{UnitType: "JavaArtifact", Unit: "com.example/foo", Path: "com/example/Foo"},
+			want: []*URL{
+				{Name: "javadoc", URL: "https://javadoc.example.com/com.example/foo/com/example/Foo.html"},
+			},
+		},
+		{
+			// Non-ASCII and reserved characters are escaped.
+			key: graph.DefKey{Repo: "github.com/a/b", UnitType: "JavaArtifact", Unit: "com.example/été", Path: "com/example/Café#1"},
+			want: []*URL{
+				{Name: "javadoc", URL: "https://javadoc.example.com/com.example/%C3%A9t%C3%A9/com/example/Caf%C3%A9%231.html"},
+				{Name: "sourcegraph", URL: "https://sourcegraph.com/github.com/a/b/.JavaArtifact/com.example/%C3%A9t%C3%A9/.def/com/example/Caf%C3%A9%231"},
+			},
+		},
+		{
+			key:  graph.DefKey{UnitType: "PipPackage", Unit: "foo", Path: "foo/bar"},
+			want: nil,
+		},
+	}
+	for _, test := range tests {
+		got := URLs(templates, test.key)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%+v: got %v, want %v", test.key, urlStrings(got), urlStrings(test.want))
+		}
+	}
+}
+
+func TestTemplate_Expand(t *testing.T) {
+	tmpl := &Template{URL: "{repo}@{commit} {unit-type} {unit} {path} {dotpath} {name}"}
+	key := graph.DefKey{Repo: "r", CommitID: "c", UnitType: "t", Unit: "u", Path: "a/b/c"}
+	if want, got := "r@c t u a/b/c a.b.c c", tmpl.Expand(key); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func urlStrings(urls []*URL) []string {
+	var s []string
+	for _, u := range urls {
+		s = append(s, u.Name+"="+u.URL)
+	}
+	return s
+}
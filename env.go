@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"sourcegraph.com/sourcegraph/srclib/util"
 )
@@ -12,7 +13,8 @@ var (
 	// Path is SRCLIBPATH, a colon-separated list of directories that lists
 	// places to look for srclib toolchains and cache build data. It is
 	// initialized from the SRCLIBPATH environment variable; if empty, it
-	// defaults to $HOME/.srclib.
+	// defaults to $HOME/.srclib. If a toolchain is in more than one of
+	// the directories, the one in the earliest directory is used.
 	Path = os.Getenv("SRCLIBPATH")
 
 	// CacheDir stores cached build results. It is initialized from the
@@ -20,6 +22,13 @@ var (
 	// where DIR is the first entry in Path (SRCLIBPATH).
 	CacheDir = os.Getenv("SRCLIBCACHE")
 
+	// ProjectToolchainsDir is the directory (relative to a project's
+	// root directory) containing the project's own toolchains, which
+	// take precedence over those in the rest of the SRCLIBPATH (see
+	// UseProjectToolchains). It lets a project pin the versions of the
+	// toolchains that build it.
+	ProjectToolchainsDir = filepath.Join(".srclib", "toolchains")
+
 	// CommandName holds the commands that will be used to call self when generating
 	// Makefiles and updating toolchains.
 	CommandName = "srclib"
@@ -42,3 +51,39 @@ func init() {
 		CacheDir = filepath.Join(dirs[0], ".cache")
 	}
 }
+
+// UseProjectToolchains looks for a project toolchains directory (see
+// ProjectToolchainsDir) in dir and its parent directories. If it finds
+// one, it prepends it to Path (and $SRCLIBPATH, so that the programs
+// that srclib runs use it, too) and returns it; otherwise it returns
+// "".
+func UseProjectToolchains(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		tcDir := filepath.Join(dir, ProjectToolchainsDir)
+		if fi, err := os.Stat(tcDir); err == nil && fi.IsDir() {
+			return tcDir, prependPath(tcDir)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// prependPath makes dir the first entry in Path (and $SRCLIBPATH),
+// removing it from later in Path if it's already there.
+func prependPath(dir string) error {
+	entries := []string{dir}
+	for _, e := range filepath.SplitList(Path) {
+		if e != dir {
+			entries = append(entries, e)
+		}
+	}
+	Path = strings.Join(entries, string(filepath.ListSeparator))
+	return os.Setenv("SRCLIBPATH", Path)
+}
@@ -0,0 +1,43 @@
+package srclib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUseProjectToolchains(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "srclib-env-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	defer func(orig string) {
+		Path = orig
+		os.Setenv("SRCLIBPATH", orig)
+	}(Path)
+	Path = "/global"
+
+	tcDir := filepath.Join(tmpdir, ProjectToolchainsDir)
+	subdir := filepath.Join(tmpdir, "sub")
+	for _, dir := range []string{tcDir, subdir} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Twice, to check that the dir is only added once.
+	for i := 0; i < 2; i++ {
+		dir, err := UseProjectToolchains(subdir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dir != tcDir {
+			t.Errorf("got project toolchains dir %q, want %q", dir, tcDir)
+		}
+		if want := tcDir + string(filepath.ListSeparator) + "/global"; Path != want || os.Getenv("SRCLIBPATH") != want {
+			t.Errorf("got Path %q ($SRCLIBPATH %q), want %q", Path, os.Getenv("SRCLIBPATH"), want)
+		}
+	}
+}
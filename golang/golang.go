@@ -0,0 +1,168 @@
+// Package golang is a minimal Go toolchain built into srclib. It lets
+// Go repositories (including srclib itself) be built with "srclib make"
+// when no external Go toolchain (such as srclib-go) is installed.
+//
+// Its scanner (the built-in "go" scanner, which is run by default; see
+// scan.DefaultBuiltins) emits a GoPackage source unit for each
+// directory that contains a Go package, unless an installed toolchain
+// graphs GoPackage units. Its grapher (see grapher.Builtins) parses
+// the package's files and emits defs for its package-level
+// declarations, methods, and struct fields and refs to them. Names are
+// resolved by type-checking the package (with go/types, loading the
+// packages that it imports with go/packages).
+package golang
+
+import (
+	"bufio"
+	"go/build"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/scan"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+	"sourcegraph.com/sourcegraph/srclib/util"
+)
+
+// UnitType is the type of the source units that contain Go packages.
+// It is the same as the type of the units that external Go toolchains
+// emit, so that the units (and refs to them) are interchangeable. The
+// units are named by the packages' import paths.
+const UnitType = "GoPackage"
+
+func init() {
+	scan.Builtins["go"] = Scan
+	scan.DefaultBuiltins = append(scan.DefaultBuiltins, "go")
+	grapher.Builtins[UnitType] = GraphPackage
+}
+
+// Scan returns the Go packages in the tree in the current directory,
+// or no packages if an installed toolchain graphs GoPackage units (in
+// which case its own scanner emits them).
+//
+// The import path of the tree's root directory is taken from the
+// "ImportPath" key of the tree config, the module path in its go.mod
+// file, or its location in the GOPATH, in that order. If it can't be
+// determined, packages are named by their directory's path. Files are
+// selected by the build constraints of the current platform (see
+// go/build), and external test files (in package x_test) are omitted.
+// Directories whose names begin with "." or "_" and testdata, vendor,
+// and node_modules directories are skipped, as are symbolic links.
+func Scan(treeConfig map[string]interface{}) ([]*unit.SourceUnit, error) {
+	if t, err := toolchain.ChooseTool("graph", UnitType); err != nil || t != nil {
+		// An error means that there are multiple (conflicting)
+		// toolchains for Go; either way, they take precedence.
+		return nil, nil
+	}
+
+	root, err := rootImportPath(treeConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var units []*unit.SourceUnit
+	err = util.Walk(".", util.IgnoreSymlinks, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return nil
+		}
+		if name := fi.Name(); p != "." && (name[0] == '.' || name[0] == '_' || name == "testdata" || name == "vendor" || name == "node_modules") {
+			return filepath.SkipDir
+		}
+		pkg, err := build.Default.ImportDir(p, 0)
+		if err != nil {
+			if _, ok := err.(*build.NoGoError); !ok {
+				log.Printf("Skipping Go package in %s: %s", p, err)
+			}
+			return nil
+		}
+		dir := filepath.ToSlash(p)
+		var files []string
+		for _, names := range [][]string{pkg.GoFiles, pkg.CgoFiles, pkg.TestGoFiles} {
+			for _, name := range names {
+				files = append(files, path.Join(dir, name))
+			}
+		}
+		if len(files) == 0 {
+			return nil
+		}
+		sort.Strings(files)
+		units = append(units, &unit.SourceUnit{
+			Key:  unit.Key{Type: UnitType, Name: importPath(root, dir)},
+			Info: unit.Info{Dir: dir, Files: files},
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return units, nil
+}
+
+// rootImportPath returns the import path of the tree in the current
+// directory (see Scan), or "" if it can't be determined.
+func rootImportPath(treeConfig map[string]interface{}) (string, error) {
+	if s, ok := treeConfig["ImportPath"].(string); ok && s != "" {
+		return s, nil
+	}
+	if mod, err := goModulePath("go.mod"); err != nil || mod != "" {
+		return mod, err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	if wd, err = filepath.EvalSymlinks(wd); err != nil {
+		return "", err
+	}
+	for _, gopath := range filepath.SplitList(build.Default.GOPATH) {
+		if gopath == "" {
+			continue
+		}
+		if src, err := filepath.EvalSymlinks(filepath.Join(gopath, "src")); err == nil {
+			if rel, err := filepath.Rel(src, wd); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+				return filepath.ToSlash(rel), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// goModulePath returns the module path declared in the go.mod file
+// named name, or "" if the file doesn't exist or declares no module.
+func goModulePath(name string) (string, error) {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`), nil
+		}
+	}
+	return "", s.Err()
+}
+
+// importPath returns the import path of the package in dir (relative
+// to the root of the tree whose import path is root).
+func importPath(root, dir string) string {
+	switch {
+	case root == "":
+		return dir
+	case dir == ".":
+		return root
+	}
+	return root + "/" + dir
+}
@@ -0,0 +1,109 @@
+package golang
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/graph/graphtest"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func chdirTestdata(t *testing.T) func() {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir("testdata"); err != nil {
+		t.Fatal(err)
+	}
+	return func() { os.Chdir(wd) }
+}
+
+func TestScan(t *testing.T) {
+	defer chdirTestdata(t)()
+	oldChooseTool := toolchain.ChooseTool
+	defer func() { toolchain.ChooseTool = oldChooseTool }()
+	var installed *srclib.ToolRef
+	toolchain.ChooseTool = func(op, unitType string) (*srclib.ToolRef, error) { return installed, nil }
+
+	units, err := Scan(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*unit.SourceUnit{
+		{Key: unit.Key{Type: UnitType, Name: "example.com/m/a"}, Info: unit.Info{Dir: "a", Files: []string{"a/a.go", "a/b.go"}}},
+		{Key: unit.Key{Type: UnitType, Name: "example.com/m/b"}, Info: unit.Info{Dir: "b", Files: []string{"b/b.go"}}},
+	}
+	if !reflect.DeepEqual(units, want) {
+		t.Errorf("got units %+v, want %+v", units, want)
+	}
+
+	units, err = Scan(map[string]interface{}{"ImportPath": "example.org/x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(units) != 2 || units[0].Name != "example.org/x/a" {
+		t.Errorf("got units %+v, want units named by the configured import path", units)
+	}
+
+	// An installed Go toolchain takes precedence.
+	installed = &srclib.ToolRef{Toolchain: "sourcegraph.com/sourcegraph/srclib-go", Subcmd: "graph"}
+	units, err = Scan(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(units) != 0 {
+		t.Errorf("got units %+v, want none", units)
+	}
+}
+
+func TestGraphPackage(t *testing.T) {
+	defer chdirTestdata(t)()
+
+	tests := map[string]struct {
+		unit       *unit.SourceUnit
+		defs, refs []string
+	}{
+		"a": {
+			unit: &unit.SourceUnit{Key: unit.Key{Type: UnitType, Name: "example.com/m/a"}, Info: unit.Info{Dir: "a", Files: []string{"a/a.go", "a/b.go"}}},
+			defs: []string{"N", "New", "T", "T/F", "T/M", "T/U", "U", "x"},
+			refs: []string{
+				"F -> example.com/m/a T/F",
+				"F -> example.com/m/a T/F",
+				"M -> example.com/m/a T/M",
+				"N -> example.com/m/a N",
+				"T -> example.com/m/a T",
+				"T -> example.com/m/a T",
+				"T -> example.com/m/a T",
+				"T -> example.com/m/a T",
+				"U -> example.com/m/a U",
+			},
+		},
+		"b": {
+			unit: &unit.SourceUnit{Key: unit.Key{Type: UnitType, Name: "example.com/m/b"}, Info: unit.Info{Dir: "b", Files: []string{"b/b.go"}}},
+			defs: []string{"f"},
+			refs: []string{
+				"F -> example.com/m/a T/F",
+				"M -> example.com/m/a T/M",
+				"N -> example.com/m/a N",
+				"New -> example.com/m/a New",
+			},
+		},
+	}
+	for label, test := range tests {
+		o, err := GraphPackage(test.unit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defs, refs := graphtest.DescribeOutput(t, o)
+		if !reflect.DeepEqual(defs, test.defs) {
+			t.Errorf("%s: got defs %q, want %q", label, defs, test.defs)
+		}
+		if !reflect.DeepEqual(refs, test.refs) {
+			t.Errorf("%s: got refs %q, want %q", label, refs, test.refs)
+		}
+	}
+}
@@ -0,0 +1,434 @@
+package golang
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// GraphPackage graphs the GoPackage source unit u (see UnitType). It
+// emits defs for each package-level func, type, var, and const (whose
+// def path is its name), method (whose def path is "Type/Method"), and
+// struct field and interface method (whose def path is "Type/Name"),
+// with their doc comments, and refs to them from identifiers that
+// resolve to them. Files with syntax errors are graphed as far as they
+// could be parsed.
+//
+// Identifiers are resolved by type-checking the package's files with
+// go/types, so refs to methods and fields that are selected from
+// values (as in x.M()) are found. The packages that the files import
+// are loaded with go/packages (from the go command's export data); if
+// they can't be loaded, or the package has type errors, the
+// identifiers that can't be resolved are omitted.
+//
+// Refs to defs in other packages in the same tree (found by their
+// import paths relative to u's) refer to those packages' units. Refs
+// to other packages (such as the standard library) are omitted.
+func GraphPackage(u *unit.SourceUnit) (*graph.Output, error) {
+	fset := token.NewFileSet()
+	var files []*ast.File
+	var names []string
+	for _, name := range u.Files {
+		f, err := parser.ParseFile(fset, filepath.FromSlash(name), nil, parser.ParseComments)
+		if f == nil {
+			return nil, err
+		}
+		files = append(files, f)
+		names = append(names, name)
+	}
+
+	g := &goGrapher{
+		unit:   u,
+		fset:   fset,
+		root:   treeImportPath(u),
+		out:    &graph.Output{},
+		paths:  map[string]bool{},
+		fields: map[*types.Package]map[*types.Var]string{},
+	}
+	g.pkg, g.info = typeCheck(fset, u, files)
+	for i, f := range files {
+		g.declare(names[i], f)
+	}
+	for i, f := range files {
+		g.resolve(names[i], f)
+	}
+	return g.out, nil
+}
+
+// typeCheck type-checks the files of the GoPackage unit u, loading the
+// packages that they import with go/packages. Type errors are ignored
+// (and the objects that can't be resolved are omitted from the
+// returned info).
+func typeCheck(fset *token.FileSet, u *unit.SourceUnit, files []*ast.File) (*types.Package, *types.Info) {
+	seen := map[string]bool{}
+	var importPaths []string
+	for _, f := range files {
+		for _, spec := range f.Imports {
+			if p, err := strconv.Unquote(spec.Path.Value); err == nil && p != "C" && p != "unsafe" && !seen[p] {
+				seen[p] = true
+				importPaths = append(importPaths, p)
+			}
+		}
+	}
+	imported := map[string]*types.Package{}
+	if len(importPaths) > 0 {
+		dir := u.Dir
+		if dir == "" {
+			dir = "."
+		}
+		cfg := &packages.Config{Mode: packages.NeedName | packages.NeedTypes, Dir: filepath.FromSlash(dir), Fset: fset}
+		pkgs, err := packages.Load(cfg, importPaths...)
+		if err != nil {
+			log.Printf("Loading the packages that Go package %s imports failed (refs to them will be omitted): %s", u.Name, err)
+		}
+		for _, pkg := range pkgs {
+			// Packages whose export data couldn't be read are
+			// incomplete (and omitted).
+			if pkg.Types != nil && pkg.Types.Complete() {
+				imported[pkg.PkgPath] = pkg.Types
+			}
+		}
+	}
+
+	conf := types.Config{
+		Importer: importerFunc(func(path string) (*types.Package, error) {
+			if path == "unsafe" {
+				return types.Unsafe, nil
+			}
+			if pkg, ok := imported[path]; ok {
+				return pkg, nil
+			}
+			// Packages in vendor directories are loaded by their
+			// full paths.
+			for p, pkg := range imported {
+				if strings.HasSuffix(p, "/vendor/"+path) {
+					return pkg, nil
+				}
+			}
+			return nil, fmt.Errorf("package %s was not loaded", path)
+		}),
+		Error: func(error) {},
+	}
+	info := &types.Info{
+		Defs: map[*ast.Ident]types.Object{},
+		Uses: map[*ast.Ident]types.Object{},
+	}
+	pkg, _ := conf.Check(u.Name, fset, files, info)
+	return pkg, info
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+type goGrapher struct {
+	unit *unit.SourceUnit
+	fset *token.FileSet
+	root string // import path of the tree's root (see treeImportPath)
+	pkg  *types.Package
+	info *types.Info
+	out  *graph.Output
+
+	paths  map[string]bool                          // def paths of the defs added so far
+	fields map[*types.Package]map[*types.Var]string // names of the named struct types of fields, by package (see fieldType)
+}
+
+// declare adds the defs of the declarations in f (named file).
+func (g *goGrapher) declare(file string, f *ast.File) {
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil {
+				g.addDef(file, d.Name, "", graph.KindFunction, d, d.Doc, true)
+			} else if len(d.Recv.List) == 1 {
+				if recv := typeName(d.Recv.List[0].Type); recv != nil {
+					g.addDef(file, d.Name, recv.Name, graph.KindMethod, d, d.Doc, true)
+				}
+			}
+
+		case *ast.GenDecl:
+			// A declaration of a single name (without parentheses)
+			// extends to its keyword and has its doc comment.
+			single := len(d.Specs) == 1 && !d.Lparen.IsValid()
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					var node ast.Node = s
+					doc := s.Doc
+					if single {
+						node, doc = d, d.Doc
+					}
+					kind := graph.KindType
+					if _, ok := s.Type.(*ast.InterfaceType); ok {
+						kind = graph.KindInterface
+					}
+					g.addDef(file, s.Name, "", kind, node, doc, true)
+					g.declareMembers(file, s)
+
+				case *ast.ValueSpec:
+					var node ast.Node = s
+					doc := s.Doc
+					if single && len(s.Names) == 1 {
+						node, doc = d, d.Doc
+					}
+					kind := graph.KindVariable
+					if d.Tok == token.CONST {
+						kind = graph.KindConstant
+					}
+					for _, name := range s.Names {
+						g.addDef(file, name, "", kind, node, doc, true)
+					}
+				}
+			}
+		}
+	}
+}
+
+// declareMembers adds the defs of the fields of the struct type or the
+// methods of the interface type declared by s.
+func (g *goGrapher) declareMembers(file string, s *ast.TypeSpec) {
+	var fields *ast.FieldList
+	kind := graph.KindField
+	switch t := s.Type.(type) {
+	case *ast.StructType:
+		fields = t.Fields
+	case *ast.InterfaceType:
+		fields, kind = t.Methods, graph.KindMethod
+	}
+	if fields == nil {
+		return
+	}
+	for _, field := range fields.List {
+		if len(field.Names) == 0 && kind == graph.KindField {
+			// An embedded field is named by its type, and its name
+			// is a ref to the type (not a def ref).
+			if name := typeName(field.Type); name != nil {
+				g.addDef(file, name, s.Name.Name, kind, field, field.Doc, false)
+			}
+		}
+		for _, name := range field.Names {
+			g.addDef(file, name, s.Name.Name, kind, field, field.Doc, true)
+		}
+	}
+}
+
+// addDef adds the def named by the identifier name (and a def ref at
+// name, if defRef), which is a member of the type named parent (if
+// any), unless it's blank or a def with the same path was already
+// added.
+func (g *goGrapher) addDef(file string, name *ast.Ident, parent, kind string, node ast.Node, doc *ast.CommentGroup, defRef bool) {
+	defPath := name.Name
+	exported := ast.IsExported(name.Name)
+	if parent != "" {
+		defPath = parent + "/" + name.Name
+		exported = exported && ast.IsExported(parent)
+	}
+	if name.Name == "_" || g.paths[defPath] {
+		return
+	}
+	g.paths[defPath] = true
+	def := &graph.Def{
+		DefKey:   graph.DefKey{UnitType: g.unit.Type, Unit: g.unit.Name, Path: defPath},
+		Name:     name.Name,
+		Kind:     kind,
+		File:     file,
+		DefStart: g.offset(node.Pos()),
+		DefEnd:   g.offset(node.End()),
+		Exported: exported,
+		Test:     strings.HasSuffix(file, "_test.go"),
+	}
+	g.out.Defs = append(g.out.Defs, def)
+	if defRef {
+		g.addRef(file, name, g.unit.Name, defPath, true)
+	}
+	if doc != nil {
+		if text := doc.Text(); text != "" {
+			g.out.Docs = append(g.out.Docs, &graph.Doc{
+				DefKey: def.DefKey,
+				Format: "text/plain",
+				Data:   text,
+				File:   file,
+				Start:  g.offset(doc.Pos()),
+				End:    g.offset(doc.End()),
+			})
+		}
+	}
+}
+
+func (g *goGrapher) addRef(file string, id *ast.Ident, defUnit, defPath string, def bool) {
+	g.out.Refs = append(g.out.Refs, &graph.Ref{
+		DefUnitType: UnitType,
+		DefUnit:     defUnit,
+		DefPath:     defPath,
+		UnitType:    g.unit.Type,
+		Unit:        g.unit.Name,
+		Def:         def,
+		File:        file,
+		Start:       g.offset(id.Pos()),
+		End:         g.offset(id.End()),
+	})
+}
+
+// resolve adds the refs from the identifiers in f (named file) that
+// the type-checker resolved to package-level defs or to methods or
+// fields.
+func (g *goGrapher) resolve(file string, f *ast.File) {
+	ast.Inspect(f, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		obj := g.info.Uses[id]
+		if obj == nil || obj.Pkg() == nil {
+			return true
+		}
+		defUnit, defPath := g.objectDef(obj)
+		if defPath == "" {
+			return true
+		}
+		if defUnit == g.unit.Name {
+			if !g.paths[defPath] {
+				return true
+			}
+		} else if !g.inTree(defUnit) || !obj.Exported() {
+			return true
+		}
+		g.addRef(file, id, defUnit, defPath, false)
+		return true
+	})
+}
+
+// objectDef returns the unit (the import path of obj's package) and
+// def path of the def of obj, or an empty def path if obj isn't a
+// package-level object, a method of a named type, or a field of a
+// named struct type.
+func (g *goGrapher) objectDef(obj types.Object) (defUnit, defPath string) {
+	pkg := obj.Pkg()
+	defUnit = pkg.Path()
+	if pkg == g.pkg {
+		defUnit = g.unit.Name
+	}
+	switch o := obj.(type) {
+	case *types.Func:
+		o = o.Origin()
+		if recv := o.Type().(*types.Signature).Recv(); recv != nil {
+			if t := namedType(recv.Type()); t != nil {
+				return defUnit, t.Obj().Name() + "/" + o.Name()
+			}
+			return "", ""
+		}
+	case *types.Var:
+		if o.IsField() {
+			if t := g.fieldType(o.Origin()); t != "" {
+				return defUnit, t + "/" + o.Name()
+			}
+			return "", ""
+		}
+	case *types.PkgName, *types.Label:
+		return "", ""
+	}
+	if obj.Parent() != pkg.Scope() {
+		return "", ""
+	}
+	return defUnit, obj.Name()
+}
+
+// fieldType returns the name of the package-level named struct type
+// that declares field, or "" if there is none.
+func (g *goGrapher) fieldType(field *types.Var) string {
+	pkg := field.Pkg()
+	fields, ok := g.fields[pkg]
+	if !ok {
+		fields = map[*types.Var]string{}
+		scope := pkg.Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || tn.IsAlias() {
+				continue
+			}
+			if st, ok := tn.Type().Underlying().(*types.Struct); ok {
+				for i := 0; i < st.NumFields(); i++ {
+					fields[st.Field(i)] = name
+				}
+			}
+		}
+		g.fields[pkg] = fields
+	}
+	return fields[field]
+}
+
+// namedType returns the named type t, or that t points to, or nil if
+// t is neither.
+func namedType(t types.Type) *types.Named {
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	n, _ := t.(*types.Named)
+	return n
+}
+
+// inTree reports whether the package with the given import path is in
+// the same tree as the unit being graphed.
+func (g *goGrapher) inTree(importPath string) bool {
+	if g.root == "" || !strings.HasPrefix(importPath+"/", g.root+"/") {
+		return false
+	}
+	dir := strings.TrimPrefix(strings.TrimPrefix(importPath, g.root), "/")
+	if dir == "" {
+		dir = "."
+	}
+	fi, err := os.Stat(filepath.FromSlash(dir))
+	return err == nil && fi.IsDir()
+}
+
+func (g *goGrapher) offset(pos token.Pos) uint32 {
+	return uint32(g.fset.Position(pos).Offset)
+}
+
+// treeImportPath returns the import path of the root of the tree that
+// contains the GoPackage unit u, or "" if the unit isn't named by its
+// import path (see Scan).
+func treeImportPath(u *unit.SourceUnit) string {
+	switch {
+	case u.Name == u.Dir:
+		return ""
+	case u.Dir == "." || u.Dir == "":
+		return u.Name
+	case strings.HasSuffix(u.Name, "/"+u.Dir):
+		return strings.TrimSuffix(u.Name, "/"+u.Dir)
+	}
+	return ""
+}
+
+// typeName returns the name of the (possibly pointer to or
+// instantiated) named type expr, or nil if expr isn't one.
+func typeName(expr ast.Expr) *ast.Ident {
+	for {
+		switch e := expr.(type) {
+		case *ast.Ident:
+			return e
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.SelectorExpr:
+			return e.Sel
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,13 @@
+// Package a is a test package.
+package a
+
+// T is a type.
+type T struct {
+	F int
+	*U
+}
+
+// New returns a T.
+func New() *T { return &T{F: N} }
+
+func (t *T) M() int { return t.F }
@@ -0,0 +1,7 @@
+package a
+
+type U struct{}
+
+const N = 1
+
+var x = (*T).M
@@ -0,0 +1,12 @@
+package b
+
+import (
+	"fmt"
+
+	"example.com/m/a"
+)
+
+func f() {
+	N := a.New()
+	fmt.Println(N, a.N, N.M(), N.F)
+}
@@ -0,0 +1,90 @@
+package graph
+
+import "sort"
+
+// AliasKey returns the key of the def that d is an alias of (see
+// AliasOf), with the Repo, UnitType, and Unit defaulting to d's. If d
+// is not an alias, it returns the zero DefKey and false.
+func (d *Def) AliasKey() (DefKey, bool) {
+	if d.AliasOf == nil {
+		return DefKey{}, false
+	}
+	k := *d.AliasOf
+	if k.Repo == "" {
+		k.Repo = d.Repo
+	}
+	if k.UnitType == "" && k.Unit == "" {
+		k.UnitType, k.Unit = d.UnitType, d.Unit
+	}
+	return k, true
+}
+
+// Aliases maps the keys of alias defs to the keys of the defs that
+// they alias. The CommitIDs of the keys are ignored.
+type Aliases map[DefKey]DefKey
+
+// NewAliases returns the aliases defined by the defs that are aliases
+// (i.e., that have an AliasOf).
+func NewAliases(defs []*Def) Aliases {
+	a := Aliases{}
+	a.Add(defs...)
+	return a
+}
+
+// Add adds the aliases defined by the defs that are aliases.
+func (a Aliases) Add(defs ...*Def) {
+	for _, d := range defs {
+		if k, ok := d.AliasKey(); ok {
+			a[withoutCommitID(d.DefKey)] = withoutCommitID(k)
+		}
+	}
+}
+
+// Resolve returns the key of the canonical def that key refers to,
+// following chains of aliases. If key is not an alias, it is returned
+// unchanged. The returned key has key's CommitID. If the chain of
+// aliases is cyclic, Resolve returns key and false.
+func (a Aliases) Resolve(key DefKey) (DefKey, bool) {
+	k := withoutCommitID(key)
+	seen := map[DefKey]struct{}{}
+	for {
+		target, isAlias := a[k]
+		if !isAlias {
+			break
+		}
+		if _, cyclic := seen[k]; cyclic {
+			return key, false
+		}
+		seen[k] = struct{}{}
+		k = target
+	}
+	k.CommitID = key.CommitID
+	return k, true
+}
+
+// AliasesOf returns the keys (sorted) of the alias defs that resolve
+// to key (see Resolve), not including key itself.
+func (a Aliases) AliasesOf(key DefKey) []DefKey {
+	key = withoutCommitID(key)
+	var keys []DefKey
+	for alias := range a {
+		if k, ok := a.Resolve(alias); ok && k == key && alias != key {
+			keys = append(keys, alias)
+		}
+	}
+	sort.Sort(defKeys(keys))
+	return keys
+}
+
+func withoutCommitID(k DefKey) DefKey {
+	k.CommitID = ""
+	return k
+}
+
+type defKeys []DefKey
+
+func (v defKeys) Len() int      { return len(v) }
+func (v defKeys) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v defKeys) Less(i, j int) bool {
+	return defLess(&Def{DefKey: v[i]}, &Def{DefKey: v[j]})
+}
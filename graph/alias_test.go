@@ -0,0 +1,47 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAliases(t *testing.T) {
+	key := func(path string) DefKey { return DefKey{UnitType: "t", Unit: "u", Path: path} }
+	defs := []*Def{
+		{DefKey: key("x/y")},
+		{DefKey: key("z/y"), AliasOf: &DefKey{Path: "x/y"}},
+		{DefKey: key("w/y"), AliasOf: &DefKey{UnitType: "t", Unit: "u", Path: "z/y"}},
+		{DefKey: DefKey{UnitType: "t", Unit: "u2", Path: "v/y"}, AliasOf: &DefKey{UnitType: "t", Unit: "u", Path: "w/y"}},
+		{DefKey: key("c1"), AliasOf: &DefKey{Path: "c2"}},
+		{DefKey: key("c2"), AliasOf: &DefKey{Path: "c1"}},
+	}
+	a := NewAliases(defs)
+
+	tests := []struct {
+		key  DefKey
+		want DefKey
+		ok   bool
+	}{
+		{key("x/y"), key("x/y"), true},
+		{key("z/y"), key("x/y"), true},
+		{key("w/y"), key("x/y"), true},
+		{DefKey{UnitType: "t", Unit: "u2", Path: "v/y"}, key("x/y"), true},
+		{DefKey{CommitID: "c", UnitType: "t", Unit: "u", Path: "w/y"}, DefKey{CommitID: "c", UnitType: "t", Unit: "u", Path: "x/y"}, true},
+		{key("c1"), key("c1"), false},
+		{key("other"), key("other"), true},
+	}
+	for _, test := range tests {
+		got, ok := a.Resolve(test.key)
+		if got != test.want || ok != test.ok {
+			t.Errorf("Resolve(%+v): got %+v, %v, want %+v, %v", test.key, got, ok, test.want, test.ok)
+		}
+	}
+
+	want := []DefKey{key("w/y"), key("z/y"), {UnitType: "t", Unit: "u2", Path: "v/y"}}
+	if got := a.AliasesOf(key("x/y")); !reflect.DeepEqual(got, want) {
+		t.Errorf("AliasesOf: got %+v, want %+v", got, want)
+	}
+	if got := a.AliasesOf(key("c1")); len(got) != 0 {
+		t.Errorf("AliasesOf cyclic alias: got %+v, want none", got)
+	}
+}
@@ -13,7 +13,22 @@ func IsValidTreePath(treePath string) bool {
 
 func (s *Def) Fmt() DefPrintFormatter { return PrintFormatter(s) }
 
-func (s *Def) sortKey() string { return s.DefKey.String() }
+// defLess reports whether a sorts before b, comparing their DefKey
+// fields in order.
+func defLess(a, b *Def) bool {
+	for _, f := range [][2]string{
+		{a.Repo, b.Repo},
+		{a.CommitID, b.CommitID},
+		{a.UnitType, b.UnitType},
+		{a.Unit, b.Unit},
+		{a.Path, b.Path},
+	} {
+		if f[0] != f[1] {
+			return f[0] < f[1]
+		}
+	}
+	return false
+}
 
 // Propagate describes type/value propagation in code. A Propagate entry from A
 // (src) to B (dst) indicates that the type/value of A propagates to B. In Tern,
@@ -92,7 +107,7 @@ type Defs []*Def
 
 func (vs Defs) Len() int           { return len(vs) }
 func (vs Defs) Swap(i, j int)      { vs[i], vs[j] = vs[j], vs[i] }
-func (vs Defs) Less(i, j int) bool { return vs[i].sortKey() < vs[j].sortKey() }
+func (vs Defs) Less(i, j int) bool { return defLess(vs[i], vs[j]) }
 
 func (defs Defs) Keys() (keys []DefKey) {
 	keys = make([]DefKey, len(defs))
@@ -15,6 +15,7 @@
 		DefKey
 		Def
 		DefDoc
+		DefAuthor
 		DefFormatStrings
 		QualFormatStrings
 		Doc
@@ -88,16 +89,22 @@ type Def struct {
 	DefKey `protobuf:"bytes,1,opt,name=Key,embedded=Key" json:""`
 	// Name of the definition. This need not be unique.
 	Name string `protobuf:"bytes,2,opt,name=Name,proto3" json:"Name"`
-	// Kind is the kind of thing this definition is. This is
-	// language-specific. Possible values include "type", "func",
-	// "var", etc.
+	// Kind is the kind of thing this definition is. It is one of the
+	// canonical def kinds (see the Kind* constants), so that defs of
+	// the same kind can be queried consistently across languages. The
+	// toolchain's language-specific kind is preserved in RawKind.
 	Kind     string `protobuf:"bytes,3,opt,name=Kind,proto3" json:"Kind,omitempty"`
 	File     string `protobuf:"bytes,4,opt,name=File,proto3" json:"File"`
+	// DefStart and DefEnd are the byte offsets (not character
+	// offsets) in File, as it is stored, of the start and end of this
+	// def's range. See grapher.OffsetUnit for how toolchains that emit
+	// character offsets are handled.
 	DefStart uint32 `protobuf:"varint,5,opt,name=DefStart,proto3" json:"DefStart"`
 	DefEnd   uint32 `protobuf:"varint,6,opt,name=DefEnd,proto3" json:"DefEnd"`
 	// Exported is whether this def is part of a source unit's
 	// public API. For example, in Java a "public" field is
 	// Exported.
+	// If Visibility is set, Exported is derived from it.
 	Exported bool `protobuf:"varint,7,opt,name=Exported,proto3" json:"Exported,omitempty"`
 	// Local is whether this def is local to a function or some
 	// other inner scope. Local defs do *not* have module,
@@ -129,6 +136,36 @@ type Def struct {
 	// tree-path for some def.
 	// The following regex captures the children of a tree-path X: X(/-[^/]*)*(/[^/-][^/]*)
 	TreePath string `protobuf:"bytes,17,opt,name=TreePath,proto3" json:"TreePath,omitempty"`
+	// Authors are the authors of this def's source code, as determined
+	// by "git blame" (or the equivalent). This field is not set in the
+	// Defs produced by graphers; it is only set if authorship
+	// information was computed and imported (see the authorship
+	// package).
+	Authors []*DefAuthor `protobuf:"bytes,18,rep,name=Authors" json:"Authors,omitempty"`
+	// RawKind is the language-specific kind that the toolchain emitted
+	// for this def (e.g., "struct", "trait", or "ctor"), if it differs
+	// from the canonical Kind.
+	RawKind string `protobuf:"bytes,19,opt,name=RawKind,proto3" json:"RawKind,omitempty"`
+	// Visibility is the def's visibility: "public", "protected",
+	// "internal", or "private" (see the Visibility* constants), or
+	// empty if unknown. Exported is true iff Visibility is "public" or
+	// "protected".
+	Visibility string `protobuf:"bytes,20,opt,name=Visibility,proto3" json:"Visibility,omitempty"`
+	// Generated is whether this def is defined in a generated file
+	// (see IsGenerated).
+	Generated bool `protobuf:"varint,21,opt,name=Generated,proto3" json:"Generated,omitempty"`
+	// AliasOf, if set, is the key of the def that this def is an alias
+	// of (e.g., a name that re-exports another def, such as Python's
+	// "from x import y" or a TypeScript "export { y } from 'x'"). Refs
+	// to this def are treated as refs to the def it (transitively)
+	// aliases (see Aliases). If the Repo (or the UnitType and Unit) is
+	// empty, it is assumed to be that of this def.
+	AliasOf *DefKey `protobuf:"bytes,22,opt,name=AliasOf" json:"AliasOf,omitempty"`
+	// RefCount is the number of refs to this def in its repository (not
+	// counting its own definition), if its refs were dropped when its
+	// graph data was downsampled (see RefCounts). Otherwise it is 0,
+	// and the refs must be counted.
+	RefCount uint32 `protobuf:"varint,23,opt,name=RefCount,proto3" json:"RefCount,omitempty"`
 }
 
 func (m *Def) Reset()         { *m = Def{} }
@@ -149,6 +186,27 @@ func (m *DefDoc) Reset()         { *m = DefDoc{} }
 func (m *DefDoc) String() string { return proto.CompactTextString(m) }
 func (*DefDoc) ProtoMessage()    {}
 
+// DefAuthor is an author of a Def's source code.
+type DefAuthor struct {
+	// Name is the author's name.
+	Name string `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
+	// Email is the author's email address.
+	Email string `protobuf:"bytes,2,opt,name=Email,proto3" json:"Email"`
+	// LastCommitID is the ID of the most recent commit in which the
+	// author changed the def.
+	LastCommitID string `protobuf:"bytes,3,opt,name=LastCommitID,proto3" json:"LastCommitID"`
+	// LastCommitDate is the author date (in RFC 3339 format) of
+	// LastCommitID.
+	LastCommitDate string `protobuf:"bytes,4,opt,name=LastCommitDate,proto3" json:"LastCommitDate"`
+	// Lines is the number of lines of the def that were last changed
+	// by the author.
+	Lines uint32 `protobuf:"varint,5,opt,name=Lines,proto3" json:"Lines"`
+}
+
+func (m *DefAuthor) Reset()         { *m = DefAuthor{} }
+func (m *DefAuthor) String() string { return proto.CompactTextString(m) }
+func (*DefAuthor) ProtoMessage()    {}
+
 // DefFormatStrings contains the various def format strings.
 type DefFormatStrings struct {
 	Name                 QualFormatStrings `protobuf:"bytes,1,opt,name=Name" json:"Name"`
@@ -334,6 +392,67 @@ func (m *Def) MarshalTo(data []byte) (int, error) {
 		i = encodeVarintDef(data, i, uint64(len(m.TreePath)))
 		i += copy(data[i:], m.TreePath)
 	}
+	if len(m.Authors) > 0 {
+		for _, msg := range m.Authors {
+			data[i] = 0x92
+			i++
+			data[i] = 0x1
+			i++
+			i = encodeVarintDef(data, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(data[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	if len(m.RawKind) > 0 {
+		data[i] = 0x9a
+		i++
+		data[i] = 0x1
+		i++
+		i = encodeVarintDef(data, i, uint64(len(m.RawKind)))
+		i += copy(data[i:], m.RawKind)
+	}
+	if len(m.Visibility) > 0 {
+		data[i] = 0xa2
+		i++
+		data[i] = 0x1
+		i++
+		i = encodeVarintDef(data, i, uint64(len(m.Visibility)))
+		i += copy(data[i:], m.Visibility)
+	}
+	if m.Generated {
+		data[i] = 0xa8
+		i++
+		data[i] = 0x1
+		i++
+		if m.Generated {
+			data[i] = 1
+		} else {
+			data[i] = 0
+		}
+		i++
+	}
+	if m.AliasOf != nil {
+		data[i] = 0xb2
+		i++
+		data[i] = 0x1
+		i++
+		i = encodeVarintDef(data, i, uint64(m.AliasOf.Size()))
+		n, err := m.AliasOf.MarshalTo(data[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n
+	}
+	if m.RefCount != 0 {
+		data[i] = 0xb8
+		i++
+		data[i] = 0x1
+		i++
+		i = encodeVarintDef(data, i, uint64(m.RefCount))
+	}
 	return i, nil
 }
 
@@ -367,6 +486,53 @@ func (m *DefDoc) MarshalTo(data []byte) (int, error) {
 	return i, nil
 }
 
+func (m *DefAuthor) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *DefAuthor) MarshalTo(data []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Name) > 0 {
+		data[i] = 0xa
+		i++
+		i = encodeVarintDef(data, i, uint64(len(m.Name)))
+		i += copy(data[i:], m.Name)
+	}
+	if len(m.Email) > 0 {
+		data[i] = 0x12
+		i++
+		i = encodeVarintDef(data, i, uint64(len(m.Email)))
+		i += copy(data[i:], m.Email)
+	}
+	if len(m.LastCommitID) > 0 {
+		data[i] = 0x1a
+		i++
+		i = encodeVarintDef(data, i, uint64(len(m.LastCommitID)))
+		i += copy(data[i:], m.LastCommitID)
+	}
+	if len(m.LastCommitDate) > 0 {
+		data[i] = 0x22
+		i++
+		i = encodeVarintDef(data, i, uint64(len(m.LastCommitDate)))
+		i += copy(data[i:], m.LastCommitDate)
+	}
+	if m.Lines != 0 {
+		data[i] = 0x28
+		i++
+		i = encodeVarintDef(data, i, uint64(m.Lines))
+	}
+	return i, nil
+}
+
 func (m *DefFormatStrings) Marshal() (data []byte, err error) {
 	size := m.Size()
 	data = make([]byte, size)
@@ -574,6 +740,30 @@ func (m *Def) Size() (n int) {
 	if l > 0 {
 		n += 2 + l + sovDef(uint64(l))
 	}
+	if len(m.Authors) > 0 {
+		for _, e := range m.Authors {
+			l = e.Size()
+			n += 2 + l + sovDef(uint64(l))
+		}
+	}
+	l = len(m.RawKind)
+	if l > 0 {
+		n += 2 + l + sovDef(uint64(l))
+	}
+	l = len(m.Visibility)
+	if l > 0 {
+		n += 2 + l + sovDef(uint64(l))
+	}
+	if m.Generated {
+		n += 3
+	}
+	if m.AliasOf != nil {
+		l = m.AliasOf.Size()
+		n += 2 + l + sovDef(uint64(l))
+	}
+	if m.RefCount != 0 {
+		n += 2 + sovDef(uint64(m.RefCount))
+	}
 	return n
 }
 
@@ -591,6 +781,31 @@ func (m *DefDoc) Size() (n int) {
 	return n
 }
 
+func (m *DefAuthor) Size() (n int) {
+	var l int
+	_ = l
+	l = len(m.Name)
+	if l > 0 {
+		n += 1 + l + sovDef(uint64(l))
+	}
+	l = len(m.Email)
+	if l > 0 {
+		n += 1 + l + sovDef(uint64(l))
+	}
+	l = len(m.LastCommitID)
+	if l > 0 {
+		n += 1 + l + sovDef(uint64(l))
+	}
+	l = len(m.LastCommitDate)
+	if l > 0 {
+		n += 1 + l + sovDef(uint64(l))
+	}
+	if m.Lines != 0 {
+		n += 1 + sovDef(uint64(m.Lines))
+	}
+	return n
+}
+
 func (m *DefFormatStrings) Size() (n int) {
 	var l int
 	_ = l
@@ -1183,6 +1398,167 @@ func (m *Def) Unmarshal(data []byte) error {
 			}
 			m.TreePath = string(data[iNdEx:postIndex])
 			iNdEx = postIndex
+		case 18:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Authors", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDef
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthDef
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Authors = append(m.Authors, &DefAuthor{})
+			if err := m.Authors[len(m.Authors)-1].Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 19:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RawKind", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDef
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthDef
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.RawKind = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 20:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Visibility", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDef
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthDef
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Visibility = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 21:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Generated", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDef
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				v |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Generated = bool(v != 0)
+		case 22:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field AliasOf", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDef
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthDef
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.AliasOf == nil {
+				m.AliasOf = &DefKey{}
+			}
+			if err := m.AliasOf.Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 23:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RefCount", wireType)
+			}
+			m.RefCount = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDef
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.RefCount |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipDef(data[iNdEx:])
@@ -1312,6 +1688,191 @@ func (m *DefDoc) Unmarshal(data []byte) error {
 	}
 	return nil
 }
+func (m *DefAuthor) Unmarshal(data []byte) error {
+	l := len(data)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowDef
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: DefAuthor: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: DefAuthor: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Name", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDef
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthDef
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Name = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Email", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDef
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthDef
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Email = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LastCommitID", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDef
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthDef
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.LastCommitID = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LastCommitDate", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDef
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthDef
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.LastCommitDate = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Lines", wireType)
+			}
+			m.Lines = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDef
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				m.Lines |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipDef(data[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthDef
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func (m *DefFormatStrings) Unmarshal(data []byte) error {
 	l := len(data)
 	iNdEx := 0
@@ -0,0 +1,315 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Standard Def.Data fields. A toolchain's Def.Data schema (see
+// DefDataSchema) may declare which of its own fields hold these, so
+// that consumers can read them from any toolchain's defs (see
+// (*Def).StandardData) once the data is normalized (see
+// (*DefDataRegistry).Normalize).
+const (
+	DataPackageName  = "PackageName"  // name of the package or module that contains the def
+	DataReceiverType = "ReceiverType" // type that a method or field belongs to
+	DataTypeString   = "TypeString"   // the def's type or signature, as written in its language
+)
+
+// standardDataFields lists the standard Def.Data fields. They all hold
+// strings.
+var standardDataFields = []string{DataPackageName, DataReceiverType, DataTypeString}
+
+func isStandardDataField(name string) bool {
+	for _, f := range standardDataFields {
+		if name == f {
+			return true
+		}
+	}
+	return false
+}
+
+// StandardDefData holds the standard Def.Data fields of a def.
+type StandardDefData struct {
+	PackageName  string `json:",omitempty"`
+	ReceiverType string `json:",omitempty"`
+	TypeString   string `json:",omitempty"`
+}
+
+// StandardData returns the standard fields of d.Data (which are only
+// set for all toolchains if the data was normalized). Fields that
+// aren't set (or aren't strings) are empty.
+func (d *Def) StandardData() StandardDefData {
+	var fields map[string]interface{}
+	json.Unmarshal(d.Data, &fields)
+	str := func(name string) string {
+		s, _ := fields[name].(string)
+		return s
+	}
+	return StandardDefData{
+		PackageName:  str(DataPackageName),
+		ReceiverType: str(DataReceiverType),
+		TypeString:   str(DataTypeString),
+	}
+}
+
+// A DefDataSchema declares the fields of the (otherwise opaque)
+// Def.Data JSON objects of a toolchain's defs in source units of a
+// type. Toolchains declare their schemas in the DefData list of their
+// Srclibtoolchain file.
+type DefDataSchema struct {
+	// UnitType is the source unit type of the defs.
+	UnitType string
+
+	// Kinds, if set, restricts the schema to defs of these kinds
+	// (matching Def.Kind, or its canonical kind; see CanonicalKind).
+	// A schema with Kinds takes precedence over one without.
+	Kinds []string `json:",omitempty"`
+
+	// Fields describes the top-level fields of the Data object, keyed
+	// by name. Fields that aren't listed are allowed, with any value.
+	Fields map[string]*DefDataField
+}
+
+// A DefDataField describes a field of the Def.Data object.
+type DefDataField struct {
+	// Type is the JSON type of the field's value: "string",
+	// "number", "boolean", "object", "array", or "any". A null value
+	// is treated as a missing field.
+	Type string
+
+	// Required is whether the field must be present.
+	Required bool `json:",omitempty"`
+
+	// Standard is the standard field (e.g., "PackageName"; see
+	// DataPackageName) whose value this field holds, if any. The
+	// field must be a string.
+	Standard string `json:",omitempty"`
+}
+
+var defDataTypes = []string{"string", "number", "boolean", "object", "array", "any"}
+
+// Validate checks that s is well formed: that its field types and
+// standard fields are known, that standard fields are held by string
+// fields, and that fields named like a standard field hold it.
+func (s *DefDataSchema) Validate() error {
+	if s.UnitType == "" {
+		return fmt.Errorf("Def.Data schema has no UnitType")
+	}
+	standard := map[string]string{}
+	for _, name := range sortedDataFieldNames(s.Fields) {
+		f := s.Fields[name]
+		if f == nil || !containsString(defDataTypes, f.Type) {
+			return fmt.Errorf("Def.Data schema for %s: field %q has invalid type (expected one of %s)", s.UnitType, name, strings.Join(defDataTypes, ", "))
+		}
+		if isStandardDataField(name) && f.Standard != name {
+			return fmt.Errorf("Def.Data schema for %s: field %q has the name of a standard field but doesn't hold it (set its Standard to %q)", s.UnitType, name, name)
+		}
+		if f.Standard == "" {
+			continue
+		}
+		if !isStandardDataField(f.Standard) {
+			return fmt.Errorf("Def.Data schema for %s: field %q holds unknown standard field %q (expected one of %s)", s.UnitType, name, f.Standard, strings.Join(standardDataFields, ", "))
+		}
+		if f.Type != "string" {
+			return fmt.Errorf("Def.Data schema for %s: field %q holds standard field %q, so its type must be string", s.UnitType, name, f.Standard)
+		}
+		if other, dup := standard[f.Standard]; dup {
+			return fmt.Errorf("Def.Data schema for %s: fields %q and %q both hold standard field %q", s.UnitType, other, name, f.Standard)
+		}
+		standard[f.Standard] = name
+	}
+	return nil
+}
+
+// appliesTo reports whether s applies to defs of the given kind.
+func (s *DefDataSchema) appliesTo(kind string) bool {
+	if len(s.Kinds) == 0 {
+		return true
+	}
+	canonical := CanonicalKind(kind)
+	for _, k := range s.Kinds {
+		if strings.EqualFold(k, kind) || k == canonical {
+			return true
+		}
+	}
+	return false
+}
+
+// Check checks that data (a def's Data) matches s: that it is a JSON
+// object (or empty) whose fields have the declared types and that has
+// the required fields.
+func (s *DefDataSchema) Check(data []byte) error {
+	fields, err := dataFields(data)
+	if err != nil {
+		return err
+	}
+	for _, name := range sortedDataFieldNames(s.Fields) {
+		f := s.Fields[name]
+		v, present := fields[name]
+		if !present || string(v) == "null" {
+			if f.Required {
+				return fmt.Errorf("missing required field %q", name)
+			}
+			continue
+		}
+		if t := jsonType(v); f.Type != "any" && t != f.Type {
+			return fmt.Errorf("field %q is a %s, want %s", name, t, f.Type)
+		}
+	}
+	return nil
+}
+
+// dataFields returns the fields of the JSON object data. Empty data
+// has no fields.
+func dataFields(data []byte) (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if len(data) == 0 {
+		return fields, nil
+	}
+	if err := json.Unmarshal(data, &fields); err != nil || (fields == nil && string(data) != "null") {
+		return nil, fmt.Errorf("Data is not a JSON object")
+	}
+	return fields, nil
+}
+
+// jsonType returns the JSON type of the (valid) JSON value v.
+func jsonType(v json.RawMessage) string {
+	switch s := strings.TrimSpace(string(v)); {
+	case strings.HasPrefix(s, `"`):
+		return "string"
+	case strings.HasPrefix(s, "{"):
+		return "object"
+	case strings.HasPrefix(s, "["):
+		return "array"
+	case s == "true" || s == "false":
+		return "boolean"
+	case s == "null":
+		return "null"
+	}
+	return "number"
+}
+
+// A DefDataRegistry holds the Def.Data schemas of toolchains, to
+// validate and normalize the Data of their defs. A nil registry has no
+// schemas.
+type DefDataRegistry struct {
+	schemas map[string][]*DefDataSchema // keyed by unit type
+}
+
+// NewDefDataRegistry returns a registry of schemas, which must be
+// valid (see (*DefDataSchema).Validate). At most one schema without
+// Kinds may be given for each unit type.
+func NewDefDataRegistry(schemas []*DefDataSchema) (*DefDataRegistry, error) {
+	r := &DefDataRegistry{schemas: map[string][]*DefDataSchema{}}
+	for _, s := range schemas {
+		if err := s.Validate(); err != nil {
+			return nil, err
+		}
+		for _, other := range r.schemas[s.UnitType] {
+			if len(s.Kinds) == 0 && len(other.Kinds) == 0 {
+				return nil, fmt.Errorf("more than one Def.Data schema for all kinds of %s defs", s.UnitType)
+			}
+		}
+		r.schemas[s.UnitType] = append(r.schemas[s.UnitType], s)
+	}
+	return r, nil
+}
+
+// Lookup returns the schema for the Data of defs of the given kind in
+// source units of the given type, or nil if there is none.
+func (r *DefDataRegistry) Lookup(unitType, kind string) *DefDataSchema {
+	if r == nil {
+		return nil
+	}
+	var all *DefDataSchema
+	for _, s := range r.schemas[unitType] {
+		if len(s.Kinds) == 0 {
+			all = s
+		} else if s.appliesTo(kind) {
+			return s
+		}
+	}
+	return all
+}
+
+// lookupDef returns the schema for the Data of def, in a source unit
+// of type unitType, matching schemas' Kinds against def's
+// language-specific kind if it has one.
+func (r *DefDataRegistry) lookupDef(unitType string, def *Def) *DefDataSchema {
+	kind := def.Kind
+	if def.RawKind != "" {
+		kind = def.RawKind
+	}
+	return r.Lookup(unitType, kind)
+}
+
+// Check checks that the Data of def, in a source unit of type
+// unitType (which graphers may leave out of def.UnitType), matches
+// its schema (see (*DefDataSchema).Check), if it has one.
+func (r *DefDataRegistry) Check(unitType string, def *Def) error {
+	s := r.lookupDef(unitType, def)
+	if s == nil {
+		return nil
+	}
+	return s.Check(def.Data)
+}
+
+// Normalize checks def's Data (see Check) and adds to it the standard
+// fields (see DataPackageName, etc.) that its schema declares, copied
+// from the fields that hold them, so that they can be read without
+// knowing the toolchain (see (*Def).StandardData). Data that doesn't
+// match its schema is left unchanged, and the mismatch is returned.
+func (r *DefDataRegistry) Normalize(unitType string, def *Def) error {
+	s := r.lookupDef(unitType, def)
+	if s == nil {
+		return nil
+	}
+	if err := s.Check(def.Data); err != nil {
+		return err
+	}
+	fields, err := dataFields(def.Data)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, name := range sortedDataFieldNames(s.Fields) {
+		std := s.Fields[name].Standard
+		if v, present := fields[name]; present && std != "" && std != name && string(v) != "null" {
+			if fields == nil {
+				fields = map[string]json.RawMessage{}
+			}
+			fields[std] = v
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	def.Data = data
+	return nil
+}
+
+func sortedDataFieldNames(fields map[string]*DefDataField) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefDataSchema_Validate(t *testing.T) {
+	tests := map[string]struct {
+		fields map[string]*DefDataField
+		errSub string
+	}{
+		"ok":            {map[string]*DefDataField{"Recv": {Type: "string", Standard: DataReceiverType}, "N": {Type: "number"}}, ""},
+		"bad type":      {map[string]*DefDataField{"X": {Type: "int"}}, "invalid type"},
+		"bad standard":  {map[string]*DefDataField{"X": {Type: "string", Standard: "Nope"}}, "unknown standard field"},
+		"nonstring":     {map[string]*DefDataField{"X": {Type: "object", Standard: DataTypeString}}, "must be string"},
+		"dup standard":  {map[string]*DefDataField{"X": {Type: "string", Standard: DataTypeString}, "Y": {Type: "string", Standard: DataTypeString}}, "both hold"},
+		"standard name": {map[string]*DefDataField{"PackageName": {Type: "string"}}, "name of a standard field"},
+	}
+	for label, test := range tests {
+		err := (&DefDataSchema{UnitType: "t", Fields: test.fields}).Validate()
+		if test.errSub == "" && err != nil {
+			t.Errorf("%s: got error %v, want none", label, err)
+		} else if test.errSub != "" && (err == nil || !strings.Contains(err.Error(), test.errSub)) {
+			t.Errorf("%s: got error %v, want one containing %q", label, err, test.errSub)
+		}
+	}
+}
+
+func TestDefDataRegistry(t *testing.T) {
+	r, err := NewDefDataRegistry([]*DefDataSchema{
+		{UnitType: "GoPackage", Fields: map[string]*DefDataField{
+			"PkgName": {Type: "string", Required: true, Standard: DataPackageName},
+		}},
+		{UnitType: "GoPackage", Kinds: []string{"method"}, Fields: map[string]*DefDataField{
+			"PkgName": {Type: "string", Required: true, Standard: DataPackageName},
+			"Recv":    {Type: "string", Required: true, Standard: DataReceiverType},
+			"Params":  {Type: "array"},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		def    Def
+		errSub string
+		data   string // normalized Data
+	}{
+		{Def{Kind: KindFunction, Data: []byte(`{"PkgName":"a"}`)}, "", `{"PackageName":"a","PkgName":"a"}`},
+		{Def{Kind: KindMethod, RawKind: "method", Data: []byte(`{"PkgName":"a","Recv":"*T","Params":[]}`)}, "", `{"PackageName":"a","Params":[],"PkgName":"a","ReceiverType":"*T","Recv":"*T"}`},
+		{Def{Kind: KindMethod, Data: []byte(`{"PkgName":"a"}`)}, `missing required field "Recv"`, `{"PkgName":"a"}`},
+		{Def{Kind: KindFunction, Data: []byte(`{"PkgName":1}`)}, `field "PkgName" is a number, want string`, `{"PkgName":1}`},
+		{Def{Kind: KindFunction, Data: []byte(`[1]`)}, "not a JSON object", `[1]`},
+		{Def{Kind: KindFunction}, `missing required field "PkgName"`, ``},
+	}
+	for _, test := range tests {
+		def := test.def
+		orig := string(def.Data)
+		err := r.Normalize("GoPackage", &def)
+		if test.errSub == "" && err != nil {
+			t.Errorf("%s: got error %v, want none", orig, err)
+		} else if test.errSub != "" && (err == nil || !strings.Contains(err.Error(), test.errSub)) {
+			t.Errorf("%s: got error %v, want one containing %q", orig, err, test.errSub)
+		}
+		if string(def.Data) != test.data {
+			t.Errorf("%s: got normalized Data %s, want %s", orig, def.Data, test.data)
+		}
+	}
+
+	// Defs of other unit types have no schema.
+	if err := r.Check("PipPackage", &Def{Data: []byte(`[1]`)}); err != nil {
+		t.Errorf("got error %v for a unit type without a schema", err)
+	}
+
+	std := (&Def{Data: []byte(`{"PackageName":"a","ReceiverType":"*T","TypeString":7}`)}).StandardData()
+	if want := (StandardDefData{PackageName: "a", ReceiverType: "*T"}); std != want {
+		t.Errorf("got standard data %+v, want %+v", std, want)
+	}
+
+	if _, err := NewDefDataRegistry([]*DefDataSchema{{UnitType: "t"}, {UnitType: "t"}}); err == nil {
+		t.Error("got no error for two schemas for all kinds of the same unit type")
+	}
+}
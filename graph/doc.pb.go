@@ -29,7 +29,8 @@ type Doc struct {
 	Data string `protobuf:"bytes,3,opt,name=Data,proto3" json:"Data"`
 	// File is the filename where this Doc exists.
 	File string `protobuf:"bytes,4,opt,name=File,proto3" json:"File,omitempty"`
-	// Start is the byte offset of this Doc's first byte in File.
+	// Start is the byte offset (not character offset) of this Doc's
+	// first byte in File, as it is stored.
 	Start uint32 `protobuf:"varint,5,opt,name=Start,proto3" json:"Start,omitempty"`
 	// End is the byte offset of this Doc's last byte in File.
 	End uint32 `protobuf:"varint,6,opt,name=End,proto3" json:"End,omitempty"`
@@ -0,0 +1,162 @@
+// Package docs normalizes the documentation that toolchains emit for
+// defs (in Markdown, reStructuredText, Javadoc HTML, plain text, or
+// other formats) into sanitized HTML and plain text, so that
+// consumers of build data don't each need renderers for every
+// language's doc format.
+package docs
+
+import (
+	"html"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// Doc formats (MIME types) understood by this package. Docs in other
+// formats are treated as plain text.
+const (
+	HTML     = "text/html"
+	Text     = "text/plain"
+	Markdown = "text/x-markdown"
+	RST      = "text/x-rst"
+)
+
+// mediaType returns the normalized media type of format, without
+// parameters and with aliases resolved.
+func mediaType(format string) string {
+	if semi := strings.IndexByte(format, ';'); semi != -1 {
+		format = format[:semi]
+	}
+	format = strings.ToLower(strings.TrimSpace(format))
+	switch format {
+	case "text/markdown":
+		return Markdown
+	case "text/prs.fallenstein.rst":
+		return RST
+	case "":
+		return Text
+	}
+	return format
+}
+
+// ToHTML converts data, a doc in the given format, to sanitized HTML.
+func ToHTML(format, data string) string {
+	switch mediaType(format) {
+	case HTML:
+		if isJavadoc(data) {
+			data = javadocToHTML(data)
+		}
+		return Sanitize(data)
+	case Markdown:
+		return Sanitize(markdownToHTML(data))
+	case RST:
+		return Sanitize(rstToHTML(data))
+	}
+	return textToHTML(data)
+}
+
+// textToHTML converts plain text to HTML. Paragraphs are separated by
+// blank lines, and paragraphs whose lines are all indented are
+// preformatted (as in Go doc comments).
+func textToHTML(s string) string {
+	var buf []byte
+	lines := splitLines(s)
+	for i := 0; i < len(lines); {
+		if strings.TrimSpace(lines[i]) == "" {
+			i++
+			continue
+		}
+		start := i
+		indented := true
+		for ; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+			indented = indented && isSpace(lines[i][0])
+		}
+		para := strings.Join(lines[start:i], "\n")
+		if indented {
+			buf = append(buf, "<pre>"+html.EscapeString(dedent(para))+"</pre>\n"...)
+		} else {
+			buf = append(buf, "<p>"+html.EscapeString(strings.TrimSpace(para))+"</p>\n"...)
+		}
+	}
+	return string(buf)
+}
+
+// docGroupKey identifies the docs that document the same def (or the
+// same freestanding comment) in different formats.
+type docGroupKey struct {
+	graph.DefKey
+	File  string
+	Start uint32
+}
+
+// Normalize returns docs with HTML and plain text versions of each
+// documented def (or freestanding comment) added. Existing HTML docs
+// are sanitized in place. Missing HTML versions are converted from
+// the def's doc in another format (preferring Markdown, then
+// reStructuredText, then any other non-plain-text format, then plain
+// text), and missing plain text versions are extracted from the HTML.
+// Docs in other formats are kept unchanged.
+func Normalize(docs []*graph.Doc) []*graph.Doc {
+	type docGroup struct {
+		byFormat map[string]*graph.Doc
+		formats  []string // in order of appearance
+	}
+	var keys []docGroupKey
+	groups := map[docGroupKey]*docGroup{}
+	for _, d := range docs {
+		k := docGroupKey{DefKey: d.DefKey, File: d.File, Start: d.Start}
+		g, ok := groups[k]
+		if !ok {
+			g = &docGroup{byFormat: map[string]*graph.Doc{}}
+			groups[k] = g
+			keys = append(keys, k)
+		}
+		if f := mediaType(d.Format); g.byFormat[f] == nil {
+			g.byFormat[f] = d
+			g.formats = append(g.formats, f)
+		}
+	}
+
+	for _, k := range keys {
+		g := groups[k].byFormat
+		htmlDoc := g[HTML]
+		if htmlDoc != nil {
+			htmlDoc.Data = ToHTML(htmlDoc.Format, htmlDoc.Data)
+		} else {
+			src := g[Markdown]
+			if src == nil {
+				src = g[RST]
+			}
+			if src == nil {
+				for _, f := range groups[k].formats {
+					if f != Text {
+						src = g[f]
+						break
+					}
+				}
+			}
+			if src == nil {
+				src = g[Text]
+			}
+			if strings.TrimSpace(src.Data) == "" {
+				continue
+			}
+			htmlDoc = withFormat(src, HTML, ToHTML(src.Format, src.Data))
+			docs = append(docs, htmlDoc)
+		}
+		if g[Text] == nil {
+			if text := PlainText(htmlDoc.Data); text != "" {
+				docs = append(docs, withFormat(htmlDoc, Text, text))
+			}
+		}
+	}
+	return docs
+}
+
+// withFormat returns a copy of d with the given format and data.
+func withFormat(d *graph.Doc, format, data string) *graph.Doc {
+	d2 := *d
+	d2.Format = format
+	d2.Data = data
+	return &d2
+}
@@ -0,0 +1,102 @@
+package docs
+
+import (
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := map[string]string{
+		`<p>Hello, <b>world</b>!</p>`:                       `<p>Hello, <b>world</b>!</p>`,
+		`<script>alert(1)</script>x`:                        `x`,
+		`<a href="javascript:alert(1)" onclick="x()">y</a>`: `<a>y</a>`,
+		`<a href="http://example.com/?a=1&amp;b=2">y</a>`:   `<a href="http://example.com/?a=1&amp;b=2">y</a>`,
+		`<img src=x onerror=alert(1)>z`:                     `z`,
+		`<p>unclosed <em>tags`:                              `<p>unclosed <em>tags</em></p>`,
+		`a < b && c > d`:                                    `a &lt; b &amp;&amp; c &gt; d`,
+		`<div><!-- comment -->x</span></div>`:               `<div>x</div>`,
+		`<a href="  JaVaScRiPt:x">y</a><br/>`:               `<a>y</a><br>`,
+		`<style>p { color: red }</style><p style="x">p</p>`: `<p>p</p>`,
+	}
+	for input, want := range tests {
+		if got := Sanitize(input); got != want {
+			t.Errorf("Sanitize(%q): got %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	tests := map[string]string{
+		"<p>Hello,\n  <b>world</b>!</p><p>Bye &amp; thanks.</p>": "Hello, world!\n\nBye & thanks.",
+		"<ul><li>a</li><li>b</li></ul>after":                     "a\nb\n\nafter",
+		"<p>code:</p><pre>  x := 1\n  y := 2\n</pre>":            "code:\n\n  x := 1\n  y := 2",
+	}
+	for input, want := range tests {
+		if got := PlainText(input); got != want {
+			t.Errorf("PlainText(%q): got %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestToHTML(t *testing.T) {
+	tests := []struct {
+		format, data, want string
+	}{
+		{Text, "Foo does <x>.\n\n\tfoo()\n", "<p>Foo does &lt;x&gt;.</p>\n<pre>foo()</pre>\n"},
+		{"", "plain", "<p>plain</p>\n"},
+		{"application/x-unknown", "a & b", "<p>a &amp; b</p>\n"},
+		{
+			Markdown,
+			"# Title\n\nSome *em*, **strong**, `code`, and [a link](http://x.com).\n\n- one\n- two\n\n```\nx < y\n```\n\n<script>bad()</script>",
+			"<h1>Title</h1>\n<p>Some <em>em</em>, <strong>strong</strong>, <code>code</code>, and <a href=\"http://x.com\">a link</a>.</p>\n<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n<pre><code>x &lt; y</code></pre>\n<p>&lt;script&gt;bad()&lt;/script&gt;</p>\n",
+		},
+		{Markdown, "- a\n- b\n1. c\n2. d\n- e", "<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n<ol>\n<li>c</li>\n<li>d</li>\n</ol>\n<ul>\n<li>e</li>\n</ul>\n"},
+		{"text/markdown", "snake_case_name and [x](javascript:alert(1))", "<p>snake_case_name and <a>x</a></p>\n"},
+		{
+			RST,
+			"Summary line.\n\n    Use ``foo()`` and :func:`~pkg.bar`, see `docs <http://x.com>`_.\n\n    :param x: the x\n    :returns: nothing\n\n    Example::\n\n        foo(1)\n",
+			"<p>Summary line.</p>\n<p>Use <code>foo()</code> and <code>bar</code>, see <a href=\"http://x.com\">docs</a>.</p>\n<dl>\n<dt>param x</dt>\n<dd>the x</dd>\n<dt>returns</dt>\n<dd>nothing</dd>\n</dl>\n<p>Example:</p>\n<pre><code>foo(1)</code></pre>\n",
+		},
+		{
+			HTML,
+			"Returns the {@code Foo} for {@link Bar#baz}.\n@param x the x\n@return the foo\n@throws IOException if it fails",
+			"Returns the <code>Foo</code> for <code>Bar.baz</code>.\n<dl>\n<dt>Parameters:</dt>\n<dd><code>x</code> - the x</dd>\n<dt>Returns:</dt>\n<dd>the foo</dd>\n<dt>Throws:</dt>\n<dd><code>IOException</code> - if it fails</dd>\n</dl>",
+		},
+	}
+	for _, test := range tests {
+		if got := ToHTML(test.format, test.data); got != test.want {
+			t.Errorf("ToHTML(%q, %q):\ngot  %q\nwant %q", test.format, test.data, got, test.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	foo := graph.DefKey{Path: "foo"}
+	bar := graph.DefKey{Path: "bar"}
+	docs := Normalize([]*graph.Doc{
+		{DefKey: foo, Format: Markdown, Data: "*Foo* docs"},
+		{DefKey: bar, Format: HTML, Data: "<p onclick=x>Bar</p>"},
+		{DefKey: bar, Format: Text, Data: "Bar (plain)"},
+	})
+
+	got := map[string]string{}
+	for _, d := range docs {
+		got[d.Path+" "+d.Format] = d.Data
+	}
+	want := map[string]string{
+		"foo " + Markdown: "*Foo* docs",
+		"foo " + HTML:     "<p><em>Foo</em> docs</p>\n",
+		"foo " + Text:     "Foo docs",
+		"bar " + HTML:     "<p>Bar</p>",
+		"bar " + Text:     "Bar (plain)",
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d docs %v, want %d", len(got), got, len(want))
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s: got %q, want %q", k, got[k], v)
+		}
+	}
+}
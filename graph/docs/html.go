@@ -0,0 +1,409 @@
+package docs
+
+import (
+	"html"
+	"strings"
+)
+
+// tokenType is the type of an HTML token.
+type tokenType int
+
+const (
+	textToken tokenType = iota
+	startTagToken
+	endTagToken
+)
+
+// A token is an HTML text run or tag. For text tokens, data is the
+// raw (still escaped) text; for tags, it is the lowercased tag name.
+type token struct {
+	typ         tokenType
+	data        string
+	attrs       []attr
+	selfClosing bool
+}
+
+type attr struct {
+	name, val string // val is unescaped
+}
+
+// rawTextTags are elements whose content is not parsed as HTML.
+var rawTextTags = map[string]bool{"script": true, "style": true, "textarea": true, "title": true, "xmp": true}
+
+// tokenize splits s into HTML tokens. It is deliberately lenient:
+// anything that doesn't look like a tag (such as "a < b") is treated
+// as text, and comments, doctypes, and processing instructions are
+// omitted.
+func tokenize(s string) []token {
+	var toks []token
+	text := func(t string) {
+		if t == "" {
+			return
+		}
+		if n := len(toks); n > 0 && toks[n-1].typ == textToken {
+			toks[n-1].data += t
+			return
+		}
+		toks = append(toks, token{typ: textToken, data: t})
+	}
+
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '<')
+		if i == -1 {
+			text(s)
+			break
+		}
+		text(s[:i])
+		s = s[i:]
+
+		if strings.HasPrefix(s, "<!--") {
+			end := strings.Index(s[4:], "-->")
+			if end == -1 {
+				break
+			}
+			s = s[4+end+3:]
+			continue
+		}
+		if strings.HasPrefix(s, "<!") || strings.HasPrefix(s, "<?") {
+			end := strings.IndexByte(s, '>')
+			if end == -1 {
+				break
+			}
+			s = s[end+1:]
+			continue
+		}
+
+		tok, n := parseTag(s)
+		if n == 0 {
+			text("<")
+			s = s[1:]
+			continue
+		}
+		toks = append(toks, tok)
+		s = s[n:]
+
+		if tok.typ == startTagToken && !tok.selfClosing && rawTextTags[tok.data] {
+			end := indexFold(s, "</"+tok.data)
+			if end == -1 {
+				text(s)
+				break
+			}
+			text(s[:end])
+			s = s[end:]
+		}
+	}
+	return toks
+}
+
+// parseTag parses the tag at the beginning of s (which begins with
+// '<'), returning the tag and its length, or a zero length if s
+// doesn't begin with a tag.
+func parseTag(s string) (token, int) {
+	var tok token
+	i := 1
+	tok.typ = startTagToken
+	if i < len(s) && s[i] == '/' {
+		tok.typ = endTagToken
+		i++
+	}
+	start := i
+	for i < len(s) && isTagNameChar(s[i]) {
+		i++
+	}
+	if i == start || !isLetter(s[start]) {
+		return token{}, 0
+	}
+	tok.data = strings.ToLower(s[start:i])
+
+	for i < len(s) {
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+		if i >= len(s) {
+			return token{}, 0
+		}
+		switch {
+		case s[i] == '>':
+			return tok, i + 1
+		case strings.HasPrefix(s[i:], "/>"):
+			tok.selfClosing = true
+			return tok, i + 2
+		case s[i] == '/':
+			i++
+			continue
+		}
+
+		nameStart := i
+		for i < len(s) && !isSpace(s[i]) && s[i] != '=' && s[i] != '>' && s[i] != '/' {
+			i++
+		}
+		a := attr{name: strings.ToLower(s[nameStart:i])}
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+		if i < len(s) && s[i] == '=' {
+			i++
+			for i < len(s) && isSpace(s[i]) {
+				i++
+			}
+			if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+				q := s[i]
+				end := strings.IndexByte(s[i+1:], q)
+				if end == -1 {
+					return token{}, 0
+				}
+				a.val = s[i+1 : i+1+end]
+				i += end + 2
+			} else {
+				valStart := i
+				for i < len(s) && !isSpace(s[i]) && s[i] != '>' {
+					i++
+				}
+				a.val = s[valStart:i]
+			}
+			a.val = html.UnescapeString(a.val)
+		}
+		if a.name != "" {
+			tok.attrs = append(tok.attrs, a)
+		}
+	}
+	return token{}, 0
+}
+
+func isLetter(c byte) bool      { return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') }
+func isTagNameChar(c byte) bool { return isLetter(c) || ('0' <= c && c <= '9') }
+func isSpace(c byte) bool       { return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' }
+
+// indexFold is like strings.Index but ASCII case-insensitive.
+func indexFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// allowedTags maps the tags that Sanitize keeps to the attributes
+// that are kept on them.
+var allowedTags = map[string][]string{
+	"a": {"href", "title"}, "abbr": {"title"}, "b": nil, "blockquote": nil,
+	"br": nil, "code": nil, "dd": nil, "del": nil, "dfn": nil, "div": nil,
+	"dl": nil, "dt": nil, "em": nil, "h1": nil, "h2": nil, "h3": nil,
+	"h4": nil, "h5": nil, "h6": nil, "hr": nil, "i": nil, "kbd": nil,
+	"li": nil, "ol": nil, "p": nil, "pre": nil, "samp": nil, "span": nil,
+	"strong": nil, "sub": nil, "sup": nil, "table": nil, "tbody": nil,
+	"td": nil, "th": nil, "thead": nil, "tr": nil, "tt": nil, "u": nil,
+	"ul": nil, "var": nil,
+}
+
+// voidTags are tags that have no end tag.
+var voidTags = map[string]bool{"br": true, "hr": true}
+
+// droppedTags are tags whose content is removed along with them.
+var droppedTags = map[string]bool{
+	"script": true, "style": true, "textarea": true, "title": true, "xmp": true,
+	"iframe": true, "object": true, "embed": true, "noscript": true, "head": true,
+}
+
+// Sanitize returns s with all HTML tags and attributes removed
+// except for a small set of safe formatting tags (see allowedTags).
+// Links are only kept if they use the http, https, or mailto schemes
+// (or are relative). The result is well-formed: text is escaped, and
+// all kept elements are closed.
+func Sanitize(s string) string {
+	var buf []byte
+	var open []string // stack of open elements
+	dropping := ""    // name of the dropped element whose content is being skipped
+	depth := 0        // nesting depth of dropping
+
+	for _, tok := range tokenize(s) {
+		if dropping != "" {
+			if tok.data == dropping {
+				switch tok.typ {
+				case startTagToken:
+					if !tok.selfClosing {
+						depth++
+					}
+				case endTagToken:
+					depth--
+				}
+				if depth == 0 {
+					dropping = ""
+				}
+			}
+			continue
+		}
+
+		switch tok.typ {
+		case textToken:
+			buf = append(buf, html.EscapeString(html.UnescapeString(tok.data))...)
+
+		case startTagToken:
+			if droppedTags[tok.data] {
+				if !tok.selfClosing {
+					dropping, depth = tok.data, 1
+				}
+				continue
+			}
+			attrs, ok := allowedTags[tok.data]
+			if !ok {
+				continue
+			}
+			buf = append(buf, '<')
+			buf = append(buf, tok.data...)
+			for _, a := range tok.attrs {
+				if !contains(attrs, a.name) || (a.name == "href" && !isSafeURL(a.val)) {
+					continue
+				}
+				buf = append(buf, ' ')
+				buf = append(buf, a.name...)
+				buf = append(buf, `="`...)
+				buf = append(buf, html.EscapeString(a.val)...)
+				buf = append(buf, '"')
+			}
+			buf = append(buf, '>')
+			if !voidTags[tok.data] && !tok.selfClosing {
+				open = append(open, tok.data)
+			}
+
+		case endTagToken:
+			// Close the element (and any unclosed elements inside it)
+			// if it is open; otherwise ignore the end tag.
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == tok.data {
+					for j := len(open) - 1; j >= i; j-- {
+						buf = append(buf, "</"+open[j]+">"...)
+					}
+					open = open[:i]
+					break
+				}
+			}
+		}
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		buf = append(buf, "</"+open[i]+">"...)
+	}
+	return string(buf)
+}
+
+func contains(ss []string, s string) bool {
+	for _, t := range ss {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
+
+// isSafeURL reports whether u is a relative URL or uses a scheme
+// that is safe to link to.
+func isSafeURL(u string) bool {
+	u = strings.TrimSpace(u)
+	colon := strings.IndexByte(u, ':')
+	if colon == -1 || strings.ContainsAny(u[:colon], "/?#") {
+		return true // relative
+	}
+	switch strings.ToLower(u[:colon]) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+// blockTags are tags after which PlainText inserts a paragraph break
+// (or, for those mapped to false, a line break).
+var blockTags = map[string]bool{
+	"p": true, "pre": true, "blockquote": true, "ul": true, "ol": true, "dl": true,
+	"table": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true,
+	"h6": true, "hr": true, "div": true,
+	"br": false, "li": false, "dt": false, "dd": false, "tr": false,
+}
+
+// PlainText returns the text content of the HTML document s, with
+// tags removed and entities unescaped. Paragraphs are separated by
+// blank lines. Whitespace is collapsed except in <pre> elements.
+func PlainText(s string) string {
+	var out, cur []byte
+	brk := "" // break to write before the next block
+	pre := 0  // depth of <pre> elements
+	flush := func() {
+		text := string(cur)
+		if pre == 0 {
+			text = strings.TrimSpace(text)
+		} else {
+			text = strings.TrimRight(strings.TrimLeft(text, "\n"), " \t\n")
+		}
+		cur = cur[:0]
+		if text == "" {
+			return
+		}
+		if len(out) > 0 {
+			if brk == "" {
+				brk = "\n"
+			}
+			out = append(out, brk...)
+		}
+		out = append(out, text...)
+		brk = ""
+	}
+
+	dropping := ""
+	for _, tok := range tokenize(s) {
+		if dropping != "" {
+			if tok.typ == endTagToken && tok.data == dropping {
+				dropping = ""
+			}
+			continue
+		}
+		if tok.typ == textToken {
+			t := html.UnescapeString(tok.data)
+			if pre == 0 {
+				t = collapseSpace(t, len(cur) == 0 || cur[len(cur)-1] == ' ')
+			}
+			cur = append(cur, t...)
+			continue
+		}
+
+		if tok.typ == startTagToken && !tok.selfClosing && droppedTags[tok.data] {
+			dropping = tok.data
+			continue
+		}
+		if para, isBlock := blockTags[tok.data]; isBlock {
+			flush()
+			if para {
+				brk = "\n\n"
+			} else if brk == "" {
+				brk = "\n"
+			}
+		}
+		if tok.data == "pre" {
+			if tok.typ == startTagToken {
+				pre++
+			} else if pre > 0 {
+				pre--
+			}
+		}
+	}
+	flush()
+	return string(out)
+}
+
+// collapseSpace replaces runs of whitespace in s with a single space.
+// If trimLeft, leading whitespace is removed.
+func collapseSpace(s string, trimLeft bool) string {
+	var buf []byte
+	space := trimLeft
+	for i := 0; i < len(s); i++ {
+		if isSpace(s[i]) {
+			if !space {
+				buf = append(buf, ' ')
+			}
+			space = true
+			continue
+		}
+		buf = append(buf, s[i])
+		space = false
+	}
+	return string(buf)
+}
@@ -0,0 +1,114 @@
+package docs
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	javadocInlineTag = regexp.MustCompile(`\{@(\w+)(?:\s+([^{}]*))?\}`)
+	javadocBlockTag  = regexp.MustCompile(`(?m)^[ \t]*\*?[ \t]*@(param|return|returns|throws|exception|see|since|deprecated|author|version|serial|serialData|serialField)\b[ \t]*`)
+)
+
+// javadocBlockTagLabels are the headings under which javadocToHTML
+// lists block tags, in order.
+var javadocBlockTagLabels = []struct{ tag, label string }{
+	{"deprecated", "Deprecated"},
+	{"param", "Parameters"},
+	{"return", "Returns"},
+	{"throws", "Throws"},
+	{"since", "Since"},
+	{"author", "Author"},
+	{"version", "Version"},
+	{"see", "See also"},
+}
+
+// isJavadoc reports whether the HTML document s contains Javadoc
+// inline or block tags.
+func isJavadoc(s string) bool {
+	return javadocInlineTag.MatchString(s) || javadocBlockTag.MatchString(s)
+}
+
+// javadocToHTML converts the Javadoc tags in the HTML document s to
+// HTML. Inline tags such as {@code x} and {@link Foo#bar} are
+// rendered as code, and block tags such as @param and @return are
+// listed at the end in a definition list.
+func javadocToHTML(s string) string {
+	s = javadocInlineTag.ReplaceAllStringFunc(s, func(tag string) string {
+		m := javadocInlineTag.FindStringSubmatch(tag)
+		name, arg := m[1], strings.TrimSpace(m[2])
+		switch name {
+		case "code", "value":
+			return "<code>" + html.EscapeString(arg) + "</code>"
+		case "literal":
+			return html.EscapeString(arg)
+		case "link", "linkplain":
+			ref, label := arg, ""
+			if sp := strings.IndexAny(arg, " \t\n"); sp != -1 {
+				ref, label = arg[:sp], strings.TrimSpace(arg[sp:])
+			}
+			if label == "" {
+				label = strings.TrimPrefix(strings.Replace(ref, "#", ".", 1), ".")
+			}
+			if name == "linkplain" {
+				return html.EscapeString(label)
+			}
+			return "<code>" + html.EscapeString(label) + "</code>"
+		case "inheritDoc", "docRoot":
+			return ""
+		}
+		return html.EscapeString(arg)
+	})
+
+	locs := javadocBlockTag.FindAllStringSubmatchIndex(s, -1)
+	if len(locs) == 0 {
+		return s
+	}
+	tags := map[string][]string{}
+	for i, loc := range locs {
+		end := len(s)
+		if i+1 < len(locs) {
+			end = locs[i+1][0]
+		}
+		tag := s[loc[2]:loc[3]]
+		switch tag {
+		case "returns":
+			tag = "return"
+		case "exception":
+			tag = "throws"
+		}
+		tags[tag] = append(tags[tag], strings.TrimSpace(s[loc[1]:end]))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(strings.TrimSpace(s[:locs[0][0]]))
+	buf.WriteString("\n<dl>\n")
+	for _, l := range javadocBlockTagLabels {
+		vals := tags[l.tag]
+		if len(vals) == 0 {
+			continue
+		}
+		buf.WriteString("<dt>" + l.label + ":</dt>\n")
+		for _, v := range vals {
+			buf.WriteString("<dd>")
+			if l.tag == "param" || l.tag == "throws" {
+				// The first word is the parameter or exception name.
+				name, desc := v, ""
+				if sp := strings.IndexAny(v, " \t\n"); sp != -1 {
+					name, desc = v[:sp], strings.TrimSpace(v[sp:])
+				}
+				buf.WriteString("<code>" + html.EscapeString(name) + "</code>")
+				if desc != "" {
+					buf.WriteString(" - " + desc)
+				}
+			} else {
+				buf.WriteString(v)
+			}
+			buf.WriteString("</dd>\n")
+		}
+	}
+	buf.WriteString("</dl>")
+	return buf.String()
+}
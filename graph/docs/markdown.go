@@ -0,0 +1,345 @@
+package docs
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	mdATXHeading   = regexp.MustCompile(`^(#{1,6})[ \t]+(.*?)[ \t#]*$`)
+	mdSetextLine   = regexp.MustCompile(`^(=+|-+)[ \t]*$`)
+	mdFence        = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+	mdListItem     = regexp.MustCompile(`^ {0,3}([-*+]|\d+[.)])[ \t]+(.*)$`)
+	mdOrderedMark  = regexp.MustCompile(`^\d`)
+	mdBlockquote   = regexp.MustCompile(`^ {0,3}> ?(.*)$`)
+	mdIndentedCode = regexp.MustCompile(`^(    |\t)(.*)$`)
+)
+
+// markdownToHTML converts a Markdown document to HTML. It supports
+// the commonly used subset of Markdown: paragraphs, ATX and Setext
+// headings, fenced and indented code blocks, block quotes, (flat)
+// lists, horizontal rules, and code spans, emphasis, links, and
+// autolinks. Raw HTML is escaped, not passed through.
+func markdownToHTML(s string) string {
+	var buf bytes.Buffer
+	writeMarkdownBlocks(&buf, splitLines(s))
+	return buf.String()
+}
+
+func writeMarkdownBlocks(buf *bytes.Buffer, lines []string) {
+	var para []string
+	flushPara := func() {
+		if len(para) > 0 {
+			buf.WriteString("<p>")
+			buf.WriteString(markdownInline(strings.Join(para, "\n")))
+			buf.WriteString("</p>\n")
+			para = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if strings.TrimSpace(line) == "" {
+			flushPara()
+			continue
+		}
+
+		if m := mdFence.FindStringSubmatch(line); m != nil {
+			flushPara()
+			fence := m[1]
+			var code []string
+			for i++; i < len(lines); i++ {
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+					break
+				}
+				code = append(code, lines[i])
+			}
+			writeCodeBlock(buf, code)
+			continue
+		}
+
+		if len(para) > 0 && mdSetextLine.MatchString(line) {
+			level := "1"
+			if line[0] == '-' {
+				level = "2"
+			}
+			buf.WriteString("<h" + level + ">" + markdownInline(strings.Join(para, " ")) + "</h" + level + ">\n")
+			para = nil
+			continue
+		}
+
+		if isMarkdownRule(line) {
+			flushPara()
+			buf.WriteString("<hr>\n")
+			continue
+		}
+
+		if m := mdATXHeading.FindStringSubmatch(line); m != nil {
+			flushPara()
+			level := strconv.Itoa(len(m[1]))
+			buf.WriteString("<h" + level + ">" + markdownInline(m[2]) + "</h" + level + ">\n")
+			continue
+		}
+
+		if len(para) == 0 && mdIndentedCode.MatchString(line) {
+			var code []string
+			for ; i < len(lines); i++ {
+				if m := mdIndentedCode.FindStringSubmatch(lines[i]); m != nil {
+					code = append(code, m[2])
+				} else if strings.TrimSpace(lines[i]) == "" {
+					code = append(code, "")
+				} else {
+					break
+				}
+			}
+			i--
+			writeCodeBlock(buf, code)
+			continue
+		}
+
+		if mdBlockquote.MatchString(line) {
+			flushPara()
+			var quoted []string
+			for ; i < len(lines); i++ {
+				m := mdBlockquote.FindStringSubmatch(lines[i])
+				if m == nil {
+					break
+				}
+				quoted = append(quoted, m[1])
+			}
+			i--
+			buf.WriteString("<blockquote>\n")
+			writeMarkdownBlocks(buf, quoted)
+			buf.WriteString("</blockquote>\n")
+			continue
+		}
+
+		if m := mdListItem.FindStringSubmatch(line); m != nil {
+			flushPara()
+			tag := listTag(m[1])
+			buf.WriteString("<" + tag + ">\n")
+			item := []string{m[2]}
+			blank := false // whether the previous line was blank
+			for i++; i < len(lines); i++ {
+				l := lines[i]
+				if m := mdListItem.FindStringSubmatch(l); m != nil {
+					if listTag(m[1]) != tag {
+						break // a different marker type starts a new list
+					}
+					writeListItem(buf, item)
+					item = []string{m[2]}
+				} else if strings.TrimSpace(l) == "" {
+					blank = true
+					continue
+				} else if isSpace(l[0]) || (!blank && !isBlockStart(l)) {
+					item = append(item, strings.TrimSpace(l))
+				} else {
+					break
+				}
+				blank = false
+			}
+			i--
+			writeListItem(buf, item)
+			buf.WriteString("</" + tag + ">\n")
+			continue
+		}
+
+		para = append(para, strings.TrimSpace(line))
+	}
+	flushPara()
+}
+
+// listTag returns the HTML list element ("ol" or "ul") for a list
+// item marker, such as "1." or "-".
+func listTag(mark string) string {
+	if mdOrderedMark.MatchString(mark) {
+		return "ol"
+	}
+	return "ul"
+}
+
+// isMarkdownRule reports whether line is a horizontal rule, such as
+// "---" or "* * *".
+func isMarkdownRule(line string) bool {
+	if strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t") {
+		return false
+	}
+	line = strings.Replace(strings.Replace(line, " ", "", -1), "\t", "", -1)
+	if len(line) < 3 || strings.IndexByte("-*_", line[0]) == -1 {
+		return false
+	}
+	return strings.Count(line, line[:1]) == len(line)
+}
+
+// isBlockStart reports whether line begins a Markdown block other
+// than a paragraph (and so doesn't continue a list item).
+func isBlockStart(line string) bool {
+	return mdATXHeading.MatchString(line) || isMarkdownRule(line) || mdFence.MatchString(line) || mdBlockquote.MatchString(line)
+}
+
+func writeListItem(buf *bytes.Buffer, item []string) {
+	buf.WriteString("<li>")
+	buf.WriteString(markdownInline(strings.Join(item, "\n")))
+	buf.WriteString("</li>\n")
+}
+
+func writeCodeBlock(buf *bytes.Buffer, lines []string) {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	buf.WriteString("<pre><code>")
+	buf.WriteString(html.EscapeString(strings.Join(lines, "\n")))
+	buf.WriteString("</code></pre>\n")
+}
+
+// markdownInline converts Markdown inline markup in s to HTML.
+func markdownInline(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_{}[]()#+-.!<>", s[i+1]) != -1:
+			buf.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			continue
+
+		case c == '`':
+			n := 0
+			for i+n < len(s) && s[i+n] == '`' {
+				n++
+			}
+			delim := s[i : i+n]
+			if end := strings.Index(s[i+n:], delim); end != -1 {
+				code := strings.TrimSpace(s[i+n : i+n+end])
+				buf.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i += n + end + n
+				continue
+			}
+			buf.WriteString(delim)
+			i += n
+			continue
+
+		case c == '[':
+			if text, url, n := markdownLink(s[i:]); n > 0 {
+				buf.WriteString(`<a href="` + html.EscapeString(url) + `">` + markdownInline(text) + "</a>")
+				i += n
+				continue
+			}
+
+		case c == '<':
+			if end := strings.IndexByte(s[i:], '>'); end != -1 {
+				url := s[i+1 : i+end]
+				if (strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")) && !strings.ContainsAny(url, " <") {
+					buf.WriteString(`<a href="` + html.EscapeString(url) + `">` + html.EscapeString(url) + "</a>")
+					i += end + 1
+					continue
+				}
+			}
+
+		case c == '*' || c == '_':
+			if text, n := delimited(s[i:], string([]byte{c, c})); n > 0 {
+				buf.WriteString("<strong>" + markdownInline(text) + "</strong>")
+				i += n
+				continue
+			}
+			// Don't treat intraword underscores (as in snake_case
+			// names) as emphasis.
+			if c == '_' && i > 0 && isWordChar(s[i-1]) {
+				break
+			}
+			if text, n := delimited(s[i:], string(c)); n > 0 && (c == '*' || n == len(s[i:]) || !isWordChar(s[i+n])) {
+				buf.WriteString("<em>" + markdownInline(text) + "</em>")
+				i += n
+				continue
+			}
+		}
+		buf.WriteString(html.EscapeString(s[i : i+1]))
+		i++
+	}
+	return buf.String()
+}
+
+// markdownLink parses a link of the form "[text](url)" at the
+// beginning of s, returning the link text and URL and the length of
+// the link, or a zero length if s doesn't begin with a link.
+func markdownLink(s string) (text, url string, n int) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				if i+1 >= len(s) || s[i+1] != '(' {
+					return "", "", 0
+				}
+				end := closingParen(s[i+2:])
+				if end == -1 {
+					return "", "", 0
+				}
+				url = strings.TrimSpace(s[i+2 : i+2+end])
+				if sp := strings.IndexAny(url, " \t"); sp != -1 {
+					url = url[:sp] // drop the title
+				}
+				return s[1:i], url, i + 2 + end + 1
+			}
+		}
+	}
+	return "", "", 0
+}
+
+// closingParen returns the index of the ')' that closes an already
+// opened '(' in s, or -1 if there is none.
+func closingParen(s string) int {
+	depth := 1
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// delimited parses text enclosed in delim at the beginning of s
+// (such as "*em*"), returning the text and the total length, or a
+// zero length if s doesn't begin with such text. The text must not
+// begin or end with whitespace.
+func delimited(s, delim string) (text string, n int) {
+	if !strings.HasPrefix(s, delim) || len(s) <= len(delim) || isSpace(s[len(delim)]) {
+		return "", 0
+	}
+	rest := s[len(delim):]
+	for off := 0; ; {
+		end := strings.Index(rest[off:], delim)
+		if end == -1 {
+			return "", 0
+		}
+		end += off
+		if end > 0 && !isSpace(rest[end-1]) && (len(delim) > 1 || !strings.HasPrefix(rest[end:], delim+delim)) {
+			return rest[:end], len(delim) + end + len(delim)
+		}
+		off = end + len(delim)
+	}
+}
+
+func isWordChar(c byte) bool { return isTagNameChar(c) || c == '_' }
+
+// splitLines splits s into lines, removing trailing carriage returns.
+func splitLines(s string) []string {
+	lines := strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n")
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,348 @@
+package docs
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	rstListItem  = regexp.MustCompile(`^([-*+\x{2022}]|\d+[.)]|#\.)[ \t]+(.*)$`)
+	rstField     = regexp.MustCompile("^:([^:`]+):(?:[ \t]+(.*))?$")
+	rstDirective = regexp.MustCompile(`^\.\.[ \t]+([\w-]+)::[ \t]*(.*)$`)
+	rstRole      = regexp.MustCompile(`^(?::[\w-]+)+:$`)
+)
+
+// rstToHTML converts a reStructuredText document to HTML. It supports
+// the constructs commonly used in docstrings: paragraphs, section
+// titles, literal blocks ("::"), doctest blocks, bullet and
+// enumerated lists, field lists (such as ":param x: ..."), admonition
+// and code directives, and inline literals, emphasis, roles, and
+// hyperlinks. Comments and other directives are omitted.
+func rstToHTML(s string) string {
+	r := rstWriter{levels: map[string]int{}}
+	r.blocks(splitLines(dedent(s)))
+	return r.buf.String()
+}
+
+type rstWriter struct {
+	buf    bytes.Buffer
+	levels map[string]int // section title adornment -> heading level
+}
+
+func (r *rstWriter) blocks(lines []string) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		if strings.TrimSpace(line) == "" {
+			i++
+			continue
+		}
+
+		// Section titles, with an optional overline.
+		if isAdornment(line) && i+2 < len(lines) && lines[i+2] == line && strings.TrimSpace(lines[i+1]) != "" {
+			r.heading("o"+line[:1], strings.TrimSpace(lines[i+1]))
+			i += 3
+			continue
+		}
+		if i+1 < len(lines) && isAdornment(lines[i+1]) && !isSpace(line[0]) && len(strings.TrimSpace(lines[i+1])) >= len(strings.TrimSpace(line)) {
+			r.heading(lines[i+1][:1], strings.TrimSpace(line))
+			i += 2
+			continue
+		}
+
+		if m := rstDirective.FindStringSubmatch(line); m != nil {
+			body, n := indentedBlock(lines[i+1:])
+			r.directive(m[1], m[2], body)
+			i += 1 + n
+			continue
+		}
+		if strings.HasPrefix(line, "..") {
+			// Comment, hyperlink target, or substitution definition.
+			_, n := indentedBlock(lines[i+1:])
+			i += 1 + n
+			continue
+		}
+
+		if strings.HasPrefix(line, ">>>") {
+			var block []string
+			for ; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+				block = append(block, lines[i])
+			}
+			writeCodeBlock(&r.buf, block)
+			continue
+		}
+
+		if rstField.MatchString(line) {
+			r.buf.WriteString("<dl>\n")
+			for i < len(lines) {
+				m := rstField.FindStringSubmatch(lines[i])
+				if m == nil {
+					break
+				}
+				body, n := indentedBlock(lines[i+1:])
+				r.buf.WriteString("<dt>" + rstInline(m[1]) + "</dt>\n<dd>")
+				r.buf.WriteString(rstInline(strings.TrimSpace(m[2] + " " + strings.Join(trimAll(body), " "))))
+				r.buf.WriteString("</dd>\n")
+				i += 1 + n
+				for i < len(lines) && strings.TrimSpace(lines[i]) == "" && i+1 < len(lines) && rstField.MatchString(lines[i+1]) {
+					i++
+				}
+			}
+			r.buf.WriteString("</dl>\n")
+			continue
+		}
+
+		if m := rstListItem.FindStringSubmatch(line); m != nil {
+			tag := "ul"
+			if m[1][0] == '#' || ('0' <= m[1][0] && m[1][0] <= '9') {
+				tag = "ol"
+			}
+			r.buf.WriteString("<" + tag + ">\n")
+			for i < len(lines) {
+				m := rstListItem.FindStringSubmatch(lines[i])
+				if m == nil {
+					break
+				}
+				body, n := indentedBlock(lines[i+1:])
+				r.buf.WriteString("<li>" + rstInline(strings.TrimSpace(m[2]+" "+strings.Join(trimAll(body), " "))) + "</li>\n")
+				i += 1 + n
+				for i < len(lines) && strings.TrimSpace(lines[i]) == "" && i+1 < len(lines) && rstListItem.MatchString(lines[i+1]) {
+					i++
+				}
+			}
+			r.buf.WriteString("</" + tag + ">\n")
+			continue
+		}
+
+		if isSpace(line[0]) {
+			// A block quote.
+			body, n := indentedBlock(lines[i:])
+			r.buf.WriteString("<blockquote>\n")
+			r.blocks(body)
+			r.buf.WriteString("</blockquote>\n")
+			i += n
+			continue
+		}
+
+		// A paragraph. If it ends with "::", the following indented
+		// block is a literal block.
+		var para []string
+		for ; i < len(lines) && strings.TrimSpace(lines[i]) != "" && !isSpace(lines[i][0]); i++ {
+			para = append(para, strings.TrimSpace(lines[i]))
+		}
+		text := strings.Join(para, "\n")
+		literal := strings.HasSuffix(text, "::")
+		if literal {
+			text = strings.TrimSuffix(text, "::")
+			if strings.HasSuffix(text, " ") || text == "" {
+				text = strings.TrimSpace(text)
+			} else {
+				text += ":"
+			}
+		}
+		if text != "" {
+			r.buf.WriteString("<p>" + rstInline(text) + "</p>\n")
+		}
+		if literal {
+			for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+				i++
+			}
+			if body, n := indentedBlock(lines[i:]); n > 0 {
+				writeCodeBlock(&r.buf, body)
+				i += n
+			}
+		}
+	}
+}
+
+// isAdornment reports whether line is a section title underline or
+// overline, such as "=====".
+func isAdornment(line string) bool {
+	line = strings.TrimRight(line, " \t")
+	if len(line) < 2 || strings.IndexByte("=-~^\"'`#*+:.", line[0]) == -1 {
+		return false
+	}
+	return strings.Count(line, line[:1]) == len(line)
+}
+
+// heading writes a section title. Heading levels are assigned in
+// the order in which adornment styles are first seen, as in
+// reStructuredText.
+func (r *rstWriter) heading(adornment, title string) {
+	level, ok := r.levels[adornment]
+	if !ok {
+		level = len(r.levels) + 1
+		if level > 6 {
+			level = 6
+		}
+		r.levels[adornment] = level
+	}
+	h := "h" + strconv.Itoa(level)
+	r.buf.WriteString("<" + h + ">" + rstInline(title) + "</" + h + ">\n")
+}
+
+func (r *rstWriter) directive(name, arg string, body []string) {
+	switch name {
+	case "code", "code-block", "sourcecode", "highlight":
+		if name != "highlight" {
+			writeCodeBlock(&r.buf, body)
+		}
+	case "note", "warning", "tip", "important", "caution", "danger", "attention", "hint", "error", "seealso", "deprecated", "versionadded", "versionchanged":
+		label := strings.ToUpper(name[:1]) + name[1:]
+		switch name {
+		case "seealso":
+			label = "See also"
+		case "versionadded":
+			label = "New in version"
+		case "versionchanged":
+			label = "Changed in version"
+		}
+		r.buf.WriteString("<p><strong>" + html.EscapeString(label) + ":</strong>")
+		if arg != "" {
+			r.buf.WriteString(" " + rstInline(arg))
+		}
+		r.buf.WriteString("</p>\n")
+		r.blocks(body)
+	}
+}
+
+// indentedBlock returns the dedented indented block (including blank
+// lines within it) at the beginning of lines and the number of lines
+// it spans.
+func indentedBlock(lines []string) ([]string, int) {
+	n := 0
+	for n < len(lines) && (strings.TrimSpace(lines[n]) == "" || isSpace(lines[n][0])) {
+		n++
+	}
+	for n > 0 && strings.TrimSpace(lines[n-1]) == "" {
+		n--
+	}
+	return splitLines(dedent(strings.Join(lines[:n], "\n"))), n
+}
+
+// dedent removes the common leading whitespace from the lines of s,
+// ignoring blank lines and (as Python does for docstrings) the first
+// line if it is unindented.
+func dedent(s string) string {
+	lines := strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n")
+	indent := -1
+	for i, l := range lines {
+		if strings.TrimSpace(l) == "" || (i == 0 && len(lines) > 1 && !isSpace(l[0])) {
+			continue
+		}
+		n := len(l) - len(strings.TrimLeft(l, " \t"))
+		if indent == -1 || n < indent {
+			indent = n
+		}
+	}
+	if indent <= 0 {
+		return s
+	}
+	for i, l := range lines {
+		if len(l) >= indent && strings.TrimSpace(l[:indent]) == "" {
+			lines[i] = l[indent:]
+		} else {
+			lines[i] = strings.TrimLeft(l, " \t")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func trimAll(lines []string) []string {
+	trimmed := make([]string, 0, len(lines))
+	for _, l := range lines {
+		if l = strings.TrimSpace(l); l != "" {
+			trimmed = append(trimmed, l)
+		}
+	}
+	return trimmed
+}
+
+// rstInline converts reStructuredText inline markup in s to HTML.
+func rstInline(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			buf.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			continue
+
+		case strings.HasPrefix(s[i:], "``"):
+			if end := strings.Index(s[i+2:], "``"); end > 0 {
+				buf.WriteString("<code>" + html.EscapeString(s[i+2:i+2+end]) + "</code>")
+				i += 2 + end + 2
+				continue
+			}
+
+		case c == ':':
+			// A role, such as :class:`Foo` or :py:func:`bar`.
+			if end := strings.Index(s[i:], ":`"); end > 0 && rstRole.MatchString(s[i:i+end+1]) {
+				if text, n := delimited(s[i+end+1:], "`"); n > 0 {
+					buf.WriteString("<code>" + html.EscapeString(rstRefText(text)) + "</code>")
+					i += end + 1 + n
+					continue
+				}
+			}
+
+		case c == '`':
+			if text, n := delimited(s[i:], "`"); n > 0 {
+				switch {
+				case strings.HasPrefix(s[i+n:], "__"):
+					n++
+					fallthrough
+				case strings.HasPrefix(s[i+n:], "_"):
+					n++
+					if lt := strings.LastIndex(text, "<"); lt != -1 && strings.HasSuffix(text, ">") {
+						url := text[lt+1 : len(text)-1]
+						label := strings.TrimSpace(text[:lt])
+						if label == "" {
+							label = url
+						}
+						buf.WriteString(`<a href="` + html.EscapeString(url) + `">` + html.EscapeString(label) + "</a>")
+					} else {
+						buf.WriteString(html.EscapeString(text))
+					}
+				default:
+					// Interpreted text with the default role.
+					buf.WriteString("<code>" + html.EscapeString(text) + "</code>")
+				}
+				i += n
+				continue
+			}
+
+		case c == '*':
+			if text, n := delimited(s[i:], "**"); n > 0 {
+				buf.WriteString("<strong>" + html.EscapeString(text) + "</strong>")
+				i += n
+				continue
+			}
+			if text, n := delimited(s[i:], "*"); n > 0 {
+				buf.WriteString("<em>" + html.EscapeString(text) + "</em>")
+				i += n
+				continue
+			}
+		}
+		buf.WriteString(html.EscapeString(s[i : i+1]))
+		i++
+	}
+	return buf.String()
+}
+
+// rstRefText returns the text to display for the target of a role,
+// such as "Foo" for "~pkg.Foo" or "title" for "title <target>".
+func rstRefText(text string) string {
+	if lt := strings.LastIndex(text, "<"); lt > 0 && strings.HasSuffix(text, ">") {
+		return strings.TrimSpace(text[:lt])
+	}
+	if strings.HasPrefix(text, "~") {
+		text = text[1:]
+		if dot := strings.LastIndex(text, "."); dot != -1 {
+			text = text[dot+1:]
+		}
+	}
+	return text
+}
@@ -0,0 +1,69 @@
+package graph
+
+import (
+	"bytes"
+	"path"
+	"strings"
+)
+
+// generatedSuffixes are the filename suffixes of files that are
+// generated (by protoc, minifiers, etc.).
+var generatedSuffixes = []string{
+	".pb.go", ".pb.gw.go", ".pb.cc", ".pb.h", "_pb2.py", "_pb2_grpc.py", ".pb.js",
+	".min.js", ".min.css",
+}
+
+// generatedMarkers are the comments that mark a file as generated
+// (e.g., Go's "// Code generated by stringer; DO NOT EDIT.").
+var generatedMarkers = [][]byte{
+	[]byte("Code generated by"),
+	[]byte("DO NOT EDIT"),
+	[]byte("@generated"),
+	[]byte("This file was automatically generated"),
+	[]byte("Autogenerated by"),
+}
+
+// generatedHeaderSize is the number of bytes at the beginning of a
+// file that are searched for generatedMarkers.
+const generatedHeaderSize = 1024
+
+// Minified JavaScript and CSS is detected by its average line length.
+const (
+	minifiedMinSize       = 1024
+	minifiedMinLineLength = 500
+)
+
+// IsGenerated reports whether the file with the given name and
+// contents was generated by a tool (instead of written by hand). A
+// file is generated if its name has a well-known suffix of generated
+// files (e.g., ".pb.go" or ".min.js"), if its header contains a
+// generated-code marker (e.g., "Code generated by" or "DO NOT EDIT"),
+// or if it is JavaScript or CSS that looks minified (i.e., has very
+// long lines).
+func IsGenerated(filename string, data []byte) bool {
+	base := path.Base(strings.Replace(filename, "\\", "/", -1))
+	for _, suffix := range generatedSuffixes {
+		if strings.HasSuffix(base, suffix) {
+			return true
+		}
+	}
+
+	header := data
+	if len(header) > generatedHeaderSize {
+		header = header[:generatedHeaderSize]
+	}
+	for _, marker := range generatedMarkers {
+		if bytes.Contains(header, marker) {
+			return true
+		}
+	}
+
+	switch strings.ToLower(path.Ext(base)) {
+	case ".js", ".css":
+		if len(data) >= minifiedMinSize {
+			lines := bytes.Count(data, []byte("\n")) + 1
+			return len(data)/lines >= minifiedMinLineLength
+		}
+	}
+	return false
+}
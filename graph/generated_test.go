@@ -0,0 +1,29 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsGenerated(t *testing.T) {
+	tests := []struct {
+		filename string
+		data     string
+		want     bool
+	}{
+		{"foo.go", "package foo\n", false},
+		{"foo.pb.go", "package foo\n", true},
+		{"dir/foo_string.go", "// Code generated by \"stringer -type=Foo\"; DO NOT EDIT.\n\npackage foo\n", true},
+		{"foo.c", "/* @generated by bison */\nint x;\n", true},
+		{"foo_pb2.py", "x = 1\n", true},
+		{"lib/jquery.min.js", "var x;", true},
+		{"lib/app.js", strings.Repeat("var x=1;", 200), true},
+		{"lib/app.js", strings.Repeat("var x = 1;\n", 200), false},
+		{"foo.go", strings.Repeat("\n", generatedHeaderSize) + "// Code generated by foo.\n", false},
+	}
+	for _, test := range tests {
+		if got := IsGenerated(test.filename, []byte(test.data)); got != test.want {
+			t.Errorf("%s (%d bytes): got %v, want %v", test.filename, len(test.data), got, test.want)
+		}
+	}
+}
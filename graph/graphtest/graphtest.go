@@ -0,0 +1,42 @@
+// Package graphtest provides helpers for testing the output of
+// graphers.
+package graphtest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// DescribeOutput returns the sorted def paths in o and a sorted
+// description of each non-def ref in o ("TEXT -> UNIT PATH", where
+// TEXT is the text of the ref in its file). The refs' files are read
+// relative to the current directory.
+func DescribeOutput(t testing.TB, o *graph.Output) (defs, refs []string) {
+	files := map[string][]byte{}
+	for _, def := range o.Defs {
+		defs = append(defs, def.Path)
+	}
+	for _, ref := range o.Refs {
+		if ref.Def {
+			continue
+		}
+		data, present := files[ref.File]
+		if !present {
+			var err error
+			data, err = ioutil.ReadFile(filepath.FromSlash(ref.File))
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[ref.File] = data
+		}
+		refs = append(refs, fmt.Sprintf("%s -> %s %s", data[ref.Start:ref.End], ref.DefUnit, ref.DefPath))
+	}
+	sort.Strings(defs)
+	sort.Strings(refs)
+	return defs, refs
+}
@@ -0,0 +1,111 @@
+package graph
+
+// An Interner deduplicates strings, so that equal strings (such as
+// the file paths, unit names, and def paths that are repeated in
+// many defs and refs) share a single copy in memory. Its zero value
+// is ready to use. It is not safe for concurrent use.
+type Interner struct {
+	m map[string]string
+}
+
+// String returns a string equal to s, which is shared with all other
+// strings equal to s that were interned by in.
+func (in *Interner) String(s string) string {
+	if s == "" {
+		return ""
+	}
+	if in.m == nil {
+		in.m = map[string]string{}
+	}
+	if t, present := in.m[s]; present {
+		return t
+	}
+	in.m[s] = s
+	return s
+}
+
+// Len returns the number of distinct strings interned by in.
+func (in *Interner) Len() int { return len(in.m) }
+
+// Output interns the strings of the defs, refs, docs, and anns in o
+// that are commonly repeated (their keys, files, kinds, etc.).
+func (in *Interner) Output(o *Output) {
+	for _, def := range o.Defs {
+		in.Def(def)
+	}
+	for _, ref := range o.Refs {
+		in.Ref(ref)
+	}
+	for _, doc := range o.Docs {
+		in.defKey(&doc.DefKey)
+		doc.Format = in.String(doc.Format)
+		doc.File = in.String(doc.File)
+		doc.DocUnit = in.String(doc.DocUnit)
+	}
+	for _, a := range o.Anns {
+		a.Repo = in.String(a.Repo)
+		a.CommitID = in.String(a.CommitID)
+		a.UnitType = in.String(a.UnitType)
+		a.Unit = in.String(a.Unit)
+		a.File = in.String(a.File)
+		a.Type = in.String(a.Type)
+	}
+}
+
+// Def interns the commonly repeated strings of def.
+func (in *Interner) Def(def *Def) {
+	in.defKey(&def.DefKey)
+	def.Name = in.String(def.Name)
+	def.Kind = in.String(def.Kind)
+	def.RawKind = in.String(def.RawKind)
+	def.File = in.String(def.File)
+	def.TreePath = in.String(def.TreePath)
+	def.Visibility = in.String(def.Visibility)
+	if def.AliasOf != nil {
+		in.defKey(def.AliasOf)
+	}
+}
+
+// Ref interns the strings of ref.
+func (in *Interner) Ref(ref *Ref) {
+	ref.DefRepo = in.String(ref.DefRepo)
+	ref.DefUnitType = in.String(ref.DefUnitType)
+	ref.DefUnit = in.String(ref.DefUnit)
+	ref.DefPath = in.String(ref.DefPath)
+	ref.Repo = in.String(ref.Repo)
+	ref.CommitID = in.String(ref.CommitID)
+	ref.UnitType = in.String(ref.UnitType)
+	ref.Unit = in.String(ref.Unit)
+	ref.File = in.String(ref.File)
+	for _, c := range ref.Candidates {
+		c.DefRepo = in.String(c.DefRepo)
+		c.DefUnitType = in.String(c.DefUnitType)
+		c.DefUnit = in.String(c.DefUnit)
+		c.DefPath = in.String(c.DefPath)
+	}
+}
+
+func (in *Interner) defKey(k *DefKey) {
+	k.Repo = in.String(k.Repo)
+	k.CommitID = in.String(k.CommitID)
+	k.UnitType = in.String(k.UnitType)
+	k.Unit = in.String(k.Unit)
+	k.Path = in.String(k.Path)
+}
+
+// DedupRefs returns refs without the refs that are identical (in all
+// of their fields) to an earlier ref in refs. It preserves the order
+// of the remaining refs and reuses refs's underlying array.
+func DedupRefs(refs []*Ref) []*Ref {
+	seen := make(map[refIdentity]struct{}, len(refs))
+	deduped := refs[:0]
+	for _, ref := range refs {
+		id := newRefIdentity(ref)
+		if _, dup := seen[id]; dup {
+			continue
+		}
+		seen[id] = struct{}{}
+		deduped = append(deduped, ref)
+	}
+	return deduped
+}
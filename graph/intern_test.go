@@ -0,0 +1,47 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInterner(t *testing.T) {
+	var in Interner
+	a := string([]byte("foo.go"))
+	b := string([]byte("foo.go"))
+	if got := in.String(a); got != a {
+		t.Errorf("got %q, want %q", got, a)
+	}
+	if got := in.String(b); got != b {
+		t.Errorf("got %q, want %q", got, b)
+	}
+	if in.String("") != "" || in.Len() != 1 {
+		t.Errorf("got %d interned strings, want 1", in.Len())
+	}
+
+	o := &Output{
+		Defs: []*Def{{DefKey: DefKey{Unit: "u", Path: "A"}, File: "a.go"}},
+		Refs: []*Ref{{DefUnit: string([]byte("u")), DefPath: string([]byte("A")), File: string([]byte("a.go"))}},
+	}
+	in.Output(o)
+	if in.Len() != 4 {
+		t.Errorf("got %d interned strings, want 4 (foo.go, u, A, a.go)", in.Len())
+	}
+}
+
+func TestDedupRefs(t *testing.T) {
+	refs := []*Ref{
+		{DefPath: "A", File: "a.go", Start: 1, End: 2},
+		{DefPath: "B", File: "a.go", Start: 1, End: 2},
+		{DefPath: "A", File: "a.go", Start: 1, End: 2},
+		{DefPath: "A", File: "a.go", Start: 3, End: 4},
+		{DefPath: "B", File: "a.go", Start: 1, End: 2},
+	}
+	want := []*Ref{refs[0], refs[1], refs[3]}
+	if got := DedupRefs(refs); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := DedupRefs(nil); len(got) != 0 {
+		t.Errorf("got %v, want no refs", got)
+	}
+}
@@ -0,0 +1,104 @@
+package graph
+
+import "strings"
+
+// Canonical def kinds. Toolchains should set Def.Kind to one of these
+// (mapping their language-specific kinds to the closest one) and
+// record the language-specific kind in Def.RawKind, so that queries
+// such as "all classes in this unit" work consistently across
+// languages. Kinds emitted by toolchains that aren't canonical are
+// mapped by (*Def).NormalizeKind.
+const (
+	KindModule    = "module"    // package, module, namespace
+	KindClass     = "class"     // class (with fields and methods)
+	KindInterface = "interface" // interface, trait, protocol
+	KindType      = "type"      // other named type (e.g., struct)
+	KindTypeAlias = "typealias" // alternate name for another type
+	KindEnum      = "enum"      // enumeration type
+	KindFunction  = "function"  // function not bound to a type
+	KindMethod    = "method"    // function bound to a type (incl. constructors)
+	KindField     = "field"     // field or property of a type
+	KindConstant  = "constant"  // named constant or enum value
+	KindVariable  = "variable"  // variable or parameter
+	KindOther     = "other"     // anything else
+)
+
+// CanonicalKinds lists the canonical def kinds.
+var CanonicalKinds = []string{
+	KindModule,
+	KindClass,
+	KindInterface,
+	KindType,
+	KindTypeAlias,
+	KindEnum,
+	KindFunction,
+	KindMethod,
+	KindField,
+	KindConstant,
+	KindVariable,
+	KindOther,
+}
+
+// IsCanonicalKind reports whether kind is one of the canonical def
+// kinds.
+func IsCanonicalKind(kind string) bool {
+	for _, k := range CanonicalKinds {
+		if kind == k {
+			return true
+		}
+	}
+	return false
+}
+
+// rawKinds maps common language-specific kinds (lowercased) to
+// canonical kinds.
+var rawKinds = map[string]string{
+	"package":     KindModule,
+	"namespace":   KindModule,
+	"struct":      KindType,
+	"typedef":     KindType,
+	"trait":       KindInterface,
+	"protocol":    KindInterface,
+	"alias":       KindTypeAlias,
+	"func":        KindFunction,
+	"def":         KindFunction,
+	"fn":          KindFunction,
+	"ctor":        KindMethod,
+	"constructor": KindMethod,
+	"property":    KindField,
+	"attr":        KindField,
+	"member":      KindField,
+	"const":       KindConstant,
+	"var":         KindVariable,
+	"let":         KindVariable,
+	"param":       KindVariable,
+}
+
+// CanonicalKind returns the canonical def kind that corresponds to the
+// language-specific kind rawKind (e.g., "func" and "def" map to
+// KindFunction). Matching is case-insensitive. Kinds that are not
+// recognized map to KindOther.
+func CanonicalKind(rawKind string) string {
+	k := strings.ToLower(rawKind)
+	if IsCanonicalKind(k) {
+		return k
+	}
+	if kind, present := rawKinds[k]; present {
+		return kind
+	}
+	return KindOther
+}
+
+// NormalizeKind sets d.Kind to the canonical kind corresponding to it
+// (see CanonicalKind), preserving the original kind in d.RawKind if
+// RawKind is not already set. Defs with an empty Kind are left
+// unchanged.
+func (d *Def) NormalizeKind() {
+	if d.Kind == "" || IsCanonicalKind(d.Kind) {
+		return
+	}
+	if d.RawKind == "" {
+		d.RawKind = d.Kind
+	}
+	d.Kind = CanonicalKind(d.Kind)
+}
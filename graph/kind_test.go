@@ -0,0 +1,47 @@
+package graph
+
+import "testing"
+
+func TestCanonicalKind(t *testing.T) {
+	tests := map[string]string{
+		"function":  KindFunction,
+		"func":      KindFunction,
+		"def":       KindFunction,
+		"Method":    KindMethod,
+		"ctor":      KindMethod,
+		"struct":    KindType,
+		"trait":     KindInterface,
+		"PACKAGE":   KindModule,
+		"const":     KindConstant,
+		"var":       KindVariable,
+		"typealias": KindTypeAlias,
+		"gadget":    KindOther,
+		"":          KindOther,
+	}
+	for raw, want := range tests {
+		if got := CanonicalKind(raw); got != want {
+			t.Errorf("%q: got %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func TestDef_NormalizeKind(t *testing.T) {
+	tests := []struct {
+		def                   Def
+		wantKind, wantRawKind string
+	}{
+		{Def{}, "", ""},
+		{Def{Kind: "class"}, KindClass, ""},
+		{Def{Kind: "func"}, KindFunction, "func"},
+		{Def{Kind: "trait"}, KindInterface, "trait"},
+		{Def{Kind: "gadget"}, KindOther, "gadget"},
+		{Def{Kind: "func", RawKind: "func_decl"}, KindFunction, "func_decl"},
+	}
+	for _, test := range tests {
+		def := test.def
+		def.NormalizeKind()
+		if def.Kind != test.wantKind || def.RawKind != test.wantRawKind {
+			t.Errorf("%+v: got Kind %q RawKind %q, want %q and %q", test.def, def.Kind, def.RawKind, test.wantKind, test.wantRawKind)
+		}
+	}
+}
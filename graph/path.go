@@ -0,0 +1,165 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// File paths and def paths
+//
+// File paths in graph data (the File fields of defs, refs, docs, and
+// anns, and the Files of source units) are slash-separated, relative
+// to the root of the repository (or source unit directory the
+// toolchain was run in), and clean (see CleanFile). They are the raw
+// UTF-8 names of the files, exactly as the file system reports them:
+// they are never percent-encoded ("docs/café.md", not
+// "docs/caf%C3%A9.md") and never file: URIs. srclib doesn't perform
+// Unicode normalization, so toolchains must report file names in the
+// same normalization form as the file system (e.g., by using the names
+// returned by directory listings instead of reconstructing them).
+//
+// Def paths (DefKey.Path and Ref.DefPath) are opaque, slash-separated
+// sequences of components. They are valid UTF-8 (see ValidDefPath) and
+// are stored and compared byte-for-byte, without escaping; a component
+// may contain any character except "/" and NUL. Def paths must be
+// escaped (with EscapeDefPath) only when they are embedded in URLs.
+
+// CleanFile returns the clean form of the slash-separated file path
+// file (see path.Clean), without a leading "./". It returns "" if file
+// is empty.
+func CleanFile(file string) string {
+	if file == "" {
+		return ""
+	}
+	return path.Clean(file)
+}
+
+// ResolveFile returns the path of file, as reported by a toolchain
+// that was run in dir, in the form required in graph data (see the
+// comment at the top of this file). It converts file: URIs of files in
+// dir to relative paths (leaving URIs of other files as is), and it
+// decodes percent-encoded paths if the encoded path doesn't exist in
+// dir but the decoded path does (so that files whose names contain "%"
+// are left alone).
+func ResolveFile(dir, file string) string {
+	if file == "" {
+		return ""
+	}
+	if strings.HasPrefix(file, "file:") {
+		u, err := url.Parse(file)
+		if err != nil || u.Path == "" {
+			return file
+		}
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return file
+		}
+		rel, err := filepath.Rel(absDir, filepath.FromSlash(u.Path))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return file // not in dir
+		}
+		return CleanFile(filepath.ToSlash(rel))
+	}
+	file = CleanFile(file)
+	if strings.Contains(file, "%") && !fileExists(dir, file) {
+		if p, err := UnescapePath(file); err == nil && fileExists(dir, p) {
+			file = CleanFile(p)
+		}
+	}
+	return file
+}
+
+func fileExists(dir, file string) bool {
+	_, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(file)))
+	return err == nil
+}
+
+var errNULInDefPath = errors.New("def path contains a NUL byte")
+
+// ValidDefPath returns an error if p isn't a valid def path: if it
+// isn't valid UTF-8 or it contains a NUL byte.
+func ValidDefPath(p string) error {
+	if !utf8.ValidString(p) {
+		return fmt.Errorf("def path %q is not valid UTF-8", p)
+	}
+	if strings.IndexByte(p, 0) != -1 {
+		return errNULInDefPath
+	}
+	return nil
+}
+
+// EscapeDefPath percent-encodes each component of the def path p so
+// that it can be embedded in the path of a URL. The "/" separators are
+// left as is. Characters that are allowed in URL path segments
+// (letters, digits, and "-._~!$&'()*+,;=:@") are not encoded; all
+// other bytes, including those of non-ASCII characters, are.
+func EscapeDefPath(p string) string {
+	const hex = "0123456789ABCDEF"
+	var buf []byte
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if c == '/' || isPathSegmentChar(c) {
+			if buf != nil {
+				buf = append(buf, c)
+			}
+			continue
+		}
+		if buf == nil {
+			buf = append(make([]byte, 0, len(p)+16), p[:i]...)
+		}
+		buf = append(buf, '%', hex[c>>4], hex[c&0xF])
+	}
+	if buf == nil {
+		return p
+	}
+	return string(buf)
+}
+
+func isPathSegmentChar(c byte) bool {
+	if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+		return true
+	}
+	return strings.IndexByte("-._~!$&'()*+,;=:@", c) != -1
+}
+
+// UnescapePath decodes the percent-encoded bytes ("%XX") in s. Unlike
+// url.QueryUnescape, it leaves "+" as is. It is the inverse of
+// EscapeDefPath.
+func UnescapePath(s string) (string, error) {
+	if strings.IndexByte(s, '%') == -1 {
+		return s, nil
+	}
+	buf := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			buf = append(buf, s[i])
+			continue
+		}
+		if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			return "", fmt.Errorf("invalid percent-encoding in %q", s)
+		}
+		buf = append(buf, unhex(s[i+1])<<4|unhex(s[i+2]))
+		i += 2
+	}
+	return string(buf), nil
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
@@ -0,0 +1,100 @@
+package graph
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCleanFile(t *testing.T) {
+	tests := map[string]string{
+		"":            "",
+		"a.go":        "a.go",
+		"./a.go":      "a.go",
+		"a//b/../c":   "a/c",
+		"café/été.go": "café/été.go",
+	}
+	for file, want := range tests {
+		if got := CleanFile(file); got != want {
+			t.Errorf("%q: got %q, want %q", file, got, want)
+		}
+	}
+}
+
+func TestResolveFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-resolve-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"café.go", "100%.go", "a b.go"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"":               "",
+		"café.go":        "café.go",
+		"./café.go":      "café.go",
+		"caf%C3%A9.go":   "café.go",
+		"a%20b.go":       "a b.go",
+		"100%.go":        "100%.go", // exists, so not decoded (and invalid encoding)
+		"missing%20x.go": "missing%20x.go",
+		"file://" + filepath.ToSlash(absDir) + "/caf%C3%A9.go": "café.go",
+		"file:///elsewhere/x.go":                               "file:///elsewhere/x.go",
+	}
+	for file, want := range tests {
+		if got := ResolveFile(dir, file); got != want {
+			t.Errorf("%q: got %q, want %q", file, got, want)
+		}
+	}
+}
+
+func TestValidDefPath(t *testing.T) {
+	for _, p := range []string{"", "a/b", "Straße/größe", "日本/語", "a b/%20"} {
+		if err := ValidDefPath(p); err != nil {
+			t.Errorf("%q: %s", p, err)
+		}
+	}
+	for _, p := range []string{"a\xff", "a\x00b"} {
+		if err := ValidDefPath(p); err == nil {
+			t.Errorf("%q: got no error, want error", p)
+		}
+	}
+}
+
+func TestEscapeDefPath(t *testing.T) {
+	tests := map[string]string{
+		"":               "",
+		"Router/Serve":   "Router/Serve",
+		"a.b-c_d~e:f@g$": "a.b-c_d~e:f@g$",
+		"été/x":          "%C3%A9t%C3%A9/x",
+		"a b/c#d?e%f":    "a%20b/c%23d%3Fe%25f",
+	}
+	for p, want := range tests {
+		got := EscapeDefPath(p)
+		if got != want {
+			t.Errorf("%q: got %q, want %q", p, got, want)
+		}
+		if unescaped, err := UnescapePath(got); err != nil {
+			t.Errorf("%q: UnescapePath: %s", got, err)
+		} else if unescaped != p {
+			t.Errorf("%q: UnescapePath: got %q, want %q", got, unescaped, p)
+		}
+	}
+
+	for _, s := range []string{"%", "%4", "%zz"} {
+		if _, err := UnescapePath(s); err == nil {
+			t.Errorf("%q: got no error, want error", s)
+		}
+	}
+	if got, _ := UnescapePath("a+b"); got != "a+b" {
+		t.Errorf("got %q, want \"a+b\" (+ is not a space)", got)
+	}
+}
@@ -1,6 +1,9 @@
 package graph
 
-import "strconv"
+import (
+	"bytes"
+	"fmt"
+)
 
 type RefKey struct {
 	DefRepo     string `json:",omitempty"`
@@ -71,30 +74,79 @@ func (r *Ref) SetFromDefKey(k DefKey) {
 
 type Refs []*Ref
 
-func (r *Ref) sortKey() string {
-	return r.DefPath + r.DefRepo + r.DefUnitType + r.DefUnit + r.Repo + r.UnitType + r.Unit + r.File + strconv.Itoa(int(r.Start)) + strconv.Itoa(int(r.End))
+// refLess reports whether a sorts before b. It compares the fields in
+// order (and offsets numerically), so that refs that differ only in
+// their Def flag or CommitID still sort deterministically.
+func refLess(a, b *Ref) bool {
+	for _, f := range [][2]string{
+		{a.DefPath, b.DefPath},
+		{a.DefRepo, b.DefRepo},
+		{a.DefUnitType, b.DefUnitType},
+		{a.DefUnit, b.DefUnit},
+		{a.Repo, b.Repo},
+		{a.CommitID, b.CommitID},
+		{a.UnitType, b.UnitType},
+		{a.Unit, b.Unit},
+		{a.File, b.File},
+	} {
+		if f[0] != f[1] {
+			return f[0] < f[1]
+		}
+	}
+	if a.Start != b.Start {
+		return a.Start < b.Start
+	}
+	if a.End != b.End {
+		return a.End < b.End
+	}
+	return !a.Def && b.Def
 }
+
 func (vs Refs) Len() int           { return len(vs) }
 func (vs Refs) Swap(i, j int)      { vs[i], vs[j] = vs[j], vs[i] }
-func (vs Refs) Less(i, j int) bool { return vs[i].sortKey() < vs[j].sortKey() }
+func (vs Refs) Less(i, j int) bool { return refLess(vs[i], vs[j]) }
+
+// refIdentity holds all of a ref's fields in a comparable form, so
+// that identical refs can be found with a map. (Refs themselves aren't
+// comparable, because of their Candidates.)
+type refIdentity struct {
+	RefKey
+	Generated  bool
+	Test       bool
+	Candidates string
+}
+
+func newRefIdentity(r *Ref) refIdentity {
+	id := refIdentity{RefKey: r.RefKey(), Generated: r.Generated, Test: r.Test}
+	id.CommitID = r.CommitID
+	if len(r.Candidates) > 0 {
+		var buf bytes.Buffer
+		for _, c := range r.Candidates {
+			fmt.Fprintf(&buf, "%q %q %q %q %v;", c.DefRepo, c.DefUnitType, c.DefUnit, c.DefPath, c.Confidence)
+		}
+		id.Candidates = buf.String()
+	}
+	return id
+}
 
 // RefSet is a set of Refs. It can used to determine whether a grapher emits
 // duplicate refs.
 type RefSet struct {
-	refs map[Ref]struct{}
+	refs map[refIdentity]struct{}
 }
 
 func NewRefSet() *RefSet {
-	return &RefSet{make(map[Ref]struct{})}
+	return &RefSet{make(map[refIdentity]struct{})}
 }
 
 // AddAndCheckUnique adds ref to the set of seen refs, and returns whether the
 // ref already existed in the set.
 func (c *RefSet) AddAndCheckUnique(ref Ref) (duplicate bool) {
-	_, present := c.refs[ref]
+	id := newRefIdentity(&ref)
+	_, present := c.refs[id]
 	if present {
 		return true
 	}
-	c.refs[ref] = struct{}{}
+	c.refs[id] = struct{}{}
 	return false
 }
@@ -43,10 +43,24 @@ type Ref struct {
 	Def bool `protobuf:"varint,17,opt,name=Def,proto3" json:"Def,omitempty"`
 	// File is the filename in which this Ref exists.
 	File string `protobuf:"bytes,10,opt,name=File,proto3" json:"File,omitempty"`
-	// Start is the byte offset of this ref's first byte in File.
+	// Start is the byte offset (not character offset) of this ref's
+	// first byte in File, as it is stored.
 	Start uint32 `protobuf:"varint,11,opt,name=Start,proto3" json:"Start"`
 	// End is the byte offset of this ref's last byte in File.
 	End uint32 `protobuf:"varint,12,opt,name=End,proto3" json:"End"`
+	// Generated is whether this ref is in a generated file (see
+	// IsGenerated).
+	Generated bool `protobuf:"varint,18,opt,name=Generated,proto3" json:"Generated,omitempty"`
+	// Test is whether this ref is in test code (as opposed to main
+	// code). For example, refs in Go *_test.go files have Test = true.
+	Test bool `protobuf:"varint,19,opt,name=Test,proto3" json:"Test,omitempty"`
+	// Candidates are the defs that this ref may refer to, if the
+	// grapher couldn't statically determine which one it refers to
+	// (e.g., a method call on a value of unknown type in a dynamic
+	// language), in decreasing order of confidence. The ref's def
+	// fields (DefRepo, DefUnitType, DefUnit, and DefPath) are those
+	// of the top candidate (see SortCandidates).
+	Candidates []*RefCandidate `protobuf:"bytes,20,rep,name=Candidates" json:"Candidates,omitempty"`
 }
 
 func (m *Ref) Reset()         { *m = Ref{} }
@@ -64,6 +78,22 @@ func (m *RefDefKey) Reset()         { *m = RefDefKey{} }
 func (m *RefDefKey) String() string { return proto.CompactTextString(m) }
 func (*RefDefKey) ProtoMessage()    {}
 
+// RefCandidate is a def that an ambiguous ref may refer to (see
+// Ref.Candidates).
+type RefCandidate struct {
+	DefRepo     string `protobuf:"bytes,1,opt,name=DefRepo,proto3" json:"DefRepo,omitempty"`
+	DefUnitType string `protobuf:"bytes,3,opt,name=DefUnitType,proto3" json:"DefUnitType,omitempty"`
+	DefUnit     string `protobuf:"bytes,4,opt,name=DefUnit,proto3" json:"DefUnit,omitempty"`
+	DefPath     string `protobuf:"bytes,5,opt,name=DefPath,proto3" json:"DefPath"`
+	// Confidence is the grapher's estimate (between 0 and 1) of the
+	// probability that the ref refers to this def.
+	Confidence float32 `protobuf:"fixed32,6,opt,name=Confidence,proto3" json:"Confidence"`
+}
+
+func (m *RefCandidate) Reset()         { *m = RefCandidate{} }
+func (m *RefCandidate) String() string { return proto.CompactTextString(m) }
+func (*RefCandidate) ProtoMessage()    {}
+
 func (m *Ref) Marshal() (data []byte, err error) {
 	size := m.Size()
 	data = make([]byte, size)
@@ -155,6 +185,44 @@ func (m *Ref) MarshalTo(data []byte) (int, error) {
 		}
 		i++
 	}
+	if m.Generated {
+		data[i] = 0x90
+		i++
+		data[i] = 0x1
+		i++
+		if m.Generated {
+			data[i] = 1
+		} else {
+			data[i] = 0
+		}
+		i++
+	}
+	if m.Test {
+		data[i] = 0x98
+		i++
+		data[i] = 0x1
+		i++
+		if m.Test {
+			data[i] = 1
+		} else {
+			data[i] = 0
+		}
+		i++
+	}
+	if len(m.Candidates) > 0 {
+		for _, msg := range m.Candidates {
+			data[i] = 0xa2
+			i++
+			data[i] = 0x1
+			i++
+			i = encodeVarintRef(data, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(data[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
 	return i, nil
 }
 
@@ -200,6 +268,53 @@ func (m *RefDefKey) MarshalTo(data []byte) (int, error) {
 	return i, nil
 }
 
+func (m *RefCandidate) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *RefCandidate) MarshalTo(data []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.DefRepo) > 0 {
+		data[i] = 0xa
+		i++
+		i = encodeVarintRef(data, i, uint64(len(m.DefRepo)))
+		i += copy(data[i:], m.DefRepo)
+	}
+	if len(m.DefUnitType) > 0 {
+		data[i] = 0x1a
+		i++
+		i = encodeVarintRef(data, i, uint64(len(m.DefUnitType)))
+		i += copy(data[i:], m.DefUnitType)
+	}
+	if len(m.DefUnit) > 0 {
+		data[i] = 0x22
+		i++
+		i = encodeVarintRef(data, i, uint64(len(m.DefUnit)))
+		i += copy(data[i:], m.DefUnit)
+	}
+	if len(m.DefPath) > 0 {
+		data[i] = 0x2a
+		i++
+		i = encodeVarintRef(data, i, uint64(len(m.DefPath)))
+		i += copy(data[i:], m.DefPath)
+	}
+	if m.Confidence != 0 {
+		data[i] = 0x35
+		i++
+		i = encodeFixed32Ref(data, i, uint32(math.Float32bits(float32(m.Confidence))))
+	}
+	return i, nil
+}
+
 func encodeFixed64Ref(data []byte, offset int, v uint64) int {
 	data[offset] = uint8(v)
 	data[offset+1] = uint8(v >> 8)
@@ -275,6 +390,18 @@ func (m *Ref) Size() (n int) {
 	if m.Def {
 		n += 3
 	}
+	if m.Generated {
+		n += 3
+	}
+	if m.Test {
+		n += 3
+	}
+	if len(m.Candidates) > 0 {
+		for _, e := range m.Candidates {
+			l = e.Size()
+			n += 2 + l + sovRef(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -300,6 +427,31 @@ func (m *RefDefKey) Size() (n int) {
 	return n
 }
 
+func (m *RefCandidate) Size() (n int) {
+	var l int
+	_ = l
+	l = len(m.DefRepo)
+	if l > 0 {
+		n += 1 + l + sovRef(uint64(l))
+	}
+	l = len(m.DefUnitType)
+	if l > 0 {
+		n += 1 + l + sovRef(uint64(l))
+	}
+	l = len(m.DefUnit)
+	if l > 0 {
+		n += 1 + l + sovRef(uint64(l))
+	}
+	l = len(m.DefPath)
+	if l > 0 {
+		n += 1 + l + sovRef(uint64(l))
+	}
+	if m.Confidence != 0 {
+		n += 5
+	}
+	return n
+}
+
 func sovRef(x uint64) (n int) {
 	for {
 		n++
@@ -661,6 +813,77 @@ func (m *Ref) Unmarshal(data []byte) error {
 				}
 			}
 			m.Def = bool(v != 0)
+		case 18:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Generated", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRef
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				v |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Generated = bool(v != 0)
+		case 19:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Test", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRef
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				v |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Test = bool(v != 0)
+		case 20:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Candidates", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRef
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRef
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Candidates = append(m.Candidates, &RefCandidate{})
+			if err := m.Candidates[len(m.Candidates)-1].Unmarshal(data[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRef(data[iNdEx:])
@@ -848,6 +1071,186 @@ func (m *RefDefKey) Unmarshal(data []byte) error {
 	}
 	return nil
 }
+func (m *RefCandidate) Unmarshal(data []byte) error {
+	l := len(data)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowRef
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: RefCandidate: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: RefCandidate: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DefRepo", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRef
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRef
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.DefRepo = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DefUnitType", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRef
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRef
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.DefUnitType = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DefUnit", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRef
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRef
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.DefUnit = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DefPath", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRef
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRef
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.DefPath = string(data[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 6:
+			if wireType != 5 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Confidence", wireType)
+			}
+			var v uint32
+			if (iNdEx + 4) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += 4
+			v = uint32(data[iNdEx-4])
+			v |= uint32(data[iNdEx-3]) << 8
+			v |= uint32(data[iNdEx-2]) << 16
+			v |= uint32(data[iNdEx-1]) << 24
+			m.Confidence = float32(math.Float32frombits(v))
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRef(data[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthRef
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func skipRef(data []byte) (n int, err error) {
 	l := len(data)
 	iNdEx := 0
@@ -0,0 +1,59 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DefKey returns the key of the def that c refers to.
+func (c *RefCandidate) DefKey() DefKey {
+	return DefKey{
+		Repo:     c.DefRepo,
+		UnitType: c.DefUnitType,
+		Unit:     c.DefUnit,
+		Path:     c.DefPath,
+	}
+}
+
+// Ambiguous reports whether r has more than one candidate def (see
+// Ref.Candidates).
+func (r *Ref) Ambiguous() bool { return len(r.Candidates) > 1 }
+
+// SortCandidates sorts r.Candidates in decreasing order of confidence
+// (keeping the order of candidates with equal confidence) and sets r's
+// def fields to those of the top candidate, so that r resolves to the
+// def that it most likely refers to. Graphers that emit candidates
+// needn't set a ref's def fields themselves.
+func (r *Ref) SortCandidates() {
+	if len(r.Candidates) == 0 {
+		return
+	}
+	sort.Stable(candidatesByConfidence(r.Candidates))
+	r.SetFromDefKey(r.Candidates[0].DefKey())
+}
+
+type candidatesByConfidence []*RefCandidate
+
+func (v candidatesByConfidence) Len() int           { return len(v) }
+func (v candidatesByConfidence) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v candidatesByConfidence) Less(i, j int) bool { return v[i].Confidence > v[j].Confidence }
+
+// ValidCandidates checks that r's candidates have valid def paths and
+// confidences between 0 and 1, and that no def is a candidate twice.
+func (r *Ref) ValidCandidates() error {
+	seen := make(map[DefKey]struct{}, len(r.Candidates))
+	for _, c := range r.Candidates {
+		key := c.DefKey()
+		if err := ValidDefPath(c.DefPath); err != nil {
+			return fmt.Errorf("candidate %+v: %s", key, err)
+		}
+		if !(c.Confidence >= 0 && c.Confidence <= 1) {
+			return fmt.Errorf("candidate %+v has confidence %v (expected between 0 and 1)", key, c.Confidence)
+		}
+		if _, dup := seen[key]; dup {
+			return fmt.Errorf("duplicate candidate %+v", key)
+		}
+		seen[key] = struct{}{}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+)
+
+func TestRef_SortCandidates(t *testing.T) {
+	ref := &Ref{
+		File: "f",
+		Candidates: []*RefCandidate{
+			{DefUnitType: "t", DefUnit: "u", DefPath: "A/m", Confidence: 0.25},
+			{DefUnitType: "t", DefUnit: "u", DefPath: "B/m", Confidence: 0.5},
+			{DefUnitType: "t", DefUnit: "u", DefPath: "C/m", Confidence: 0.25},
+		},
+	}
+	ref.SortCandidates()
+
+	var paths []string
+	for _, c := range ref.Candidates {
+		paths = append(paths, c.DefPath)
+	}
+	if want := []string{"B/m", "A/m", "C/m"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("got candidates %v, want %v", paths, want)
+	}
+	if want := (DefKey{UnitType: "t", Unit: "u", Path: "B/m"}); ref.DefKey() != want {
+		t.Errorf("got def key %+v, want top candidate %+v", ref.DefKey(), want)
+	}
+	if !ref.Ambiguous() {
+		t.Error("got !Ambiguous, want Ambiguous")
+	}
+	if err := ref.ValidCandidates(); err != nil {
+		t.Error(err)
+	}
+
+	// Candidates survive a protobuf round trip.
+	b, err := proto.Marshal(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ref2 Ref
+	if err := proto.Unmarshal(b, &ref2); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&ref2, ref) {
+		t.Errorf("got %+v, want %+v", &ref2, ref)
+	}
+}
+
+func TestRef_ValidCandidates(t *testing.T) {
+	tests := map[string][]*RefCandidate{
+		"confidence > 1": {{DefPath: "a", Confidence: 1.5}},
+		"confidence < 0": {{DefPath: "a", Confidence: -0.5}},
+		"duplicate":      {{DefPath: "a", Confidence: 0.5}, {DefPath: "a", Confidence: 0.5}},
+		"bad def path":   {{DefPath: "a\x00", Confidence: 0.5}},
+	}
+	for label, candidates := range tests {
+		ref := &Ref{Candidates: candidates}
+		if err := ref.ValidCandidates(); err == nil {
+			t.Errorf("%s: got no error, want an error", label)
+		}
+	}
+}
+
+func TestDedupRefs_Candidates(t *testing.T) {
+	candidates := func(conf float32) []*RefCandidate {
+		return []*RefCandidate{{DefPath: "a", Confidence: conf}, {DefPath: "b", Confidence: 0.1}}
+	}
+	refs := []*Ref{
+		{DefPath: "a", File: "f", Candidates: candidates(0.9)},
+		{DefPath: "a", File: "f", Candidates: candidates(0.9)},
+		{DefPath: "a", File: "f", Candidates: candidates(0.8)},
+	}
+	if got := DedupRefs(refs); len(got) != 2 {
+		t.Errorf("got %d refs, want 2", len(got))
+	}
+}
@@ -0,0 +1,33 @@
+package graph
+
+// RefCounts holds the number of refs to each def in a repository,
+// keyed by the def's UnitType, Unit, and Path. It is used to
+// downsample graph data (see (RefCounts).Downsample), which keeps only the defs
+// (with their ref counts) so that they can still be looked up and
+// ranked in search results.
+type RefCounts map[DefKey]uint32
+
+// Add counts refs. Refs to defs in other repositories, and refs that
+// span defs' own names (whose Def field is set), aren't counted.
+func (c RefCounts) Add(refs []*Ref) {
+	for _, r := range refs {
+		if r.Def || (r.DefRepo != "" && r.DefRepo != r.Repo) {
+			continue
+		}
+		k := DefKey{UnitType: r.DefUnitType, Unit: r.DefUnit, Path: r.DefPath}
+		if k.UnitType == "" && k.Unit == "" {
+			k.UnitType, k.Unit = r.UnitType, r.Unit
+		}
+		c[k]++
+	}
+}
+
+// Downsample removes o's refs and anns, which make up most of the
+// size of graph data, and sets the RefCount of each of o's defs to
+// its number of refs in c.
+func (c RefCounts) Downsample(o *Output) {
+	for _, d := range o.Defs {
+		d.RefCount = c[DefKey{UnitType: d.UnitType, Unit: d.Unit, Path: d.Path}]
+	}
+	o.Refs, o.Anns = nil, nil
+}
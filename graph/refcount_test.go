@@ -0,0 +1,38 @@
+package graph
+
+import (
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/ann"
+)
+
+func TestRefCounts(t *testing.T) {
+	c := RefCounts{}
+	c.Add([]*Ref{
+		{UnitType: "t", Unit: "u", DefPath: "F"},
+		{UnitType: "t", Unit: "u", DefUnitType: "t", DefUnit: "u", DefPath: "F"},
+		{UnitType: "t", Unit: "v", DefUnitType: "t", DefUnit: "u", DefPath: "F"},
+		{UnitType: "t", Unit: "u", DefPath: "F", Def: true},
+		{UnitType: "t", Unit: "u", DefRepo: "other", DefUnitType: "t", DefUnit: "u", DefPath: "F"},
+		{UnitType: "t", Unit: "u", DefPath: "G"},
+	})
+
+	o := &Output{
+		Defs: []*Def{
+			{DefKey: DefKey{UnitType: "t", Unit: "u", Path: "F"}},
+			{DefKey: DefKey{UnitType: "t", Unit: "u", Path: "G"}},
+			{DefKey: DefKey{UnitType: "t", Unit: "u", Path: "H"}},
+		},
+		Refs: []*Ref{{DefPath: "F"}},
+		Anns: []*ann.Ann{{File: "f"}},
+	}
+	c.Downsample(o)
+	if o.Refs != nil || o.Anns != nil {
+		t.Errorf("got refs %v and anns %v, want none", o.Refs, o.Anns)
+	}
+	for i, want := range []uint32{3, 1, 0} {
+		if got := o.Defs[i].RefCount; got != want {
+			t.Errorf("def %s: got RefCount %d, want %d", o.Defs[i].Path, got, want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package graph
+
+import (
+	"path"
+	"strings"
+)
+
+// testFileSuffixes are the filename suffixes of test files, by the
+// conventions of the test tools of Go, Python (pytest), Ruby (RSpec and
+// Minitest), Java and Kotlin (JUnit), C# (NUnit and xUnit), PHP
+// (PHPUnit), C++ (Google Test), and Swift and Objective-C (XCTest).
+var testFileSuffixes = []string{
+	"_test.go",
+	"_test.py",
+	"_spec.rb", "_test.rb",
+	"Test.java", "Tests.java",
+	"Test.kt", "Tests.kt",
+	"Test.cs", "Tests.cs",
+	"Test.php",
+	"_test.cc", "_test.cpp", "_unittest.cc", "_unittest.cpp",
+	"Tests.swift", "Tests.m",
+}
+
+// testFileInfixes are the infixes (before the extension) of test files
+// in JavaScript and TypeScript (e.g., "foo.test.js" or "foo.spec.ts").
+var testFileInfixes = []string{".test.", ".spec.", "-test.", "-spec.", "_spec."}
+
+// testDirs are the names of directories whose files are all tests
+// (e.g., Maven's and Gradle's src/test).
+var testDirs = []string{"__tests__", "testdata", "test", "tests", "spec"}
+
+// IsTestFile reports whether filename (a slash-separated path relative
+// to the repository root) contains test code (as opposed to main
+// code), by the naming conventions of common languages and test tools.
+// For example, Go *_test.go files, Python test_*.py files, and files
+// in test or __tests__ directories are test files.
+func IsTestFile(filename string) bool {
+	filename = strings.Replace(filename, "\\", "/", -1)
+	base := path.Base(filename)
+	for _, suffix := range testFileSuffixes {
+		if strings.HasSuffix(base, suffix) && len(base) > len(suffix) {
+			return true
+		}
+	}
+	if strings.HasPrefix(base, "test_") && strings.HasSuffix(base, ".py") {
+		return true
+	}
+	for _, infix := range testFileInfixes {
+		if strings.Contains(base, infix) {
+			return true
+		}
+	}
+
+	for _, dir := range strings.Split(path.Dir(filename), "/") {
+		for _, testDir := range testDirs {
+			if dir == testDir {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package graph
+
+import "testing"
+
+func TestIsTestFile(t *testing.T) {
+	tests := map[string]bool{
+		"foo.go":                       false,
+		"foo_test.go":                  true,
+		"pkg/test_foo.py":              true,
+		"pkg/foo_test.py":              true,
+		"pkg/testing.py":               false,
+		"lib/foo.rb":                   false,
+		"spec/foo_spec.rb":             true,
+		"src/main/java/a/Foo.java":     false,
+		"src/test/java/a/FooTest.java": true,
+		"src/main/java/a/Test.java":    false,
+		"app/foo.test.js":              true,
+		"app/foo.spec.ts":              true,
+		"app/__tests__/foo.js":         true,
+		"app/latest.js":                false,
+		"testdata/input.go":            true,
+		`Foo.Tests\FooTests.cs`:        true,
+		"contest/foo.c":                false,
+	}
+	for file, want := range tests {
+		if got := IsTestFile(file); got != want {
+			t.Errorf("%s: got %v, want %v", file, got, want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package graph
+
+import "strings"
+
+// Def visibilities. Toolchains should set Def.Visibility to one of
+// these when the language has a notion of visibility.
+const (
+	VisibilityPublic    = "public"    // visible everywhere
+	VisibilityProtected = "protected" // visible to subclasses (and, in some languages, the package)
+	VisibilityInternal  = "internal"  // visible within the package, module, or assembly
+	VisibilityPrivate   = "private"   // visible within the enclosing type or file
+)
+
+// visibilityAliases maps common language-specific visibilities
+// (lowercased) to canonical ones.
+var visibilityAliases = map[string]string{
+	"export":          VisibilityPublic,
+	"exported":        VisibilityPublic,
+	"package":         VisibilityInternal,
+	"package-private": VisibilityInternal,
+	"default":         VisibilityInternal,
+	"fileprivate":     VisibilityPrivate,
+}
+
+// IsValidVisibility reports whether v is one of the Visibility*
+// constants or empty (unknown).
+func IsValidVisibility(v string) bool {
+	switch v {
+	case "", VisibilityPublic, VisibilityProtected, VisibilityInternal, VisibilityPrivate:
+		return true
+	}
+	return false
+}
+
+// IsExportedVisibility reports whether defs with visibility v are part
+// of their source unit's public API (i.e., v is VisibilityPublic or
+// VisibilityProtected).
+func IsExportedVisibility(v string) bool {
+	return v == VisibilityPublic || v == VisibilityProtected
+}
+
+// NormalizeVisibility makes d's Visibility and Exported fields
+// consistent. A language-specific Visibility (e.g., "package-private")
+// is mapped to the corresponding canonical visibility, and then, if
+// Visibility is valid, Exported is set according to it. If Visibility
+// is empty and the def is Exported, Visibility is set to
+// VisibilityPublic. An unrecognized Visibility is left as is (and is
+// reported by validation).
+func (d *Def) NormalizeVisibility() {
+	if d.Visibility == "" {
+		if d.Exported {
+			d.Visibility = VisibilityPublic
+		}
+		return
+	}
+	v := strings.ToLower(d.Visibility)
+	if alias, present := visibilityAliases[v]; present {
+		v = alias
+	}
+	if IsValidVisibility(v) {
+		d.Visibility = v
+		d.Exported = IsExportedVisibility(v)
+	}
+}
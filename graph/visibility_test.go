@@ -0,0 +1,27 @@
+package graph
+
+import "testing"
+
+func TestDef_NormalizeVisibility(t *testing.T) {
+	tests := []struct {
+		def            Def
+		wantVisibility string
+		wantExported   bool
+	}{
+		{Def{}, "", false},
+		{Def{Exported: true}, VisibilityPublic, true},
+		{Def{Visibility: "Public"}, VisibilityPublic, true},
+		{Def{Visibility: "protected"}, VisibilityProtected, true},
+		{Def{Visibility: "package-private", Exported: true}, VisibilityInternal, false},
+		{Def{Visibility: "private", Exported: true}, VisibilityPrivate, false},
+		{Def{Visibility: "fileprivate"}, VisibilityPrivate, false},
+		{Def{Visibility: "bogus", Exported: true}, "bogus", true},
+	}
+	for _, test := range tests {
+		def := test.def
+		def.NormalizeVisibility()
+		if def.Visibility != test.wantVisibility || def.Exported != test.wantExported {
+			t.Errorf("%+v: got Visibility %q Exported %v, want %q and %v", test.def, def.Visibility, def.Exported, test.wantVisibility, test.wantExported)
+		}
+	}
+}
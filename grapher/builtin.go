@@ -0,0 +1,68 @@
+package grapher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/scan"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// A BuiltinGrapher graphs the source unit u in the current directory
+// (the root of the repository). Unlike toolchains, built-in graphers
+// must emit byte offsets.
+type BuiltinGrapher func(u *unit.SourceUnit) (*graph.Output, error)
+
+// Builtins maps source unit types to the graphers built into srclib
+// that graph units of those types. A built-in grapher is used only if
+// no installed toolchain has a graph tool for the unit type. It is run
+// as the "graph" tool of the built-in toolchain (see
+// scan.BuiltinToolchain and RunBuiltin).
+var Builtins = map[string]BuiltinGrapher{}
+
+// builtinGraphTool is the tool that runs the built-in graphers.
+var builtinGraphTool = srclib.ToolRef{Toolchain: scan.BuiltinToolchain, Subcmd: graphOp}
+
+// chooseGraphTool returns the tool that graphs source units of the
+// given type: the installed toolchain's graph tool for the type, or
+// else the built-in graph tool if there is a built-in grapher for it.
+func chooseGraphTool(unitType string) (*srclib.ToolRef, error) {
+	toolRef, err := toolchain.ChooseTool(graphOp, unitType)
+	if err != nil || toolRef != nil {
+		return toolRef, err
+	}
+	if _, present := Builtins[unitType]; present {
+		t := builtinGraphTool
+		return &t, nil
+	}
+	return nil, nil
+}
+
+// RunBuiltin runs the built-in tool named subcmd (see Builtins), as
+// toolchain programs are run: it reads a source unit from r and writes
+// its graph output to w.
+func RunBuiltin(subcmd string, r io.Reader, w io.Writer) error {
+	if subcmd != builtinGraphTool.Subcmd {
+		return fmt.Errorf("no built-in tool named %q", subcmd)
+	}
+	var u *unit.SourceUnit
+	if err := json.NewDecoder(r).Decode(&u); err != nil {
+		return err
+	}
+	if u == nil {
+		return fmt.Errorf("no source unit given")
+	}
+	g, present := Builtins[u.Type]
+	if !present {
+		return fmt.Errorf("no built-in grapher for source unit type %q", u.Type)
+	}
+	o, err := g(u)
+	if err != nil {
+		return fmt.Errorf("graphing %s %s: %s", u.Type, u.Name, err)
+	}
+	return json.NewEncoder(w).Encode(o)
+}
@@ -0,0 +1,64 @@
+package grapher
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestBuiltin(t *testing.T) {
+	oldChooseTool := toolchain.ChooseTool
+	defer func() { toolchain.ChooseTool = oldChooseTool }()
+	toolchain.ChooseTool = func(op, unitType string) (*srclib.ToolRef, error) {
+		if unitType == "Installed" {
+			return &srclib.ToolRef{Toolchain: "tc", Subcmd: "graph"}, nil
+		}
+		return nil, nil
+	}
+	defer func() {
+		delete(Builtins, "Installed")
+		delete(Builtins, "Builtin")
+	}()
+	g := func(u *unit.SourceUnit) (*graph.Output, error) {
+		return &graph.Output{Defs: []*graph.Def{{DefKey: graph.DefKey{Path: u.Name}}}}, nil
+	}
+	Builtins["Installed"] = g
+	Builtins["Builtin"] = g
+
+	for unitType, want := range map[string]*srclib.ToolRef{
+		"Installed": {Toolchain: "tc", Subcmd: "graph"},
+		"Builtin":   {Toolchain: "srclib", Subcmd: "graph"},
+		"Unknown":   nil,
+	} {
+		got, err := chooseGraphTool(unitType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got tool %v, want %v", unitType, got, want)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := RunBuiltin("graph", strings.NewReader(`{"Type": "Builtin", "Name": "u"}`), &out); err != nil {
+		t.Fatal(err)
+	}
+	var o graph.Output
+	if err := json.Unmarshal(out.Bytes(), &o); err != nil {
+		t.Fatal(err)
+	}
+	if len(o.Defs) != 1 || o.Defs[0].Path != "u" {
+		t.Errorf("got output %+v, want the built-in grapher's output", o)
+	}
+
+	if err := RunBuiltin("graph", strings.NewReader(`{"Type": "Unknown", "Name": "u"}`), &out); err == nil {
+		t.Error("got nil error for a unit type without a built-in grapher")
+	}
+}
@@ -0,0 +1,165 @@
+package grapher
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/makex"
+	"sourcegraph.com/sourcegraph/srclib/dep"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// DepGraphDataEnv is the environment variable that lists (separated by
+// os.PathListSeparator) the graph output files of the source units in
+// the same repository that the unit being graphed depends on. Graphers
+// that need information from other units (such as the types defined
+// in the other modules of a multi-module project) may read it from
+// those files instead of recomputing it. The files are built before
+// the unit is graphed.
+//
+// A unit's dependencies on other units in the same repository are
+// declared by its depresolve output: they are the resolutions whose
+// target has no ToRepoCloneURL and names a source unit in the
+// repository (see dep.ResolvedTarget). Because the plan is created
+// before the depresolve rules run, the dependencies are those in the
+// existing depresolve output (see "srclib make", which resolves
+// dependencies before planning the graph rules when it is missing).
+const DepGraphDataEnv = "SRCLIB_DEP_GRAPH_DATA"
+
+// unitDeps returns the units that each unit (by ID) depends on,
+// according to the existing output of the depresolve rules in rules.
+// Only units graphed by GraphUnitRules (not by GraphMultiUnitsRules)
+// are considered. Dependencies that would form a cycle are dropped
+// (and logged), so that the graph rules can be ordered by them.
+func unitDeps(units []*unit.SourceUnit, rules []makex.Rule) map[unit.ID2][]*unit.SourceUnit {
+	byID := make(map[unit.ID2]*unit.SourceUnit, len(units))
+	for _, u := range units {
+		byID[u.ID2()] = u
+	}
+
+	deps := map[unit.ID2][]*unit.SourceUnit{}
+	for _, rule := range rules {
+		r, ok := rule.(*dep.ResolveDepsRule)
+		if !ok {
+			continue
+		}
+		from := r.Unit.ID2()
+		if _, ok := byID[from]; !ok {
+			continue
+		}
+		seen := map[unit.ID2]bool{from: true}
+		for _, res := range readResolutions(r.Target()) {
+			t := res.Target
+			if t == nil || t.ToRepoCloneURL != "" || t.ToUnit == "" {
+				continue
+			}
+			to := unit.ID2{Type: t.ToUnitType, Name: t.ToUnit}
+			if u, ok := byID[to]; ok && !seen[to] {
+				seen[to] = true
+				deps[from] = append(deps[from], u)
+			}
+		}
+	}
+	breakDepCycles(units, deps)
+	return deps
+}
+
+// readResolutions reads the depresolve output in file. If it doesn't
+// exist or can't be read, it returns nil; the depresolve rule will
+// (re)create it, and the unit's dependencies will be known the next
+// time that the plan is created.
+func readResolutions(file string) []*dep.Resolution {
+	f, err := os.Open(filepath.FromSlash(file))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var res []*dep.Resolution
+	if err := json.NewDecoder(f).Decode(&res); err != nil {
+		return nil
+	}
+	return res
+}
+
+// breakDepCycles removes the dependencies in deps that form cycles,
+// visiting units in order (and their dependencies in the order in
+// which they were declared).
+func breakDepCycles(units []*unit.SourceUnit, deps map[unit.ID2][]*unit.SourceUnit) {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[unit.ID2]int{}
+	var visit func(id unit.ID2)
+	visit = func(id unit.ID2) {
+		state[id] = visiting
+		kept := deps[id][:0]
+		for _, d := range deps[id] {
+			did := d.ID2()
+			switch state[did] {
+			case visiting:
+				log.Printf("Warning: ignoring the dependency of source unit %s %s on %s %s, which is part of a dependency cycle.", id.Type, id.Name, did.Type, did.Name)
+				continue
+			case 0:
+				visit(did)
+			}
+			kept = append(kept, d)
+		}
+		if len(kept) > 0 {
+			deps[id] = kept
+		} else {
+			delete(deps, id)
+		}
+		state[id] = done
+	}
+	ids := make([]unit.ID2, len(units))
+	for i, u := range units {
+		ids[i] = u.ID2()
+	}
+	sort.Sort(unitID2s(ids))
+	for _, id := range ids {
+		if state[id] == 0 {
+			visit(id)
+		}
+	}
+}
+
+type unitID2s []unit.ID2
+
+func (v unitID2s) Len() int { return len(v) }
+func (v unitID2s) Less(i, j int) bool {
+	if v[i].Type != v[j].Type {
+		return v[i].Type < v[j].Type
+	}
+	return v[i].Name < v[j].Name
+}
+func (v unitID2s) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+
+// depGraphFiles returns the graph output files (under dataDir) of the
+// units in deps, or nil if there are none.
+func depGraphFiles(dataDir string, deps []*unit.SourceUnit) []string {
+	if len(deps) == 0 {
+		return nil
+	}
+	files := make([]string, len(deps))
+	for i, u := range deps {
+		files[i] = filepath.ToSlash(filepath.Join(dataDir, plan.SourceUnitDataFilename(&graph.Output{}, u)))
+	}
+	return files
+}
+
+// depGraphDataArgs returns the "srclib tool" flags that set
+// DepGraphDataEnv to files, preceded by a space, or "" if there are
+// none.
+func depGraphDataArgs(files []string) string {
+	if len(files) == 0 {
+		return ""
+	}
+	return " --env " + plan.ShellQuote(DepGraphDataEnv+"="+strings.Join(files, string(os.PathListSeparator)))
+}
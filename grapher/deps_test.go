@@ -0,0 +1,95 @@
+package grapher
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/dep"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestMakeGraphRules_unitDeps(t *testing.T) {
+	oldChooseTool := toolchain.ChooseTool
+	defer func() { toolchain.ChooseTool = oldChooseTool }()
+	toolchain.ChooseTool = func(op, unitType string) (*srclib.ToolRef, error) {
+		return &srclib.ToolRef{Toolchain: "tc", Subcmd: op}, nil
+	}
+
+	dataDir, err := ioutil.TempDir("", "srclib-unit-deps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	newUnit := func(name string) *unit.SourceUnit {
+		return &unit.SourceUnit{Key: unit.Key{Type: "MavenModule", Name: name}}
+	}
+	a, b, c, d := newUnit("a"), newUnit("b"), newUnit("c"), newUnit("d")
+	tree := &config.Tree{SourceUnits: []*unit.SourceUnit{a, b, c, d}}
+
+	// a depends on b (and on an external unit), b on c, and c on b (a
+	// cycle).
+	intra := func(u *unit.SourceUnit) *dep.Resolution {
+		return &dep.Resolution{Target: &dep.ResolvedTarget{ToUnit: u.Name, ToUnitType: u.Type}}
+	}
+	resolutions := map[*unit.SourceUnit][]*dep.Resolution{
+		a: {intra(b), {Target: &dep.ResolvedTarget{ToRepoCloneURL: "https://example.com/x", ToUnit: "c", ToUnitType: "MavenModule"}}},
+		b: {intra(c)},
+		c: {intra(b), intra(c)},
+	}
+	for u, res := range resolutions {
+		data, err := json.Marshal(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(dataDir, plan.SourceUnitDataFilename([]*dep.ResolvedDep{}, u))
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	depRules, err := plan.RuleMakers["depresolve"](tree, dataDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := makeGraphRules(tree, dataDir, depRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	graphFile := func(u *unit.SourceUnit) string {
+		return depGraphFiles(dataDir, []*unit.SourceUnit{u})[0]
+	}
+	want := map[string][]string{
+		"a": {graphFile(b)},
+		"b": {graphFile(c)},
+		"c": nil, // its dependency on b would form a cycle
+		"d": nil,
+	}
+	for _, rule := range rules {
+		r := rule.(*GraphUnitRule)
+		if got := r.DepGraphFiles; !reflect.DeepEqual(got, want[r.Unit.Name]) {
+			t.Errorf("unit %s: got dep graph files %v, want %v", r.Unit.Name, got, want[r.Unit.Name])
+		}
+		prereqs := r.Prereqs()
+		if got := prereqs[len(prereqs)-len(r.DepGraphFiles):]; len(r.DepGraphFiles) > 0 && !reflect.DeepEqual(got, r.DepGraphFiles) {
+			t.Errorf("unit %s: got prereqs %v, want them to end with %v", r.Unit.Name, prereqs, r.DepGraphFiles)
+		}
+		hasEnv := strings.Contains(r.Recipes()[0], DepGraphDataEnv+"=")
+		if hasEnv != (len(r.DepGraphFiles) > 0) {
+			t.Errorf("unit %s: got recipe %q", r.Unit.Name, r.Recipes()[0])
+		}
+	}
+}
@@ -1,17 +1,17 @@
 package grapher
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
-	"log"
-	"os"
 	"path/filepath"
 	"sort"
 
-	"github.com/sqs/fileset"
-
 	"sourcegraph.com/sourcegraph/srclib/ann"
 	"sourcegraph.com/sourcegraph/srclib/config"
 	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/graph/docs"
 	"sourcegraph.com/sourcegraph/srclib/unit"
 )
 
@@ -21,68 +21,85 @@ type Grapher interface {
 
 // TODO(sqs): add grapher validation of output
 
-func ensureOffsetsAreByteOffsets(dir string, output *graph.Output) {
-	fset := fileset.NewFileSet()
-	files := make(map[string]*fileset.File)
-
-	addOrGetFile := func(filename string) *fileset.File {
-		if f, ok := files[filename]; ok {
-			return f
-		}
-		data, err := ioutil.ReadFile(filename)
-		if err != nil {
-			panic("ReadFile " + filename + ": " + err.Error())
-		}
+func sortedOutput(o *graph.Output) *graph.Output {
+	sort.Sort(graph.Defs(o.Defs))
+	sort.Sort(graph.Refs(o.Refs))
+	sort.Sort(graph.Docs(o.Docs))
+	sort.Sort(ann.Anns(o.Anns))
+	return o
+}
 
-		f := fset.AddFile(filename, fset.Base(), len(data))
-		f.SetByteOffsetsForContent(data)
-		files[filename] = f
-		return f
+// canonicalJSON re-encodes the JSON document data with object keys
+// sorted and insignificant whitespace removed, so that toolchain
+// output that differs only in formatting or key order normalizes to
+// the same bytes.
+func canonicalJSON(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
 	}
+	return json.Marshal(v)
+}
 
-	fix := func(filename string, offsets ...*uint32) {
-		defer func() {
-			if e := recover(); e != nil {
-				log.Printf("failed to convert unicode offset to byte offset in file %s (did grapher output a nonexistent byte offset?) continuing anyway...", filename)
-			}
-		}()
-		if filename == "" {
-			return
-		}
-		filename = filepath.Join(dir, filename)
-		if fi, err := os.Stat(filename); err != nil || !fi.Mode().IsRegular() {
-			return
+// canonicalizeData canonicalizes the toolchain-specific Data of the
+// defs and anns in o (see canonicalJSON).
+func canonicalizeData(o *graph.Output) error {
+	for _, def := range o.Defs {
+		data, err := canonicalJSON(def.Data)
+		if err != nil {
+			return fmt.Errorf("def %s: invalid Data: %s", def.Path, err)
 		}
-		f := addOrGetFile(filename)
-		for _, offset := range offsets {
-			if *offset == 0 {
-				continue
-			}
-			*offset = uint32(f.ByteOffsetOfRune(int(*offset)))
+		def.Data = data
+	}
+	for _, a := range o.Anns {
+		data, err := canonicalJSON(a.Data)
+		if err != nil {
+			return fmt.Errorf("ann %s:%d: invalid Data: %s", a.File, a.StartLine, err)
 		}
+		a.Data = data
 	}
+	return nil
+}
 
-	for _, s := range output.Defs {
-		fix(s.File, &s.DefStart, &s.DefEnd)
-	}
-	for _, r := range output.Refs {
-		fix(r.File, &r.Start, &r.End)
-	}
-	for _, d := range output.Docs {
-		fix(d.File, &d.Start, &d.End)
+// MarshalOutput returns the JSON encoding of graph output that has
+// been normalized with NormalizeData. Because normalized output is
+// sorted and its fields are encoded in a fixed order, the encoding is
+// byte-for-byte reproducible.
+func MarshalOutput(o *graph.Output) ([]byte, error) {
+	data, err := json.MarshalIndent(o, "", "  ")
+	if err != nil {
+		return nil, err
 	}
+	return append(data, '\n'), nil
 }
 
-func sortedOutput(o *graph.Output) *graph.Output {
-	sort.Sort(graph.Defs(o.Defs))
-	sort.Sort(graph.Refs(o.Refs))
-	sort.Sort(graph.Docs(o.Docs))
-	sort.Sort(ann.Anns(o.Anns))
-	return o
+// NormalizeData sorts data and performs other postprocessing, such as
+// converting file paths to the form required in graph data (see
+// graph.ResolveFile), adding sanitized HTML and plain text versions of docs (see
+// docs.Normalize), mapping def kinds and visibilities to canonical
+// ones (see graph.CanonicalKind and (*graph.Def).NormalizeVisibility),
+// tagging defs and refs in generated files and test files (see
+// graph.IsGenerated and graph.IsTestFile), and filling in the unit of
+// alias defs' AliasOf keys (see (*graph.Def).AliasKey).
+// The defs, refs, docs, and anns are sorted in a canonical order, and
+// the Data of defs and anns is re-encoded with sorted keys, so that
+// normalized output is deterministic.
+//
+// The unit of the offsets in o is detected (see DetectOffsets); use
+// NormalizeDataOffsets if the toolchain that emitted o declares it.
+func NormalizeData(unitType, dir string, o *graph.Output) error {
+	return NormalizeDataOffsets(unitType, dir, DetectOffsets, o)
 }
 
-// NormalizeData sorts data and performs other postprocessing.
-func NormalizeData(unitType, dir string, o *graph.Output) error {
+// NormalizeDataOffsets is like NormalizeData, but the offsets in o
+// are in the given unit, and they are converted to byte offsets if
+// necessary.
+func NormalizeDataOffsets(unitType, dir string, offsets OffsetUnit, o *graph.Output) error {
 	for _, ref := range o.Refs {
 		if ref.DefRepo != "" && ref.DefRepo != unit.UnitRepoUnresolved {
 			uri, err := graph.TryMakeURI(string(ref.DefRepo))
@@ -99,21 +116,170 @@ func NormalizeData(unitType, dir string, o *graph.Output) error {
 			ref.Repo = uri
 		}
 	}
+	for _, def := range o.Defs {
+		if def.AliasOf == nil {
+			continue
+		}
+		if def.AliasOf.Path == "" {
+			return fmt.Errorf("def %s is an alias of a def with an empty path", def.Path)
+		}
+		k, _ := def.AliasKey()
+		if k.Repo != "" && k.Repo != unit.UnitRepoUnresolved {
+			uri, err := graph.TryMakeURI(k.Repo)
+			if err != nil {
+				return err
+			}
+			k.Repo = uri
+		}
+		def.AliasOf = &k
+	}
+
+	resolveFiles(dir, o)
+
+	fallback := defaultOffsetUnit(unitType)
+	if offsets == DetectOffsets && fallback == ByteOffsets {
+		offsets = ByteOffsets
+	}
+	ensureByteOffsets(dir, offsets, fallback, o)
+	markGenerated(dir, o)
+	MarkTests(o, graph.IsTestFile)
+
+	return finishOutput(o)
+}
+
+// resolveFiles converts the file paths in o, as reported by the
+// toolchain that was run in dir, to the form required in graph data
+// (see graph.ResolveFile).
+func resolveFiles(dir string, o *graph.Output) {
+	resolved := map[string]string{}
+	resolve := func(file string) string {
+		if file == "" {
+			return ""
+		}
+		f, present := resolved[file]
+		if !present {
+			f = graph.ResolveFile(dir, file)
+			resolved[file] = f
+		}
+		return f
+	}
+	for _, def := range o.Defs {
+		def.File = resolve(def.File)
+	}
+	for _, ref := range o.Refs {
+		ref.File = resolve(ref.File)
+	}
+	for _, doc := range o.Docs {
+		doc.File = resolve(doc.File)
+	}
+	for _, a := range o.Anns {
+		a.File = resolve(a.File)
+	}
+}
+
+// MarkTests sets the Test field of the defs and refs in o that are in
+// test files, as reported by isTestFile. It doesn't unset the Test
+// field of defs and refs that the toolchain already marked as Test.
+func MarkTests(o *graph.Output, isTestFile func(file string) bool) {
+	tests := map[string]bool{}
+	isTest := func(file string) bool {
+		if file == "" {
+			return false
+		}
+		t, present := tests[file]
+		if !present {
+			t = isTestFile(file)
+			tests[file] = t
+		}
+		return t
+	}
+
+	for _, def := range o.Defs {
+		if !def.Test && isTest(def.File) {
+			def.Test = true
+		}
+	}
+	for _, ref := range o.Refs {
+		if !ref.Test && isTest(ref.File) {
+			ref.Test = true
+		}
+	}
+}
+
+// markGenerated sets the Generated field of the defs and refs in o
+// that are in generated files (see graph.IsGenerated). Files that
+// can't be read are assumed to not be generated.
+func markGenerated(dir string, o *graph.Output) {
+	generated := map[string]bool{}
+	isGenerated := func(filename string) bool {
+		if filename == "" {
+			return false
+		}
+		if g, present := generated[filename]; present {
+			return g
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, filename))
+		g := err == nil && graph.IsGenerated(filename, data)
+		generated[filename] = g
+		return g
+	}
+
+	for _, def := range o.Defs {
+		if isGenerated(def.File) {
+			def.Generated = true
+		}
+	}
+	for _, ref := range o.Refs {
+		if isGenerated(ref.File) {
+			ref.Generated = true
+		}
+	}
+}
 
-	if unitType != "GoPackage" && unitType != "Dockerfile" && unitType != "BashDirectory" && unitType != "ManPages" {
-		ensureOffsetsAreByteOffsets(dir, o)
+// migrateOutputV0 upgrades graph output written before build data
+// schema versions were recorded (see buildstore.SchemaVersion) by
+// normalizing it as NormalizeData would, except for the steps that
+// require the source files (which may have changed since the output
+// was written). That output may predate the canonical def kinds and
+// visibilities, test file tagging, and canonical form.
+func migrateOutputV0(data []byte) ([]byte, error) {
+	var o graph.Output
+	if err := json.Unmarshal(data, &o); err != nil {
+		return nil, err
 	}
+	MarkTests(&o, graph.IsTestFile)
+	if err := finishOutput(&o); err != nil {
+		return nil, err
+	}
+	return MarshalOutput(&o)
+}
 
+// finishOutput resolves o's ambiguous refs to their top candidates,
+// normalizes o's def kinds and visibilities, validates it, normalizes
+// its docs, and puts it in canonical form.
+func finishOutput(o *graph.Output) error {
+	for _, ref := range o.Refs {
+		ref.SortCandidates()
+	}
 	if err := ValidateRefs(o.Refs); err != nil {
 		return err
 	}
+	for _, def := range o.Defs {
+		def.NormalizeKind()
+		def.NormalizeVisibility()
+	}
 	if err := ValidateDefs(o.Defs); err != nil {
 		return err
 	}
+	o.Docs = docs.Normalize(o.Docs)
 	if err := ValidateDocs(o.Docs); err != nil {
 		return err
 	}
 
+	if err := canonicalizeData(o); err != nil {
+		return err
+	}
+
 	sortedOutput(o)
 	return nil
 }
@@ -0,0 +1,213 @@
+package grapher
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/ann"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestNormalizeData_deterministic(t *testing.T) {
+	// output returns the same graph data, with its elements in the
+	// given order and with Data formatted differently.
+	output := func(reverse bool) *graph.Output {
+		o := &graph.Output{
+			Defs: []*graph.Def{
+				{DefKey: graph.DefKey{Path: "a"}, Data: []byte(`{"x": 1, "b": [true]}`)},
+				{DefKey: graph.DefKey{Path: "b"}, Data: []byte(`{}`)},
+			},
+			Refs: []*graph.Ref{
+				{DefPath: "a", File: "f", Start: 10, End: 11},
+				{DefPath: "a", File: "f", Start: 9, End: 10},
+				{DefPath: "a", File: "f", Start: 9, End: 10, Def: true},
+			},
+			Anns: []*ann.Ann{
+				{File: "f", StartLine: 10, EndLine: 10, Type: "t", Data: []byte(`{"k":2}`)},
+				{File: "f", StartLine: 9, EndLine: 10, Type: "t", Data: []byte(`{"k":1}`)},
+			},
+		}
+		if reverse {
+			o.Defs[0].Data = []byte(`{"b":[true],"x":1}`)
+			for i, j := 0, len(o.Defs)-1; i < j; i, j = i+1, j-1 {
+				o.Defs[i], o.Defs[j] = o.Defs[j], o.Defs[i]
+			}
+			for i, j := 0, len(o.Refs)-1; i < j; i, j = i+1, j-1 {
+				o.Refs[i], o.Refs[j] = o.Refs[j], o.Refs[i]
+			}
+			for i, j := 0, len(o.Anns)-1; i < j; i, j = i+1, j-1 {
+				o.Anns[i], o.Anns[j] = o.Anns[j], o.Anns[i]
+			}
+		}
+		return o
+	}
+
+	var encoded []string
+	for _, reverse := range []bool{false, true} {
+		o := output(reverse)
+		if err := NormalizeData("GoPackage", ".", o); err != nil {
+			t.Fatal(err)
+		}
+		data, err := MarshalOutput(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded = append(encoded, string(data))
+
+		if got, want := string(o.Defs[0].Data), `{"b":[true],"x":1}`; got != want {
+			t.Errorf("got def Data %s, want %s", got, want)
+		}
+		if o.Refs[0].Start != 9 || o.Refs[0].Def || !o.Refs[1].Def || o.Refs[2].Start != 10 {
+			t.Errorf("refs not sorted by offset and Def flag: %+v %+v %+v", o.Refs[0], o.Refs[1], o.Refs[2])
+		}
+		if o.Anns[0].StartLine != 9 {
+			t.Errorf("anns not sorted by line: got first StartLine %d, want 9", o.Anns[0].StartLine)
+		}
+	}
+	if encoded[0] != encoded[1] {
+		t.Errorf("normalized output differs with input order\n%s\n\nvs.\n\n%s", encoded[0], encoded[1])
+	}
+}
+
+func TestNormalizeData_generated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-generated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.go"), []byte("package a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "a_string.go"), []byte("// Code generated by stringer; DO NOT EDIT.\n\npackage a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	o := &graph.Output{
+		Defs: []*graph.Def{
+			{DefKey: graph.DefKey{Path: "A"}, File: "a.go"},
+			{DefKey: graph.DefKey{Path: "String"}, File: "a_string.go"},
+		},
+		Refs: []*graph.Ref{
+			{DefPath: "A", File: "a.go"},
+			{DefPath: "A", File: "a_string.go", Start: 1},
+		},
+	}
+	if err := NormalizeData("GoPackage", dir, o); err != nil {
+		t.Fatal(err)
+	}
+	if o.Defs[0].Generated || !o.Defs[1].Generated {
+		t.Errorf("got def Generated %v %v, want false true", o.Defs[0].Generated, o.Defs[1].Generated)
+	}
+	if o.Refs[0].Generated || !o.Refs[1].Generated {
+		t.Errorf("got ref Generated %v %v, want false true", o.Refs[0].Generated, o.Refs[1].Generated)
+	}
+}
+
+func TestNormalizeData_nonASCIIFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-non-ascii")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "données"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "données", "日本.py"), []byte("x = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	o := &graph.Output{
+		Defs: []*graph.Def{
+			{DefKey: graph.DefKey{Path: "données/日本/x"}, Name: "x", File: "./données/日本.py"},
+		},
+		Refs: []*graph.Ref{
+			{DefPath: "données/日本/x", File: "donn%C3%A9es/%E6%97%A5%E6%9C%AC.py", Start: 0, End: 1},
+		},
+	}
+	if err := NormalizeData("t", dir, o); err != nil {
+		t.Fatal(err)
+	}
+	const want = "données/日本.py"
+	if got := o.Defs[0].File; got != want {
+		t.Errorf("got def file %q, want %q", got, want)
+	}
+	if got := o.Refs[0].File; got != want {
+		t.Errorf("got ref file %q, want %q", got, want)
+	}
+	if got := o.Refs[0].DefPath; got != o.Defs[0].Path {
+		t.Errorf("got ref def path %q, want %q (unchanged)", got, o.Defs[0].Path)
+	}
+}
+
+func TestNormalizeData_aliases(t *testing.T) {
+	o := &graph.Output{
+		Defs: []*graph.Def{
+			{DefKey: graph.DefKey{UnitType: "t", Unit: "u", Path: "x/y"}},
+			{DefKey: graph.DefKey{UnitType: "t", Unit: "u", Path: "z/y"}, AliasOf: &graph.DefKey{Path: "x/y"}},
+		},
+	}
+	if err := NormalizeData("t", ".", o); err != nil {
+		t.Fatal(err)
+	}
+	want := graph.DefKey{UnitType: "t", Unit: "u", Path: "x/y"}
+	if got := o.Defs[1].AliasOf; got == nil || *got != want {
+		t.Errorf("got AliasOf %+v, want %+v", got, want)
+	}
+
+	o.Defs[1].AliasOf = &graph.DefKey{}
+	if err := NormalizeData("t", ".", o); err == nil {
+		t.Error("got no error for alias with empty path, want error")
+	}
+}
+
+func TestMarkTests(t *testing.T) {
+	o := &graph.Output{
+		Defs: []*graph.Def{
+			{DefKey: graph.DefKey{Path: "A"}, File: "a.go"},
+			{DefKey: graph.DefKey{Path: "TestA"}, File: "a_test.go"},
+			{DefKey: graph.DefKey{Path: "B"}, File: "b.go", Test: true},
+		},
+		Refs: []*graph.Ref{
+			{DefPath: "A", File: "a.go"},
+			{DefPath: "A", File: "a_test.go"},
+		},
+	}
+	MarkTests(o, graph.IsTestFile)
+	if o.Defs[0].Test || !o.Defs[1].Test || !o.Defs[2].Test {
+		t.Errorf("got def Test %v %v %v, want false true true", o.Defs[0].Test, o.Defs[1].Test, o.Defs[2].Test)
+	}
+	if o.Refs[0].Test || !o.Refs[1].Test {
+		t.Errorf("got ref Test %v %v, want false true", o.Refs[0].Test, o.Refs[1].Test)
+	}
+}
+
+func TestMigrateOutputV0(t *testing.T) {
+	data, err := migrateOutputV0([]byte(`{"Defs": [{"Path": "B", "Kind": "function", "File": "b_test.go"}, {"Path": "A", "Kind": "func", "File": "a.go", "Data": {"y": 1, "x": 2}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var o graph.Output
+	if err := json.Unmarshal(data, &o); err != nil {
+		t.Fatal(err)
+	}
+	if len(o.Defs) != 2 || o.Defs[0].Path != "A" || o.Defs[1].Path != "B" {
+		t.Fatalf("got defs %+v, want A and B in order", o.Defs)
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, o.Defs[0].Data); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), `{"x":2,"y":1}`; got != want {
+		t.Errorf("got Data %s, want %s", got, want)
+	}
+	if !o.Defs[1].Test {
+		t.Error("got def in test file not marked Test")
+	}
+	if _, err := migrateOutputV0([]byte(`{`)); err == nil {
+		t.Error("got no error migrating invalid JSON")
+	}
+}
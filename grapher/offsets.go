@@ -0,0 +1,316 @@
+package grapher
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"unicode"
+	"unicode/utf8"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+)
+
+// OffsetUnit is the unit of the offsets (Def.DefStart and DefEnd,
+// Ref.Start and End, and Doc.Start and End) in a toolchain's graph
+// output.
+//
+// The offsets in graph data are byte offsets in the files as they are
+// stored, so that a def's or ref's range can be sliced out of the
+// file's contents. Some toolchains (e.g., those written in languages
+// whose strings are sequences of code points) emit rune offsets
+// instead, which differ from byte offsets after the first non-ASCII
+// character in a file. NormalizeData converts those to byte offsets.
+type OffsetUnit string
+
+const (
+	// ByteOffsets means that the offsets are byte offsets.
+	ByteOffsets OffsetUnit = "bytes"
+
+	// RuneOffsets means that the offsets are rune (Unicode code
+	// point) offsets.
+	RuneOffsets OffsetUnit = "runes"
+
+	// DetectOffsets means that the unit of the offsets is unknown, so
+	// it is detected heuristically for each file that contains
+	// non-ASCII characters: the offsets are interpreted as rune
+	// offsets if, interpreted that way, more of the ranges in the file
+	// are valid and contain the name of their def than if they are
+	// interpreted as byte offsets, and vice versa. If neither
+	// interpretation is more plausible (e.g., because none of the
+	// ranges has a name to check), the default unit for the source
+	// unit's type is used (see defaultOffsetUnit).
+	DetectOffsets OffsetUnit = ""
+)
+
+// ParseOffsetUnit parses the unit of offsets that a toolchain
+// declares in its Srclibtoolchain file (see toolchain.Config's
+// Offsets).
+func ParseOffsetUnit(s string) (OffsetUnit, error) {
+	switch s {
+	case "", "auto":
+		return DetectOffsets, nil
+	case string(ByteOffsets), string(RuneOffsets):
+		return OffsetUnit(s), nil
+	}
+	return "", fmt.Errorf("invalid offsets unit %q (expected %q, %q, or %q)", s, ByteOffsets, RuneOffsets, "auto")
+}
+
+// ToolchainOffsets returns the unit of offsets in the graph output of
+// the toolchain with the given path, as declared in its config. If the
+// toolchain is not installed (e.g., for the built-in tools), it
+// returns DetectOffsets.
+func ToolchainOffsets(toolchainPath string) (OffsetUnit, error) {
+	tc, err := toolchain.Lookup(toolchainPath)
+	if err != nil {
+		return DetectOffsets, nil
+	}
+	c, err := tc.ReadConfig()
+	if err != nil {
+		return "", err
+	}
+	u, err := ParseOffsetUnit(c.Offsets)
+	if err != nil {
+		return "", fmt.Errorf("toolchain %s: %s", toolchainPath, err)
+	}
+	return u, nil
+}
+
+// byteOffsetUnitTypes are the types of source units whose graphers are
+// known to emit byte offsets, so their offsets don't need to be
+// detected.
+var byteOffsetUnitTypes = map[string]struct{}{
+	"GoPackage":     struct{}{},
+	"Dockerfile":    struct{}{},
+	"BashDirectory": struct{}{},
+	"ManPages":      struct{}{},
+}
+
+// defaultOffsetUnit returns the unit of the offsets that the graphers
+// of source units of the given type are assumed to emit when it can't
+// be detected: byte offsets for the built-in tools and for
+// byteOffsetUnitTypes, and rune offsets otherwise (as srclib has always
+// assumed).
+func defaultOffsetUnit(unitType string) OffsetUnit {
+	_, builtin := Builtins[unitType]
+	if _, known := byteOffsetUnitTypes[unitType]; builtin || known {
+		return ByteOffsets
+	}
+	return RuneOffsets
+}
+
+// offsetRange is a range in a file in graph output whose offsets might
+// need to be converted to byte offsets.
+type offsetRange struct {
+	start, end *uint32
+
+	// name is the name that the range is expected to contain, or ""
+	// if unknown.
+	name string
+}
+
+// fileOffsetRanges returns the ranges in o, grouped by file. Refs are
+// expected to contain the names of the defs they point to, if those
+// are in o.
+func fileOffsetRanges(o *graph.Output) map[string][]offsetRange {
+	defNames := map[string]string{}
+	for _, d := range o.Defs {
+		defNames[d.Path] = d.Name
+	}
+	files := map[string][]offsetRange{}
+	add := func(file string, start, end *uint32, name string) {
+		if file != "" {
+			files[file] = append(files[file], offsetRange{start: start, end: end, name: name})
+		}
+	}
+	for _, d := range o.Defs {
+		add(d.File, &d.DefStart, &d.DefEnd, d.Name)
+	}
+	for _, r := range o.Refs {
+		var name string
+		if r.DefRepo == "" && r.DefUnitType == "" && r.DefUnit == "" {
+			name = defNames[r.DefPath]
+		}
+		add(r.File, &r.Start, &r.End, name)
+	}
+	for _, d := range o.Docs {
+		add(d.File, &d.Start, &d.End, "")
+	}
+	return files
+}
+
+// ensureByteOffsets converts the offsets in o, whose files are
+// relative to dir, to byte offsets if they are in the given unit (or
+// were detected to be rune offsets). If unit is DetectOffsets and the
+// unit of a file's offsets can't be detected, they are assumed to be
+// in the unit fallback.
+func ensureByteOffsets(dir string, unit, fallback OffsetUnit, o *graph.Output) {
+	if unit == ByteOffsets {
+		return
+	}
+	for file, ranges := range fileOffsetRanges(o) {
+		filename := filepath.Join(dir, file)
+		if fi, err := os.Stat(filename); err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			log.Printf("Warning: couldn't read %s to convert its offsets to byte offsets: %s.", filename, err)
+			continue
+		}
+		if isASCII(data) {
+			continue // byte and rune offsets are the same
+		}
+
+		runeStarts := runeByteOffsets(data)
+		if unit == DetectOffsets {
+			detected := detectOffsetUnit(data, runeStarts, ranges)
+			if detected == DetectOffsets {
+				detected = fallback
+			}
+			if detected != RuneOffsets {
+				continue
+			}
+		}
+		var bad int
+		for _, r := range ranges {
+			for _, offset := range []*uint32{r.start, r.end} {
+				if int(*offset) >= len(runeStarts) {
+					bad++
+					continue
+				}
+				*offset = uint32(runeStarts[*offset])
+			}
+		}
+		if bad > 0 {
+			log.Printf("Warning: %d rune offsets in %s are past the end of the file (did the grapher emit nonexistent offsets?); leaving them unchanged.", bad, filename)
+		}
+	}
+}
+
+// detectOffsetUnit returns whether the offsets of the ranges in the
+// file whose contents are data are more plausibly byte offsets or rune
+// offsets, or DetectOffsets if they are equally plausible. A range is
+// plausible if it is within the file and starts and ends on character
+// boundaries, and more so if it contains its expected name. runeStarts
+// are the byte offsets of data's runes (see runeByteOffsets).
+func detectOffsetUnit(data []byte, runeStarts []int, ranges []offsetRange) OffsetUnit {
+	score := func(start, end int, name string) int {
+		if start > end || end > len(data) || !isRuneBoundary(data, start) || !isRuneBoundary(data, end) {
+			return 0
+		}
+		if name != "" && bytes.Contains(data[start:end], []byte(name)) {
+			return 2
+		}
+		return 1
+	}
+	var byteScore, runeScore int
+	for _, r := range ranges {
+		start, end := int(*r.start), int(*r.end)
+		byteScore += score(start, end, r.name)
+		if start < len(runeStarts) && end < len(runeStarts) {
+			runeScore += score(runeStarts[start], runeStarts[end], r.name)
+		}
+	}
+	switch {
+	case runeScore > byteScore:
+		return RuneOffsets
+	case byteScore > runeScore:
+		return ByteOffsets
+	}
+	return DetectOffsets
+}
+
+// runeByteOffsets returns the byte offset in data of each rune in data,
+// followed by len(data), so that the byte offset of the rune offset i
+// is the i'th element.
+func runeByteOffsets(data []byte) []int {
+	offsets := make([]int, 0, utf8.RuneCount(data)+1)
+	for i := 0; i < len(data); {
+		offsets = append(offsets, i)
+		_, size := utf8.DecodeRune(data[i:])
+		i += size
+	}
+	return append(offsets, len(data))
+}
+
+// isRuneBoundary reports whether the byte offset i in data is at the
+// start of a rune (or the end of data).
+func isRuneBoundary(data []byte, i int) bool {
+	return i == len(data) || utf8.RuneStart(data[i])
+}
+
+func isASCII(data []byte) bool {
+	for _, b := range data {
+		if b >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// VerifyOffsets checks that the offsets in o, whose files are
+// relative to dir, are byte offsets: that each def's, ref's, and doc's
+// range is within its file and starts and ends on UTF-8 character
+// boundaries, and that each def's range contains the def's name (if
+// the name is an identifier, which the range would be expected to
+// contain). Ranges whose offsets are both 0 are unset and are not
+// checked, nor are ranges in files that don't exist.
+func VerifyOffsets(dir string, o *graph.Output) (errs MultiError) {
+	files := map[string][]byte{}
+	readFile := func(file string) []byte {
+		if data, present := files[file]; present {
+			return data
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+		files[file] = data
+		return data
+	}
+
+	check := func(label, file string, start, end uint32, name string) {
+		if file == "" || (start == 0 && end == 0) {
+			return
+		}
+		data := readFile(file)
+		if data == nil {
+			return
+		}
+		switch {
+		case start > end:
+			errs = append(errs, fmt.Errorf("%s: range %d-%d in %s starts after it ends", label, start, end, file))
+		case int(end) > len(data):
+			errs = append(errs, fmt.Errorf("%s: range %d-%d is past the end of %s (%d bytes)", label, start, end, file, len(data)))
+		case !isRuneBoundary(data, int(start)) || !isRuneBoundary(data, int(end)):
+			errs = append(errs, fmt.Errorf("%s: range %d-%d in %s is not on UTF-8 character boundaries (are the offsets rune offsets instead of byte offsets?)", label, start, end, file))
+		case name != "" && isIdent(name) && !bytes.Contains(data[start:end], []byte(name)):
+			errs = append(errs, fmt.Errorf("%s: range %d-%d in %s (%q) doesn't contain the def name %q", label, start, end, file, data[start:end], name))
+		}
+	}
+	for _, d := range o.Defs {
+		check(fmt.Sprintf("def %s", d.Path), d.File, d.DefStart, d.DefEnd, d.Name)
+	}
+	for _, r := range o.Refs {
+		check(fmt.Sprintf("ref to %s", r.DefPath), r.File, r.Start, r.End, "")
+	}
+	for _, d := range o.Docs {
+		check(fmt.Sprintf("doc of %s", d.Path), d.File, d.Start, d.End, "")
+	}
+	return errs
+}
+
+// isIdent reports whether name is an identifier (letters, digits, and
+// underscores), as opposed to, e.g., a qualified or generated name.
+func isIdent(name string) bool {
+	for _, c := range name {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_' {
+			return false
+		}
+	}
+	return name != ""
+}
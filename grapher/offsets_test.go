@@ -0,0 +1,115 @@
+package grapher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// offsetsTestFile is a file whose byte and rune offsets differ after
+// the first line. Its def "b" is at bytes 20-21 and runes 18-19.
+const offsetsTestFile = "a = 'héllo wörld'\nb = a\n"
+
+func writeOffsetsTestFile(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "srclib-offsets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "f.py"), []byte(offsetsTestFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func offsetsTestOutput(bStart, bEnd, refStart, refEnd uint32) *graph.Output {
+	return &graph.Output{
+		Defs: []*graph.Def{
+			{DefKey: graph.DefKey{Path: "a"}, Name: "a", File: "f.py", DefStart: 0, DefEnd: 1},
+			{DefKey: graph.DefKey{Path: "b"}, Name: "b", File: "f.py", DefStart: bStart, DefEnd: bEnd},
+		},
+		Refs: []*graph.Ref{
+			{DefPath: "a", File: "f.py", Start: refStart, End: refEnd},
+		},
+	}
+}
+
+func TestEnsureByteOffsets(t *testing.T) {
+	dir := writeOffsetsTestFile(t)
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		unit OffsetUnit
+		in   *graph.Output
+	}{
+		"detect bytes": {DetectOffsets, offsetsTestOutput(20, 21, 24, 25)},
+		"detect runes": {DetectOffsets, offsetsTestOutput(18, 19, 22, 23)},
+		"runes":        {RuneOffsets, offsetsTestOutput(18, 19, 22, 23)},
+		"bytes":        {ByteOffsets, offsetsTestOutput(20, 21, 24, 25)},
+	}
+	for label, test := range tests {
+		ensureByteOffsets(dir, test.unit, ByteOffsets, test.in)
+		b, ref := test.in.Defs[1], test.in.Refs[0]
+		if b.DefStart != 20 || b.DefEnd != 21 || ref.Start != 24 || ref.End != 25 {
+			t.Errorf("%s: got def range %d-%d and ref range %d-%d, want 20-21 and 24-25", label, b.DefStart, b.DefEnd, ref.Start, ref.End)
+		}
+		if errs := VerifyOffsets(dir, test.in); len(errs) > 0 {
+			t.Errorf("%s: got offset errors %v after conversion", label, errs)
+		}
+	}
+}
+
+func TestEnsureByteOffsets_tie(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-offsets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The ref to "foo" (in another unit, so its range has no name to
+	// check) is at bytes 7-10 and runes 6-9. Both are valid ranges, so
+	// the unit of its offsets is the default for the unit type.
+	if err := ioutil.WriteFile(filepath.Join(dir, "f.py"), []byte("é = 1\nfoo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]struct {
+		unitType           string
+		wantStart, wantEnd uint32
+	}{
+		"runes by default": {"PythonPackage", 7, 10},
+		"known bytes":      {"GoPackage", 6, 9},
+	}
+	for label, test := range tests {
+		o := &graph.Output{Refs: []*graph.Ref{{DefUnitType: "PipPackage", DefUnit: "foo", DefPath: "foo", File: "f.py", Start: 6, End: 9}}}
+		ensureByteOffsets(dir, DetectOffsets, defaultOffsetUnit(test.unitType), o)
+		if r := o.Refs[0]; r.Start != test.wantStart || r.End != test.wantEnd {
+			t.Errorf("%s: got ref range %d-%d, want %d-%d", label, r.Start, r.End, test.wantStart, test.wantEnd)
+		}
+	}
+}
+
+func TestVerifyOffsets(t *testing.T) {
+	dir := writeOffsetsTestFile(t)
+	defer os.RemoveAll(dir)
+
+	o := &graph.Output{
+		Defs: []*graph.Def{
+			{DefKey: graph.DefKey{Path: "a"}, Name: "a", File: "f.py", DefStart: 0, DefEnd: 1},
+			{DefKey: graph.DefKey{Path: "b"}, Name: "b", File: "f.py", DefStart: 18, DefEnd: 19},       // rune offsets
+			{DefKey: graph.DefKey{Path: "c"}, Name: "c", File: "f.py", DefStart: 30, DefEnd: 31},       // past the end
+			{DefKey: graph.DefKey{Path: "(a).x"}, Name: "(a).x", File: "f.py", DefStart: 0, DefEnd: 1}, // not an identifier
+			{DefKey: graph.DefKey{Path: "nofile"}, Name: "d", File: "nonexistent.py", DefStart: 0, DefEnd: 1},
+		},
+		Refs: []*graph.Ref{
+			{DefPath: "a", File: "f.py", Start: 7, End: 8}, // splits "é"
+			{DefPath: "a", File: "f.py", Start: 2, End: 1},
+			{DefPath: "a", File: "f.py"}, // unset
+		},
+	}
+	errs := VerifyOffsets(dir, o)
+	if len(errs) != 4 {
+		t.Errorf("got %d offset errors, want 4: %v", len(errs), errs)
+	}
+}
@@ -0,0 +1,61 @@
+package grapher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+)
+
+// PostProcess runs the graph output o of a source unit through each
+// of the post-processing tools (see config.Tree's
+// GraphPostProcessors) in order and returns the final output.
+//
+// Each tool is run as "PROGRAM SUBCMD" in the current directory, with
+// the graph output JSON on stdin and with the source unit's type and
+// name in the SRCLIB_UNIT_TYPE and SRCLIB_UNIT environment variables.
+// It must write the (possibly filtered or augmented) graph output JSON
+// to stdout.
+//
+// o should already have been normalized with NormalizeData. Each
+// tool's output is validated and put in canonical form again, but its
+// offsets are not converted, so tools must emit byte offsets.
+func PostProcess(tools []*srclib.ToolRef, unitType, unitName string, o *graph.Output) (*graph.Output, error) {
+	for _, t := range tools {
+		cmdName, err := toolchain.Command(t.Toolchain)
+		if err != nil {
+			return nil, fmt.Errorf("graph post-processor %s: %s", t, err)
+		}
+		in, err := json.Marshal(o)
+		if err != nil {
+			return nil, err
+		}
+
+		cmd := exec.Command(cmdName, t.Subcmd)
+		cmd.Env = append(os.Environ(), "SRCLIB_UNIT_TYPE="+unitType, "SRCLIB_UNIT="+unitName)
+		cmd.Stdin = bytes.NewReader(in)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("graph post-processor %s failed on %s %s: %s", t, unitType, unitName, err)
+		}
+
+		var o2 *graph.Output
+		if err := json.Unmarshal(out, &o2); err != nil {
+			return nil, fmt.Errorf("graph post-processor %s emitted invalid graph output for %s %s: %s", t, unitType, unitName, err)
+		}
+		if o2 == nil {
+			o2 = &graph.Output{}
+		}
+		if err := finishOutput(o2); err != nil {
+			return nil, fmt.Errorf("graph post-processor %s emitted invalid graph output for %s %s: %s", t, unitType, unitName, err)
+		}
+		o = o2
+	}
+	return o, nil
+}
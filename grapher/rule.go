@@ -23,27 +23,73 @@ const graphAllOp = "graph-all"
 func init() {
 	plan.RegisterRuleMaker(graphOp, makeGraphRules)
 	plan.RegisterRuleMaker(graphAllOp, makeGraphAllRules)
+	plan.RegisterRuleMaker(stitchOp, makeStitchRules)
 	buildstore.RegisterDataType("graph", &graph.Output{})
+	buildstore.RegisterMigration("graph", 0, migrateOutputV0)
 }
 
 func makeGraphRules(c *config.Tree, dataDir string, existing []makex.Rule) ([]makex.Rule, error) {
-	var rules []makex.Rule
+	if err := checkPostProcessors(c.GraphPostProcessors); err != nil {
+		return nil, err
+	}
+	var units []*unit.SourceUnit
 	for _, u := range c.SourceUnits {
 		// HACK: ensure backward compatibility with old behavior where
 		// we assume we should `graph` if no `graph` op explicitly specified
 		if _, hasGraphAll := u.Ops[graphAllOp]; hasGraphAll {
 			continue
 		}
-		toolRef, err := toolchain.ChooseTool(graphOp, u.Type)
+		units = append(units, u)
+	}
+	deps := unitDeps(units, existing)
+	var rules []makex.Rule
+	for _, u := range units {
+		r, err := newGraphUnitRule(dataDir, u, c.GraphPostProcessors, c.TestFiles, depGraphFiles(dataDir, deps[u.ID2()]))
 		if err != nil {
 			return nil, err
 		}
-		rules = append(rules, &GraphUnitRule{dataDir, u, toolRef})
+		rules = append(rules, r)
 	}
 	return rules, nil
 }
 
+// NewGraphUnitRule returns the rule that graphs u with the installed
+// tool for its type, writing the output to the build data directory
+// dataDir. The other arguments are as in GraphUnitRule. It is used to
+// rebuild a rule from its parts (e.g., by "srclib worker", which
+// is sent the parts and not the recipes).
+func NewGraphUnitRule(dataDir string, u *unit.SourceUnit, postProcessors []*srclib.ToolRef, testFiles, depGraphFiles []string) (*GraphUnitRule, error) {
+	if err := checkPostProcessors(postProcessors); err != nil {
+		return nil, err
+	}
+	return newGraphUnitRule(dataDir, u, postProcessors, testFiles, depGraphFiles)
+}
+
+func newGraphUnitRule(dataDir string, u *unit.SourceUnit, postProcessors []*srclib.ToolRef, testFiles, depGraphFiles []string) (*GraphUnitRule, error) {
+	toolRef, err := chooseGraphTool(u.Type)
+	if err != nil {
+		return nil, err
+	}
+	offsets, err := toolOffsets(toolRef)
+	if err != nil {
+		return nil, err
+	}
+	return &GraphUnitRule{
+		dataDir:        dataDir,
+		Unit:           u,
+		Tool:           toolRef,
+		Offsets:        offsets,
+		PostProcessors: postProcessors,
+		TestFiles:      testFiles,
+		DepGraphFiles:  depGraphFiles,
+	}, nil
+}
+
 func makeGraphAllRules(c *config.Tree, dataDir string, existing []makex.Rule) ([]makex.Rule, error) {
+	if err := checkPostProcessors(c.GraphPostProcessors); err != nil {
+		return nil, err
+	}
+
 	// Group all graph-all units by type.
 	groupedUnits := make(map[string]unit.SourceUnits)
 	for _, u := range c.SourceUnits {
@@ -57,21 +103,103 @@ func makeGraphAllRules(c *config.Tree, dataDir string, existing []makex.Rule) ([
 	// Make a GraphMultiUnitsRule for each group of source units
 	var rules []makex.Rule
 	for unitType, units := range groupedUnits {
-		toolRef, err := toolchain.ChooseTool(graphOp, unitType)
+		toolRef, err := chooseGraphTool(unitType)
+		if err != nil {
+			return nil, err
+		}
+		offsets, err := toolOffsets(toolRef)
 		if err != nil {
 			return nil, err
 		}
-		rules = append(rules, &GraphMultiUnitsRule{dataDir, units, unitType, toolRef})
+		rules = append(rules, &GraphMultiUnitsRule{dataDir, units, unitType, toolRef, offsets, c.GraphPostProcessors, c.TestFiles})
 	}
 	return rules, nil
 }
 
+// checkPostProcessors returns an error if any of the graph
+// post-processing tools' toolchains is not installed.
+func checkPostProcessors(tools []*srclib.ToolRef) error {
+	for _, t := range tools {
+		if _, err := toolchain.Lookup(t.Toolchain); err != nil {
+			return fmt.Errorf("graph post-processor %s: %s", t, err)
+		}
+	}
+	return nil
+}
+
+// postProcessArgs returns the "srclib internal normalize-graph-data"
+// arguments that run the graph output of the named unit (or, if
+// unitName is empty, of each unit) through the post-processors.
+func postProcessArgs(unitName string, tools []*srclib.ToolRef) string {
+	if len(tools) == 0 {
+		return ""
+	}
+	var s string
+	if unitName != "" {
+		s = " --unit " + plan.ShellQuote(unitName)
+	}
+	for _, t := range tools {
+		s += " --post-process " + plan.ShellQuote(t.Toolchain+":"+t.Subcmd)
+	}
+	return s
+}
+
+// toolOffsets returns the unit of the offsets in the graph output of
+// the tool (see ToolchainOffsets).
+func toolOffsets(t *srclib.ToolRef) (OffsetUnit, error) {
+	if t == nil {
+		return DetectOffsets, nil
+	}
+	return ToolchainOffsets(t.Toolchain)
+}
+
+// offsetsArgs returns the "srclib internal normalize-graph-data"
+// arguments that declare the unit of the offsets in the graph output
+// (if it is known).
+func offsetsArgs(offsets OffsetUnit) string {
+	if offsets == DetectOffsets {
+		return ""
+	}
+	return " --offsets " + plan.ShellQuote(string(offsets))
+}
+
+// testFilesArgs returns the "srclib internal normalize-graph-data"
+// arguments that mark the defs and refs in files matching the patterns
+// (see config.Tree's TestFiles) as Test.
+func testFilesArgs(patterns []string) string {
+	var s string
+	for _, p := range patterns {
+		s += " --test-files " + plan.ShellQuote(p)
+	}
+	return s
+}
+
 type GraphUnitRule struct {
 	dataDir string
 	Unit    *unit.SourceUnit
 	Tool    *srclib.ToolRef
+
+	// Offsets is the unit of the offsets in the tool's output (see
+	// toolchain.Config's Offsets).
+	Offsets OffsetUnit
+
+	// PostProcessors are the tools that post-process the unit's
+	// graph output (see config.Tree's GraphPostProcessors).
+	PostProcessors []*srclib.ToolRef
+
+	// TestFiles are the patterns of test files (see config.Tree's
+	// TestFiles).
+	TestFiles []string
+
+	// DepGraphFiles are the graph output files of the units in the
+	// same repository that the unit depends on (see
+	// DepGraphDataEnv). They are built before the unit is graphed.
+	DepGraphFiles []string
 }
 
+// DataDir returns the build data directory that r writes to.
+func (r *GraphUnitRule) DataDir() string { return r.dataDir }
+
 func (r *GraphUnitRule) Target() string {
 	return filepath.ToSlash(filepath.Join(r.dataDir, plan.SourceUnitDataFilename(&graph.Output{}, r.Unit)))
 }
@@ -85,7 +213,7 @@ func (r *GraphUnitRule) Prereqs() []string {
 		}
 		ps = append(ps, file)
 	}
-	return ps
+	return append(ps, r.DepGraphFiles...)
 }
 
 func (r *GraphUnitRule) Recipes() []string {
@@ -94,7 +222,7 @@ func (r *GraphUnitRule) Recipes() []string {
 	}
 	safeCommand := util.SafeCommandName(srclib.CommandName)
 	return []string{
-		fmt.Sprintf("%s tool %q %q < $< | %s internal normalize-graph-data --unit-type %q --dir . 1> $@", safeCommand, r.Tool.Toolchain, r.Tool.Subcmd, safeCommand, r.Unit.Type),
+		fmt.Sprintf("%s tool%s%s%s %s %s < $< | %s internal normalize-graph-data --unit-type %s --dir .%s%s%s 1> $@", safeCommand, plan.EnvArgs(r.Unit), depGraphDataArgs(r.DepGraphFiles), plan.LogArgs(r.dataDir, graphOp, r.Unit), plan.ShellQuote(r.Tool.Toolchain), plan.ShellQuote(r.Tool.Subcmd), safeCommand, plan.ShellQuote(r.Unit.Type), offsetsArgs(r.Offsets), testFilesArgs(r.TestFiles), postProcessArgs(r.Unit.Name, r.PostProcessors)),
 	}
 }
 
@@ -103,6 +231,18 @@ type GraphMultiUnitsRule struct {
 	Units     unit.SourceUnits
 	UnitsType string
 	Tool      *srclib.ToolRef
+
+	// Offsets is the unit of the offsets in the tool's output (see
+	// toolchain.Config's Offsets).
+	Offsets OffsetUnit
+
+	// PostProcessors are the tools that post-process each unit's
+	// graph output (see config.Tree's GraphPostProcessors).
+	PostProcessors []*srclib.ToolRef
+
+	// TestFiles are the patterns of test files (see config.Tree's
+	// TestFiles).
+	TestFiles []string
 }
 
 func (r *GraphMultiUnitsRule) Target() string {
@@ -152,6 +292,6 @@ func (r *GraphMultiUnitsRule) Recipes() []string {
 		findCmd = "/usr/bin/find"
 	}
 	return []string{
-		fmt.Sprintf(`%s %s -name "*%s.unit.json" | xargs %s internal emit-unit-data  | %s tool %q %q | %s internal normalize-graph-data --unit-type %q --dir . --multi --data-dir %s`, findCmd, filepath.ToSlash(r.dataDir), r.UnitsType, safeCommand, safeCommand, r.Tool.Toolchain, r.Tool.Subcmd, safeCommand, r.UnitsType, filepath.ToSlash(r.dataDir)),
+		fmt.Sprintf(`%s %s -name "*%s.unit.json" | xargs %s internal emit-unit-data  | %s tool%s %s %s | %s internal normalize-graph-data --unit-type %s --dir . --multi --data-dir %s%s%s%s`, findCmd, filepath.ToSlash(r.dataDir), r.UnitsType, safeCommand, safeCommand, plan.LogArgs(r.dataDir, graphAllOp, &unit.SourceUnit{Key: unit.Key{Type: r.UnitsType}}), plan.ShellQuote(r.Tool.Toolchain), plan.ShellQuote(r.Tool.Subcmd), safeCommand, plan.ShellQuote(r.UnitsType), filepath.ToSlash(r.dataDir), offsetsArgs(r.Offsets), testFilesArgs(r.TestFiles), postProcessArgs("", r.PostProcessors)),
 	}
 }
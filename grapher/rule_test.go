@@ -0,0 +1,56 @@
+package grapher
+
+import (
+	"strings"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestGraphUnitRule_PostProcessors(t *testing.T) {
+	r := &GraphUnitRule{
+		dataDir: "d",
+		Unit:    &unit.SourceUnit{Key: unit.Key{Name: "n", Type: "t"}},
+		Tool:    &srclib.ToolRef{Toolchain: "tc", Subcmd: "graph"},
+	}
+	if recipe := r.Recipes()[0]; strings.Contains(recipe, "--post-process") || strings.Contains(recipe, "--unit ") {
+		t.Errorf("got recipe %q, want no post-processing args", recipe)
+	}
+
+	r.PostProcessors = []*srclib.ToolRef{{Toolchain: "pp1", Subcmd: "a"}, {Toolchain: "pp2", Subcmd: "b"}}
+	want := `normalize-graph-data --unit-type "t" --dir . --unit "n" --post-process "pp1:a" --post-process "pp2:b" 1> $@`
+	if recipe := r.Recipes()[0]; !strings.HasSuffix(recipe, want) {
+		t.Errorf("got recipe %q, want suffix %q", recipe, want)
+	}
+}
+
+func TestGraphUnitRule_TestFiles(t *testing.T) {
+	r := &GraphUnitRule{
+		dataDir:   "d",
+		Unit:      &unit.SourceUnit{Key: unit.Key{Name: "n", Type: "t"}},
+		Tool:      &srclib.ToolRef{Toolchain: "tc", Subcmd: "graph"},
+		TestFiles: []string{"it/*", "*_check.go"},
+	}
+	want := `normalize-graph-data --unit-type "t" --dir . --test-files "it/*" --test-files "*_check.go" 1> $@`
+	if recipe := r.Recipes()[0]; !strings.HasSuffix(recipe, want) {
+		t.Errorf("got recipe %q, want suffix %q", recipe, want)
+	}
+}
+
+func TestGraphUnitRule_Offsets(t *testing.T) {
+	r := &GraphUnitRule{
+		dataDir: "d",
+		Unit:    &unit.SourceUnit{Key: unit.Key{Name: "n", Type: "t"}},
+		Tool:    &srclib.ToolRef{Toolchain: "tc", Subcmd: "graph"},
+	}
+	if recipe := r.Recipes()[0]; strings.Contains(recipe, "--offsets") {
+		t.Errorf("got recipe %q, want no offsets arg (detected)", recipe)
+	}
+
+	r.Offsets = RuneOffsets
+	want := `normalize-graph-data --unit-type "t" --dir . --offsets "runes" 1> $@`
+	if recipe := r.Recipes()[0]; !strings.HasSuffix(recipe, want) {
+		t.Errorf("got recipe %q, want suffix %q", recipe, want)
+	}
+}
@@ -0,0 +1,169 @@
+package grapher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+
+	"sourcegraph.com/sourcegraph/makex"
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+	"sourcegraph.com/sourcegraph/srclib/util"
+)
+
+const stitchOp = "stitch"
+
+// StitchedRefsFilename is the name of the file, in a commit's build
+// data directory, that holds the refs emitted by the stitchers (see
+// Stitch). They are imported along with the graph data of the source
+// units they belong to.
+const StitchedRefsFilename = "stitched_refs.json"
+
+// A StitchUnit is the graph data of a source unit that is given to
+// stitchers.
+type StitchUnit struct {
+	Unit *unit.SourceUnit
+	Defs []*graph.Def
+}
+
+// Stitch runs each of the stitchers (see config.Tree's Stitchers) on
+// the graph data of units and returns the refs they emit, sorted.
+//
+// Each stitcher is run as "PROGRAM SUBCMD" in the current directory
+// (the root of the repository, so that it can read IDL files), with a
+// JSON array of StitchUnits on stdin. It must write a JSON array of
+// refs to stdout. Each ref must be in one of units (its UnitType and
+// Unit must be set) and refer to a def by its DefUnitType, DefUnit,
+// and DefPath (and, for defs in other repositories, DefRepo). Offsets
+// are byte offsets.
+func Stitch(tools []*srclib.ToolRef, units []*StitchUnit) ([]*graph.Ref, error) {
+	if len(tools) == 0 {
+		return nil, nil
+	}
+	in, err := json.Marshal(units)
+	if err != nil {
+		return nil, err
+	}
+	var refs []*graph.Ref
+	for _, t := range tools {
+		cmdName, err := toolchain.Command(t.Toolchain)
+		if err != nil {
+			return nil, fmt.Errorf("stitcher %s: %s", t, err)
+		}
+		cmd := exec.Command(cmdName, t.Subcmd)
+		cmd.Stdin = bytes.NewReader(in)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("stitcher %s failed: %s", t, err)
+		}
+
+		var refs2 []*graph.Ref
+		if err := json.Unmarshal(out, &refs2); err != nil {
+			return nil, fmt.Errorf("stitcher %s emitted invalid refs: %s", t, err)
+		}
+		if err := checkStitchedRefs(units, refs2); err != nil {
+			return nil, fmt.Errorf("stitcher %s emitted invalid refs: %s", t, err)
+		}
+		refs = append(refs, refs2...)
+	}
+	refs = graph.DedupRefs(refs)
+	sort.Sort(graph.Refs(refs))
+	return refs, nil
+}
+
+// checkStitchedRefs returns an error if any of refs isn't in one of
+// units or doesn't refer to a def.
+func checkStitchedRefs(units []*StitchUnit, refs []*graph.Ref) error {
+	known := make(map[unit.ID2]struct{}, len(units))
+	for _, u := range units {
+		known[u.Unit.ID2()] = struct{}{}
+	}
+	for _, ref := range refs {
+		if ref == nil {
+			return fmt.Errorf("null ref")
+		}
+		if _, ok := known[unit.ID2{Type: ref.UnitType, Name: ref.Unit}]; !ok {
+			return fmt.Errorf("ref at %s:%d-%d is in unknown source unit %s %s", ref.File, ref.Start, ref.End, ref.UnitType, ref.Unit)
+		}
+		if ref.File == "" {
+			return fmt.Errorf("ref to %s in source unit %s %s has no file", ref.DefPath, ref.UnitType, ref.Unit)
+		}
+		if ref.Start > ref.End {
+			return fmt.Errorf("ref at %s:%d-%d has start after end", ref.File, ref.Start, ref.End)
+		}
+		if ref.DefUnitType == "" || ref.DefUnit == "" || ref.DefPath == "" {
+			return fmt.Errorf("ref at %s:%d-%d doesn't specify a def (DefUnitType, DefUnit, and DefPath are required)", ref.File, ref.Start, ref.End)
+		}
+		if err := graph.ValidDefPath(ref.DefPath); err != nil {
+			return err
+		}
+		ref.File = graph.CleanFile(ref.File)
+	}
+	return nil
+}
+
+func makeStitchRules(c *config.Tree, dataDir string, existing []makex.Rule) ([]makex.Rule, error) {
+	if len(c.Stitchers) == 0 {
+		return nil, nil
+	}
+	for _, t := range c.Stitchers {
+		if _, err := toolchain.Lookup(t.Toolchain); err != nil {
+			return nil, fmt.Errorf("stitcher %s: %s", t, err)
+		}
+	}
+
+	// The stitchers run after all source units are graphed.
+	var graphFiles []string
+	for _, rule := range existing {
+		switch rule := rule.(type) {
+		case *GraphUnitRule:
+			graphFiles = append(graphFiles, rule.Target())
+		case *GraphMultiUnitsRule:
+			for target := range rule.Targets() {
+				graphFiles = append(graphFiles, target)
+			}
+		}
+	}
+	if len(graphFiles) == 0 {
+		return nil, nil
+	}
+	sort.Strings(graphFiles)
+	return []makex.Rule{&StitchRule{dataDir, graphFiles, c.Stitchers}}, nil
+}
+
+type StitchRule struct {
+	dataDir string
+
+	// GraphFiles are the graph output files of the source units.
+	GraphFiles []string
+
+	// Stitchers are the tools that emit refs across source units (see
+	// config.Tree's Stitchers).
+	Stitchers []*srclib.ToolRef
+}
+
+func (r *StitchRule) Target() string {
+	return filepath.ToSlash(filepath.Join(r.dataDir, StitchedRefsFilename))
+}
+
+func (r *StitchRule) Prereqs() []string { return r.GraphFiles }
+
+func (r *StitchRule) Recipes() []string {
+	safeCommand := util.SafeCommandName(srclib.CommandName)
+	var args string
+	for _, t := range r.Stitchers {
+		args += " --stitcher " + plan.ShellQuote(t.Toolchain+":"+t.Subcmd)
+	}
+	return []string{
+		fmt.Sprintf("%s internal stitch --data-dir %s%s 1> $@", safeCommand, filepath.ToSlash(r.dataDir), args),
+	}
+}
@@ -0,0 +1,50 @@
+package grapher
+
+import (
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestCheckStitchedRefs(t *testing.T) {
+	units := []*StitchUnit{
+		{Unit: &unit.SourceUnit{Key: unit.Key{Type: "GoPackage", Name: "example.com/api/client"}}},
+		{Unit: &unit.SourceUnit{Key: unit.Key{Type: "ProtoPackage", Name: "api"}}},
+	}
+	ref := func() *graph.Ref {
+		return &graph.Ref{
+			UnitType:    "GoPackage",
+			Unit:        "example.com/api/client",
+			File:        "./client/api.pb.go",
+			Start:       10,
+			End:         20,
+			DefUnitType: "ProtoPackage",
+			DefUnit:     "api",
+			DefPath:     "Greeter/SayHello",
+		}
+	}
+
+	refs := []*graph.Ref{ref()}
+	if err := checkStitchedRefs(units, refs); err != nil {
+		t.Fatal(err)
+	}
+	if want := "client/api.pb.go"; refs[0].File != want {
+		t.Errorf("got File %q, want %q", refs[0].File, want)
+	}
+
+	tests := map[string]func(r *graph.Ref){
+		"unknown unit": func(r *graph.Ref) { r.Unit = "other" },
+		"no file":      func(r *graph.Ref) { r.File = "" },
+		"bad offsets":  func(r *graph.Ref) { r.Start = 30 },
+		"no def":       func(r *graph.Ref) { r.DefPath = "" },
+		"bad def path": func(r *graph.Ref) { r.DefPath = "a\x00b" },
+	}
+	for label, modify := range tests {
+		r := ref()
+		modify(r)
+		if err := checkStitchedRefs(units, []*graph.Ref{r}); err == nil {
+			t.Errorf("%s: got nil err, want validation error", label)
+		}
+	}
+}
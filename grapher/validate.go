@@ -17,6 +17,12 @@ func ValidateRefs(refs []*graph.Ref) (errs MultiError) {
 		} else {
 			refKeys[key] = struct{}{}
 		}
+		if err := graph.ValidDefPath(ref.DefPath); err != nil {
+			errs = append(errs, fmt.Errorf("ref %+v: %s", key, err))
+		}
+		if err := ref.ValidCandidates(); err != nil {
+			errs = append(errs, fmt.Errorf("ref %+v: %s", key, err))
+		}
 	}
 	return
 }
@@ -30,6 +36,12 @@ func ValidateDefs(defs []*graph.Def) (errs MultiError) {
 		} else {
 			defKeys[key] = struct{}{}
 		}
+		if err := graph.ValidDefPath(key.Path); err != nil {
+			errs = append(errs, fmt.Errorf("def %+v: %s", key, err))
+		}
+		if !graph.IsValidVisibility(def.Visibility) {
+			errs = append(errs, fmt.Errorf("def %+v has invalid visibility %q (expected %q, %q, %q, or %q)", key, def.Visibility, graph.VisibilityPublic, graph.VisibilityProtected, graph.VisibilityInternal, graph.VisibilityPrivate))
+		}
 	}
 	return
 }
@@ -113,18 +125,9 @@ func PopulateImpliedFields(repo, commitID, unitType, unit string, o *graph.Outpu
 		ref.Unit = unit
 		ref.CommitID = commitID
 
-		// Treat an empty repository URI as referring to the current
-		// repository.
-		if ref.DefRepo == "" {
-			ref.DefRepo = repo
-			if ref.DefUnit == "" {
-				ref.DefUnitType = unitType
-				ref.DefUnit = unit
-			}
-		}
-		if ref.DefUnitType == "" {
-			// default DefUnitType to same unit type as the ref itself
-			ref.DefUnitType = unitType
+		populateImpliedDefKey(repo, unitType, unit, &ref.DefRepo, &ref.DefUnitType, &ref.DefUnit)
+		for _, c := range ref.Candidates {
+			populateImpliedDefKey(repo, unitType, unit, &c.DefRepo, &c.DefUnitType, &c.DefUnit)
 		}
 	}
 	for _, doc := range o.Docs {
@@ -141,3 +144,21 @@ func PopulateImpliedFields(repo, commitID, unitType, unit string, o *graph.Outpu
 		ann.CommitID = commitID
 	}
 }
+
+// populateImpliedDefKey fills in the def key fields of a ref (or ref
+// candidate) in the given source unit that the grapher left blank.
+func populateImpliedDefKey(repo, unitType, unit string, defRepo, defUnitType, defUnit *string) {
+	// Treat an empty repository URI as referring to the current
+	// repository.
+	if *defRepo == "" {
+		*defRepo = repo
+		if *defUnit == "" {
+			*defUnitType = unitType
+			*defUnit = unit
+		}
+	}
+	if *defUnitType == "" {
+		// default DefUnitType to same unit type as the ref itself
+		*defUnitType = unitType
+	}
+}
@@ -46,3 +46,30 @@ func TestValidateDocs_dup(t *testing.T) {
 		t.Fatalf("got nil err, want validation error")
 	}
 }
+
+func TestValidateDefs_visibility(t *testing.T) {
+	defs := []*graph.Def{
+		{DefKey: graph.DefKey{Path: "p"}, Visibility: graph.VisibilityPublic},
+		{DefKey: graph.DefKey{Path: "p2"}},
+	}
+	if err := ValidateDefs(defs); err != nil {
+		t.Fatal(err)
+	}
+
+	defs = append(defs, &graph.Def{DefKey: graph.DefKey{Path: "p3"}, Visibility: "bogus"})
+	if err := ValidateDefs(defs); err == nil {
+		t.Fatalf("got nil err, want validation error")
+	}
+}
+
+func TestValidateDefs_path(t *testing.T) {
+	defs := []*graph.Def{{DefKey: graph.DefKey{Path: "Straße/größe"}}}
+	if err := ValidateDefs(defs); err != nil {
+		t.Fatal(err)
+	}
+
+	defs = append(defs, &graph.Def{DefKey: graph.DefKey{Path: "p\xff"}})
+	if err := ValidateDefs(defs); err == nil {
+		t.Fatalf("got nil err, want validation error")
+	}
+}
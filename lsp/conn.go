@@ -0,0 +1,143 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A Conn is a client connection to a language server. It speaks
+// JSON-RPC 2.0 with the base protocol's Content-Length framing.
+//
+// Calls are synchronous: Call sends a request and reads messages
+// until the response arrives. Notifications from the server (such as
+// diagnostics) are discarded, and requests from the server (such as
+// workspace/configuration) are answered with empty results.
+type Conn struct {
+	rw io.ReadWriter
+	r  *textproto.Reader
+
+	mu  sync.Mutex // serializes calls
+	seq int64
+}
+
+// NewConn returns a connection to the language server that reads
+// messages from and writes messages to rw.
+func NewConn(rw io.ReadWriter) *Conn {
+	return &Conn{rw: rw, r: textproto.NewReader(bufio.NewReader(rw))}
+}
+
+// ResponseError is an error returned by the server.
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("language server error %d: %s", e.Code, e.Message)
+}
+
+// message is any JSON-RPC 2.0 message: a request (with an ID and a
+// method), a notification (with a method and no ID), or a response
+// (with an ID and no method).
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  *json.RawMessage `json:"params,omitempty"`
+	Result  *json.RawMessage `json:"result,omitempty"`
+	Error   *ResponseError   `json:"error,omitempty"`
+}
+
+// Call sends a request and stores the result of its response in
+// result (unless result is nil).
+func (c *Conn) Call(method string, params, result interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seq++
+	id := json.RawMessage(strconv.FormatInt(c.seq, 10))
+	if err := c.write(map[string]interface{}{"jsonrpc": "2.0", "id": &id, "method": method, "params": params}); err != nil {
+		return err
+	}
+	for {
+		m, err := c.read()
+		if err != nil {
+			return fmt.Errorf("%s: %s", method, err)
+		}
+		switch {
+		case m.ID != nil && m.Method != "":
+			if err := c.replyToServer(m); err != nil {
+				return err
+			}
+		case m.ID != nil && string(*m.ID) == string(id):
+			if m.Error != nil {
+				return fmt.Errorf("%s: %s", method, m.Error)
+			}
+			if result == nil || m.Result == nil {
+				return nil
+			}
+			return json.Unmarshal(*m.Result, result)
+		}
+	}
+}
+
+// Notify sends a notification.
+func (c *Conn) Notify(method string, params interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.write(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// replyToServer answers a request from the server. The client has no
+// configuration and doesn't report progress, so every request gets an
+// empty result.
+func (c *Conn) replyToServer(m *message) error {
+	var result interface{}
+	if m.Method == "workspace/configuration" && m.Params != nil {
+		// The result must have an element for each requested item.
+		var params struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		json.Unmarshal(*m.Params, &params)
+		result = make([]interface{}, len(params.Items))
+	}
+	return c.write(map[string]interface{}{"jsonrpc": "2.0", "id": m.ID, "result": result})
+}
+
+func (c *Conn) write(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(c.rw, "Content-Length: %d\r\n\r\n", len(data)); err != nil {
+		return err
+	}
+	_, err = c.rw.Write(data)
+	return err
+}
+
+func (c *Conn) read() (*message, error) {
+	header, err := c.r.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(header.Get("Content-Length")))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid Content-Length header %q", header.Get("Content-Length"))
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(c.r.R, data); err != nil {
+		return nil, err
+	}
+	var m message
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
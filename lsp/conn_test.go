@@ -0,0 +1,106 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/textproto"
+	"reflect"
+	"testing"
+)
+
+// fakeServer is a language server that answers each request with the
+// result returned by handle. Before each response, it sends the
+// messages in before (e.g., notifications or requests to the client).
+type fakeServer struct {
+	handle func(method string, params json.RawMessage) interface{}
+	before []map[string]interface{}
+
+	replies chan *message // responses from the client to its requests
+}
+
+// start serves a connection on conn until it is closed.
+func (s *fakeServer) start(t *testing.T, conn net.Conn) {
+	c := &Conn{rw: conn, r: textproto.NewReader(bufio.NewReader(conn))}
+
+	// Read messages concurrently with writing responses, as a real
+	// server does, so that the client can reply to the server's
+	// requests (over the unbuffered pipe) while a response is written.
+	msgs := make(chan *message, 10)
+	go func() {
+		defer close(msgs)
+		for {
+			m, err := c.read()
+			if err != nil {
+				return
+			}
+			if m.Method == "" {
+				if s.replies != nil {
+					s.replies <- m
+				}
+				continue
+			}
+			msgs <- m
+		}
+	}()
+
+	go func() {
+		for m := range msgs {
+			if m.ID == nil {
+				continue // notification
+			}
+			for _, b := range s.before {
+				if err := c.write(b); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+			var params json.RawMessage
+			if m.Params != nil {
+				params = *m.Params
+			}
+			if err := c.write(map[string]interface{}{"jsonrpc": "2.0", "id": m.ID, "result": s.handle(m.Method, params)}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+}
+
+func TestConn_Call(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	s := &fakeServer{
+		replies: make(chan *message, 2),
+		handle: func(method string, params json.RawMessage) interface{} {
+			return map[string]interface{}{"method": method, "params": params}
+		},
+		before: []map[string]interface{}{
+			{"jsonrpc": "2.0", "method": "window/logMessage", "params": map[string]interface{}{"message": "hi"}},
+			{"jsonrpc": "2.0", "id": "s1", "method": "workspace/configuration", "params": map[string]interface{}{"items": []interface{}{1, 2}}},
+		},
+	}
+	s.start(t, server)
+
+	c := NewConn(client)
+	for i := 0; i < 2; i++ {
+		var res struct {
+			Method string
+			Params map[string]int
+		}
+		if err := c.Call("m", map[string]int{"x": i}, &res); err != nil {
+			t.Fatal(err)
+		}
+		if want := map[string]int{"x": i}; res.Method != "m" || !reflect.DeepEqual(res.Params, want) {
+			t.Errorf("call %d: got %+v, want method m and params %v", i, res, want)
+		}
+	}
+
+	// The server's requests are answered before the responses to the
+	// client's calls are read.
+	for i := 0; i < 2; i++ {
+		if got := string(*(<-s.replies).Result); got != "[null,null]" {
+			t.Errorf("got workspace/configuration result %s, want [null,null]", got)
+		}
+	}
+}
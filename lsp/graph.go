@@ -0,0 +1,423 @@
+package lsp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+	"sourcegraph.com/sourcegraph/srclib/util"
+)
+
+// Config configures the adapter for a language.
+type Config struct {
+	UnitType   string   // source unit type (e.g., "RubyLSP")
+	LanguageID string   // LSP language identifier (e.g., "ruby")
+	Extensions []string // extensions of the language's files (e.g., ".rb")
+
+	// Symlinks is the policy for symbolic links when scanning (see
+	// util.SymlinkPolicy).
+	Symlinks util.SymlinkPolicy
+}
+
+// Scan returns a source unit (named ".") of type c.UnitType that
+// contains the files under dir with one of c.Extensions, or no source
+// units if there are no such files. Directories whose names begin
+// with "." or "_" are skipped, and symbolic links are treated according
+// to c.Symlinks.
+func Scan(dir string, c *Config) ([]*unit.SourceUnit, error) {
+	var files []string
+	err := util.Walk(dir, c.Symlinks, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			if p != dir && (fi.Name()[0] == '.' || fi.Name()[0] == '_') {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if hasExtension(p, c.Extensions) && fi.Mode().IsRegular() {
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+	sort.Strings(files)
+	return []*unit.SourceUnit{{
+		Key:  unit.Key{Type: c.UnitType, Name: "."},
+		Info: unit.Info{Dir: ".", Files: files},
+	}}, nil
+}
+
+func hasExtension(file string, exts []string) bool {
+	for _, ext := range exts {
+		if strings.EqualFold(filepath.Ext(file), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Initialize initializes the language server for the workspace rooted
+// at the absolute path rootDir.
+func (c *Conn) Initialize(rootDir string) error {
+	params := InitializeParams{
+		ProcessID: os.Getpid(),
+		RootURI:   fileURI(rootDir),
+		RootPath:  rootDir,
+		Capabilities: map[string]interface{}{
+			"textDocument": map[string]interface{}{
+				"documentSymbol": map[string]interface{}{"hierarchicalDocumentSymbolSupport": true},
+				"definition":     map[string]interface{}{"linkSupport": true},
+			},
+		},
+	}
+	if err := c.Call("initialize", params, nil); err != nil {
+		return err
+	}
+	return c.Notify("initialized", struct{}{})
+}
+
+// Shutdown asks the language server to shut down and exit.
+func (c *Conn) Shutdown() error {
+	if err := c.Call("shutdown", nil, nil); err != nil {
+		return err
+	}
+	return c.Notify("exit", nil)
+}
+
+// Graph opens the files of the source unit u (relative to rootDir,
+// which must be the absolute path of the initialized workspace) in the
+// language server and converts its responses into graph data:
+//
+//   - The symbols returned by documentSymbol for each file become defs
+//     (whose def paths are the file's path followed by the names of the
+//     symbol and the symbols that contain it).
+//   - The locations returned by references for each def become refs
+//     to it.
+//   - The locations returned by definition for each other identifier
+//     in the files become refs to the defs there. Refs to definitions
+//     outside of u's files have an unresolved repository
+//     (unit.UnitRepoUnresolved), because their def keys are unknown.
+func Graph(conn *Conn, rootDir string, u *unit.SourceUnit, c *Config) (*graph.Output, error) {
+	g := &grapher{
+		conn:       conn,
+		rootDir:    rootDir,
+		unit:       u,
+		config:     c,
+		docs:       map[string]*document{},
+		defsAt:     map[loc]string{},
+		nameStarts: map[string]uint32{},
+		covered:    map[loc]bool{},
+		paths:      map[string]bool{},
+		out:        &graph.Output{},
+	}
+	for _, file := range u.Files {
+		if err := g.open(file); err != nil {
+			return nil, err
+		}
+	}
+	for _, file := range u.Files {
+		if err := g.symbols(g.docs[file]); err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+	}
+	for _, def := range g.out.Defs {
+		if err := g.references(def); err != nil {
+			return nil, fmt.Errorf("%s: %s", def.File, err)
+		}
+	}
+	for _, file := range u.Files {
+		if err := g.definitions(g.docs[file]); err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+	}
+	return g.out, nil
+}
+
+type grapher struct {
+	conn    *Conn
+	rootDir string
+	unit    *unit.SourceUnit
+	config  *Config
+
+	docs       map[string]*document // keyed by file (relative to rootDir)
+	defsAt     map[loc]string       // def path of the def whose name starts at loc
+	nameStarts map[string]uint32    // byte offset of each def's name, keyed by def path
+	covered    map[loc]bool         // locations of the defs and refs found so far
+	paths      map[string]bool      // def paths of the defs found so far
+
+	out *graph.Output
+}
+
+// loc is a byte offset in a file.
+type loc struct {
+	file  string
+	start uint32
+}
+
+func (g *grapher) open(file string) error {
+	text, err := ioutil.ReadFile(filepath.Join(g.rootDir, filepath.FromSlash(file)))
+	if err != nil {
+		return err
+	}
+	d := newDocument(file, fileURI(filepath.Join(g.rootDir, filepath.FromSlash(file))), text)
+	g.docs[file] = d
+	return g.conn.Notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": TextDocumentItem{URI: d.uri, LanguageID: g.config.LanguageID, Version: 1, Text: string(text)},
+	})
+}
+
+// symbols adds a def for each symbol in d.
+func (g *grapher) symbols(d *document) error {
+	var syms []DocumentSymbol
+	if err := g.conn.Call("textDocument/documentSymbol", map[string]interface{}{"textDocument": TextDocumentIdentifier{URI: d.uri}}, &syms); err != nil {
+		return err
+	}
+	var add func(sym DocumentSymbol, parentPath string, parentKind string)
+	add = func(sym DocumentSymbol, parentPath string, parentKind string) {
+		if sym.Location != nil {
+			// A SymbolInformation (which has no children).
+			sym.Range, sym.SelectionRange = sym.Location.Range, sym.Location.Range
+			if sym.ContainerName != "" {
+				parentPath = path.Join(parentPath, sym.ContainerName)
+			}
+		}
+		kinds := symbolKinds[sym.Kind]
+		if kinds[1] == "" {
+			kinds = [2]string{"", graph.KindOther}
+		}
+		def := &graph.Def{
+			DefKey:   graph.DefKey{UnitType: g.unit.Type, Unit: g.unit.Name, Path: g.uniquePath(path.Join(parentPath, sym.Name))},
+			Name:     sym.Name,
+			Kind:     kinds[1],
+			RawKind:  kinds[0],
+			File:     d.file,
+			DefStart: d.offset(sym.Range.Start),
+			DefEnd:   d.offset(sym.Range.End),
+			Local:    parentKind == graph.KindFunction || parentKind == graph.KindMethod,
+		}
+		g.out.Defs = append(g.out.Defs, def)
+
+		start, end := d.offset(sym.SelectionRange.Start), d.offset(sym.SelectionRange.End)
+		g.defsAt[loc{d.file, start}] = def.Path
+		g.nameStarts[def.Path] = start
+		g.covered[loc{d.file, start}] = true
+		g.out.Refs = append(g.out.Refs, &graph.Ref{
+			DefUnitType: def.UnitType,
+			DefUnit:     def.Unit,
+			DefPath:     def.Path,
+			UnitType:    g.unit.Type,
+			Unit:        g.unit.Name,
+			Def:         true,
+			File:        d.file,
+			Start:       start,
+			End:         end,
+		})
+
+		for _, child := range sym.Children {
+			add(child, def.Path, def.Kind)
+		}
+	}
+	for _, sym := range syms {
+		add(sym, d.file, "")
+	}
+	return nil
+}
+
+// uniquePath returns p, or (if p is the path of a def that was
+// already found, e.g., an overloaded method) p with a "$N" suffix.
+func (g *grapher) uniquePath(p string) string {
+	unique := p
+	for i := 2; g.paths[unique]; i++ {
+		unique = fmt.Sprintf("%s$%d", p, i)
+	}
+	g.paths[unique] = true
+	return unique
+}
+
+// references adds the refs to def.
+func (g *grapher) references(def *graph.Def) error {
+	d := g.docs[def.File]
+	var params ReferenceParams
+	params.TextDocument = TextDocumentIdentifier{URI: d.uri}
+	params.Position = d.position(g.nameStarts[def.Path])
+	var locs []Location
+	if err := g.conn.Call("textDocument/references", params, &locs); err != nil {
+		return err
+	}
+	for _, l := range locs {
+		rd := g.docFor(l.URI)
+		if rd == nil {
+			continue // not in this source unit
+		}
+		g.addRef(rd, l.Range, def.UnitType, def.Unit, def.Path, "")
+	}
+	return nil
+}
+
+// definitions adds refs for the identifiers in d that aren't defs or
+// refs found by references.
+func (g *grapher) definitions(d *document) error {
+	for _, id := range identifiers(d.text) {
+		if g.covered[loc{d.file, uint32(id[0])}] {
+			continue
+		}
+		var locs definitionResult
+		if err := g.conn.Call("textDocument/definition", TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: d.uri}, Position: d.position(uint32(id[0]))}, &locs); err != nil {
+			return err
+		}
+		if len(locs) == 0 {
+			continue
+		}
+		r := Range{Start: d.position(uint32(id[0])), End: d.position(uint32(id[1]))}
+		target := locs[0]
+		if td := g.docFor(target.URI); td != nil {
+			if defPath, ok := g.defsAt[loc{td.file, td.offset(target.Range.Start)}]; ok {
+				g.addRef(d, r, g.unit.Type, g.unit.Name, defPath, "")
+			}
+			// Otherwise it's a def that documentSymbol didn't return
+			// (such as a local variable).
+			continue
+		}
+		if p := uriPath(target.URI); p == "" || !isUnder(p, g.rootDir) {
+			g.addRef(d, r, g.unit.Type, unit.UnitRepoUnresolved, fmt.Sprintf("%s#L%d", target.URI, target.Range.Start.Line+1), unit.UnitRepoUnresolved)
+		}
+	}
+	return nil
+}
+
+func (g *grapher) addRef(d *document, r Range, defUnitType, defUnit, defPath, defRepo string) {
+	start := d.offset(r.Start)
+	if g.covered[loc{d.file, start}] {
+		return
+	}
+	g.covered[loc{d.file, start}] = true
+	g.out.Refs = append(g.out.Refs, &graph.Ref{
+		DefRepo:     defRepo,
+		DefUnitType: defUnitType,
+		DefUnit:     defUnit,
+		DefPath:     defPath,
+		UnitType:    g.unit.Type,
+		Unit:        g.unit.Name,
+		File:        d.file,
+		Start:       start,
+		End:         d.offset(r.End),
+	})
+}
+
+// docFor returns the opened document with the given URI, or nil if it
+// isn't one of the source unit's files.
+func (g *grapher) docFor(uri string) *document {
+	p := uriPath(uri)
+	if p == "" {
+		return nil
+	}
+	rel, err := filepath.Rel(g.rootDir, p)
+	if err != nil {
+		return nil
+	}
+	return g.docs[filepath.ToSlash(rel)]
+}
+
+func isUnder(p, dir string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// identifiers returns the byte ranges of the identifiers (sequences of
+// letters, digits, and underscores that don't begin with a digit) in
+// text.
+func identifiers(text []byte) [][2]int {
+	isIdent := func(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+	var ids [][2]int
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRune(text[i:])
+		if !isIdent(r) {
+			i += size
+			continue
+		}
+		start := i
+		for i < len(text) {
+			r, size := utf8.DecodeRune(text[i:])
+			if !isIdent(r) {
+				break
+			}
+			i += size
+		}
+		if !unicode.IsDigit(r) {
+			ids = append(ids, [2]int{start, i})
+		}
+	}
+	return ids
+}
+
+// document is a file opened in the language server.
+type document struct {
+	file       string // relative to the workspace root
+	uri        string
+	text       []byte
+	lineStarts []int // byte offset of the start of each line
+}
+
+func newDocument(file, uri string, text []byte) *document {
+	d := &document{file: file, uri: uri, text: text, lineStarts: []int{0}}
+	for i, c := range text {
+		if c == '\n' {
+			d.lineStarts = append(d.lineStarts, i+1)
+		}
+	}
+	return d
+}
+
+// offset returns the byte offset of p, which counts characters in
+// UTF-16 code units. Positions past the end of a line or of the
+// document are clamped.
+func (d *document) offset(p Position) uint32 {
+	if p.Line >= len(d.lineStarts) {
+		return uint32(len(d.text))
+	}
+	if p.Line < 0 {
+		return 0
+	}
+	i := d.lineStarts[p.Line]
+	for units := 0; units < p.Character && i < len(d.text) && d.text[i] != '\n'; {
+		r, size := utf8.DecodeRune(d.text[i:])
+		units += utf16Len(r)
+		i += size
+	}
+	return uint32(i)
+}
+
+// position returns the position of the byte offset off.
+func (d *document) position(off uint32) Position {
+	line := sort.SearchInts(d.lineStarts, int(off)+1) - 1
+	units := 0
+	for i := d.lineStarts[line]; i < int(off) && i < len(d.text); {
+		r, size := utf8.DecodeRune(d.text[i:])
+		units += utf16Len(r)
+		i += size
+	}
+	return Position{Line: line, Character: units}
+}
+
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
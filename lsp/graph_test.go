@@ -0,0 +1,139 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestScan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsp-scan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, file := range []string{"a.x", "b.X", "sub/c.x", "d.y", ".hidden/e.x"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(file)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, file), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	units, err := Scan(dir, &Config{UnitType: "XLSP", Extensions: []string{".x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*unit.SourceUnit{{Key: unit.Key{Type: "XLSP", Name: "."}, Info: unit.Info{Dir: ".", Files: []string{"a.x", "b.X", "sub/c.x"}}}}
+	if !reflect.DeepEqual(units, want) {
+		t.Errorf("got %+v, want %+v", units, want)
+	}
+}
+
+func TestGraph(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsp-graph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Line 0 defines F (with a local variable v), line 1 refers to F
+	// and to an external def E. The "é" is 2 bytes but 1 UTF-16 unit.
+	src := "func F() { v }\né F(); E()\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.x"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	uri := fileURI(filepath.Join(dir, "a.x"))
+	rng := func(line, start, end int) Range {
+		return Range{Start: Position{line, start}, End: Position{line, end}}
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	s := &fakeServer{handle: func(method string, params json.RawMessage) interface{} {
+		var p TextDocumentPositionParams
+		json.Unmarshal(params, &p)
+		switch method {
+		case "textDocument/documentSymbol":
+			return []DocumentSymbol{{
+				Name: "F", Kind: 12, Range: rng(0, 0, 14), SelectionRange: rng(0, 5, 6),
+				Children: []DocumentSymbol{{Name: "v", Kind: 13, Range: rng(0, 11, 12), SelectionRange: rng(0, 11, 12)}},
+			}}
+		case "textDocument/references":
+			if p.Position == (Position{0, 5}) {
+				return []Location{{URI: uri, Range: rng(1, 2, 3)}}
+			}
+			return nil
+		case "textDocument/definition":
+			if p.Position == (Position{1, 7}) {
+				return []map[string]interface{}{{"targetUri": "file:///lib/e.x", "targetRange": rng(9, 0, 20), "targetSelectionRange": rng(9, 4, 5)}}
+			}
+			return nil
+		}
+		return nil
+	}}
+	s.start(t, server)
+
+	o, err := Graph(NewConn(client), dir, &unit.SourceUnit{Key: unit.Key{Type: "XLSP", Name: "."}, Info: unit.Info{Files: []string{"a.x"}}}, &Config{UnitType: "XLSP", LanguageID: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantDefs := []*graph.Def{
+		{DefKey: graph.DefKey{UnitType: "XLSP", Unit: ".", Path: "a.x/F"}, Name: "F", Kind: "function", RawKind: "function", File: "a.x", DefStart: 0, DefEnd: 14},
+		{DefKey: graph.DefKey{UnitType: "XLSP", Unit: ".", Path: "a.x/F/v"}, Name: "v", Kind: "variable", RawKind: "variable", File: "a.x", DefStart: 11, DefEnd: 12, Local: true},
+	}
+	if !reflect.DeepEqual(o.Defs, wantDefs) {
+		t.Errorf("got defs %+v, want %+v", o.Defs, wantDefs)
+	}
+	ref := func(defRepo, defUnit, defPath string, def bool, start, end uint32) *graph.Ref {
+		return &graph.Ref{DefRepo: defRepo, DefUnitType: "XLSP", DefUnit: defUnit, DefPath: defPath, UnitType: "XLSP", Unit: ".", Def: def, File: "a.x", Start: start, End: end}
+	}
+	wantRefs := []*graph.Ref{
+		ref("", ".", "a.x/F", true, 5, 6),
+		ref("", ".", "a.x/F/v", true, 11, 12),
+		ref("", ".", "a.x/F", false, 18, 19),
+		ref("?", "?", "file:///lib/e.x#L10", false, 23, 24),
+	}
+	if !reflect.DeepEqual(o.Refs, wantRefs) {
+		for _, r := range o.Refs {
+			t.Logf("ref %+v", r)
+		}
+		t.Errorf("got refs %+v, want %+v", o.Refs, wantRefs)
+	}
+}
+
+func TestDocument_offset(t *testing.T) {
+	d := newDocument("f", "", []byte("a\nxé😀y\n"))
+	tests := []struct {
+		pos Position
+		off uint32
+	}{
+		{Position{0, 0}, 0},
+		{Position{0, 1}, 1},
+		{Position{1, 0}, 2},
+		{Position{1, 1}, 3},
+		{Position{1, 2}, 5},
+		{Position{1, 4}, 9},
+		{Position{1, 5}, 10},
+		{Position{2, 0}, 11},
+	}
+	for _, test := range tests {
+		if got := d.offset(test.pos); got != test.off {
+			t.Errorf("offset(%v): got %d, want %d", test.pos, got, test.off)
+		}
+		if got := d.position(test.off); got != test.pos {
+			t.Errorf("position(%d): got %v, want %v", test.off, got, test.pos)
+		}
+	}
+	if got := d.offset(Position{1, 99}); got != 10 {
+		t.Errorf("got offset %d past the end of a line, want the end of the line (10)", got)
+	}
+}
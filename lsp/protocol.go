@@ -0,0 +1,177 @@
+// Package lsp adapts language servers that speak the Language Server
+// Protocol (LSP) to srclib, so that a language with an LSP server but
+// no srclib toolchain can be analyzed: Scan emits a source unit for
+// the files of a language, and Graph converts the server's responses
+// to documentSymbol, references, and definition requests into graph
+// data.
+package lsp
+
+import (
+	"encoding/json"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// Only the parts of the protocol that the adapter uses are defined
+// here. See
+// https://microsoft.github.io/language-server-protocol/specification.
+
+// Position is a zero-based line and character offset (in UTF-16 code
+// units) in a document.
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Range is a range in a document. End is exclusive.
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Location is a range in a document.
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+// SymbolKind is the kind of a symbol.
+type SymbolKind int
+
+// symbolKinds maps each SymbolKind to its name in the specification
+// (lowercased), which is used as the raw def kind, and the canonical
+// def kind.
+var symbolKinds = map[SymbolKind][2]string{
+	1:  {"file", "module"},
+	2:  {"module", "module"},
+	3:  {"namespace", "module"},
+	4:  {"package", "module"},
+	5:  {"class", "class"},
+	6:  {"method", "method"},
+	7:  {"property", "field"},
+	8:  {"field", "field"},
+	9:  {"constructor", "method"},
+	10: {"enum", "enum"},
+	11: {"interface", "interface"},
+	12: {"function", "function"},
+	13: {"variable", "variable"},
+	14: {"constant", "constant"},
+	15: {"string", "constant"},
+	16: {"number", "constant"},
+	17: {"boolean", "constant"},
+	18: {"array", "variable"},
+	19: {"object", "variable"},
+	20: {"key", "field"},
+	21: {"null", "constant"},
+	22: {"enummember", "constant"},
+	23: {"struct", "type"},
+	24: {"event", "field"},
+	25: {"operator", "function"},
+	26: {"typeparameter", "type"},
+}
+
+// DocumentSymbol is a symbol in a document: either a DocumentSymbol
+// (with children) or a SymbolInformation (with a location and the name
+// of its container), depending on which the server returns.
+type DocumentSymbol struct {
+	Name           string           `json:"name"`
+	Kind           SymbolKind       `json:"kind"`
+	Range          Range            `json:"range"`
+	SelectionRange Range            `json:"selectionRange"`
+	Children       []DocumentSymbol `json:"children,omitempty"`
+
+	Location      *Location `json:"location,omitempty"`
+	ContainerName string    `json:"containerName,omitempty"`
+}
+
+// InitializeParams are the parameters of the initialize request.
+type InitializeParams struct {
+	ProcessID    int         `json:"processId"`
+	RootURI      string      `json:"rootUri"`
+	RootPath     string      `json:"rootPath"`
+	Capabilities interface{} `json:"capabilities"`
+}
+
+// TextDocumentItem is a document that is opened with didOpen.
+type TextDocumentItem struct {
+	URI        string `json:"uri"`
+	LanguageID string `json:"languageId"`
+	Version    int    `json:"version"`
+	Text       string `json:"text"`
+}
+
+// TextDocumentIdentifier identifies a document.
+type TextDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+// TextDocumentPositionParams are the parameters of requests about a
+// position in a document (such as definition).
+type TextDocumentPositionParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+// ReferenceParams are the parameters of the references request.
+type ReferenceParams struct {
+	TextDocumentPositionParams
+	Context struct {
+		IncludeDeclaration bool `json:"includeDeclaration"`
+	} `json:"context"`
+}
+
+// definitionResult is the result of a definition request: null, a
+// Location, or an array of Locations or LocationLinks.
+type definitionResult []Location
+
+func (r *definitionResult) UnmarshalJSON(data []byte) error {
+	type location struct {
+		Location
+		TargetURI            string `json:"targetUri"`
+		TargetSelectionRange Range  `json:"targetSelectionRange"`
+	}
+	var locs []location
+	if len(data) > 0 && data[0] == '[' {
+		if err := json.Unmarshal(data, &locs); err != nil {
+			return err
+		}
+	} else if string(data) != "null" {
+		var loc location
+		if err := json.Unmarshal(data, &loc); err != nil {
+			return err
+		}
+		locs = append(locs, loc)
+	}
+	*r = nil
+	for _, loc := range locs {
+		if loc.TargetURI != "" {
+			loc.URI, loc.Range = loc.TargetURI, loc.TargetSelectionRange
+		}
+		*r = append(*r, loc.Location)
+	}
+	return nil
+}
+
+// fileURI returns the file: URI for the absolute path p.
+func fileURI(p string) string {
+	p = filepath.ToSlash(p)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p // Windows drive letter
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
+
+// uriPath returns the file path of the file: URI uri, or "" if uri
+// isn't a file: URI.
+func uriPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	p := u.Path
+	if len(p) >= 3 && p[0] == '/' && p[2] == ':' {
+		p = p[1:] // Windows drive letter
+	}
+	return filepath.FromSlash(p)
+}
@@ -0,0 +1,92 @@
+package srclib
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Proxy is the URL of an HTTP proxy (typically a caching proxy)
+	// that network fetches are routed through, both by srclib and by
+	// the programs it runs (such as toolchain installs and dep
+	// resolvers). It is initialized from the SRCLIB_PROXY environment
+	// variable; if empty, it may be set by the Srcfile's Proxy.
+	Proxy = os.Getenv("SRCLIB_PROXY")
+
+	// Offline is whether network fetches are forbidden. In offline
+	// mode, operations that would need to fetch something fail
+	// immediately (see CheckOnline), and the programs that srclib runs
+	// are told (by environment variables, see NetworkEnv) not to fetch
+	// anything. It is initialized from the SRCLIB_OFFLINE environment
+	// variable (e.g., "1" or "true"); the Srcfile's Offline may also
+	// set it.
+	Offline, _ = strconv.ParseBool(os.Getenv("SRCLIB_OFFLINE"))
+)
+
+// An OfflineError occurs when an operation needs network access in
+// offline mode.
+type OfflineError struct {
+	Op string // the operation that needs network access
+}
+
+func (e *OfflineError) Error() string {
+	return fmt.Sprintf("%s requires network access, but srclib is in offline mode (--offline or SRCLIB_OFFLINE)", e.Op)
+}
+
+// CheckOnline returns an *OfflineError for the operation op if srclib
+// is in offline mode, and nil otherwise. Call it before any network
+// fetch so that it fails fast (instead of timing out) in air-gapped
+// environments.
+func CheckOnline(op string) error {
+	if Offline {
+		return &OfflineError{Op: op}
+	}
+	return nil
+}
+
+// NetworkEnv returns the environment variables (in "KEY=VALUE" form)
+// that route the network fetches of the programs that srclib runs
+// through Proxy and, in offline mode, tell them not to fetch anything.
+// Toolchains should honor SRCLIB_PROXY and SRCLIB_OFFLINE in their
+// own fetches (e.g., when resolving dependencies from package
+// registries); the other variables are understood by common tools
+// (git, npm, pip, and go).
+func NetworkEnv() []string {
+	var env []string
+	if Proxy != "" {
+		env = append(env,
+			"SRCLIB_PROXY="+Proxy,
+			"HTTP_PROXY="+Proxy,
+			"HTTPS_PROXY="+Proxy,
+			"http_proxy="+Proxy,
+			"https_proxy="+Proxy,
+			"npm_config_proxy="+Proxy,
+			"npm_config_https_proxy="+Proxy,
+		)
+	}
+	if Offline {
+		env = append(env,
+			"SRCLIB_OFFLINE=1",
+			"GIT_ALLOW_PROTOCOL=file",
+			"npm_config_offline=true",
+			"PIP_NO_INDEX=1",
+			"GOPROXY=off",
+		)
+	}
+	return env
+}
+
+// ApplyNetworkEnv sets the variables returned by NetworkEnv in this
+// process's environment, so that all of the programs that srclib runs
+// inherit them. Call it again after changing Proxy or Offline.
+func ApplyNetworkEnv() error {
+	for _, kv := range NetworkEnv() {
+		i := strings.Index(kv, "=")
+		if err := os.Setenv(kv[:i], kv[i+1:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
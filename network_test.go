@@ -0,0 +1,44 @@
+package srclib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNetworkEnv(t *testing.T) {
+	origProxy, origOffline := Proxy, Offline
+	defer func() { Proxy, Offline = origProxy, origOffline }()
+
+	Proxy, Offline = "", false
+	if env := NetworkEnv(); len(env) != 0 {
+		t.Errorf("got env %v, want none", env)
+	}
+	if err := CheckOnline("x"); err != nil {
+		t.Errorf("got error %v when online, want nil", err)
+	}
+
+	Proxy = "http://cache:3128"
+	env := NetworkEnv()
+	if want := "HTTPS_PROXY=http://cache:3128"; !containsString(env, want) {
+		t.Errorf("got env %v, want it to contain %q", env, want)
+	}
+
+	Offline = true
+	env = NetworkEnv()
+	if want := "SRCLIB_OFFLINE=1"; !containsString(env, want) {
+		t.Errorf("got env %v, want it to contain %q", env, want)
+	}
+	err := CheckOnline("downloading x")
+	if want := (&OfflineError{Op: "downloading x"}); !reflect.DeepEqual(err, want) {
+		t.Errorf("got error %v, want %v", err, want)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
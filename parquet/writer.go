@@ -0,0 +1,165 @@
+// Package parquet writes tables in the Apache Parquet columnar file
+// format, so that exported srclib data can be queried by analytics
+// tools (such as BigQuery, DuckDB, and Spark).
+//
+// The files are written by github.com/xitongsys/parquet-go. This
+// package describes srclib's flat tables to it: schemas of required
+// (non-null) boolean, 64-bit integer, double, and UTF-8 string
+// columns.
+package parquet
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// A Type is the type of a column.
+type Type int
+
+// Column types.
+const (
+	Boolean Type = iota
+	Int64
+	Double
+	String
+)
+
+func (t Type) String() string {
+	switch t {
+	case Boolean:
+		return "boolean"
+	case Int64:
+		return "int64"
+	case Double:
+		return "double"
+	case String:
+		return "string"
+	}
+	return fmt.Sprintf("Type(%d)", int(t))
+}
+
+// schema returns the parquet-go schema metadata tags of a column of
+// type t.
+func (t Type) schema() string {
+	switch t {
+	case Boolean:
+		return "type=BOOLEAN"
+	case Int64:
+		return "type=INT64"
+	case Double:
+		return "type=DOUBLE"
+	}
+	return "type=BYTE_ARRAY, convertedtype=UTF8"
+}
+
+// A Column describes a column of a table.
+type Column struct {
+	Name string
+	Type Type
+}
+
+// DefaultRowGroupSize is the default value of Writer.RowGroupSize.
+const DefaultRowGroupSize = 64 << 20
+
+// A Writer writes a table to a Parquet file. Rows are buffered in
+// memory and written in row groups; the file is complete when Close
+// is called.
+type Writer struct {
+	// RowGroupSize is the approximate size (in bytes of buffered
+	// values) at which buffered rows are written as a row group.
+	RowGroupSize int
+
+	columns []Column
+	pw      *writer.CSVWriter
+	err     error
+}
+
+// NewWriter returns a writer of a table with the given columns to w.
+// The file's magic number is written to w immediately.
+func NewWriter(w io.Writer, columns []Column) (*Writer, error) {
+	md := make([]string, len(columns))
+	for i, col := range columns {
+		md[i] = fmt.Sprintf("name=%s, %s, repetitiontype=REQUIRED", col.Name, col.Type.schema())
+	}
+	pw, err := writer.NewCSVWriterFromWriter(md, w, 1)
+	if err != nil {
+		return nil, fmt.Errorf("parquet: %s", err)
+	}
+	createdBy := "srclib"
+	pw.Footer.CreatedBy = &createdBy
+	return &Writer{RowGroupSize: DefaultRowGroupSize, columns: columns, pw: pw}, nil
+}
+
+// Write buffers a row. Its values must correspond to the columns: a
+// bool for a Boolean column, an int or int64 for an Int64 column, a
+// float64 for a Double column, and a string for a String column.
+func (w *Writer) Write(row ...interface{}) error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(row) != len(w.columns) {
+		return fmt.Errorf("parquet: row has %d values, want %d", len(row), len(w.columns))
+	}
+	rec := make([]interface{}, len(row))
+	for i, col := range w.columns {
+		if err := checkValue(col, row[i]); err != nil {
+			return err
+		}
+		rec[i] = row[i]
+		if v, ok := row[i].(int); ok {
+			rec[i] = int64(v)
+		}
+	}
+	w.pw.RowGroupSize = int64(w.RowGroupSize)
+	w.err = w.pw.Write(rec)
+	return w.err
+}
+
+func checkValue(col Column, v interface{}) error {
+	var ok bool
+	switch col.Type {
+	case Boolean:
+		_, ok = v.(bool)
+	case Int64:
+		switch v.(type) {
+		case int, int64:
+			ok = true
+		}
+	case Double:
+		_, ok = v.(float64)
+	case String:
+		_, ok = v.(string)
+	}
+	if !ok {
+		return fmt.Errorf("parquet: value of %s column %q has type %T", col.Type, col.Name, v)
+	}
+	return nil
+}
+
+// Flush writes the buffered rows as a row group.
+func (w *Writer) Flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	w.err = w.pw.Flush(true)
+	return w.err
+}
+
+// Close writes the buffered rows and the file metadata. It does not
+// close the underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.pw.WriteStop(); err != nil {
+		w.err = err
+		return err
+	}
+	w.err = errClosed
+	return nil
+}
+
+var errClosed = errors.New("parquet: writer is closed")
@@ -0,0 +1,96 @@
+package parquet
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, []Column{{"name", String}, {"n", Int64}, {"ok", Boolean}, {"x", Double}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]interface{}{
+		{"a", 1, true, 0.5},
+		{"", int64(-2), false, 1.5},
+		{"ccc", 3, true, -1.0},
+	}
+	for i, row := range rows {
+		if err := w.Write(row...); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			// So that there are 2 row groups.
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Write("a", "b", true, 0.5); err == nil {
+		t.Error("got no error writing a string to an Int64 column")
+	}
+	if err := w.Write("a"); err == nil {
+		t.Error("got no error writing a row with too few values")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := buffer.NewBufferFile(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := reader.NewParquetColumnReader(f, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.ReadStop()
+	if got, want := r.GetNumRows(), int64(3); got != want {
+		t.Errorf("got %d rows, want %d", got, want)
+	}
+	if got := len(r.Footer.RowGroups); got != 2 {
+		t.Errorf("got %d row groups, want 2", got)
+	}
+	var names []string
+	for _, info := range r.SchemaHandler.Infos[1:] {
+		names = append(names, info.ExName) // the column names in the file
+	}
+	if want := []string{"name", "n", "ok", "x"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got columns %q, want %q", names, want)
+	}
+
+	want := [][]interface{}{
+		{"a", "", "ccc"},
+		{int64(1), int64(-2), int64(3)},
+		{true, false, true},
+		{0.5, 1.5, -1.0},
+	}
+	for i := range want {
+		col, _, _, err := r.ReadColumnByIndex(int64(i), 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(col, want[i]) {
+			t.Errorf("column %d: got %v, want %v", i, col, want[i])
+		}
+	}
+}
+
+func TestWriter_empty(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, []Column{{"a", String}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if file := buf.String(); file[:4] != "PAR1" || file[len(file)-4:] != "PAR1" {
+		t.Errorf("got %q, want a file beginning and ending with %q", file, "PAR1")
+	}
+}
@@ -0,0 +1,66 @@
+package plan
+
+import (
+	"path/filepath"
+	"time"
+
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// ToolLog records a single run of a toolchain tool by a build rule
+// (see "srclib tool --log"). The logs of a source unit's tool runs are
+// stored in the build store alongside the unit's build data (see
+// LogFilename) and can be viewed with "srclib logs".
+type ToolLog struct {
+	// Toolchain and Tool identify the tool that was run, and Args are
+	// the extra args that were passed to it.
+	Toolchain string
+	Tool      string
+	Args      []string `json:",omitempty"`
+
+	// Start is when the tool was started, and Duration is how long it
+	// ran.
+	Start    time.Time
+	Duration time.Duration
+
+	// ExitCode is the tool's exit code, or -1 if it couldn't be run or
+	// was killed by a signal (in which case Error describes why).
+	ExitCode int
+	Error    string `json:",omitempty"`
+
+	// Stdout is the beginning of the tool's standard output (which is
+	// usually also stored in full as the rule's build data), and
+	// StdoutBytes is its total length.
+	Stdout      string
+	StdoutBytes int64
+
+	// Stderr is the tool's standard error output.
+	Stderr string
+
+	// MaxRSS is the peak resident memory (in megabytes) of the tool
+	// and its child processes, as sampled while it ran under a memory
+	// budget (see "srclib make --max-memory"), or 0 if it wasn't
+	// measured. It is used to estimate the memory that the tool needs
+	// the next time that it's run on the source unit.
+	MaxRSS int64 `json:",omitempty"`
+
+	// Errors are the structured errors that the tool reported (see
+	// toolchain.ErrorsFileEnv).
+	Errors []*toolchain.ToolError `json:",omitempty"`
+}
+
+// LogFilename returns the name of the file (relative to the build
+// data directory) that holds the log of the tool run for op on u.
+// For rules that run a tool on all source units of a type at once,
+// u should have only its Type set.
+func LogFilename(op string, u *unit.SourceUnit) string {
+	return SourceUnitDataFilename(op+".log", u)
+}
+
+// LogArgs returns the "srclib tool" flag that logs the tool run for
+// op on u to the build data directory dataDir, preceded by a space.
+// It is used by rules whose recipes run a tool.
+func LogArgs(dataDir, op string, u *unit.SourceUnit) string {
+	return " --log " + ShellQuote(filepath.ToSlash(filepath.Join(dataDir, LogFilename(op, u))))
+}
@@ -7,6 +7,7 @@ import (
 	"sourcegraph.com/sourcegraph/makex"
 	"sourcegraph.com/sourcegraph/srclib/buildstore"
 	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
 )
 
 type RuleMaker func(c *config.Tree, dataDir string, existing []makex.Rule) ([]makex.Rule, error)
@@ -33,7 +34,22 @@ func RegisterRuleMaker(name string, r RuleMaker) {
 }
 
 // CreateMakefile creates the makefiles for the source units in c.
+//
+// When multiple toolchains can graph (or resolve the dependencies of)
+// source units of the same type, the toolchain is chosen by scoring
+// the files of c's units of that type (see toolchain.ChooseTool), and
+// the choices are recorded (see toolchain.ToolChoices).
 func CreateMakefile(buildDataDir string, buildStore buildstore.RepoBuildStore, vcsType string, c *config.Tree) (*makex.Makefile, error) {
+	toolchain.SetSampleFiles(func(unitType string) []string {
+		var files []string
+		for _, u := range c.SourceUnits {
+			if u.Type == unitType {
+				files = append(files, u.Files...)
+			}
+		}
+		return files
+	})
+
 	var allRules []makex.Rule
 	for i, r := range orderedRuleMakers {
 		name := ruleMakerNames[i]
@@ -56,10 +56,10 @@ func TestCreateMakefile(t *testing.T) {
 all: testdata/n/t.depresolve.json testdata/n/t.graph.json
 
 testdata/n/t.depresolve.json: testdata/n/t.unit.json
-	srclib tool "tc" "t" < $^ 1> $@
+	srclib tool --log "testdata/n/t.depresolve.log.json" "tc" "t" < $^ 1> $@
 
 testdata/n/t.graph.json: testdata/n/t.unit.json
-	srclib tool "tc" "t" < $< | srclib internal normalize-graph-data --unit-type "t" --dir . 1> $@
+	srclib tool --log "testdata/n/t.graph.log.json" "tc" "t" < $< | srclib internal normalize-graph-data --unit-type "t" --dir . 1> $@
 
 .DELETE_ON_ERROR:
 `
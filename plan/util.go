@@ -1,6 +1,11 @@
 package plan
 
-import "sourcegraph.com/sourcegraph/makex"
+import (
+	"strings"
+
+	"sourcegraph.com/sourcegraph/makex"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
 
 // ruleSort sorts rules by target name, alphabetically. It is used to
 // enforce stable ordering so that Makefiles are consistently
@@ -16,3 +21,59 @@ func (s ruleSort) Less(i, j int) bool {
 func (s ruleSort) Swap(i, j int) {
 	s.Rules[i], s.Rules[j] = s.Rules[j], s.Rules[i]
 }
+
+// EnvArgs returns the "srclib tool" flags that set the extra
+// environment variables for u (see unit.Info.Env), preceded
+// by a space, or "" if there are none. It is used by rules whose
+// recipes run a tool on a single source unit.
+func EnvArgs(u *unit.SourceUnit) string {
+	var s string
+	for _, v := range u.Env {
+		s += " --env " + ShellQuote(v)
+	}
+	return s
+}
+
+// ShellQuote quotes s as a single word in a rule's recipe, which is
+// run by sh (by makex, or by make after EscapeMakeRecipe). Strings
+// that sh and make treat literally in double quotes are double quoted
+// (as %q would), so that the common recipes stay readable; others are
+// single quoted, so that sh doesn't expand "$VAR" and "$(cmd)" in
+// them. Each "$" is followed by an empty single-quoted string, so that a
+// quoted "$@", "$<", or "$^" is never taken for an automatic
+// variable.
+func ShellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, needsSingleQuotes) == -1 {
+		return `"` + s + `"`
+	}
+	s = strings.Replace(s, "'", `'\''`, -1)
+	s = strings.Replace(s, "$", "$''", -1)
+	return "'" + s + "'"
+}
+
+// needsSingleQuotes reports whether ShellQuote must single quote a
+// string that contains r.
+func needsSingleQuotes(r rune) bool {
+	return r < ' ' || r == 0x7f || strings.ContainsRune("$`\\\"'!", r)
+}
+
+// EscapeMakeRecipe escapes each "$" in recipe as "$$" (which make
+// passes to sh as "$"), except for those of the automatic variables
+// "$@", "$<", and "$^" that makex and make both expand. It is used to
+// write rules (whose recipes are for makex) to Makefiles.
+func EscapeMakeRecipe(recipe string) string {
+	var buf []byte
+	for i := 0; i < len(recipe); i++ {
+		buf = append(buf, recipe[i])
+		if recipe[i] != '$' {
+			continue
+		}
+		if i+1 < len(recipe) && strings.IndexByte("@<^", recipe[i+1]) != -1 {
+			i++
+			buf = append(buf, recipe[i])
+		} else {
+			buf = append(buf, '$')
+		}
+	}
+	return string(buf)
+}
@@ -0,0 +1,47 @@
+package plan_test
+
+import (
+	"os/exec"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/plan"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := map[string]string{
+		"tc":               `"tc"`,
+		"a b/*_test.go":    `"a b/*_test.go"`,
+		"":                 `''`,
+		"GOPATH=$HOME/go":  `'GOPATH=$''HOME/go'`,
+		"X=$(rm -rf /)":    `'X=$''(rm -rf /)'`,
+		"it's `date` $@ !": `'it'\''s ` + "`date`" + ` $''@ !'`,
+		`a\b"c`:            `'a\b"c'`,
+	}
+	for s, want := range tests {
+		got := plan.ShellQuote(s)
+		if got != want {
+			t.Errorf("%q: got %s, want %s", s, got, want)
+		}
+		out, err := exec.Command("sh", "-c", "printf %s "+got).Output()
+		if err != nil {
+			t.Fatalf("%q: %s", s, err)
+		}
+		if string(out) != s {
+			t.Errorf("%q: sh got %q from %s", s, out, got)
+		}
+	}
+}
+
+func TestEscapeMakeRecipe(t *testing.T) {
+	tests := map[string]string{
+		`cat $^ > $@`:                       `cat $^ > $@`,
+		`srclib tool < $< 1> $@`:            `srclib tool < $< 1> $@`,
+		`srclib tool --env 'A=$''HOME' "t"`: `srclib tool --env 'A=$$''HOME' "t"`,
+		`echo $`:                            `echo $$`,
+	}
+	for recipe, want := range tests {
+		if got := plan.EscapeMakeRecipe(recipe); got != want {
+			t.Errorf("%q: got %q, want %q", recipe, got, want)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package scan
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func init() {
+	Builtins["bazel"] = scanBazel
+	Builtins["buck"] = scanBuck
+}
+
+// BuildTargetUnitType is the type of the source units emitted by the
+// built-in bazel and buck scanners. They query the build system for
+// its targets (with "bazel query" or "buck query") and emit a source
+// unit for each target, named by its label (e.g., "//foo/bar:baz"),
+// whose Files are the target's source files and whose Dependencies
+// are the units of the targets it depends on. This gives monorepos
+// that use these build systems the build's own unit boundaries.
+//
+// The targets are those matched by the query in the "BazelQuery" or
+// "BuckQuery" key of the tree config (the Srcfile's Config), or by
+// defaultBuildTargetsQuery. Targets with no source files in the
+// repository (e.g., only generated sources) are omitted.
+const BuildTargetUnitType = "BuildTarget"
+
+// defaultBuildTargetsQuery matches all library, binary, and test
+// targets.
+const defaultBuildTargetsQuery = `kind(".*_(library|binary|test)", //...)`
+
+// BuildTargetData is the Data of the source units emitted by the
+// built-in bazel and buck scanners (see BuildTargetUnitType).
+type BuildTargetData struct {
+	BuildSystem string // "bazel" or "buck"
+	RuleClass   string // the target's rule (e.g., "go_library")
+}
+
+func scanBazel(treeConfig map[string]interface{}) ([]*unit.SourceUnit, error) {
+	out, err := runBuildQuery("bazel", "query", buildTargetsQuery(treeConfig, "BazelQuery"), "--output=xml")
+	if err != nil {
+		return nil, err
+	}
+	return bazelUnits(".", out)
+}
+
+func scanBuck(treeConfig map[string]interface{}) ([]*unit.SourceUnit, error) {
+	out, err := runBuildQuery("buck", "query", buildTargetsQuery(treeConfig, "BuckQuery"), "--output-attributes", "buck.type", "srcs", "deps")
+	if err != nil {
+		return nil, err
+	}
+	return buckUnits(".", out)
+}
+
+func buildTargetsQuery(treeConfig map[string]interface{}, key string) string {
+	if q, _ := treeConfig[key].(string); q != "" {
+		return q
+	}
+	return defaultBuildTargetsQuery
+}
+
+func runBuildQuery(name string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %s\n%s", name, strings.Join(args, " "), err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
+
+// bazelUnits returns the units for the targets in the output of "bazel
+// query --output=xml", for the workspace rooted at root.
+func bazelUnits(root string, out []byte) ([]*unit.SourceUnit, error) {
+	var q struct {
+		Rules []struct {
+			Class string `xml:"class,attr"`
+			Name  string `xml:"name,attr"`
+			Lists []struct {
+				Name   string `xml:"name,attr"`
+				Labels []struct {
+					Value string `xml:"value,attr"`
+				} `xml:"label"`
+			} `xml:"list"`
+		} `xml:"rule"`
+	}
+	// Bazel declares XML version 1.1, which encoding/xml rejects, so
+	// skip the declaration.
+	if bytes.HasPrefix(out, []byte("<?xml")) {
+		if i := bytes.Index(out, []byte("?>")); i >= 0 {
+			out = out[i+len("?>"):]
+		}
+	}
+	if err := xml.Unmarshal(out, &q); err != nil {
+		return nil, fmt.Errorf("parsing bazel query output: %s", err)
+	}
+	var targets []*buildTarget
+	for _, r := range q.Rules {
+		t := &buildTarget{label: r.Name, class: r.Class}
+		for _, l := range r.Lists {
+			for _, label := range l.Labels {
+				switch l.Name {
+				case "srcs", "hdrs":
+					t.srcs = append(t.srcs, label.Value)
+				case "deps":
+					t.deps = append(t.deps, label.Value)
+				}
+			}
+		}
+		targets = append(targets, t)
+	}
+	return buildTargetUnits(root, "bazel", targets), nil
+}
+
+// buckUnits returns the units for the targets in the output of "buck
+// query --output-attributes buck.type srcs deps", for the repository
+// rooted at root.
+func buckUnits(root string, out []byte) ([]*unit.SourceUnit, error) {
+	var q map[string]struct {
+		Type string   `json:"buck.type"`
+		Srcs []string `json:"srcs"`
+		Deps []string `json:"deps"`
+	}
+	if err := json.Unmarshal(out, &q); err != nil {
+		return nil, fmt.Errorf("parsing buck query output: %s", err)
+	}
+	var targets []*buildTarget
+	for label, attrs := range q {
+		targets = append(targets, &buildTarget{label: label, class: attrs.Type, srcs: attrs.Srcs, deps: attrs.Deps})
+	}
+	return buildTargetUnits(root, "buck", targets), nil
+}
+
+// buildTarget is a target in a build system's query output.
+type buildTarget struct {
+	label, class string
+	srcs, deps   []string // labels, or paths relative to the target's package
+}
+
+type buildTargetsByLabel []*buildTarget
+
+func (v buildTargetsByLabel) Len() int           { return len(v) }
+func (v buildTargetsByLabel) Less(i, j int) bool { return v[i].label < v[j].label }
+func (v buildTargetsByLabel) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+
+// buildTargetUnits returns the units (sorted by label) for the targets
+// that have source files in the repository rooted at root.
+func buildTargetUnits(root, buildSystem string, targets []*buildTarget) []*unit.SourceUnit {
+	sort.Sort(buildTargetsByLabel(targets))
+	var units []*unit.SourceUnit
+	for _, t := range targets {
+		pkg := labelPackage(t.label)
+		var files []string
+		for _, src := range t.srcs {
+			file := labelFile(pkg, src)
+			if file == "" {
+				continue
+			}
+			if fi, err := os.Stat(filepath.Join(root, filepath.FromSlash(file))); err != nil || !fi.Mode().IsRegular() {
+				continue // generated by another target, or not a file
+			}
+			files = append(files, file)
+		}
+		if len(files) == 0 {
+			continue
+		}
+		sort.Strings(files)
+
+		var deps []*unit.Key
+		for _, dep := range t.deps {
+			if strings.HasPrefix(dep, ":") {
+				dep = "//" + pkg + dep
+			}
+			deps = append(deps, &unit.Key{Type: BuildTargetUnitType, Name: dep})
+		}
+		data, _ := json.Marshal(BuildTargetData{BuildSystem: buildSystem, RuleClass: t.class})
+
+		dir := pkg
+		if dir == "" {
+			dir = "."
+		}
+		units = append(units, &unit.SourceUnit{
+			Key:  unit.Key{Type: BuildTargetUnitType, Name: t.label},
+			Info: unit.Info{Dir: dir, Files: files, Dependencies: deps, Data: data},
+		})
+	}
+	return units
+}
+
+// labelPackage returns the package (directory) of the target label
+// (e.g., "foo/bar" for "//foo/bar:baz" or "//foo/bar").
+func labelPackage(label string) string {
+	label = strings.TrimPrefix(label, "//")
+	if i := strings.Index(label, ":"); i >= 0 {
+		return label[:i]
+	}
+	return label
+}
+
+// labelFile returns the repository-relative path of the source file
+// src, which is either a label or a path relative to the package pkg.
+// It returns "" for labels in other repositories.
+func labelFile(pkg, src string) string {
+	switch {
+	case strings.HasPrefix(src, "@"):
+		return ""
+	case strings.HasPrefix(src, "//"):
+		src = strings.TrimPrefix(src, "//")
+		if i := strings.Index(src, ":"); i >= 0 {
+			return path.Join(src[:i], src[i+1:])
+		}
+		return ""
+	case strings.HasPrefix(src, ":"):
+		return path.Join(pkg, src[1:])
+	}
+	return path.Join(pkg, src)
+}
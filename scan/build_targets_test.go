@@ -0,0 +1,144 @@
+package scan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// writeBuildTargetFiles creates a repository with the given files (and
+// returns its root).
+func writeBuildTargetFiles(t *testing.T, files ...string) string {
+	root, err := ioutil.TempDir("", "srclib-build-targets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		p := filepath.Join(root, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestBazelUnits(t *testing.T) {
+	root := writeBuildTargetFiles(t, "foo/a.go", "foo/sub/b.go", "bar/c.go")
+	defer os.RemoveAll(root)
+
+	out := []byte(`<?xml version="1.1" encoding="UTF-8" standalone="no"?>
+<query version="2">
+    <rule class="go_library" location="/src/foo/BUILD:1:1" name="//foo:foo">
+        <string name="name" value="foo"/>
+        <list name="srcs">
+            <label value="//foo:a.go"/>
+            <label value="//foo:sub/b.go"/>
+            <label value="//foo:generated.go"/>
+        </list>
+        <list name="deps">
+            <label value="//bar:bar"/>
+            <label value="@com_github_x_y//:go_default_library"/>
+        </list>
+    </rule>
+    <rule class="go_library" location="/src/bar/BUILD:1:1" name="//bar:bar">
+        <list name="srcs">
+            <label value="//bar:c.go"/>
+        </list>
+    </rule>
+    <rule class="genrule" location="/src/gen/BUILD:1:1" name="//gen:gen">
+        <list name="srcs">
+            <label value="//gen:in.txt"/>
+        </list>
+    </rule>
+</query>`)
+	units, err := bazelUnits(root, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(units) != 2 {
+		t.Fatalf("got %d units, want 2 (the target without source files is omitted)", len(units))
+	}
+
+	if u := units[0]; u.Name != "//bar:bar" || u.Dir != "bar" || !reflect.DeepEqual(u.Files, []string{"bar/c.go"}) || len(u.Dependencies) != 0 {
+		t.Errorf("got first unit %+v, want //bar:bar with bar/c.go", u)
+	}
+
+	u := units[1]
+	if u.Name != "//foo:foo" || u.Type != BuildTargetUnitType || u.Dir != "foo" {
+		t.Errorf("got second unit %+v, want //foo:foo in foo", u)
+	}
+	if want := []string{"foo/a.go", "foo/sub/b.go"}; !reflect.DeepEqual(u.Files, want) {
+		t.Errorf("got files %q, want %q (the generated file is omitted)", u.Files, want)
+	}
+	wantDeps := []*unit.Key{
+		{Type: BuildTargetUnitType, Name: "//bar:bar"},
+		{Type: BuildTargetUnitType, Name: "@com_github_x_y//:go_default_library"},
+	}
+	if !reflect.DeepEqual(u.Dependencies, wantDeps) {
+		t.Errorf("got dependencies %+v, want %+v", u.Dependencies, wantDeps)
+	}
+	var data BuildTargetData
+	if err := json.Unmarshal(u.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	if want := (BuildTargetData{BuildSystem: "bazel", RuleClass: "go_library"}); data != want {
+		t.Errorf("got data %+v, want %+v", data, want)
+	}
+}
+
+func TestBuckUnits(t *testing.T) {
+	root := writeBuildTargetFiles(t, "App.java", "lib/Lib.java", "lib/Util.java")
+	defer os.RemoveAll(root)
+
+	out := []byte(`{
+  "//:app": {"buck.type": "java_binary", "srcs": ["App.java"], "deps": ["//lib:lib"]},
+  "//lib:lib": {"buck.type": "java_library", "srcs": ["Util.java", "Lib.java", ":gen"], "deps": [":util"]}
+}`)
+	units, err := buckUnits(root, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*unit.SourceUnit{
+		{
+			Key:  unit.Key{Type: BuildTargetUnitType, Name: "//:app"},
+			Info: unit.Info{Dir: ".", Files: []string{"App.java"}, Dependencies: []*unit.Key{{Type: BuildTargetUnitType, Name: "//lib:lib"}}},
+		},
+		{
+			Key:  unit.Key{Type: BuildTargetUnitType, Name: "//lib:lib"},
+			Info: unit.Info{Dir: "lib", Files: []string{"lib/Lib.java", "lib/Util.java"}, Dependencies: []*unit.Key{{Type: BuildTargetUnitType, Name: "//lib:util"}}},
+		},
+	}
+	if len(units) != len(want) {
+		t.Fatalf("got %d units, want %d", len(units), len(want))
+	}
+	for i, u := range units {
+		u.Data = nil
+		if !reflect.DeepEqual(u, want[i]) {
+			t.Errorf("got unit %d %+v, want %+v", i, u, want[i])
+		}
+	}
+}
+
+func TestLabelFile(t *testing.T) {
+	tests := []struct{ pkg, src, want string }{
+		{"foo", "a.go", "foo/a.go"},
+		{"foo", ":a.go", "foo/a.go"},
+		{"foo", "//foo:sub/a.go", "foo/sub/a.go"},
+		{"", "//:a.go", "a.go"},
+		{"foo", "//bar", ""},
+		{"foo", "@x//:a.go", ""},
+	}
+	for _, test := range tests {
+		if got := labelFile(test.pkg, test.src); got != test.want {
+			t.Errorf("labelFile(%q, %q): got %q, want %q", test.pkg, test.src, got, test.want)
+		}
+	}
+}
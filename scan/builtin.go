@@ -0,0 +1,45 @@
+package scan
+
+import (
+	"fmt"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// BuiltinToolchain is the toolchain path of the scanners that are
+// built into srclib (see Builtins). Scanners with this toolchain path
+// (e.g., {"Toolchain": "srclib", "Subcmd": "compile-commands"} in a
+// Srcfile's Scanners) are run in-process instead of by running a
+// toolchain program.
+const BuiltinToolchain = "srclib"
+
+// A BuiltinScanner scans the tree in the current directory for source
+// units. It is passed the tree config, as scanner programs are.
+type BuiltinScanner func(treeConfig map[string]interface{}) ([]*unit.SourceUnit, error)
+
+// Builtins maps the subcommand name of each built-in scanner to its
+// implementation.
+var Builtins = map[string]BuiltinScanner{}
+
+// DefaultBuiltins lists the subcommand names of the built-in scanners
+// that are run by default: when a Srcfile doesn't list its Scanners,
+// they are run after the scanners of the installed toolchains.
+var DefaultBuiltins []string
+
+// Command returns the command (as passed to Scan and ScanMulti) that
+// runs the scanner ref.
+func Command(ref *srclib.ToolRef) ([]string, error) {
+	if ref.Toolchain == BuiltinToolchain {
+		if _, present := Builtins[ref.Subcmd]; !present {
+			return nil, fmt.Errorf("no built-in scanner named %q", ref.Subcmd)
+		}
+		return []string{BuiltinToolchain, ref.Subcmd}, nil
+	}
+	cmdName, err := toolchain.Command(ref.Toolchain)
+	if err != nil {
+		return nil, err
+	}
+	return []string{cmdName, ref.Subcmd}, nil
+}
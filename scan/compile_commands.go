@@ -0,0 +1,266 @@
+package scan
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func init() {
+	Builtins["compile-commands"] = scanCompileCommands
+}
+
+// CompileCommandsUnitType is the type of the source units emitted by
+// the built-in compile-commands scanner. It reads a JSON compilation
+// database (compile_commands.json, as written by CMake with
+// -DCMAKE_EXPORT_COMPILE_COMMANDS=ON, Bear, and other build tools) and
+// emits a source unit for each directory that contains source files
+// that are compiled, so that C and C++ toolchains can graph the units
+// with the include paths and macro definitions that the build uses.
+//
+// The compilation database is read from the file named by the
+// "CompileCommands" key in the tree config (the Srcfile's Config), or
+// else from compile_commands.json or build/compile_commands.json.
+// Source files that aren't in the repository are omitted.
+const CompileCommandsUnitType = "CompileCommands"
+
+// CompileCommandsData is the Data of the source units emitted by the
+// compile-commands scanner (see CompileCommandsUnitType).
+type CompileCommandsData struct {
+	// IncludeDirs and Defines are the include directories (from -I,
+	// -isystem, -iquote, and -idirafter flags) and macro definitions
+	// (from -D flags, such as "NDEBUG" or "VERSION=2") of all of the
+	// unit's compile commands, in the order they first appear.
+	IncludeDirs []string `json:",omitempty"`
+	Defines     []string `json:",omitempty"`
+
+	// Commands lists the compile command of each of the unit's files.
+	Commands []*CompileCommand
+}
+
+// CompileCommand is a command that compiles a source file. Paths in
+// the repository are relative to its root (with forward slashes);
+// other paths are absolute.
+type CompileCommand struct {
+	File      string
+	Directory string   // the directory the command is run in
+	Arguments []string // the command, starting with the compiler
+}
+
+// compileCommandsFiles are the default locations of the compilation
+// database.
+var compileCommandsFiles = []string{"compile_commands.json", "build/compile_commands.json"}
+
+func scanCompileCommands(treeConfig map[string]interface{}) ([]*unit.SourceUnit, error) {
+	file, _ := treeConfig["CompileCommands"].(string)
+	if file == "" {
+		for _, f := range compileCommandsFiles {
+			if _, err := os.Stat(f); err == nil {
+				file = f
+				break
+			}
+		}
+		if file == "" {
+			return nil, nil
+		}
+	}
+	root, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []*compileCommandsEntry
+	if err := json.NewDecoder(f).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	return compileCommandsUnits(root, entries)
+}
+
+// compileCommandsEntry is an entry in a JSON compilation database (see
+// https://clang.llvm.org/docs/JSONCompilationDatabase.html).
+type compileCommandsEntry struct {
+	Directory string   `json:"directory"`
+	File      string   `json:"file"`
+	Arguments []string `json:"arguments"`
+	Command   string   `json:"command"`
+}
+
+// compileCommandsUnits groups the compile commands in entries (for the
+// repository whose root is the absolute path root) into source units
+// by the directories of their source files.
+func compileCommandsUnits(root string, entries []*compileCommandsEntry) ([]*unit.SourceUnit, error) {
+	// repoPath returns p (relative to dir) relative to the repository
+	// root, or the absolute p and false if it's not in the repository.
+	repoPath := func(dir, p string) (string, bool) {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.ToSlash(filepath.Clean(p)), false
+		}
+		return filepath.ToSlash(rel), true
+	}
+
+	groups := map[string]*CompileCommandsData{}
+	files := map[string][]string{}
+	for _, e := range entries {
+		args := e.Arguments
+		if len(args) == 0 {
+			var err error
+			if args, err = splitCommand(e.Command); err != nil {
+				return nil, fmt.Errorf("compile command for %s: %s", e.File, err)
+			}
+		}
+		dir := e.Directory
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(root, dir)
+		}
+		file, inRepo := repoPath(dir, e.File)
+		if !inRepo {
+			continue
+		}
+		relDir, _ := repoPath(root, dir)
+
+		unitDir := path.Dir(file)
+		g := groups[unitDir]
+		if g == nil {
+			g = &CompileCommandsData{}
+			groups[unitDir] = g
+		}
+		if !containsString(files[unitDir], file) {
+			files[unitDir] = append(files[unitDir], file)
+		}
+		g.Commands = append(g.Commands, &CompileCommand{File: file, Directory: relDir, Arguments: args})
+
+		includeDirs, defines := compileFlags(args)
+		for _, inc := range includeDirs {
+			inc, _ = repoPath(dir, inc)
+			if !containsString(g.IncludeDirs, inc) {
+				g.IncludeDirs = append(g.IncludeDirs, inc)
+			}
+		}
+		for _, def := range defines {
+			if !containsString(g.Defines, def) {
+				g.Defines = append(g.Defines, def)
+			}
+		}
+	}
+
+	dirs := make([]string, 0, len(groups))
+	for dir := range groups {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	units := make([]*unit.SourceUnit, len(dirs))
+	for i, dir := range dirs {
+		data, err := json.Marshal(groups[dir])
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files[dir])
+		units[i] = &unit.SourceUnit{
+			Key:  unit.Key{Type: CompileCommandsUnitType, Name: dir},
+			Info: unit.Info{Dir: dir, Files: files[dir], Data: data},
+		}
+	}
+	return units, nil
+}
+
+// compileFlags returns the include directories and macro definitions
+// in the compiler arguments args.
+func compileFlags(args []string) (includeDirs, defines []string) {
+	includeFlags := []string{"-isystem", "-iquote", "-idirafter", "-I"}
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		// value returns the value of the flag, which is either
+		// attached to it or the next argument.
+		value := func(flag string) string {
+			if v := arg[len(flag):]; v != "" {
+				return v
+			}
+			if i+1 < len(args) {
+				i++
+				return args[i]
+			}
+			return ""
+		}
+		if strings.HasPrefix(arg, "-D") {
+			if v := value("-D"); v != "" {
+				defines = append(defines, v)
+			}
+			continue
+		}
+		for _, flag := range includeFlags {
+			if strings.HasPrefix(arg, flag) {
+				if v := value(flag); v != "" {
+					includeDirs = append(includeDirs, v)
+				}
+				break
+			}
+		}
+	}
+	return includeDirs, defines
+}
+
+// splitCommand splits a shell command line into words, handling
+// single and double quotes and backslash escapes (but not variables or
+// other shell syntax).
+func splitCommand(s string) ([]string, error) {
+	var words []string
+	var word []rune
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, c := range s {
+		switch {
+		case escaped:
+			word = append(word, c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word = append(word, c)
+			}
+		case c == '\'' || c == '"':
+			quote, inWord = c, true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, string(word))
+				word, inWord = nil, false
+			}
+		default:
+			word = append(word, c)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in command %q", s)
+	}
+	if inWord {
+		words = append(words, string(word))
+	}
+	return words, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package scan
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCompileCommandsUnits(t *testing.T) {
+	entries := []*compileCommandsEntry{
+		{Directory: "/src/build", File: "../lib/a.c", Command: `cc -I../include -isystem /usr/include/x -DNDEBUG -D 'NAME="a b"' -c ../lib/a.c`},
+		{Directory: "/src/build", File: "/src/lib/b.c", Arguments: []string{"cc", "-I", "../include", "-DX=1", "-c", "/src/lib/b.c"}},
+		{Directory: "/src", File: "main.c", Arguments: []string{"cc", "-c", "main.c"}},
+		{Directory: "/src/build", File: "/tmp/generated.c", Arguments: []string{"cc", "-c", "/tmp/generated.c"}},
+	}
+	units, err := compileCommandsUnits("/src", entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(units) != 2 {
+		t.Fatalf("got %d units, want 2 (the file outside the repository is omitted)", len(units))
+	}
+
+	if u := units[0]; u.Name != "." || u.Type != CompileCommandsUnitType || !reflect.DeepEqual(u.Files, []string{"main.c"}) {
+		t.Errorf("got first unit %+v, want unit . with main.c", u)
+	}
+
+	u := units[1]
+	if u.Name != "lib" || u.Dir != "lib" || !reflect.DeepEqual(u.Files, []string{"lib/a.c", "lib/b.c"}) {
+		t.Errorf("got second unit %+v, want unit lib with lib/a.c and lib/b.c", u)
+	}
+	var data CompileCommandsData
+	if err := json.Unmarshal(u.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"include", "/usr/include/x"}; !reflect.DeepEqual(data.IncludeDirs, want) {
+		t.Errorf("got include dirs %q, want %q", data.IncludeDirs, want)
+	}
+	if want := []string{"NDEBUG", `NAME="a b"`, "X=1"}; !reflect.DeepEqual(data.Defines, want) {
+		t.Errorf("got defines %q, want %q", data.Defines, want)
+	}
+	if len(data.Commands) != 2 || data.Commands[0].File != "lib/a.c" || data.Commands[0].Directory != "build" || data.Commands[0].Arguments[0] != "cc" {
+		t.Errorf("got commands %+v, want the commands for lib/a.c and lib/b.c, run in build", data.Commands)
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	tests := map[string][]string{
+		`cc -c a.c`:                  {"cc", "-c", "a.c"},
+		`cc  -D'A B' "-DC=\"d\""`:    {"cc", "-DA B", `-DC="d"`},
+		`cc -I dir\ with\ spaces ''`: {"cc", "-I", "dir with spaces", ""},
+	}
+	for cmd, want := range tests {
+		got, err := splitCommand(cmd)
+		if err != nil {
+			t.Errorf("%s: %s", cmd, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %q, want %q", cmd, got, want)
+		}
+	}
+	if _, err := splitCommand(`cc "unterminated`); err == nil {
+		t.Error("got no error for an unterminated quote")
+	}
+}
@@ -8,17 +8,30 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"reflect"
 	"runtime"
 	"sync"
 
 	"github.com/neelance/parallel"
 	"sourcegraph.com/sourcegraph/srclib/flagutil"
+	"sourcegraph.com/sourcegraph/srclib/graph"
 	"sourcegraph.com/sourcegraph/srclib/unit"
+	"sourcegraph.com/sourcegraph/srclib/util"
 )
 
+// SymlinksEnvVar is the environment variable that holds the symlink
+// policy (see util.SymlinkPolicy) for scanner programs, which should
+// heed it when walking the tree.
+const SymlinksEnvVar = "SRCLIB_SYMLINKS"
+
 type Options struct {
 	// Quiet silences all output.
 	Quiet bool
+
+	// Symlinks is the symlink policy that scanners should use. It is
+	// passed to scanner programs in $SRCLIB_SYMLINKS (see
+	// SymlinksEnvVar), not as a flag.
+	Symlinks util.SymlinkPolicy `no-flag:"true"`
 }
 
 // ScanMulti runs multiple scanner tools in parallel. It passes command-line
@@ -30,8 +43,9 @@ func ScanMulti(scanners [][]string, opt Options, treeConfig map[string]interface
 	}
 
 	var (
-		units []*unit.SourceUnit
-		mu    sync.Mutex
+		units   []*unit.SourceUnit
+		origins = map[*unit.SourceUnit][]string{} // unit -> scanner that emitted it
+		mu      sync.Mutex
 	)
 
 	run := parallel.NewRun(runtime.GOMAXPROCS(0))
@@ -50,6 +64,9 @@ func ScanMulti(scanners [][]string, opt Options, treeConfig map[string]interface
 			mu.Lock()
 			defer mu.Unlock()
 			units = append(units, units2...)
+			for _, u := range units2 {
+				origins[u] = scanner
+			}
 		}()
 	}
 	err := run.Wait()
@@ -57,10 +74,72 @@ func ScanMulti(scanners [][]string, opt Options, treeConfig map[string]interface
 	if len(units) == 0 {
 		return nil, err
 	}
-	return units, nil
+	return checkCollisions(units, origins)
+}
+
+// A CollisionError is returned by ScanMulti when two distinct source
+// units have the same ID. Build data is stored by unit name and type,
+// so the units' build data would overwrite each other.
+type CollisionError struct {
+	ID unit.ID
+
+	// A and B are the colliding source units, and ScannerA and
+	// ScannerB are the scanners that emitted them.
+	A, B               *unit.SourceUnit
+	ScannerA, ScannerB []string
+}
+
+func (e *CollisionError) Error() string {
+	return fmt.Sprintf("source unit ID collision: %q was emitted for %s and for %s (source unit IDs must be unique; see unit.SourceUnit.ID)", e.ID, describeOrigin(e.A, e.ScannerA), describeOrigin(e.B, e.ScannerB))
+}
+
+// describeOrigin describes where the source unit u came from, for
+// CollisionError messages.
+func describeOrigin(u *unit.SourceUnit, scanner []string) string {
+	var files string
+	switch len(u.Files) {
+	case 0:
+		files = "no files"
+	case 1:
+		files = fmt.Sprintf("file %s", u.Files[0])
+	default:
+		files = fmt.Sprintf("%d files (%s, ...)", len(u.Files), u.Files[0])
+	}
+	dir := u.Dir
+	if dir == "" {
+		dir = "."
+	}
+	return fmt.Sprintf("dir %s with %s by scanner %v", dir, files, scanner)
+}
+
+// checkCollisions returns a *CollisionError if two units have the
+// same ID. Units with the same ID that are identical (such as a unit
+// emitted by two scanners) are not collisions; only the first of them
+// is kept in the returned units.
+func checkCollisions(units []*unit.SourceUnit, origins map[*unit.SourceUnit][]string) ([]*unit.SourceUnit, error) {
+	seen := make(map[unit.ID]*unit.SourceUnit, len(units))
+	uniq := units[:0]
+	for _, u := range units {
+		id := u.ID()
+		if u0, present := seen[id]; present {
+			if reflect.DeepEqual(u0, u) {
+				continue
+			}
+			return nil, &CollisionError{ID: id, A: u0, B: u, ScannerA: origins[u0], ScannerB: origins[u]}
+		}
+		seen[id] = u
+		uniq = append(uniq, u)
+	}
+	return uniq, nil
 }
 
 func Scan(scanner []string, opt Options, treeConfig map[string]interface{}) ([]*unit.SourceUnit, error) {
+	if scanner[0] == BuiltinToolchain {
+		if fn, present := Builtins[scanner[1]]; present {
+			return fn(treeConfig)
+		}
+	}
+
 	args, err := flagutil.MarshalArgs(&opt)
 	if err != nil {
 		return nil, fmt.Errorf("marshalling arguments for the scanner failed with: %s", err)
@@ -69,6 +148,9 @@ func Scan(scanner []string, opt Options, treeConfig map[string]interface{}) ([]*
 	var errw bytes.Buffer
 	cmd := exec.Command(scanner[0], scanner[1])
 	cmd.Args = append(cmd.Args, args...)
+	if opt.Symlinks != "" {
+		cmd.Env = append(os.Environ(), SymlinksEnvVar+"="+string(opt.Symlinks))
+	}
 	if opt.Quiet {
 		cmd.Stderr = &errw
 	} else {
@@ -114,5 +196,13 @@ func Scan(scanner []string, opt Options, treeConfig map[string]interface{}) ([]*
 		return nil, fmt.Errorf("waiting on the scanner failed with: %s", err)
 	}
 
+	// Scanners are run in the repository root, so the files they
+	// report are relative to it.
+	for _, u := range units {
+		for i, f := range u.Files {
+			u.Files[i] = graph.ResolveFile(".", f)
+		}
+	}
+
 	return units, nil
 }
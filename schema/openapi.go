@@ -0,0 +1,310 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// openAPIMethods are the HTTP methods of the operations in an OpenAPI
+// path item.
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// openAPISections are the top-level (Swagger 2) and "components"
+// (OpenAPI 3) sections whose members are defs, and their raw kinds.
+var openAPISections = map[string]string{
+	"definitions":                "schema",
+	"parameters":                 "parameter",
+	"responses":                  "response",
+	"securityDefinitions":        "security scheme",
+	"components/schemas":         "schema",
+	"components/parameters":      "parameter",
+	"components/responses":       "response",
+	"components/requestBodies":   "request body",
+	"components/headers":         "header",
+	"components/examples":        "example",
+	"components/links":           "link",
+	"components/callbacks":       "callback",
+	"components/securitySchemes": "security scheme",
+}
+
+// GraphOpenAPI graphs the OpenAPI source unit u (see OpenAPIUnitType).
+// It emits defs for the operations (under "paths") and for the
+// schemas, parameters, responses, and other reusable components of
+// the document, and refs from their $refs. Def paths are the JSON
+// pointers of the defs without the leading "#/" (e.g.,
+// "components/schemas/Pet" and "paths/~1pets~1{petId}/get"), so that
+// the fragments of $refs are the def paths they refer to. $refs to
+// other documents refer to the OpenAPI units of those documents.
+//
+// Documents may be written in JSON or in YAML (see
+// config.ReadDocument).
+func GraphOpenAPI(u *unit.SourceUnit) (*graph.Output, error) {
+	out := &graph.Output{}
+	for _, file := range u.Files {
+		if err := graphOpenAPIFile(u, file, out); err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+	}
+	return out, nil
+}
+
+func graphOpenAPIFile(u *unit.SourceUnit, file string, out *graph.Output) error {
+	data, err := ioutil.ReadFile(filepath.FromSlash(file))
+	if err != nil {
+		return err
+	}
+	jsonData, offsets, err := config.ReadDocument(file, data)
+	if err != nil {
+		return err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(jsonData, &doc); err != nil {
+		return err
+	}
+	g := &openAPIGrapher{unit: u, file: file, data: data, offsets: offsets, out: out, paths: map[string]bool{}}
+
+	// Operations.
+	pathItems, _ := doc["paths"].(map[string]interface{})
+	for _, apiPath := range sortedKeys(pathItems) {
+		item, _ := pathItems[apiPath].(map[string]interface{})
+		for _, method := range openAPIMethods {
+			op, ok := item[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _ := op["operationId"].(string)
+			if name == "" {
+				name = strings.ToUpper(method) + " " + apiPath
+			}
+			g.addDef([]string{"paths", apiPath, method}, name, graph.KindFunction, "operation")
+		}
+	}
+
+	// Reusable components.
+	sections := make([]string, 0, len(openAPISections))
+	for section := range openAPISections {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	for _, section := range sections {
+		keys := strings.Split(section, "/")
+		var members map[string]interface{}
+		if len(keys) == 1 {
+			members, _ = doc[keys[0]].(map[string]interface{})
+		} else if parent, ok := doc[keys[0]].(map[string]interface{}); ok {
+			members, _ = parent[keys[1]].(map[string]interface{})
+		}
+		rawKind := openAPISections[section]
+		kind := graph.KindOther
+		if rawKind == "schema" {
+			kind = graph.KindType
+		}
+		for _, name := range sortedKeys(members) {
+			g.addDef(append(keys, name), name, kind, rawKind)
+		}
+	}
+
+	g.refs(doc, "")
+	return nil
+}
+
+type openAPIGrapher struct {
+	unit    *unit.SourceUnit
+	file    string
+	data    []byte
+	offsets map[string]int // see config.ReadDocument
+	out     *graph.Output
+	paths   map[string]bool // def paths of the defs in the document
+}
+
+// addDef adds the def at the JSON pointer whose (unescaped) reference
+// tokens are keys, and a def ref at its key.
+func (g *openAPIGrapher) addDef(keys []string, name, kind, rawKind string) {
+	defPath := openAPIPointer(keys)
+	if g.paths[defPath] {
+		return
+	}
+	g.paths[defPath] = true
+	start, end := g.keySpan(keys)
+	def := &graph.Def{
+		DefKey:   graph.DefKey{UnitType: g.unit.Type, Unit: g.unit.Name, Path: defPath},
+		Name:     name,
+		Kind:     kind,
+		RawKind:  rawKind,
+		File:     g.file,
+		DefStart: uint32(start),
+		DefEnd:   uint32(end),
+		Exported: true,
+	}
+	g.out.Defs = append(g.out.Defs, def)
+	if end > start {
+		g.out.Refs = append(g.out.Refs, &graph.Ref{
+			DefUnitType: def.UnitType,
+			DefUnit:     def.Unit,
+			DefPath:     def.Path,
+			UnitType:    g.unit.Type,
+			Unit:        g.unit.Name,
+			Def:         true,
+			File:        g.file,
+			Start:       uint32(start),
+			End:         uint32(end),
+		})
+	}
+}
+
+// keySpan returns the offsets of the last of the keys (of the value at
+// the path formed by keys) in the document, or 0, 0 if it isn't found.
+func (g *openAPIGrapher) keySpan(keys []string) (start, end int) {
+	var p string
+	for _, k := range keys {
+		p += "/" + strings.ToLower(k)
+	}
+	off, ok := g.offsets[p]
+	if !ok {
+		return 0, 0
+	}
+	return g.find(off, keys[len(keys)-1])
+}
+
+// find returns the offsets of the first occurrence of s in the
+// document at or after off (on the same line), or 0, 0 if there is
+// none.
+func (g *openAPIGrapher) find(off int, s string) (start, end int) {
+	if off < 0 || off > len(g.data) || s == "" {
+		return 0, 0
+	}
+	line := g.data[off:]
+	if i := bytes.IndexByte(line, '\n'); i != -1 {
+		line = line[:i]
+	}
+	i := bytes.Index(line, []byte(s))
+	if i == -1 {
+		return 0, 0
+	}
+	return off + i, off + i + len(s)
+}
+
+// refs adds refs for the $refs in the value v, whose lowercased path
+// (as in config.ReadDocument) is p.
+func (g *openAPIGrapher) refs(v interface{}, p string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(v) {
+			kp := p + "/" + strings.ToLower(k)
+			if ref, ok := v[k].(string); ok && k == "$ref" {
+				g.ref(ref, kp)
+				continue
+			}
+			g.refs(v[k], kp)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			g.refs(elem, fmt.Sprintf("%s/%d", p, i))
+		}
+	}
+}
+
+// ref adds a ref for the $ref value ref, whose member's path is p.
+func (g *openAPIGrapher) ref(ref, p string) {
+	defUnit, defPath, ok := resolveOpenAPIRef(g.file, ref)
+	if !ok {
+		return
+	}
+	if defUnit == g.unit.Name && !g.paths[defPath] {
+		return // not a def (e.g., a property of a schema)
+	}
+	off, ok := g.offsets[p]
+	if !ok {
+		return
+	}
+	// The offset is that of the "$ref" key; the ref spans its value.
+	start, end := g.find(off+len("$ref"), ref)
+	if end == 0 {
+		return
+	}
+	g.out.Refs = append(g.out.Refs, &graph.Ref{
+		DefUnitType: OpenAPIUnitType,
+		DefUnit:     defUnit,
+		DefPath:     defPath,
+		UnitType:    g.unit.Type,
+		Unit:        g.unit.Name,
+		File:        g.file,
+		Start:       uint32(start),
+		End:         uint32(end),
+	})
+}
+
+// resolveOpenAPIRef returns the unit (the document's path) and def
+// path that the $ref value ref in file refers to. It returns false if
+// ref doesn't refer to a def (such as a $ref to a whole document or to
+// a URL).
+func resolveOpenAPIRef(file, ref string) (defUnit, defPath string, ok bool) {
+	i := strings.Index(ref, "#")
+	if i == -1 {
+		return "", "", false
+	}
+	doc, frag := ref[:i], ref[i+1:]
+	if !strings.HasPrefix(frag, "/") || strings.Contains(doc, ":") {
+		return "", "", false
+	}
+	frag, err := graph.UnescapePath(frag[1:])
+	if err != nil || !isOpenAPIDefPath(frag) {
+		return "", "", false
+	}
+	if doc == "" {
+		return file, frag, true
+	}
+	doc = path.Join(path.Dir(file), doc)
+	if doc == ".." || strings.HasPrefix(doc, "../") {
+		return "", "", false
+	}
+	return doc, frag, true
+}
+
+// isOpenAPIDefPath reports whether the JSON pointer p (without the
+// leading "/") is the path of an operation or a reusable component.
+func isOpenAPIDefPath(p string) bool {
+	keys := strings.Split(p, "/")
+	if len(keys) == 3 && keys[0] == "paths" {
+		for _, m := range openAPIMethods {
+			if keys[2] == m {
+				return true
+			}
+		}
+		return false
+	}
+	if len(keys) < 2 {
+		return false
+	}
+	_, present := openAPISections[strings.Join(keys[:len(keys)-1], "/")]
+	return present
+}
+
+// openAPIPointer returns the JSON pointer (without the leading "/")
+// whose unescaped reference tokens are keys.
+func openAPIPointer(keys []string) string {
+	escaped := make([]string, len(keys))
+	for i, k := range keys {
+		escaped[i] = strings.Replace(strings.Replace(k, "~", "~0", -1), "/", "~1", -1)
+	}
+	return strings.Join(escaped, "/")
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,78 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph/graphtest"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestGraphOpenAPI(t *testing.T) {
+	tests := map[string]struct {
+		defs, refs []string
+	}{
+		"testdata/openapi/petstore.yaml": {
+			defs: []string{
+				"components/schemas/Person",
+				"components/schemas/Pet",
+				"paths/~1pets~1{petId}/get",
+			},
+			refs: []string{
+				"#/components/schemas/Person -> testdata/openapi/petstore.yaml components/schemas/Person",
+				"#/components/schemas/Pet -> testdata/openapi/petstore.yaml components/schemas/Pet",
+				"common.json#/definitions/Person -> testdata/openapi/common.json definitions/Person",
+			},
+		},
+		"testdata/openapi/common.json": {
+			defs: []string{
+				"definitions/Person",
+				"paths/~1people/post",
+			},
+			refs: []string{
+				"#/definitions/Person -> testdata/openapi/common.json definitions/Person",
+			},
+		},
+	}
+	for file, test := range tests {
+		u := &unit.SourceUnit{
+			Key:  unit.Key{Type: OpenAPIUnitType, Name: file},
+			Info: unit.Info{Dir: "testdata/openapi", Files: []string{file}},
+		}
+		o, err := GraphOpenAPI(u)
+		if err != nil {
+			t.Errorf("%s: %s", file, err)
+			continue
+		}
+		defs, refs := graphtest.DescribeOutput(t, o)
+		if !reflect.DeepEqual(defs, test.defs) {
+			t.Errorf("%s: got defs\n%s\n\nwant\n%s", file, strings.Join(defs, "\n"), strings.Join(test.defs, "\n"))
+		}
+		if !reflect.DeepEqual(refs, test.refs) {
+			t.Errorf("%s: got refs\n%s\n\nwant\n%s", file, strings.Join(refs, "\n"), strings.Join(test.refs, "\n"))
+		}
+	}
+}
+
+func TestResolveOpenAPIRef(t *testing.T) {
+	tests := []struct {
+		ref           string
+		unit, defPath string
+	}{
+		{ref: "#/components/schemas/Pet", unit: "api/a.yaml", defPath: "components/schemas/Pet"},
+		{ref: "#/components/schemas/Pet%20Store", unit: "api/a.yaml", defPath: "components/schemas/Pet Store"},
+		{ref: "../common/b.yaml#/definitions/X", unit: "common/b.yaml", defPath: "definitions/X"},
+		{ref: "#/paths/~1pets/get", unit: "api/a.yaml", defPath: "paths/~1pets/get"},
+		{ref: "#/components/schemas/Pet/properties/name"},
+		{ref: "b.yaml"},
+		{ref: "https://example.com/a.yaml#/definitions/X"},
+		{ref: "../../x.yaml#/definitions/X"},
+	}
+	for _, test := range tests {
+		u, p, ok := resolveOpenAPIRef("api/a.yaml", test.ref)
+		if ok != (test.unit != "") || u != test.unit || p != test.defPath {
+			t.Errorf("%q: got %q %q %v, want %q %q", test.ref, u, p, ok, test.unit, test.defPath)
+		}
+	}
+}
@@ -0,0 +1,717 @@
+package schema
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// GraphProtobuf graphs the Protobuf source unit u (see
+// ProtobufUnitType). It emits defs for each file (whose def path is
+// the file's name), message, field, enum, enum value, service, rpc, and
+// extension, and refs from field and rpc types, custom option names,
+// and import statements. The def paths of messages and other named
+// elements are their fully qualified names with "/" in place of "."
+// (e.g., "helloworld/Greeter/SayHello").
+//
+// Imported files are found relative to the directory of the importing
+// file or any of its parent directories, and refs to the elements
+// defined in them refer to the Protobuf units of their directories.
+// Names that can't be resolved (such as those in imported files that
+// aren't in the repository) have no refs.
+func GraphProtobuf(u *unit.SourceUnit) (*graph.Output, error) {
+	// Parse the unit's files and the files they import (transitively).
+	files := map[string]*protoFile{}
+	queue := append([]string{}, u.Files...)
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+		if _, seen := files[file]; seen {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.FromSlash(file))
+		if err != nil {
+			if containsString(u.Files, file) {
+				return nil, err
+			}
+			files[file] = nil // an unreadable import
+			continue
+		}
+		pf := parseProto(data)
+		files[file] = pf
+		for _, imp := range pf.imports {
+			imp.resolved = resolveProtoImport(file, imp.path)
+			if imp.resolved != "" {
+				queue = append(queue, imp.resolved)
+			}
+		}
+	}
+
+	// Index the named elements that can be referred to, in a
+	// deterministic order so that the first of any duplicates wins.
+	names := make([]string, 0, len(files))
+	for file := range files {
+		names = append(names, file)
+	}
+	sort.Strings(names)
+	symbols := map[string]*protoSymbol{}
+	for _, file := range names {
+		pf := files[file]
+		if pf == nil {
+			continue
+		}
+		unitName := path.Dir(file)
+		for _, d := range pf.defs {
+			if d.rawKind == "field" || d.rawKind == "enum value" || d.rawKind == "rpc" {
+				continue
+			}
+			if _, dup := symbols[d.fullName]; !dup {
+				symbols[d.fullName] = &protoSymbol{unit: unitName, path: protoDefPath(d.fullName), extension: d.rawKind == "extension"}
+			}
+		}
+	}
+
+	g := &protoGrapher{unit: u, out: &graph.Output{}, paths: map[string]bool{}}
+	for _, file := range u.Files {
+		pf := files[file]
+		if pf == nil {
+			continue
+		}
+		g.addDef(&graph.Def{
+			DefKey:   graph.DefKey{Path: path.Base(file)},
+			Name:     path.Base(file),
+			Kind:     graph.KindModule,
+			RawKind:  "file",
+			File:     file,
+			DefStart: 0,
+			DefEnd:   uint32(pf.size),
+		}, file, 0, 0)
+		for _, d := range pf.defs {
+			g.addDef(&graph.Def{
+				DefKey:   graph.DefKey{Path: protoDefPath(d.fullName)},
+				Name:     d.name,
+				Kind:     d.kind,
+				RawKind:  d.rawKind,
+				File:     file,
+				DefStart: uint32(d.start),
+				DefEnd:   uint32(d.end),
+			}, file, d.nameStart, d.nameEnd)
+		}
+		for _, imp := range pf.imports {
+			if imp.resolved == "" || files[imp.resolved] == nil {
+				continue
+			}
+			g.addRef(file, imp.start, imp.end, path.Dir(imp.resolved), path.Base(imp.resolved))
+		}
+		for _, r := range pf.refs {
+			if sym := resolveProtoName(symbols, r.name, r.scope, r.option); sym != nil {
+				g.addRef(file, r.start, r.end, sym.unit, sym.path)
+			}
+		}
+	}
+	return g.out, nil
+}
+
+type protoGrapher struct {
+	unit  *unit.SourceUnit
+	out   *graph.Output
+	paths map[string]bool // def paths of the defs added so far
+}
+
+// addDef adds def (and a def ref at nameStart-nameEnd, unless the name
+// has no position) to the output, unless a def with the same path was
+// already added.
+func (g *protoGrapher) addDef(def *graph.Def, file string, nameStart, nameEnd int) {
+	if g.paths[def.Path] {
+		return
+	}
+	g.paths[def.Path] = true
+	def.UnitType = g.unit.Type
+	def.Unit = g.unit.Name
+	def.Exported = true
+	g.out.Defs = append(g.out.Defs, def)
+	if nameEnd > nameStart {
+		g.out.Refs = append(g.out.Refs, &graph.Ref{
+			DefUnitType: def.UnitType,
+			DefUnit:     def.Unit,
+			DefPath:     def.Path,
+			UnitType:    g.unit.Type,
+			Unit:        g.unit.Name,
+			Def:         true,
+			File:        file,
+			Start:       uint32(nameStart),
+			End:         uint32(nameEnd),
+		})
+	}
+}
+
+func (g *protoGrapher) addRef(file string, start, end int, defUnit, defPath string) {
+	g.out.Refs = append(g.out.Refs, &graph.Ref{
+		DefUnitType: ProtobufUnitType,
+		DefUnit:     defUnit,
+		DefPath:     defPath,
+		UnitType:    g.unit.Type,
+		Unit:        g.unit.Name,
+		File:        file,
+		Start:       uint32(start),
+		End:         uint32(end),
+	})
+}
+
+// A protoSymbol is a named element (message, enum, service, or
+// extension) that can be referred to.
+type protoSymbol struct {
+	unit, path string
+	extension  bool
+}
+
+// protoDefPath returns the def path of the element with the fully
+// qualified name fullName.
+func protoDefPath(fullName string) string {
+	return strings.Replace(fullName, ".", "/", -1)
+}
+
+// resolveProtoName returns the element that the name (a type name, or
+// an extension name if option is true) refers to in the scope (the
+// fully qualified name of the message or package it appears in), as
+// protoc resolves names: a name that begins with "." is fully
+// qualified, and other names are looked up in the scope and then in
+// each of its enclosing scopes.
+func resolveProtoName(symbols map[string]*protoSymbol, name, scope string, option bool) *protoSymbol {
+	lookup := func(fullName string) *protoSymbol {
+		if sym := symbols[fullName]; sym != nil && sym.extension == option {
+			return sym
+		}
+		return nil
+	}
+	if strings.HasPrefix(name, ".") {
+		return lookup(name[1:])
+	}
+	for {
+		fullName := name
+		if scope != "" {
+			fullName = scope + "." + name
+		}
+		if sym := lookup(fullName); sym != nil {
+			return sym
+		}
+		if scope == "" {
+			return nil
+		}
+		if i := strings.LastIndex(scope, "."); i != -1 {
+			scope = scope[:i]
+		} else {
+			scope = ""
+		}
+	}
+}
+
+// resolveProtoImport returns the path (relative to the repository
+// root) of the file imported as imp by file, or "" if it isn't found.
+// It looks for imp relative to the directory of file and each of its
+// parent directories.
+func resolveProtoImport(file, imp string) string {
+	imp = path.Clean(imp)
+	if path.IsAbs(imp) || imp == ".." || strings.HasPrefix(imp, "../") {
+		return ""
+	}
+	for dir := path.Dir(file); ; dir = path.Dir(dir) {
+		p := path.Join(dir, imp)
+		if fileExists(p) {
+			return p
+		}
+		if dir == "." || dir == "/" {
+			return ""
+		}
+	}
+}
+
+// A protoFile is the result of parsing a .proto file.
+type protoFile struct {
+	pkg     string
+	imports []*protoImport
+	defs    []*protoDef
+	refs    []*protoRef
+	size    int
+}
+
+type protoImport struct {
+	path       string
+	start, end int    // offsets of the path (without quotes)
+	resolved   string // path of the imported file, if found
+}
+
+type protoDef struct {
+	fullName, name     string
+	kind, rawKind      string
+	start, end         int // offsets of the whole definition
+	nameStart, nameEnd int
+}
+
+type protoRef struct {
+	name       string
+	scope      string // fully qualified name of the enclosing scope
+	option     bool   // whether name is an extension (in an option)
+	start, end int
+}
+
+// protoScalarTypes are the scalar value types, which aren't refs.
+var protoScalarTypes = map[string]bool{
+	"double": true, "float": true, "int32": true, "int64": true, "uint32": true, "uint64": true,
+	"sint32": true, "sint64": true, "fixed32": true, "fixed64": true, "sfixed32": true, "sfixed64": true,
+	"bool": true, "string": true, "bytes": true,
+}
+
+// parseProto parses the .proto file data. Statements that it doesn't
+// understand (or that are malformed) are skipped.
+func parseProto(data []byte) *protoFile {
+	p := &protoParser{toks: lexProto(data), f: &protoFile{size: len(data)}}
+	for !p.done() {
+		p.topLevel()
+	}
+	return p.f
+}
+
+type protoParser struct {
+	toks []protoToken
+	i    int
+	f    *protoFile
+}
+
+func (p *protoParser) done() bool { return p.i >= len(p.toks) }
+
+func (p *protoParser) peek() protoToken {
+	if p.done() {
+		return protoToken{start: -1}
+	}
+	return p.toks[p.i]
+}
+
+func (p *protoParser) next() protoToken {
+	t := p.peek()
+	if !p.done() {
+		p.i++
+	}
+	return t
+}
+
+// accept consumes the next token if its text is s.
+func (p *protoParser) accept(s string) bool {
+	if t := p.peek(); t.start >= 0 && t.kind != tokString && t.text == s {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// skip skips to the end of the current statement: past the next ";"
+// or balanced "{...}" block at the current nesting level. It stops
+// before a "}" that closes the enclosing block.
+func (p *protoParser) skip() {
+	for !p.done() {
+		t := p.peek()
+		if t.kind == tokString {
+			p.i++
+			continue
+		}
+		switch t.text {
+		case ";":
+			p.i++
+			return
+		case "}":
+			return
+		case "{":
+			p.skipBlock()
+			return
+		}
+		p.i++
+	}
+}
+
+// skipBlock skips the balanced "{...}" block that begins at the next
+// token.
+func (p *protoParser) skipBlock() {
+	depth := 0
+	for !p.done() {
+		t := p.next()
+		if t.kind == tokString {
+			continue
+		}
+		switch t.text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth == 0 {
+				return
+			}
+		}
+	}
+}
+
+func (p *protoParser) topLevel() {
+	t := p.peek()
+	switch {
+	case p.accept("package"):
+		if name := p.next(); name.kind == tokIdent {
+			p.f.pkg = strings.TrimPrefix(name.text, ".")
+		}
+		p.skip()
+	case p.accept("import"):
+		if !p.accept("public") {
+			p.accept("weak")
+		}
+		if s := p.next(); s.kind == tokString {
+			p.f.imports = append(p.f.imports, &protoImport{path: s.text, start: s.start + 1, end: s.end - 1})
+		}
+		p.skip()
+	case t.text == "option":
+		p.option(p.f.pkg)
+	case t.text == "message" || t.text == "enum" || t.text == "service" || t.text == "extend":
+		p.element(p.f.pkg)
+	default:
+		p.skip()
+		p.accept("}") // stray
+	}
+}
+
+// element parses a message, enum, service, or extend definition in
+// scope.
+func (p *protoParser) element(scope string) {
+	kw := p.next()
+	if kw.text == "extend" {
+		typ := p.next()
+		if typ.kind == tokIdent {
+			p.typeRef(typ, scope)
+		}
+		if !p.accept("{") {
+			p.skip()
+			return
+		}
+		p.body(scope, "", "extension")
+		return
+	}
+
+	name := p.next()
+	if name.kind != tokIdent || !p.accept("{") {
+		p.skip()
+		return
+	}
+	d := &protoDef{fullName: qualify(scope, name.text), name: name.text, rawKind: kw.text, start: kw.start, nameStart: name.start, nameEnd: name.end}
+	switch kw.text {
+	case "message":
+		d.kind = graph.KindType
+	case "enum":
+		d.kind = graph.KindEnum
+	case "service":
+		d.kind = graph.KindInterface
+	}
+	p.f.defs = append(p.f.defs, d)
+	d.end = p.body(d.fullName, kw.text, "field")
+}
+
+// body parses the body of a message, enum, service, oneof, or extend
+// (after its "{") whose fully qualified name is scope, and returns the
+// offset just after its closing "}". Fields are defined with the given
+// raw kind.
+func (p *protoParser) body(scope, kind, fieldKind string) int {
+	for !p.done() {
+		t := p.peek()
+		if t.kind != tokString && t.text == "}" {
+			p.i++
+			return t.end
+		}
+		switch {
+		case t.kind == tokString || t.text == ";":
+			p.skip()
+		case t.text == "option":
+			p.option(scope)
+		case t.text == "reserved" || t.text == "extensions" || t.text == "syntax":
+			p.skip()
+		case kind != "enum" && (t.text == "message" || t.text == "enum" || t.text == "extend"):
+			if kind == "service" {
+				p.skip()
+				break
+			}
+			p.element(scope)
+		case kind == "service":
+			p.rpc(scope)
+		case kind == "rpc":
+			p.skip()
+		case kind == "enum":
+			p.enumValue(scope)
+		case t.text == "oneof":
+			p.i++
+			p.next() // name
+			if p.accept("{") {
+				p.body(scope, "oneof", fieldKind)
+			} else {
+				p.skip()
+			}
+		default:
+			p.field(scope, fieldKind)
+		}
+	}
+	return p.f.size
+}
+
+// field parses a field definition in the message (or extend block)
+// scope.
+func (p *protoParser) field(scope, rawKind string) {
+	start := p.peek().start
+	if !p.accept("repeated") && !p.accept("optional") {
+		p.accept("required")
+	}
+	if p.accept("map") {
+		if !p.accept("<") {
+			p.skip()
+			return
+		}
+		for !p.done() && !p.accept(">") {
+			if t := p.next(); t.kind == tokIdent {
+				p.typeRef(t, scope)
+			}
+		}
+	} else {
+		typ := p.next()
+		if typ.kind != tokIdent {
+			p.skip()
+			return
+		}
+		if typ.text == "group" {
+			p.skip()
+			return
+		}
+		p.typeRef(typ, scope)
+	}
+	name := p.next()
+	if name.kind != tokIdent {
+		p.skip()
+		return
+	}
+	d := &protoDef{name: name.text, kind: graph.KindField, rawKind: rawKind, start: start, nameStart: name.start, nameEnd: name.end}
+	if rawKind == "extension" {
+		// Extensions are named in the scope of the extend block (not
+		// of the extended message).
+		d.fullName = qualify(scope, name.text)
+	} else {
+		d.fullName = scope + "." + name.text
+	}
+	p.f.defs = append(p.f.defs, d)
+	d.end = p.fieldOptions(scope)
+}
+
+// enumValue parses an enum value definition in the enum scope.
+func (p *protoParser) enumValue(scope string) {
+	name := p.next()
+	if name.kind != tokIdent {
+		p.skip()
+		return
+	}
+	d := &protoDef{fullName: scope + "." + name.text, name: name.text, kind: graph.KindConstant, rawKind: "enum value", start: name.start, nameStart: name.start, nameEnd: name.end}
+	p.f.defs = append(p.f.defs, d)
+	d.end = p.fieldOptions(scope)
+}
+
+// fieldOptions parses the rest of a field or enum value definition
+// (its number and options), adding refs for the options, and returns
+// the offset just after it.
+func (p *protoParser) fieldOptions(scope string) int {
+	end := p.peek().end
+	depth := 0 // of "[...]"
+	for !p.done() {
+		t := p.next()
+		end = t.end
+		if t.kind == tokString {
+			continue
+		}
+		switch t.text {
+		case "[":
+			depth++
+		case "]":
+			depth--
+		case ";":
+			if depth <= 0 {
+				return end
+			}
+		case "(":
+			p.optionName(scope)
+		case "{", "}":
+			if depth <= 0 {
+				// Malformed; leave the block for the caller.
+				p.i--
+				return t.start
+			}
+			if t.text == "{" {
+				// An aggregate option value.
+				p.i--
+				p.skipBlock()
+			}
+		}
+	}
+	return end
+}
+
+// rpc parses an rpc definition in the service scope.
+func (p *protoParser) rpc(scope string) {
+	kw := p.next()
+	if kw.text != "rpc" {
+		p.i--
+		p.skip()
+		return
+	}
+	name := p.next()
+	if name.kind != tokIdent {
+		p.skip()
+		return
+	}
+	d := &protoDef{fullName: scope + "." + name.text, name: name.text, kind: graph.KindMethod, rawKind: "rpc", start: kw.start, nameStart: name.start, nameEnd: name.end}
+	p.f.defs = append(p.f.defs, d)
+
+	for i := 0; i < 2; i++ {
+		if i == 1 && !p.accept("returns") {
+			break
+		}
+		if !p.accept("(") {
+			break
+		}
+		p.accept("stream")
+		if typ := p.next(); typ.kind == tokIdent {
+			p.typeRef(typ, scope)
+		}
+		p.accept(")")
+	}
+	if p.accept("{") {
+		d.end = p.body(scope, "rpc", "")
+		return
+	}
+	d.end = p.peek().end
+	p.skip()
+}
+
+// option parses an option statement in scope.
+func (p *protoParser) option(scope string) {
+	p.next() // "option"
+	if p.accept("(") {
+		p.optionName(scope)
+	}
+	p.skip()
+}
+
+// optionName parses the extension name of a custom option (after its
+// "(") and adds a ref to it.
+func (p *protoParser) optionName(scope string) {
+	if t := p.next(); t.kind == tokIdent {
+		p.f.refs = append(p.f.refs, &protoRef{name: t.text, scope: scope, option: true, start: t.start, end: t.end})
+	}
+	p.accept(")")
+}
+
+// typeRef adds a ref to the type named by t (unless it's a scalar
+// type) in scope.
+func (p *protoParser) typeRef(t protoToken, scope string) {
+	if protoScalarTypes[t.text] {
+		return
+	}
+	p.f.refs = append(p.f.refs, &protoRef{name: t.text, scope: scope, start: t.start, end: t.end})
+}
+
+func qualify(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+// Token kinds (symbols have kind tokSymbol and their character as
+// text).
+const (
+	tokIdent = iota + 1
+	tokString
+	tokNumber
+	tokSymbol
+)
+
+type protoToken struct {
+	kind       int
+	text       string // for strings, the unquoted value
+	start, end int
+}
+
+// lexProto splits the .proto file data into tokens, omitting
+// whitespace and comments. Identifiers include dotted names (such as
+// "google.protobuf.Timestamp" and ".pkg.Message").
+func lexProto(data []byte) []protoToken {
+	var toks []protoToken
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == '\v':
+			i++
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := strings.Index(string(data[i+2:]), "*/")
+			if end == -1 {
+				i = len(data)
+			} else {
+				i += 2 + end + 2
+			}
+		case c == '"' || c == '\'':
+			start := i
+			var val []byte
+			for i++; i < len(data) && data[i] != c && data[i] != '\n'; i++ {
+				if data[i] == '\\' && i+1 < len(data) {
+					i++
+				}
+				val = append(val, data[i])
+			}
+			if i < len(data) && data[i] == c {
+				i++
+			}
+			toks = append(toks, protoToken{kind: tokString, text: string(val), start: start, end: i})
+		case isIdentStart(c) || (c == '.' && i+1 < len(data) && isIdentStart(data[i+1])):
+			start := i
+			for i++; i < len(data) && (isIdentStart(data[i]) || isDigit(data[i]) || (data[i] == '.' && i+1 < len(data) && isIdentStart(data[i+1]))); i++ {
+			}
+			toks = append(toks, protoToken{kind: tokIdent, text: string(data[start:i]), start: start, end: i})
+		case isDigit(c) || (c == '-' && i+1 < len(data) && isDigit(data[i+1])):
+			start := i
+			for i++; i < len(data) && (isIdentStart(data[i]) || isDigit(data[i]) || data[i] == '.'); i++ {
+			}
+			toks = append(toks, protoToken{kind: tokNumber, text: string(data[start:i]), start: start, end: i})
+		default:
+			toks = append(toks, protoToken{kind: tokSymbol, text: string(c), start: i, end: i + 1})
+			i++
+		}
+	}
+	return toks
+}
+
+func fileExists(file string) bool {
+	fi, err := os.Stat(filepath.FromSlash(file))
+	return err == nil && fi.Mode().IsRegular()
+}
+
+func isIdentStart(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_'
+}
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
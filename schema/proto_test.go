@@ -0,0 +1,86 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph/graphtest"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestGraphProtobuf(t *testing.T) {
+	u := &unit.SourceUnit{
+		Key:  unit.Key{Type: ProtobufUnitType, Name: "testdata/api"},
+		Info: unit.Info{Dir: "testdata/api", Files: []string{"testdata/api/greeter.proto"}},
+	}
+	o, err := GraphProtobuf(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defs, refs := graphtest.DescribeOutput(t, o)
+
+	wantDefs := []string{
+		"greeter.proto",
+		"helloworld/Greeter",
+		"helloworld/Greeter/SayHello",
+		"helloworld/HelloReply",
+		"helloworld/HelloReply/message",
+		"helloworld/HelloRequest",
+		"helloworld/HelloRequest/Greeting",
+		"helloworld/HelloRequest/Greeting/HELLO",
+		"helloworld/HelloRequest/Greeting/HI",
+		"helloworld/HelloRequest/greetings",
+		"helloworld/HelloRequest/locale",
+		"helloworld/HelloRequest/name",
+	}
+	if !reflect.DeepEqual(defs, wantDefs) {
+		t.Errorf("got defs\n%s\n\nwant\n%s", strings.Join(defs, "\n"), strings.Join(wantDefs, "\n"))
+	}
+
+	wantRefs := []string{
+		"Greeting -> testdata/api helloworld/HelloRequest/Greeting",
+		"HelloReply -> testdata/api helloworld/HelloReply",
+		"HelloRequest -> testdata/api helloworld/HelloRequest",
+		"common.Locale -> testdata/api/common common/Locale",
+		"common.http -> testdata/api/common common/http",
+		"common.sensitive -> testdata/api/common common/sensitive",
+		"common/types.proto -> testdata/api/common types.proto",
+	}
+	if !reflect.DeepEqual(refs, wantRefs) {
+		t.Errorf("got refs\n%s\n\nwant\n%s", strings.Join(refs, "\n"), strings.Join(wantRefs, "\n"))
+	}
+}
+
+func TestResolveProtoName(t *testing.T) {
+	symbols := map[string]*protoSymbol{
+		"a.B":     {path: "a/B"},
+		"a.B.C":   {path: "a/B/C"},
+		"C":       {path: "C"},
+		"a.ext":   {path: "a/ext", extension: true},
+		"x.y.Foo": {path: "x/y/Foo"},
+	}
+	tests := []struct {
+		name, scope string
+		option      bool
+		want        string
+	}{
+		{name: "C", scope: "a.B", want: "a/B/C"},
+		{name: "C", scope: "a", want: "C"},
+		{name: ".C", scope: "a.B", want: "C"},
+		{name: "B.C", scope: "a.D", want: "a/B/C"},
+		{name: "x.y.Foo", scope: "a.B", want: "x/y/Foo"},
+		{name: "ext", scope: "a.B", option: true, want: "a/ext"},
+		{name: "ext", scope: "a.B"},
+		{name: "Missing", scope: "a.B"},
+	}
+	for _, test := range tests {
+		var got string
+		if sym := resolveProtoName(symbols, test.name, test.scope, test.option); sym != nil {
+			got = sym.path
+		}
+		if got != test.want {
+			t.Errorf("%q in scope %q (option %v): got %q, want %q", test.name, test.scope, test.option, got, test.want)
+		}
+	}
+}
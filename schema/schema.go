@@ -0,0 +1,139 @@
+// Package schema is a toolchain, built into srclib, for API schemas:
+// Protocol Buffers (.proto) files and OpenAPI (and Swagger) documents.
+// It lets API schemas participate in the code graph even when no
+// external toolchain for them is installed.
+//
+// Its scanner (the built-in "schema" scanner, which is run by default;
+// see scan.DefaultBuiltins) emits a source unit for each directory that
+// contains .proto files and for each OpenAPI document, and its
+// graphers (see grapher.Builtins) emit defs for the messages, enums,
+// services, and endpoints in them and refs from field types, options,
+// imports, and $refs.
+package schema
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/scan"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+	"sourcegraph.com/sourcegraph/srclib/util"
+)
+
+const (
+	// ProtobufUnitType is the type of the source units that contain
+	// the .proto files in a directory. The units are named by the
+	// directory (relative to the repository root).
+	ProtobufUnitType = "Protobuf"
+
+	// OpenAPIUnitType is the type of the source units that contain an
+	// OpenAPI or Swagger document (in JSON or YAML). The units are
+	// named by the document's path.
+	OpenAPIUnitType = "OpenAPI"
+)
+
+func init() {
+	scan.Builtins["schema"] = Scan
+	scan.DefaultBuiltins = append(scan.DefaultBuiltins, "schema")
+	grapher.Builtins[ProtobufUnitType] = GraphProtobuf
+	grapher.Builtins[OpenAPIUnitType] = GraphOpenAPI
+}
+
+// Scan returns the Protobuf and OpenAPI source units in the tree in
+// the current directory. Directories whose names begin with "." or "_"
+// and node_modules directories are skipped, as are symbolic links.
+func Scan(treeConfig map[string]interface{}) ([]*unit.SourceUnit, error) {
+	protoDirs := map[string][]string{}
+	var openAPIFiles []string
+	err := util.Walk(".", util.IgnoreSymlinks, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			if name := fi.Name(); p != "." && (name[0] == '.' || name[0] == '_' || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		file := filepath.ToSlash(p)
+		switch strings.ToLower(path.Ext(file)) {
+		case ".proto":
+			dir := path.Dir(file)
+			protoDirs[dir] = append(protoDirs[dir], file)
+		case ".json", ".yaml", ".yml":
+			isOpenAPI, err := sniffOpenAPI(p)
+			if err != nil {
+				return err
+			}
+			if isOpenAPI {
+				openAPIFiles = append(openAPIFiles, file)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var units []*unit.SourceUnit
+	dirs := make([]string, 0, len(protoDirs))
+	for dir := range protoDirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		files := protoDirs[dir]
+		sort.Strings(files)
+		units = append(units, &unit.SourceUnit{
+			Key:  unit.Key{Type: ProtobufUnitType, Name: dir},
+			Info: unit.Info{Dir: dir, Files: files},
+		})
+	}
+	sort.Strings(openAPIFiles)
+	for _, file := range openAPIFiles {
+		units = append(units, &unit.SourceUnit{
+			Key:  unit.Key{Type: OpenAPIUnitType, Name: file},
+			Info: unit.Info{Dir: path.Dir(file), Files: []string{file}},
+		})
+	}
+	return units, nil
+}
+
+// openAPISniffLen is the number of bytes at the beginning of a JSON or
+// YAML file that are checked for the top-level "openapi" or "swagger"
+// key.
+const openAPISniffLen = 2048
+
+// openAPIKey matches the line of the top-level "openapi" or "swagger"
+// key of an OpenAPI or Swagger document.
+var openAPIKey = regexp.MustCompile(`(?m)^(\{\s*)?\s{0,4}"?(openapi|swagger)"?\s*:\s*["']?\d`)
+
+// sniffOpenAPI reports whether the beginning of the file named name
+// looks like an OpenAPI or Swagger document.
+func sniffOpenAPI(name string) (bool, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	head := make([]byte, openAPISniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+	head = head[:n]
+	if bytes.IndexByte(head, 0) != -1 {
+		return false, nil // binary
+	}
+	return openAPIKey.Match(head), nil
+}
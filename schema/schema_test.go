@@ -0,0 +1,34 @@
+package schema
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestScan(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir("testdata"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	units, err := Scan(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*unit.SourceUnit{
+		{Key: unit.Key{Type: ProtobufUnitType, Name: "api"}, Info: unit.Info{Dir: "api", Files: []string{"api/greeter.proto"}}},
+		{Key: unit.Key{Type: ProtobufUnitType, Name: "api/common"}, Info: unit.Info{Dir: "api/common", Files: []string{"api/common/types.proto"}}},
+		{Key: unit.Key{Type: OpenAPIUnitType, Name: "openapi/common.json"}, Info: unit.Info{Dir: "openapi", Files: []string{"openapi/common.json"}}},
+		{Key: unit.Key{Type: OpenAPIUnitType, Name: "openapi/petstore.yaml"}, Info: unit.Info{Dir: "openapi", Files: []string{"openapi/petstore.yaml"}}},
+	}
+	if !reflect.DeepEqual(units, want) {
+		t.Errorf("got units %+v, want %+v", units, want)
+	}
+}
@@ -0,0 +1,170 @@
+package srcfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/tools/godoc/vfs"
+)
+
+// OpenZip opens the tree in the zip archive file. Each file is
+// decompressed when it is opened.
+func OpenZip(file string) (FileSystem, error) {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	ix := newIndex("zip archive " + file)
+	for _, f := range zr.File {
+		mode := f.Mode()
+		e := &entry{mode: archiveMode(mode), size: int64(f.UncompressedSize64), modTime: f.ModTime(), loc: f}
+		if mode.IsDir() || strings.HasSuffix(f.Name, "/") {
+			e.mode, e.size = os.ModeDir|0755, 0
+		}
+		ix.add(f.Name, e)
+	}
+	ix.stripTopDir()
+	ix.open = func(e *entry) (vfs.ReadSeekCloser, error) {
+		rc, err := e.loc.(*zip.File).Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		data, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return nil, err
+		}
+		return memFile{bytes.NewReader(data)}, nil
+	}
+	return &archiveFS{index: ix, close: zr.Close}, nil
+}
+
+// OpenTar opens the tree in the tar archive file, which is
+// gzip-compressed if its name ends in ".gz" or ".tgz". A compressed
+// archive is decompressed into a temporary file (which is removed by
+// Close), so that its files can be read without decompressing the
+// archive again.
+func OpenTar(file string) (FileSystem, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	closeFn := f.Close
+	if name := strings.ToLower(file); strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".tgz") {
+		tmp, err := decompressToTemp(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		f = tmp
+		closeFn = func() error {
+			err := tmp.Close()
+			if err2 := os.Remove(tmp.Name()); err == nil {
+				err = err2
+			}
+			return err
+		}
+	}
+
+	ix, err := indexTar(f, "tar archive "+file)
+	if err != nil {
+		closeFn()
+		return nil, err
+	}
+	ix.stripTopDir()
+	ix.open = func(e *entry) (vfs.ReadSeekCloser, error) {
+		return sectionFile{io.NewSectionReader(f, e.loc.(int64), e.size)}, nil
+	}
+	return &archiveFS{index: ix, close: closeFn}, nil
+}
+
+// indexTar indexes the tar archive in f, recording the offset in f of
+// each file's contents.
+func indexTar(f *os.File, name string) (*index, error) {
+	ix := newIndex(name)
+	// The tar reader doesn't read ahead, so after it reads a header,
+	// the number of bytes read so far is the offset of the contents.
+	cr := &countingReader{r: f}
+	tr := tar.NewReader(cr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading %s: %s", name, err)
+		}
+		e := &entry{mode: archiveMode(hdr.FileInfo().Mode()), size: hdr.Size, modTime: hdr.ModTime, loc: cr.n}
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+		case tar.TypeDir:
+			e.mode, e.size = os.ModeDir|0755, 0
+		case tar.TypeSymlink:
+			e.mode, e.size, e.link = os.ModeSymlink|0777, int64(len(hdr.Linkname)), hdr.Linkname
+		default:
+			continue // skip hard links, devices, pax headers, etc.
+		}
+		ix.add(hdr.Name, e)
+	}
+	return ix, nil
+}
+
+// archiveMode returns the mode of a file in an archive, keeping only
+// its type and executable bit (as git does).
+func archiveMode(mode os.FileMode) os.FileMode {
+	if mode&0111 != 0 {
+		return mode&os.ModeType | 0755
+	}
+	return mode&os.ModeType | 0644
+}
+
+func decompressToTemp(f *os.File) (*os.File, error) {
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile("", "srclib-tree-")
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(tmp, zr)
+	if err == nil {
+		_, err = tmp.Seek(0, 0)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return tmp, nil
+}
+
+type archiveFS struct {
+	*index
+	close func() error
+}
+
+func (fs *archiveFS) Close() error { return fs.close() }
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// sectionFile is an open file whose contents are read from an
+// archive that stays open.
+type sectionFile struct{ *io.SectionReader }
+
+func (sectionFile) Close() error { return nil }
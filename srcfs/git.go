@@ -0,0 +1,110 @@
+package srcfs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/godoc/vfs"
+)
+
+// A GitFS is the tree of a revision of a git repository. Files are
+// read from the repository's object store, so the repository may be
+// bare, and its working tree (if any) is neither used nor changed.
+type GitFS struct {
+	*index
+
+	// Dir is the directory of the git repository.
+	Dir string
+
+	// CommitID is the full ID of the commit whose tree this is.
+	CommitID string
+}
+
+// OpenGit opens the tree of revision rev of the git repository in
+// dir. Submodules are omitted.
+func OpenGit(dir, rev string) (*GitFS, error) {
+	out, err := git(dir, "rev-parse", "--verify", rev+"^{commit}")
+	if err != nil {
+		return nil, err
+	}
+	fs := &GitFS{Dir: dir, CommitID: string(bytes.TrimSpace(out))}
+	fs.index = newIndex(fmt.Sprintf("git tree %s in %s", fs.CommitID, dir))
+	fs.open = fs.openBlob
+
+	out, err = git(dir, "ls-tree", "-r", "-l", "-z", "--full-tree", fs.CommitID)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range bytes.Split(out, []byte{0}) {
+		if len(rec) == 0 {
+			continue
+		}
+		e, name, err := parseLsTreeEntry(string(rec))
+		if err != nil {
+			return nil, err
+		}
+		if e != nil {
+			fs.add(name, e)
+		}
+	}
+	return fs, nil
+}
+
+// parseLsTreeEntry parses an entry in the output of "git ls-tree -r
+// -l", of the form "MODE TYPE OBJECT SIZE\tPATH". It returns a nil
+// entry for submodules.
+func parseLsTreeEntry(rec string) (*entry, string, error) {
+	tab := strings.Index(rec, "\t")
+	if tab == -1 {
+		return nil, "", fmt.Errorf("bad git ls-tree entry %q", rec)
+	}
+	fields := strings.Fields(rec[:tab])
+	if len(fields) != 4 {
+		return nil, "", fmt.Errorf("bad git ls-tree entry %q", rec)
+	}
+	if fields[1] != "blob" {
+		return nil, "", nil
+	}
+	e := &entry{loc: fields[2]}
+	switch fields[0] {
+	case "100755":
+		e.mode = 0755
+	case "120000":
+		e.mode = os.ModeSymlink | 0777
+	default:
+		e.mode = 0644
+	}
+	size, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return nil, "", fmt.Errorf("bad git ls-tree entry %q", rec)
+	}
+	e.size = size
+	return e, rec[tab+1:], nil
+}
+
+func (fs *GitFS) openBlob(e *entry) (vfs.ReadSeekCloser, error) {
+	data, err := git(fs.Dir, "cat-file", "blob", e.loc.(string))
+	if err != nil {
+		return nil, err
+	}
+	return memFile{bytes.NewReader(data)}, nil
+}
+
+func (fs *GitFS) Close() error { return nil }
+
+// git runs git in dir and returns its standard output.
+func git(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("exec %v failed: %s. Output was:\n\n%s", cmd.Args, err, stderr.Bytes())
+	}
+	return out, nil
+}
@@ -0,0 +1,194 @@
+package srcfs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/godoc/vfs"
+)
+
+// An index is the directory tree of a file system whose files are all
+// listed up front (a git tree or an archive) but whose contents are
+// read only when they are opened.
+type index struct {
+	name    string            // the name of the file system (for String)
+	entries map[string]*entry // keyed by clean path ("" is the root)
+
+	// open opens the contents of the file or symbolic link e.
+	open func(e *entry) (vfs.ReadSeekCloser, error)
+}
+
+// An entry is a file, directory, or symbolic link in an index.
+type entry struct {
+	name     string
+	mode     os.FileMode
+	size     int64
+	modTime  time.Time
+	link     string   // the target of a symbolic link, if known without opening it
+	children []*entry // sorted by name, for directories
+
+	// loc locates the entry's contents in the underlying storage
+	// (e.g., a git blob ID or an archive offset).
+	loc interface{}
+}
+
+func newIndex(name string) *index {
+	return &index{
+		name:    name,
+		entries: map[string]*entry{"": {mode: os.ModeDir | 0755}},
+	}
+}
+
+// add adds e at the path name, creating its parent directories. If a
+// directory is added at a path that already exists, the existing
+// entry is kept.
+func (ix *index) add(name string, e *entry) {
+	name = cleanPath(name)
+	if name == "" {
+		return
+	}
+	if old, present := ix.entries[name]; present {
+		if old.mode.IsDir() && e.mode.IsDir() {
+			return
+		}
+		ix.remove(name)
+	}
+	dir, base := path.Split(name)
+	dir = strings.TrimSuffix(dir, "/")
+	parent, ok := ix.entries[dir]
+	if !ok {
+		ix.add(dir, &entry{mode: os.ModeDir | 0755})
+		parent = ix.entries[dir]
+	}
+	e.name = base
+	ix.entries[name] = e
+	i := sort.Search(len(parent.children), func(i int) bool { return parent.children[i].name >= base })
+	parent.children = append(parent.children, nil)
+	copy(parent.children[i+1:], parent.children[i:])
+	parent.children[i] = e
+}
+
+// remove removes the entry at the path name (which must exist) from
+// its parent directory.
+func (ix *index) remove(name string) {
+	dir, base := path.Split(name)
+	parent := ix.entries[strings.TrimSuffix(dir, "/")]
+	for i, c := range parent.children {
+		if c.name == base {
+			parent.children = append(parent.children[:i], parent.children[i+1:]...)
+			break
+		}
+	}
+	delete(ix.entries, name)
+}
+
+// stripTopDir makes the only top-level directory of the tree its
+// root, if all of the tree's files are in it.
+func (ix *index) stripTopDir() {
+	root := ix.entries[""]
+	if len(root.children) != 1 || !root.children[0].mode.IsDir() {
+		return
+	}
+	top := root.children[0].name
+	entries := make(map[string]*entry, len(ix.entries)-1)
+	for name, e := range ix.entries {
+		if name == top {
+			entries[""] = e
+		} else if strings.HasPrefix(name, top+"/") {
+			entries[name[len(top)+1:]] = e
+		}
+	}
+	entries[""].name = ""
+	ix.entries = entries
+}
+
+func (ix *index) lookup(op, name string) (*entry, error) {
+	e, ok := ix.entries[cleanPath(name)]
+	if !ok {
+		return nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return e, nil
+}
+
+func (ix *index) Open(name string) (vfs.ReadSeekCloser, error) {
+	e, err := ix.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if e.mode.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: name, Err: errIsDir}
+	}
+	return ix.open(e)
+}
+
+func (ix *index) Lstat(name string) (os.FileInfo, error) {
+	e, err := ix.lookup("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{e}, nil
+}
+
+func (ix *index) Stat(name string) (os.FileInfo, error) {
+	e, err := ix.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{e}, nil
+}
+
+func (ix *index) ReadDir(name string) ([]os.FileInfo, error) {
+	e, err := ix.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !e.mode.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	fis := make([]os.FileInfo, len(e.children))
+	for i, c := range e.children {
+		fis[i] = fileInfo{c}
+	}
+	return fis, nil
+}
+
+func (ix *index) Readlink(name string) (string, error) {
+	e, err := ix.lookup("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	if e.mode&os.ModeSymlink == 0 {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: errNotLink}
+	}
+	if e.link != "" {
+		return e.link, nil
+	}
+	f, err := ix.open(e)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	target, err := ioutil.ReadAll(f)
+	return string(target), err
+}
+
+func (ix *index) String() string { return ix.name }
+
+type fileInfo struct{ e *entry }
+
+func (fi fileInfo) Name() string       { return fi.e.name }
+func (fi fileInfo) Size() int64        { return fi.e.size }
+func (fi fileInfo) Mode() os.FileMode  { return fi.e.mode }
+func (fi fileInfo) ModTime() time.Time { return fi.e.modTime }
+func (fi fileInfo) IsDir() bool        { return fi.e.mode.IsDir() }
+func (fi fileInfo) Sys() interface{}   { return nil }
+
+// memFile is an open file whose contents are in memory.
+type memFile struct{ *bytes.Reader }
+
+func (memFile) Close() error { return nil }
@@ -0,0 +1,95 @@
+package srcfs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/kr/fs"
+	"golang.org/x/tools/godoc/vfs"
+	"sourcegraph.com/sourcegraph/rwvfs"
+)
+
+// Walk calls fn with the path (relative to the root of the tree) and
+// FileInfo of each file and directory in tree under the directory
+// root (in lexical order), as filepath.Walk does.
+func Walk(tree vfs.FileSystem, root string, fn filepath.WalkFunc) error {
+	w := fs.WalkFS(cleanDir(root), rwvfs.Walkable(rwvfs.ReadOnly(tree)))
+	for w.Step() {
+		if err := fn(w.Path(), w.Stat(), w.Err()); err == filepath.SkipDir {
+			if w.Stat() != nil && w.Stat().IsDir() {
+				w.SkipDir()
+			}
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cleanDir(dir string) string {
+	if dir = cleanPath(dir); dir == "" {
+		return "."
+	}
+	return dir
+}
+
+// Materialize writes the files (slash-separated paths relative to
+// the root of the tree) from tree to the same paths under dir, creating
+// their parent directories as needed. Directories in files are
+// created (but their contents aren't written), symbolic links are
+// recreated, and the executable bits of files are kept. Files that
+// already exist under dir are overwritten.
+func Materialize(tree FileSystem, dir string, files []string) error {
+	for _, file := range files {
+		name := cleanPath(file)
+		dst := filepath.Join(dir, filepath.FromSlash(name))
+		fi, err := tree.Lstat(name)
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			if err := os.MkdirAll(dst, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			target, err := tree.Readlink(name)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(target, dst); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := materializeFile(tree, name, dst, fi.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func materializeFile(tree FileSystem, name, dst string, perm os.FileMode) error {
+	src, err := tree.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
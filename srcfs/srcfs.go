@@ -0,0 +1,89 @@
+// Package srcfs provides read-only file systems for source trees that
+// aren't checked out on disk: a revision of a git repository (which
+// may be bare) or a zip or tar archive. srclib analyzes such a tree
+// by materializing only the files that it needs into a directory (see
+// Materialize), instead of checking out or extracting all of it.
+package srcfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/godoc/vfs"
+)
+
+// A FileSystem is a read-only source tree. Paths are slash-separated
+// and relative to the root of the tree ("." or "" is the root).
+//
+// In git trees and archives, symbolic links aren't followed: Stat and
+// Lstat both describe the link itself. Its target is returned by
+// Readlink.
+type FileSystem interface {
+	vfs.FileSystem
+
+	// Readlink returns the target of the symbolic link name.
+	Readlink(name string) (string, error)
+
+	// Close releases the resources (such as open archives and
+	// temporary files) of the file system.
+	io.Closer
+}
+
+// Open opens the source tree named by spec, which is a directory, a
+// git repository directory (which may be bare) and a revision in the
+// form DIR@REV, or a .zip, .tar, .tar.gz, or .tgz archive. If all of
+// an archive's files are in one top-level directory (as in GitHub's
+// archives), that directory is the root of the tree.
+func Open(spec string) (FileSystem, error) {
+	if fi, err := os.Stat(spec); err == nil {
+		if fi.IsDir() {
+			return OS(spec), nil
+		}
+		switch name := strings.ToLower(spec); {
+		case strings.HasSuffix(name, ".zip"):
+			return OpenZip(spec)
+		case strings.HasSuffix(name, ".tar"), strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+			return OpenTar(spec)
+		}
+		return nil, fmt.Errorf("source tree %q is not a directory or a .zip, .tar, .tar.gz, or .tgz archive", spec)
+	}
+	if i := strings.LastIndex(spec, "@"); i > 0 {
+		if fi, err := os.Stat(spec[:i]); err == nil && fi.IsDir() && i < len(spec)-1 {
+			return OpenGit(spec[:i], spec[i+1:])
+		}
+	}
+	return nil, fmt.Errorf("source tree %q not found (expected DIR, DIR@REV, or an archive)", spec)
+}
+
+// OS returns the file system of the directory dir on disk.
+func OS(dir string) FileSystem {
+	return osFS{FileSystem: vfs.OS(dir), dir: dir}
+}
+
+type osFS struct {
+	vfs.FileSystem
+	dir string
+}
+
+func (fs osFS) Readlink(name string) (string, error) {
+	return os.Readlink(filepath.Join(fs.dir, filepath.FromSlash(cleanPath(name))))
+}
+
+func (osFS) Close() error { return nil }
+
+// cleanPath returns name cleaned and made relative to the root of the
+// tree, with "" for the root itself.
+func cleanPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+}
+
+var (
+	errIsDir   = errors.New("is a directory")
+	errNotDir  = errors.New("not a directory")
+	errNotLink = errors.New("not a symbolic link")
+)
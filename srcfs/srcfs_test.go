@@ -0,0 +1,228 @@
+package srcfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// testTree is the tree that the tests' archives and git repository
+// contain.
+var testTree = map[string]string{
+	"Srcfile":     "{}",
+	"a/a.go":      "package a",
+	"a/b/b.go":    "package b",
+	"bin/run":     "#!/bin/sh\n",
+	"README.link": "->a/a.go",
+}
+
+func TestOpenArchives(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srcfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	names := make([]string, 0, len(testTree))
+	for name := range testTree {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	zipFile := filepath.Join(dir, "t.zip")
+	writeArchive(t, zipFile, func(w io.Writer) (func(name, data string, mode os.FileMode) error, func() error) {
+		zw := zip.NewWriter(w)
+		return func(name, data string, mode os.FileMode) error {
+			hdr := &zip.FileHeader{Name: name, Method: zip.Deflate}
+			hdr.SetMode(mode)
+			f, err := zw.CreateHeader(hdr)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(f, data)
+			return err
+		}, zw.Close
+	}, names)
+
+	for _, gz := range []bool{false, true} {
+		tarFile := filepath.Join(dir, "t.tar")
+		if gz {
+			tarFile += ".gz"
+		}
+		writeArchive(t, tarFile, func(w io.Writer) (func(name, data string, mode os.FileMode) error, func() error) {
+			var zw *gzip.Writer
+			if gz {
+				zw = gzip.NewWriter(w)
+				w = zw
+			}
+			tw := tar.NewWriter(w)
+			return func(name, data string, mode os.FileMode) error {
+					hdr := &tar.Header{Name: name, Mode: int64(mode.Perm()), Size: int64(len(data)), Typeflag: tar.TypeReg}
+					if mode&os.ModeSymlink != 0 {
+						hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, data, 0
+						data = ""
+					}
+					if err := tw.WriteHeader(hdr); err != nil {
+						return err
+					}
+					_, err := io.WriteString(tw, data)
+					return err
+				}, func() error {
+					if err := tw.Close(); err != nil || zw == nil {
+						return err
+					}
+					return zw.Close()
+				}
+		}, names)
+	}
+
+	for _, file := range []string{zipFile, filepath.Join(dir, "t.tar"), filepath.Join(dir, "t.tar.gz")} {
+		fs, err := Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkTree(t, fs, dir, file)
+		if err := fs.Close(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestOpenGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir, err := ioutil.TempDir("", "srcfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	work := filepath.Join(dir, "work")
+	for name, data := range testTree {
+		file := filepath.Join(work, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if name == "README.link" {
+			err = os.Symlink(data, file)
+		} else {
+			err = ioutil.WriteFile(file, []byte(data), testMode(name).Perm())
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=a", "-c", "user.email=a@example.com", "commit", "-q", "-m", "x"},
+		{"clone", "-q", "--bare", ".", filepath.Join(dir, "bare.git")},
+	} {
+		if _, err := git(work, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs, err := Open(filepath.Join(dir, "bare.git") + "@master")
+	if err != nil {
+		fs, err = Open(filepath.Join(dir, "bare.git") + "@HEAD")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := fs.(*GitFS).CommitID; len(id) != 40 {
+		t.Errorf("got commit ID %q, want a full commit ID", id)
+	}
+	checkTree(t, fs, dir, "git")
+}
+
+func testMode(name string) os.FileMode {
+	switch name {
+	case "bin/run":
+		return 0755
+	case "README.link":
+		return os.ModeSymlink | 0777
+	}
+	return 0644
+}
+
+// writeArchive writes an archive of testTree (in the directory "top",
+// which the file system should strip) to file.
+func writeArchive(t *testing.T, file string, newWriter func(io.Writer) (func(name, data string, mode os.FileMode) error, func() error), names []string) {
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	add, close := newWriter(f)
+	for _, name := range names {
+		if err := add("top/"+name, testTree[name], testMode(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkTree checks that fs contains testTree, and that materializing
+// part of it writes the right files.
+func checkTree(t *testing.T, fs FileSystem, tmpDir, label string) {
+	var files []string
+	err := Walk(fs, ".", func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("%s: %s", label, err)
+	}
+	want := []string{"README.link", "Srcfile", "a/a.go", "a/b/b.go", "bin/run"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("%s: got files %v, want %v", label, files, want)
+	}
+
+	fis, err := fs.ReadDir("a")
+	if err != nil {
+		t.Fatalf("%s: %s", label, err)
+	}
+	if len(fis) != 2 || fis[0].Name() != "a.go" || !fis[1].IsDir() {
+		t.Errorf("%s: got ReadDir entries %v, want a.go and b", label, fis)
+	}
+	if _, err := fs.Stat("nope"); !os.IsNotExist(err) {
+		t.Errorf("%s: got Stat error %v, want not-exist", label, err)
+	}
+
+	dst, err := ioutil.TempDir(tmpDir, "dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Materialize(fs, dst, []string{"a/b/b.go", "bin/run", "README.link"}); err != nil {
+		t.Fatalf("%s: %s", label, err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dst, "a", "b", "b.go")); err != nil || string(data) != "package b" {
+		t.Errorf("%s: got a/b/b.go %q (error %v), want %q", label, data, err, "package b")
+	}
+	if fi, err := os.Stat(filepath.Join(dst, "bin", "run")); err != nil || fi.Mode()&0100 == 0 {
+		t.Errorf("%s: got bin/run %v (error %v), want an executable file", label, fi, err)
+	}
+	if target, err := os.Readlink(filepath.Join(dst, "README.link")); err != nil || target != "->a/a.go" {
+		t.Errorf("%s: got README.link target %q (error %v), want %q", label, target, err, "->a/a.go")
+	}
+	if _, err := os.Stat(filepath.Join(dst, "a", "a.go")); !os.IsNotExist(err) {
+		t.Errorf("%s: a/a.go was materialized but not requested", label)
+	}
+}
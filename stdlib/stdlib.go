@@ -0,0 +1,262 @@
+// Package stdlib resolves refs to defs in standard libraries (such as
+// the Go standard library, the JDK, or the Python standard library)
+// using prebuilt def manifests, so that those refs count as valid
+// (e.g., in "srclib coverage") and can be linked to the standard
+// library's canonical documentation.
+//
+// A manifest is a JSON file (see Manifest) that lists the exported
+// defs of a standard library. Manifests are bundled in the "stdlib"
+// subdirectory of a toolchain, or installed in the "stdlib"
+// subdirectory of any SRCLIBPATH entry. They can be generated from a
+// standard library's build data with "srclib stdlib gen".
+package stdlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// DirName is the name of the directory (in toolchains and SRCLIBPATH
+// entries) that contains stdlib manifests.
+const DirName = "stdlib"
+
+// A Manifest lists the defs in a language's standard library.
+type Manifest struct {
+	// Language is the name of the language (as in "srclib coverage"
+	// output, e.g., "Go").
+	Language string
+
+	// Repo is the URI of the repository that defines the standard
+	// library (e.g., "github.com/golang/go"). Refs to the standard
+	// library are resolved to defs in this repository.
+	Repo string
+
+	// Version is the version of the standard library (e.g., "go1.5").
+	Version string `json:",omitempty"`
+
+	// DocURL, if set, is the template for the canonical documentation
+	// URL of a def. The placeholders "{unit}" and "{path}" are replaced
+	// by the def's unit and path, and "{dotpath}" is replaced by its
+	// path with "/" replaced by "." (e.g.,
+	// "https://golang.org/pkg/{unit}/#{dotpath}").
+	DocURL string `json:",omitempty"`
+
+	// Units lists the defs of each of the standard library's source
+	// units.
+	Units []*Unit
+
+	// File is the file that the manifest was read from.
+	File string `json:"-"`
+}
+
+// A Unit lists the defs in one of a standard library's source units.
+type Unit struct {
+	UnitType string
+	Unit     string
+	Defs     []string // def paths, sorted
+}
+
+// NumDefs returns the number of defs in the manifest.
+func (m *Manifest) NumDefs() int {
+	var n int
+	for _, u := range m.Units {
+		n += len(u.Defs)
+	}
+	return n
+}
+
+// DefDocURL returns the canonical documentation URL of the def with
+// the given unit and path, or the empty string if the manifest has no
+// DocURL.
+func (m *Manifest) DefDocURL(unit, path string) string {
+	if m.DocURL == "" {
+		return ""
+	}
+	r := strings.NewReplacer("{unit}", unit, "{path}", path, "{dotpath}", strings.Replace(path, "/", ".", -1))
+	return r.Replace(m.DocURL)
+}
+
+// Generate creates a manifest of the exported defs in defs.
+func Generate(language, repo string, defs []*graph.Def) *Manifest {
+	units := map[unit.ID2]*Unit{}
+	for _, def := range defs {
+		if !def.Exported {
+			continue
+		}
+		k := unit.ID2{Type: def.UnitType, Name: def.Unit}
+		u, present := units[k]
+		if !present {
+			u = &Unit{UnitType: def.UnitType, Unit: def.Unit}
+			units[k] = u
+		}
+		u.Defs = append(u.Defs, def.Path)
+	}
+
+	m := &Manifest{Language: language, Repo: repo, Units: make([]*Unit, 0, len(units))}
+	for _, u := range units {
+		sort.Strings(u.Defs)
+		m.Units = append(m.Units, u)
+	}
+	sort.Sort(unitsByKey(m.Units))
+	return m
+}
+
+type unitsByKey []*Unit
+
+func (v unitsByKey) Len() int      { return len(v) }
+func (v unitsByKey) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v unitsByKey) Less(i, j int) bool {
+	if v[i].UnitType != v[j].UnitType {
+		return v[i].UnitType < v[j].UnitType
+	}
+	return v[i].Unit < v[j].Unit
+}
+
+// ReadManifest reads a manifest from a JSON file.
+func ReadManifest(file string) (*Manifest, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var m Manifest
+	if err := json.NewDecoder(f).Decode(&m); err != nil {
+		return nil, fmt.Errorf("reading stdlib manifest %s: %s", file, err)
+	}
+	if m.Repo == "" {
+		return nil, fmt.Errorf("stdlib manifest %s has no Repo", file)
+	}
+	m.File = file
+	return &m, nil
+}
+
+// Dirs returns the directories that may contain manifests: the
+// DirName subdirectory of each SRCLIBPATH entry and of each installed
+// toolchain.
+func Dirs() ([]string, error) {
+	var dirs []string
+	for _, dir := range filepath.SplitList(srclib.Path) {
+		dirs = append(dirs, filepath.Join(dir, DirName))
+	}
+	tcs, err := toolchain.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, tc := range tcs {
+		dirs = append(dirs, filepath.Join(tc.Dir, DirName))
+	}
+	return dirs, nil
+}
+
+// Load reads all manifests (*.json files) in dirs (which may not
+// exist).
+func Load(dirs []string) (*Set, error) {
+	var ms []*Manifest
+	for _, dir := range dirs {
+		files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			m, err := ReadManifest(file)
+			if err != nil {
+				return nil, err
+			}
+			ms = append(ms, m)
+		}
+	}
+	return NewSet(ms...), nil
+}
+
+// LoadInstalled reads all manifests in the directories returned by
+// Dirs.
+func LoadInstalled() (*Set, error) {
+	dirs, err := Dirs()
+	if err != nil {
+		return nil, err
+	}
+	return Load(dirs)
+}
+
+// A Set is a set of manifests that refs can be resolved against.
+type Set struct {
+	Manifests []*Manifest
+
+	defs map[defKey]*Manifest
+}
+
+// defKey identifies a def in a manifest. The repo is omitted because
+// refs to standard libraries often don't specify it.
+type defKey struct {
+	unitType, unit, path string
+}
+
+// NewSet creates a set of the given manifests. If more than one
+// manifest lists the same def, the first one is used.
+func NewSet(manifests ...*Manifest) *Set {
+	s := &Set{Manifests: manifests, defs: map[defKey]*Manifest{}}
+	for _, m := range manifests {
+		for _, u := range m.Units {
+			for _, path := range u.Defs {
+				k := defKey{u.UnitType, u.Unit, path}
+				if _, present := s.defs[k]; !present {
+					s.defs[k] = m
+				}
+			}
+		}
+	}
+	return s
+}
+
+// Lookup returns the manifest that lists the def that ref refers to,
+// or nil if there is none. A ref matches if its def's unit type, unit,
+// and path are in the manifest, and its DefRepo is empty or the
+// manifest's Repo.
+func (s *Set) Lookup(ref *graph.Ref) *Manifest {
+	if s == nil {
+		return nil
+	}
+	m := s.defs[defKey{ref.DefUnitType, ref.DefUnit, ref.DefPath}]
+	if m == nil || (ref.DefRepo != "" && ref.DefRepo != m.Repo) {
+		return nil
+	}
+	return m
+}
+
+// ResolveRefs sets the DefRepo of each ref (with an empty DefRepo)
+// that refers to a def in a manifest to the manifest's Repo, so that
+// the ref is resolved to the standard library's repository. Refs whose
+// def unit is one of the local units (i.e., in the repository being
+// processed) and refs in the manifest's own repository (repo) are left
+// unchanged. It returns the number of refs that were resolved.
+func (s *Set) ResolveRefs(refs []*graph.Ref, repo string, local []*unit.SourceUnit) int {
+	if s == nil || len(s.defs) == 0 {
+		return 0
+	}
+	isLocal := make(map[unit.ID2]bool, len(local))
+	for _, u := range local {
+		isLocal[unit.ID2{Type: u.Type, Name: u.Name}] = true
+	}
+
+	var n int
+	for _, ref := range refs {
+		if ref.DefRepo != "" || isLocal[unit.ID2{Type: ref.DefUnitType, Name: ref.DefUnit}] {
+			continue
+		}
+		if m := s.Lookup(ref); m != nil && m.Repo != repo {
+			ref.DefRepo = m.Repo
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,85 @@
+package stdlib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestGenerate(t *testing.T) {
+	defs := []*graph.Def{
+		{DefKey: graph.DefKey{UnitType: "GoPackage", Unit: "strings", Path: "Split"}, Exported: true},
+		{DefKey: graph.DefKey{UnitType: "GoPackage", Unit: "fmt", Path: "Println"}, Exported: true},
+		{DefKey: graph.DefKey{UnitType: "GoPackage", Unit: "fmt", Path: "Errorf"}, Exported: true},
+		{DefKey: graph.DefKey{UnitType: "GoPackage", Unit: "fmt", Path: "newPrinter"}},
+	}
+	want := &Manifest{
+		Language: "Go",
+		Repo:     "github.com/golang/go",
+		Units: []*Unit{
+			{UnitType: "GoPackage", Unit: "fmt", Defs: []string{"Errorf", "Println"}},
+			{UnitType: "GoPackage", Unit: "strings", Defs: []string{"Split"}},
+		},
+	}
+	if got := Generate("Go", "github.com/golang/go", defs); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestSet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-stdlib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	manifest := `{"Language": "Go", "Repo": "github.com/golang/go", "DocURL": "https://golang.org/pkg/{unit}/#{dotpath}",
+"Units": [{"UnitType": "GoPackage", "Unit": "net/http", "Defs": ["Client/Do", "Get"]}]}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.json"), []byte(manifest), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Load([]string{dir, filepath.Join(dir, "nonexistent")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Manifests) != 1 {
+		t.Fatalf("got %d manifests, want 1", len(s.Manifests))
+	}
+	m := s.Manifests[0]
+	if got, want := m.DefDocURL("net/http", "Client/Do"), "https://golang.org/pkg/net/http/#Client.Do"; got != want {
+		t.Errorf("got doc URL %q, want %q", got, want)
+	}
+
+	refs := []*graph.Ref{
+		{DefUnitType: "GoPackage", DefUnit: "net/http", DefPath: "Get"},
+		{DefRepo: "github.com/golang/go", DefUnitType: "GoPackage", DefUnit: "net/http", DefPath: "Client/Do"},
+		{DefRepo: "example.com/other", DefUnitType: "GoPackage", DefUnit: "net/http", DefPath: "Get"},
+		{DefUnitType: "GoPackage", DefUnit: "net/http", DefPath: "Missing"},
+	}
+	for i, want := range []bool{true, true, false, false} {
+		if got := s.Lookup(refs[i]) != nil; got != want {
+			t.Errorf("ref %d: got found %v, want %v", i, got, want)
+		}
+	}
+
+	// Refs into a local unit with the same name as a stdlib unit are
+	// not resolved.
+	local := []*unit.SourceUnit{{Key: unit.Key{Type: "GoPackage", Name: "net/http"}}}
+	if n := s.ResolveRefs(refs, "example.com/me", local); n != 0 {
+		t.Errorf("got %d refs resolved into local unit, want 0", n)
+	}
+	if n := s.ResolveRefs(refs, "example.com/me", nil); n != 1 {
+		t.Errorf("got %d refs resolved, want 1", n)
+	}
+	if refs[0].DefRepo != "github.com/golang/go" {
+		t.Errorf("got DefRepo %q, want the stdlib repo", refs[0].DefRepo)
+	}
+	if refs[3].DefRepo != "" {
+		t.Errorf("got DefRepo %q for ref to missing def, want empty", refs[3].DefRepo)
+	}
+}
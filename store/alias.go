@@ -0,0 +1,41 @@
+package store
+
+import "sourcegraph.com/sourcegraph/srclib/graph"
+
+// ByAliases returns a filter that selects alias defs (i.e., defs
+// with an AliasOf).
+func ByAliases() DefFilter {
+	return DefFilterFunc(func(def *graph.Def) bool { return def.AliasOf != nil })
+}
+
+// LoadAliases returns the aliases defined by the alias defs in s that
+// match the filters.
+func LoadAliases(s UnitStore, fs ...DefFilter) (graph.Aliases, error) {
+	defs, err := s.Defs(append([]DefFilter{ByAliases()}, fs...)...)
+	if err != nil {
+		return nil, err
+	}
+	return graph.NewAliases(defs), nil
+}
+
+// ByRefDefOrAliases returns a filter that selects refs to def (as
+// ByRefDef does) and refs to any of the defs in aliases that
+// (transitively) alias def. If def has no aliases, it returns
+// ByRefDef(def), which can use an index.
+func ByRefDefOrAliases(def graph.RefDefKey, aliases graph.Aliases) RefFilter {
+	key := graph.DefKey{Repo: def.DefRepo, UnitType: def.DefUnitType, Unit: def.DefUnit, Path: def.DefPath}
+	keys := aliases.AliasesOf(key)
+	if len(keys) == 0 {
+		return ByRefDef(def)
+	}
+
+	match := make(map[graph.DefKey]struct{}, len(keys)+1)
+	match[key] = struct{}{}
+	for _, k := range keys {
+		match[k] = struct{}{}
+	}
+	return AbsRefFilterFunc(func(ref *graph.Ref) bool {
+		_, ok := match[ref.DefKey()]
+		return ok
+	})
+}
@@ -0,0 +1,41 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestByRefDefOrAliases(t *testing.T) {
+	aliases := graph.NewAliases([]*graph.Def{
+		{DefKey: graph.DefKey{UnitType: "t", Unit: "u", Path: "z/y"}, AliasOf: &graph.DefKey{Path: "x/y"}},
+		{DefKey: graph.DefKey{UnitType: "t", Unit: "u2", Path: "w/y"}, AliasOf: &graph.DefKey{UnitType: "t", Unit: "u", Path: "z/y"}},
+	})
+	refs := []*graph.Ref{
+		{DefUnitType: "t", DefUnit: "u", DefPath: "x/y", File: "a"},
+		{DefUnitType: "t", DefUnit: "u", DefPath: "z/y", File: "b"},
+		{DefUnitType: "t", DefUnit: "u2", DefPath: "w/y", File: "c"},
+		{DefUnitType: "t", DefUnit: "u", DefPath: "v", File: "d"},
+	}
+	tests := map[string]struct {
+		def  graph.RefDefKey
+		want []string
+	}{
+		"canonical": {graph.RefDefKey{DefUnitType: "t", DefUnit: "u", DefPath: "x/y"}, []string{"a", "b", "c"}},
+		"alias":     {graph.RefDefKey{DefUnitType: "t", DefUnit: "u", DefPath: "z/y"}, []string{"b"}},
+		"no alias":  {graph.RefDefKey{DefUnitType: "t", DefUnit: "u", DefPath: "v"}, []string{"d"}},
+	}
+	for label, test := range tests {
+		f := ByRefDefOrAliases(test.def, aliases)
+		var got []string
+		for _, r := range refs {
+			if f.SelectRef(r) {
+				got = append(got, r.File)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got refs %v, want %v", label, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package store
+
+import (
+	"io"
+	"sync"
+
+	"github.com/alecthomas/binary"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store/phtable"
+)
+
+// defKindIndex makes it fast to determine which defs (within a source
+// unit) are of a given kind (e.g., all of the classes in a unit).
+type defKindIndex struct {
+	phtable *phtable.CHD
+	ready   bool
+	sync.RWMutex
+}
+
+var _ interface {
+	Index
+	persistedIndex
+	defIndexBuilder
+	defIndex
+} = (*defKindIndex)(nil)
+
+func (x *defKindIndex) String() string { return "defKindIndex" }
+
+func (x *defKindIndex) getByKind(kind string) (byteOffsets, bool, error) {
+	if x.phtable == nil {
+		panic("phtable not built/read")
+	}
+	v := x.phtable.Get([]byte(kind))
+	if v == nil {
+		return nil, false, nil
+	}
+
+	var ofs byteOffsets
+	if err := binary.Unmarshal(v, &ofs); err != nil {
+		return nil, true, err
+	}
+	return ofs, true, nil
+}
+
+// Covers implements defIndex.
+func (x *defKindIndex) Covers(filters interface{}) int {
+	cov := 0
+	for _, f := range storeFilters(filters) {
+		if _, ok := f.(ByDefKindFilter); ok {
+			cov++
+		}
+	}
+	return cov
+}
+
+// Defs implements defIndex.
+func (x *defKindIndex) Defs(fs ...DefFilter) (byteOffsets, error) {
+	x.RLock()
+	defer x.RUnlock()
+	for _, f := range fs {
+		if ff, ok := f.(ByDefKindFilter); ok {
+			ofs, _, err := x.getByKind(ff.ByDefKind())
+			return ofs, err
+		}
+	}
+	return nil, nil
+}
+
+// Build implements defIndexBuilder.
+func (x *defKindIndex) Build(defs []*graph.Def, ofs byteOffsets) error {
+	x.Lock()
+	defer x.Unlock()
+	vlog.Printf("defKindIndex: building inverted kind->def index (%d defs)...", len(defs))
+	kindToDefOfs := map[string]byteOffsets{}
+	for i, def := range defs {
+		kindToDefOfs[def.Kind] = append(kindToDefOfs[def.Kind], ofs[i])
+	}
+
+	b := phtable.Builder(len(kindToDefOfs))
+	for kind, defOfs := range kindToDefOfs {
+		v, err := binary.Marshal(defOfs)
+		if err != nil {
+			return err
+		}
+		b.Add([]byte(kind), v)
+	}
+	h, err := b.Build()
+	if err != nil {
+		return err
+	}
+	h.StoreKeys = true // so lookups of kinds not in the unit don't match another kind
+	x.phtable = h
+	x.ready = true
+	vlog.Printf("defKindIndex: done building index (%d kinds).", len(kindToDefOfs))
+	return nil
+}
+
+// Write implements persistedIndex.
+func (x *defKindIndex) Write(w io.Writer) error {
+	x.RLock()
+	defer x.RUnlock()
+	if x.phtable == nil {
+		panic("no phtable to write")
+	}
+	return x.phtable.Write(w)
+}
+
+// Read implements persistedIndex.
+func (x *defKindIndex) Read(r io.Reader) error {
+	phtable, err := phtable.Read(r)
+	x.Lock()
+	defer x.Unlock()
+	x.phtable = phtable
+	x.ready = (err == nil)
+	return err
+}
+
+// Ready implements persistedIndex.
+func (x *defKindIndex) Ready() bool {
+	x.RLock()
+	defer x.RUnlock()
+	return x.ready
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestDefKindIndex_Covers(t *testing.T) {
+	x := &defKindIndex{}
+	c := x.Covers([]DefFilter{ByDefKind(graph.KindClass)})
+	if want := 1; c != want {
+		t.Errorf("got coverage %d, want %d", c, want)
+	}
+
+	c = x.Covers([]DefFilter{ByDefPath("p")})
+	if want := 0; c != want {
+		t.Errorf("got coverage %d, want %d", c, want)
+	}
+}
+
+func TestDefKindIndex(t *testing.T) {
+	defs := []*graph.Def{
+		{DefKey: graph.DefKey{Path: "a"}, Kind: graph.KindClass},
+		{DefKey: graph.DefKey{Path: "b"}, Kind: graph.KindMethod},
+		{DefKey: graph.DefKey{Path: "c"}, Kind: graph.KindClass},
+	}
+	x := &defKindIndex{}
+	if err := x.Build(defs, byteOffsets{10, 20, 30}); err != nil {
+		t.Fatal(err)
+	}
+	if !x.Ready() {
+		t.Fatal("index not ready after Build")
+	}
+
+	tests := map[string]byteOffsets{
+		graph.KindClass:    {10, 30},
+		graph.KindMethod:   {20},
+		graph.KindFunction: nil,
+	}
+	for kind, want := range tests {
+		ofs, err := x.Defs(ByDefKind(kind))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(ofs, want) {
+			t.Errorf("%s: got offsets %v, want %v", kind, ofs, want)
+		}
+	}
+}
@@ -425,6 +425,59 @@ func (f byUnitKeyFilter) SelectUnit(unit *unit.SourceUnit) bool {
 		(unit.Type == "" || unit.Type == f.key.Type) && (unit.Name == "" || unit.Name == f.key.Name)
 }
 
+// ByUnitOwners returns a filter that selects source units owned by
+// any of the given owners (see unit.Info.Owners). To select the defs
+// or refs of those units, list the units and then use ByUnits.
+func ByUnitOwners(owners ...string) UnitFilter {
+	return byUnitOwnersFilter(owners)
+}
+
+type byUnitOwnersFilter []string
+
+func (f byUnitOwnersFilter) String() string { return fmt.Sprintf("ByUnitOwners(%v)", []string(f)) }
+func (f byUnitOwnersFilter) SelectUnit(unit *unit.SourceUnit) bool {
+	for _, o := range f {
+		if unit.HasOwner(o) {
+			return true
+		}
+	}
+	return false
+}
+
+// ByUnitTags returns a filter that selects source units that have
+// all of the given tags (see unit.Info.Tags).
+func ByUnitTags(tags ...string) UnitFilter {
+	return byUnitTagsFilter(tags)
+}
+
+type byUnitTagsFilter []string
+
+func (f byUnitTagsFilter) String() string { return fmt.Sprintf("ByUnitTags(%v)", []string(f)) }
+func (f byUnitTagsFilter) SelectUnit(unit *unit.SourceUnit) bool {
+	for _, t := range f {
+		if !unit.HasTag(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// ByUnitMetadata returns a filter that selects source units whose
+// Metadata has the given value for key (see unit.Info.Metadata).
+func ByUnitMetadata(key, value string) UnitFilter {
+	return byUnitMetadataFilter{key, value}
+}
+
+type byUnitMetadataFilter struct{ key, value string }
+
+func (f byUnitMetadataFilter) String() string {
+	return fmt.Sprintf("ByUnitMetadata(%s=%s)", f.key, f.value)
+}
+func (f byUnitMetadataFilter) SelectUnit(unit *unit.SourceUnit) bool {
+	v, present := unit.Metadata[f.key]
+	return present && v == f.value
+}
+
 // ByDefKey returns a filter by a def key. It panics if the def path
 // is not set. If you pass a ByDefKey filter to a store that's scoped
 // to a specific repo/version/unit, then it will match all items in
@@ -571,8 +624,12 @@ type absRefFilterFunc struct {
 func (f *absRefFilterFunc) String() string {
 	return fmt.Sprintf("AbsRefFilterFunc(func %p, impliedRepo=%q, impliedCommitID=%q, impliedUnit=%+v)", f.f, f.impliedRepo, f.impliedCommitID, f.impliedUnit)
 }
-func (f *absRefFilterFunc) setImpliedRepo(repo string)         { f.impliedRepo = repo }
-func (f *absRefFilterFunc) setImpliedCommitID(commitID string) { f.impliedCommitID = commitID }
+func (f *absRefFilterFunc) setImpliedRepo(repo string) { f.impliedRepo = repo }
+func (f *absRefFilterFunc) withImpliedCommitID(commitID string) RefFilter {
+	newF := *f
+	newF.impliedCommitID = commitID
+	return &newF
+}
 func (f *absRefFilterFunc) withImpliedUnit(u unit.ID2) RefFilter {
 	newF := *f
 	newF.impliedUnit = u
@@ -604,7 +661,7 @@ type impliedRepoSetter interface {
 	setImpliedRepo(string)
 }
 type impliedCommitIDSetter interface {
-	setImpliedCommitID(string)
+	withImpliedCommitID(string) RefFilter
 }
 type impliedUnitSetter interface {
 	withImpliedUnit(unit.ID2) RefFilter
@@ -618,12 +675,20 @@ func setImpliedRepo(fs []RefFilter, repo string) {
 	}
 }
 
-func setImpliedCommitID(fs []RefFilter, commitID string) {
-	for _, f := range fs {
-		if f, ok := f.(impliedCommitIDSetter); ok {
-			f.setImpliedCommitID(commitID)
+// withImpliedCommitID returns a copy of fs in which the filters that
+// depend on the commit ID being filtered are replaced by copies that
+// imply commitID, so that the refs of multiple commits can be
+// filtered concurrently.
+func withImpliedCommitID(fs []RefFilter, commitID string) []RefFilter {
+	fCopy := make([]RefFilter, len(fs))
+	for i, f := range fs {
+		if fCommitIDSetter, ok := f.(impliedCommitIDSetter); ok {
+			fCopy[i] = fCommitIDSetter.withImpliedCommitID(commitID)
+		} else {
+			fCopy[i] = f
 		}
 	}
+	return fCopy
 }
 
 func withImpliedUnit(fs []RefFilter, u unit.ID2) []RefFilter {
@@ -664,6 +729,62 @@ func (f byDefPathFilter) SelectDef(def *graph.Def) bool {
 	return def.Path == string(f)
 }
 
+// ByDefKindFilter is implemented by filters that restrict their
+// selection to defs of a specific (canonical) kind.
+type ByDefKindFilter interface {
+	ByDefKind() string
+}
+
+// ByDefKind returns a filter by def kind (one of the canonical def
+// kinds, such as graph.KindClass). It panics if kind is empty.
+func ByDefKind(kind string) interface {
+	DefFilter
+	ByDefKindFilter
+} {
+	if kind == "" {
+		panic("kind: empty")
+	}
+	return byDefKindFilter(kind)
+}
+
+type byDefKindFilter string
+
+func (f byDefKindFilter) String() string    { return fmt.Sprintf("ByDefKind(%s)", string(f)) }
+func (f byDefKindFilter) ByDefKind() string { return string(f) }
+func (f byDefKindFilter) SelectDef(def *graph.Def) bool {
+	return def.Kind == string(f)
+}
+
+// ByDefExported returns a filter that selects exported defs (i.e.,
+// defs that are part of their source unit's public API).
+func ByDefExported() DefFilter { return byDefExportedFilter{} }
+
+type byDefExportedFilter struct{}
+
+func (f byDefExportedFilter) String() string                { return "ByDefExported" }
+func (f byDefExportedFilter) SelectDef(def *graph.Def) bool { return def.Exported }
+
+// ByTestCode returns a filter that selects the defs and refs in test
+// code (i.e., whose Test field is set) and the source units that are
+// tagged unit.TestTag, if test is true, or
+// the ones that aren't, if test is false.
+func ByTestCode(test bool) interface {
+	DefFilter
+	RefFilter
+	UnitFilter
+} {
+	return byTestCodeFilter(test)
+}
+
+type byTestCodeFilter bool
+
+func (f byTestCodeFilter) String() string                { return fmt.Sprintf("ByTestCode(%v)", bool(f)) }
+func (f byTestCodeFilter) SelectDef(def *graph.Def) bool { return def.Test == bool(f) }
+func (f byTestCodeFilter) SelectRef(ref *graph.Ref) bool { return ref.Test == bool(f) }
+func (f byTestCodeFilter) SelectUnit(u *unit.SourceUnit) bool {
+	return u.HasTag(unit.TestTag) == bool(f)
+}
+
 // ByDefQueryFilter is implemented by filters that restrict their
 // selection to defs whose names match the query.
 type ByDefQueryFilter interface {
@@ -0,0 +1,305 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// A FilterExpr is a parsed filter expression, which selects defs or
+// refs by the values of their fields. It is a list of terms separated
+// by spaces, all of which must match. Each term is a field name
+// followed by ":" and a value, which matches objects whose field
+// equals the value (or, if the value contains "*" or "?", matches it
+// as a glob pattern, in which "**" matches any number of path
+// components), or followed by "~" and a regular expression, which
+// matches objects whose field contains a match of the regexp. Values
+// with spaces or other special characters may be double-quoted (as in
+// Go). A term preceded by "-" matches objects that the term doesn't
+// match. For example:
+//
+//	kind:func exported:true file:pkg/** name~"^New" -test:true
+//
+// The fields are listed in DefExprFields and RefExprFields. Boolean
+// fields (such as exported) match the values "true" and "false".
+//
+// Terms that select objects by exact repository, commit, source unit,
+// def path, def kind, or file are evaluated using the store's indexes
+// (when it has them).
+type FilterExpr struct {
+	Terms []*FilterTerm
+}
+
+// A FilterTerm is a term in a FilterExpr.
+type FilterTerm struct {
+	Negate bool   // whether the term is preceded by "-"
+	Field  string // the field name
+	Op     string // ":" or "~"
+	Value  string // the unquoted value
+}
+
+func (t *FilterTerm) String() string {
+	var neg string
+	if t.Negate {
+		neg = "-"
+	}
+	return neg + t.Field + t.Op + strconv.Quote(t.Value)
+}
+
+func (e *FilterExpr) String() string {
+	terms := make([]string, len(e.Terms))
+	for i, t := range e.Terms {
+		terms[i] = t.String()
+	}
+	return strings.Join(terms, " ")
+}
+
+// ParseFilterExpr parses the filter expression s (see FilterExpr).
+func ParseFilterExpr(s string) (*FilterExpr, error) {
+	var e FilterExpr
+	for {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		if s == "" {
+			return &e, nil
+		}
+		term := strings.Fields(s)[0]
+		var t FilterTerm
+		if s[0] == '-' {
+			t.Negate = true
+			s = s[1:]
+		}
+		i := strings.IndexAny(s, ":~")
+		if i <= 0 || strings.IndexFunc(s[:i], unicode.IsSpace) != -1 {
+			return nil, fmt.Errorf("invalid filter term %q (expected field:value or field~regexp)", term)
+		}
+		t.Field, t.Op, s = strings.ToLower(s[:i]), s[i:i+1], s[i+1:]
+
+		if strings.HasPrefix(s, `"`) {
+			// Find the closing quote (skipping escaped characters).
+			end := -1
+			for j := 1; j < len(s); j++ {
+				if s[j] == '\\' {
+					j++
+				} else if s[j] == '"' {
+					end = j
+					break
+				}
+			}
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated quoted value in filter term %s%s", t.Field, t.Op)
+			}
+			v, err := strconv.Unquote(s[:end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted value in filter term %s%s: %s", t.Field, t.Op, err)
+			}
+			t.Value, s = v, s[end+1:]
+		} else {
+			end := strings.IndexFunc(s, unicode.IsSpace)
+			if end == -1 {
+				end = len(s)
+			}
+			t.Value, s = s[:end], s[end:]
+		}
+		e.Terms = append(e.Terms, &t)
+	}
+}
+
+// DefExprFields maps the name of each def field that may be used in a
+// FilterExpr to a function that returns its value.
+var DefExprFields = map[string]func(*graph.Def) string{
+	"repo":       func(d *graph.Def) string { return d.Repo },
+	"commit":     func(d *graph.Def) string { return d.CommitID },
+	"unit-type":  func(d *graph.Def) string { return d.UnitType },
+	"unit":       func(d *graph.Def) string { return d.Unit },
+	"path":       func(d *graph.Def) string { return d.Path },
+	"name":       func(d *graph.Def) string { return d.Name },
+	"kind":       func(d *graph.Def) string { return d.Kind },
+	"raw-kind":   func(d *graph.Def) string { return d.RawKind },
+	"file":       func(d *graph.Def) string { return d.File },
+	"visibility": func(d *graph.Def) string { return d.Visibility },
+	"exported":   func(d *graph.Def) string { return strconv.FormatBool(d.Exported) },
+	"local":      func(d *graph.Def) string { return strconv.FormatBool(d.Local) },
+	"test":       func(d *graph.Def) string { return strconv.FormatBool(d.Test) },
+	"generated":  func(d *graph.Def) string { return strconv.FormatBool(d.Generated) },
+	"alias":      func(d *graph.Def) string { return strconv.FormatBool(d.AliasOf != nil) },
+}
+
+// RefExprFields maps the name of each ref field that may be used in a
+// FilterExpr to a function that returns its value. The def-* fields
+// are those of the def that the ref refers to.
+var RefExprFields = map[string]func(*graph.Ref) string{
+	"repo":          func(r *graph.Ref) string { return r.Repo },
+	"commit":        func(r *graph.Ref) string { return r.CommitID },
+	"unit-type":     func(r *graph.Ref) string { return r.UnitType },
+	"unit":          func(r *graph.Ref) string { return r.Unit },
+	"file":          func(r *graph.Ref) string { return r.File },
+	"def-repo":      func(r *graph.Ref) string { return r.DefRepo },
+	"def-unit-type": func(r *graph.Ref) string { return r.DefUnitType },
+	"def-unit":      func(r *graph.Ref) string { return r.DefUnit },
+	"def-path":      func(r *graph.Ref) string { return r.DefPath },
+	"def":           func(r *graph.Ref) string { return strconv.FormatBool(r.Def) },
+	"test":          func(r *graph.Ref) string { return strconv.FormatBool(r.Test) },
+	"generated":     func(r *graph.Ref) string { return strconv.FormatBool(r.Generated) },
+}
+
+// DefFilters returns the filters that select the defs that e matches.
+func (e *FilterExpr) DefFilters() ([]DefFilter, error) {
+	var fs []DefFilter
+	for _, f := range e.indexedFilters() {
+		if df, ok := f.(DefFilter); ok {
+			fs = append(fs, df)
+		}
+	}
+	for _, t := range e.Terms {
+		field, ok := DefExprFields[t.Field]
+		if !ok {
+			return nil, fmt.Errorf("unknown def field %q in filter term %s (valid fields: %s)", t.Field, t, fieldNames(DefExprFields))
+		}
+		match, err := t.matcher()
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, DefFilterFunc(func(d *graph.Def) bool { return match(field(d)) }))
+	}
+	return fs, nil
+}
+
+// RefFilters returns the filters that select the refs that e matches.
+func (e *FilterExpr) RefFilters() ([]RefFilter, error) {
+	var fs []RefFilter
+	for _, f := range e.indexedFilters() {
+		if rf, ok := f.(RefFilter); ok {
+			fs = append(fs, rf)
+		}
+	}
+	for _, t := range e.Terms {
+		field, ok := RefExprFields[t.Field]
+		if !ok {
+			return nil, fmt.Errorf("unknown ref field %q in filter term %s (valid fields: %s)", t.Field, t, fieldNames(RefExprFields))
+		}
+		match, err := t.matcher()
+		if err != nil {
+			return nil, err
+		}
+		f := RefFilterFunc(func(r *graph.Ref) bool { return match(field(r)) })
+		if strings.HasPrefix(t.Field, "def-") {
+			fs = append(fs, AbsRefFilterFunc(f))
+		} else {
+			fs = append(fs, f)
+		}
+	}
+	return fs, nil
+}
+
+// indexedFilters returns the filters (which the store's indexes can
+// evaluate) that are implied by e's positive, exact terms. They select
+// a superset of the objects that e matches, so e's terms are still
+// evaluated in full.
+func (e *FilterExpr) indexedFilters() []interface{} {
+	exact := map[string]string{}
+	for _, t := range e.Terms {
+		if !t.Negate && t.Op == ":" && !isGlob(t.Value) {
+			exact[t.Field] = t.Value
+		}
+	}
+
+	var fs []interface{}
+	if v, ok := exact["repo"]; ok && v != "" {
+		fs = append(fs, ByRepos(v))
+	}
+	if v, ok := exact["commit"]; ok && v != "" {
+		fs = append(fs, ByCommitIDs(v))
+	}
+	if typ, name := exact["unit-type"], exact["unit"]; typ != "" && name != "" {
+		fs = append(fs, ByUnits(unit.ID2{Type: typ, Name: name}))
+	}
+	if v, ok := exact["file"]; ok && v != "" && v == path.Clean(v) {
+		fs = append(fs, ByFiles(true, v))
+	}
+	if v, ok := exact["path"]; ok && v != "" {
+		fs = append(fs, ByDefPath(v))
+	}
+	if v, ok := exact["kind"]; ok && v != "" {
+		fs = append(fs, ByDefKind(v))
+	}
+	return fs
+}
+
+// matcher returns a function that reports whether a field value
+// matches t.
+func (t *FilterTerm) matcher() (func(string) bool, error) {
+	var match func(string) bool
+	switch {
+	case t.Op == "~":
+		re, err := regexp.Compile(t.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp in filter term %s: %s", t, err)
+		}
+		match = re.MatchString
+	case isGlob(t.Value):
+		re := globRegexp(t.Value)
+		match = re.MatchString
+	default:
+		v := t.Value
+		match = func(s string) bool { return s == v }
+	}
+	if t.Negate {
+		return func(s string) bool { return !match(s) }, nil
+	}
+	return match, nil
+}
+
+func isGlob(s string) bool { return strings.ContainsAny(s, "*?") }
+
+// globRegexp converts a glob pattern to an anchored regexp. In the
+// pattern, "**" matches any string (including "/"), "*" matches any
+// string not containing "/", and "?" matches any single character
+// except "/".
+func globRegexp(pat string) *regexp.Regexp {
+	var re bytes.Buffer
+	re.WriteString("^")
+	for i := 0; i < len(pat); i++ {
+		switch {
+		case strings.HasPrefix(pat[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pat[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case pat[i] == '*':
+			re.WriteString("[^/]*")
+		case pat[i] == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(pat[i : i+1]))
+		}
+	}
+	re.WriteString("$")
+	return regexp.MustCompile(re.String())
+}
+
+// fieldNames returns the sorted keys of a map of fields, separated by
+// commas.
+func fieldNames(fields interface{}) string {
+	var names []string
+	switch fields := fields.(type) {
+	case map[string]func(*graph.Def) string:
+		for name := range fields {
+			names = append(names, name)
+		}
+	case map[string]func(*graph.Ref) string:
+		for name := range fields {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,159 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestParseFilterExpr(t *testing.T) {
+	tests := map[string][]*FilterTerm{
+		"":    nil,
+		"   ": nil,
+		"kind:func": {
+			{Field: "kind", Op: ":", Value: "func"},
+		},
+		`kind:func  exported:true file:pkg/** name~"^New" -Test:true`: {
+			{Field: "kind", Op: ":", Value: "func"},
+			{Field: "exported", Op: ":", Value: "true"},
+			{Field: "file", Op: ":", Value: "pkg/**"},
+			{Field: "name", Op: "~", Value: "^New"},
+			{Negate: true, Field: "test", Op: ":", Value: "true"},
+		},
+		`path:"a b\"c" name:`: {
+			{Field: "path", Op: ":", Value: `a b"c`},
+			{Field: "name", Op: ":", Value: ""},
+		},
+		"file:a:b": {
+			{Field: "file", Op: ":", Value: "a:b"},
+		},
+	}
+	for s, want := range tests {
+		e, err := ParseFilterExpr(s)
+		if err != nil {
+			t.Errorf("%q: %s", s, err)
+			continue
+		}
+		if !reflect.DeepEqual(e.Terms, want) {
+			t.Errorf("%q: got terms %v, want %v", s, e.Terms, want)
+		}
+	}
+
+	for _, s := range []string{"kind", ":func", "-", `name:"foo`, `name:"\q"`} {
+		if _, err := ParseFilterExpr(s); err == nil {
+			t.Errorf("%q: got no error, want error", s)
+		}
+	}
+}
+
+func TestFilterExpr_DefFilters(t *testing.T) {
+	defs := []*graph.Def{
+		{DefKey: graph.DefKey{Path: "a/NewA"}, Name: "NewA", Kind: "func", File: "pkg/a/a.go", Exported: true},
+		{DefKey: graph.DefKey{Path: "a/newB"}, Name: "newB", Kind: "func", File: "pkg/a/b.go"},
+		{DefKey: graph.DefKey{Path: "a/NewC"}, Name: "NewC", Kind: "func", File: "pkg/a/a_test.go", Exported: true, Test: true},
+		{DefKey: graph.DefKey{Path: "b/NewD"}, Name: "NewD", Kind: "type", File: "cmd/d.go", Exported: true},
+	}
+	tests := map[string][]string{
+		"":                         {"a/NewA", "a/newB", "a/NewC", "b/NewD"},
+		"kind:func":                {"a/NewA", "a/newB", "a/NewC"},
+		"-kind:func":               {"b/NewD"},
+		`name~"^New"`:              {"a/NewA", "a/NewC", "b/NewD"},
+		"file:pkg/**":              {"a/NewA", "a/newB", "a/NewC"},
+		"file:**/*.go":             {"a/NewA", "a/newB", "a/NewC", "b/NewD"},
+		"file:pkg/*.go":            nil,
+		"file:pkg/a/a.go":          {"a/NewA"},
+		"path:a/*":                 {"a/NewA", "a/newB", "a/NewC"},
+		"exported:true -test:true": {"a/NewA", "b/NewD"},
+		`kind:func exported:true file:pkg/** name~"^New" -test:true`: {"a/NewA"},
+	}
+	for s, want := range tests {
+		e, err := ParseFilterExpr(s)
+		if err != nil {
+			t.Fatalf("%q: %s", s, err)
+		}
+		fs, err := e.DefFilters()
+		if err != nil {
+			t.Fatalf("%q: %s", s, err)
+		}
+		var got []string
+		for _, d := range defs {
+			if defMatchesAll(d, fs) {
+				got = append(got, d.Path)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got defs %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestFilterExpr_RefFilters(t *testing.T) {
+	refs := []*graph.Ref{
+		{DefRepo: "r", DefUnitType: "t", DefUnit: "u", DefPath: "p", Repo: "r", UnitType: "t", Unit: "u", File: "f.go", Def: true},
+		{DefRepo: "r", DefUnitType: "t", DefUnit: "u", DefPath: "p", Repo: "r", UnitType: "t", Unit: "u2", File: "f_test.go", Test: true},
+		{DefRepo: "r2", DefUnitType: "t", DefUnit: "u", DefPath: "q", Repo: "r", UnitType: "t", Unit: "u2", File: "g.go"},
+	}
+	tests := map[string][]string{
+		"def-path:p":           {"f.go", "f_test.go"},
+		"def-repo:r":           {"f.go", "f_test.go"},
+		"-def:true -test:true": {"g.go"},
+		"unit:u2 file~_test":   {"f_test.go"},
+	}
+	for s, want := range tests {
+		e, err := ParseFilterExpr(s)
+		if err != nil {
+			t.Fatalf("%q: %s", s, err)
+		}
+		fs, err := e.RefFilters()
+		if err != nil {
+			t.Fatalf("%q: %s", s, err)
+		}
+		var got []string
+		for _, r := range refs {
+			if refMatchesAll(r, fs) {
+				got = append(got, r.File)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got refs %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestFilterExpr_errors(t *testing.T) {
+	for _, s := range []string{"foo:bar", `name~"("`} {
+		e, err := ParseFilterExpr(s)
+		if err != nil {
+			t.Fatalf("%q: %s", s, err)
+		}
+		if _, err := e.DefFilters(); err == nil {
+			t.Errorf("%q: got no DefFilters error, want error", s)
+		}
+	}
+	e, err := ParseFilterExpr("name:foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.RefFilters(); err == nil {
+		t.Error("got no RefFilters error for def-only field, want error")
+	}
+}
+
+func defMatchesAll(d *graph.Def, fs []DefFilter) bool {
+	for _, f := range fs {
+		if !f.SelectDef(d) {
+			return false
+		}
+	}
+	return true
+}
+
+func refMatchesAll(r *graph.Ref, fs []RefFilter) bool {
+	for _, f := range fs {
+		if !f.SelectRef(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -57,6 +57,26 @@ func NewFSMultiRepoStore(fs rwvfs.WalkableFileSystem, conf *FSMultiRepoStoreConf
 	return mrs
 }
 
+// WithIndexBuildJobs returns a copy of s, a store created by
+// NewFSRepoStore or NewFSMultiRepoStore, that builds up to n indexes
+// concurrently (see FSMultiRepoStoreConf.IndexBuildJobs). Other
+// stores are returned as is.
+func WithIndexBuildJobs(s interface{}, n int) interface{} {
+	switch s := s.(type) {
+	case *fsRepoStore:
+		rs := *s
+		rs.indexJobs = n
+		rs.treeStores = treeStores{&rs}
+		return &rs
+	case *fsMultiRepoStore:
+		mrs := *s
+		mrs.IndexBuildJobs = n
+		mrs.repoStores = repoStores{&mrs}
+		return &mrs
+	}
+	return s
+}
+
 // FSMultiRepoStoreConf configures an FS-backed multi-repo store. Pass
 // it to NewFSMultiRepoStore to construct a new store with the
 // specified options.
@@ -65,6 +85,15 @@ type FSMultiRepoStoreConf struct {
 	// repository data. If nil, DefaultRepoPaths is used, which stores
 	// repos at "${REPO}/.srclib-store".
 	RepoPaths
+
+	// IndexBuildJobs is the maximum number of indexes that the store
+	// builds concurrently, and of source units' indexes that it reads
+	// concurrently to build the indexes that span them. Each index
+	// (and the data it is built from) is held in memory while it is
+	// built, so lowering IndexBuildJobs bounds the memory used by
+	// imports and indexing of large repositories. If it is 0 or less,
+	// GOMAXPROCS is used.
+	IndexBuildJobs int
 }
 
 // getRepo gets a single repo.
@@ -149,7 +178,9 @@ func (s *fsMultiRepoStore) Repos(f ...RepoFilter) ([]string, error) {
 
 func (s *fsMultiRepoStore) openRepoStore(repo string) RepoStore {
 	subpath := s.fs.Join(s.RepoToPath(repo)...)
-	return NewFSRepoStore(rwvfs.Walkable(rwvfs.Sub(s.fs, subpath)))
+	rs := NewFSRepoStore(rwvfs.Walkable(rwvfs.Sub(s.fs, subpath))).(*fsRepoStore)
+	rs.indexJobs = s.IndexBuildJobs
+	return rs
 }
 
 func (s *fsMultiRepoStore) openAllRepoStores() (map[string]RepoStore, error) {
@@ -196,6 +227,8 @@ func (s *fsMultiRepoStore) String() string { return "fsMultiRepoStore" }
 type fsRepoStore struct {
 	fs rwvfs.WalkableFileSystem
 	treeStores
+
+	indexJobs int // see FSMultiRepoStoreConf.IndexBuildJobs
 }
 
 // SrclibStoreDir is the name of the directory under which a RepoStore's data is stored.
@@ -340,7 +373,7 @@ func (s *fsRepoStore) newTreeStore(commitID string) TreeStoreImporter {
 	fs := s.treeStoreFS(commitID)
 	if useIndexedStore {
 		cacheKey := fs.String()
-		return newIndexedTreeStore(fs, cacheKey)
+		return newIndexedTreeStore(fs, cacheKey, s.indexJobs)
 	}
 	return newFSTreeStore(fs)
 }
@@ -371,6 +404,8 @@ func (s *fsRepoStore) String() string { return "fsRepoStore" }
 type fsTreeStore struct {
 	fs rwvfs.FileSystem
 	unitStores
+
+	indexJobs int // see FSMultiRepoStoreConf.IndexBuildJobs
 }
 
 func newFSTreeStore(fs rwvfs.FileSystem) *fsTreeStore {
@@ -491,7 +526,7 @@ func (s *fsTreeStore) openUnitStore(u unit.ID2) UnitStore {
 	filename := s.unitFilename(u.Type, u.Name)
 	dir := strings.TrimSuffix(filename, unitFileSuffix)
 	if useIndexedStore {
-		return newIndexedUnitStore(rwvfs.Sub(s.fs, dir), u.String())
+		return newIndexedUnitStore(rwvfs.Sub(s.fs, dir), u.String(), s.indexJobs)
 	}
 	return &fsUnitStore{fs: rwvfs.Sub(s.fs, dir), label: u.String()}
 }
@@ -687,6 +722,7 @@ func (s *fsUnitStore) Refs(fs ...RefFilter) (refs []*graph.Ref, err error) {
 		}
 	}()
 
+	var interner graph.Interner
 	dec := Codec.NewDecoder(f)
 	for {
 		var ref graph.Ref
@@ -696,6 +732,7 @@ func (s *fsUnitStore) Refs(fs ...RefFilter) (refs []*graph.Ref, err error) {
 			return nil, err
 		}
 		if refFilters(fs).SelectRef(&ref) {
+			interner.Ref(&ref)
 			refs = append(refs, &ref)
 		}
 	}
@@ -907,6 +944,7 @@ func (s *fsUnitStore) readRefs() (refs []*graph.Ref, fbrs fileByteRanges, ofs by
 	}()
 
 	o := int64(0)
+	var interner graph.Interner
 	dec := Codec.NewDecoder(f)
 	fbrs = fileByteRanges{}
 	lastFile := ""
@@ -918,6 +956,7 @@ func (s *fsUnitStore) readRefs() (refs []*graph.Ref, fbrs fileByteRanges, ofs by
 		} else if err != nil {
 			return nil, nil, nil, err
 		}
+		interner.Ref(&ref)
 
 		ofs = append(ofs, o)
 
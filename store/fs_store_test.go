@@ -36,3 +36,25 @@ func TestFSMultiRepoStore_customRepoPaths(t *testing.T) {
 		return NewFSMultiRepoStore(newTestFS(), &FSMultiRepoStoreConf{RepoPaths: &customRepoPaths{}})
 	})
 }
+
+func TestWithIndexBuildJobs(t *testing.T) {
+	useIndexedStore = true
+
+	rs := NewFSRepoStore(newTestFS())
+	rs2 := WithIndexBuildJobs(rs, 1).(*fsRepoStore)
+	if ts := rs2.newTreeStore("c").(*indexedTreeStore); ts.indexJobs != 1 {
+		t.Errorf("got tree store indexJobs %d, want 1", ts.indexJobs)
+	}
+	if ts := rs.(*fsRepoStore).newTreeStore("c").(*indexedTreeStore); ts.indexJobs != 0 {
+		t.Errorf("got original tree store indexJobs %d, want 0", ts.indexJobs)
+	}
+
+	mrs := NewFSMultiRepoStore(newTestFS(), nil)
+	mrs2 := WithIndexBuildJobs(mrs, 2).(*fsMultiRepoStore)
+	if rs := mrs2.openRepoStore("r").(*fsRepoStore); rs.indexJobs != 2 {
+		t.Errorf("got repo store indexJobs %d, want 2", rs.indexJobs)
+	}
+	if n := mrs.(*fsMultiRepoStore).IndexBuildJobs; n != 0 {
+		t.Errorf("got original IndexBuildJobs %d, want 0", n)
+	}
+}
@@ -66,9 +66,22 @@ const (
 	unitsIndexName = "units"
 )
 
+// indexBuildJobs returns the maximum number of indexes that a store
+// whose IndexBuildJobs setting (see FSMultiRepoStoreConf) is n builds
+// concurrently: n, or GOMAXPROCS if n is 0 or less.
+func indexBuildJobs(n int) int {
+	if n > 0 {
+		return n
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
 // newIndexedTreeStore creates a new indexed tree store that stores
-// data and indexes in fs.
-func newIndexedTreeStore(fs rwvfs.FileSystem, cacheKey interface{}) TreeStoreImporter {
+// data and indexes in fs, building up to indexJobs indexes
+// concurrently (see indexBuildJobs).
+func newIndexedTreeStore(fs rwvfs.FileSystem, cacheKey interface{}, indexJobs int) TreeStoreImporter {
+	ts := newFSTreeStore(fs)
+	ts.indexJobs = indexJobs
 	return &indexedTreeStore{
 		indexes: map[string]Index{
 			"file_to_units":       &unitFilesIndex{},
@@ -77,7 +90,7 @@ func newIndexedTreeStore(fs rwvfs.FileSystem, cacheKey interface{}) TreeStoreImp
 			unitsIndexName:        &unitsIndex{},
 		},
 		cacheKey:    cacheKey,
-		fsTreeStore: newFSTreeStore(fs),
+		fsTreeStore: ts,
 	}
 }
 
@@ -371,7 +384,7 @@ func (s *indexedTreeStore) buildIndexes(xs map[string]Index, units []*unit.Sourc
 				}
 
 				unitRefIndexes = make(map[unit.ID2]*defRefsIndex, len(units))
-				par := parallel.NewRun(runtime.GOMAXPROCS(0))
+				par := parallel.NewRun(indexBuildJobs(s.indexJobs))
 				for u_, us_ := range uss {
 					u := u_
 					us, ok := us_.(*indexedUnitStore)
@@ -423,7 +436,7 @@ func (s *indexedTreeStore) buildIndexes(xs map[string]Index, units []*unit.Sourc
 				}
 
 				unitDefQueryIndexes = make(map[unit.ID2]*defQueryIndex, len(units))
-				par := parallel.NewRun(runtime.GOMAXPROCS(0))
+				par := parallel.NewRun(indexBuildJobs(s.indexJobs))
 				for u_, us_ := range uss {
 					u := u_
 					us, ok := us_.(*indexedUnitStore)
@@ -453,7 +466,7 @@ func (s *indexedTreeStore) buildIndexes(xs map[string]Index, units []*unit.Sourc
 		return unitDefQueryIndexes, getUnitDefQueryIndexesErr
 	}
 
-	par := parallel.NewRun(runtime.GOMAXPROCS(0))
+	par := parallel.NewRun(indexBuildJobs(s.indexJobs))
 	for name_, x_ := range xs {
 		name, x := name_, x_
 		par.Acquire()
@@ -523,6 +536,8 @@ type indexedUnitStore struct {
 	indexes map[string]Index
 
 	*fsUnitStore
+
+	indexJobs int // see indexBuildJobs
 }
 
 var _ interface {
@@ -531,16 +546,19 @@ var _ interface {
 } = (*indexedUnitStore)(nil)
 
 // newIndexedUnitStore creates a new indexed unit store that stores
-// data and indexes in fs.
-func newIndexedUnitStore(fs rwvfs.FileSystem, label string) UnitStoreImporter {
+// data and indexes in fs, building up to indexJobs indexes
+// concurrently (see indexBuildJobs).
+func newIndexedUnitStore(fs rwvfs.FileSystem, label string, indexJobs int) UnitStoreImporter {
 	return &indexedUnitStore{
 		indexes: map[string]Index{
 			"path_to_def":      &defPathIndex{},
+			"kind_to_defs":     &defKindIndex{},
 			"file_to_refs":     &refFileIndex{},
 			defToRefsIndexName: &defRefsIndex{},
 			defQueryIndexName:  &defQueryIndex{f: defQueryFilter},
 		},
 		fsUnitStore: &fsUnitStore{fs: fs, label: label},
+		indexJobs:   indexJobs,
 	}
 }
 
@@ -685,7 +703,7 @@ func (s *indexedUnitStore) buildIndexes(xs map[string]Index, data *graph.Output,
 		return refs, refFBRs, refOfs, getRefsErr
 	}
 
-	par := parallel.NewRun(runtime.GOMAXPROCS(0))
+	par := parallel.NewRun(indexBuildJobs(s.indexJobs))
 	for name_, x_ := range xs {
 		name, x := name_, x_
 		par.Acquire()
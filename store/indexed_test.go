@@ -5,14 +5,14 @@ import "testing"
 func TestIndexedUnitStore(t *testing.T) {
 	useIndexedStore = true
 	testUnitStore(t, func() UnitStoreImporter {
-		return newIndexedUnitStore(newTestFS(), "")
+		return newIndexedUnitStore(newTestFS(), "", 0)
 	})
 }
 
 func TestIndexedTreeStore(t *testing.T) {
 	useIndexedStore = true
 	testTreeStore(t, func() TreeStoreImporter {
-		return newIndexedTreeStore(newTestFS(), "test")
+		return newIndexedTreeStore(newTestFS(), "test", 0)
 	})
 }
 
@@ -43,3 +43,10 @@ func TestIndexedFSMultiRepoStore_customRepoPaths(t *testing.T) {
 		return NewFSMultiRepoStore(newTestFS(), &FSMultiRepoStoreConf{RepoPaths: &customRepoPaths{}})
 	})
 }
+
+func TestIndexedTreeStore_oneIndexBuildJob(t *testing.T) {
+	useIndexedStore = true
+	testTreeStore(t, func() TreeStoreImporter {
+		return newIndexedTreeStore(newTestFS(), "test", 1)
+	})
+}
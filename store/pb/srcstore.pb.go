@@ -134,40 +134,58 @@ func RegisterMultiRepoImporterServer(s *grpc.Server, srv MultiRepoImporterServer
 	s.RegisterService(&_MultiRepoImporter_serviceDesc, srv)
 }
 
-func _MultiRepoImporter_Import_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+func _MultiRepoImporter_Import_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(ImportOp)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
-	out, err := srv.(MultiRepoImporterServer).Import(ctx, in)
-	if err != nil {
-		return nil, err
+	if interceptor == nil {
+		return srv.(MultiRepoImporterServer).Import(ctx, in)
 	}
-	return out, nil
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.MultiRepoImporter/Import",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MultiRepoImporterServer).Import(ctx, req.(*ImportOp))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func _MultiRepoImporter_CreateVersion_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+func _MultiRepoImporter_CreateVersion_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(CreateVersionOp)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
-	out, err := srv.(MultiRepoImporterServer).CreateVersion(ctx, in)
-	if err != nil {
-		return nil, err
+	if interceptor == nil {
+		return srv.(MultiRepoImporterServer).CreateVersion(ctx, in)
 	}
-	return out, nil
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.MultiRepoImporter/CreateVersion",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MultiRepoImporterServer).CreateVersion(ctx, req.(*CreateVersionOp))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func _MultiRepoImporter_Index_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+func _MultiRepoImporter_Index_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(IndexOp)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
-	out, err := srv.(MultiRepoImporterServer).Index(ctx, in)
-	if err != nil {
-		return nil, err
+	if interceptor == nil {
+		return srv.(MultiRepoImporterServer).Index(ctx, in)
 	}
-	return out, nil
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.MultiRepoImporter/Index",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MultiRepoImporterServer).Index(ctx, req.(*IndexOp))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
 var _MultiRepoImporter_serviceDesc = grpc.ServiceDesc{
@@ -2,6 +2,7 @@ package store
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 
 	"sort"
@@ -20,6 +21,7 @@ func testRepoStore(t *testing.T, newFn func() RepoStoreImporter) {
 	testRepoStore_Defs_ByCommitIDs(t, newFn())
 	testRepoStore_Defs_ByCommitIDs_ByFile(t, newFn())
 	testRepoStore_Refs(t, newFn())
+	testRepoStore_Refs_ByCommitIDs(t, newFn())
 }
 
 func testRepoStore_uninitialized(t *testing.T, rs RepoStore) {
@@ -360,3 +362,38 @@ func testRepoStore_Refs(t *testing.T, rs RepoStoreImporter) {
 		t.Errorf("%s: Refs(): got refs %v, want %v", rs, refs, want)
 	}
 }
+
+func testRepoStore_Refs_ByCommitIDs(t *testing.T, rs RepoStoreImporter) {
+	const numCommits = 3
+	for c := 1; c <= numCommits; c++ {
+		unit := &unit.SourceUnit{Key: unit.Key{Type: "t", Name: "u"}, Info: unit.Info{Files: []string{"f"}}}
+		data := graph.Output{Refs: []*graph.Ref{{DefPath: "p", File: "f", Start: uint32(c), End: uint32(c + 1)}}}
+		commitID := fmt.Sprintf("c%d", c)
+		if err := rs.Import(commitID, unit, data); err != nil {
+			t.Errorf("%s: Import(%s, %v, data): %s", rs, commitID, unit, err)
+		}
+		if rs, ok := rs.(RepoIndexer); ok {
+			if err := rs.Index(commitID); err != nil {
+				t.Fatalf("%s: Index: %s", rs, err)
+			}
+		}
+		if err := rs.CreateVersion(commitID); err != nil {
+			t.Errorf("%s: CreateVersion(%s): %s", rs, commitID, err)
+		}
+	}
+
+	// The commits are queried concurrently, and filters that depend
+	// on the commit being queried must see the right one.
+	refs, err := rs.Refs(ByCommitIDs("c1", "c2", "c3"), AbsRefFilterFunc(func(ref *graph.Ref) bool { return ref.CommitID != "c2" }))
+	if err != nil {
+		t.Fatalf("%s: Refs: %s", rs, err)
+	}
+	got := map[string]uint32{}
+	for _, ref := range refs {
+		got[ref.CommitID] = ref.Start
+	}
+	want := map[string]uint32{"c1": 1, "c3": 3}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: Refs: got refs by commit %v, want %v", rs, got, want)
+	}
+}
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// A DefScorer scores the defs that match a search query, so that they
+// can be ranked (see SearchDefs). Higher scores rank first.
+//
+// Hosts that embed srclib can implement DefScorer to plug in their own
+// ranking (e.g., one that uses usage data from outside the store).
+type DefScorer interface {
+	// ScoreDef scores def, which matches query (see ByDefQuery) and
+	// has refs refs to it.
+	ScoreDef(query string, def *graph.Def, refs int) float64
+}
+
+// The DefScorerFunc type is an adapter to allow the use of ordinary
+// functions as DefScorers.
+type DefScorerFunc func(query string, def *graph.Def, refs int) float64
+
+// ScoreDef calls f(query, def, refs).
+func (f DefScorerFunc) ScoreDef(query string, def *graph.Def, refs int) float64 {
+	return f(query, def, refs)
+}
+
+// DefaultDefScorer is the DefScorer that is used if none is given. It
+// scores defs by the sum of:
+//
+//	the quality of the name match (see NameMatchScore)
+//	1 if the def is exported
+//	log10(1+refs), so that each tenfold increase in usage adds 1
+//	-0.25 for each component of the def path after the first
+//
+// Local defs and defs in test code are penalized, because they are
+// rarely what a search is for.
+var DefaultDefScorer DefScorer = DefScorerFunc(scoreDef)
+
+func scoreDef(query string, def *graph.Def, refs int) float64 {
+	score := NameMatchScore(query, def.Name)
+	if def.Exported {
+		score++
+	}
+	score += math.Log10(1 + float64(refs))
+	if depth := strings.Count(def.Path, "/"); depth > 0 {
+		score -= 0.25 * float64(depth)
+	}
+	if def.Local {
+		score -= 2
+	}
+	if def.Test {
+		score -= 0.5
+	}
+	return score
+}
+
+// NameMatchScore scores how well a def name matches a search query:
+// 4 for an exact match, 3 for a case-insensitive match, 2 for a
+// prefix match, 1 for a case-insensitive prefix match, and 0
+// otherwise.
+func NameMatchScore(query, name string) float64 {
+	switch {
+	case name == query:
+		return 4
+	case strings.EqualFold(name, query):
+		return 3
+	case strings.HasPrefix(name, query):
+		return 2
+	case strings.HasPrefix(strings.ToLower(name), strings.ToLower(query)):
+		return 1
+	}
+	return 0
+}
+
+// SearchRefCountLimit is the maximum number of defs whose refs
+// SearchDefs counts. Counting refs requires a query per def, so only
+// the best-scoring matches (scored as though they have no refs) are
+// counted, and the rest are ranked below them.
+var SearchRefCountLimit = 200
+
+// A SearchResult is a def that matches a search query.
+type SearchResult struct {
+	Def   *graph.Def
+	Refs  int     // the number of refs to the def (see SearchRefCountLimit)
+	Score float64 // the def's score (see DefScorer)
+}
+
+// SearchDefs returns the defs in s whose names match query (see
+// ByDefQuery) and that are selected by fs, ranked by the scores
+// assigned to them by scorer (or DefaultDefScorer, if scorer is nil).
+// Defs with equal scores are ordered by their keys.
+func SearchDefs(s UnitStore, query string, scorer DefScorer, fs ...DefFilter) ([]*SearchResult, error) {
+	if scorer == nil {
+		scorer = DefaultDefScorer
+	}
+	defs, err := s.Defs(append([]DefFilter{ByDefQuery(query)}, fs...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*SearchResult, len(defs))
+	for i, def := range defs {
+		results[i] = &SearchResult{Def: def, Score: scorer.ScoreDef(query, def, 0)}
+	}
+	sort.Sort(searchResults(results))
+
+	for i, r := range results {
+		if i == SearchRefCountLimit {
+			break
+		}
+		if r.Def.RefCount > 0 {
+			// The def's refs were downsampled (see
+			// graph.RefCounts), so they can't be counted.
+			r.Refs = int(r.Def.RefCount)
+			r.Score = scorer.ScoreDef(query, r.Def, r.Refs)
+			continue
+		}
+		refFilters := []RefFilter{ByRefDef(graph.RefDefKey{DefRepo: r.Def.Repo, DefUnitType: r.Def.UnitType, DefUnit: r.Def.Unit, DefPath: r.Def.Path})}
+		if r.Def.CommitID != "" {
+			refFilters = append(refFilters, ByCommitIDs(r.Def.CommitID))
+		}
+		refs, err := s.Refs(refFilters...)
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range refs {
+			if !ref.Def {
+				r.Refs++
+			}
+		}
+		r.Score = scorer.ScoreDef(query, r.Def, r.Refs)
+	}
+	if len(results) > SearchRefCountLimit {
+		sort.Sort(searchResults(results[:SearchRefCountLimit]))
+	} else {
+		sort.Sort(searchResults(results))
+	}
+	return results, nil
+}
+
+type searchResults []*SearchResult
+
+func (v searchResults) Len() int      { return len(v) }
+func (v searchResults) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v searchResults) Less(i, j int) bool {
+	if v[i].Score != v[j].Score {
+		return v[i].Score > v[j].Score
+	}
+	a, b := v[i].Def.DefKey, v[j].Def.DefKey
+	if a.Repo != b.Repo {
+		return a.Repo < b.Repo
+	}
+	if a.CommitID != b.CommitID {
+		return a.CommitID < b.CommitID
+	}
+	if a.UnitType != b.UnitType {
+		return a.UnitType < b.UnitType
+	}
+	if a.Unit != b.Unit {
+		return a.Unit < b.Unit
+	}
+	return a.Path < b.Path
+}
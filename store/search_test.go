@@ -0,0 +1,110 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestNameMatchScore(t *testing.T) {
+	tests := []struct {
+		query, name string
+		want        float64
+	}{
+		{"Foo", "Foo", 4},
+		{"foo", "Foo", 3},
+		{"Foo", "FooBar", 2},
+		{"foo", "FooBar", 1},
+		{"foo", "Bar", 0},
+	}
+	for _, test := range tests {
+		if got := NameMatchScore(test.query, test.name); got != test.want {
+			t.Errorf("%q, %q: got %v, want %v", test.query, test.name, got, test.want)
+		}
+	}
+}
+
+func TestSearchDefs(t *testing.T) {
+	def := func(path, name string, exported bool) *graph.Def {
+		return &graph.Def{DefKey: graph.DefKey{UnitType: "t", Unit: "u", Path: path}, Name: name, Exported: exported}
+	}
+	ref := func(defPath string, start uint32) *graph.Ref {
+		return &graph.Ref{DefUnitType: "t", DefUnit: "u", DefPath: defPath, UnitType: "t", Unit: "u", File: "f", Start: start, End: start + 1}
+	}
+	us := &memoryUnitStore{data: &graph.Output{
+		Defs: []*graph.Def{
+			def("a/b/Client", "Client", true),
+			def("client", "client", false),
+			def("ClientOpt", "ClientOpt", true),
+			def("Clients", "Clients", true),
+			def("Server", "Server", true),
+		},
+		Refs: []*graph.Ref{ref("ClientOpt", 200)},
+	}}
+	for i := 0; i < 100; i++ {
+		us.data.Refs = append(us.data.Refs, ref("Clients", uint32(i)))
+	}
+
+	results, err := SearchDefs(us, "Client", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, r := range results {
+		paths = append(paths, r.Def.Path)
+	}
+	// Clients: 2 (prefix) + 1 (exported) + ~2 (100 refs) = ~5.00
+	// a/b/Client: 4 (exact) + 1 (exported) - 0.5 (depth 2) = 4.5
+	// ClientOpt: 2 (prefix) + 1 (exported) + ~0.3 (1 ref) = ~3.30
+	// client: 3 (case-insensitive) = 3
+	want := []string{"Clients", "a/b/Client", "ClientOpt", "client"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("got ranking %v, want %v", paths, want)
+	}
+	if results[0].Refs != 100 {
+		t.Errorf("got %d refs to %s, want 100", results[0].Refs, results[0].Def.Path)
+	}
+}
+
+func TestSearchDefs_refCount(t *testing.T) {
+	// Downsampled defs have ref counts instead of refs.
+	us := &memoryUnitStore{data: &graph.Output{
+		Defs: []*graph.Def{
+			{DefKey: graph.DefKey{Path: "Client"}, Name: "Client"},
+			{DefKey: graph.DefKey{Path: "Clients"}, Name: "Clients", RefCount: 1000},
+		},
+	}}
+	results, err := SearchDefs(us, "Client", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Clients: 2 (prefix) + 3 (1000 refs) = ~5; Client: 4 (exact).
+	if results[0].Def.Path != "Clients" || results[0].Refs != 1000 {
+		t.Errorf("got first result %s with %d refs, want Clients with 1000", results[0].Def.Path, results[0].Refs)
+	}
+}
+
+func TestSearchDefs_scorer(t *testing.T) {
+	us := &memoryUnitStore{data: &graph.Output{
+		Defs: []*graph.Def{
+			{DefKey: graph.DefKey{Path: "Aa"}, Name: "Aa"},
+			{DefKey: graph.DefKey{Path: "Aaa"}, Name: "Aaa"},
+			{DefKey: graph.DefKey{Path: "Ab"}, Name: "Ab"},
+		},
+	}}
+	byLength := DefScorerFunc(func(query string, def *graph.Def, refs int) float64 {
+		return float64(len(def.Name))
+	})
+	results, err := SearchDefs(us, "A", byLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, r := range results {
+		paths = append(paths, r.Def.Path)
+	}
+	if want := []string{"Aaa", "Aa", "Ab"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("got ranking %v, want %v", paths, want)
+	}
+}
@@ -1,6 +1,10 @@
 package store
 
 import (
+	"sync"
+
+	"github.com/neelance/parallel"
+
 	"sourcegraph.com/sourcegraph/srclib/graph"
 	"sourcegraph.com/sourcegraph/srclib/unit"
 )
@@ -43,7 +47,9 @@ type TreeIndexer interface {
 
 // A treeStores is a TreeStore whose methods call the
 // corresponding method on each of the tree stores returned by the
-// treeStores func.
+// treeStores func. The tree stores of multiple commits (as selected
+// by ByCommitIDs) are queried concurrently, and each result's
+// CommitID is set to the commit that it came from.
 type treeStores struct {
 	opener treeStoreOpener
 }
@@ -56,22 +62,35 @@ func (s treeStores) Units(f ...UnitFilter) ([]*unit.SourceUnit, error) {
 		return nil, err
 	}
 
-	var allUnits []*unit.SourceUnit
-	for commitID, ts := range tss {
+	var (
+		allUnits   []*unit.SourceUnit
+		allUnitsMu sync.Mutex
+	)
+	par := parallel.NewRun(storeFetchPar)
+	for commitID_, ts_ := range tss {
+		commitID, ts := commitID_, ts_
 		if ts == nil {
 			continue
 		}
 
-		units, err := ts.Units(f...)
-		if err != nil && !isStoreNotExist(err) {
-			return nil, err
-		}
-		for _, unit := range units {
-			unit.CommitID = commitID
-		}
-		allUnits = append(allUnits, units...)
+		par.Acquire()
+		go func() {
+			defer par.Release()
+			units, err := ts.Units(f...)
+			if err != nil && !isStoreNotExist(err) {
+				par.Error(err)
+				return
+			}
+			for _, unit := range units {
+				unit.CommitID = commitID
+			}
+			allUnitsMu.Lock()
+			allUnits = append(allUnits, units...)
+			allUnitsMu.Unlock()
+		}()
 	}
-	return allUnits, nil
+	err = par.Wait()
+	return allUnits, err
 }
 
 func (s treeStores) Defs(f ...DefFilter) ([]*graph.Def, error) {
@@ -80,22 +99,35 @@ func (s treeStores) Defs(f ...DefFilter) ([]*graph.Def, error) {
 		return nil, err
 	}
 
-	var allDefs []*graph.Def
-	for commitID, ts := range tss {
+	var (
+		allDefs   []*graph.Def
+		allDefsMu sync.Mutex
+	)
+	par := parallel.NewRun(storeFetchPar)
+	for commitID_, ts_ := range tss {
+		commitID, ts := commitID_, ts_
 		if ts == nil {
 			continue
 		}
 
-		defs, err := ts.Defs(f...)
-		if err != nil && !isStoreNotExist(err) {
-			return nil, err
-		}
-		for _, def := range defs {
-			def.CommitID = commitID
-		}
-		allDefs = append(allDefs, defs...)
+		par.Acquire()
+		go func() {
+			defer par.Release()
+			defs, err := ts.Defs(f...)
+			if err != nil && !isStoreNotExist(err) {
+				par.Error(err)
+				return
+			}
+			for _, def := range defs {
+				def.CommitID = commitID
+			}
+			allDefsMu.Lock()
+			allDefs = append(allDefs, defs...)
+			allDefsMu.Unlock()
+		}()
 	}
-	return allDefs, nil
+	err = par.Wait()
+	return allDefs, err
 }
 
 func (s treeStores) Refs(f ...RefFilter) ([]*graph.Ref, error) {
@@ -104,21 +136,33 @@ func (s treeStores) Refs(f ...RefFilter) ([]*graph.Ref, error) {
 		return nil, err
 	}
 
-	var allRefs []*graph.Ref
-	for commitID, ts := range tss {
+	var (
+		allRefs   []*graph.Ref
+		allRefsMu sync.Mutex
+	)
+	par := parallel.NewRun(storeFetchPar)
+	for commitID_, ts_ := range tss {
+		commitID, ts := commitID_, ts_
 		if ts == nil {
 			continue
 		}
 
-		setImpliedCommitID(f, commitID)
-		refs, err := ts.Refs(f...)
-		if err != nil && !isStoreNotExist(err) {
-			return nil, err
-		}
-		for _, ref := range refs {
-			ref.CommitID = commitID
-		}
-		allRefs = append(allRefs, refs...)
+		par.Acquire()
+		go func() {
+			defer par.Release()
+			refs, err := ts.Refs(withImpliedCommitID(f, commitID)...)
+			if err != nil && !isStoreNotExist(err) {
+				par.Error(err)
+				return
+			}
+			for _, ref := range refs {
+				ref.CommitID = commitID
+			}
+			allRefsMu.Lock()
+			allRefs = append(allRefs, refs...)
+			allRefsMu.Unlock()
+		}()
 	}
-	return allRefs, nil
+	err = par.Wait()
+	return allRefs, err
 }
@@ -1,19 +1,18 @@
 package toolchain
 
-import (
-	"fmt"
-
-	"sourcegraph.com/sourcegraph/srclib"
-)
+import "sourcegraph.com/sourcegraph/srclib"
 
 // ChooseTool determines which toolchain and tool to use to run op (graph,
 // depresolve, etc.) on a source unit of the given type. If no tools fit the
 // criteria, an error is returned.
 //
-// The selection algorithm is currently very simplistic: if exactly one tool is
-// found that can perform op on the source unit type, it is returned. If zero or
-// more than 1 are found, then an error is returned. TODO(sqs): extend this to
-// choose the "best" tool when multiple tools would suffice.
+// If exactly one tool is found that can perform op on the source unit type, it
+// is returned. If none are found, nil is returned. If more than one are found
+// (in different toolchains), the toolchains' scanners are asked to score a
+// sample of the files of the source units of the type (if SetSampleFiles was
+// called), and the tool of the toolchain with the highest score is returned;
+// if there is no such toolchain, an error is returned. (See ToolChoices for
+// the choices that were made.)
 var ChooseTool = func(op, unitType string) (*srclib.ToolRef, error) {
 	tcs, err := List()
 	if err != nil {
@@ -44,7 +43,7 @@ func chooseTool(op, unitType string, tcs []*Info) (*srclib.ToolRef, error) {
 	}
 
 	if n := len(satisfying); n > 1 {
-		return nil, fmt.Errorf("%d tools satisfy op %q for source unit type %q (refusing to choose between multiple possibilities)", n, op, unitType)
+		return breakTie(op, unitType, satisfying, tcs)
 	} else if n == 0 {
 		return nil, nil
 	}
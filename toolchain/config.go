@@ -1,5 +1,7 @@
 package toolchain
 
+import "sourcegraph.com/sourcegraph/srclib/graph"
+
 // ConfigFilename is the filename of the toolchain configuration file. The
 // presence of this file in a directory signifies that a srclib toolchain is
 // defined in that directory.
@@ -10,6 +12,33 @@ type Config struct {
 	// Tools is the list of this toolchain's tools and their definitions.
 	Tools []*ToolInfo
 
+	// Version, if set, identifies the version of the toolchain (e.g., a
+	// release number or the commit ID of its repository). Build data
+	// is rebuilt when it changes. If it is not set, the version is
+	// derived from the contents of the toolchain's program (see
+	// (*Info).Version).
+	Version string `json:",omitempty"`
+
+	// Env declares the environment variables that this toolchain's
+	// tools use. If it is set, the tools are run with only those
+	// variables from srclib's environment (see Env.Filter); otherwise,
+	// they inherit the whole environment.
+	Env *Env `json:",omitempty"`
+
+	// DefData declares the schemas of the Def.Data of the defs that
+	// this toolchain's graphers emit, which srclib validates (and,
+	// optionally, normalizes) when it imports them (see
+	// graph.DefDataSchema).
+	DefData []*graph.DefDataSchema `json:",omitempty"`
+
+	// Offsets is the unit of the def, ref, and doc offsets in the
+	// output of this toolchain's graphers: "bytes" or "runes" (Unicode
+	// code points). srclib stores byte offsets, so rune offsets are
+	// converted. If Offsets is empty (or "auto"), the unit is detected
+	// for each file that contains non-ASCII characters (see
+	// grapher.OffsetUnit).
+	Offsets string `json:",omitempty"`
+
 	// Bundle configures the way that this toolchain is built and
 	// archived. If Bundle is not set, it means that the toolchain
 	// can't be bundled.
@@ -0,0 +1,31 @@
+package toolchain
+
+import (
+	"fmt"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// DefDataRegistry returns a registry of the Def.Data schemas that
+// the available toolchains (returned by List) declare (see
+// Config.DefData).
+func DefDataRegistry() (*graph.DefDataRegistry, error) {
+	tcs, err := List()
+	if err != nil {
+		return nil, err
+	}
+	var schemas []*graph.DefDataSchema
+	for _, tc := range tcs {
+		c, err := tc.ReadConfig()
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range c.DefData {
+			if err := s.Validate(); err != nil {
+				return nil, fmt.Errorf("toolchain %s: %s", tc.Path, err)
+			}
+		}
+		schemas = append(schemas, c.DefData...)
+	}
+	return graph.NewDefDataRegistry(schemas)
+}
@@ -0,0 +1,111 @@
+package toolchain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Env declares the environment variables that a toolchain's tools
+// use. If a toolchain declares them (in its Srclibtoolchain file), its
+// tools are run with only those variables (and the ones in BaseEnv)
+// from srclib's environment, plus the extra variables set for the
+// source unit (see (*unit.SourceUnit).Env), instead of the whole
+// environment.
+type Env struct {
+	// Required lists the variables that must be set for the tools to
+	// run. A tool isn't run if any of them is unset.
+	Required []string `json:",omitempty"`
+
+	// Allowed lists the other variables that are passed to the tools
+	// if they are set. An entry ending in "*" matches all variables
+	// with the preceding prefix (e.g., "JAVA_*").
+	Allowed []string `json:",omitempty"`
+}
+
+// BaseEnv lists the variables (in the form of Env.Allowed) that are
+// passed to the tools of all toolchains that declare their
+// environment variables, because most programs need them to run (or
+// because they configure srclib itself).
+var BaseEnv = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TERM", "TZ", "LANG", "LC_*",
+	"TMPDIR", "TMP", "TEMP",
+	"SYSTEMROOT", "USERPROFILE", "HOMEDRIVE", "HOMEPATH", "APPDATA", "LOCALAPPDATA",
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy",
+	"DOCKER_*",
+	"SRCLIB*",
+}
+
+// Filter returns the variables in environ (as "NAME=value" pairs, as
+// returned by os.Environ) that e requires or allows (or that BaseEnv
+// allows), followed by extra. It returns an error if a required
+// variable is set in neither environ nor extra.
+func (e *Env) Filter(environ, extra []string) ([]string, error) {
+	set := map[string]bool{}
+	var env []string
+	for _, kv := range environ {
+		name := envName(kv)
+		if matchEnv(e.Required, name) || matchEnv(e.Allowed, name) || matchEnv(BaseEnv, name) {
+			env = append(env, kv)
+			set[name] = true
+		}
+	}
+	for _, kv := range extra {
+		set[envName(kv)] = true
+	}
+	for _, name := range e.Required {
+		if !set[name] {
+			return nil, fmt.Errorf("required environment variable %s is not set", name)
+		}
+	}
+	return append(env, extra...), nil
+}
+
+func envName(kv string) string {
+	if i := strings.Index(kv, "="); i >= 0 {
+		return kv[:i]
+	}
+	return kv
+}
+
+// matchEnv reports whether the variable name matches any of patterns
+// (see Env.Allowed).
+func matchEnv(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(name, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+		} else if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ToolEnv returns the environment to run the tools of the toolchain
+// with the given path with, given srclib's environment environ and
+// the extra variables to set: if the toolchain declares its
+// environment variables, the filtered environment (see Env.Filter);
+// otherwise, environ followed by extra, or nil (meaning the tools
+// inherit srclib's environment) if there are no extra variables.
+func ToolEnv(toolchainPath string, environ, extra []string) ([]string, error) {
+	tc, err := Lookup(toolchainPath)
+	if err != nil {
+		return nil, err
+	}
+	c, err := tc.ReadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if c.Env == nil {
+		if len(extra) == 0 {
+			return nil, nil
+		}
+		return append(environ, extra...), nil
+	}
+	env, err := c.Env.Filter(environ, extra)
+	if err != nil {
+		return nil, fmt.Errorf("toolchain %s: %s", toolchainPath, err)
+	}
+	return env, nil
+}
@@ -0,0 +1,28 @@
+package toolchain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnvFilter(t *testing.T) {
+	environ := []string{"PATH=/bin", "JAVA_HOME=/jdk", "JAVA_OPTS=-Xmx1g", "AWS_SECRET_ACCESS_KEY=s", "MAVEN_REPO=r", "SRCLIBPATH=/s", "LC_ALL=C"}
+	e := &Env{Required: []string{"JAVA_HOME"}, Allowed: []string{"JAVA_*", "GRADLE_HOME"}}
+
+	got, err := e.Filter(environ, []string{"MAVEN_REPO=unit"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"PATH=/bin", "JAVA_HOME=/jdk", "JAVA_OPTS=-Xmx1g", "SRCLIBPATH=/s", "LC_ALL=C", "MAVEN_REPO=unit"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Required variables may be set by the extra variables.
+	if _, err := e.Filter([]string{"PATH=/bin"}, []string{"JAVA_HOME=/jdk"}); err != nil {
+		t.Error(err)
+	}
+	if _, err := e.Filter([]string{"PATH=/bin"}, nil); err == nil {
+		t.Error("got no error for missing required variable")
+	}
+}
@@ -0,0 +1,96 @@
+package toolchain
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ErrorsFileEnv is the environment variable that names the file to
+// which a tool may write structured descriptions of the errors that
+// it encountered (see ToolError), so that srclib can report why the
+// tool failed more precisely than by its exit code and stderr. The
+// file holds one JSON-encoded ToolError per line; it is empty (or
+// missing) if the tool reported no errors.
+//
+// It is only set when the tool run is logged (see "srclib tool
+// --log"), and the errors are recorded in the tool's log.
+const ErrorsFileEnv = "SRCLIB_ERRORS_FILE"
+
+// A ToolError is an error that a tool reported in the errors file
+// (see ErrorsFileEnv).
+type ToolError struct {
+	// Code is a short, machine-readable identifier of the kind of
+	// error (e.g., "missing-dependency"), defined by the toolchain.
+	Code string `json:",omitempty"`
+
+	// Message describes the error (e.g., "missing dependency
+	// com.foo:bar:1.2").
+	Message string
+
+	// File, Line, and Column are the position (relative to the
+	// repository root, with 1-based line and column numbers) that
+	// the error is about, if any.
+	File   string `json:",omitempty"`
+	Line   int    `json:",omitempty"`
+	Column int    `json:",omitempty"`
+
+	// Recoverable is whether the tool was able to continue after the
+	// error (e.g., by skipping a file), so that its output is usable
+	// but incomplete.
+	Recoverable bool `json:",omitempty"`
+}
+
+func (e *ToolError) Error() string {
+	msg := e.Message
+	if e.Code != "" {
+		msg = e.Code + ": " + msg
+	}
+	if pos := e.Position(); pos != "" {
+		msg += " at " + pos
+	}
+	return msg
+}
+
+// Position returns the error's position as "file:line:column"
+// (omitting the parts that are unknown), or "" if it has no file.
+func (e *ToolError) Position() string {
+	if e.File == "" {
+		return ""
+	}
+	pos := e.File
+	if e.Line > 0 {
+		pos += fmt.Sprintf(":%d", e.Line)
+		if e.Column > 0 {
+			pos += fmt.Sprintf(":%d", e.Column)
+		}
+	}
+	return pos
+}
+
+// ReadErrors reads the errors written by a tool to the errors file
+// (see ErrorsFileEnv). Blank lines are ignored. A line that isn't a
+// valid ToolError (such as one that the tool was killed while
+// writing) is an error.
+func ReadErrors(r io.Reader) ([]*ToolError, error) {
+	var errs []*ToolError
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for n := 1; s.Scan(); n++ {
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var e ToolError
+		if err := json.Unmarshal(line, &e); err != nil {
+			return errs, fmt.Errorf("errors file line %d: %s", n, err)
+		}
+		if e.Message == "" && e.Code == "" {
+			return errs, fmt.Errorf("errors file line %d: error has no message or code", n)
+		}
+		errs = append(errs, &e)
+	}
+	return errs, s.Err()
+}
@@ -0,0 +1,39 @@
+package toolchain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadErrors(t *testing.T) {
+	input := `{"Code": "missing-dependency", "Message": "missing dependency com.foo:bar:1.2", "File": "pom.xml", "Line": 47}
+
+{"Message": "couldn't parse file", "File": "a.java", "Line": 3, "Column": 9, "Recoverable": true}
+`
+	errs, err := ReadErrors(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"missing-dependency: missing dependency com.foo:bar:1.2 at pom.xml:47",
+		"couldn't parse file at a.java:3:9",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors, want %d", len(errs), len(want))
+	}
+	for i, e := range errs {
+		if got := e.Error(); got != want[i] {
+			t.Errorf("error %d: got %q, want %q", i, got, want[i])
+		}
+	}
+	if errs[0].Recoverable || !errs[1].Recoverable {
+		t.Errorf("got recoverable %v and %v, want false and true", errs[0].Recoverable, errs[1].Recoverable)
+	}
+
+	if _, err := ReadErrors(strings.NewReader(`{"Message": "a"}` + "\n" + `{"Mess`)); err == nil {
+		t.Error("got no error for truncated line")
+	}
+	if _, err := ReadErrors(strings.NewReader(`{"File": "a"}`)); err == nil {
+		t.Error("got no error for error without message")
+	}
+}
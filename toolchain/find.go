@@ -34,21 +34,24 @@ func Lookup(path string) (*Info, error) {
 	return newInfo(path, dir, ConfigFilename)
 }
 
+// lookupToolchain returns the directory of the toolchain in the
+// earliest SRCLIBPATH entry that contains it.
 func lookupToolchain(toolchainPath string) (string, error) {
-	matches, err := lookInPaths(filepath.Join(toolchainPath, ConfigFilename), srclib.Path)
-	if err != nil {
-		return "", err
-	}
-	if len(matches) > 1 {
-		return "", fmt.Errorf("shadowed toolchain path %q (toolchains: %v)", toolchainPath, matches)
-	}
-	if len(matches) == 0 {
-		return "", &os.PathError{Op: "lookupToolchain", Path: toolchainPath, Err: os.ErrNotExist}
+	for _, dir := range filepath.SplitList(srclib.Path) {
+		matches, err := lookInPaths(filepath.Join(toolchainPath, ConfigFilename), dir)
+		if err != nil {
+			return "", err
+		}
+		if len(matches) > 0 {
+			return filepath.Dir(matches[0]), nil
+		}
 	}
-	return filepath.Dir(matches[0]), nil
+	return "", &os.PathError{Op: "lookupToolchain", Path: toolchainPath, Err: os.ErrNotExist}
 }
 
-// List finds all toolchains in the SRCLIBPATH.
+// List finds all toolchains in the SRCLIBPATH. If a toolchain is in
+// more than one SRCLIBPATH entry, only the one in the earliest entry
+// (which Lookup finds) is listed.
 //
 // List does not find nested toolchains; i.e., if DIR is a toolchain
 // dir (with a DIR/Srclibtoolchain file), then none of DIR's
@@ -71,7 +74,7 @@ func List() ([]*Info, error) {
 		for w.Step() {
 			if err := w.Err(); err != nil {
 				if w.Path() == dir && os.IsNotExist(err) {
-					return nil, nil
+					break // skip nonexistent SRCLIBPATH entries
 				}
 				return nil, w.Err()
 			}
@@ -127,8 +130,10 @@ func List() ([]*Info, error) {
 				}
 				toolchainPath = filepath.ToSlash(toolchainPath)
 
-				if otherDir, seen := seen[toolchainPath]; seen {
-					return nil, fmt.Errorf("saw 2 toolchains at path %s in dirs %s and %s", toolchainPath, otherDir, path)
+				if _, seen := seen[toolchainPath]; seen {
+					// Shadowed by a toolchain in an earlier SRCLIBPATH entry.
+					w.SkipDir()
+					continue
 				}
 				seen[toolchainPath] = path
 
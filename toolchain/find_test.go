@@ -81,3 +81,49 @@ func toolchainPathsWithProgram(toolchains []*Info) []string {
 	}
 	return paths
 }
+
+func TestLookup_precedence(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "srclib-toolchain-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	defer func(orig string) {
+		srclib.Path = orig
+	}(srclib.Path)
+	project, global := filepath.Join(tmpdir, "project"), filepath.Join(tmpdir, "global")
+	srclib.Path = project + string(filepath.ListSeparator) + global
+
+	for _, dir := range []string{project, global} {
+		files := map[string]os.FileMode{
+			filepath.Join("a", ".bin", "a"):       0700,
+			filepath.Join("a", "Srclibtoolchain"): 0600,
+		}
+		for f, mode := range files {
+			f = filepath.Join(dir, f)
+			if err := os.MkdirAll(filepath.Dir(f), 0700); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(f, nil, mode); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tc, err := Lookup("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(project, "a"); tc.Dir != want {
+		t.Errorf("got toolchain dir %q, want %q (the earliest SRCLIBPATH entry)", tc.Dir, want)
+	}
+
+	toolchains, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toolchains) != 1 || toolchains[0].Dir != filepath.Join(project, "a") {
+		t.Errorf("got toolchains %+v, want only the one in the earliest SRCLIBPATH entry", toolchains)
+	}
+}
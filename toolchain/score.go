@@ -0,0 +1,260 @@
+package toolchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"sourcegraph.com/sourcegraph/srclib"
+)
+
+// ScoreFlag is the flag that a scanner that declares that it scores
+// files (see ToolInfo.Scores) is run with to score them instead of
+// scanning. The scanner reads a JSON array of file paths (relative to
+// the repository root, which is its working directory) from stdin and
+// writes a ToolchainScore (of which only Confidence is read) to stdout.
+const ScoreFlag = "--score"
+
+// MaxScoreSample is the maximum number of files that scanners are
+// asked to score.
+const MaxScoreSample = 50
+
+// A ToolchainScore is a scanner's confidence that its toolchain is
+// the right one to analyze a sample of files.
+type ToolchainScore struct {
+	Toolchain string `json:",omitempty"`
+
+	// Confidence is from 0 (the files aren't for the toolchain) to 1
+	// (they certainly are).
+	Confidence float64
+
+	// Error is why the files couldn't be scored (in which case
+	// Confidence is 0), if they couldn't.
+	Error string `json:",omitempty"`
+}
+
+// A ToolChoice records how ChooseTool chose which of multiple
+// toolchains to use for source units of a type, when each of them has
+// a tool that can perform the op on units of the type.
+type ToolChoice struct {
+	UnitType string
+
+	// Ops are the ops that the choice was made for (e.g., "graph"
+	// and "depresolve").
+	Ops []string
+
+	// Files are the sampled files that the toolchains' scanners
+	// scored.
+	Files []string
+
+	// Scores are the toolchains' scores, highest first.
+	Scores []*ToolchainScore
+
+	// Toolchain is the chosen toolchain, or empty if none scored
+	// higher than all of the others.
+	Toolchain string `json:",omitempty"`
+}
+
+var (
+	sampleFiles func(unitType string) []string
+
+	choicesMu sync.Mutex
+	choices   map[string]*ToolChoice // keyed by unit type and candidate toolchains
+)
+
+// SetSampleFiles sets the function that returns the files (of the
+// source units of a type in the tree that is being planned) that
+// ChooseTool samples for the toolchains' scanners to score. If it is
+// nil (the default), ChooseTool doesn't break ties. It forgets the
+// choices that were made for the previous tree.
+func SetSampleFiles(fn func(unitType string) []string) {
+	choicesMu.Lock()
+	defer choicesMu.Unlock()
+	sampleFiles = fn
+	choices = nil
+}
+
+// ToolChoices returns the choices that ChooseTool made by scoring
+// files since SetSampleFiles was last called, sorted by unit type.
+func ToolChoices() []*ToolChoice {
+	choicesMu.Lock()
+	defer choicesMu.Unlock()
+	cs := make([]*ToolChoice, 0, len(choices))
+	for _, c := range choices {
+		cs = append(cs, c)
+	}
+	sort.Sort(toolChoicesByUnitType(cs))
+	return cs
+}
+
+// LookupToolChoice returns the choice that ChooseTool made by scoring
+// files for source units of the given type, or nil if it made none.
+func LookupToolChoice(unitType string) *ToolChoice {
+	for _, c := range ToolChoices() {
+		if c.UnitType == unitType {
+			return c
+		}
+	}
+	return nil
+}
+
+// breakTie chooses among tools (from different toolchains), which can
+// all perform op on source units of the given type, by asking each
+// toolchain's scanner to score a sample of the units' files (see
+// ScoreFlag) and choosing the toolchain with the highest score. The
+// choice is made once for each unit type (for all ops) and recorded
+// (see ToolChoices).
+func breakTie(op, unitType string, tools []*srclib.ToolRef, tcs []*Info) (*srclib.ToolRef, error) {
+	tie := fmt.Errorf("%d tools satisfy op %q for source unit type %q (refusing to choose between multiple possibilities)", len(tools), op, unitType)
+
+	choicesMu.Lock()
+	defer choicesMu.Unlock()
+	if sampleFiles == nil {
+		return nil, tie
+	}
+
+	paths := make([]string, len(tools))
+	for i, t := range tools {
+		paths[i] = t.Toolchain
+	}
+	sort.Strings(paths)
+	key := unitType + "\x00" + strings.Join(paths, "\x00")
+	c, present := choices[key]
+	if !present {
+		c = &ToolChoice{UnitType: unitType, Files: sample(sampleFiles(unitType), MaxScoreSample)}
+		for _, path := range paths {
+			c.Scores = append(c.Scores, scoreFiles(path, tcs, c.Files))
+		}
+		sort.Stable(toolchainScoresByConfidence(c.Scores))
+		if len(c.Scores) > 0 && c.Scores[0].Confidence > 0 && (len(c.Scores) == 1 || c.Scores[0].Confidence > c.Scores[1].Confidence) {
+			c.Toolchain = c.Scores[0].Toolchain
+		}
+		if choices == nil {
+			choices = map[string]*ToolChoice{}
+		}
+		choices[key] = c
+	}
+	c.Ops = addOp(c.Ops, op)
+
+	if c.Toolchain == "" {
+		return nil, fmt.Errorf("%s, and their toolchains' scanners' confidence scores of %d sampled files don't break the tie", tie, len(c.Files))
+	}
+	for _, t := range tools {
+		if t.Toolchain == c.Toolchain {
+			return t, nil
+		}
+	}
+	panic("unreachable")
+}
+
+func addOp(ops []string, op string) []string {
+	for _, o := range ops {
+		if o == op {
+			return ops
+		}
+	}
+	ops = append(ops, op)
+	sort.Strings(ops)
+	return ops
+}
+
+// sample returns at most n of files, evenly spaced in sorted order (so
+// that the sample is the same each time for the same files).
+func sample(files []string, n int) []string {
+	files = append([]string(nil), files...)
+	sort.Strings(files)
+	if len(files) <= n {
+		return files
+	}
+	s := make([]string, n)
+	for i := range s {
+		s[i] = files[i*len(files)/n]
+	}
+	return s
+}
+
+// scoreFiles runs the scanner of the toolchain with the given path (in
+// tcs) to score files. If the toolchain's scanner doesn't score files
+// or fails, the returned score's Error says why.
+func scoreFiles(toolchainPath string, tcs []*Info, files []string) *ToolchainScore {
+	score := &ToolchainScore{Toolchain: toolchainPath}
+	if err := runScorer(toolchainPath, tcs, files, score); err != nil {
+		score.Confidence = 0
+		score.Error = err.Error()
+	}
+	return score
+}
+
+func runScorer(toolchainPath string, tcs []*Info, files []string, score *ToolchainScore) error {
+	var tc *Info
+	for _, tc2 := range tcs {
+		if tc2.Path == toolchainPath {
+			tc = tc2
+		}
+	}
+	if tc == nil {
+		return fmt.Errorf("toolchain %s not found", toolchainPath)
+	}
+	cfg, err := tc.ReadConfig()
+	if err != nil {
+		return err
+	}
+	var scanner *ToolInfo
+	for _, tool := range cfg.Tools {
+		if tool.Op == "scan" && tool.Scores {
+			scanner = tool
+			break
+		}
+	}
+	if scanner == nil {
+		return fmt.Errorf("toolchain has no scanner that scores files")
+	}
+	if tc.Program == "" {
+		return fmt.Errorf("toolchain has no program")
+	}
+
+	input, err := json.Marshal(files)
+	if err != nil {
+		return err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(filepath.Join(tc.Dir, tc.Program), scanner.Subcmd, ScoreFlag)
+	if cfg.Env != nil {
+		if cmd.Env, err = cfg.Env.Filter(os.Environ(), nil); err != nil {
+			return err
+		}
+	}
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("scanner %s failed: %s: %s", scanner.Subcmd, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	var out ToolchainScore
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return fmt.Errorf("parsing the score of scanner %s failed with: %s", scanner.Subcmd, err)
+	}
+	if !(out.Confidence >= 0 && out.Confidence <= 1) {
+		return fmt.Errorf("scanner %s returned confidence %v (expected a value from 0 to 1)", scanner.Subcmd, out.Confidence)
+	}
+	score.Confidence = out.Confidence
+	return nil
+}
+
+type toolchainScoresByConfidence []*ToolchainScore
+
+func (v toolchainScoresByConfidence) Len() int           { return len(v) }
+func (v toolchainScoresByConfidence) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v toolchainScoresByConfidence) Less(i, j int) bool { return v[i].Confidence > v[j].Confidence }
+
+type toolChoicesByUnitType []*ToolChoice
+
+func (v toolChoicesByUnitType) Len() int           { return len(v) }
+func (v toolChoicesByUnitType) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v toolChoicesByUnitType) Less(i, j int) bool { return v[i].UnitType < v[j].UnitType }
@@ -0,0 +1,106 @@
+package toolchain
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestChooseTool_breakTie(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test toolchain programs are shell scripts")
+	}
+	tmpdir, err := ioutil.TempDir("", "srclib-toolchain-score")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// newToolchain creates a toolchain with a graph tool for units of
+	// type "T" and a scanner that scores files with the given output
+	// (or that doesn't score files, if output is empty).
+	newToolchain := func(path, output string) *Info {
+		dir := filepath.Join(tmpdir, path)
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		cfg := Config{Tools: []*ToolInfo{
+			{Subcmd: "scan", Op: "scan", Scores: output != ""},
+			{Subcmd: "graph", Op: "graph", SourceUnitTypes: []string{"T"}},
+		}}
+		data, err := json.Marshal(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, ConfigFilename), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		script := "#!/bin/sh\ntest \"$1 $2\" = \"scan --score\" || exit 1\ncat > /dev/null\necho '" + output + "'\n"
+		if err := ioutil.WriteFile(filepath.Join(dir, "prog"), []byte(script), 0700); err != nil {
+			t.Fatal(err)
+		}
+		return &Info{Path: path, Dir: dir, ConfigFile: ConfigFilename, Program: "prog"}
+	}
+	a := newToolchain("a", `{"Confidence": 0.2}`)
+	b := newToolchain("b", `{"Confidence": 0.9}`)
+	c := newToolchain("c", "")
+	d := newToolchain("d", `{"Confidence": 0.9}`)
+
+	defer SetSampleFiles(nil)
+	if _, err := chooseTool("graph", "T", []*Info{a, b}); err == nil {
+		t.Error("got no error without sample files, want an error")
+	}
+
+	var sampled string
+	SetSampleFiles(func(unitType string) []string {
+		sampled = unitType
+		return []string{"x.t", "y.t"}
+	})
+	tool, err := chooseTool("graph", "T", []*Info{a, b, c})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tool.Toolchain != "b" || tool.Subcmd != "graph" {
+		t.Errorf("got tool %+v, want b's graph tool", tool)
+	}
+	if sampled != "T" {
+		t.Errorf("sampled files of unit type %q, want T", sampled)
+	}
+	choice := LookupToolChoice("T")
+	if choice == nil {
+		t.Fatal("no choice recorded")
+	}
+	if choice.Toolchain != "b" || !reflect.DeepEqual(choice.Ops, []string{"graph"}) || !reflect.DeepEqual(choice.Files, []string{"x.t", "y.t"}) {
+		t.Errorf("got choice %+v", choice)
+	}
+	var order []string
+	for _, s := range choice.Scores {
+		order = append(order, s.Toolchain)
+	}
+	if want := []string{"b", "a", "c"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("got scores in order %v, want %v", order, want)
+	}
+	if choice.Scores[2].Error == "" {
+		t.Error("got no error for a toolchain whose scanner doesn't score files")
+	}
+
+	// Toolchains with equal scores are still a tie.
+	SetSampleFiles(func(string) []string { return nil })
+	if _, err := chooseTool("graph", "T", []*Info{b, d}); err == nil {
+		t.Error("got no error for equal scores, want an error")
+	}
+}
+
+func TestSample(t *testing.T) {
+	files := []string{"e", "d", "c", "b", "a", "f"}
+	if got, want := sample(files, 3), []string{"a", "c", "e"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := sample(files[:2], 3), []string{"d", "e"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -25,6 +25,40 @@ type ToolInfo struct {
 	// TODO(sqs): determine how repository- or directory-level tools will be
 	// defined.
 	SourceUnitTypes []string `json:",omitempty"`
+
+	// Scores is whether this tool, a scanner, can score how likely it
+	// is that the toolchain is the right one to analyze a set of
+	// files (see ScoreFlag). When multiple toolchains can perform an
+	// op on the same source unit type, the one whose scanner gives
+	// the highest score is chosen (see ChooseTool).
+	Scores bool `json:",omitempty"`
+
+	// Memory is the amount of memory (in megabytes) that this tool
+	// typically needs at its peak. "srclib make --max-memory" uses it
+	// to decide how many tools to run at once, until it has learned
+	// the tool's actual usage on a source unit from a previous run.
+	// If it is 0, a default is assumed.
+	Memory int `json:",omitempty"`
+}
+
+// ToolMemory returns the memory (in megabytes) that the tool with the
+// given toolchain path and subcommand declares that it needs (see
+// ToolInfo.Memory), or 0 if it doesn't declare it.
+func ToolMemory(toolchainPath, subcmd string) (int, error) {
+	tc, err := Lookup(toolchainPath)
+	if err != nil {
+		return 0, err
+	}
+	c, err := tc.ReadConfig()
+	if err != nil {
+		return 0, err
+	}
+	for _, tool := range c.Tools {
+		if tool.Subcmd == subcmd {
+			return tool.Memory, nil
+		}
+	}
+	return 0, nil
 }
 
 // ListTools lists all tools in all available toolchains (returned by List). If
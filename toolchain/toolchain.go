@@ -1,9 +1,15 @@
 package toolchain
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"sourcegraph.com/sourcegraph/srclib"
 )
@@ -69,3 +75,77 @@ func Command(path string) (string, error) {
 	}
 	return filepath.Join(tc.Dir, tc.Program), nil
 }
+
+// Version returns a string that identifies the installed version of
+// the toolchain. If the toolchain's Srclibtoolchain file declares a
+// Version, it is a hash of that file. Otherwise, it is a hash of that
+// file and of the contents of the toolchain's program, so it changes
+// whenever the toolchain is updated or rebuilt, but not when its files
+// are only touched (e.g., by a fresh checkout).
+func (t *Info) Version() (string, error) {
+	h := sha1.New()
+	config, err := ioutil.ReadFile(filepath.Join(t.Dir, t.ConfigFile))
+	if err != nil {
+		return "", err
+	}
+	h.Write(config)
+	var declared struct{ Version string }
+	if json.Unmarshal(config, &declared) == nil && declared.Version != "" {
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	if t.Program != "" {
+		sum, err := programHash(filepath.Join(t.Dir, t.Program))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "\x00%s", sum)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// programHashes caches the results of programHash, keyed by the
+// program's file and the size and modification time that it had when
+// it was hashed.
+var (
+	programHashesMu sync.Mutex
+	programHashes   = map[programHashKey]string{}
+)
+
+type programHashKey struct {
+	file    string
+	size    int64
+	modTime int64
+}
+
+// programHash returns the hex SHA-1 hash of the contents of the
+// program file. Programs can be large, so the hash is computed only
+// once per process for each version (by size and modification time)
+// of the file.
+func programHash(file string) (string, error) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return "", err
+	}
+	key := programHashKey{file, fi.Size(), fi.ModTime().UnixNano()}
+	programHashesMu.Lock()
+	sum, cached := programHashes[key]
+	programHashesMu.Unlock()
+	if cached {
+		return sum, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum = hex.EncodeToString(h.Sum(nil))
+	programHashesMu.Lock()
+	programHashes[key] = sum
+	programHashesMu.Unlock()
+	return sum, nil
+}
@@ -0,0 +1,65 @@
+package toolchain
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInfo_Version(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-toolchain-version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tc := &Info{Path: "example.com/tc", Dir: dir, ConfigFile: "Srclibtoolchain", Program: ".bin/tc"}
+	write := func(name, data string) {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(data), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	version := func() string {
+		v, err := tc.Version()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	write("Srclibtoolchain", `{"Tools": []}`)
+	write(".bin/tc", "#!/bin/sh\necho 1\n")
+	v1 := version()
+
+	// Touching the program (e.g., by checking it out again) doesn't
+	// change the version.
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, ".bin", "tc"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if v := version(); v != v1 {
+		t.Errorf("got version %q after touching the program, want unchanged %q", v, v1)
+	}
+
+	write(".bin/tc", "#!/bin/sh\necho 2\n")
+	v2 := version()
+	if v2 == v1 {
+		t.Errorf("got unchanged version %q after changing the program", v2)
+	}
+
+	// A declared version takes precedence over the program's contents.
+	write("Srclibtoolchain", `{"Version": "1.0", "Tools": []}`)
+	v3 := version()
+	if v3 == v2 {
+		t.Errorf("got unchanged version %q after declaring a version", v3)
+	}
+	write(".bin/tc", "#!/bin/sh\necho 3\n")
+	if v := version(); v != v3 {
+		t.Errorf("got version %q after changing the program, want the declared version's %q", v, v3)
+	}
+}
@@ -0,0 +1,125 @@
+package toolchain
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/godoc/vfs"
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib"
+)
+
+// VersionsFilename is the name of the file, in a commit's build data
+// directory, that records the versions of the toolchains that produced
+// the build data (see WriteVersions).
+const VersionsFilename = "toolchains.json"
+
+// BuildVersions records the versions of the toolchains that produced a
+// commit's build data.
+type BuildVersions struct {
+	// Toolchains lists the toolchains that the build ran, sorted by
+	// path.
+	Toolchains []*VersionRecord
+
+	// Targets maps each build data file (relative to the commit's build
+	// data directory, with forward slashes) to the versions of the
+	// toolchains that produced it.
+	Targets map[string]TargetVersions `json:",omitempty"`
+}
+
+// TargetVersions maps the paths of the toolchains that produced a
+// build data file (the toolchain whose tool created it and those of
+// any post-processors) to their versions.
+type TargetVersions map[string]string
+
+// Equal reports whether v and w list the same toolchain versions.
+func (v TargetVersions) Equal(w TargetVersions) bool {
+	if len(v) != len(w) {
+		return false
+	}
+	for path, version := range v {
+		if wv, present := w[path]; !present || wv != version {
+			return false
+		}
+	}
+	return true
+}
+
+// A VersionRecord records the version of a toolchain that produced
+// build data.
+type VersionRecord struct {
+	// Path is the toolchain's path (e.g., "sourcegraph.com/sourcegraph/srclib-go").
+	Path string
+
+	// Version is the toolchain's version (see (*Info).Version).
+	Version string
+
+	// Dir is the directory that the toolchain was run from.
+	Dir string
+
+	// Project is whether the toolchain is one of the project's own
+	// toolchains (in the project toolchains directory; see
+	// srclib.ProjectToolchainsDir) instead of a globally installed one.
+	Project bool `json:",omitempty"`
+}
+
+// Versions returns records of the installed versions of the named
+// toolchains, sorted by path.
+func Versions(toolchainPaths []string) ([]*VersionRecord, error) {
+	sort.Strings(toolchainPaths)
+	recs := make([]*VersionRecord, 0, len(toolchainPaths))
+	for _, path := range toolchainPaths {
+		tc, err := Lookup(path)
+		if err != nil {
+			return nil, err
+		}
+		v, err := tc.Version()
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, &VersionRecord{
+			Path:    tc.Path,
+			Version: v,
+			Dir:     tc.Dir,
+			Project: strings.Contains(filepath.ToSlash(tc.Dir), "/"+filepath.ToSlash(srclib.ProjectToolchainsDir)+"/"),
+		})
+	}
+	return recs, nil
+}
+
+// WriteVersions records v as the versions of the toolchains that
+// produced the build data in bdfs, which should be a VFS obtained from
+// a call to (buildstore.RepoBuildStore).Commit.
+func WriteVersions(bdfs rwvfs.FileSystem, v *BuildVersions) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := bdfs.Create(VersionsFilename)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadVersions reads the versions of the toolchains that produced the
+// build data in bdfs (see WriteVersions). If none were recorded, it
+// returns an error satisfying os.IsNotExist.
+func ReadVersions(bdfs vfs.FileSystem) (*BuildVersions, error) {
+	f, err := bdfs.Open(VersionsFilename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var v BuildVersions
+	if err := json.NewDecoder(f).Decode(&v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
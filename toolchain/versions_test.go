@@ -0,0 +1,21 @@
+package toolchain
+
+import "testing"
+
+func TestTargetVersions_Equal(t *testing.T) {
+	tests := []struct {
+		v, w TargetVersions
+		want bool
+	}{
+		{TargetVersions{}, nil, true},
+		{TargetVersions{"a": "1"}, TargetVersions{"a": "1"}, true},
+		{TargetVersions{"a": "1"}, TargetVersions{"a": "2"}, false},
+		{TargetVersions{"a": "1"}, TargetVersions{"b": "1"}, false},
+		{TargetVersions{"a": "1"}, TargetVersions{"a": "1", "b": "1"}, false},
+	}
+	for _, test := range tests {
+		if got := test.v.Equal(test.w); got != test.want {
+			t.Errorf("%v.Equal(%v): got %v, want %v", test.v, test.w, got, test.want)
+		}
+	}
+}
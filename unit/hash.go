@@ -0,0 +1,80 @@
+package unit
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// contentHashVersion is written first into every content hash. It
+// must be incremented if the content hash algorithm changes.
+const contentHashVersion = "srclib-unit-content-v1"
+
+// ContentHash returns a hex-encoded SHA-1 hash of the source unit's
+// type and files, reading the files relative to repoDir (the
+// repository root). It identifies a unit by its contents rather than
+// by its name, so it is unchanged when the unit's directory is
+// renamed or moved but changes when any of its files are edited,
+// added, or removed.
+//
+// The hash is computed over the following, each followed by a NUL
+// byte: contentHashVersion, the unit type, and then, for each file in
+// lexical order of its path relative to the unit's Dir (slash
+// separated), that relative path and the hex SHA-1 of the file's
+// contents. Files that don't exist are hashed as if they were empty.
+func (u *SourceUnit) ContentHash(repoDir string) (string, error) {
+	return u.ContentHashRenamed(repoDir, nil)
+}
+
+// ContentHashRenamed is like ContentHash, but each of the unit's
+// files that is a key of origFiles is hashed as if it were still at
+// its original path, origFiles[file] (but with its current contents).
+// So, if the unit's files were only renamed (without being changed)
+// since the hash of the unit with the original files was computed,
+// the hashes are the same.
+func (u *SourceUnit) ContentHashRenamed(repoDir string, origFiles map[string]string) (string, error) {
+	paths := make(map[string]string, len(u.Files)) // relative path -> path
+	rels := make([]string, 0, len(u.Files))
+	for _, f := range u.Files {
+		name := f
+		if orig, renamed := origFiles[f]; renamed {
+			name = orig
+		}
+		rel, err := filepath.Rel(filepath.FromSlash(u.Dir), filepath.FromSlash(name))
+		if err != nil || strings.HasPrefix(rel, "..") {
+			rel = name
+		}
+		rel = filepath.ToSlash(rel)
+		if _, seen := paths[rel]; !seen {
+			rels = append(rels, rel)
+		}
+		paths[rel] = filepath.Join(repoDir, filepath.FromSlash(f))
+	}
+	sort.Strings(rels)
+
+	h := sha1.New()
+	fmt.Fprintf(h, "%s\x00%s\x00", contentHashVersion, u.Type)
+	for _, rel := range rels {
+		fh := sha1.New()
+		if err := hashFile(fh, paths[rel]); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00%x\x00", rel, fh.Sum(nil))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
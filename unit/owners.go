@@ -0,0 +1,24 @@
+package unit
+
+// TestTag is the tag of source units that consist of test code (see
+// config.Tree's TagTestUnit).
+const TestTag = "test"
+
+// HasOwner reports whether owner is one of u's Owners.
+func (u *SourceUnit) HasOwner(owner string) bool {
+	return containsString(u.Owners, owner)
+}
+
+// HasTag reports whether tag is one of u's Tags.
+func (u *SourceUnit) HasTag(tag string) bool {
+	return containsString(u.Tags, tag)
+}
+
+func containsString(ss []string, s string) bool {
+	for _, t := range ss {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,11 @@
 package unit
 
-import "testing"
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
 
 func TestParseID(t *testing.T) {
 	tests := []struct {
@@ -23,3 +28,82 @@ func TestParseID(t *testing.T) {
 		}
 	}
 }
+
+func TestID(t *testing.T) {
+	// These IDs are used in build data and user-facing commands, so
+	// they must not change.
+	tests := []struct {
+		unit SourceUnit
+		want ID
+	}{
+		{SourceUnit{Key: Key{Name: "a", Type: "b"}}, "a@b"},
+		{SourceUnit{Key: Key{Name: "github.com/foo/bar", Type: "GoPackage"}}, "github.com%2Ffoo%2Fbar@GoPackage"},
+		{SourceUnit{Key: Key{Name: "a b@c", Type: "t"}}, "a+b%40c@t"},
+	}
+	for _, test := range tests {
+		if id := test.unit.ID(); id != test.want {
+			t.Errorf("%+v: got ID %q, want %q", test.unit.Key, id, test.want)
+		}
+		name, typ, err := ParseID(string(test.unit.ID()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != test.unit.Name || typ != test.unit.Type {
+			t.Errorf("%q: got ParseID %q %q, want %q %q", test.want, name, typ, test.unit.Name, test.unit.Type)
+		}
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-unit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, f := range []string{"a/x.go", "a/y.go", "b/x.go", "b/y.go", "c/x.go"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(f)), 0700); err != nil {
+			t.Fatal(err)
+		}
+		data := "package " + filepath.Base(f)
+		if f == "c/x.go" {
+			data = "changed"
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, f), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hash := func(u *SourceUnit) string {
+		h, err := u.ContentHash(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	a := &SourceUnit{Key: Key{Name: "a", Type: "t"}, Info: Info{Dir: "a", Files: []string{"a/x.go", "a/y.go"}}}
+	renamed := &SourceUnit{Key: Key{Name: "b", Type: "t"}, Info: Info{Dir: "b", Files: []string{"b/y.go", "b/x.go"}}}
+	if hash(a) != hash(renamed) {
+		t.Errorf("got different content hashes for a unit and its renamed copy")
+	}
+	otherType := &SourceUnit{Key: Key{Name: "a", Type: "t2"}, Info: Info{Dir: "a", Files: a.Files}}
+	if hash(a) == hash(otherType) {
+		t.Errorf("got same content hash for units of different types")
+	}
+	edited := &SourceUnit{Key: Key{Name: "c", Type: "t"}, Info: Info{Dir: "c", Files: []string{"c/x.go"}}}
+	fewer := &SourceUnit{Key: Key{Name: "a", Type: "t"}, Info: Info{Dir: "a", Files: []string{"a/x.go"}}}
+	if hash(edited) == hash(fewer) {
+		t.Errorf("got same content hash for units with different file contents")
+	}
+
+	// b/y.go has the same contents as a/y.go, so a unit in which
+	// a/y.go was renamed to b/y.go has the same hash as a.
+	moved := &SourceUnit{Key: Key{Name: "a", Type: "t"}, Info: Info{Dir: "a", Files: []string{"a/x.go", "b/y.go"}}}
+	if h, err := moved.ContentHashRenamed(dir, map[string]string{"b/y.go": "a/y.go"}); err != nil {
+		t.Fatal(err)
+	} else if h != hash(a) {
+		t.Errorf("got different content hashes for a unit and the unit with a renamed file")
+	}
+	if hash(moved) == hash(a) {
+		t.Errorf("got same content hash for a unit and the unit with a renamed file, without renames")
+	}
+}
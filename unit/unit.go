@@ -47,6 +47,16 @@ const idSeparator = "@"
 
 // ID returns an opaque identifier for this source unit that is guaranteed to be
 // unique among all other source units in the same repository.
+//
+// The ID is the query-escaped unit name, followed by "@", followed by
+// the unit type (e.g., "github.com%2Ffoo%2Fbar@GoPackage"). It depends
+// only on the name and type, so it is stable across builds, commits,
+// and changes to the unit's files, and ParseID recovers both. Because
+// toolchains usually derive the name from the unit's directory,
+// renaming the directory changes the ID; ContentHash recognizes such
+// a unit under its new name (e.g., so that "srclib make --commits"
+// reuses its build data). Scanners must not emit two units
+// with the same ID (see scan.ScanMulti).
 func (u SourceUnit) ID() ID {
 	return ID(fmt.Sprintf("%s%s%s", url.QueryEscape(u.Name), idSeparator, u.Type))
 }
@@ -127,6 +137,10 @@ type sourceUnit struct {
 	Data         *json.RawMessage            `json:",omitempty"`
 	Config       map[string]*json.RawMessage `json:",omitempty"`
 	Ops          map[string]*srclib.ToolRef  `json:",omitempty"`
+	Owners       []string                    `json:",omitempty"`
+	Tags         []string                    `json:",omitempty"`
+	Metadata     map[string]string           `json:",omitempty"`
+	Env          []string                    `json:",omitempty"`
 }
 
 var _ json.Marshaler = (*SourceUnit)(nil)
@@ -171,6 +185,10 @@ func (u *SourceUnit) MarshalJSON() ([]byte, error) {
 		Data:         data,
 		Config:       cfg,
 		Ops:          ops,
+		Owners:       u.Owners,
+		Tags:         u.Tags,
+		Metadata:     u.Metadata,
+		Env:          u.Env,
 	})
 }
 
@@ -221,5 +239,9 @@ func (u *SourceUnit) UnmarshalJSON(b []byte) error {
 	}
 	u.Config = cfg
 	u.Ops = ops
+	u.Owners = su.Owners
+	u.Tags = su.Tags
+	u.Metadata = su.Metadata
+	u.Env = su.Env
 	return nil
 }
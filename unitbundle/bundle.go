@@ -0,0 +1,199 @@
+// Package unitbundle creates and extracts source unit bundles:
+// tarballs that contain exactly the files that a source unit's
+// grapher needs, so that the grapher can be run on the unit elsewhere
+// (e.g., on another machine, or to reproduce a toolchain bug from a
+// bundle that a user submitted) without the rest of the repository.
+package unitbundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// ManifestName is the name of the bundle entry that holds the bundle's
+// Manifest.
+const ManifestName = "srclib-bundle.json"
+
+// FilesDir is the directory (in a bundle) that holds the bundled
+// files, at their paths relative to the repository root.
+const FilesDir = "files"
+
+// A Manifest describes a source unit bundle.
+type Manifest struct {
+	// Unit is the bundled source unit (which is passed to the grapher
+	// on stdin).
+	Unit *unit.SourceUnit
+
+	// Tool is the grapher that graphed the unit when it was bundled,
+	// and ToolchainVersion is its toolchain's version, if known.
+	Tool             *srclib.ToolRef
+	ToolchainVersion string `json:",omitempty"`
+
+	// CommitID is the repository commit that the unit was bundled from,
+	// if known.
+	CommitID string `json:",omitempty"`
+
+	Created time.Time
+
+	// Files lists the bundled files (relative to the repository root,
+	// with forward slashes), in sorted order.
+	Files []string
+}
+
+// Write writes a bundle (a gzipped tarball) to w that contains m and
+// the files that it lists, read from the repository root directory
+// root.
+func Write(w io.Writer, root string, m *Manifest) (err error) {
+	gw := gzip.NewWriter(w)
+	defer func() {
+		if err2 := gw.Close(); err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+	tw := tar.NewWriter(gw)
+	defer func() {
+		if err2 := tw.Close(); err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: ManifestName, Mode: 0644, Size: int64(len(data)), ModTime: m.Created}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	for _, file := range m.Files {
+		if err := checkPath(file); err != nil {
+			return err
+		}
+		if err := writeFile(tw, filepath.Join(root, filepath.FromSlash(file)), path.Join(FilesDir, file)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFile(tw *tar.Writer, file, name string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("can't bundle %s: not a regular file", file)
+	}
+	hdr, err := tar.FileInfoHeader(fi, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Extract extracts the bundle in r to dir, writing the bundled files
+// to dir/FilesDir, and returns its manifest.
+func Extract(r io.Reader, dir string) (*Manifest, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	var m *Manifest
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if err := checkPath(hdr.Name); err != nil {
+			return nil, err
+		}
+		if hdr.Name == ManifestName {
+			if err := json.NewDecoder(tr).Decode(&m); err != nil {
+				return nil, fmt.Errorf("%s: %s", ManifestName, err)
+			}
+			continue
+		}
+		if !strings.HasPrefix(hdr.Name, FilesDir+"/") || hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			return nil, fmt.Errorf("unexpected bundle entry %q", hdr.Name)
+		}
+		file := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, hdr.FileInfo().Mode().Perm()|0600)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return nil, err
+		}
+		if err := f.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if m == nil {
+		return nil, fmt.Errorf("bundle has no %s", ManifestName)
+	}
+	if m.Unit == nil || m.Tool == nil {
+		return nil, fmt.Errorf("bundle %s has no source unit or tool", ManifestName)
+	}
+	return m, nil
+}
+
+// UnitFiles returns the files to bundle for u: its files and the
+// extra files (such as build configuration) given, deduplicated and
+// sorted.
+func UnitFiles(u *unit.SourceUnit, extra ...string) []string {
+	seen := map[string]bool{}
+	var files []string
+	for _, f := range append(append([]string{}, u.Files...), extra...) {
+		f = path.Clean(filepath.ToSlash(f))
+		if !seen[f] {
+			seen[f] = true
+			files = append(files, f)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// checkPath returns an error if name (a slash-separated path) isn't
+// relative or refers to a parent directory.
+func checkPath(name string) error {
+	clean := path.Clean(name)
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("invalid bundle path %q", name)
+	}
+	return nil
+}
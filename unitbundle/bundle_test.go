@@ -0,0 +1,85 @@
+package unitbundle
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestWriteExtract(t *testing.T) {
+	root, err := ioutil.TempDir("", "srclib-unitbundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	files := map[string]string{"Srcfile": "{}", "a/a.go": "package a", "a/b/b.go": "package b", "c.go": "package c"}
+	for name, data := range files {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	u := &unit.SourceUnit{Key: unit.Key{Name: "a", Type: "GoPackage"}, Info: unit.Info{Files: []string{"a/b/b.go", "a/a.go", "./a/a.go"}}}
+	m := &Manifest{
+		Unit:    u,
+		Tool:    &srclib.ToolRef{Toolchain: "sourcegraph.com/sourcegraph/srclib-go", Subcmd: "graph"},
+		Created: time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC),
+		Files:   UnitFiles(u, "Srcfile"),
+	}
+	if want := []string{"Srcfile", "a/a.go", "a/b/b.go"}; !reflect.DeepEqual(m.Files, want) {
+		t.Errorf("got files %v, want %v", m.Files, want)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, root, m); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "srclib-unitbundle-extract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m2, err := Extract(&buf, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m2.Unit.ID2() != u.ID2() || !reflect.DeepEqual(m2.Unit.Files, u.Files) {
+		t.Errorf("got unit %+v, want %+v", m2.Unit, u)
+	}
+	m2.Unit = u
+	if !reflect.DeepEqual(m2, m) {
+		t.Errorf("got manifest %+v, want %+v", m2, m)
+	}
+	for _, name := range m.Files {
+		data, err := ioutil.ReadFile(filepath.Join(dir, FilesDir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(data) != files[name] {
+			t.Errorf("%s: got %q, want %q", name, data, files[name])
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, FilesDir, "c.go")); !os.IsNotExist(err) {
+		t.Errorf("got c.go extracted (err %v), want only the unit's files", err)
+	}
+}
+
+func TestWrite_invalidPath(t *testing.T) {
+	m := &Manifest{Files: []string{"../x"}}
+	if err := Write(ioutil.Discard, os.TempDir(), m); err == nil {
+		t.Error("got no error")
+	}
+}
@@ -0,0 +1,162 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A SymlinkPolicy determines how symbolic links are treated when
+// walking a directory tree (see Walk).
+type SymlinkPolicy string
+
+const (
+	// IgnoreSymlinks skips symbolic links. It is the default.
+	IgnoreSymlinks SymlinkPolicy = "ignore"
+
+	// FollowSymlinks follows symbolic links whose targets are inside
+	// the root of the walk and skips the others. Each file and
+	// directory is visited only once, even if it is reachable by more
+	// than one path, so that symlink cycles terminate and files aren't
+	// duplicated.
+	FollowSymlinks SymlinkPolicy = "follow"
+
+	// ErrorOnSymlinks treats symbolic links as errors (see
+	// SymlinkError).
+	ErrorOnSymlinks SymlinkPolicy = "error"
+)
+
+// ParseSymlinkPolicy returns the symlink policy named s. The empty
+// string names IgnoreSymlinks.
+func ParseSymlinkPolicy(s string) (SymlinkPolicy, error) {
+	switch p := SymlinkPolicy(s); p {
+	case "":
+		return IgnoreSymlinks, nil
+	case IgnoreSymlinks, FollowSymlinks, ErrorOnSymlinks:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid symlink policy %q (expected %q, %q, or %q)", s, IgnoreSymlinks, FollowSymlinks, ErrorOnSymlinks)
+}
+
+// A SymlinkError is passed to the WalkFunc by Walk when it encounters
+// a symbolic link and the policy is ErrorOnSymlinks.
+type SymlinkError struct {
+	Path string
+}
+
+func (e *SymlinkError) Error() string {
+	return fmt.Sprintf("%s is a symbolic link (symbolic links are not allowed)", e.Path)
+}
+
+// IsSymlinkError reports whether err is a *SymlinkError.
+func IsSymlinkError(err error) bool {
+	_, ok := err.(*SymlinkError)
+	return ok
+}
+
+// Walk is like filepath.Walk, except that it treats symbolic links
+// (other than root itself, which is always followed) according to
+// policy. When a link is followed, walkFn is called with the link's
+// path and its target's FileInfo.
+func Walk(root string, policy SymlinkPolicy, walkFn filepath.WalkFunc) error {
+	w := &walker{policy: policy, walkFn: walkFn}
+	if policy == FollowSymlinks {
+		realRoot, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			return walkFn(root, nil, err)
+		}
+		w.realRoot = realRoot
+		w.seen = map[string]struct{}{}
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		err = walkFn(root, nil, err)
+	} else {
+		err = w.walk(root, info)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+type walker struct {
+	policy   SymlinkPolicy
+	walkFn   filepath.WalkFunc
+	realRoot string              // the root with symlinks evaluated (FollowSymlinks only)
+	seen     map[string]struct{} // real paths already visited (FollowSymlinks only)
+}
+
+func (w *walker) walk(path string, info os.FileInfo) error {
+	if info.Mode()&os.ModeSymlink != 0 {
+		switch w.policy {
+		case FollowSymlinks:
+			var err error
+			info, err = os.Stat(path)
+			if err != nil {
+				return w.walkFn(path, nil, err) // broken link
+			}
+		case ErrorOnSymlinks:
+			return w.walkFn(path, info, &SymlinkError{Path: path})
+		default:
+			return nil
+		}
+	}
+	if w.policy == FollowSymlinks {
+		real, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return w.walkFn(path, info, err)
+		}
+		if !IsWithin(w.realRoot, real) {
+			return nil
+		}
+		if _, seen := w.seen[real]; seen {
+			return nil
+		}
+		w.seen[real] = struct{}{}
+	}
+
+	if !info.IsDir() {
+		return w.walkFn(path, info, nil)
+	}
+	if err := w.walkFn(path, info, nil); err != nil {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return w.walkFn(path, info, err)
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return w.walkFn(path, info, err)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := filepath.Join(path, name)
+		fi, err := os.Lstat(p)
+		if err != nil {
+			err = w.walkFn(p, nil, err)
+		} else {
+			err = w.walk(p, fi)
+		}
+		if err == filepath.SkipDir {
+			return nil // skip the rest of this directory
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsWithin reports whether path is dir or is inside dir. Both must be
+// clean paths of the same kind (absolute or relative).
+func IsWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,97 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// makeSymlinkTree creates a tree with a symlink to a file, a symlink
+// to a directory in the tree, a symlink cycle, and a symlink to a
+// directory outside the tree. It returns the tree's root.
+func makeSymlinkTree(t *testing.T) (root string, cleanup func()) {
+	tmp, err := ioutil.TempDir("", "srclib-walk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root = filepath.Join(tmp, "root")
+	for _, dir := range []string{"root/src", "root/vendor", "outside"} {
+		if err := os.MkdirAll(filepath.Join(tmp, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"root/src/a.go", "root/vendor/v.go", "outside/o.go"} {
+		if err := ioutil.WriteFile(filepath.Join(tmp, file), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"root/src/b.go":   "a.go",
+		"root/src/vendor": "../vendor",
+		"root/src/loop":   "..",
+		"root/outside":    "../outside",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(tmp, link)); err != nil {
+			t.Skip("symlinks not supported:", err)
+		}
+	}
+	return root, func() { os.RemoveAll(tmp) }
+}
+
+func walkFiles(root string, policy SymlinkPolicy) ([]string, error) {
+	var files []string
+	err := Walk(root, policy, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return files, err
+}
+
+func TestWalk(t *testing.T) {
+	root, cleanup := makeSymlinkTree(t)
+	defer cleanup()
+
+	tests := map[SymlinkPolicy][]string{
+		IgnoreSymlinks: {"src/a.go", "vendor/v.go"},
+		// Each file is visited once (by the first path to it), the
+		// loop terminates, and the link outside the root is skipped.
+		FollowSymlinks: {"src/a.go", "src/vendor/v.go"},
+	}
+	for policy, want := range tests {
+		files, err := walkFiles(root, policy)
+		if err != nil {
+			t.Errorf("%s: %s", policy, err)
+			continue
+		}
+		if !reflect.DeepEqual(files, want) {
+			t.Errorf("%s: got files %v, want %v", policy, files, want)
+		}
+	}
+
+	if _, err := walkFiles(root, ErrorOnSymlinks); !IsSymlinkError(err) {
+		t.Errorf("%s: got error %v, want *SymlinkError", ErrorOnSymlinks, err)
+	}
+}
+
+func TestParseSymlinkPolicy(t *testing.T) {
+	for s, want := range map[string]SymlinkPolicy{"": IgnoreSymlinks, "follow": FollowSymlinks, "error": ErrorOnSymlinks} {
+		if got, err := ParseSymlinkPolicy(s); err != nil || got != want {
+			t.Errorf("%q: got %q, %v, want %q", s, got, err, want)
+		}
+	}
+	if _, err := ParseSymlinkPolicy("always"); err == nil {
+		t.Error("got no error for invalid policy")
+	}
+}
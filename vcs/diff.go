@@ -0,0 +1,112 @@
+package vcs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A DiffHunk is a range of lines that differ between the base and
+// head versions of a file.
+type DiffHunk struct {
+	// OrigFile and File are the slash-separated paths of the file
+	// (relative to the repository root) at the base and head commits.
+	// OrigFile is empty if the file was added, and File is empty if it
+	// was deleted.
+	OrigFile, File string
+
+	// OrigStart and OrigLines are the first line (1-indexed) and the
+	// number of lines of the hunk in the base version of the file. If
+	// OrigLines is 0, the hunk only adds lines, after line OrigStart.
+	OrigStart, OrigLines int
+
+	// Start and Lines are the first line and the number of lines of
+	// the hunk in the head version of the file. If Lines is 0, the
+	// hunk only removes lines, after line Start.
+	Start, Lines int
+}
+
+// parseUnifiedDiff parses the hunks of a diff in the unified format
+// with git-style headers (the output of "git diff" and "hg diff
+// --git"). Renamed files are only reported if their contents changed.
+func parseUnifiedDiff(out []byte) ([]DiffHunk, error) {
+	var (
+		hunks          []DiffHunk
+		origFile, file string
+		// The number of lines of the current hunk that remain to be
+		// read. Content lines may look like headers (e.g., a removed
+		// line "-- x" is "--- x"), so they must be skipped by count.
+		origLeft, left int
+	)
+	for _, l := range strings.Split(string(out), "\n") {
+		if origLeft > 0 || left > 0 {
+			switch {
+			case strings.HasPrefix(l, "-"):
+				origLeft--
+			case strings.HasPrefix(l, "+"):
+				left--
+			case strings.HasPrefix(l, " "):
+				origLeft--
+				left--
+			}
+			continue
+		}
+		switch {
+		case strings.HasPrefix(l, "diff --git "):
+			origFile, file = "", ""
+		case strings.HasPrefix(l, "--- "):
+			origFile = diffFileName(l[len("--- "):], "a/")
+		case strings.HasPrefix(l, "+++ "):
+			file = diffFileName(l[len("+++ "):], "b/")
+		case strings.HasPrefix(l, "@@ "):
+			h := DiffHunk{OrigFile: origFile, File: file}
+			fields := strings.Fields(l)
+			if len(fields) < 4 || fields[3] != "@@" {
+				return nil, fmt.Errorf("diff: bad hunk header %q", l)
+			}
+			var err error
+			if h.OrigStart, h.OrigLines, err = parseHunkRange(fields[1], "-"); err != nil {
+				return nil, fmt.Errorf("diff: bad hunk header %q", l)
+			}
+			if h.Start, h.Lines, err = parseHunkRange(fields[2], "+"); err != nil {
+				return nil, fmt.Errorf("diff: bad hunk header %q", l)
+			}
+			hunks = append(hunks, h)
+			origLeft, left = h.OrigLines, h.Lines
+		}
+	}
+	return hunks, nil
+}
+
+// diffFileName returns the path named in a "---" or "+++" line of a
+// diff header, without its prefix ("a/" or "b/"), or "" if it is
+// /dev/null.
+func diffFileName(name, prefix string) string {
+	if i := strings.Index(name, "\t"); i >= 0 {
+		name = name[:i]
+	}
+	if name == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(name, prefix)
+}
+
+// parseHunkRange parses a line range of the form "-START[,COUNT]" or
+// "+START[,COUNT]" in a hunk header. COUNT defaults to 1.
+func parseHunkRange(s, sign string) (start, count int, err error) {
+	if !strings.HasPrefix(s, sign) {
+		return 0, 0, fmt.Errorf("missing %q", sign)
+	}
+	s = s[len(sign):]
+	count = 1
+	if i := strings.Index(s, ","); i >= 0 {
+		if count, err = strconv.Atoi(s[i+1:]); err != nil {
+			return 0, 0, err
+		}
+		s = s[:i]
+	}
+	if start, err = strconv.Atoi(s); err != nil {
+		return 0, 0, err
+	}
+	return start, count, nil
+}
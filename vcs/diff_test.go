@@ -0,0 +1,57 @@
+package vcs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseUnifiedDiff(t *testing.T) {
+	out := `diff --git a/a.go b/a.go
+index 1111111..2222222 100644
+--- a/a.go
++++ b/a.go
+@@ -3 +3,2 @@ package a
+-func F() {}
++func G() {}
++func H() {}
+@@ -10,2 +10,0 @@ func x() {
+--- looks like a header
+-x
+diff --git a/old.go b/new.go
+similarity index 90%
+rename from old.go
+rename to new.go
+--- a/old.go
++++ b/new.go
+@@ -1,0 +2 @@
++// added
+diff --git a/moved.go b/moved2.go
+similarity index 100%
+rename from moved.go
+rename to moved2.go
+diff --git a/gone.go b/gone.go
+deleted file mode 100644
+--- a/gone.go
++++ /dev/null
+@@ -1,2 +0,0 @@
+-package a
+-
+`
+	hunks, err := parseUnifiedDiff([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DiffHunk{
+		{OrigFile: "a.go", File: "a.go", OrigStart: 3, OrigLines: 1, Start: 3, Lines: 2},
+		{OrigFile: "a.go", File: "a.go", OrigStart: 10, OrigLines: 2, Start: 10, Lines: 0},
+		{OrigFile: "old.go", File: "new.go", OrigStart: 1, OrigLines: 0, Start: 2, Lines: 1},
+		{OrigFile: "gone.go", OrigStart: 1, OrigLines: 2, Start: 0, Lines: 0},
+	}
+	if !reflect.DeepEqual(hunks, want) {
+		t.Errorf("got hunks %+v, want %+v", hunks, want)
+	}
+
+	if _, err := parseUnifiedDiff([]byte("@@ -x +1 @@\n")); err == nil {
+		t.Error("got no error for bad hunk header")
+	}
+}
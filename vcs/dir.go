@@ -0,0 +1,104 @@
+package vcs
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Dir is the backend for plain directory trees that are not under
+// version control (e.g., an extracted release tarball). The commit ID
+// of a directory tree is a hash of its contents (see TreeHash).
+//
+// Dir never detects a repository on its own, and FindRoot doesn't
+// fall back to it, because hashing a large tree (such as a home
+// directory) is slow. Callers must opt in to it (see cli.OpenRepo).
+var Dir VCS = dirVCS{}
+
+type dirVCS struct{}
+
+func (dirVCS) Type() string { return "dir" }
+
+func (dirVCS) Detect(dir string) bool { return false }
+
+func (dirVCS) CommitID(dir string) (string, error) { return TreeHash(dir) }
+
+func (dirVCS) Remotes(dir string) ([]Remote, error) { return nil, nil }
+
+func (dirVCS) ChangedFiles(dir, base, head string) ([]string, error) {
+	return nil, ErrNoHistory
+}
+
+func (dirVCS) Renames(dir, base, head string) ([]Rename, error) {
+	return nil, ErrNoHistory
+}
+
+func (dirVCS) Commits(dir, base, head string) ([]string, error) {
+	return nil, ErrNoHistory
+}
+
+func (dirVCS) Checkout(dir, rev string) (string, error) {
+	return "", ErrNoHistory
+}
+
+func (dirVCS) Dirty(dir string) (bool, error) { return false, nil }
+
+func (dirVCS) Blame(dir, file string) ([]BlameHunk, error) {
+	return nil, ErrNoHistory
+}
+
+func (dirVCS) Diff(dir, base, head string) ([]DiffHunk, error) {
+	return nil, ErrNoHistory
+}
+
+func (dirVCS) ReadFileAt(dir, rev, file string) ([]byte, error) {
+	return nil, ErrNoHistory
+}
+
+func (dirVCS) CommitDate(dir, rev string) (time.Time, error) {
+	return time.Time{}, ErrNoHistory
+}
+
+// TreeHash computes a 40-character hex SHA-1 hash over the names,
+// modes, and contents of all files in the tree rooted at dir. Hidden
+// files and directories (whose names begin with ".") are skipped, so
+// that srclib's own build data and store directories do not affect
+// the hash.
+func TreeHash(dir string) (string, error) {
+	h := sha1.New()
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s %o %d\x00", filepath.ToSlash(rel), info.Mode().Perm(), info.Size())
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
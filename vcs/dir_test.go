@@ -0,0 +1,70 @@
+package vcs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTreeHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-vcs-dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile := func(name, data string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hash := func() string {
+		h, err := TreeHash(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	writeFile("a.go", "package a")
+	writeFile("b/b.go", "package b")
+	h1 := hash()
+	if len(h1) != 40 {
+		t.Errorf("got hash %q, want 40 hex chars", h1)
+	}
+
+	// Hidden dirs (such as .srclib-cache) don't affect the hash.
+	writeFile(".srclib-cache/x/y.json", "{}")
+	if h := hash(); h != h1 {
+		t.Errorf("got hash %q after adding hidden file, want unchanged %q", h, h1)
+	}
+
+	writeFile("b/b.go", "package bb")
+	if h := hash(); h == h1 {
+		t.Errorf("got unchanged hash %q after modifying file", h)
+	}
+}
+
+func TestFindRoot_dir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-vcs-dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Unversioned trees aren't detected, so that they aren't hashed
+	// unless a command opts in to the Dir backend.
+	rootDir, v, err := FindRoot(dir)
+	if err == nil {
+		// The temp dir might be inside a repository on some systems.
+		t.Skipf("temp dir %s is inside a %s repository at %s", dir, v.Type(), rootDir)
+	}
+	if err != ErrNoRepository {
+		t.Errorf("got error %v, want %v", err, ErrNoRepository)
+	}
+}
@@ -0,0 +1,247 @@
+package vcs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Git is the git VCS backend.
+var Git VCS = gitVCS{}
+
+type gitVCS struct{}
+
+func (gitVCS) Type() string { return "git" }
+
+func (gitVCS) Detect(dir string) bool {
+	// Don't check that the FileInfo is a dir because git submodules
+	// have a .git file.
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+func (gitVCS) CommitID(dir string) (string, error) {
+	return run(dir, "git", "rev-parse", "HEAD")
+}
+
+func (gitVCS) Remotes(dir string) ([]Remote, error) {
+	out, err := runNoMatch(dir, "git", "config", "--get-regexp", `^remote\..*\.url$`)
+	if err != nil {
+		return nil, err
+	}
+	var remotes []Remote
+	for _, line := range splitLines(out) {
+		// Each line is "remote.NAME.url URL".
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(fields[0], "remote."), ".url")
+		remotes = append(remotes, Remote{Name: name, URL: strings.TrimSpace(fields[1])})
+	}
+	sort.Sort(remotesByName(remotes))
+	return remotes, nil
+}
+
+func (gitVCS) ChangedFiles(dir, base, head string) ([]string, error) {
+	out, err := run(dir, "git", "diff", "--name-only", base, head)
+	if err != nil {
+		return nil, err
+	}
+	return splitLines(out), nil
+}
+
+func (gitVCS) Renames(dir, base, head string) ([]Rename, error) {
+	cmd := exec.Command("git", "diff", "--no-color", "--name-status", "-M", "-z", base, head)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("exec %v failed: %s", cmd.Args, err)
+	}
+	return parseGitRenames(out)
+}
+
+func (gitVCS) Commits(dir, base, head string) ([]string, error) {
+	out, err := run(dir, "git", "rev-list", "--reverse", head, "^"+base)
+	if err != nil {
+		return nil, err
+	}
+	return splitLines(out), nil
+}
+
+func (gitVCS) Checkout(dir, rev string) (string, error) {
+	// Prefer the branch name, so that restoring it doesn't leave a
+	// detached HEAD.
+	prev, err := run(dir, "git", "symbolic-ref", "-q", "--short", "HEAD")
+	if err != nil {
+		if prev, err = run(dir, "git", "rev-parse", "HEAD"); err != nil {
+			return "", err
+		}
+	}
+	if _, err := run(dir, "git", "checkout", "-q", rev); err != nil {
+		return "", err
+	}
+	return prev, nil
+}
+
+func (gitVCS) Dirty(dir string) (bool, error) {
+	out, err := run(dir, "git", "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return false, err
+	}
+	return out != "", nil
+}
+
+func (gitVCS) Blame(dir, file string) ([]BlameHunk, error) {
+	cmd := exec.Command("git", "blame", "--porcelain", "--", file)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("exec %v failed: %s", cmd.Args, err)
+	}
+	return parseGitBlame(out)
+}
+
+func (gitVCS) Diff(dir, base, head string) ([]DiffHunk, error) {
+	cmd := exec.Command("git", "diff", "--no-color", "--no-ext-diff", "-M", "-U0", base, head)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("exec %v failed: %s", cmd.Args, err)
+	}
+	return parseUnifiedDiff(out)
+}
+
+func (gitVCS) ReadFileAt(dir, rev, file string) ([]byte, error) {
+	cmd := exec.Command("git", "show", rev+":"+filepath.ToSlash(file))
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("exec %v failed: %s", cmd.Args, err)
+	}
+	return out, nil
+}
+
+func (gitVCS) CommitDate(dir, rev string) (time.Time, error) {
+	out, err := run(dir, "git", "show", "-s", "--format=%ct", rev)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := strconv.ParseInt(out, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("git show: bad commit time %q", out)
+	}
+	return time.Unix(t, 0).UTC(), nil
+}
+
+// gitUncommitted is the commit ID that git blame reports for lines
+// that have not been committed.
+const gitUncommitted = "0000000000000000000000000000000000000000"
+
+// parseGitBlame parses the output of "git blame --porcelain".
+func parseGitBlame(out []byte) ([]BlameHunk, error) {
+	// Commit info is only given the first time each commit appears.
+	commits := map[string]*BlameHunk{} // commit ID -> commit info
+	var (
+		hunks  []BlameHunk
+		commit *BlameHunk // commit of the current line
+		line   int        // current line number
+	)
+	for _, l := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(l, "\t") {
+			// The content of the current line.
+			if commit == nil {
+				return nil, errors.New("git blame: line content without header")
+			}
+			if commit.CommitID != gitUncommitted {
+				if n := len(hunks); n > 0 && hunks[n-1].CommitID == commit.CommitID && hunks[n-1].EndLine == line-1 {
+					hunks[n-1].EndLine = line
+				} else {
+					h := *commit
+					h.StartLine, h.EndLine = line, line
+					hunks = append(hunks, h)
+				}
+			}
+			continue
+		}
+
+		fields := strings.Fields(l)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) >= 3 && len(fields[0]) == 40 {
+			// A line header: "<commit> <orig line> <final line> [<num lines>]".
+			n, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("git blame: bad line header %q", l)
+			}
+			line = n
+			commit = commits[fields[0]]
+			if commit == nil {
+				commit = &BlameHunk{CommitID: fields[0]}
+				commits[fields[0]] = commit
+			}
+			continue
+		}
+		if commit == nil {
+			continue
+		}
+		val := strings.TrimSpace(strings.TrimPrefix(l, fields[0]))
+		switch fields[0] {
+		case "author":
+			commit.Author = val
+		case "author-mail":
+			commit.AuthorEmail = strings.TrimSuffix(strings.TrimPrefix(val, "<"), ">")
+		case "author-time":
+			t, err := strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("git blame: bad author-time %q", val)
+			}
+			commit.AuthorDate = time.Unix(t, 0).UTC()
+		}
+	}
+	return hunks, nil
+}
+
+// parseGitRenames parses the renames in the output of "git diff
+// --name-status -M -z", which is a sequence of NUL-terminated fields:
+// a status (e.g., "M" or, for a rename, "R" followed by the
+// similarity) followed by a path, or by the old and new paths for
+// renames and copies.
+func parseGitRenames(out []byte) ([]Rename, error) {
+	fields := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	var renames []Rename
+	for i := 0; i < len(fields) && fields[i] != ""; {
+		status := fields[i]
+		switch status[0] {
+		case 'R', 'C':
+			if i+2 >= len(fields) {
+				return nil, fmt.Errorf("git diff: missing paths for status %q", status)
+			}
+			if status[0] == 'R' {
+				sim, err := strconv.Atoi(status[1:])
+				if err != nil {
+					return nil, fmt.Errorf("git diff: bad rename status %q", status)
+				}
+				renames = append(renames, Rename{OrigFile: fields[i+1], File: fields[i+2], Similarity: sim})
+			}
+			i += 3
+		default:
+			i += 2
+		}
+	}
+	sort.Sort(renamesByOrigFile(renames))
+	return renames, nil
+}
+
+type renamesByOrigFile []Rename
+
+func (v renamesByOrigFile) Len() int           { return len(v) }
+func (v renamesByOrigFile) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v renamesByOrigFile) Less(i, j int) bool { return v[i].OrigFile < v[j].OrigFile }
@@ -0,0 +1,175 @@
+package vcs
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseGitBlame(t *testing.T) {
+	const (
+		c1 = "1111111111111111111111111111111111111111"
+		c2 = "2222222222222222222222222222222222222222"
+	)
+	out := c1 + ` 1 1 2
+author Alice
+author-mail <alice@example.com>
+author-time 1400000000
+author-tz +0000
+summary first
+filename f.go
+	package f
+` + c1 + ` 2 2
+	
+` + c2 + ` 3 3 1
+author Bob
+author-mail <bob@example.com>
+author-time 1500000000
+author-tz -0700
+summary second
+previous ` + c1 + ` f.go
+filename f.go
+	func F() {}
+` + gitUncommitted + ` 4 4 1
+author Not Committed Yet
+author-mail <not.committed.yet>
+author-time 1600000000
+author-tz +0000
+summary Version of f.go from f.go
+filename f.go
+	// TODO
+` + c1 + ` 4 5 1
+	var x int
+`
+	hunks, err := parseGitBlame([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := BlameHunk{CommitID: c1, Author: "Alice", AuthorEmail: "alice@example.com", AuthorDate: time.Unix(1400000000, 0).UTC()}
+	bob := BlameHunk{CommitID: c2, Author: "Bob", AuthorEmail: "bob@example.com", AuthorDate: time.Unix(1500000000, 0).UTC()}
+	want := []BlameHunk{alice, bob, alice}
+	want[0].StartLine, want[0].EndLine = 1, 2
+	want[1].StartLine, want[1].EndLine = 3, 3
+	want[2].StartLine, want[2].EndLine = 5, 5
+	if !reflect.DeepEqual(hunks, want) {
+		t.Errorf("got hunks %+v, want %+v", hunks, want)
+	}
+}
+
+func TestParseGitRenames(t *testing.T) {
+	out := "M\x00a.go\x00R100\x00old/z.go\x00new/z.go\x00C075\x00b.go\x00c.go\x00R087\x00d.go\x00e.go\x00D\x00f.go\x00"
+	renames, err := parseGitRenames([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Rename{{OrigFile: "d.go", File: "e.go", Similarity: 87}, {OrigFile: "old/z.go", File: "new/z.go", Similarity: 100}}
+	if !reflect.DeepEqual(renames, want) {
+		t.Errorf("got renames %+v, want %+v", renames, want)
+	}
+
+	if renames, err := parseGitRenames(nil); err != nil || renames != nil {
+		t.Errorf("got %v, %v for no output, want nil, nil", renames, err)
+	}
+}
+
+func TestParseHgRenames(t *testing.T) {
+	out := `A b.go
+  a.go
+A d.go
+  c.go
+A e.go
+R a.go
+R f.go
+`
+	want := []Rename{{OrigFile: "a.go", File: "b.go"}}
+	if renames := parseHgRenames([]byte(out)); !reflect.DeepEqual(renames, want) {
+		t.Errorf("got renames %+v, want %+v", renames, want)
+	}
+}
+
+func TestGitDirty(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir, err := ioutil.TempDir("", "srclib-vcs-git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	git := func(arg ...string) {
+		arg = append([]string{"-c", "user.name=a", "-c", "user.email=a@example.com"}, arg...)
+		if _, err := run(dir, "git", arg...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dirty := func(want bool) {
+		got, err := Git.Dirty(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("got dirty %v, want %v", got, want)
+		}
+	}
+	git("init", "-q")
+	if err := ioutil.WriteFile(filepath.Join(dir, "f"), []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	git("add", "f")
+	git("commit", "-q", "-m", "c")
+	dirty(false)
+
+	// Untracked files are ignored.
+	if err := ioutil.WriteFile(filepath.Join(dir, "g"), []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	dirty(false)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "f"), []byte("b"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	dirty(true)
+}
+
+func TestGitRemotes(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir, err := ioutil.TempDir("", "srclib-vcs-git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := run(dir, "git", "init", "-q"); err != nil {
+		t.Fatal(err)
+	}
+
+	// git config exits with status 1 when there are no remotes.
+	remotes, err := Git.Remotes(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remotes != nil {
+		t.Errorf("got remotes %v, want none", remotes)
+	}
+
+	if _, err := run(dir, "git", "remote", "add", "origin", "https://example.com/a"); err != nil {
+		t.Fatal(err)
+	}
+	remotes, err = Git.Remotes(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Remote{{Name: "origin", URL: "https://example.com/a"}}; !reflect.DeepEqual(remotes, want) {
+		t.Errorf("got remotes %v, want %v", remotes, want)
+	}
+
+	// Other failures are returned.
+	if remotes, err := Git.Remotes(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("got remotes %v and no error for a missing directory", remotes)
+	}
+}
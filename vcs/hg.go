@@ -0,0 +1,224 @@
+package vcs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Hg is the Mercurial VCS backend.
+var Hg VCS = hgVCS{}
+
+type hgVCS struct{}
+
+func (hgVCS) Type() string { return "hg" }
+
+func (hgVCS) Detect(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ".hg"))
+	return err == nil
+}
+
+func (hgVCS) CommitID(dir string) (string, error) {
+	out, err := run(dir, "hg", "--config", "trusted.users=root", "identify", "--debug", "-i")
+	if err != nil {
+		return "", err
+	}
+	// hg adds a "+" if the wd is dirty
+	return strings.TrimSuffix(out, "+"), nil
+}
+
+func (hgVCS) Remotes(dir string) ([]Remote, error) {
+	out, err := runNoMatch(dir, "hg", "--config", "trusted.users=root", "paths")
+	if err != nil {
+		return nil, err
+	}
+	var remotes []Remote
+	for _, line := range splitLines(out) {
+		// Each line is "NAME = URL".
+		fields := strings.SplitN(line, "=", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		name := strings.TrimSpace(fields[0])
+		if name == "default" {
+			// Mercurial's "default" path is the equivalent of git's
+			// "origin" remote.
+			name = "origin"
+		}
+		remotes = append(remotes, Remote{Name: name, URL: strings.TrimSpace(fields[1])})
+	}
+	sort.Sort(remotesByName(remotes))
+	return remotes, nil
+}
+
+func (hgVCS) ChangedFiles(dir, base, head string) ([]string, error) {
+	out, err := run(dir, "hg", "--config", "trusted.users=root", "status", "--no-status", "--rev", base, "--rev", head)
+	if err != nil {
+		return nil, err
+	}
+	return splitLines(out), nil
+}
+
+func (hgVCS) Renames(dir, base, head string) ([]Rename, error) {
+	cmd := exec.Command("hg", "--config", "trusted.users=root", "status", "--added", "--removed", "--copies", "--rev", base, "--rev", head)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("exec %v failed: %s", cmd.Args, err)
+	}
+	return parseHgRenames(out), nil
+}
+
+func (hgVCS) Commits(dir, base, head string) ([]string, error) {
+	// Follow the ancestors of head, pruning base and its ancestors.
+	// hg lists them newest first.
+	out, err := run(dir, "hg", "--config", "trusted.users=root", "log", "--template", "{node}\\n", "--follow", "-r", head, "--prune", base)
+	if err != nil {
+		return nil, err
+	}
+	commits := splitLines(out)
+	for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+		commits[i], commits[j] = commits[j], commits[i]
+	}
+	return commits, nil
+}
+
+func (v hgVCS) Checkout(dir, rev string) (string, error) {
+	prev, err := v.CommitID(dir)
+	if err != nil {
+		return "", err
+	}
+	if _, err := run(dir, "hg", "--config", "trusted.users=root", "update", "-q", "-r", rev); err != nil {
+		return "", err
+	}
+	return prev, nil
+}
+
+func (hgVCS) Dirty(dir string) (bool, error) {
+	// Only list modified, added, removed, and deleted (missing)
+	// files, not unknown ones.
+	out, err := run(dir, "hg", "--config", "trusted.users=root", "status", "-mard")
+	if err != nil {
+		return false, err
+	}
+	return out != "", nil
+}
+
+func (hgVCS) Blame(dir, file string) ([]BlameHunk, error) {
+	cmd := exec.Command("hg", "--config", "trusted.users=root", "annotate", "--template", "json", "--changeset", "--user", "--date", "--", file)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("exec %v failed: %s", cmd.Args, err)
+	}
+	return parseHgAnnotate(out)
+}
+
+func (hgVCS) Diff(dir, base, head string) ([]DiffHunk, error) {
+	cmd := exec.Command("hg", "--config", "trusted.users=root", "diff", "--git", "-U", "0", "-r", base, "-r", head)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("exec %v failed: %s", cmd.Args, err)
+	}
+	return parseUnifiedDiff(out)
+}
+
+func (hgVCS) ReadFileAt(dir, rev, file string) ([]byte, error) {
+	cmd := exec.Command("hg", "--config", "trusted.users=root", "cat", "-r", rev, "--", file)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("exec %v failed: %s", cmd.Args, err)
+	}
+	return out, nil
+}
+
+func (hgVCS) CommitDate(dir, rev string) (time.Time, error) {
+	// The hgdate filter formats the date as "UNIXTIME TZOFFSET".
+	out, err := run(dir, "hg", "--config", "trusted.users=root", "log", "-r", rev, "--template", "{date|hgdate}")
+	if err != nil {
+		return time.Time{}, err
+	}
+	var t, tz int64
+	if _, err := fmt.Sscanf(out, "%d %d", &t, &tz); err != nil {
+		return time.Time{}, fmt.Errorf("hg log: bad commit date %q", out)
+	}
+	return time.Unix(t, 0).UTC(), nil
+}
+
+// parseHgAnnotate parses the output of "hg annotate --template json".
+func parseHgAnnotate(out []byte) ([]BlameHunk, error) {
+	var files []struct {
+		Lines []struct {
+			Node string
+			User string
+			Date [2]float64 // Unix time and time zone offset
+		}
+	}
+	if err := json.Unmarshal(out, &files); err != nil {
+		return nil, fmt.Errorf("hg annotate: %s", err)
+	}
+	var hunks []BlameHunk
+	for _, f := range files {
+		for i, l := range f.Lines {
+			line := i + 1
+			if strings.Trim(l.Node, "f") == "" {
+				continue // not committed
+			}
+			if n := len(hunks); n > 0 && hunks[n-1].CommitID == l.Node && hunks[n-1].EndLine == line-1 {
+				hunks[n-1].EndLine = line
+				continue
+			}
+			h := BlameHunk{StartLine: line, EndLine: line, CommitID: l.Node, AuthorDate: time.Unix(int64(l.Date[0]), 0).UTC()}
+			h.Author, h.AuthorEmail = parseHgUser(l.User)
+			hunks = append(hunks, h)
+		}
+	}
+	return hunks, nil
+}
+
+// parseHgUser splits a Mercurial user string of the form "Name
+// <email>" into its name and email.
+func parseHgUser(user string) (name, email string) {
+	lt := strings.Index(user, "<")
+	if lt == -1 || !strings.HasSuffix(user, ">") {
+		return user, ""
+	}
+	return strings.TrimSpace(user[:lt]), user[lt+1 : len(user)-1]
+}
+
+// parseHgRenames parses the renames in the output of "hg status
+// --added --removed --copies". A rename is an added file ("A FILE")
+// whose copy source (on the next line, indented by 2 spaces) was
+// removed ("R FILE").
+func parseHgRenames(out []byte) []Rename {
+	var copies []Rename
+	removed := map[string]bool{}
+	var added string // the last added file
+	for _, l := range strings.Split(string(out), "\n") {
+		switch {
+		case strings.HasPrefix(l, "A "):
+			added = l[2:]
+		case strings.HasPrefix(l, "  ") && added != "":
+			copies = append(copies, Rename{OrigFile: l[2:], File: added})
+			added = ""
+		case strings.HasPrefix(l, "R "):
+			removed[l[2:]] = true
+			added = ""
+		}
+	}
+	var renames []Rename
+	for _, c := range copies {
+		if removed[c.OrigFile] {
+			renames = append(renames, c)
+		}
+	}
+	sort.Sort(renamesByOrigFile(renames))
+	return renames
+}
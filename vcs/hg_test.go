@@ -0,0 +1,56 @@
+package vcs
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHgRemotes(t *testing.T) {
+	if _, err := exec.LookPath("hg"); err != nil {
+		t.Skip("hg not found")
+	}
+	dir, err := ioutil.TempDir("", "srclib-vcs-hg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := run(dir, "hg", "init"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A repository with no paths has no remotes (as a git repository
+	// with no remotes does).
+	remotes, err := Hg.Remotes(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remotes != nil {
+		t.Errorf("got remotes %v, want none", remotes)
+	}
+
+	hgrc := "[paths]\ndefault = https://example.com/a\nupstream = https://example.com/b\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, ".hg", "hgrc"), []byte(hgrc), 0600); err != nil {
+		t.Fatal(err)
+	}
+	remotes, err = Hg.Remotes(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Remote{{Name: "origin", URL: "https://example.com/a"}, {Name: "upstream", URL: "https://example.com/b"}}
+	if !reflect.DeepEqual(remotes, want) {
+		t.Errorf("got remotes %v, want %v", remotes, want)
+	}
+
+	// Failures of hg paths (e.g., outside of a repository) are
+	// returned.
+	if err := os.RemoveAll(filepath.Join(dir, ".hg")); err != nil {
+		t.Fatal(err)
+	}
+	if remotes, err := Hg.Remotes(dir); err == nil {
+		t.Errorf("got remotes %v and no error outside of a repository", remotes)
+	}
+}
@@ -0,0 +1,37 @@
+package vcs
+
+// DefaultRemotes is the default remote selection policy: the names of
+// remotes, in order of preference, whose URL is used as a
+// repository's clone URL.
+//
+// A remote named "srclib" always takes precedence, so that
+// repositories can designate their canonical location explicitly. An
+// "upstream" remote is preferred over "origin" because in a checkout
+// of a fork, "origin" is usually the fork and "upstream" is the
+// canonical repository.
+var DefaultRemotes = []string{"srclib", "upstream", "origin"}
+
+// SelectRemote chooses the remote whose URL determines a repository's
+// clone URL. It returns the first remote in remotes whose name is
+// listed in policy, trying the names in policy in order. If no remote
+// matches but there is exactly one remote, that remote is returned.
+// Otherwise, it returns false.
+func SelectRemote(remotes []Remote, policy []string) (Remote, bool) {
+	for _, name := range policy {
+		for _, r := range remotes {
+			if r.Name == name {
+				return r, true
+			}
+		}
+	}
+	if len(remotes) == 1 {
+		return remotes[0], true
+	}
+	return Remote{}, false
+}
+
+type remotesByName []Remote
+
+func (v remotesByName) Len() int           { return len(v) }
+func (v remotesByName) Less(i, j int) bool { return v[i].Name < v[j].Name }
+func (v remotesByName) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
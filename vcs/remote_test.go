@@ -0,0 +1,34 @@
+package vcs
+
+import "testing"
+
+func TestSelectRemote(t *testing.T) {
+	origin := Remote{Name: "origin", URL: "https://github.com/me/repo"}
+	upstream := Remote{Name: "upstream", URL: "https://github.com/them/repo"}
+	fork := Remote{Name: "fork", URL: "https://github.com/other/repo"}
+
+	tests := []struct {
+		remotes []Remote
+		policy  []string
+		want    Remote
+		wantOK  bool
+	}{
+		{remotes: nil, policy: DefaultRemotes},
+		{remotes: []Remote{origin}, policy: DefaultRemotes, want: origin, wantOK: true},
+		{remotes: []Remote{origin, upstream}, policy: DefaultRemotes, want: upstream, wantOK: true},
+		{remotes: []Remote{origin, upstream}, policy: []string{"origin"}, want: origin, wantOK: true},
+		{remotes: []Remote{fork, origin}, policy: []string{"upstream", "fork"}, want: fork, wantOK: true},
+		{remotes: []Remote{fork}, policy: []string{"upstream"}, want: fork, wantOK: true},
+		{remotes: []Remote{fork, upstream}, policy: []string{"origin"}},
+	}
+	for _, test := range tests {
+		r, ok := SelectRemote(test.remotes, test.policy)
+		if ok != test.wantOK {
+			t.Errorf("%v with policy %v: got ok %v, want %v", test.remotes, test.policy, ok, test.wantOK)
+			continue
+		}
+		if r != test.want {
+			t.Errorf("%v with policy %v: got remote %+v, want %+v", test.remotes, test.policy, r, test.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package vcs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Tree is the backend for directories into which files of a source
+// tree that isn't checked out (a revision of a git repository, or an
+// archive) were materialized (see package srcfs). Such a directory
+// has a TreeInfoFile recording the tree's commit ID and, for a git
+// revision, the git repository, which answers history queries.
+var Tree VCS = treeVCS{}
+
+// TreeInfoFile is the name of the file, in the top-level directory
+// of a materialized tree, that describes the tree (see TreeInfo).
+const TreeInfoFile = ".srclib-tree.json"
+
+// TreeInfo describes a materialized tree.
+type TreeInfo struct {
+	// Source is the spec of the source tree (see srcfs.Open).
+	Source string
+
+	// CommitID is the ID of the tree's git commit, or a hash of the
+	// archive that the tree was materialized from.
+	CommitID string
+
+	// GitDir is the absolute path of the git repository whose
+	// revision the tree is, if any.
+	GitDir string `json:",omitempty"`
+}
+
+// WriteTreeInfo writes info to the TreeInfoFile in dir.
+func WriteTreeInfo(dir string, info *TreeInfo) error {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, TreeInfoFile), data, 0644)
+}
+
+// ReadTreeInfo reads the TreeInfoFile in dir.
+func ReadTreeInfo(dir string) (*TreeInfo, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, TreeInfoFile))
+	if err != nil {
+		return nil, err
+	}
+	var info TreeInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+type treeVCS struct{}
+
+func (treeVCS) Type() string { return "tree" }
+
+func (treeVCS) Detect(dir string) bool {
+	fi, err := os.Stat(filepath.Join(dir, TreeInfoFile))
+	return err == nil && fi.Mode().IsRegular()
+}
+
+func (treeVCS) CommitID(dir string) (string, error) {
+	info, err := ReadTreeInfo(dir)
+	if err != nil {
+		return "", err
+	}
+	return info.CommitID, nil
+}
+
+// gitDir returns the git repository of the tree in dir, or
+// ErrNoHistory if it wasn't materialized from one.
+func (treeVCS) gitDir(dir string) (string, error) {
+	info, err := ReadTreeInfo(dir)
+	if err != nil {
+		return "", err
+	}
+	if info.GitDir == "" {
+		return "", ErrNoHistory
+	}
+	return info.GitDir, nil
+}
+
+func (v treeVCS) Remotes(dir string) ([]Remote, error) {
+	gitDir, err := v.gitDir(dir)
+	if err == ErrNoHistory {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return Git.Remotes(gitDir)
+}
+
+func (v treeVCS) ChangedFiles(dir, base, head string) ([]string, error) {
+	gitDir, err := v.gitDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	return Git.ChangedFiles(gitDir, base, head)
+}
+
+func (v treeVCS) Renames(dir, base, head string) ([]Rename, error) {
+	gitDir, err := v.gitDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	return Git.Renames(gitDir, base, head)
+}
+
+func (v treeVCS) Commits(dir, base, head string) ([]string, error) {
+	gitDir, err := v.gitDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	return Git.Commits(gitDir, base, head)
+}
+
+func (treeVCS) Checkout(dir, rev string) (string, error) {
+	return "", ErrNoHistory
+}
+
+func (treeVCS) Dirty(dir string) (bool, error) { return false, nil }
+
+func (treeVCS) Blame(dir, file string) ([]BlameHunk, error) {
+	return nil, ErrNoHistory
+}
+
+func (v treeVCS) Diff(dir, base, head string) ([]DiffHunk, error) {
+	gitDir, err := v.gitDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	return Git.Diff(gitDir, base, head)
+}
+
+func (v treeVCS) ReadFileAt(dir, rev, file string) ([]byte, error) {
+	gitDir, err := v.gitDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	return Git.ReadFileAt(gitDir, rev, file)
+}
+
+func (v treeVCS) CommitDate(dir, rev string) (time.Time, error) {
+	gitDir, err := v.gitDir(dir)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return Git.CommitDate(gitDir, rev)
+}
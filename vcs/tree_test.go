@@ -0,0 +1,44 @@
+package vcs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-vcs-tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sub := filepath.Join(dir, "a", "b")
+	if err := os.MkdirAll(sub, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if rootDir, v, err := FindRoot(sub); err == nil && v == Tree {
+		t.Fatalf("got root %q, VCS %v before writing the tree info, want not a tree", rootDir, v)
+	}
+	if err := WriteTreeInfo(dir, &TreeInfo{Source: "x.zip", CommitID: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	rootDir, v, err := FindRoot(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rootDir != dir || v != Tree {
+		t.Errorf("got root %q, VCS %v, want %q, tree", rootDir, v, dir)
+	}
+	if id, err := v.CommitID(rootDir); err != nil || id != "c" {
+		t.Errorf("got commit ID %q (error %v), want %q", id, err, "c")
+	}
+	if remotes, err := v.Remotes(rootDir); err != nil || len(remotes) != 0 {
+		t.Errorf("got remotes %v (error %v), want none", remotes, err)
+	}
+	// An archive's tree has no history.
+	if _, err := v.Commits(rootDir, "a", "b"); err != ErrNoHistory {
+		t.Errorf("got Commits error %v, want ErrNoHistory", err)
+	}
+}
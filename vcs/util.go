@@ -0,0 +1,45 @@
+package vcs
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// run runs the named program in dir and returns its trimmed output.
+func run(dir, prog string, arg ...string) (string, error) {
+	cmd := exec.Command(prog, arg...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("exec %v failed: %s. Output was:\n\n%s", cmd.Args, err, out)
+	}
+	return string(bytes.TrimSpace(out)), nil
+}
+
+// runNoMatch is like run, but if the program exits with status 1
+// (which git config and, in some versions, hg paths do when nothing
+// matches), it returns no output and no error.
+func runNoMatch(dir, prog string, arg ...string) (string, error) {
+	cmd := exec.Command(prog, arg...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if e, ok := err.(*exec.ExitError); ok && e.ExitCode() == 1 {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("exec %v failed: %s. Output was:\n\n%s", cmd.Args, err, out)
+	}
+	return string(bytes.TrimSpace(out)), nil
+}
+
+// splitLines splits s into its non-empty lines.
+func splitLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
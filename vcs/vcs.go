@@ -0,0 +1,177 @@
+// Package vcs defines the version control systems that srclib can
+// analyze and provides backends for git, Mercurial, and plain
+// (unversioned) directory trees.
+package vcs
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"sourcegraph.com/sourcegraph/srclib/util"
+)
+
+// A VCS is a version control system backend. It knows how to detect
+// repositories of its type and how to query them for information that
+// srclib needs to analyze a tree.
+type VCS interface {
+	// Type is the short name of the VCS (e.g., "git" or "hg"). It is
+	// also the value of (cli.Repo).VCSType.
+	Type() string
+
+	// Detect reports whether dir is the top-level directory of a
+	// repository of this type.
+	Detect(dir string) bool
+
+	// CommitID returns the commit ID of the working tree whose
+	// top-level directory is dir.
+	CommitID(dir string) (string, error)
+
+	// Remotes returns the repository's configured remotes (e.g.,
+	// "origin" and "upstream"), sorted by name.
+	Remotes(dir string) ([]Remote, error)
+
+	// ChangedFiles returns the list of files (relative to dir) that
+	// differ between the base and head commits.
+	ChangedFiles(dir, base, head string) ([]string, error)
+
+	// Renames returns the files that were renamed (or moved) between
+	// the base and head commits, sorted by their old paths.
+	Renames(dir, base, head string) ([]Rename, error)
+
+	// Commits returns the IDs of the commits that are ancestors of
+	// head (including head itself) but not of base, oldest first.
+	Commits(dir, base, head string) ([]string, error)
+
+	// Checkout updates the working tree to the given revision. It
+	// returns the revision that was previously checked out (a branch
+	// name, if any), so that it can be restored.
+	Checkout(dir, rev string) (prev string, err error)
+
+	// Dirty reports whether the working tree whose top-level
+	// directory is dir has uncommitted changes to tracked files.
+	// (Untracked files, such as srclib's build data, are ignored.)
+	Dirty(dir string) (bool, error)
+
+	// Blame returns the hunks of lines of the file (relative to dir)
+	// in the working tree, in line order, along with the commit that
+	// last changed each hunk. Lines that have not been committed are
+	// omitted.
+	Blame(dir, file string) ([]BlameHunk, error)
+
+	// Diff returns the hunks of lines that differ between the base
+	// and head commits, in the order of their files and lines.
+	Diff(dir, base, head string) ([]DiffHunk, error)
+
+	// ReadFileAt returns the contents of the file (relative to dir)
+	// at the given revision.
+	ReadFileAt(dir, rev, file string) ([]byte, error)
+
+	// CommitDate returns the date of the given commit.
+	CommitDate(dir, rev string) (time.Time, error)
+}
+
+// A BlameHunk is a range of consecutive lines in a file that were
+// last changed in the same commit.
+type BlameHunk struct {
+	StartLine, EndLine int // 1-indexed, inclusive
+
+	CommitID    string
+	Author      string
+	AuthorEmail string
+	AuthorDate  time.Time
+}
+
+// A Rename is a file that was renamed (or moved) between two commits.
+type Rename struct {
+	// OrigFile and File are the slash-separated paths of the file
+	// (relative to the repository root) at the base and head commits.
+	OrigFile, File string
+
+	// Similarity is the percentage (from 0 to 100) of the file's
+	// contents that are the same at both commits, as estimated by the
+	// VCS, or 0 if the VCS doesn't estimate it (as Mercurial, which
+	// records renames explicitly, doesn't).
+	Similarity int `json:",omitempty"`
+}
+
+// A Remote is a named remote repository location.
+type Remote struct {
+	Name string // remote name (e.g., "origin")
+	URL  string // clone URL
+}
+
+// ErrNoRepository is returned by FindRoot when no registered backend
+// detects a repository.
+var ErrNoRepository = errors.New("vcs: no repository found")
+
+// ErrNoHistory is returned by VCS backends that have no notion of
+// history (such as plain directories) when a history operation is
+// requested.
+var ErrNoHistory = errors.New("vcs: repository has no history")
+
+var (
+	// VCSes holds all registered VCS backends, keyed by type.
+	VCSes = make(map[string]VCS)
+
+	// orderedVCSes is the list of registered backends, in the order
+	// in which they are tried when detecting repositories.
+	orderedVCSes []VCS
+)
+
+// Register makes a VCS backend available for detection and lookup
+// by its type. Backends are tried in the order in which they were
+// registered. If Register is called twice with the same type or if v
+// is nil, it panics.
+func Register(v VCS) {
+	if v == nil {
+		panic("vcs: Register VCS is nil")
+	}
+	if _, dup := VCSes[v.Type()]; dup {
+		panic("vcs: Register called twice for VCS type " + v.Type())
+	}
+	VCSes[v.Type()] = v
+	orderedVCSes = append(orderedVCSes, v)
+}
+
+func init() {
+	Register(Git)
+	Register(Hg)
+	Register(Tree)
+	Register(Dir)
+}
+
+// Lookup returns the registered VCS backend with the given type.
+func Lookup(vcsType string) (VCS, error) {
+	if v, present := VCSes[vcsType]; present {
+		return v, nil
+	}
+	return nil, fmt.Errorf("unknown vcs type: %q", vcsType)
+}
+
+// FindRoot finds the top-level directory of the repository that
+// contains dir (or dir itself) by checking dir and each of its
+// ancestors with every registered backend, starting with the
+// innermost directory. If no repository is found, it returns
+// ErrNoRepository.
+//
+// The Dir backend never detects a repository, so unversioned trees
+// (e.g., extracted tarballs) must be opened with it explicitly, since
+// computing a tree's commit ID hashes all of its files.
+func FindRoot(dir string) (rootDir string, v VCS, err error) {
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return "", nil, err
+	}
+	ancestors := util.AncestorDirs(dir, true)
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		ancDir := ancestors[i]
+		for _, v := range orderedVCSes {
+			if v.Detect(ancDir) {
+				return ancDir, v, nil
+			}
+		}
+	}
+	return "", nil, ErrNoRepository
+}